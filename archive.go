@@ -0,0 +1,226 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+// ArchivedMessage is a signed request sent to CIS together with the raw CIS response, exactly as exchanged
+type ArchivedMessage struct {
+	// Operation is the name of the request message, e.g. "RacunZahtjev"
+	Operation string `json:"operation"`
+
+	// IdPoruke is the message ID from the request header, the key of the message in the archive
+	IdPoruke string `json:"id_poruke"`
+
+	// ZKI of the invoice (or the accompanying document) in the request, empty if there is none
+	ZKI string `json:"zki,omitempty"`
+
+	// JIR from the CIS response, empty if the request was not accepted
+	JIR string `json:"jir,omitempty"`
+
+	// Time the request was sent
+	Time time.Time `json:"time"`
+
+	// StatusCode is the HTTP status code of the response, 0 if no response was received
+	StatusCode int `json:"status_code"`
+
+	// Error is the error returned to the caller, empty on success
+	Error string `json:"error,omitempty"`
+
+	// Metadata describes the HTTP response and the TLS connection, nil if no response was received
+	Metadata *ResponseMetadata `json:"metadata,omitempty"`
+
+	// Request is the exact SOAP envelope sent to CIS, including the signature
+	Request []byte `json:"-"`
+
+	// Response is the raw response body as received from CIS, nil if no response was received
+	Response []byte `json:"-"`
+}
+
+// MessageArchive stores every signed request sent to CIS with the raw CIS response. The exact signed messages
+// prove what was fiscalized and when, which is invaluable during a tax inspection.
+//
+// Store is called synchronously after every signed exchange, successful or not. A failure to store is logged
+// and doesn't fail the request, the invoice is already fiscalized at that point.
+// Implementations must be safe for concurrent use, NewFileMessageArchive is the filesystem implementation.
+type MessageArchive interface {
+	Store(msg *ArchivedMessage) error
+}
+
+// WithMessageArchive archives the signed messages, see SetMessageArchive
+func WithMessageArchive(archive MessageArchive) Option {
+	return func(o *entityOptions) {
+		o.messageArchive = archive
+	}
+}
+
+// SetMessageArchive sets the archive storing every signed request and the CIS response. Use nil to remove it.
+func (fe *FiskalEntity) SetMessageArchive(archive MessageArchive) {
+	fe.hooksMu.Lock()
+	defer fe.hooksMu.Unlock()
+	fe.messageArchive = archive
+}
+
+// archiveExchange stores the signed exchange in the message archive if one is set
+func (fe *FiskalEntity) archiveExchange(exchange *Exchange) {
+	fe.hooksMu.RLock()
+	archive := fe.messageArchive
+	fe.hooksMu.RUnlock()
+	if archive == nil {
+		return
+	}
+
+	msg := &ArchivedMessage{
+		Operation:  exchange.Operation,
+		Time:       exchange.Started,
+		StatusCode: exchange.StatusCode,
+		Metadata:   exchange.Metadata,
+		Request:    exchange.Request,
+		Response:   exchange.Response,
+	}
+	if exchange.Err != nil {
+		msg.Error = exchange.Err.Error()
+	}
+	if request := etree.NewDocument(); request.ReadFromBytes(exchange.Request) == nil {
+		msg.IdPoruke = elementText(request, "//Zaglavlje/IdPoruke")
+		msg.ZKI = elementText(request, "//ZastKod")
+		if msg.ZKI == "" {
+			msg.ZKI = elementText(request, "//ZastKodPD")
+		}
+	}
+	if response := etree.NewDocument(); exchange.Err == nil && response.ReadFromBytes(exchange.Response) == nil {
+		msg.JIR = elementText(response, "//Jir")
+	}
+
+	if err := archive.Store(msg); err != nil {
+		fe.log(failureLevel, "failed to archive the CIS message", append(errorAttrs(err), slog.String("id_poruke", msg.IdPoruke))...)
+	}
+}
+
+// elementText returns the trimmed text of the first element matching the path, empty if there is none
+func elementText(doc *etree.Document, path string) string {
+	if el := doc.FindElement(path); el != nil {
+		return strings.TrimSpace(el.Text())
+	}
+	return ""
+}
+
+// archiveIDPattern limits the IdPoruke used as a file name
+var archiveIDPattern = regexp.MustCompile(`^[0-9A-Za-z-]{1,64}$`)
+
+// FileMessageArchive is a MessageArchive storing the messages in a directory, a subdirectory for every day
+// (YYYY/MM/DD) with three files for every message named by its IdPoruke: the signed request (.request.xml),
+// the response (.response.xml) and the metadata (.json).
+type FileMessageArchive struct {
+	dir string
+}
+
+// NewFileMessageArchive returns the archive storing the messages in the directory, it is created if it doesn't exist
+func NewFileMessageArchive(dir string) (*FileMessageArchive, error) {
+	if dir == "" {
+		return nil, errors.New("archive directory is required")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create the archive directory: %w", err)
+	}
+	return &FileMessageArchive{dir: dir}, nil
+}
+
+// Store writes the message files, a message with the same IdPoruke on the same day is replaced
+func (a *FileMessageArchive) Store(msg *ArchivedMessage) error {
+	if msg == nil || !archiveIDPattern.MatchString(msg.IdPoruke) {
+		return errors.New("archived message must have a valid IdPoruke")
+	}
+	dir := filepath.Join(a.dir, msg.Time.Format("2006"), msg.Time.Format("01"), msg.Time.Format("02"))
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	base := filepath.Join(dir, msg.IdPoruke)
+	if err := writeFileAtomic(base+".request.xml", msg.Request); err != nil {
+		return err
+	}
+	if msg.Response != nil {
+		if err := writeFileAtomic(base+".response.xml", msg.Response); err != nil {
+			return err
+		}
+	}
+	meta, err := json.MarshalIndent(msg, "", "  ")
+	if err != nil {
+		return err
+	}
+	// The metadata is written last, so a message is listed only when its files are complete
+	return writeFileAtomic(base+".json", meta)
+}
+
+// Get returns the message with the IdPoruke, nil if it's not in the archive
+func (a *FileMessageArchive) Get(idPoruke string) (*ArchivedMessage, error) {
+	messages, err := a.find(func(msg *ArchivedMessage) bool { return msg.IdPoruke == idPoruke })
+	if err != nil || len(messages) == 0 {
+		return nil, err
+	}
+	return messages[len(messages)-1], nil
+}
+
+// FindByZKI returns all messages of the invoice with the ZKI (e.g. the late delivery after a failed one), oldest first
+func (a *FileMessageArchive) FindByZKI(zki string) ([]*ArchivedMessage, error) {
+	return a.find(func(msg *ArchivedMessage) bool { return msg.ZKI == zki })
+}
+
+// FindByJIR returns the messages with the JIR in the response, oldest first
+func (a *FileMessageArchive) FindByJIR(jir string) ([]*ArchivedMessage, error) {
+	return a.find(func(msg *ArchivedMessage) bool { return msg.JIR == jir })
+}
+
+// find scans the metadata of all messages and loads the matching ones with the request and the response
+func (a *FileMessageArchive) find(match func(*ArchivedMessage) bool) ([]*ArchivedMessage, error) {
+	var messages []*ArchivedMessage
+	err := filepath.WalkDir(a.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".json") {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var msg ArchivedMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return fmt.Errorf("invalid archive metadata %s: %w", path, err)
+		}
+		if !match(&msg) {
+			return nil
+		}
+		base := strings.TrimSuffix(path, ".json")
+		if msg.Request, err = os.ReadFile(base + ".request.xml"); err != nil {
+			return err
+		}
+		if msg.Response, err = os.ReadFile(base + ".response.xml"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		messages = append(messages, &msg)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(messages, func(i, j int) bool { return messages[i].Time.Before(messages[j].Time) })
+	return messages, nil
+}
@@ -0,0 +1,81 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+func TestFileMessageArchive(t *testing.T) {
+	key, cert := newTestCISSigningCert(t)
+	var signedResponse bool
+	fe := newTestServerEntity(t, func(w http.ResponseWriter, r *http.Request) {
+		doc := etree.NewDocument()
+		if _, err := doc.ReadFrom(r.Body); err != nil {
+			t.Error(err)
+			return
+		}
+		response := fmt.Sprintf(testCISResponse, "G0x1", doc.FindElement("//IdPoruke").Text(), doc.FindElement("//DatumVrijeme").Text(), "9d6f5bb6-da48-4fcd-a803-4586a025e0e4")
+		if signedResponse {
+			response = signTestCISResponse(t, key, response, MakeC14N10RecCanonicalizer())
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprint(w, response)
+	})
+	fe.ciscert = newSignatureCheckCIScert(cert, fe.ciscert.SSLverifyPoll)
+
+	archive, err := NewFileMessageArchive(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fe.SetMessageArchive(archive)
+
+	invoice, zki, err := fe.NewCISInvoice(time.Now(), 1, 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "10.00", CISCash, "12345678901")
+	if err != nil {
+		t.Fatalf("Failed to create invoice: %v", err)
+	}
+	if _, _, err := invoice.InvoiceRequest(); err == nil {
+		t.Fatal("Expected the unsigned response to be rejected")
+	}
+	signedResponse = true
+	jir, _, err := invoice.InvoiceRequest()
+	if err != nil {
+		t.Fatalf("Failed to send invoice: %v", err)
+	}
+
+	messages, err := archive.FindByZKI(zki)
+	if err != nil || len(messages) != 2 {
+		t.Fatalf("Expected both exchanges of the invoice, got %d %v", len(messages), err)
+	}
+	failed, accepted := messages[0], messages[1]
+	if failed.Error == "" || failed.JIR != "" {
+		t.Errorf("Expected the failed exchange without the JIR, got %+v", failed)
+	}
+	if accepted.Operation != "RacunZahtjev" || accepted.JIR != jir || accepted.Error != "" || accepted.StatusCode != http.StatusOK {
+		t.Errorf("Unexpected archived message %+v", accepted)
+	}
+	if !bytes.Contains(accepted.Request, []byte("<SignatureValue>")) || !bytes.Contains(accepted.Response, []byte(jir)) {
+		t.Error("Expected the signed request and the raw response in the archive")
+	}
+
+	if byJIR, err := archive.FindByJIR(jir); err != nil || len(byJIR) != 1 || byJIR[0].IdPoruke != accepted.IdPoruke {
+		t.Errorf("Expected the message by the JIR, got %v", err)
+	}
+	if msg, err := archive.Get(accepted.IdPoruke); err != nil || msg == nil || !bytes.Equal(msg.Request, accepted.Request) {
+		t.Errorf("Expected the message by the IdPoruke, got %v", err)
+	}
+	if msg, err := archive.Get("f81d4fae-7dec-11d0-a765-00a0c91e6bf6"); err != nil || msg != nil {
+		t.Errorf("Expected nil for an unknown IdPoruke, got %v %v", msg, err)
+	}
+	if err := archive.Store(&ArchivedMessage{IdPoruke: "../escape", Time: time.Now()}); err == nil {
+		t.Error("Expected an error for an invalid IdPoruke")
+	}
+}
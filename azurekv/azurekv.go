@@ -0,0 +1,108 @@
+// Package azurekv signs fiscalization messages with an RSA key held in Azure Key Vault or Managed HSM,
+// so the private key never leaves the vault.
+//
+// CIS requires RSA PKCS #1 v1.5 signatures over SHA-1 digests. Key Vault signs them with the RSNULL algorithm,
+// where the caller provides the encoded DigestInfo, the RS256 family can't be used. The FINA certificate
+// is issued for the key (create a CSR signed by the vault key), and is passed together with the signer:
+//
+//	client, err := azkeys.NewClient("https://myvault.vault.azure.net/", credential, nil)
+//	signer, err := azurekv.New(client, "fiskal-key", "", cert)
+//	entity, err := fiskalhrgo.NewFiskalEntityWithOptions(oib, fiskalhrgo.WithLocation("POS1"), fiskalhrgo.WithSigner(signer, cert))
+package azurekv
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azkeys"
+)
+
+// DefaultTimeout of a signing request
+const DefaultTimeout = 10 * time.Second
+
+// SignatureAlgorithmRSNULL is the RSASSA-PKCS1-v1_5 algorithm over a caller encoded DigestInfo,
+// it has no constant in azkeys
+const SignatureAlgorithmRSNULL azkeys.SignatureAlgorithm = "RSNULL"
+
+// Client is the part of the Key Vault keys client used by the Signer, implemented by *azkeys.Client
+type Client interface {
+	Sign(ctx context.Context, name string, version string, parameters azkeys.SignParameters, options *azkeys.SignOptions) (azkeys.SignResponse, error)
+}
+
+// Signer is a crypto.Signer using a Key Vault key
+type Signer struct {
+	client  Client
+	name    string
+	version string
+	public  *rsa.PublicKey
+	timeout time.Duration
+}
+
+// New creates the signer for the key name and version (empty for the latest version),
+// the certificate must be issued for the key
+func New(client Client, name string, version string, cert *x509.Certificate) (*Signer, error) {
+	if client == nil {
+		return nil, errors.New("client is nil")
+	}
+	if name == "" {
+		return nil, errors.New("key name is required")
+	}
+	if cert == nil {
+		return nil, errors.New("certificate is nil")
+	}
+	public, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("certificate public key is not of RSA type")
+	}
+	return &Signer{client: client, name: name, version: version, public: public, timeout: DefaultTimeout}, nil
+}
+
+// SetTimeout sets the timeout of a signing request, DefaultTimeout if zero or negative
+func (s *Signer) SetTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	s.timeout = timeout
+}
+
+// Public implements crypto.Signer
+func (s *Signer) Public() crypto.PublicKey {
+	return s.public
+}
+
+// Sign implements crypto.Signer, it signs the digest with RSA PKCS #1 v1.5, PSS is not supported
+func (s *Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if _, ok := opts.(*rsa.PSSOptions); ok {
+		return nil, errors.New("PSS signatures are not supported")
+	}
+	hash := opts.HashFunc()
+	data, err := digestInfo(hash, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	algorithm := SignatureAlgorithmRSNULL
+	resp, err := s.client.Sign(ctx, s.name, s.version, azkeys.SignParameters{Algorithm: &algorithm, Value: data}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("key vault signing failed: %w", err)
+	}
+
+	signature := resp.Result
+	if err := rsa.VerifyPKCS1v15(s.public, hash, digest, signature); err != nil {
+		return nil, fmt.Errorf("key vault signature does not match the certificate: %w", err)
+	}
+	return signature, nil
+}
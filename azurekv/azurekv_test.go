@@ -0,0 +1,77 @@
+package azurekv
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"errors"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azkeys"
+)
+
+// fakeVault signs like Key Vault with the RSNULL algorithm
+type fakeVault struct {
+	key     *rsa.PrivateKey
+	name    string
+	version string
+}
+
+func (f *fakeVault) Sign(ctx context.Context, name string, version string, parameters azkeys.SignParameters, options *azkeys.SignOptions) (azkeys.SignResponse, error) {
+	f.name, f.version = name, version
+	if parameters.Algorithm == nil || *parameters.Algorithm != SignatureAlgorithmRSNULL {
+		return azkeys.SignResponse{}, errors.New("unexpected algorithm")
+	}
+	signature, err := rsa.SignPKCS1v15(nil, f.key, 0, parameters.Value)
+	if err != nil {
+		return azkeys.SignResponse{}, err
+	}
+	return azkeys.SignResponse{KeyOperationResult: azkeys.KeyOperationResult{Result: signature}}, nil
+}
+
+func TestSigner(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := &x509.Certificate{PublicKey: &key.PublicKey}
+	client := &fakeVault{key: key}
+
+	signer, err := New(client, "fiskal-key", "v1", cert)
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+
+	digest := sha1.Sum([]byte("ZKI data"))
+	signature, err := signer.Sign(rand.Reader, digest[:], crypto.SHA1)
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA1, digest[:], signature); err != nil {
+		t.Errorf("Signature doesn't verify: %v", err)
+	}
+	if client.name != "fiskal-key" || client.version != "v1" {
+		t.Errorf("Unexpected key %s/%s", client.name, client.version)
+	}
+
+	if _, err := signer.Sign(rand.Reader, digest[:5], crypto.SHA1); err == nil {
+		t.Errorf("Expected error for a wrong digest length")
+	}
+
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	wrongSigner, _ := New(&fakeVault{key: otherKey}, "fiskal-key", "", cert)
+	if _, err := wrongSigner.Sign(rand.Reader, digest[:], crypto.SHA1); err == nil {
+		t.Errorf("Expected error for a key not matching the certificate")
+	}
+
+	if _, err := New(client, "", "", cert); err == nil {
+		t.Errorf("Expected error without the key name")
+	}
+}
@@ -0,0 +1,29 @@
+package azurekv
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+)
+
+// digestInfoPrefix is the DER encoded DigestInfo up to the digest, see RFC 8017 section 9.2
+var digestInfoPrefix = map[crypto.Hash][]byte{
+	crypto.SHA1:   {0x30, 0x21, 0x30, 0x09, 0x06, 0x05, 0x2b, 0x0e, 0x03, 0x02, 0x1a, 0x05, 0x00, 0x04, 0x14},
+	crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+}
+
+// digestInfo returns the DER encoded DigestInfo of the digest, signed as is by the raw PKCS #1 algorithm
+func digestInfo(hash crypto.Hash, digest []byte) ([]byte, error) {
+	prefix, ok := digestInfoPrefix[hash]
+	if !ok {
+		return nil, fmt.Errorf("unsupported hash: %v", hash)
+	}
+	if len(digest) != hash.Size() {
+		return nil, errors.New("digest length does not match the hash")
+	}
+	return append(append(make([]byte, 0, len(prefix)+len(digest)), prefix...), digest...), nil
+}
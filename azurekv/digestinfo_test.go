@@ -0,0 +1,45 @@
+package azurekv
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"testing"
+)
+
+func TestDigestInfo(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sha1Digest := sha1.Sum([]byte("test"))
+	sha256Digest := sha256.Sum256([]byte("test"))
+	for hash, digest := range map[crypto.Hash][]byte{crypto.SHA1: sha1Digest[:], crypto.SHA256: sha256Digest[:]} {
+		info, err := digestInfo(hash, digest)
+		if err != nil {
+			t.Fatalf("%v: %v", hash, err)
+		}
+		// With hash zero the data is signed directly, like the raw KMS algorithms do
+		signature, err := rsa.SignPKCS1v15(nil, key, 0, info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, hash, digest, signature); err != nil {
+			t.Errorf("%v: raw signature of the DigestInfo doesn't verify: %v", hash, err)
+		}
+	}
+
+	if _, err := digestInfo(crypto.SHA1, sha256Digest[:]); err == nil {
+		t.Errorf("Expected error for a wrong digest length")
+	}
+	if _, err := digestInfo(crypto.MD5, make([]byte, 16)); err == nil {
+		t.Errorf("Expected error for an unsupported hash")
+	}
+}
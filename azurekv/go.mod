@@ -0,0 +1,13 @@
+module github.com/l-d-t/fiskalhrgo/azurekv
+
+go 1.22
+
+require github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azkeys v1.2.0
+
+require (
+	github.com/Azure/azure-sdk-for-go/sdk/azcore v1.16.0 // indirect
+	github.com/Azure/azure-sdk-for-go/sdk/internal v1.10.0 // indirect
+	github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/internal v1.1.0 // indirect
+	golang.org/x/net v0.30.0 // indirect
+	golang.org/x/text v0.19.0 // indirect
+)
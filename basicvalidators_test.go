@@ -139,3 +139,14 @@ func TestCheckOIB(t *testing.T) {
 		t.Fatalf("Expected OIB 12345678900 to be invalid")
 	}
 }
+
+func TestValidateIBAN(t *testing.T) {
+	if !ValidateIBAN("HR1210010051863000160") {
+		t.Fatalf("Expected IBAN HR1210010051863000160 to be valid")
+	}
+
+	// Valid MOD 97 check digits, but an invalid check digit of the bank code
+	if ValidateIBAN("HR4710010061863000160") {
+		t.Fatalf("Expected IBAN HR4710010061863000160 to be invalid")
+	}
+}
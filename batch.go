@@ -0,0 +1,115 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultBatchConcurrency is used when InvoiceRequestBatch is called with concurrency < 1
+const defaultBatchConcurrency = 4
+
+// BatchResult is the outcome of a single invoice sent with InvoiceRequestBatch
+type BatchResult struct {
+	// Index of the invoice in the input slice
+	Index int
+
+	// Invoice is the sent invoice
+	Invoice *RacunType
+
+	// ZKI and JIR of the invoice, JIR is empty if the request failed
+	ZKI string
+	JIR string
+
+	// Duration is the round-trip time of the request to CIS, zero if it was not sent
+	Duration time.Duration
+
+	// Err is the error of the request, nil on success
+	Err error
+}
+
+// BatchError is returned by InvoiceRequestBatch when at least one invoice failed.
+// errors.Is and errors.As check the errors of all failed invoices.
+type BatchError struct {
+	// Total is the number of invoices in the batch
+	Total int
+
+	// Failed holds the results of the failed invoices, in the input order
+	Failed []BatchResult
+}
+
+func (e *BatchError) Error() string {
+	messages := make([]string, 0, len(e.Failed))
+	for _, res := range e.Failed {
+		messages = append(messages, fmt.Sprintf("invoice %d (%s): %v", res.Index, invoiceNumber(res.Invoice), res.Err))
+	}
+	return fmt.Sprintf("%d of %d invoices failed: %s", len(e.Failed), e.Total, strings.Join(messages, "; "))
+}
+
+// Unwrap returns the errors of all failed invoices
+func (e *BatchError) Unwrap() []error {
+	errs := make([]error, len(e.Failed))
+	for i, res := range e.Failed {
+		errs[i] = res.Err
+	}
+	return errs
+}
+
+// InvoiceRequestBatch sends the invoices to CIS with at most concurrency requests in parallel
+// (4 if concurrency is less than 1), e.g. to resubmit the invoices issued during an outage.
+// Invoices without an entity (loaded from storage) are sent with this entity.
+//
+// The results are returned in the input order, one for every invoice. The error is a *BatchError
+// with all failed invoices, or nil if all of them were fiscalized.
+func (fe *FiskalEntity) InvoiceRequestBatch(invoices []*RacunType, concurrency int) ([]BatchResult, error) {
+	if concurrency < 1 {
+		concurrency = defaultBatchConcurrency
+	}
+
+	results := make([]BatchResult, len(invoices))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, invoice := range invoices {
+		results[i] = BatchResult{Index: i, Invoice: invoice}
+
+		switch {
+		case invoice == nil:
+			results[i].Err = newFiskalError(CategoryInput, errors.New("invoice is nil"))
+			continue
+		case invoice.pointerToEntity == nil:
+			invoice.pointerToEntity = fe
+		case invoice.pointerToEntity != fe:
+			results[i].ZKI = invoice.ZastKod
+			results[i].Err = newFiskalError(CategoryInput, errors.New("invoice belongs to another entity"))
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(res *BatchResult) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			result, err := res.Invoice.InvoiceRequestResult()
+			res.JIR, res.ZKI, res.Duration, res.Err = result.JIR, result.ZKI, result.Duration, err
+		}(&results[i])
+	}
+	wg.Wait()
+
+	batchErr := &BatchError{Total: len(invoices)}
+	for _, res := range results {
+		if res.Err != nil {
+			batchErr.Failed = append(batchErr.Failed, res)
+		}
+	}
+	if len(batchErr.Failed) > 0 {
+		return results, batchErr
+	}
+	return results, nil
+}
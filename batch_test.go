@@ -0,0 +1,63 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestInvoiceRequestBatch(t *testing.T) {
+	var inFlight, maxInFlight int32
+	fe := newTestServerEntity(t, func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	invoices := make([]*RacunType, 0, 7)
+	for i := 1; i <= 6; i++ {
+		invoice, _, err := fe.NewCISInvoice(time.Now(), uint(i), 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "10.00", CISCash, "12345678901")
+		if err != nil {
+			t.Fatalf("Failed to create invoice: %v", err)
+		}
+		invoices = append(invoices, invoice)
+	}
+	invoices = append(invoices, nil)
+
+	results, err := fe.InvoiceRequestBatch(invoices, 2)
+	if len(results) != len(invoices) {
+		t.Fatalf("Expected %d results, got %d", len(invoices), len(results))
+	}
+	for i, res := range results {
+		if res.Index != i || res.Invoice != invoices[i] || res.Err == nil {
+			t.Errorf("Unexpected result %d: %+v", i, res)
+		}
+		if sent := invoices[i] != nil; sent != (res.Duration >= 20*time.Millisecond) {
+			t.Errorf("Expected the round-trip duration of the sent invoices, got %s for %d", res.Duration, i)
+		}
+	}
+
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || batchErr.Total != 7 || len(batchErr.Failed) != 7 {
+		t.Fatalf("Expected BatchError with 7 failures, got %v", err)
+	}
+	if !IsRetriable(batchErr.Failed[0].Err) {
+		t.Errorf("Expected the unavailable CIS to be retriable, got %v", batchErr.Failed[0].Err)
+	}
+	if max := atomic.LoadInt32(&maxInFlight); max > 2 {
+		t.Errorf("Expected at most 2 parallel requests, got %d", max)
+	}
+}
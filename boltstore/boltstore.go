@@ -0,0 +1,274 @@
+// Package boltstore provides durable storage backends for fiskalhrgo based on bbolt,
+// a pure Go embedded key/value database. A single file holds all the data, so small
+// deployments (a POS device, a single server) get crash-safe storage without running a database server.
+package boltstore
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	fiskalhrgo "github.com/l-d-t/fiskalhrgo"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	queueBucket    = []byte("queue")
+	messagesBucket = []byte("messages")
+
+	// messageZKIBucket maps the ZKI to the IdPoruke of its last message record, for MessageStore.Lookup
+	messageZKIBucket = []byte("messages-zki")
+)
+
+// Store is a bbolt backed implementation of fiskalhrgo.QueueStore, Messages returns the fiskalhrgo.MessageStore
+// in the same file.
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens (or creates) the bbolt database file at path.
+// Only one process can have the file open at a time, a second Open waits up to 5 seconds and then fails.
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt database: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{queueBucket, messagesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		if tx.Bucket(messageZKIBucket) != nil {
+			return nil
+		}
+		// A database of an older version has the message records without the ZKI index
+		index, err := tx.CreateBucket(messageZKIBucket)
+		if err != nil {
+			return err
+		}
+		return indexMessages(tx.Bucket(messagesBucket), index)
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create buckets: %w", err)
+	}
+
+	return &Store{db: db}, nil
+}
+
+// Put inserts or replaces the queued invoice with the same ZKI
+func (s *Store) Put(item *fiskalhrgo.QueuedInvoice) error {
+	if item == nil || item.ZKI == "" {
+		return errors.New("queued invoice must have a ZKI")
+	}
+	data, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("failed to encode queued invoice: %w", err)
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(queueBucket).Put([]byte(item.ZKI), data)
+	})
+}
+
+// Get returns the queued invoice for the ZKI, or nil if it is not in the store
+func (s *Store) Get(zki string) (*fiskalhrgo.QueuedInvoice, error) {
+	var item *fiskalhrgo.QueuedInvoice
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(queueBucket).Get([]byte(zki))
+		if data == nil {
+			return nil
+		}
+		item = &fiskalhrgo.QueuedInvoice{}
+		return json.Unmarshal(data, item)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read queued invoice: %w", err)
+	}
+	return item, nil
+}
+
+// Delete removes the queued invoice with the ZKI, deleting a missing one is not an error
+func (s *Store) Delete(zki string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(queueBucket).Delete([]byte(zki))
+	})
+}
+
+// List returns all queued invoices ordered by QueuedAt (oldest first)
+func (s *Store) List() ([]*fiskalhrgo.QueuedInvoice, error) {
+	var list []*fiskalhrgo.QueuedInvoice
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(queueBucket).ForEach(func(k, v []byte) error {
+			item := &fiskalhrgo.QueuedInvoice{}
+			if err := json.Unmarshal(v, item); err != nil {
+				return fmt.Errorf("failed to decode queued invoice %s: %w", k, err)
+			}
+			list = append(list, item)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].QueuedAt.Before(list[j].QueuedAt)
+	})
+	return list, nil
+}
+
+// Close closes the database file
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// MessageStore is a bbolt backed implementation of fiskalhrgo.MessageStore
+type MessageStore struct {
+	db *bolt.DB
+}
+
+// Messages returns the store of the issued IdPoruke values, it is closed with the Store
+func (s *Store) Messages() *MessageStore {
+	return &MessageStore{db: s.db}
+}
+
+// Put inserts or replaces the record with the same IdPoruke
+func (s *MessageStore) Put(record *fiskalhrgo.MessageRecord) error {
+	if record == nil || record.IdPoruke == "" {
+		return errors.New("message record must have an IdPoruke")
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode message record: %w", err)
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(messagesBucket).Put([]byte(record.IdPoruke), data); err != nil {
+			return err
+		}
+		if record.ZKI == "" {
+			return nil
+		}
+		return tx.Bucket(messageZKIBucket).Put([]byte(record.ZKI), []byte(record.IdPoruke))
+	})
+}
+
+// Get returns the record with the IdPoruke, nil if it is not in the store
+func (s *MessageStore) Get(idPoruke string) (*fiskalhrgo.MessageRecord, error) {
+	var record *fiskalhrgo.MessageRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(messagesBucket).Get([]byte(idPoruke))
+		if data == nil {
+			return nil
+		}
+		record = &fiskalhrgo.MessageRecord{}
+		return json.Unmarshal(data, record)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read message record: %w", err)
+	}
+	return record, nil
+}
+
+// Lookup returns the last stored record of the invoice with the ZKI, nil if there is none
+func (s *MessageStore) Lookup(zki string) (*fiskalhrgo.MessageRecord, error) {
+	var record *fiskalhrgo.MessageRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		idPoruke := tx.Bucket(messageZKIBucket).Get([]byte(zki))
+		if idPoruke == nil {
+			return nil
+		}
+		data := tx.Bucket(messagesBucket).Get(idPoruke)
+		if data == nil {
+			return nil
+		}
+		record = &fiskalhrgo.MessageRecord{}
+		return json.Unmarshal(data, record)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read message record: %w", err)
+	}
+	return record, nil
+}
+
+// InFlight returns the records in the MessageInFlight state, oldest first
+func (s *MessageStore) InFlight() ([]*fiskalhrgo.MessageRecord, error) {
+	var list []*fiskalhrgo.MessageRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(messagesBucket).ForEach(func(k, v []byte) error {
+			record := &fiskalhrgo.MessageRecord{}
+			if err := json.Unmarshal(v, record); err != nil {
+				return fmt.Errorf("failed to decode message record %s: %w", k, err)
+			}
+			if record.State == fiskalhrgo.MessageInFlight {
+				list = append(list, record)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Created.Before(list[j].Created)
+	})
+	return list, nil
+}
+
+// Delete removes the record, deleting a missing one is not an error
+func (s *MessageStore) Delete(idPoruke string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		messages := tx.Bucket(messagesBucket)
+		data := messages.Get([]byte(idPoruke))
+		if data == nil {
+			return nil
+		}
+		record := &fiskalhrgo.MessageRecord{}
+		if err := json.Unmarshal(data, record); err != nil {
+			return fmt.Errorf("failed to decode message record %s: %w", idPoruke, err)
+		}
+		index := tx.Bucket(messageZKIBucket)
+		if string(index.Get([]byte(record.ZKI))) == idPoruke {
+			if err := index.Delete([]byte(record.ZKI)); err != nil {
+				return err
+			}
+		}
+		return messages.Delete([]byte(idPoruke))
+	})
+}
+
+// indexMessages adds the message records to the ZKI index, the newest record of a ZKI wins
+func indexMessages(messages *bolt.Bucket, index *bolt.Bucket) error {
+	latest := make(map[string]*fiskalhrgo.MessageRecord)
+	err := messages.ForEach(func(k, v []byte) error {
+		record := &fiskalhrgo.MessageRecord{}
+		if err := json.Unmarshal(v, record); err != nil {
+			return fmt.Errorf("failed to decode message record %s: %w", k, err)
+		}
+		if last, ok := latest[record.ZKI]; record.ZKI != "" && (!ok || record.Created.After(last.Created)) {
+			latest[record.ZKI] = record
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for zki, record := range latest {
+		if err := index.Put([]byte(zki), []byte(record.IdPoruke)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Make sure the stores implement the interfaces
+var (
+	_ fiskalhrgo.QueueStore   = (*Store)(nil)
+	_ fiskalhrgo.MessageStore = (*MessageStore)(nil)
+)
@@ -0,0 +1,188 @@
+package boltstore
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	fiskalhrgo "github.com/l-d-t/fiskalhrgo"
+	bolt "go.etcd.io/bbolt"
+)
+
+func testInvoice(zki string) *fiskalhrgo.RacunType {
+	return &fiskalhrgo.RacunType{
+		Oib:         "65049901548",
+		USustPdv:    true,
+		DatVrijeme:  "17.05.2024T16:00:38",
+		OznSlijed:   "P",
+		BrRac:       &fiskalhrgo.BrojRacunaType{BrOznRac: 13, OznPosPr: "TEST3", OznNapUr: 1},
+		Pdv:         &fiskalhrgo.PdvType{Porez: []*fiskalhrgo.PorezType{{Stopa: "25.00", Osnovica: "72.00", Iznos: "18.00"}}},
+		IznosUkupno: "90.00",
+		NacinPlac:   "G",
+		OibOper:     "12345678901",
+		ZastKod:     zki,
+	}
+}
+
+func TestQueueStorePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.db")
+
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	now := time.Now()
+	items := []*fiskalhrgo.QueuedInvoice{
+		{ZKI: "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Invoice: testInvoice("bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"), QueuedAt: now},
+		{ZKI: "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Invoice: testInvoice("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), QueuedAt: now.Add(-time.Hour), LastError: "no route to host"},
+	}
+	for _, item := range items {
+		if err := store.Put(item); err != nil {
+			t.Fatalf("Failed to put item: %v", err)
+		}
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("Failed to close store: %v", err)
+	}
+
+	// Reopen to make sure the data survived
+	store, err = Open(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer store.Close()
+
+	list, err := store.List()
+	if err != nil {
+		t.Fatalf("Failed to list items: %v", err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("Expected 2 items, got %d", len(list))
+	}
+	if list[0].ZKI != "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa" {
+		t.Errorf("Expected oldest item first, got %s", list[0].ZKI)
+	}
+	if list[0].LastError != "no route to host" {
+		t.Errorf("Expected LastError to be persisted, got %q", list[0].LastError)
+	}
+	if list[0].Invoice.BrRac.OznPosPr != "TEST3" || list[0].Invoice.IznosUkupno != "90.00" {
+		t.Errorf("Invoice data not persisted correctly: %+v", list[0].Invoice)
+	}
+
+	if err := store.Delete("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"); err != nil {
+		t.Fatalf("Failed to delete item: %v", err)
+	}
+
+	item, err := store.Get("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	if err != nil {
+		t.Fatalf("Failed to get item: %v", err)
+	}
+	if item != nil {
+		t.Errorf("Expected deleted item to be gone")
+	}
+
+	item, err = store.Get("bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
+	if err != nil || item == nil {
+		t.Fatalf("Expected item to be found, got %v, %v", item, err)
+	}
+}
+
+func TestMessageStorePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fiskal.db")
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	now := time.Now()
+	for _, record := range []*fiskalhrgo.MessageRecord{
+		{IdPoruke: "id-2", ZKI: "b", State: fiskalhrgo.MessageInFlight, Created: now},
+		{IdPoruke: "id-1", ZKI: "a", State: fiskalhrgo.MessageInFlight, Created: now.Add(-time.Hour), Error: "timeout"},
+		{IdPoruke: "id-3", ZKI: "c", State: fiskalhrgo.MessageRejected, Created: now, Error: "s006"},
+	} {
+		if err := store.Messages().Put(record); err != nil {
+			t.Fatalf("Failed to put record: %v", err)
+		}
+	}
+	if err := store.Messages().Put(&fiskalhrgo.MessageRecord{}); err == nil {
+		t.Error("Expected an error for a record without the IdPoruke")
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Failed to close store: %v", err)
+	}
+
+	store, err = Open(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer store.Close()
+	messages := store.Messages()
+
+	inFlight, err := messages.InFlight()
+	if err != nil || len(inFlight) != 2 || inFlight[0].IdPoruke != "id-1" || inFlight[0].Error != "timeout" {
+		t.Fatalf("Expected the in-flight records oldest first, got %+v %v", inFlight, err)
+	}
+	if record, err := messages.Get("id-3"); err != nil || record == nil || record.Error != "s006" {
+		t.Errorf("Expected the rejected record, got %+v %v", record, err)
+	}
+	if record, err := messages.Lookup("c"); err != nil || record == nil || record.IdPoruke != "id-3" {
+		t.Errorf("Expected the record of the ZKI, got %+v %v", record, err)
+	}
+	if err := messages.Delete("id-3"); err != nil {
+		t.Fatalf("Failed to delete record: %v", err)
+	}
+	if record, err := messages.Get("id-3"); err != nil || record != nil {
+		t.Errorf("Expected the deleted record to be gone, got %+v %v", record, err)
+	}
+	if record, err := messages.Lookup("c"); err != nil || record != nil {
+		t.Errorf("Expected no record of the ZKI after the delete, got %+v %v", record, err)
+	}
+}
+
+func TestMessageStoreIndexesOlderDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fiskal.db")
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	err = db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucket(messagesBucket)
+		if err != nil {
+			return err
+		}
+		for _, record := range []*fiskalhrgo.MessageRecord{
+			{IdPoruke: "id-1", ZKI: "a", State: fiskalhrgo.MessageRejected, Created: now.Add(-time.Hour)},
+			{IdPoruke: "id-2", ZKI: "a", State: fiskalhrgo.MessageInFlight, Created: now},
+		} {
+			data, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(record.IdPoruke), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer store.Close()
+	if record, err := store.Messages().Lookup("a"); err != nil || record == nil || record.IdPoruke != "id-2" {
+		t.Errorf("Expected the newest record of the ZKI, got %+v %v", record, err)
+	}
+}
@@ -5,19 +5,33 @@ package fiskalhrgo
 // Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
-	"os"
+	"math/big"
 	"strings"
 	"time"
 
+	"github.com/l-d-t/fiskalhrgo/internal/rfc6979"
+	"github.com/l-d-t/fiskalhrgo/sign"
+	"golang.org/x/crypto/cryptobyte"
+	"golang.org/x/crypto/cryptobyte/asn1"
 	"golang.org/x/crypto/pkcs12"
+	gopkcs12 "software.sslmate.com/src/go-pkcs12"
 )
 
-// certManager holds the private key, public certificate, and additional info
+// certManager holds the signer, public certificate, and additional info
 type certManager struct {
-	privateKey  *rsa.PrivateKey
+	// signer signs the ZKI and the XML messages, for a P12 certificate it is the *rsa.PrivateKey or *ecdsa.PrivateKey,
+	// otherwise the private key may live in an HSM, TPM or cloud KMS and never be exposed
+	signer      crypto.Signer
 	publicCert  *x509.Certificate
 	caCerts     []*x509.Certificate // This holds any CA certs
 	certORG     string
@@ -27,11 +41,18 @@ type certManager struct {
 	expired     bool
 	expire_soon bool
 	expire_days uint16
+
+	// SHA-1 and SHA-256 fingerprints of the DER encoded certificate, lowercase hex
+	fingerprintSHA1   string
+	fingerprintSHA256 string
+
+	// keyAlgorithm is the public key algorithm of the signer, x509.RSA or x509.ECDSA
+	keyAlgorithm x509.PublicKeyAlgorithm
 }
 
 func newCertManager() *certManager {
 	return &certManager{
-		privateKey:  nil,
+		signer:      nil,
 		publicCert:  nil,
 		caCerts:     []*x509.Certificate{},
 		certORG:     "",
@@ -44,24 +65,209 @@ func newCertManager() *certManager {
 	}
 }
 
-// decodeP12Cert loads and decodes a P12 certificate, extracting the private key, public cert, and CA certificates
-func (cm *certManager) decodeP12Cert(certPath string, password string) error {
-	// Read the P12 file
-	certBytes, err := os.ReadFile(certPath)
+// decodeP12Data decodes the P12 certificate data, extracting the private key, public cert, and CA certificates
+func (cm *certManager) decodeP12Data(certBytes []byte, password string) error {
+	privateKey, certificate, caCerts, err := parseP12(certBytes, password)
+	if err != nil {
+		return err
+	}
+
+	return cm.setSigner(privateKey, certificate, caCerts)
+}
+
+// setSigner sets the signer with its certificate and checks the certificate validity
+func (cm *certManager) setSigner(signer crypto.Signer, certificate *x509.Certificate, caCerts []*x509.Certificate) error {
+	if signer == nil {
+		return fmt.Errorf("signer is nil")
+	}
+	if certificate == nil {
+		return fmt.Errorf("certificate is nil")
+	}
+
+	// The fiscal certificates have RSA keys, ECDSA is supported in case FINA starts issuing EC certificates,
+	// and the key must belong to the certificate
+	keyAlgorithm, err := signerKeyAlgorithm(signer)
+	if err != nil {
+		return err
+	}
+	pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !pub.Equal(certificate.PublicKey) {
+		return fmt.Errorf("private key does not match the certificate")
+	}
+
+	// Store the parsed certificate information
+	cm.signer = signer
+	cm.keyAlgorithm = keyAlgorithm
+	cm.publicCert = certificate
+	cm.caCerts = caCerts
+
+	// Check if the certificate is expired
+	now := time.Now()
+	if now.Before(certificate.NotBefore) {
+		return fmt.Errorf("certificate is not valid yet: valid from %v", certificate.NotBefore)
+	}
+	if now.After(certificate.NotAfter) {
+		cm.expired = true
+	}
+
+	// Check if the certificate is expiring soon (within 30 days)
+	daysUntilExpiration := certificate.NotAfter.Sub(now).Hours() / 24
+	cm.expire_days = uint16(daysUntilExpiration)
+	if daysUntilExpiration <= expireSoonDays {
+		cm.expire_soon = true
+	}
+
+	// Extract the OIB
+	oib, err := cm.getCertOIB()
+	if err != nil {
+		return fmt.Errorf("error extracting OIB: %v", err)
+	}
+	cm.certOIB = oib
+	cm.certORG = certificate.Subject.Organization[0]
+	cm.certSERIAL = certificate.SerialNumber.String()
+	sha1Sum := sha1.Sum(certificate.Raw)
+	sha256Sum := sha256.Sum256(certificate.Raw)
+	cm.fingerprintSHA1 = hex.EncodeToString(sha1Sum[:])
+	cm.fingerprintSHA256 = hex.EncodeToString(sha256Sum[:])
+
+	cm.init_ok = true
+
+	return nil
+}
+
+// signerKeyAlgorithm returns the public key algorithm of the signer, only RSA and ECDSA keys are supported
+func signerKeyAlgorithm(signer crypto.Signer) (x509.PublicKeyAlgorithm, error) {
+	switch signer.Public().(type) {
+	case *rsa.PublicKey:
+		return x509.RSA, nil
+	case *ecdsa.PublicKey:
+		return x509.ECDSA, nil
+	default:
+		return x509.UnknownPublicKeyAlgorithm, fmt.Errorf("private key is not of RSA or ECDSA type")
+	}
+}
+
+// signSHA1 signs the SHA1 digest, as required by CIS for the ZKI and the XML signature. RSA keys sign with
+// PKCS #1 v1.5, ECDSA keys return r and s concatenated as XML-DSig expects. The ECDSA private keys
+// sign deterministically (RFC 6979), other ECDSA signers (HSM, KMS) with a random nonce.
+func (cm *certManager) signSHA1(digest []byte) ([]byte, error) {
+	if cm.signer == nil {
+		return nil, fmt.Errorf("signer is not set")
+	}
+	if cm.keyAlgorithm != x509.ECDSA {
+		return cm.signer.Sign(rand.Reader, digest, crypto.SHA1)
+	}
+
+	pub := cm.signer.Public().(*ecdsa.PublicKey)
+	if key, ok := cm.signer.(*ecdsa.PrivateKey); ok {
+		r, s, err := rfc6979.Sign(key, crypto.SHA1, digest)
+		if err != nil {
+			return nil, err
+		}
+		return ecdsaRawSignature(pub, r, s), nil
+	}
+	der, err := cm.signer.Sign(rand.Reader, digest, crypto.SHA1)
+	if err != nil {
+		return nil, err
+	}
+	var r, s big.Int
+	var inner cryptobyte.String
+	input := cryptobyte.String(der)
+	if !input.ReadASN1(&inner, asn1.SEQUENCE) || !input.Empty() ||
+		!inner.ReadASN1Integer(&r) || !inner.ReadASN1Integer(&s) || !inner.Empty() {
+		return nil, fmt.Errorf("invalid ECDSA signature from the signer")
+	}
+	return ecdsaRawSignature(pub, &r, &s), nil
+}
+
+// signZKI signs the SHA1 digest of the ZKI. The ZKI is recalculated to be verified, so the signature
+// has to be deterministic: RSA PKCS #1 v1.5 always is, ECDSA only when signing with the private key.
+func (cm *certManager) signZKI(digest []byte) ([]byte, error) {
+	if _, closed := cm.signer.(closedSigner); closed {
+		return nil, ErrEntityClosed
+	}
+	if cm.keyAlgorithm == x509.ECDSA {
+		if _, ok := cm.signer.(*ecdsa.PrivateKey); !ok {
+			return nil, fmt.Errorf("ZKI requires a deterministic signature, ECDSA keys must be an *ecdsa.PrivateKey")
+		}
+	}
+	return cm.signSHA1(digest)
+}
+
+// signatureMethod returns the XML-DSig signature method of the key
+func (cm *certManager) signatureMethod() string {
+	return sign.SignatureMethod(cm.keyAlgorithm, crypto.SHA1)
+}
+
+// ecdsaRawSignature encodes the signature as r and s, each padded to the size of the curve
+func ecdsaRawSignature(pub *ecdsa.PublicKey, r *big.Int, s *big.Int) []byte {
+	size := (pub.Curve.Params().N.BitLen() + 7) / 8
+	out := make([]byte, 2*size)
+	r.FillBytes(out[:size])
+	s.FillBytes(out[size:])
+	return out
+}
+
+// parseP12 decodes the P12 data into the RSA or ECDSA private key, the certificate and the CA certificates.
+// It uses go-pkcs12, which also supports the modern AES based encryption (PBES2) of newer bundles,
+// and falls back to golang.org/x/crypto/pkcs12 for bundles go-pkcs12 can't read.
+func parseP12(certBytes []byte, password string) (crypto.Signer, *x509.Certificate, []*x509.Certificate, error) {
+	key, certificate, caCerts, err := gopkcs12.DecodeChain(certBytes, password)
 	if err != nil {
-		return fmt.Errorf("failed to read certificate: %v", err)
+		privateKey, legacyCert, legacyCACerts, legacyErr := parseP12Legacy(certBytes, password)
+		if legacyErr != nil {
+			return nil, nil, nil, fmt.Errorf("failed to decode P12: %v", err)
+		}
+		return privateKey, legacyCert, legacyCACerts, nil
 	}
 
+	privateKey, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("private key is not of RSA or ECDSA type")
+	}
+	if _, err := signerKeyAlgorithm(privateKey); err != nil {
+		return nil, nil, nil, err
+	}
+	pub := privateKey.Public().(interface{ Equal(crypto.PublicKey) bool })
+
+	// The certificate order in the bundle is not guaranteed, the certificate is the one matching the private key
+	all := append([]*x509.Certificate{certificate}, caCerts...)
+	certificate, caCerts = nil, nil
+	for _, cert := range all {
+		if certificate == nil && pub.Equal(cert.PublicKey) {
+			certificate = cert
+		} else {
+			caCerts = append(caCerts, cert)
+		}
+	}
+	if certificate == nil {
+		return nil, nil, nil, fmt.Errorf("certificate matching the private key not found in P12 file")
+	}
+
+	return privateKey, certificate, caCerts, nil
+}
+
+// parseP12Legacy decodes the P12 data with golang.org/x/crypto/pkcs12
+func parseP12Legacy(certBytes []byte, password string) (crypto.Signer, *x509.Certificate, []*x509.Certificate, error) {
 	// Convert the P12 file to PEM blocks using the password
 	pemBlocks, err := pkcs12.ToPEM(certBytes, password)
 	if err != nil {
-		return fmt.Errorf("failed to convert P12 to PEM: %v", err)
+		return nil, nil, nil, fmt.Errorf("failed to convert P12 to PEM: %v", err)
 	}
 
-	var privateKey *rsa.PrivateKey
+	var privateKey crypto.Signer
 	var certificate *x509.Certificate
 	var caCerts []*x509.Certificate
 
+	// The PEM blocks of the private key are wiped once parsed
+	defer func() {
+		for _, block := range pemBlocks {
+			if block.Type == "PRIVATE KEY" {
+				wipeBytes(block.Bytes)
+			}
+		}
+	}()
+
 	// Iterate over the PEM blocks to extract the private key, certificate, and CA certificates
 	for _, block := range pemBlocks {
 		switch block.Type {
@@ -69,22 +275,28 @@ func (cm *certManager) decodeP12Cert(certPath string, password string) error {
 			// Try parsing the key as PKCS8 first
 			key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
 			if err != nil {
-				// If PKCS8 parsing fails, try PKCS1
+				// If PKCS8 parsing fails, try PKCS1 and SEC 1 (x/crypto/pkcs12 converts EC keys to SEC 1)
 				key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
 				if err != nil {
-					return fmt.Errorf("failed to parse private key (tried PKCS8 and PKCS1): %v", err)
+					key, err = x509.ParseECPrivateKey(block.Bytes)
+				}
+				if err != nil {
+					return nil, nil, nil, fmt.Errorf("failed to parse private key (tried PKCS8, PKCS1 and SEC 1): %v", err)
 				}
 			}
-			rsaKey, ok := key.(*rsa.PrivateKey)
+			signer, ok := key.(crypto.Signer)
 			if !ok {
-				return fmt.Errorf("private key is not of RSA type")
+				return nil, nil, nil, fmt.Errorf("private key is not of RSA or ECDSA type")
+			}
+			if _, err := signerKeyAlgorithm(signer); err != nil {
+				return nil, nil, nil, err
 			}
-			privateKey = rsaKey
+			privateKey = signer
 		case "CERTIFICATE":
 			// Parse the certificate
 			cert, err := x509.ParseCertificate(block.Bytes)
 			if err != nil {
-				return fmt.Errorf("failed to parse certificate: %v", err)
+				return nil, nil, nil, fmt.Errorf("failed to parse certificate: %v", err)
 			}
 			// Check if it's a CA cert (we assume it's a CA cert if it's not self-issued)
 			if cert.IsCA {
@@ -96,44 +308,13 @@ func (cm *certManager) decodeP12Cert(certPath string, password string) error {
 	}
 
 	if privateKey == nil {
-		return fmt.Errorf("private key not found in P12 file")
+		return nil, nil, nil, fmt.Errorf("private key not found in P12 file")
 	}
 	if certificate == nil {
-		return fmt.Errorf("certificate not found in P12 file")
-	}
-
-	// Store the parsed certificate information
-	cm.privateKey = privateKey
-	cm.publicCert = certificate
-	cm.caCerts = caCerts
-
-	// Check if the certificate is expired
-	now := time.Now()
-	if now.Before(certificate.NotBefore) {
-		return fmt.Errorf("certificate is not valid yet: valid from %v", certificate.NotBefore)
-	}
-	if now.After(certificate.NotAfter) {
-		cm.expired = true
-	}
-
-	// Check if the certificate is expiring soon (within 30 days)
-	daysUntilExpiration := certificate.NotAfter.Sub(now).Hours() / 24
-	cm.expire_days = uint16(daysUntilExpiration)
-	if daysUntilExpiration <= 30 {
-		cm.expire_soon = true
+		return nil, nil, nil, fmt.Errorf("certificate not found in P12 file")
 	}
 
-	// Extract the OIB
-	oib, err := cm.getCertOIB()
-	if err != nil {
-		return fmt.Errorf("error extracting OIB: %v", err)
-	}
-	cm.certOIB = oib
-	cm.certORG = certificate.Subject.Organization[0]
-
-	cm.init_ok = true
-
-	return nil
+	return privateKey, certificate, caCerts, nil
 }
 
 // getCertOIB extracts the OIB from the certificate's subject information
@@ -170,6 +351,8 @@ func (cm *certManager) displayCertInfoText() string {
 	result += fmt.Sprintf("Serial Number: %s\n", cm.publicCert.SerialNumber.String())
 	result += fmt.Sprintf("Valid From: %s\n", cm.publicCert.NotBefore.Format("02 Jan 2006 15:04:05 MST"))
 	result += fmt.Sprintf("Valid Until: %s\n", cm.publicCert.NotAfter.Format("02 Jan 2006 15:04:05 MST"))
+	result += fmt.Sprintf("SHA-1 Fingerprint: %s\n", cm.fingerprintSHA1)
+	result += fmt.Sprintf("SHA-256 Fingerprint: %s\n", cm.fingerprintSHA256)
 
 	// Display CA certificates if present
 	if len(cm.caCerts) > 0 {
@@ -194,6 +377,8 @@ func (cm *certManager) displayCertInfoMarkdown() string {
 	result += fmt.Sprintf("**Serial Number**: %s\n\n", cm.publicCert.SerialNumber.String())
 	result += fmt.Sprintf("**Valid From**: %s\n\n", cm.publicCert.NotBefore.Format("02 Jan 2006 15:04:05 MST"))
 	result += fmt.Sprintf("**Valid Until**: %s\n\n", cm.publicCert.NotAfter.Format("02 Jan 2006 15:04:05 MST"))
+	result += fmt.Sprintf("**SHA-1 Fingerprint**: %s\n\n", cm.fingerprintSHA1)
+	result += fmt.Sprintf("**SHA-256 Fingerprint**: %s\n\n", cm.fingerprintSHA256)
 
 	// Display CA certificates if present
 	if len(cm.caCerts) > 0 {
@@ -218,6 +403,8 @@ func (cm *certManager) displayCertInfoHTML() string {
 	result += fmt.Sprintf("<p><strong>Serial Number:</strong> %s</p>", cm.publicCert.SerialNumber.String())
 	result += fmt.Sprintf("<p><strong>Valid From:</strong> %s</p>", cm.publicCert.NotBefore.Format("02 Jan 2006 15:04:05 MST"))
 	result += fmt.Sprintf("<p><strong>Valid Until:</strong> %s</p>", cm.publicCert.NotAfter.Format("02 Jan 2006 15:04:05 MST"))
+	result += fmt.Sprintf("<p><strong>SHA-1 Fingerprint:</strong> %s</p>", cm.fingerprintSHA1)
+	result += fmt.Sprintf("<p><strong>SHA-256 Fingerprint:</strong> %s</p>", cm.fingerprintSHA256)
 
 	// Display CA certificates if present
 	if len(cm.caCerts) > 0 {
@@ -232,6 +419,76 @@ func (cm *certManager) displayCertInfoHTML() string {
 	return result
 }
 
+// CertInfo describes the certificate, for the JSON representation (DisplayCertInfoJSON)
+type CertInfo struct {
+	Issuer            string       `json:"issuer"`
+	Subject           string       `json:"subject"`
+	SerialNumber      string       `json:"serial_number"`
+	Organization      string       `json:"organization"`
+	OIB               string       `json:"oib"`
+	ValidFrom         time.Time    `json:"valid_from"`
+	ValidUntil        time.Time    `json:"valid_until"`
+	Expired           bool         `json:"expired"`
+	ExpiringSoon      bool         `json:"expiring_soon"`
+	DaysUntilExpiry   int          `json:"days_until_expiry"`
+	FingerprintSHA1   string       `json:"fingerprint_sha1"`
+	FingerprintSHA256 string       `json:"fingerprint_sha256"`
+	CACerts           []CACertInfo `json:"ca_certificates"`
+}
+
+// CACertInfo describes a CA certificate from the P12 bundle
+type CACertInfo struct {
+	Issuer       string    `json:"issuer"`
+	Subject      string    `json:"subject"`
+	SerialNumber string    `json:"serial_number"`
+	ValidUntil   time.Time `json:"valid_until"`
+}
+
+// certInfo returns the certificate details, nil if no certificate is loaded
+func (cm *certManager) certInfo() *CertInfo {
+	if cm.publicCert == nil {
+		return nil
+	}
+
+	info := &CertInfo{
+		Issuer:            cm.publicCert.Issuer.String(),
+		Subject:           cm.publicCert.Subject.String(),
+		SerialNumber:      cm.publicCert.SerialNumber.String(),
+		Organization:      cm.certORG,
+		OIB:               cm.certOIB,
+		ValidFrom:         cm.publicCert.NotBefore,
+		ValidUntil:        cm.publicCert.NotAfter,
+		Expired:           cm.expired,
+		ExpiringSoon:      cm.expire_soon,
+		DaysUntilExpiry:   int(time.Until(cm.publicCert.NotAfter).Hours() / 24),
+		FingerprintSHA1:   cm.fingerprintSHA1,
+		FingerprintSHA256: cm.fingerprintSHA256,
+		CACerts:           []CACertInfo{},
+	}
+	for _, caCert := range cm.caCerts {
+		info.CACerts = append(info.CACerts, CACertInfo{
+			Issuer:       caCert.Issuer.String(),
+			Subject:      caCert.Subject.String(),
+			SerialNumber: caCert.SerialNumber.String(),
+			ValidUntil:   caCert.NotAfter,
+		})
+	}
+	return info
+}
+
+func (cm *certManager) displayCertInfoJSON() string {
+	info := cm.certInfo()
+	if info == nil {
+		return `{"error":"No public certificate available."}`
+	}
+
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return fmt.Sprintf(`{"error":%q}`, err.Error())
+	}
+	return string(data)
+}
+
 func (cm *certManager) displayCertInfoKeyPoints() [][2]string {
 	var result [][2]string
 
@@ -245,6 +502,8 @@ func (cm *certManager) displayCertInfoKeyPoints() [][2]string {
 	result = append(result, [2]string{"Serial Number", cm.publicCert.SerialNumber.String()})
 	result = append(result, [2]string{"Valid From", cm.publicCert.NotBefore.Format("02 Jan 2006 15:04:05 MST")})
 	result = append(result, [2]string{"Valid Until", cm.publicCert.NotAfter.Format("02 Jan 2006 15:04:05 MST")})
+	result = append(result, [2]string{"SHA-1 Fingerprint", cm.fingerprintSHA1})
+	result = append(result, [2]string{"SHA-256 Fingerprint", cm.fingerprintSHA256})
 
 	// Display CA certificates if present
 	if len(cm.caCerts) > 0 {
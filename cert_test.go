@@ -0,0 +1,266 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/l-d-t/fiskalhrgo/fiskaltest"
+	xpkcs12 "golang.org/x/crypto/pkcs12"
+	gopkcs12 "software.sslmate.com/src/go-pkcs12"
+)
+
+// newP12TestCert creates a certificate with a CA in the FINA subject format, valid for a year
+func newP12TestCert(t *testing.T, oib string) (*rsa.PrivateKey, *x509.Certificate, *x509.Certificate) {
+	t.Helper()
+	return newP12TestCertValidity(t, oib, time.Now().Add(-time.Hour), time.Now().Add(365*24*time.Hour))
+}
+
+// newP12TestCertValidity creates a certificate with a CA in the FINA subject format, with the validity period
+func newP12TestCertValidity(t *testing.T, oib string, notBefore time.Time, notAfter time.Time) (*rsa.PrivateKey, *x509.Certificate, *x509.Certificate) {
+	t.Helper()
+	cert, err := fiskaltest.NewCertificateValidity(oib, notBefore, notAfter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.Key, cert.Cert, cert.CACert
+}
+
+// newP12TestECCert creates a certificate with an ECDSA P-256 key, issued by an RSA CA like newP12TestCert
+func newP12TestECCert(t *testing.T, oib string) (*ecdsa.PrivateKey, *x509.Certificate, *x509.Certificate) {
+	t.Helper()
+	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test EC CA", Country: []string{"HR"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, _ := x509.ParseCertificate(caDER)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "FISKAL 1", Organization: []string{"TEST D.O.O. HR" + oib}, Country: []string{"HR"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return key, cert, caCert
+}
+
+func TestDecodeP12Encodings(t *testing.T) {
+	const oib = "12345678903"
+	key, cert, caCert := newP12TestCert(t, oib)
+
+	encoders := map[string]*gopkcs12.Encoder{
+		"modern AES": gopkcs12.Modern,
+		"legacy RC2": gopkcs12.LegacyRC2,
+		"legacy DES": gopkcs12.LegacyDES,
+	}
+	for name, encoder := range encoders {
+		data, err := encoder.Encode(key, cert, []*x509.Certificate{caCert}, "secret")
+		if err != nil {
+			t.Fatalf("%s: failed to encode: %v", name, err)
+		}
+
+		cm := newCertManager()
+		if err := cm.decodeP12Data(data, "secret"); err != nil {
+			t.Errorf("%s: failed to decode: %v", name, err)
+			continue
+		}
+		if !cm.publicCert.Equal(cert) || cm.certOIB != oib || len(cm.caCerts) != 1 || !cm.caCerts[0].Equal(caCert) {
+			t.Errorf("%s: unexpected decoded certificate", name)
+		}
+
+		if err := newCertManager().decodeP12Data(data, "wrong"); err == nil {
+			t.Errorf("%s: expected error with a wrong password", name)
+		}
+	}
+}
+
+func TestDecodeP12ModernNotSupportedByLegacyParser(t *testing.T) {
+	key, cert, _ := newP12TestCert(t, "12345678903")
+	data, err := gopkcs12.Modern.Encode(key, cert, nil, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// This is why go-pkcs12 is used, the x/crypto parser can't read AES encrypted bundles
+	if _, err := xpkcs12.ToPEM(data, "secret"); err == nil {
+		t.Skip("x/crypto/pkcs12 reads AES encrypted bundles now")
+	}
+	if _, _, _, err := parseP12(data, "secret"); err != nil {
+		t.Errorf("Failed to decode the AES encrypted bundle: %v", err)
+	}
+}
+
+func TestDecodeP12CAFirst(t *testing.T) {
+	key, cert, caCert := newP12TestCert(t, "12345678903")
+	// The CA certificate is stored first, the certificate must still be found by the private key
+	data, err := gopkcs12.Modern.Encode(key, caCert, []*x509.Certificate{cert}, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, decoded, caCerts, err := parseP12(data, "secret")
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if !decoded.Equal(cert) || len(caCerts) != 1 || !caCerts[0].Equal(caCert) {
+		t.Errorf("Expected the certificate matching the private key")
+	}
+}
+
+// ecdsaSigner hides the private key type, like an HSM or a cloud KMS signer
+type ecdsaSigner struct {
+	key *ecdsa.PrivateKey
+}
+
+func (s ecdsaSigner) Public() crypto.PublicKey { return &s.key.PublicKey }
+
+func (s ecdsaSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.key.Sign(rand, digest, opts)
+}
+
+func TestECDSACertificate(t *testing.T) {
+	key, cert, caCert := newP12TestECCert(t, testOIB)
+
+	for name, encoder := range map[string]*gopkcs12.Encoder{"modern AES": gopkcs12.Modern, "legacy RC2": gopkcs12.LegacyRC2} {
+		data, err := encoder.Encode(key, cert, []*x509.Certificate{caCert}, "secret")
+		if err != nil {
+			t.Fatalf("%s: failed to encode: %v", name, err)
+		}
+		decodedKey, decoded, _, err := parseP12(data, "secret")
+		if err != nil {
+			t.Fatalf("%s: failed to decode: %v", name, err)
+		}
+		if ecKey, ok := decodedKey.(*ecdsa.PrivateKey); !ok || !ecKey.Equal(key) || !decoded.Equal(cert) {
+			t.Errorf("%s: unexpected decoded key or certificate", name)
+		}
+	}
+	// The legacy parser reads the EC key in the SEC 1 format
+	data, err := gopkcs12.LegacyRC2.Encode(key, cert, nil, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if legacyKey, _, _, err := parseP12Legacy(data, "secret"); err != nil || !legacyKey.(*ecdsa.PrivateKey).Equal(key) {
+		t.Errorf("Legacy parser failed to decode the EC key: %v", err)
+	}
+
+	data, err = gopkcs12.Modern.Encode(key, cert, []*x509.Certificate{caCert}, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fe, err := NewFiskalEntityWithOptions(testOIB, WithLocation("ECDSA1"), WithCertP12(data, "secret"), WithChainVerification(false))
+	if err != nil {
+		t.Fatalf("Failed to create entity: %v", err)
+	}
+
+	// The ZKI must be the same every time, so it can be verified
+	issued := time.Now()
+	zki, err := fe.generateZKI(fe.certificate(), issued, 1, 1, "10.00")
+	if err != nil {
+		t.Fatalf("Failed to generate ZKI: %v", err)
+	}
+	again, _ := fe.generateZKI(fe.certificate(), issued, 1, 1, "10.00")
+	if zki != again || !ValidateZKI(zki) {
+		t.Errorf("Expected a deterministic ZKI, got %s and %s", zki, again)
+	}
+	if found, err := fe.FindZKICertificate(zki, issued, 1, 1, "10.00"); err != nil || !found.Cert.Equal(cert) {
+		t.Errorf("Expected the ZKI to match the certificate, got %v", err)
+	}
+
+	signed, err := fe.signXML([]byte(`<Test Id="t1"><A>1</A></Test>`))
+	if err != nil {
+		t.Fatalf("Failed to sign XML: %v", err)
+	}
+	if !strings.Contains(string(signed), `Algorithm="`+ECDSASHA1SignatureMethod+`"`) {
+		t.Errorf("Expected the ECDSA signature method, got %s", signed)
+	}
+
+	// A signer that is not the private key can sign the XML, but not the ZKI
+	cm := newCertManager()
+	if err := cm.setSigner(ecdsaSigner{key}, cert, nil); err != nil {
+		t.Fatalf("Failed to set the signer: %v", err)
+	}
+	digest := sha1.Sum([]byte("test"))
+	if signature, err := cm.signSHA1(digest[:]); err != nil || len(signature) != 64 {
+		t.Errorf("Expected a raw P-256 signature, got %d bytes %v", len(signature), err)
+	}
+	if _, err := fe.generateZKI(cm, issued, 1, 1, "10.00"); err == nil {
+		t.Errorf("Expected an error for a non deterministic ZKI signer")
+	}
+}
+
+func TestCertFingerprints(t *testing.T) {
+	raw := testEntity.certificate().publicCert.Raw
+	sha1Sum := sha1.Sum(raw)
+	sha256Sum := sha256.Sum256(raw)
+
+	if fp := testEntity.GetCertFingerprintSHA1(); fp != hex.EncodeToString(sha1Sum[:]) || len(fp) != 40 {
+		t.Errorf("Unexpected SHA-1 fingerprint %s", fp)
+	}
+	if fp := testEntity.GetCertFingerprintSHA256(); fp != hex.EncodeToString(sha256Sum[:]) || len(fp) != 64 {
+		t.Errorf("Unexpected SHA-256 fingerprint %s", fp)
+	}
+
+	for name, info := range map[string]string{
+		"text":     testEntity.DisplayCertInfoText(),
+		"markdown": testEntity.DisplayCertInfoMarkdown(),
+		"html":     testEntity.DisplayCertInfoHTML(),
+	} {
+		if !strings.Contains(info, testEntity.GetCertFingerprintSHA1()) || !strings.Contains(info, testEntity.GetCertFingerprintSHA256()) {
+			t.Errorf("Expected the fingerprints in the %s certificate info", name)
+		}
+	}
+}
+
+func TestDisplayCertInfoJSON(t *testing.T) {
+	var info CertInfo
+	if err := json.Unmarshal([]byte(testEntity.DisplayCertInfoJSON()), &info); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	cert := testEntity.certificate().publicCert
+	if info.SerialNumber != testEntity.GetCertSERIAL() || info.OIB != testOIB || info.FingerprintSHA256 != testEntity.GetCertFingerprintSHA256() ||
+		!info.ValidUntil.Equal(cert.NotAfter) || info.Subject != cert.Subject.String() || info.CACerts == nil {
+		t.Errorf("Unexpected certificate info %+v", info)
+	}
+
+	if info := newCertManager().displayCertInfoJSON(); !json.Valid([]byte(info)) || !strings.Contains(info, "error") {
+		t.Errorf("Expected an error object without a certificate, got %s", info)
+	}
+}
@@ -0,0 +1,185 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrZKIMismatch is returned when the ZKI doesn't match any known certificate of the entity
+var ErrZKIMismatch = errors.New("ZKI does not match any known certificate")
+
+// CertArchive keeps the old (usually expired) certificates of an entity, indexed by the serial number
+// and the fingerprints. The ZKI of an invoice can only be recalculated with the certificate that produced it,
+// which is needed when an invoice is delivered late after the certificate was renewed, and during an inspection.
+//
+// Every entity has an archive, the certificates replaced by ReloadCertificate and RotateCertificate are added
+// to it automatically. Add the certificates from previous years at startup with AddFile or AddP12.
+type CertArchive struct {
+	mu    sync.RWMutex
+	certs []*Certificate
+}
+
+// NewCertArchive returns an empty archive
+func NewCertArchive() *CertArchive {
+	return &CertArchive{}
+}
+
+// Add adds the certificate to the archive, a certificate already in the archive is ignored
+func (a *CertArchive) Add(cert *Certificate) error {
+	if cert == nil || cert.Cert == nil {
+		return errors.New("certificate is nil")
+	}
+	if cert.Signer == nil {
+		return errors.New("certificate signer is nil")
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, c := range a.certs {
+		if c.FingerprintSHA256() == cert.FingerprintSHA256() {
+			return nil
+		}
+	}
+	a.certs = append(a.certs, cert)
+	return nil
+}
+
+// AddP12 decodes the P12 certificate and adds it to the archive
+func (a *CertArchive) AddP12(data []byte, password string) error {
+	cert, err := ParseP12(data, password)
+	if err != nil {
+		return fmt.Errorf("certificate decode fail: %v", err)
+	}
+	return a.Add(cert)
+}
+
+// AddFile loads the P12 certificate from the file and adds it to the archive
+func (a *CertArchive) AddFile(path string, password string) error {
+	//check path is valid
+	if !IsFileReadable(path) {
+		return fmt.Errorf("invalid certificate path or file not readable: %s", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read certificate: %v", err)
+	}
+	defer wipeBytes(data)
+	return a.AddP12(data, password)
+}
+
+// Find returns the certificate by the reference: the serial number (decimal, as GetCertSERIAL), or the SHA-1
+// or SHA-256 fingerprint (hex, case and colons are ignored). ErrCertificateNotFound if it's not in the archive.
+func (a *CertArchive) Find(ref string) (*Certificate, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return findByRef(a.certs, ref)
+}
+
+// List returns the archived certificates, in the order they were added
+func (a *CertArchive) List() []*Certificate {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return append([]*Certificate(nil), a.certs...)
+}
+
+// findByRef returns the certificate with the serial number or the fingerprint
+func findByRef(certs []*Certificate, ref string) (*Certificate, error) {
+	fingerprint := strings.ToLower(strings.ReplaceAll(ref, ":", ""))
+	for _, cert := range certs {
+		if cert.Serial() == ref || cert.FingerprintSHA1() == fingerprint || cert.FingerprintSHA256() == fingerprint {
+			return cert, nil
+		}
+	}
+	return nil, ErrCertificateNotFound
+}
+
+// WithCertArchive uses the archive for the old certificates, e.g. to share it between entities of the same OIB.
+// By default every entity has its own empty archive.
+func WithCertArchive(archive *CertArchive) Option {
+	return func(o *entityOptions) {
+		o.archive = archive
+	}
+}
+
+// CertArchive returns the archive of the old certificates
+func (fe *FiskalEntity) CertArchive() *CertArchive {
+	fe.certMu.RLock()
+	defer fe.certMu.RUnlock()
+	return fe.archive
+}
+
+// knownCertificates returns all certificates of the entity without duplicates: the current one first,
+// then the ones from the certificate provider and the archive
+func (fe *FiskalEntity) knownCertificates() []*Certificate {
+	cm := fe.certificate()
+	certs := []*Certificate{{Signer: cm.signer, Cert: cm.publicCert, CACerts: cm.caCerts}}
+	seen := map[string]bool{cm.fingerprintSHA256: true}
+	add := func(list []*Certificate) {
+		for _, cert := range list {
+			if cert != nil && cert.Cert != nil && !seen[cert.FingerprintSHA256()] {
+				seen[cert.FingerprintSHA256()] = true
+				certs = append(certs, cert)
+			}
+		}
+	}
+	if provider := fe.CertProvider(); provider != nil {
+		if historical, err := provider.ListHistorical(); err == nil {
+			add(historical)
+		}
+	}
+	if archive := fe.CertArchive(); archive != nil {
+		add(archive.List())
+	}
+	return certs
+}
+
+// FindCertificate returns a certificate of the entity (the current one, from the certificate provider or the archive)
+// by the serial number or the SHA-1 or SHA-256 fingerprint, ErrCertificateNotFound if it's not known
+func (fe *FiskalEntity) FindCertificate(ref string) (*Certificate, error) {
+	return findByRef(fe.knownCertificates(), ref)
+}
+
+// FindZKICertificate returns the certificate that produced the ZKI of the invoice, trying all known certificates of
+// the entity, the current one first. ErrZKIMismatch is returned if none matches, so the invoice data was modified
+// or the certificate is missing from the archive. Use it to validate a stored ZKI without knowing its certificate.
+func (fe *FiskalEntity) FindZKICertificate(zki string, issueDateTime time.Time, invoiceNumber uint, deviceID uint, totalAmount string) (*Certificate, error) {
+	if !IsValidCurrencyFormat(totalAmount) {
+		return nil, errors.New("invalid totalAmount format; expected a string with 2 decimal places (e.g., 100.00)")
+	}
+	for _, cert := range fe.knownCertificates() {
+		cm, err := fe.certManagerFor(cert)
+		if err != nil {
+			continue
+		}
+		calculated, err := fe.generateZKI(cm, issueDateTime, invoiceNumber, deviceID, totalAmount)
+		if err != nil {
+			return nil, err
+		}
+		if calculated == zki {
+			return cert, nil
+		}
+	}
+	return nil, ErrZKIMismatch
+}
+
+// certManagerFor prepares the certificate of the entity OIB for signing, expired certificates are allowed
+func (fe *FiskalEntity) certManagerFor(cert *Certificate) (*certManager, error) {
+	if current := fe.certificate(); cert.Cert != nil && cert.Cert.Equal(current.publicCert) {
+		return current, nil
+	}
+	cm := newCertManager()
+	if err := cm.setSigner(cert.Signer, cert.Cert, cert.CACerts); err != nil {
+		return nil, fmt.Errorf("certificate setup fail: %v", err)
+	}
+	if cm.certOIB != fe.oib {
+		return nil, errors.New("OIB does not match the certificate")
+	}
+	return cm, nil
+}
@@ -0,0 +1,153 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCertArchiveFind(t *testing.T) {
+	key, cert, _ := newP12TestCert(t, testOIB)
+	archived := &Certificate{Signer: key, Cert: cert}
+
+	archive := NewCertArchive()
+	if err := archive.Add(archived); err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.Add(&Certificate{Signer: key, Cert: cert}); err != nil || len(archive.List()) != 1 {
+		t.Errorf("Expected the duplicate to be ignored, got %d certificates %v", len(archive.List()), err)
+	}
+	if err := archive.Add(&Certificate{Cert: cert}); err == nil {
+		t.Errorf("Expected error for a certificate without the signer")
+	}
+
+	colons := strings.ToUpper(archived.FingerprintSHA1()[:2] + ":" + archived.FingerprintSHA1()[2:])
+	for _, ref := range []string{archived.Serial(), archived.FingerprintSHA1(), archived.FingerprintSHA256(), colons} {
+		if found, err := archive.Find(ref); err != nil || found != archived {
+			t.Errorf("Expected to find the certificate by %s, got %v", ref, err)
+		}
+	}
+	if _, err := archive.Find("123"); !errors.Is(err, ErrCertificateNotFound) {
+		t.Errorf("Expected ErrCertificateNotFound, got %v", err)
+	}
+}
+
+func TestLateDeliveryWithArchivedCertificate(t *testing.T) {
+	oldKey, oldCert, _ := newP12TestCert(t, testOIB)
+	newKey, newCert, _ := newP12TestCert(t, testOIB)
+	old := &Certificate{Signer: oldKey, Cert: oldCert}
+	renewed := &Certificate{Signer: newKey, Cert: newCert}
+
+	fe, err := NewFiskalEntityWithOptions(testOIB, WithLocation("ARCH1"), WithSigner(oldKey, oldCert), WithChainVerification(false))
+	if err != nil {
+		t.Fatalf("Failed to create entity: %v", err)
+	}
+	issued := time.Now().Add(-time.Hour)
+	_, oldZKI, err := fe.NewCISInvoice(issued, 5, 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "10.00", CISCash, "12345678901")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The renewed certificate comes from a provider that doesn't know the old one, it's kept in the archive
+	provider, _ := NewMemoryCertProvider(renewed)
+	if err := fe.replaceCertificate(renewed, provider); err != nil {
+		t.Fatalf("Failed to replace the certificate: %v", err)
+	}
+	if _, err := fe.CertArchive().Find(old.FingerprintSHA256()); err != nil {
+		t.Fatalf("Expected the replaced certificate in the archive: %v", err)
+	}
+
+	if cert, err := fe.FindZKICertificate(oldZKI, issued, 5, 1, "10.00"); err != nil || cert.Serial() != old.Serial() {
+		t.Errorf("Expected the old certificate to match the ZKI, got %v", err)
+	}
+	if zki, err := fe.GenerateZKIWithCertificate(old.FingerprintSHA1(), issued, 5, 1, "10.00"); err != nil || zki != oldZKI {
+		t.Errorf("Expected the ZKI of the archived certificate, got %s %v", zki, err)
+	}
+	if _, err := fe.FindZKICertificate(oldZKI, issued, 5, 1, "11.00"); !errors.Is(err, ErrZKIMismatch) {
+		t.Errorf("Expected ErrZKIMismatch for modified invoice data, got %v", err)
+	}
+
+	invoice, newZKI, _ := fe.NewCISInvoice(issued, 5, 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "10.00", CISCash, "12345678901")
+	if newZKI == oldZKI {
+		t.Fatalf("Expected a different ZKI with the renewed certificate")
+	}
+	if err := invoice.SetLateDelivery(oldZKI); err != nil {
+		t.Fatalf("Expected the old ZKI to be accepted, got %v", err)
+	}
+	if invoice.ZastKod != oldZKI || !invoice.NakDost || !invoice.zkiCert.publicCert.Equal(oldCert) {
+		t.Errorf("Expected the late delivery with the old ZKI and certificate")
+	}
+	if err := invoice.SetLateDelivery(strings.Repeat("0", 32)); !errors.Is(err, ErrZKIMismatch) {
+		t.Errorf("Expected ErrZKIMismatch, got %v", err)
+	}
+}
+
+func TestIhaveZKIwithExpiredCertificateEdgeCase(t *testing.T) {
+	path, _ := writeTestP12(t, testOIB)
+	oldEntity, err := NewFiskalEntityWithOptions(testOIB, WithLocation("ARCH1"), WithCertFile(path, "renewed"), WithChainVerification(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	issued := time.Now().Add(-time.Hour)
+	_, oldZKI, _ := oldEntity.NewCISInvoice(issued, 6, 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "10.00", CISCash, "12345678901")
+
+	key, cert, _ := newP12TestCert(t, testOIB)
+	fe, err := NewFiskalEntityWithOptions(testOIB, WithLocation("ARCH1"), WithSigner(key, cert), WithChainVerification(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	invoice, _, _ := fe.NewCISInvoice(issued, 6, 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "10.00", CISCash, "12345678901")
+	if err := invoice.IhaveZKIwithExpiredCertificateEdgeCase(oldZKI, path, "renewed"); err != nil {
+		t.Errorf("Expected the old ZKI to be validated with the old certificate, got %v", err)
+	}
+	if len(fe.CertArchive().List()) != 1 {
+		t.Errorf("Expected the old certificate in the archive")
+	}
+}
+
+func TestIhaveZKIwithExpiredCertificateInMemory(t *testing.T) {
+	path, _ := writeTestP12(t, testOIB)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldEntity, err := NewFiskalEntityWithOptions(testOIB, WithLocation("ARCH1"), WithCertP12(data, "renewed"), WithChainVerification(false), WithExpiredCheck(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	issued := time.Now().Add(-time.Hour)
+	_, oldZKI, _ := oldEntity.NewCISInvoice(issued, 7, 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "10.00", CISCash, "12345678901")
+
+	newEntity := func() *RacunType {
+		key, cert, _ := newP12TestCert(t, testOIB)
+		fe, err := NewFiskalEntityWithOptions(testOIB, WithLocation("ARCH1"), WithSigner(key, cert), WithChainVerification(false))
+		if err != nil {
+			t.Fatal(err)
+		}
+		invoice, _, _ := fe.NewCISInvoice(issued, 7, 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "10.00", CISCash, "12345678901")
+		return invoice
+	}
+
+	if err := newEntity().IhaveZKIwithExpiredCertificateP12(oldZKI, data, "renewed"); err != nil {
+		t.Errorf("P12 data: %v", err)
+	}
+	if err := newEntity().IhaveZKIwithExpiredCertificateEntity(oldZKI, oldEntity); err != nil {
+		t.Errorf("Entity: %v", err)
+	}
+	cert, _ := ParseP12(data, "renewed")
+	if err := newEntity().IhaveZKIwithExpiredCertificate(oldZKI, cert); err != nil {
+		t.Errorf("Certificate: %v", err)
+	}
+	if err := newEntity().IhaveZKIwithExpiredCertificateP12(oldZKI, data, "wrong"); err == nil {
+		t.Errorf("Expected error with a wrong password")
+	}
+	if err := newEntity().IhaveZKIwithExpiredCertificateEntity(oldZKI, testEntity); err == nil {
+		t.Errorf("Expected error for an entity with another certificate")
+	}
+}
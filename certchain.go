@@ -0,0 +1,115 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"bytes"
+	"crypto/x509"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// Embed the FINA CA certificates issuing the fiscal certificates, production and demo
+//
+//go:embed certProd/Fina*.pem certDemo/demo*_ca.pem
+var finaCACerts embed.FS
+
+// ErrUntrustedCertificate is returned when the certificate doesn't chain to a FINA CA
+var ErrUntrustedCertificate = errors.New("certificate not issued by FINA")
+
+// finaCAPatterns match the embedded FINA CA files
+var finaCAPatterns = []string{"certProd/Fina*.pem", "certDemo/demo*_ca.pem"}
+
+var (
+	finaCAOnce        sync.Once
+	finaRoots         *x509.CertPool
+	finaIntermediates *x509.CertPool
+	finaCAError       error
+)
+
+// loadFinaCAs parses the embedded FINA CA certificates once, the self-signed ones are the roots
+func loadFinaCAs() (*x509.CertPool, *x509.CertPool, error) {
+	finaCAOnce.Do(func() {
+		finaRoots, finaIntermediates = x509.NewCertPool(), x509.NewCertPool()
+		for _, pattern := range finaCAPatterns {
+			files, err := fs.Glob(finaCACerts, pattern)
+			if err != nil {
+				finaCAError = fmt.Errorf("failed to read embedded FINA CA files: %w", err)
+				return
+			}
+			for _, file := range files {
+				data, err := finaCACerts.ReadFile(file)
+				if err != nil {
+					finaCAError = fmt.Errorf("failed to read FINA CA file %s: %w", file, err)
+					return
+				}
+				certs, err := parsePEMCertificates(data)
+				if err != nil {
+					finaCAError = fmt.Errorf("failed to parse FINA CA file %s: %w", file, err)
+					return
+				}
+				for _, cert := range certs {
+					if bytes.Equal(cert.RawSubject, cert.RawIssuer) {
+						finaRoots.AddCert(cert)
+					} else {
+						finaIntermediates.AddCert(cert)
+					}
+				}
+			}
+		}
+	})
+	return finaRoots, finaIntermediates, finaCAError
+}
+
+// VerifyFinaCertificate checks that the certificate was issued by the FINA production or demo CA (ErrUntrustedCertificate
+// if not), e.g. the signer returned by VerifyXMLSigner. Intermediates missing from the embedded CAs can be supplied.
+func VerifyFinaCertificate(cert *x509.Certificate, intermediates ...*x509.Certificate) error {
+	if cert == nil {
+		return errors.New("certificate is nil")
+	}
+	return verifyFinaChain(cert, intermediates)
+}
+
+// verifyFinaChain checks that the certificate was issued by the FINA production or demo CA,
+// the CA certificates from the P12 bundle may supply intermediates missing from the embedded ones
+func verifyFinaChain(cert *x509.Certificate, caCerts []*x509.Certificate) error {
+	roots, intermediates, err := loadFinaCAs()
+	if err != nil {
+		return err
+	}
+	return verifyCertChain(cert, caCerts, roots, intermediates)
+}
+
+// verifyCertChain verifies the certificate chains to one of the roots. The chain is checked at a time
+// within the certificate validity, the expiry itself is checked separately (see WithExpiredCheck).
+func verifyCertChain(cert *x509.Certificate, caCerts []*x509.Certificate, roots *x509.CertPool, intermediates *x509.CertPool) error {
+	pool := intermediates.Clone()
+	for _, ca := range caCerts {
+		pool.AddCert(ca)
+	}
+
+	at := time.Now()
+	if at.After(cert.NotAfter) {
+		at = cert.NotAfter
+	}
+	if at.Before(cert.NotBefore) {
+		at = cert.NotBefore
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: pool,
+		CurrentTime:   at,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	if _, err := cert.Verify(opts); err != nil {
+		return fmt.Errorf("%w: %v", ErrUntrustedCertificate, err)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"crypto/x509"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerifyFinaChainEmbeddedCAs(t *testing.T) {
+	// The CIS certificates are issued by the same FINA CAs as the fiscal certificates
+	for _, file := range []string{"certProd/fiskalcis1.pem", "certDemo/democis1.pem"} {
+		fsys := prodCISCert
+		if file == "certDemo/democis1.pem" {
+			fsys = demoCISCert
+		}
+		data, err := fsys.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		certs, err := parsePEMCertificates(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := verifyFinaChain(certs[0], nil); err != nil {
+			t.Errorf("Expected %s to chain to the embedded FINA CA: %v", file, err)
+		}
+	}
+}
+
+func TestVerifyCertChain(t *testing.T) {
+	key, cert, caCert := newP12TestCert(t, testOIB)
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+
+	if err := verifyCertChain(cert, nil, roots, x509.NewCertPool()); err != nil {
+		t.Errorf("Expected the certificate to chain to the CA: %v", err)
+	}
+	if err := verifyCertChain(cert, []*x509.Certificate{caCert}, x509.NewCertPool(), x509.NewCertPool()); !errors.Is(err, ErrUntrustedCertificate) {
+		t.Errorf("Expected ErrUntrustedCertificate for an unknown root, got %v", err)
+	}
+
+	// An expired certificate still chains, the expiry is checked separately
+	_, expired, expiredCA := newP12TestCertValidity(t, testOIB, time.Now().Add(-2*time.Hour), time.Now().Add(-30*time.Minute))
+	expiredRoots := x509.NewCertPool()
+	expiredRoots.AddCert(expiredCA)
+	if err := verifyCertChain(expired, nil, expiredRoots, x509.NewCertPool()); err != nil {
+		t.Errorf("Expected the expired certificate to chain to the CA: %v", err)
+	}
+
+	if _, err := NewFiskalEntityWithOptions(testOIB, WithLocation("CHAIN1"), WithSigner(key, cert, caCert)); !errors.Is(err, ErrUntrustedCertificate) {
+		t.Errorf("Expected a certificate not issued by FINA to be rejected, got %v", err)
+	}
+	if _, err := NewFiskalEntityWithOptions(testOIB, WithLocation("CHAIN1"), WithSigner(key, cert, caCert), WithChainVerification(false)); err != nil {
+		t.Errorf("Expected the test certificate to be accepted without the chain verification, got %v", err)
+	}
+
+	fe := newTestEntity(t)
+	path, _ := writeTestP12(t, testOIB)
+	if err := fe.ReloadCertificate(path, "renewed"); !errors.Is(err, ErrUntrustedCertificate) {
+		t.Errorf("Expected the reload of a certificate not issued by FINA to fail, got %v", err)
+	}
+}
@@ -0,0 +1,209 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"crypto"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ErrCertificateNotFound is returned by a CertProvider when the requested certificate is not known
+var ErrCertificateNotFound = errors.New("certificate not found")
+
+// Certificate is a fiscal certificate together with the signer of its private key
+type Certificate struct {
+	Signer  crypto.Signer
+	Cert    *x509.Certificate
+	CACerts []*x509.Certificate
+}
+
+// Serial returns the certificate serial number in decimal, the same format as GetCertSERIAL
+func (c *Certificate) Serial() string {
+	if c == nil || c.Cert == nil {
+		return ""
+	}
+	return c.Cert.SerialNumber.String()
+}
+
+// FingerprintSHA1 returns the SHA-1 fingerprint of the certificate, the same format as GetCertFingerprintSHA1
+func (c *Certificate) FingerprintSHA1() string {
+	if c == nil || c.Cert == nil {
+		return ""
+	}
+	sum := sha1.Sum(c.Cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// FingerprintSHA256 returns the SHA-256 fingerprint of the certificate, the same format as GetCertFingerprintSHA256
+func (c *Certificate) FingerprintSHA256() string {
+	if c == nil || c.Cert == nil {
+		return ""
+	}
+	sum := sha256.Sum256(c.Cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseP12 decodes a P12 certificate bundle
+func ParseP12(data []byte, password string) (*Certificate, error) {
+	if len(data) == 0 {
+		return nil, errors.New("certificate data is empty")
+	}
+	key, cert, caCerts, err := parseP12(data, password)
+	if err != nil {
+		return nil, err
+	}
+	return &Certificate{Signer: key, Cert: cert, CACerts: caCerts}, nil
+}
+
+// CertProvider supplies the fiscal certificates of an entity: the current one used to sign new invoices,
+// and the older (usually expired) ones still needed to recalculate the ZKI of old invoices during an inspection.
+type CertProvider interface {
+	// GetCurrent returns the certificate used to sign new invoices
+	GetCurrent() (*Certificate, error)
+
+	// GetBySerial returns the certificate with the serial number (decimal, as GetCertSERIAL),
+	// ErrCertificateNotFound if it's not known
+	GetBySerial(serial string) (*Certificate, error)
+
+	// ListHistorical returns all known certificates, the current one and the older ones
+	ListHistorical() ([]*Certificate, error)
+}
+
+// memoryCertProvider holds already loaded certificates
+type memoryCertProvider struct {
+	certs []*Certificate
+}
+
+// NewMemoryCertProvider returns a CertProvider with already loaded certificates, e.g. from WithSigner or ParseP12
+func NewMemoryCertProvider(current *Certificate, historical ...*Certificate) (CertProvider, error) {
+	if current == nil {
+		return nil, errors.New("current certificate is nil")
+	}
+	certs := []*Certificate{current}
+	for _, cert := range historical {
+		if cert == nil || cert.Cert == nil {
+			return nil, errors.New("historical certificate is nil")
+		}
+		certs = append(certs, cert)
+	}
+	return &memoryCertProvider{certs: certs}, nil
+}
+
+func (p *memoryCertProvider) GetCurrent() (*Certificate, error) {
+	return p.certs[0], nil
+}
+
+func (p *memoryCertProvider) GetBySerial(serial string) (*Certificate, error) {
+	return findBySerial(p.certs, serial)
+}
+
+func (p *memoryCertProvider) ListHistorical() ([]*Certificate, error) {
+	return append([]*Certificate(nil), p.certs...), nil
+}
+
+// findBySerial returns the certificate with the serial number
+func findBySerial(certs []*Certificate, serial string) (*Certificate, error) {
+	for _, cert := range certs {
+		if cert.Serial() == serial {
+			return cert, nil
+		}
+	}
+	return nil, ErrCertificateNotFound
+}
+
+// CertFile is the path and the password of a P12 certificate file
+type CertFile struct {
+	Path     string
+	Password string
+}
+
+// NewFileCertProvider loads the current and the historical certificates from P12 files
+func NewFileCertProvider(current CertFile, historical ...CertFile) (CertProvider, error) {
+	var certs []*Certificate
+	for _, file := range append([]CertFile{current}, historical...) {
+		//check path is valid
+		if !IsFileReadable(file.Path) {
+			return nil, fmt.Errorf("invalid certificate path or file not readable: %s", file.Path)
+		}
+		data, err := os.ReadFile(file.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read certificate: %v", err)
+		}
+		cert, err := ParseP12(data, file.Password)
+		wipeBytes(data)
+		if err != nil {
+			return nil, fmt.Errorf("certificate decode fail: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+	return &memoryCertProvider{certs: certs}, nil
+}
+
+// NewEnvCertProvider loads the certificates from environment variables (with the prefix, FISKALHR_ by default):
+//
+//   - CERT_P12_BASE64 or CERT_PATH, and CERT_PASSWORD: the current certificate, see NewFiskalEntityFromEnv
+//   - CERT_HISTORICAL_1_P12_BASE64 or CERT_HISTORICAL_1_PATH, and CERT_HISTORICAL_1_PASSWORD: the older certificates,
+//     numbered from 1 until the first missing number
+func NewEnvCertProvider(prefix string) (CertProvider, error) {
+	if prefix == "" {
+		prefix = DefaultEnvPrefix
+	}
+
+	current, err := certFromEnv(prefix + "CERT_")
+	if err != nil {
+		return nil, err
+	}
+	if current == nil {
+		return nil, errors.New("the certificate is not set, set " + prefix + "CERT_P12_BASE64 or " + prefix + "CERT_PATH")
+	}
+
+	certs := []*Certificate{current}
+	for i := 1; ; i++ {
+		cert, err := certFromEnv(prefix + "CERT_HISTORICAL_" + strconv.Itoa(i) + "_")
+		if err != nil {
+			return nil, err
+		}
+		if cert == nil {
+			break
+		}
+		certs = append(certs, cert)
+	}
+	return &memoryCertProvider{certs: certs}, nil
+}
+
+// certFromEnv loads the certificate from the <prefix>P12_BASE64 or <prefix>PATH and <prefix>PASSWORD variables,
+// nil if neither is set
+func certFromEnv(prefix string) (*Certificate, error) {
+	password := os.Getenv(prefix + "PASSWORD")
+	if certBase64 := os.Getenv(prefix + "P12_BASE64"); certBase64 != "" {
+		data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(certBase64), ""))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %sP12_BASE64: %w", prefix, err)
+		}
+		cert, err := ParseP12(data, password)
+		wipeBytes(data)
+		if err != nil {
+			return nil, fmt.Errorf("certificate decode fail: %v", err)
+		}
+		return cert, nil
+	}
+	if certPath := os.Getenv(prefix + "PATH"); certPath != "" {
+		provider, err := NewFileCertProvider(CertFile{Path: certPath, Password: password})
+		if err != nil {
+			return nil, err
+		}
+		return provider.GetCurrent()
+	}
+	return nil, nil
+}
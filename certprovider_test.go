@@ -0,0 +1,109 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestGenerateZKIWithCertificate(t *testing.T) {
+	data, err := os.ReadFile(certPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := ParseP12(data, certPassword)
+	if err != nil {
+		t.Fatalf("Failed to parse the test certificate: %v", err)
+	}
+	oldKey, oldCert, _ := newP12TestCert(t, testOIB)
+	old := &Certificate{Signer: oldKey, Cert: oldCert}
+
+	provider, err := NewMemoryCertProvider(current, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fe, err := NewFiskalEntityWithOptions(testOIB, WithLocation("HIST1"), WithCertProvider(provider))
+	if err != nil {
+		t.Fatalf("Failed to create entity: %v", err)
+	}
+	if fe.CertProvider() != provider {
+		t.Errorf("Expected the entity to keep the provider")
+	}
+
+	issued := time.Date(2020, 5, 1, 10, 0, 0, 0, time.Local)
+	zki, _ := fe.GenerateZKI(issued, 1, 1, "10.00")
+
+	sameZKI, err := fe.GenerateZKIWithCertificate(current.Serial(), issued, 1, 1, "10.00")
+	if err != nil || sameZKI != zki {
+		t.Errorf("Expected the current certificate ZKI, got %s %v", sameZKI, err)
+	}
+
+	oldZKI, err := fe.GenerateZKIWithCertificate(old.Serial(), issued, 1, 1, "10.00")
+	if err != nil {
+		t.Fatalf("Failed to generate ZKI with the old certificate: %v", err)
+	}
+	if oldZKI == zki || !ValidateZKI(oldZKI) {
+		t.Errorf("Expected a different valid ZKI with the old certificate, got %s", oldZKI)
+	}
+	again, _ := fe.GenerateZKIWithCertificate(old.Serial(), issued, 1, 1, "10.00")
+	if again != oldZKI {
+		t.Errorf("Expected the ZKI to be deterministic")
+	}
+
+	if _, err := fe.GenerateZKIWithCertificate("999999", issued, 1, 1, "10.00"); !errors.Is(err, ErrCertificateNotFound) {
+		t.Errorf("Expected ErrCertificateNotFound, got %v", err)
+	}
+
+	otherKey, otherCert, _ := newP12TestCert(t, "12345678903")
+	other, _ := NewMemoryCertProvider(current, &Certificate{Signer: otherKey, Cert: otherCert})
+	fe2, _ := NewFiskalEntityWithOptions(testOIB, WithLocation("HIST1"), WithCertProvider(other))
+	if _, err := fe2.GenerateZKIWithCertificate(otherCert.SerialNumber.String(), issued, 1, 1, "10.00"); err == nil {
+		t.Errorf("Expected error for a certificate of another OIB")
+	}
+}
+
+func TestEnvCertProvider(t *testing.T) {
+	const prefix = "FISKALHRGO_PROVIDER_TEST_"
+	t.Setenv(prefix+"CERT_PATH", certPath)
+	t.Setenv(prefix+"CERT_PASSWORD", certPassword)
+	t.Setenv(prefix+"CERT_HISTORICAL_1_P12_BASE64", os.Getenv("CIS_P12_BASE64"))
+	t.Setenv(prefix+"CERT_HISTORICAL_1_PASSWORD", certPassword)
+
+	provider, err := NewEnvCertProvider(prefix)
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	certs, err := provider.ListHistorical()
+	if err != nil || len(certs) != 2 {
+		t.Fatalf("Expected 2 certificates, got %d %v", len(certs), err)
+	}
+	current, _ := provider.GetCurrent()
+	if current.Serial() != testEntity.GetCertSERIAL() {
+		t.Errorf("Unexpected current certificate serial %s", current.Serial())
+	}
+
+	t.Setenv(prefix+"CERT_HISTORICAL_1_P12_BASE64", base64.StdEncoding.EncodeToString([]byte("garbage")))
+	if _, err := NewEnvCertProvider(prefix); err == nil {
+		t.Errorf("Expected error for an invalid historical certificate")
+	}
+}
+
+func TestFileCertProvider(t *testing.T) {
+	if _, err := NewFileCertProvider(CertFile{Path: certPath, Password: certPassword}, CertFile{Path: "/nonexistent.p12"}); err == nil {
+		t.Errorf("Expected error for a missing historical file")
+	}
+	provider, err := NewFileCertProvider(CertFile{Path: certPath, Password: certPassword})
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	current, _ := provider.GetCurrent()
+	if cert, err := provider.GetBySerial(current.Serial()); err != nil || cert != current {
+		t.Errorf("Expected to find the current certificate by serial, got %v", err)
+	}
+}
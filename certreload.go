@@ -0,0 +1,180 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// certificate returns the current certificate, requests take it once so a reload never affects a request in flight.
+// With a time selecting provider (NewMultiCertProvider) the certificate is switched when its selection is due.
+func (fe *FiskalEntity) certificate() *certManager {
+	fe.certMu.RLock()
+	cert, recheck := fe.cert, fe.certRecheck
+	fe.certMu.RUnlock()
+
+	if recheck.IsZero() || time.Now().Before(recheck) {
+		return cert
+	}
+	if _, err := fe.RotateCertificate(); err != nil {
+		fe.log(failureLevel, "automatic certificate selection failed", errorAttrs(err)...)
+		// Don't retry on every call, the current certificate is kept until the next selection time
+		fe.certMu.Lock()
+		fe.certRecheck = certRecheckTime(fe.certProvider)
+		fe.certMu.Unlock()
+	}
+
+	fe.certMu.RLock()
+	defer fe.certMu.RUnlock()
+	return fe.cert
+}
+
+// CertProvider returns the provider of the entity certificates
+func (fe *FiskalEntity) CertProvider() CertProvider {
+	fe.certMu.RLock()
+	defer fe.certMu.RUnlock()
+	return fe.certProvider
+}
+
+// currentSerial returns the serial number of the current certificate without the automatic selection
+func (fe *FiskalEntity) currentSerial() string {
+	fe.certMu.RLock()
+	defer fe.certMu.RUnlock()
+	if fe.cert == nil {
+		return ""
+	}
+	return fe.cert.certSERIAL
+}
+
+// ReloadCertificate loads a new (renewed) P12 certificate from the file and atomically replaces the current one,
+// without recreating the entity. Requests in flight finish with the certificate they started with.
+// The certificate must belong to the entity OIB and must not be expired. The replaced certificate stays
+// available to GenerateZKIWithCertificate.
+func (fe *FiskalEntity) ReloadCertificate(path string, password string) error {
+	provider, err := NewFileCertProvider(CertFile{Path: path, Password: password})
+	if err != nil {
+		return err
+	}
+	cert, err := provider.GetCurrent()
+	if err != nil {
+		return err
+	}
+	return fe.replaceCertificate(cert, nil)
+}
+
+// RotateCertificate asks the certificate provider for the current certificate and switches to it if it changed,
+// e.g. after a new version of the certificate was stored in the secret store. It returns true if the
+// certificate was replaced. Call it periodically or use WatchCertProvider.
+func (fe *FiskalEntity) RotateCertificate() (bool, error) {
+	provider := fe.CertProvider()
+	if provider == nil {
+		return false, errors.New("certificate provider is not set")
+	}
+	cert, err := provider.GetCurrent()
+	if err != nil {
+		return false, fmt.Errorf("failed to get the current certificate: %w", err)
+	}
+	if cert == nil || cert.Serial() == fe.currentSerial() {
+		fe.certMu.Lock()
+		fe.certRecheck = certRecheckTime(provider)
+		fe.certMu.Unlock()
+		return false, nil
+	}
+	if err := fe.replaceCertificate(cert, provider); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// WatchCertProvider calls RotateCertificate every interval until the context is done.
+// Errors are passed to onError (if not nil) and the current certificate is kept.
+func (fe *FiskalEntity) WatchCertProvider(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := fe.RotateCertificate(); err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
+
+// replaceCertificate validates the certificate and makes it the current one. If provider is nil, the
+// current provider is replaced with one holding the new certificate and all the known certificates.
+func (fe *FiskalEntity) replaceCertificate(cert *Certificate, provider CertProvider) error {
+	if cert == nil {
+		return errors.New("certificate is nil")
+	}
+	cm := newCertManager()
+	if err := cm.setSigner(cert.Signer, cert.Cert, cert.CACerts); err != nil {
+		return fmt.Errorf("certificate setup fail: %v", err)
+	}
+	if cm.certOIB != fe.oib {
+		return errors.New("OIB does not match the certificate")
+	}
+	if cm.expired {
+		return errors.New("certificate expired")
+	}
+	if fe.verifyChain {
+		if err := verifyFinaChain(cm.publicCert, cm.caCerts); err != nil {
+			return err
+		}
+	}
+	if err := fe.checkNotRevoked(cm); err != nil {
+		return err
+	}
+
+	if provider == nil {
+		var historical []*Certificate
+		if current := fe.CertProvider(); current != nil {
+			known, err := current.ListHistorical()
+			if err != nil {
+				return fmt.Errorf("failed to list the known certificates: %w", err)
+			}
+			for _, c := range known {
+				if c.Serial() != cert.Serial() {
+					historical = append(historical, c)
+				}
+			}
+		}
+		var err error
+		if provider, err = NewMemoryCertProvider(cert, historical...); err != nil {
+			return err
+		}
+	}
+
+	fe.certMu.Lock()
+	if fe.closed {
+		fe.certMu.Unlock()
+		return ErrEntityClosed
+	}
+	old := fe.cert
+	fe.cert = cm
+	fe.certProvider = provider
+	fe.certRecheck = certRecheckTime(provider)
+	fe.certMu.Unlock()
+
+	oldSerial := ""
+	if old != nil {
+		oldSerial = old.certSERIAL
+		if err := fe.CertArchive().Add(&Certificate{Signer: old.signer, Cert: old.publicCert, CACerts: old.caCerts}); err != nil {
+			fe.log(failureLevel, "failed to archive the replaced certificate", errorAttrs(err)...)
+		}
+	}
+	fe.log(lifecycleLevel, "certificate replaced",
+		slog.String("old_serial", oldSerial),
+		slog.String("serial", cm.certSERIAL),
+		slog.Time("valid_until", cm.publicCert.NotAfter),
+	)
+	return nil
+}
@@ -0,0 +1,143 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	gopkcs12 "software.sslmate.com/src/go-pkcs12"
+)
+
+// writeTestP12 writes a synthetic P12 certificate for the OIB and returns the path and the certificate
+func writeTestP12(t *testing.T, oib string) (string, *x509.Certificate) {
+	t.Helper()
+	key, cert, caCert := newP12TestCert(t, oib)
+	data, err := gopkcs12.Modern.Encode(key, cert, []*x509.Certificate{caCert}, "renewed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "renewed.p12")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path, cert
+}
+
+func TestReloadCertificate(t *testing.T) {
+	// the synthetic certificates are not issued by FINA
+	fe, err := NewFiskalEntityWithOptions(testOIB, WithLocation("TEST3"), WithDemoMode(true), WithCertFile(certPath, certPassword), WithChainVerification(false))
+	if err != nil {
+		t.Fatalf("Failed to create entity: %v", err)
+	}
+	oldSerial := fe.GetCertSERIAL()
+	issued := time.Date(2024, 10, 1, 12, 0, 0, 0, time.Local)
+	oldZKI, _ := fe.GenerateZKI(issued, 1, 1, "10.00")
+
+	otherPath, _ := writeTestP12(t, "12345678903")
+	if err := fe.ReloadCertificate(otherPath, "renewed"); err == nil {
+		t.Fatalf("Expected error for a certificate of another OIB")
+	}
+	if fe.GetCertSERIAL() != oldSerial {
+		t.Fatalf("Expected the certificate to be kept after a failed reload")
+	}
+
+	path, cert := writeTestP12(t, testOIB)
+	if err := fe.ReloadCertificate(path, "renewed"); err != nil {
+		t.Fatalf("Failed to reload the certificate: %v", err)
+	}
+	if fe.GetCertSERIAL() != cert.SerialNumber.String() {
+		t.Errorf("Expected the new certificate, got serial %s", fe.GetCertSERIAL())
+	}
+
+	newZKI, _ := fe.GenerateZKI(issued, 1, 1, "10.00")
+	if newZKI == oldZKI {
+		t.Errorf("Expected a different ZKI with the new certificate")
+	}
+	if zki, err := fe.GenerateZKIWithCertificate(oldSerial, issued, 1, 1, "10.00"); err != nil || zki != oldZKI {
+		t.Errorf("Expected the old certificate to stay available, got %s %v", zki, err)
+	}
+}
+
+// switchingProvider returns the second certificate as current after the switch
+type switchingProvider struct {
+	mu       sync.Mutex
+	certs    []*Certificate
+	switched bool
+}
+
+func (p *switchingProvider) GetCurrent() (*Certificate, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.switched {
+		return p.certs[1], nil
+	}
+	return p.certs[0], nil
+}
+
+func (p *switchingProvider) GetBySerial(serial string) (*Certificate, error) {
+	return findBySerial(p.certs, serial)
+}
+
+func (p *switchingProvider) ListHistorical() ([]*Certificate, error) {
+	return p.certs, nil
+}
+
+func TestRotateCertificateRace(t *testing.T) {
+	data, err := os.ReadFile(certPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := ParseP12(data, certPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, cert, _ := newP12TestCert(t, testOIB)
+	provider := &switchingProvider{certs: []*Certificate{current, {Signer: key, Cert: cert}}}
+
+	fe, err := NewFiskalEntityWithOptions(testOIB, WithLocation("ROT1"), WithCertProvider(provider), WithChainVerification(false))
+	if err != nil {
+		t.Fatalf("Failed to create entity: %v", err)
+	}
+
+	if changed, err := fe.RotateCertificate(); err != nil || changed {
+		t.Fatalf("Expected no change, got %v %v", changed, err)
+	}
+
+	// Sign concurrently with the rotation, every signature must use a single certificate
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if _, err := fe.signXML([]byte(`<tns:EchoRequest xmlns:tns="http://www.apis-it.hr/fin/2012/types/f73" Id="x">test</tns:EchoRequest>`)); err != nil {
+					t.Errorf("Failed to sign: %v", err)
+					return
+				}
+			}
+		}()
+	}
+
+	provider.mu.Lock()
+	provider.switched = true
+	provider.mu.Unlock()
+	changed, err := fe.RotateCertificate()
+	wg.Wait()
+
+	if err != nil || !changed {
+		t.Fatalf("Expected the certificate to be rotated, got %v %v", changed, err)
+	}
+	if fe.GetCertSERIAL() != cert.SerialNumber.String() {
+		t.Errorf("Expected the rotated certificate, got serial %s", fe.GetCertSERIAL())
+	}
+	if fe.CertProvider() != provider {
+		t.Errorf("Expected the provider to be kept")
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
 	"time"
 )
@@ -34,10 +35,11 @@ type signatureCheckCIScert struct {
 	ValidFrom     time.Time
 	ValidUntil    time.Time
 	SSLverifyPoll *x509.CertPool
+	Runtime       bool // supplied at runtime instead of the embedded one
 }
 
 // parseAndVerifyEmbeddedCerts parses the embedded certificates, verifies the chain, and returns the public key of the newest valid certificate
-func parseAndVerifyEmbeddedCerts(certFS embed.FS, dir string, pattern string) (*signatureCheckCIScert, error) {
+func parseAndVerifyEmbeddedCerts(certFS embed.FS, dir string, pattern string, now time.Time) (*signatureCheckCIScert, error) {
 	var newestCert *x509.Certificate
 	var sslpool *x509.CertPool
 
@@ -63,56 +65,16 @@ func parseAndVerifyEmbeddedCerts(certFS embed.FS, dir string, pattern string) (*
 		}
 
 		// Parse the certificates
-		var certs []*x509.Certificate
-		for {
-			block, rest := pem.Decode(certData)
-			if block == nil {
-				break
-			}
-			if block.Type != "CERTIFICATE" {
-				return nil, errors.New("invalid PEM block type")
-			}
-
-			cert, err := x509.ParseCertificate(block.Bytes)
-			if err != nil {
-				return nil, fmt.Errorf("failed to parse certificate: %w", err)
-			}
-			certs = append(certs, cert)
-			certData = rest
-		}
-
-		sslpool = x509.NewCertPool()
-		// Verify the certificate chain
-		roots := x509.NewCertPool()
-		intermediates := x509.NewCertPool()
-
-		// Add the root certificate to the roots pool
-		roots.AddCert(certs[len(certs)-1])
-		sslpool.AddCert(certs[len(certs)-1])
-
-		// Add intermediate certificates to the intermediates pool
-		for i := 1; i < len(certs)-1; i++ {
-			intermediates.AddCert(certs[i])
-			sslpool.AddCert(certs[i])
-		}
-
-		opts := x509.VerifyOptions{
-			Roots:         roots,
-			Intermediates: intermediates,
-			CurrentTime:   time.Now(),
-			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
-		}
-
-		leafCert := certs[0]
-		if _, err := leafCert.Verify(opts); err != nil {
-			continue // Skip invalid certificate chains
+		certs, err := parsePEMCertificates(certData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse cert file %s: %w", certFile.Name(), err)
 		}
 
-		// Check if the certificate is valid and not expired
-		now := time.Now()
-		if now.Before(leafCert.NotBefore) || now.After(leafCert.NotAfter) {
-			continue // Skip expired or not yet valid certificates
+		leafCert, pool, err := verifyCISChain(certs, now)
+		if err != nil {
+			continue // Skip invalid certificate chains, expired or not yet valid certificates
 		}
+		sslpool = pool
 
 		// Update the newest valid certificate
 		if newestCert == nil || leafCert.NotBefore.After(newestCert.NotBefore) {
@@ -124,23 +86,170 @@ func parseAndVerifyEmbeddedCerts(certFS embed.FS, dir string, pattern string) (*
 		return nil, errors.New("no suitable certificate found")
 	}
 
+	return newSignatureCheckCIScert(newestCert, sslpool), nil
+}
+
+func newSignatureCheckCIScert(cert *x509.Certificate, sslpool *x509.CertPool) *signatureCheckCIScert {
 	return &signatureCheckCIScert{
-		PublicCert:    newestCert,
-		Subject:       newestCert.Subject.String(),
-		Serial:        newestCert.SerialNumber.String(),
-		Issuer:        newestCert.Issuer.String(),
-		ValidFrom:     newestCert.NotBefore,
-		ValidUntil:    newestCert.NotAfter,
+		PublicCert:    cert,
+		Subject:       cert.Subject.String(),
+		Serial:        cert.SerialNumber.String(),
+		Issuer:        cert.Issuer.String(),
+		ValidFrom:     cert.NotBefore,
+		ValidUntil:    cert.NotAfter,
 		SSLverifyPoll: sslpool,
-	}, nil
+	}
+}
+
+// verifyCISChain verifies the CIS certificate chain (the CIS certificate first, the root CA last) and checks
+// the CIS certificate is valid at the time now. It returns the CIS certificate and the pool of the CA certificates for SSL verification.
+func verifyCISChain(certs []*x509.Certificate, now time.Time) (*x509.Certificate, *x509.CertPool, error) {
+	if len(certs) < 2 {
+		return nil, nil, errors.New("the chain must contain the CIS certificate and its CA")
+	}
+	sslpool := x509.NewCertPool()
+	// Verify the certificate chain
+	roots := x509.NewCertPool()
+	intermediates := x509.NewCertPool()
+
+	// Add the root certificate to the roots pool
+	roots.AddCert(certs[len(certs)-1])
+	sslpool.AddCert(certs[len(certs)-1])
+
+	// Add intermediate certificates to the intermediates pool
+	for i := 1; i < len(certs)-1; i++ {
+		intermediates.AddCert(certs[i])
+		sslpool.AddCert(certs[i])
+	}
+
+	// Check if the certificate is valid and not expired
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+
+	leafCert := certs[0]
+	if _, err := leafCert.Verify(opts); err != nil {
+		return nil, nil, fmt.Errorf("invalid CIS certificate chain: %w", err)
+	}
+	if now.Before(leafCert.NotBefore) || now.After(leafCert.NotAfter) {
+		return nil, nil, fmt.Errorf("CIS certificate is not valid: valid from %v until %v", leafCert.NotBefore, leafCert.NotAfter)
+	}
+	return leafCert, sslpool, nil
+}
+
+// parsePEMCertificates parses all CERTIFICATE blocks from PEM data
+func parsePEMCertificates(pemData []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		block, rest := pem.Decode(pemData)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, errors.New("invalid PEM block type")
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %w", err)
+		}
+		certs = append(certs, cert)
+		pemData = rest
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificates found in PEM data")
+	}
+	return certs, nil
+}
+
+// Get demo public key valid at the time now
+func getDemoPublicKey(now time.Time) (*signatureCheckCIScert, error) {
+	return parseAndVerifyEmbeddedCerts(demoCISCert, "certDemo", "democis*.pem", now)
+}
+
+// Get production public key valid at the time now
+func getProductionPublicKey(now time.Time) (*signatureCheckCIScert, error) {
+	return parseAndVerifyEmbeddedCerts(prodCISCert, "certProd", "fiskalcis*.pem", now)
+}
+
+// defaultClock is the clock of the entities created without WithClock
+var defaultClock = time.Now
+
+// WithClock sets the clock checking the validity of the CIS certificates (the embedded ones, the ones supplied
+// with SetCISCertificatePEM), time.Now by default. Use a fixed time in the tests, so they don't fail when the
+// embedded CIS certificates expire.
+func WithClock(now func() time.Time) Option {
+	return func(o *entityOptions) {
+		o.clock = now
+	}
+}
+
+// now returns the time of the entity clock, see WithClock
+func (fe *FiskalEntity) now() time.Time {
+	if fe.clock != nil {
+		return fe.clock()
+	}
+	return defaultClock()
+}
+
+// cisCertificate returns the CIS certificate used by the entity. A published certificate is never modified,
+// the changes replace it (see replaceCISPoolLocked), so the caller can use it without holding the lock.
+func (fe *FiskalEntity) cisCertificate() *signatureCheckCIScert {
+	fe.clientMu.Lock()
+	defer fe.clientMu.Unlock()
+	return fe.cisCertificateLocked()
+}
+
+// cisCertificateLocked returns the CIS certificate used by the entity, clientMu must be held
+func (fe *FiskalEntity) cisCertificateLocked() *signatureCheckCIScert {
+	return fe.ciscert
 }
 
-// Get demo public key
-func getDemoPublicKey() (*signatureCheckCIScert, error) {
-	return parseAndVerifyEmbeddedCerts(demoCISCert, "certDemo", "democis*.pem")
+// replaceCISPoolLocked replaces the CIS certificate with a copy using the CA pool, clientMu must be held
+func (fe *FiskalEntity) replaceCISPoolLocked(pool *x509.CertPool) {
+	ciscert := *fe.cisCertificateLocked()
+	ciscert.SSLverifyPoll = pool
+	fe.ciscert = &ciscert
+	fe.resetHTTPClientLocked()
+}
+
+// SetCISCertificatePEM overrides the embedded CIS certificate with the PEM encoded chain, the CIS certificate first
+// and the root CA last (the format of the embedded files), so a rotation of the Tax Administration certificates doesn't
+// have to wait for a library release. The chain is verified and the CIS certificate must be valid. The CA certificates
+// of the chain are added to the pool verifying the CIS server TLS certificate, the embedded ones remain trusted.
+func (fe *FiskalEntity) SetCISCertificatePEM(pemData []byte) error {
+	certs, err := parsePEMCertificates(pemData)
+	if err != nil {
+		return err
+	}
+	cert, pool, err := verifyCISChain(certs, fe.now())
+	if err != nil {
+		return err
+	}
+
+	fe.clientMu.Lock()
+	defer fe.clientMu.Unlock()
+	// Clone the pool so the change never leaks to other users of the same pool
+	if current := fe.cisCertificateLocked(); current != nil && current.SSLverifyPoll != nil {
+		pool = current.SSLverifyPoll.Clone()
+		for _, ca := range certs[1:] {
+			pool.AddCert(ca)
+		}
+	}
+	ciscert := newSignatureCheckCIScert(cert, pool)
+	ciscert.Runtime = true
+	fe.ciscert = ciscert
+	fe.resetHTTPClientLocked()
+	return nil
 }
 
-// Get production public key
-func getProductionPublicKey() (*signatureCheckCIScert, error) {
-	return parseAndVerifyEmbeddedCerts(prodCISCert, "certProd", "fiskalcis*.pem")
+// SetCISCertificateFile overrides the embedded CIS certificate with the PEM chain from the file, see SetCISCertificatePEM
+func (fe *FiskalEntity) SetCISCertificateFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read CIS certificate: %w", err)
+	}
+	return fe.SetCISCertificatePEM(data)
 }
@@ -4,7 +4,20 @@ package fiskalhrgo
 // Copyright (c) 2024 L. D. T. d.o.o.
 // Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
 
-import "testing"
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/l-d-t/fiskalhrgo/fiskaltest"
+)
 
 // Expected serial number of the embedded CIS demo certificate currently in use
 const expectedDemoSerial = "325450325973957308031939306065516468253"
@@ -17,7 +30,7 @@ func TestParseAndVerifyEmbeddedCertsDemo(t *testing.T) {
 	t.Logf("Testing embedded CIS demo certificate...")
 
 	// Parse and verify the embedded CIS demo certificate
-	cert, err := getDemoPublicKey()
+	cert, err := getDemoPublicKey(fiskaltest.CISCertTime)
 	if err != nil {
 		t.Fatalf("Failed to parse and verify embedded CIS demo certificate: %v", err)
 	}
@@ -40,7 +53,7 @@ func TestParseAndVerifyEmbeddedCertsProd(t *testing.T) {
 	t.Logf("Testing embedded CIS production certificate...")
 
 	// Parse and verify the embedded CIS production certificate
-	cert, err := getProductionPublicKey()
+	cert, err := getProductionPublicKey(fiskaltest.CISCertTime)
 	if err != nil {
 		t.Fatalf("Failed to parse and verify embedded CIS production certificate: %v", err)
 	}
@@ -57,3 +70,122 @@ func TestParseAndVerifyEmbeddedCertsProd(t *testing.T) {
 		t.Fatalf("Expected serial number %s, but got %s", expectedProdSerial, cert.Serial)
 	}
 }
+
+// newCISChainPEM creates a CIS like certificate chain (the CIS certificate first, the root CA last) valid until notAfter,
+// from before the fixed time of the test entities (see fiskaltest.CISCertTime)
+func newCISChainPEM(t *testing.T, notAfter time.Time) ([]byte, *x509.Certificate, *x509.Certificate) {
+	t.Helper()
+	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notBefore := fiskaltest.CISCertTime.Add(-2 * 365 * 24 * time.Hour)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CIS CA", Country: []string{"HR"}},
+		NotBefore:             notBefore,
+		NotAfter:              time.Now().Add(5 * 365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, _ := x509.ParseCertificate(caDER)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "fiskalcistest", Organization: []string{"Ministarstvo financija"}, Country: []string{"HR"}},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	data := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})...)
+	return data, cert, caCert
+}
+
+func TestSetCISCertificate(t *testing.T) {
+	fe := newTestEntity(t)
+	embedded := fe.cisCertificate()
+
+	data, cert, caCert := newCISChainPEM(t, time.Now().Add(365*24*time.Hour))
+	if err := fe.SetCISCertificatePEM(data); err != nil {
+		t.Fatalf("Failed to set the CIS certificate: %v", err)
+	}
+	ciscert := fe.cisCertificate()
+	if !ciscert.PublicCert.Equal(cert) || !ciscert.Runtime || ciscert.Serial != "2" {
+		t.Errorf("Expected the supplied CIS certificate, got %+v", ciscert)
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: ciscert.SSLverifyPoll}); err != nil {
+		t.Errorf("Expected the supplied CA to be trusted for SSL: %v", err)
+	}
+	if embedded.SSLverifyPoll.Equal(ciscert.SSLverifyPoll) {
+		t.Errorf("Expected the embedded pool not to be modified")
+	}
+	if check := fe.preflightCISCertificate(time.Now()); check.Status != PreflightOK {
+		t.Errorf("Expected the preflight check to pass, got %+v", check)
+	}
+
+	// Invalid chains are rejected and the current certificate is kept
+	expired, _, _ := newCISChainPEM(t, fiskaltest.CISCertTime.Add(-400*24*time.Hour))
+	for name, invalid := range map[string][]byte{
+		"expired":  expired,
+		"no CA":    pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}),
+		"wrong CA": append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: embedded.PublicCert.Raw}), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caCert.Raw})...),
+		"garbage":  []byte("not a certificate"),
+	} {
+		if err := fe.SetCISCertificatePEM(invalid); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if !fe.cisCertificate().PublicCert.Equal(cert) {
+		t.Errorf("Expected the CIS certificate to be kept after the invalid ones")
+	}
+
+	path := filepath.Join(t.TempDir(), "cis.pem")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	optFE, err := NewFiskalEntityWithOptions(testOIB, WithLocation("TEST3"), WithDemoMode(true), WithCertFile(certPath, certPassword),
+		WithCISCertificateFile(path))
+	if err != nil {
+		t.Fatalf("Failed to create the entity: %v", err)
+	}
+	if !optFE.cisCertificate().PublicCert.Equal(cert) {
+		t.Errorf("Expected the CIS certificate from the file")
+	}
+	if _, err := NewFiskalEntityWithOptions(testOIB, WithLocation("TEST3"), WithDemoMode(true), WithCertFile(certPath, certPassword),
+		WithCISCertificatePEM(expired)); err == nil {
+		t.Errorf("Expected an error for an expired CIS certificate")
+	}
+}
+
+func TestWithClock(t *testing.T) {
+	embedded, err := getDemoPublicKey(fiskaltest.CISCertTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFiskalEntityWithOptions(testOIB, WithLocation("TEST3"), WithDemoMode(true), WithCertFile(certPath, certPassword),
+		WithClock(func() time.Time { return embedded.ValidUntil.Add(time.Hour) })); err == nil {
+		t.Errorf("Expected an error after the embedded CIS certificate expired")
+	}
+	fe, err := NewFiskalEntityWithOptions(testOIB, WithLocation("TEST3"), WithDemoMode(true), WithCertFile(certPath, certPassword),
+		WithClock(func() time.Time { return embedded.ValidFrom.Add(time.Hour) }))
+	if err != nil {
+		t.Fatalf("Expected the embedded CIS certificate to be valid: %v", err)
+	}
+	if got := fe.now(); !got.Equal(embedded.ValidFrom.Add(time.Hour)) {
+		t.Errorf("Unexpected entity time %v", got)
+	}
+}
@@ -0,0 +1,129 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"crypto/x509"
+	"embed"
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// cisCertWarnDays is the number of days before the embedded CIS certificate expiry when CISCertStatus warns,
+// longer than expireSoonDays as the fix is a library upgrade, not a certificate renewal
+const cisCertWarnDays = 90
+
+// CISCertState is the validity state of an embedded CIS certificate
+type CISCertState string
+
+const (
+	CISCertValid        CISCertState = "valid"
+	CISCertExpiringSoon CISCertState = "expiring-soon"
+	CISCertExpired      CISCertState = "expired"
+	CISCertNotYetValid  CISCertState = "not-yet-valid"
+)
+
+// CISCertReport is the validity of the CIS certificate embedded for one environment
+type CISCertReport struct {
+	Environment   string // "demo" or "production"
+	Subject       string
+	Serial        string
+	ValidFrom     time.Time
+	ValidUntil    time.Time
+	DaysRemaining int // negative after the expiry
+	State         CISCertState
+}
+
+// Warning reports if the operator should act, i.e. upgrade the library (or supply the new certificate
+// with SetCISCertificatePEM) before the CIS responses can't be verified anymore
+func (r CISCertReport) Warning() bool {
+	return r.State != CISCertValid
+}
+
+// String returns a human readable summary of the report
+func (r CISCertReport) String() string {
+	return fmt.Sprintf("%s CIS certificate %s: %s, valid until %s (%d days)", r.Environment, r.Serial, r.State, r.ValidUntil.Format(time.RFC3339), r.DaysRemaining)
+}
+
+// CISCertStatus reports the validity of the embedded demo and production CIS certificates, so the operators
+// get an advance notice to upgrade the library before they lapse. The newest embedded certificate of each
+// environment is reported, a certificate expiring in 90 days or less is in the CISCertExpiringSoon state.
+// It doesn't know about the certificates supplied at runtime, use Preflight for the certificate of an entity.
+func CISCertStatus() ([]CISCertReport, error) {
+	return cisCertStatus(time.Now())
+}
+
+func cisCertStatus(now time.Time) ([]CISCertReport, error) {
+	var reports []CISCertReport
+	for _, env := range []struct {
+		name    string
+		certFS  embed.FS
+		dir     string
+		pattern string
+	}{
+		{"demo", demoCISCert, "certDemo", "democis*.pem"},
+		{"production", prodCISCert, "certProd", "fiskalcis*.pem"},
+	} {
+		cert, err := newestEmbeddedCISCert(env.certFS, env.dir, env.pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", env.name, err)
+		}
+		reports = append(reports, newCISCertReport(env.name, cert, now))
+	}
+	return reports, nil
+}
+
+func newCISCertReport(environment string, cert *x509.Certificate, now time.Time) CISCertReport {
+	report := CISCertReport{
+		Environment:   environment,
+		Subject:       cert.Subject.String(),
+		Serial:        cert.SerialNumber.String(),
+		ValidFrom:     cert.NotBefore,
+		ValidUntil:    cert.NotAfter,
+		DaysRemaining: int(cert.NotAfter.Sub(now).Hours() / 24),
+	}
+	switch {
+	case now.Before(cert.NotBefore):
+		report.State = CISCertNotYetValid
+	case now.After(cert.NotAfter):
+		report.State = CISCertExpired
+	case report.DaysRemaining <= cisCertWarnDays:
+		report.State = CISCertExpiringSoon
+	default:
+		report.State = CISCertValid
+	}
+	return report
+}
+
+// newestEmbeddedCISCert returns the embedded CIS certificate valid the longest, unlike parseAndVerifyEmbeddedCerts
+// the expired ones are not skipped
+func newestEmbeddedCISCert(certFS embed.FS, dir string, pattern string) (*x509.Certificate, error) {
+	certFiles, err := certFS.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedded cert files: %w", err)
+	}
+	var newest *x509.Certificate
+	for _, certFile := range certFiles {
+		if match, _ := filepath.Match(pattern, certFile.Name()); certFile.IsDir() || !match {
+			continue
+		}
+		certData, err := certFS.ReadFile(dir + "/" + certFile.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cert file %s: %w", certFile.Name(), err)
+		}
+		certs, err := parsePEMCertificates(certData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse cert file %s: %w", certFile.Name(), err)
+		}
+		if newest == nil || certs[0].NotAfter.After(newest.NotAfter) {
+			newest = certs[0]
+		}
+	}
+	if newest == nil {
+		return nil, fmt.Errorf("no embedded CIS certificate found")
+	}
+	return newest, nil
+}
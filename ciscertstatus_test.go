@@ -0,0 +1,47 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCISCertStatus(t *testing.T) {
+	reports, err := CISCertStatus()
+	if err != nil {
+		t.Fatalf("Failed to get the CIS certificate status: %v", err)
+	}
+	if len(reports) != 2 || reports[0].Environment != "demo" || reports[1].Environment != "production" {
+		t.Fatalf("Expected the demo and production reports, got %+v", reports)
+	}
+
+	for _, report := range reports {
+		for _, tc := range []struct {
+			now      time.Time
+			state    CISCertState
+			warning  bool
+			positive bool
+		}{
+			{report.ValidFrom.Add(-time.Hour), CISCertNotYetValid, true, true},
+			{report.ValidUntil.AddDate(0, 0, -200), CISCertValid, false, true},
+			{report.ValidUntil.AddDate(0, 0, -30), CISCertExpiringSoon, true, true},
+			{report.ValidUntil.AddDate(0, 0, 10), CISCertExpired, true, false},
+		} {
+			got, err := cisCertStatus(tc.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, r := range got {
+				if r.Environment != report.Environment {
+					continue
+				}
+				if r.State != tc.state || r.Warning() != tc.warning || (r.DaysRemaining > 0) != tc.positive {
+					t.Errorf("%s at %s: expected %s, got %s", r.Environment, tc.now, tc.state, r)
+				}
+			}
+		}
+	}
+}
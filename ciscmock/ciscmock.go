@@ -0,0 +1,403 @@
+// Package ciscmock provides an in-process mock of the CIS fiscalization service for tests.
+//
+// The mock runs an httptest TLS server that accepts the same SOAP messages as CIS, verifies
+// the signature of the signed requests and answers with configurable responses, so the whole
+// request path of the library can be tested without the real demo environment:
+//
+//	server := ciscmock.NewServer()
+//	defer server.Close()
+//	if err := server.Configure(entity); err != nil { ... }
+//
+//	jir, zki, err := invoice.InvoiceRequest() // JIR generated by the mock
+//
+//	server.RespondWithErrors(http.StatusInternalServerError, &fiskalhrgo.GreskaType{SifraGreske: "s006", PorukaGreske: "Sistemska pogreška"})
+//
+// Any certificate that contains the OIB in the subject works, it doesn't need to be issued by FINA.
+package ciscmock
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"crypto/x509"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/google/uuid"
+	fiskalhrgo "github.com/l-d-t/fiskalhrgo"
+)
+
+// Request is a request received by the mock
+type Request struct {
+	// Operation is the name of the request message, e.g. "RacunZahtjev" or "EchoRequest"
+	Operation string
+
+	// Header holds the HTTP headers of the request
+	Header http.Header
+
+	// Envelope is the raw SOAP envelope and Payload the request message inside the SOAP Body
+	Envelope []byte
+	Payload  []byte
+
+	// IdPoruke, OIB, ZKI and NakDost of an invoice request (RacunZahtjev), empty otherwise
+	IdPoruke string
+	OIB      string
+	ZKI      string
+	NakDost  bool
+
+	// EchoText is the text of an EchoRequest
+	EchoText string
+
+	// Signed reports whether the request message has a signature,
+	// Signer is the certificate from the signature and SignatureErr the verification error (nil if valid)
+	Signed       bool
+	Signer       *x509.Certificate
+	SignatureErr error
+}
+
+// Response is the answer of the mock to a request
+type Response struct {
+	// StatusCode is the HTTP status code, 200 if 0 and there are no Errors, 500 if 0 and there are Errors
+	StatusCode int
+
+	// JIR returned for an invoice request, a random one is generated if empty
+	JIR string
+
+	// Errors are returned in the Greske element instead of the JIR
+	Errors []*fiskalhrgo.GreskaType
+
+	// Raw is sent as the complete response body instead of a generated response, e.g. a SOAP fault
+	Raw []byte
+
+	// Delay is the time to wait before answering, e.g. to test timeouts
+	Delay time.Duration
+
+	// Unsigned sends the invoice response without the signature, e.g. to test a spoofed response
+	Unsigned bool
+}
+
+// Responder creates the response for a request. Returning nil uses the default response.
+type Responder func(req *Request) *Response
+
+// Server is the mock CIS server
+type Server struct {
+	server *httptest.Server
+	signer *signer
+
+	mu        sync.Mutex
+	responder Responder
+	required  *x509.Certificate
+	requests  []*Request
+}
+
+// NewServer starts a new mock CIS server. Close it when done.
+func NewServer() *Server {
+	signer, err := newSigner()
+	if err != nil {
+		panic(fmt.Sprintf("ciscmock: failed to create the CIS certificate: %v", err))
+	}
+	s := &Server{signer: signer}
+	s.server = httptest.NewTLSServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// URL returns the endpoint URL of the mock
+func (s *Server) URL() string {
+	return s.server.URL
+}
+
+// Certificate returns the TLS certificate of the mock, it has to be trusted by the client
+func (s *Server) Certificate() *x509.Certificate {
+	return s.server.Certificate()
+}
+
+// CISCertificatePEM returns the chain of the certificate signing the mock responses, see fiskalhrgo.FiskalEntity.SetCISCertificatePEM
+func (s *Server) CISCertificatePEM() []byte {
+	return s.signer.chainPEM()
+}
+
+// Configure points the entity to the mock, makes it trust the mock TLS certificate and verify the responses
+// with the mock CIS certificate
+func (s *Server) Configure(fe *fiskalhrgo.FiskalEntity) error {
+	if err := fe.AddTrustedRoot(s.Certificate()); err != nil {
+		return fmt.Errorf("failed to trust the mock certificate: %w", err)
+	}
+	if err := fe.SetCISCertificatePEM(s.CISCertificatePEM()); err != nil {
+		return fmt.Errorf("failed to set the mock CIS certificate: %w", err)
+	}
+	return fe.SetEndpoint(s.URL())
+}
+
+// Close shuts down the mock
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// SetResponder sets the function creating the responses, nil restores the default behavior:
+// the echo text is returned for EchoRequest and a random JIR for a correctly signed RacunZahtjev.
+func (s *Server) SetResponder(responder Responder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responder = responder
+}
+
+// RespondWithErrors makes the mock answer every request with the errors and the HTTP status code
+func (s *Server) RespondWithErrors(statusCode int, errs ...*fiskalhrgo.GreskaType) {
+	s.SetResponder(func(req *Request) *Response {
+		return &Response{StatusCode: statusCode, Errors: errs}
+	})
+}
+
+// RequireSigner makes the mock reject requests not signed with the certificate (with the s004 error).
+// By default any certificate containing the OIB from the request is accepted.
+func (s *Server) RequireSigner(cert *x509.Certificate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.required = cert
+}
+
+// Requests returns all requests received so far
+func (s *Server) Requests() []*Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Request(nil), s.requests...)
+}
+
+// LastRequest returns the last received request, nil if there was none
+func (s *Server) LastRequest() *Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.requests) == 0 {
+		return nil
+	}
+	return s.requests[len(s.requests)-1]
+}
+
+// Reset clears the received requests and restores the default behavior
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = nil
+	s.responder = nil
+	s.required = nil
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req, err := parseRequest(body)
+	if err != nil {
+		writeFault(w, "soap:Client", err.Error())
+		return
+	}
+	req.Header = r.Header.Clone()
+
+	s.mu.Lock()
+	if req.Signed && req.SignatureErr == nil && s.required != nil && !s.required.Equal(req.Signer) {
+		req.SignatureErr = errors.New("request not signed with the required certificate")
+	}
+	s.requests = append(s.requests, req)
+	responder := s.responder
+	s.mu.Unlock()
+
+	var resp *Response
+	if responder != nil {
+		resp = responder(req)
+	}
+	if resp == nil {
+		resp = defaultResponse(req)
+	}
+
+	if resp.Delay > 0 {
+		select {
+		case <-time.After(resp.Delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	status := resp.StatusCode
+	if status == 0 {
+		status = http.StatusOK
+		if len(resp.Errors) > 0 {
+			status = http.StatusInternalServerError
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	if resp.Raw != nil {
+		w.WriteHeader(status)
+		w.Write(resp.Raw)
+		return
+	}
+
+	content, err := buildResponse(req, resp)
+	if err != nil {
+		writeFault(w, "soap:Server", err.Error())
+		return
+	}
+	envelope := []byte(fmt.Sprintf(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>%s</soap:Body></soap:Envelope>`, content))
+	// CIS signs the invoice responses, not the echo
+	if req.Operation != "EchoRequest" && !resp.Unsigned {
+		if envelope, err = s.signer.sign(envelope); err != nil {
+			writeFault(w, "soap:Server", err.Error())
+			return
+		}
+	}
+	w.WriteHeader(status)
+	w.Write(envelope)
+}
+
+// defaultResponse rejects badly signed invoices like CIS does and accepts everything else
+func defaultResponse(req *Request) *Response {
+	if req.Operation != "RacunZahtjev" {
+		return &Response{}
+	}
+	switch {
+	case !req.Signed || req.SignatureErr != nil:
+		return &Response{Errors: []*fiskalhrgo.GreskaType{{SifraGreske: "s004", PorukaGreske: "Neispravan digitalni potpis."}}}
+	case !strings.Contains(req.Signer.Subject.String(), req.OIB):
+		return &Response{Errors: []*fiskalhrgo.GreskaType{{SifraGreske: "s005", PorukaGreske: "OIB iz poruke zahtjeva nije jednak OIB-u iz certifikata."}}}
+	}
+	return &Response{}
+}
+
+// parseRequest extracts the request message from the SOAP envelope and verifies its signature
+func parseRequest(envelope []byte) (*Request, error) {
+	var env struct {
+		Body struct {
+			Content []byte `xml:",innerxml"`
+		} `xml:"Body"`
+	}
+	if err := xml.Unmarshal(envelope, &env); err != nil {
+		return nil, fmt.Errorf("invalid SOAP envelope: %w", err)
+	}
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(env.Body.Content); err != nil {
+		return nil, fmt.Errorf("invalid request message: %w", err)
+	}
+	root := doc.Root()
+	if root == nil {
+		return nil, errors.New("empty SOAP body")
+	}
+
+	req := &Request{
+		Operation: root.Tag,
+		Envelope:  envelope,
+		Payload:   env.Body.Content,
+	}
+
+	switch req.Operation {
+	case "EchoRequest":
+		req.EchoText = root.Text()
+	case "RacunZahtjev":
+		req.IdPoruke = childText(root, "Zaglavlje", "IdPoruke")
+		req.OIB = childText(root, "Racun", "Oib")
+		req.ZKI = childText(root, "Racun", "ZastKod")
+		req.NakDost = childText(root, "Racun", "NakDost") == "true"
+	}
+
+	if signature := root.SelectElement("Signature"); signature != nil {
+		req.Signed = true
+		req.Signer, req.SignatureErr = verifySignature(root, signature)
+	}
+
+	return req, nil
+}
+
+// childText returns the text of the nested child elements, ignoring the namespace prefixes
+func childText(el *etree.Element, path ...string) string {
+	for _, tag := range path {
+		if el = el.SelectElement(tag); el == nil {
+			return ""
+		}
+	}
+	return strings.TrimSpace(el.Text())
+}
+
+// racunOdgovor is the invoice response as sent by CIS
+type racunOdgovor struct {
+	XMLName   xml.Name   `xml:"tns:RacunOdgovor"`
+	Xmlns     string     `xml:"xmlns:tns,attr"`
+	IdAttr    string     `xml:"Id,attr"`
+	Zaglavlje zaglavlje  `xml:"tns:Zaglavlje"`
+	Jir       string     `xml:"tns:Jir,omitempty"`
+	Greske    *greskeOut `xml:"tns:Greske,omitempty"`
+}
+
+type zaglavlje struct {
+	IdPoruke     string `xml:"tns:IdPoruke"`
+	DatumVrijeme string `xml:"tns:DatumVrijeme"`
+}
+
+type greskeOut struct {
+	Greska []greskaOut `xml:"tns:Greska"`
+}
+
+type greskaOut struct {
+	SifraGreske  string `xml:"tns:SifraGreske"`
+	PorukaGreske string `xml:"tns:PorukaGreske"`
+}
+
+// echoResponse is the echo response as sent by CIS
+type echoResponse struct {
+	XMLName xml.Name `xml:"tns:EchoResponse"`
+	Xmlns   string   `xml:"xmlns:tns,attr"`
+	Text    string   `xml:",chardata"`
+}
+
+// zagreb is the time zone of the CIS clock, the time zone database is embedded by fiskalhrgo
+var zagreb, _ = time.LoadLocation("Europe/Zagreb")
+
+// buildResponse creates the response message for the request
+func buildResponse(req *Request, resp *Response) ([]byte, error) {
+	if req.Operation == "EchoRequest" {
+		return xml.Marshal(echoResponse{Xmlns: fiskalhrgo.DefaultNamespace, Text: req.EchoText})
+	}
+
+	odgovor := racunOdgovor{
+		Xmlns:  fiskalhrgo.DefaultNamespace,
+		IdAttr: uuid.New().String(),
+		Zaglavlje: zaglavlje{
+			IdPoruke:     req.IdPoruke,
+			DatumVrijeme: time.Now().In(zagreb).Format("02.01.2006T15:04:05"),
+		},
+	}
+
+	if len(resp.Errors) > 0 {
+		odgovor.Greske = &greskeOut{}
+		for _, greska := range resp.Errors {
+			odgovor.Greske.Greska = append(odgovor.Greske.Greska, greskaOut{SifraGreske: greska.SifraGreske, PorukaGreske: greska.PorukaGreske})
+		}
+	} else {
+		odgovor.Jir = resp.JIR
+		if odgovor.Jir == "" {
+			odgovor.Jir = uuid.New().String()
+		}
+	}
+
+	return xml.Marshal(odgovor)
+}
+
+// writeFault answers with a SOAP fault
+func writeFault(w http.ResponseWriter, code string, message string) {
+	var escaped strings.Builder
+	xml.EscapeText(&escaped, []byte(message))
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	w.WriteHeader(http.StatusInternalServerError)
+	fmt.Fprintf(w, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault><faultcode>%s</faultcode><faultstring>%s</faultstring></soap:Fault></soap:Body></soap:Envelope>`, code, escaped.String())
+}
@@ -0,0 +1,258 @@
+package ciscmock
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	fiskalhrgo "github.com/l-d-t/fiskalhrgo"
+	"github.com/l-d-t/fiskalhrgo/fiskaltest"
+)
+
+// newTestEntity creates an entity from the same environment variables as the main package tests,
+// or with a synthetic certificate if they are not set
+func newTestEntity(t testing.TB) *fiskalhrgo.FiskalEntity {
+	t.Helper()
+	certBase64 := os.Getenv("CIS_P12_BASE64")
+	certPassword := os.Getenv("FISKALHRGO_TEST_CERT_PASSWORD")
+	oib := os.Getenv("FISKALHRGO_TEST_CERT_OIB")
+	if certBase64 == "" || certPassword == "" || oib == "" {
+		// The mock accepts any certificate, use a synthetic one
+		cert, err := fiskaltest.NewCertificate(fiskaltest.OIB)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p12, err := cert.P12("fiskaltest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fe, err := fiskalhrgo.NewFiskalEntityWithOptions(fiskaltest.OIB, fiskalhrgo.WithLocation("TESTMOCK"), fiskalhrgo.WithDemoMode(true),
+			fiskalhrgo.WithCertP12(p12, "fiskaltest"), fiskalhrgo.WithChainVerification(false), fiskalhrgo.WithClock(fiskaltest.Clock))
+		if err != nil {
+			t.Fatalf("Failed to create entity: %v", err)
+		}
+		return fe
+	}
+
+	certData, err := base64.StdEncoding.DecodeString(certBase64)
+	if err != nil {
+		t.Fatalf("Failed to decode base64 certificate: %v", err)
+	}
+	certPath := filepath.Join(t.TempDir(), "fiskal.p12")
+	if err := os.WriteFile(certPath, certData, 0600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+
+	fe, err := fiskalhrgo.NewFiskalEntityWithOptions(oib, fiskalhrgo.WithLocation("TESTMOCK"), fiskalhrgo.WithDemoMode(true),
+		fiskalhrgo.WithCertFile(certPath, certPassword), fiskalhrgo.WithClock(fiskaltest.Clock))
+	if err != nil {
+		t.Fatalf("Failed to create entity: %v", err)
+	}
+	return fe
+}
+
+func newMockedEntity(t testing.TB) (*Server, *fiskalhrgo.FiskalEntity) {
+	t.Helper()
+	fe := newTestEntity(t)
+	server := NewServer()
+	t.Cleanup(server.Close)
+	if err := server.Configure(fe); err != nil {
+		t.Fatalf("Failed to configure entity: %v", err)
+	}
+	return server, fe
+}
+
+func newInvoice(t testing.TB, fe *fiskalhrgo.FiskalEntity) *fiskalhrgo.RacunType {
+	t.Helper()
+	invoice, _, err := fe.NewCISInvoice(time.Now(), 1, 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "10.00", fiskalhrgo.CISCash, "12345678901")
+	if err != nil {
+		t.Fatalf("Failed to create invoice: %v", err)
+	}
+	return invoice
+}
+
+func TestEcho(t *testing.T) {
+	server, fe := newMockedEntity(t)
+
+	if err := fe.PingCIS(); err != nil {
+		t.Fatalf("Ping failed: %v", err)
+	}
+	if req := server.LastRequest(); req == nil || req.Operation != "EchoRequest" || req.Signed {
+		t.Errorf("Unexpected request: %+v", req)
+	}
+}
+
+func TestInvoiceRequest(t *testing.T) {
+	server, fe := newMockedEntity(t)
+	invoice := newInvoice(t, fe)
+
+	jir, zki, err := invoice.InvoiceRequest()
+	if err != nil {
+		t.Fatalf("InvoiceRequest failed: %v", err)
+	}
+	if !fiskalhrgo.ValidateJIR(jir) {
+		t.Errorf("Invalid JIR: %s", jir)
+	}
+
+	req := server.LastRequest()
+	if req.Operation != "RacunZahtjev" || req.ZKI != zki || req.OIB != fe.OIB() || req.NakDost {
+		t.Errorf("Unexpected request: %+v", req)
+	}
+	if !req.Signed || req.SignatureErr != nil {
+		t.Errorf("Expected a valid signature, got %v", req.SignatureErr)
+	}
+
+	// A signature with another certificate is rejected with s004
+	server.RequireSigner(server.Certificate())
+	_, _, err = invoice.InvoiceRequest()
+	if !errors.Is(err, fiskalhrgo.ErrInvalidSignature) {
+		t.Errorf("Expected s004, got %v", err)
+	}
+}
+
+func TestInvoiceRequestResult(t *testing.T) {
+	server, fe := newMockedEntity(t)
+	invoice := newInvoice(t, fe)
+
+	result, err := invoice.InvoiceRequestResult()
+	if err != nil {
+		t.Fatalf("InvoiceRequestResult failed: %v", err)
+	}
+	req := server.LastRequest()
+	if !fiskalhrgo.ValidateJIR(result.JIR) || result.ZKI != req.ZKI || result.IdPoruke != req.IdPoruke {
+		t.Errorf("Unexpected result %+v for the request %+v", result, req)
+	}
+	if result.StatusCode != http.StatusOK || result.DatumVrijeme == "" || result.Duration <= 0 || !strings.Contains(string(result.Response), result.JIR) {
+		t.Errorf("Expected the response details, got %+v", result)
+	}
+
+	// A rejected request keeps the details of the exchange
+	server.RespondWithErrors(http.StatusBadRequest, &fiskalhrgo.GreskaType{SifraGreske: "s005", PorukaGreske: "Neispravan OIB"})
+	result, err = invoice.InvoiceRequestResult()
+	if err == nil || result == nil || result.JIR != "" {
+		t.Fatalf("Expected the request to be rejected, got %+v, %v", result, err)
+	}
+	if result.IdPoruke != server.LastRequest().IdPoruke || result.StatusCode != http.StatusBadRequest || !strings.Contains(string(result.Response), "s005") {
+		t.Errorf("Expected the details of the rejected request, got %+v", result)
+	}
+
+	if result, err := (*fiskalhrgo.RacunType)(nil).InvoiceRequestResult(); result != nil || err == nil {
+		t.Errorf("Expected an error for a nil invoice, got %+v", result)
+	}
+}
+
+// BenchmarkInvoiceRequest measures the whole request path: building, signing, sending over TLS
+// and verifying the signed response
+func BenchmarkInvoiceRequest(b *testing.B) {
+	_, fe := newMockedEntity(b)
+	invoice := newInvoice(b, fe)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := invoice.InvoiceRequest(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestInvoiceRequestECDSA(t *testing.T) {
+	const oib = "65049901548"
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "Test EC CA"}, IsCA: true, BasicConstraintsValid: true,
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour), KeyUsage: x509.KeyUsageCertSign}
+	template := &x509.Certificate{SerialNumber: big.NewInt(2), Subject: pkix.Name{CommonName: "FISKAL 1", Organization: []string{"TEST D.O.O. HR" + oib}, Country: []string{"HR"}},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour), KeyUsage: x509.KeyUsageDigitalSignature}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, _ := x509.ParseCertificate(caDER)
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	fe, err := fiskalhrgo.NewFiskalEntityWithOptions(oib, fiskalhrgo.WithLocation("TESTMOCK"), fiskalhrgo.WithDemoMode(true),
+		fiskalhrgo.WithSigner(key, cert, caCert), fiskalhrgo.WithChainVerification(false), fiskalhrgo.WithClock(fiskaltest.Clock))
+	if err != nil {
+		t.Fatalf("Failed to create entity: %v", err)
+	}
+	server := NewServer()
+	t.Cleanup(server.Close)
+	if err := server.Configure(fe); err != nil {
+		t.Fatalf("Failed to configure entity: %v", err)
+	}
+
+	jir, _, err := newInvoice(t, fe).InvoiceRequest()
+	if err != nil || !fiskalhrgo.ValidateJIR(jir) {
+		t.Fatalf("InvoiceRequest failed: %v", err)
+	}
+	if req := server.LastRequest(); !req.Signed || req.SignatureErr != nil {
+		t.Errorf("Expected a valid ECDSA signature, got %v", req.SignatureErr)
+	}
+}
+
+func TestConfiguredResponses(t *testing.T) {
+	server, fe := newMockedEntity(t)
+	invoice := newInvoice(t, fe)
+
+	server.RespondWithErrors(http.StatusInternalServerError, &fiskalhrgo.GreskaType{SifraGreske: "s006", PorukaGreske: "Sistemska pogreška prilikom obrade zahtjeva."})
+	_, _, err := invoice.InvoiceRequest()
+	if !errors.Is(err, fiskalhrgo.ErrCISSystemError) || !fiskalhrgo.IsRetriable(err) {
+		t.Errorf("Expected a retriable s006, got %v", err)
+	}
+
+	server.SetResponder(func(req *Request) *Response {
+		return &Response{JIR: "9d6f5bb6-da48-4fcd-a803-4586a025e0e4"}
+	})
+	jir, _, err := invoice.InvoiceRequest()
+	if err != nil || jir != "9d6f5bb6-da48-4fcd-a803-4586a025e0e4" {
+		t.Errorf("Expected the configured JIR, got %s, %v", jir, err)
+	}
+
+	// A response without the CIS signature is rejected, e.g. a spoofed JIR
+	server.SetResponder(func(req *Request) *Response {
+		return &Response{JIR: "9d6f5bb6-da48-4fcd-a803-4586a025e0e4", Unsigned: true}
+	})
+	if jir, _, err := invoice.InvoiceRequest(); !errors.Is(err, fiskalhrgo.ErrResponseSignature) || jir != "" {
+		t.Errorf("Expected ErrResponseSignature for an unsigned response, got %s, %v", jir, err)
+	}
+
+	server.SetResponder(func(req *Request) *Response {
+		return &Response{StatusCode: http.StatusInternalServerError, Raw: []byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault><faultcode>soap:Server</faultcode><faultstring>down</faultstring></soap:Fault></soap:Body></soap:Envelope>`)}
+	})
+	_, _, err = invoice.InvoiceRequest()
+	var fault *fiskalhrgo.SOAPFaultError
+	if !errors.As(err, &fault) || fault.String != "down" {
+		t.Errorf("Expected the SOAP fault, got %v", err)
+	}
+
+	server.Reset()
+	if _, _, err := invoice.InvoiceRequest(); err != nil || len(server.Requests()) != 1 {
+		t.Errorf("Expected the default behavior after Reset, got %v", err)
+	}
+}
@@ -0,0 +1,206 @@
+package ciscmock
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+	fiskalhrgo "github.com/l-d-t/fiskalhrgo"
+)
+
+// verifySignature verifies the enveloped XML signature of the request message the same way CIS does
+// (exclusive c14n, RSA-SHA1 or ECDSA-SHA1) and returns the signing certificate from the KeyInfo
+func verifySignature(root *etree.Element, signature *etree.Element) (*x509.Certificate, error) {
+	certElement := signature.FindElement("./KeyInfo/X509Data/X509Certificate")
+	if certElement == nil {
+		return nil, errors.New("signature has no X509Certificate")
+	}
+	der, err := base64.StdEncoding.DecodeString(strings.TrimSpace(certElement.Text()))
+	if err != nil {
+		return nil, fmt.Errorf("invalid X509Certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("invalid X509Certificate: %w", err)
+	}
+
+	signedInfo := signature.SelectElement("SignedInfo")
+	if signedInfo == nil {
+		return cert, errors.New("signature has no SignedInfo")
+	}
+	reference := signedInfo.SelectElement("Reference")
+	if reference == nil || reference.SelectAttrValue("URI", "") != "#"+root.SelectAttrValue("Id", "") {
+		return cert, errors.New("signature reference does not match the message Id")
+	}
+	digestElement := reference.SelectElement("DigestValue")
+	signatureValue := signature.SelectElement("SignatureValue")
+	if digestElement == nil || signatureValue == nil {
+		return cert, errors.New("signature has no DigestValue or SignatureValue")
+	}
+
+	canonicalizer := fiskalhrgo.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+
+	// Enveloped signature transform: the digest is calculated without the Signature element
+	unsigned := root.Copy()
+	unsigned.RemoveChild(unsigned.SelectElement("Signature"))
+	canonical, err := canonicalizer.Canonicalize(unsigned)
+	if err != nil {
+		return cert, fmt.Errorf("failed to canonicalize the message: %w", err)
+	}
+	digest := sha1.Sum(canonical)
+	if base64.StdEncoding.EncodeToString(digest[:]) != strings.TrimSpace(digestElement.Text()) {
+		return cert, errors.New("digest mismatch, the message was modified after signing")
+	}
+
+	canonicalSignedInfo, err := canonicalizer.Canonicalize(signedInfo.Copy())
+	if err != nil {
+		return cert, fmt.Errorf("failed to canonicalize SignedInfo: %w", err)
+	}
+	signatureBytes, err := base64.StdEncoding.DecodeString(strings.TrimSpace(signatureValue.Text()))
+	if err != nil {
+		return cert, fmt.Errorf("invalid SignatureValue: %w", err)
+	}
+	hashed := sha1.Sum(canonicalSignedInfo)
+	switch publicKey := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(publicKey, crypto.SHA1, hashed[:], signatureBytes); err != nil {
+			return cert, fmt.Errorf("invalid signature: %w", err)
+		}
+	case *ecdsa.PublicKey:
+		// XML-DSig ECDSA signatures are r and s concatenated
+		half := len(signatureBytes) / 2
+		r, s := new(big.Int).SetBytes(signatureBytes[:half]), new(big.Int).SetBytes(signatureBytes[half:])
+		if len(signatureBytes)%2 != 0 || !ecdsa.Verify(publicKey, hashed[:], r, s) {
+			return cert, errors.New("invalid signature: ECDSA verification failed")
+		}
+	default:
+		return cert, errors.New("signing certificate has no RSA or ECDSA public key")
+	}
+
+	return cert, nil
+}
+
+// signer signs the response messages like CIS does (inclusive C14N 1.0, RSA-SHA1), with its own CIS certificate
+type signer struct {
+	key    *rsa.PrivateKey
+	cert   *x509.Certificate
+	caCert *x509.Certificate
+}
+
+// newSigner creates the mock CIS certificate issued by a mock CA
+func newSigner() (*signer, error) {
+	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	notBefore := time.Now().Add(-2 * 365 * 24 * time.Hour)
+	notAfter := time.Now().Add(365 * 24 * time.Hour)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "CISMOCK CA", Country: []string{"HR"}},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter.Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "fiskalcismock", Organization: []string{"Ministarstvo financija"}, Country: []string{"HR"}},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &signer{key: key, cert: cert, caCert: caCert}, nil
+}
+
+// chainPEM returns the mock CIS certificate chain in the format of the embedded CIS certificates
+func (s *signer) chainPEM() []byte {
+	chain := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.cert.Raw})
+	return append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.caCert.Raw})...)
+}
+
+// sign adds the enveloped signature to the message in the SOAP Body of the envelope
+func (s *signer) sign(envelope []byte) ([]byte, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(envelope); err != nil {
+		return nil, err
+	}
+	body := doc.Root().SelectElement("Body")
+	if body == nil || len(body.ChildElements()) != 1 {
+		return nil, errors.New("no message to sign")
+	}
+	message := body.ChildElements()[0]
+
+	// Inclusive canonicalization takes the namespaces declared on the ancestors (the SOAP envelope) into account
+	canonicalizer := fiskalhrgo.MakeC14N10RecCanonicalizer()
+	canonical, err := canonicalizer.Canonicalize(message)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha1.Sum(canonical)
+
+	signature := message.CreateElement("Signature")
+	signature.CreateAttr("xmlns", "http://www.w3.org/2000/09/xmldsig#")
+	signedInfo := signature.CreateElement("SignedInfo")
+	signedInfo.CreateElement("CanonicalizationMethod").CreateAttr("Algorithm", string(fiskalhrgo.CanonicalXML10RecAlgorithmId))
+	signedInfo.CreateElement("SignatureMethod").CreateAttr("Algorithm", fiskalhrgo.RSASHA1SignatureMethod)
+	reference := signedInfo.CreateElement("Reference")
+	reference.CreateAttr("URI", "#"+message.SelectAttrValue("Id", ""))
+	transforms := reference.CreateElement("Transforms")
+	transforms.CreateElement("Transform").CreateAttr("Algorithm", string(fiskalhrgo.EnvelopedSignatureAltorithmId))
+	transforms.CreateElement("Transform").CreateAttr("Algorithm", string(fiskalhrgo.CanonicalXML10RecAlgorithmId))
+	reference.CreateElement("DigestMethod").CreateAttr("Algorithm", "http://www.w3.org/2000/09/xmldsig#sha1")
+	reference.CreateElement("DigestValue").SetText(base64.StdEncoding.EncodeToString(digest[:]))
+
+	canonicalSignedInfo, err := canonicalizer.Canonicalize(signedInfo)
+	if err != nil {
+		return nil, err
+	}
+	hashed := sha1.Sum(canonicalSignedInfo)
+	signatureValue, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA1, hashed[:])
+	if err != nil {
+		return nil, err
+	}
+	signature.CreateElement("SignatureValue").SetText(base64.StdEncoding.EncodeToString(signatureValue))
+	signature.CreateElement("KeyInfo").CreateElement("X509Data").CreateElement("X509Certificate").SetText(base64.StdEncoding.EncodeToString(s.cert.Raw))
+
+	return doc.WriteToBytes()
+}
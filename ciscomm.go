@@ -5,28 +5,37 @@ package fiskalhrgo
 // Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
 
 import (
-	"bytes"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/xml"
 	"errors"
 	"fmt"
-	"io"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"time"
 )
 
-// iSOAPEnvelope represents a SOAP envelope
-type iSOAPEnvelope struct {
-	XMLName xml.Name  `xml:"soapenv:Envelope"`
-	XmlnsT  string    `xml:"xmlns:tns,attr"` // Declare the tns namespace
-	Xmlns   string    `xml:"xmlns:soapenv,attr"`
-	Body    iSOAPBody `xml:"soapenv:Body"`
-}
+// defaultMaxResponseSize is the default limit for the size of a CIS response body.
+// Normal CIS responses are a few kilobytes, so 1 MiB is plenty.
+const defaultMaxResponseSize = 1 << 20
 
-// iSOAPBody represents the body of a SOAP envelope
-type iSOAPBody struct {
-	XMLName xml.Name `xml:"soapenv:Body"`
-	Content []byte   `xml:",innerxml"`
+// ErrResponseTooLarge is returned when the CIS response body exceeds the configured size limit
+var ErrResponseTooLarge = errors.New("CIS response too large")
+
+// soapEnvelopeStart and soapEnvelopeEnd are the static parts of the SOAP envelope of the requests,
+// built once instead of marshaling an envelope struct for every request
+const (
+	soapEnvelopeStart = `<soapenv:Envelope xmlns:tns="` + DefaultNamespace + `" xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/"><soapenv:Body>`
+	soapEnvelopeEnd   = `</soapenv:Body></soapenv:Envelope>`
+)
+
+// soapEnvelope wraps the XML payload in the SOAP envelope
+func soapEnvelope(xmlPayload []byte) []byte {
+	envelope := make([]byte, 0, len(soapEnvelopeStart)+len(xmlPayload)+len(soapEnvelopeEnd))
+	envelope = append(envelope, soapEnvelopeStart...)
+	envelope = append(envelope, xmlPayload...)
+	return append(envelope, soapEnvelopeEnd...)
 }
 
 // iSOAPEnvelopeNoNamespace represents a SOAP envelope without namespace (for CIS responses)
@@ -42,87 +51,418 @@ type iSOAPBodyNoNamespace struct {
 	Content []byte   `xml:",innerxml"`
 }
 
+// SetHTTPClient sets a preconfigured HTTP client to be used for the communication with CIS,
+// for example with a proxy, custom timeouts or connection limits.
+//
+// The client Transport must be nil or an *http.Transport. The library clones the transport
+// and always enforces its own TLS settings (TLS 1.3 and the CIS CA pool), so the CIS server
+// certificate is still verified against the embedded certificates. To add tracing or logging
+// middleware use SetTransportWrapper instead of a custom RoundTripper.
+// Passing nil restores the default client.
+func (fe *FiskalEntity) SetHTTPClient(client *http.Client) error {
+	if client != nil && client.Transport != nil {
+		if _, ok := client.Transport.(*http.Transport); !ok {
+			return errors.New("unsupported HTTP client transport: must be nil or *http.Transport, use SetTransportWrapper for custom RoundTrippers")
+		}
+	}
+	fe.clientMu.Lock()
+	defer fe.clientMu.Unlock()
+	fe.httpClient = client
+	fe.resetHTTPClientLocked()
+	return nil
+}
+
+// SetTransportWrapper sets a function that wraps the transport used for the communication with CIS.
+// The wrapper receives the library transport with the enforced TLS settings and returns a RoundTripper
+// that must eventually delegate to it, for example a tracing or logging transport.
+// Passing nil removes the wrapper.
+func (fe *FiskalEntity) SetTransportWrapper(wrapper func(http.RoundTripper) http.RoundTripper) {
+	fe.clientMu.Lock()
+	defer fe.clientMu.Unlock()
+	fe.wrapTransport = wrapper
+	fe.resetHTTPClientLocked()
+}
+
+// AddTrustedRoot adds a certificate to the CA pool used to verify the CIS server TLS certificate.
+// The embedded CIS CA certificates remain trusted. Use it when a new CA is introduced before
+// a library release embeds it, or when a TLS inspecting middlebox re-signs the traffic.
+func (fe *FiskalEntity) AddTrustedRoot(cert *x509.Certificate) error {
+	if cert == nil {
+		return errors.New("certificate is nil")
+	}
+
+	fe.clientMu.Lock()
+	defer fe.clientMu.Unlock()
+	ciscert := fe.cisCertificateLocked()
+	if ciscert == nil || ciscert.SSLverifyPoll == nil {
+		return errors.New("CIScert or SSLverifyPoll is not initialized")
+	}
+
+	// Clone the pool so the change never leaks to other users of the same pool
+	pool := ciscert.SSLverifyPoll.Clone()
+	pool.AddCert(cert)
+	fe.replaceCISPoolLocked(pool)
+	return nil
+}
+
+// AddTrustedRootPEM parses PEM encoded certificates and adds all of them to the CA pool
+// used to verify the CIS server TLS certificate, see AddTrustedRoot.
+func (fe *FiskalEntity) AddTrustedRootPEM(pemData []byte) error {
+	certs, err := parsePEMCertificates(pemData)
+	if err != nil {
+		return err
+	}
+	for _, cert := range certs {
+		if err := fe.AddTrustedRoot(cert); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetTrustedRoots replaces the CA pool used to verify the CIS server TLS certificate.
+// The embedded CIS CA certificates are no longer trusted unless they are part of the new pool.
+func (fe *FiskalEntity) SetTrustedRoots(pool *x509.CertPool) error {
+	if pool == nil {
+		return errors.New("CA pool is nil")
+	}
+
+	fe.clientMu.Lock()
+	defer fe.clientMu.Unlock()
+	if fe.cisCertificateLocked() == nil {
+		return errors.New("CIScert is not initialized")
+	}
+	fe.replaceCISPoolLocked(pool)
+	return nil
+}
+
+// SetEndpoint overrides the CIS endpoint URL, e.g. to use a mock CIS server in tests or a proxy.
+// The URL must use https. The default is the demo or production CIS endpoint depending on the demo mode.
+func (fe *FiskalEntity) SetEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid endpoint URL: %w", err)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return errors.New("endpoint URL must be an absolute https URL")
+	}
+	fe.clientMu.Lock()
+	defer fe.clientMu.Unlock()
+	fe.url = endpoint
+	return nil
+}
+
+// Endpoint returns the CIS endpoint URL used by the entity.
+func (fe *FiskalEntity) Endpoint() string {
+	fe.clientMu.Lock()
+	defer fe.clientMu.Unlock()
+	return fe.url
+}
+
+// SetUserAgent sets the User-Agent header sent with every request to CIS.
+// An empty string restores the default.
+func (fe *FiskalEntity) SetUserAgent(userAgent string) {
+	fe.clientMu.Lock()
+	defer fe.clientMu.Unlock()
+	fe.userAgent = userAgent
+}
+
+// SetRequestHeader sets an extra HTTP header sent with every request to CIS,
+// for example a correlation ID for an API gateway. An empty value removes the header.
+// The Content-Type header is controlled by the library and can't be changed.
+func (fe *FiskalEntity) SetRequestHeader(key string, value string) {
+	fe.clientMu.Lock()
+	defer fe.clientMu.Unlock()
+	if fe.headers == nil {
+		fe.headers = make(http.Header)
+	}
+	if value == "" {
+		fe.headers.Del(key)
+		return
+	}
+	fe.headers.Set(key, value)
+}
+
+// SetMaxResponseSize sets the maximal size in bytes of a CIS response body that will be read.
+// Bigger responses are rejected with ErrResponseTooLarge, protecting small devices from running
+// out of memory on malformed or malicious replies. Zero or negative restores the default (1 MiB).
+func (fe *FiskalEntity) SetMaxResponseSize(size int64) {
+	fe.clientMu.Lock()
+	defer fe.clientMu.Unlock()
+	fe.maxResponseSize = size
+}
+
+// maxResponseBodySize returns the configured response size limit or the default
+func (fe *FiskalEntity) maxResponseBodySize() int64 {
+	fe.clientMu.Lock()
+	defer fe.clientMu.Unlock()
+	if fe.maxResponseSize <= 0 {
+		return defaultMaxResponseSize
+	}
+	return fe.maxResponseSize
+}
+
+// applyHeaders sets the entity and per call headers on the request.
+// Per call headers override the entity headers with the same name.
+func (fe *FiskalEntity) applyHeaders(req *http.Request, header http.Header) {
+	fe.clientMu.Lock()
+	userAgent := fe.userAgent
+	for key, values := range fe.headers {
+		req.Header[key] = append([]string(nil), values...)
+	}
+	fe.clientMu.Unlock()
+
+	for key, values := range header {
+		req.Header[http.CanonicalHeaderKey(key)] = append([]string(nil), values...)
+	}
+
+	if req.Header.Get("User-Agent") == "" {
+		if userAgent == "" {
+			userAgent = defaultUserAgent
+		}
+		req.Header.Set("User-Agent", userAgent)
+	}
+	req.Header.Set("Content-Type", "text/xml")
+}
+
+// CloseIdleConnections closes the idle keep-alive connections to CIS.
+// The next request opens a new connection.
+func (fe *FiskalEntity) CloseIdleConnections() {
+	fe.clientMu.Lock()
+	defer fe.clientMu.Unlock()
+	if fe.client != nil {
+		fe.client.CloseIdleConnections()
+	}
+}
+
+// getHTTPClient returns the cached HTTP client, creating it on first use
+func (fe *FiskalEntity) getHTTPClient() *http.Client {
+	fe.clientMu.Lock()
+	defer fe.clientMu.Unlock()
+	if fe.client == nil {
+		fe.client = fe.newHTTPClientLocked()
+	}
+	return fe.client
+}
+
+// resetHTTPClientLocked drops the cached client after a settings change, clientMu must be held
+func (fe *FiskalEntity) resetHTTPClientLocked() {
+	if fe.client != nil {
+		fe.client.CloseIdleConnections()
+		fe.client = nil
+	}
+}
+
+// newHTTPClientLocked builds the HTTP client used for the communication with CIS
+// from the optional user provided client, enforcing the CIS TLS settings, clientMu must be held.
+// Use getHTTPClient to get the cached instance.
+func (fe *FiskalEntity) newHTTPClientLocked() *http.Client {
+	var transport *http.Transport
+	client := &http.Client{
+		Timeout: cistimeout * time.Second, // Set a timeout for the request
+	}
+
+	if fe.httpClient != nil {
+		*client = *fe.httpClient
+		if client.Timeout == 0 {
+			client.Timeout = cistimeout * time.Second
+		}
+		if t, ok := fe.httpClient.Transport.(*http.Transport); ok && t != nil {
+			transport = t.Clone()
+		}
+	}
+	if transport == nil {
+		transport = &http.Transport{}
+	}
+
+	// Create a custom TLS configuration using TLS 1.3 and the CA pool
+	// keeping any other settings from the user provided transport
+	tlsConfig := &tls.Config{}
+	if transport.TLSClientConfig != nil {
+		tlsConfig = transport.TLSClientConfig.Clone()
+	}
+	tlsConfig.MinVersion = tls.VersionTLS13
+	tlsConfig.RootCAs = fe.cisCertificateLocked().SSLverifyPoll
+	tlsConfig.InsecureSkipVerify = false
+	transport.TLSClientConfig = tlsConfig
+
+	var roundTripper http.RoundTripper = transport
+	if fe.wrapTransport != nil {
+		roundTripper = fe.wrapTransport(transport)
+	}
+	client.Transport = roundTripper
+
+	return client
+}
+
 // GetResponse wraps the XML payload in a SOAP envelope, makes an HTTPS request, and returns the extracted response body.
 // - Input: XML payload
 // - Output: Response body, error, HTTP status code
 func (fe *FiskalEntity) GetResponse(xmlPayload []byte, sign bool) ([]byte, int, error) {
-	if fe.ciscert == nil || fe.ciscert.SSLverifyPoll == nil {
-		return nil, 0, errors.New("CIScert or SSLverifyPoll is not initialized")
-	}
-	// Create a custom TLS configuration using TLS 1.3 and the CA pool
-	tlsConfig := &tls.Config{
-		MinVersion: tls.VersionTLS13,
-		RootCAs:    fe.ciscert.SSLverifyPoll,
+	return fe.GetResponseWithHeaders(xmlPayload, sign, nil)
+}
+
+// GetResponseWithHeaders works like GetResponse, adding the extra HTTP headers to this request only.
+// The headers are added after the entity headers set with SetRequestHeader and override them.
+// Errors are returned as *FiskalError.
+func (fe *FiskalEntity) GetResponseWithHeaders(xmlPayload []byte, sign bool, header http.Header) ([]byte, int, error) {
+	if err := fe.beginRequest(); err != nil {
+		return nil, 0, err
 	}
+	defer fe.endRequest()
+	resp, err := fe.send("", xmlPayload, sign, header)
+	return resp.content, resp.status, err
+}
 
-	// Create a custom HTTP client with the custom TLS configuration
-	client := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: tlsConfig,
-		},
-		Timeout: cistimeout * time.Second, // Set a timeout for the request
+// cisResponse is the response to a request sent to CIS
+type cisResponse struct {
+	// request is the SOAP envelope sent to CIS, nil if it was not sent
+	request []byte
+
+	// body is the raw response body, content the inner content of the SOAP Body
+	body    []byte
+	content []byte
+
+	// status is the HTTP status code, 0 if no response was received
+	status int
+
+	// meta describes the HTTP response, nil if no response was received or the transport is not based on HTTP
+	meta *ResponseMetadata
+
+	// duration of the request, zero if it was not sent
+	duration time.Duration
+
+	// warnings about an accepted response, e.g. when it was accepted without a valid signature
+	warnings []string
+}
+
+// send does the work of GetResponseWithHeaders, the request is sent to the endpoint or to the entity endpoint
+// if it is empty. The returned response is never nil.
+func (fe *FiskalEntity) send(endpoint string, xmlPayload []byte, sign bool, header http.Header) (*cisResponse, error) {
+	if ciscert := fe.cisCertificate(); ciscert == nil || ciscert.SSLverifyPoll == nil {
+		return &cisResponse{}, newFiskalError(CategoryInput, errors.New("CIScert or SSLverifyPoll is not initialized"))
 	}
 
+	fe.checkCertificateExpiry()
+
+	operation := operationName(xmlPayload)
+	metrics := fe.getMetrics()
+
 	if sign {
 		// Sign the XML payload
+		signingStarted := time.Now()
 		signedXML, err := fe.signXML(xmlPayload)
+		if metrics != nil {
+			metrics.ObserveSigning(time.Since(signingStarted))
+		}
 		if err != nil {
-			return nil, 0, fmt.Errorf("failed to sign XML: %w", err)
+			return &cisResponse{}, newFiskalError(CategorySignature, fmt.Errorf("failed to sign XML: %w", err))
 		}
 		xmlPayload = signedXML
+		fe.log(lifecycleLevel, "CIS request signed")
 	}
 
-	// Prepare the SOAP envelope with the payload
-	soapEnvelope := iSOAPEnvelope{
-		XmlnsT: DefaultNamespace,
-		Xmlns:  "http://schemas.xmlsoap.org/soap/envelope/",
-		Body:   iSOAPBody{Content: xmlPayload},
+	// Wrap the payload in the SOAP envelope
+	marshaledEnvelope := soapEnvelope(xmlPayload)
+
+	if endpoint == "" {
+		endpoint = fe.Endpoint()
 	}
-	// Marshal the SOAP envelope to XML
-	marshaledEnvelope, err := xml.Marshal(soapEnvelope)
+	fe.log(lifecycleLevel, "sending CIS request", slog.String("url", endpoint), slog.Int("size", len(marshaledEnvelope)))
+	started := time.Now()
+	resp, err := fe.exchange(&TransportRequest{Operation: operation, Endpoint: endpoint, Envelope: marshaledEnvelope, Header: header}, sign)
+	resp.request, resp.duration = marshaledEnvelope, time.Since(started)
+	attrs := []slog.Attr{slog.String("operation", operation), slog.Int("status", resp.status), slog.Duration("duration", resp.duration)}
+	attrs = append(attrs, metadataLogAttrs(resp.meta)...)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to marshal SOAP envelope: %w", err)
+		attrs = append(attrs, errorAttrs(err)...)
+	}
+	fe.log(lifecycleLevel, "CIS response received", attrs...)
+	if metrics != nil {
+		metrics.ObserveRequest(operation, outcomeOf(err), resp.duration)
+	}
+	fe.stats.observeRequest(resp.duration, err)
+	exchange := &Exchange{
+		Operation:  operation,
+		Request:    marshaledEnvelope,
+		Response:   resp.body,
+		StatusCode: resp.status,
+		Metadata:   resp.meta,
+		Started:    started,
+		Duration:   resp.duration,
+		Err:        err,
 	}
+	fe.notifyExchange(exchange)
+	fe.emitSlowRequest(exchange)
+	if sign {
+		fe.archiveExchange(exchange)
+	}
+	fe.dumpExchange(exchange)
+	return resp, err
+}
 
-	// Create a new HTTP POST request
-	req, err := http.NewRequest("POST", fe.url, bytes.NewBuffer([]byte(marshaledEnvelope)))
+// exchange sends the SOAP envelope to CIS with the entity transport and returns the raw response body,
+// the inner content of the SOAP Body, and the HTTP status code. The returned response is never nil.
+func (fe *FiskalEntity) exchange(treq *TransportRequest, sign bool) (*cisResponse, error) {
+	resp, err := fe.getTransport().Send(treq)
+	if resp == nil {
+		resp = &TransportResponse{}
+	}
+	response := &cisResponse{body: resp.Body, status: resp.StatusCode, meta: resp.Metadata}
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to create request: %w", err)
+		var fErr *FiskalError
+		if !errors.As(err, &fErr) {
+			err = wrapFiskalError("transport failed", CategoryTransport, err)
+		}
+		return response, err
 	}
-	req.Header.Set("Content-Type", "text/xml")
 
-	// Send the request
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, 0, fmt.Errorf("failed to make request: %w", err)
+	// The response size is checked here too, so custom transports are covered as well
+	if maxSize := fe.maxResponseBodySize(); int64(len(response.body)) > maxSize {
+		response.body = response.body[:maxSize]
+		// An oversized SOAP Fault (e.g. with a large detail) still reports its code and string
+		if fault := truncatedSOAPFault(response.body, resp.StatusCode); fault != nil {
+			fErr := newSOAPFaultFiskalError(fault)
+			fErr.Err = fmt.Errorf("%w: more than %d bytes: %w", ErrResponseTooLarge, maxSize, fault)
+			fErr.Message = fErr.Err.Error()
+			return response, fErr
+		}
+		fErr := newFiskalError(CategoryResponse, fmt.Errorf("%w: more than %d bytes", ErrResponseTooLarge, maxSize))
+		fErr.StatusCode = resp.StatusCode
+		return response, fErr
 	}
-	defer resp.Body.Close()
 
-	// Read the response body
-	body, err := io.ReadAll(resp.Body)
+	// Parse the SOAP response, the content of the Body is sliced from the body without copying it
+	response.content, err = soapBodyContent(response.body)
 	if err != nil {
-		return nil, resp.StatusCode, fmt.Errorf("failed to read response: %w", err)
+		fErr := newFiskalError(CategoryResponse, fmt.Errorf("failed to unmarshal SOAP response: %w", err))
+		fErr.StatusCode = resp.StatusCode
+		response.content = response.body
+		return response, fErr
 	}
 
-	if sign {
-		// Verify the signature
-		_, err := fe.verifyXML(body)
-		if err != nil {
-			return body, resp.StatusCode, fmt.Errorf("failed to verify CIS signature: %w", err)
-		}
+	// CIS or a proxy in front of it can answer with a SOAP Fault instead of a response message
+	if fault := parseSOAPFault(response.content, resp.StatusCode); fault != nil {
+		return response, newSOAPFaultFiskalError(fault)
 	}
 
-	// Parse the SOAP response
-	var soapResp iSOAPEnvelopeNoNamespace
-	err = xml.Unmarshal(body, &soapResp)
-	if err != nil {
-		return body, resp.StatusCode, fmt.Errorf("failed to unmarshal SOAP response: %w", err)
+	// Verify the signature, CIS signs the response messages but not the SOAP faults
+	if sign {
+		if _, err := fe.verifyXML(response.body); err != nil && fe.unverifiedResponses {
+			fe.log(failureLevel, "accepting the CIS response without a valid signature", errorAttrs(err)...)
+			response.warnings = append(response.warnings, "the CIS response was accepted without a valid signature: "+err.Error())
+		} else if err != nil {
+			fErr := newFiskalError(CategoryOutcomeUnknown, fmt.Errorf("failed to verify CIS signature: %w", err))
+			fErr.StatusCode = resp.StatusCode
+			return response, fErr
+		}
 	}
 
 	// Return the inner content of the SOAP Body (the actual response)
-	if resp.StatusCode == http.StatusOK {
-		return soapResp.Body.Content, resp.StatusCode, nil
-	} else {
-		return soapResp.Body.Content, resp.StatusCode, fmt.Errorf("CIS returned an error: %v", resp.Status)
+	if resp.StatusCode != http.StatusOK {
+		fErr := newFiskalError(classifyStatus(resp.StatusCode), fmt.Errorf("CIS returned an error: %d %s", resp.StatusCode, http.StatusText(resp.StatusCode)))
+		fErr.StatusCode = resp.StatusCode
+		return response, fErr
 	}
+	return response, nil
 }
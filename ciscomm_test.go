@@ -0,0 +1,262 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"crypto/tls"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestEntity creates a fresh entity with the test certificate, so tests can change settings freely
+func newTestEntity(t *testing.T) *FiskalEntity {
+	t.Helper()
+	fe, err := NewFiskalEntity(testOIB, true, "TEST3", true, true, true, certPath, certPassword)
+	if err != nil {
+		t.Fatalf("Failed to create FiskalEntity: %v", err)
+	}
+	return fe
+}
+
+type countingTransport struct {
+	base  http.RoundTripper
+	calls int
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.calls++
+	return c.base.RoundTrip(req)
+}
+
+func TestCustomHTTPClientEnforcesCISTLS(t *testing.T) {
+	fe := newTestEntity(t)
+
+	proxyURL, _ := url.Parse("http://proxy.example.com:3128")
+	err := fe.SetHTTPClient(&http.Client{
+		Timeout: 3 * time.Second,
+		Transport: &http.Transport{
+			Proxy: http.ProxyURL(proxyURL),
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+				MinVersion:         tls.VersionTLS10,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to set HTTP client: %v", err)
+	}
+
+	client := fe.getHTTPClient()
+	if client.Timeout != 3*time.Second {
+		t.Errorf("Expected the client timeout to be kept, got %v", client.Timeout)
+	}
+
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("Expected *http.Transport, got %T", client.Transport)
+	}
+	if transport.Proxy == nil {
+		t.Errorf("Expected the proxy setting to be kept")
+	}
+	if transport.TLSClientConfig.InsecureSkipVerify {
+		t.Errorf("Expected InsecureSkipVerify to be disabled")
+	}
+	if transport.TLSClientConfig.MinVersion != tls.VersionTLS13 {
+		t.Errorf("Expected TLS 1.3 to be enforced")
+	}
+	if transport.TLSClientConfig.RootCAs != fe.cisCertificate().SSLverifyPoll {
+		t.Errorf("Expected the CIS CA pool to be enforced")
+	}
+}
+
+func TestCustomHTTPClientRejectsRoundTripper(t *testing.T) {
+	fe := newTestEntity(t)
+
+	err := fe.SetHTTPClient(&http.Client{Transport: &countingTransport{base: http.DefaultTransport}})
+	if err == nil {
+		t.Fatalf("Expected error for a custom RoundTripper")
+	}
+}
+
+func TestTransportWrapper(t *testing.T) {
+	fe := newTestEntity(t)
+
+	var wrapped *countingTransport
+	fe.SetTransportWrapper(func(base http.RoundTripper) http.RoundTripper {
+		if _, ok := base.(*http.Transport); !ok {
+			t.Errorf("Expected the library transport to be wrapped, got %T", base)
+		}
+		wrapped = &countingTransport{base: base}
+		return wrapped
+	})
+
+	client := fe.getHTTPClient()
+	if client.Transport != wrapped {
+		t.Errorf("Expected the wrapped transport to be used")
+	}
+}
+
+func TestHTTPClientIsReused(t *testing.T) {
+	fe := newTestEntity(t)
+
+	first := fe.getHTTPClient()
+	if fe.getHTTPClient() != first {
+		t.Fatalf("Expected the same HTTP client to be reused")
+	}
+
+	// Changing the settings must drop the cached client
+	fe.SetTransportWrapper(func(base http.RoundTripper) http.RoundTripper {
+		return &countingTransport{base: base}
+	})
+	if fe.getHTTPClient() == first {
+		t.Fatalf("Expected a new HTTP client after changing the transport wrapper")
+	}
+}
+
+// echoHandler is a minimal CIS echo service for tests
+func echoHandler(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	var env iSOAPEnvelopeNoNamespace
+	if err := xml.Unmarshal(body, &env); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var echo struct {
+		Text string `xml:",chardata"`
+	}
+	xml.Unmarshal(env.Body.Content, &echo)
+	w.Header().Set("Content-Type", "text/xml")
+	fmt.Fprintf(w, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><tns:EchoResponse xmlns:tns="http://www.apis-it.hr/fin/2012/types/f73">%s</tns:EchoResponse></soap:Body></soap:Envelope>`, echo.Text)
+}
+
+// newTestServerEntity starts a TLS test server with the handler and returns a new entity that trusts and uses it
+func newTestServerEntity(t *testing.T, handler http.HandlerFunc) *FiskalEntity {
+	t.Helper()
+	server := httptest.NewTLSServer(handler)
+	t.Cleanup(server.Close)
+
+	fe := newTestEntity(t)
+	fe.url = server.URL
+	if err := fe.AddTrustedRoot(server.Certificate()); err != nil {
+		t.Fatalf("Failed to add trusted root: %v", err)
+	}
+	return fe
+}
+
+func TestAddTrustedRoot(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(echoHandler))
+	defer server.Close()
+
+	fe := newTestEntity(t)
+	fe.url = server.URL
+
+	// The test server certificate is not signed by the CIS CA, so the request must fail
+	if _, err := fe.EchoRequest("test"); err == nil {
+		t.Fatalf("Expected TLS verification error with an untrusted server certificate")
+	}
+
+	if err := fe.AddTrustedRoot(server.Certificate()); err != nil {
+		t.Fatalf("Failed to add trusted root: %v", err)
+	}
+
+	resp, err := fe.EchoRequest("test")
+	if err != nil {
+		t.Fatalf("Expected echo to work with the added root, got %v", err)
+	}
+	if resp != "test" {
+		t.Errorf("Expected echo response test, got %q", resp)
+	}
+
+	// The shared embedded pool of other entities must not be affected
+	if testEntity.ciscert.SSLverifyPoll == fe.ciscert.SSLverifyPoll {
+		t.Errorf("Expected the CA pool to be cloned")
+	}
+}
+
+func TestRequestHeaders(t *testing.T) {
+	var got http.Header
+	fe := newTestServerEntity(t, func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		echoHandler(w, r)
+	})
+
+	if _, err := fe.EchoRequest("test"); err != nil {
+		t.Fatalf("Echo failed: %v", err)
+	}
+	if got.Get("User-Agent") != defaultUserAgent {
+		t.Errorf("Expected default User-Agent, got %q", got.Get("User-Agent"))
+	}
+
+	fe.SetUserAgent("MyPOS/1.0")
+	fe.SetRequestHeader("X-Correlation-ID", "entity")
+	fe.SetRequestHeader("X-Tenant", "shop1")
+
+	_, err := fe.EchoRequestWithHeaders("test", http.Header{
+		"X-Correlation-Id": []string{"call"},
+		"Content-Type":     []string{"application/json"},
+	})
+	if err != nil {
+		t.Fatalf("Echo failed: %v", err)
+	}
+	if got.Get("User-Agent") != "MyPOS/1.0" {
+		t.Errorf("Expected custom User-Agent, got %q", got.Get("User-Agent"))
+	}
+	if got.Get("X-Correlation-ID") != "call" {
+		t.Errorf("Expected per call header to override the entity header, got %q", got.Get("X-Correlation-ID"))
+	}
+	if got.Get("X-Tenant") != "shop1" {
+		t.Errorf("Expected entity header, got %q", got.Get("X-Tenant"))
+	}
+	if got.Get("Content-Type") != "text/xml" {
+		t.Errorf("Expected Content-Type to be enforced, got %q", got.Get("Content-Type"))
+	}
+}
+
+func TestMaxResponseSize(t *testing.T) {
+	fe := newTestServerEntity(t, echoHandler)
+
+	fe.SetMaxResponseSize(100)
+	_, err := fe.EchoRequest(strings.Repeat("x", 200))
+	if !errors.Is(err, ErrResponseTooLarge) {
+		t.Fatalf("Expected ErrResponseTooLarge, got %v", err)
+	}
+
+	fe.SetMaxResponseSize(0)
+	if _, err := fe.EchoRequest(strings.Repeat("x", 200)); err != nil {
+		t.Fatalf("Expected the default limit to allow the response, got %v", err)
+	}
+}
+
+// testSOAPEnvelope is the envelope struct that was marshaled for every request before the envelope was prebuilt
+type testSOAPEnvelope struct {
+	XMLName xml.Name `xml:"soapenv:Envelope"`
+	XmlnsT  string   `xml:"xmlns:tns,attr"`
+	Xmlns   string   `xml:"xmlns:soapenv,attr"`
+	Body    struct {
+		Content []byte `xml:",innerxml"`
+	} `xml:"soapenv:Body"`
+}
+
+func TestSOAPEnvelope(t *testing.T) {
+	payload := []byte(`<tns:EchoRequest xmlns:tns="http://www.apis-it.hr/fin/2012/types/f73">test</tns:EchoRequest>`)
+
+	expected := testSOAPEnvelope{XmlnsT: DefaultNamespace, Xmlns: "http://schemas.xmlsoap.org/soap/envelope/"}
+	expected.Body.Content = payload
+	marshaled, err := xml.Marshal(expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if envelope := soapEnvelope(payload); string(envelope) != string(marshaled) {
+		t.Errorf("Expected %s, got %s", marshaled, envelope)
+	}
+}
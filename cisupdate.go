@@ -0,0 +1,267 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCISCertSize limits the downloaded CIS certificate chain and its signature
+const maxCISCertSize = 1 << 20
+
+// CISCertUpdaterConfig configures the CISCertUpdater. The downloaded chain is trusted only when it matches
+// the SHA256 hash or its detached signature verifies with the PublicKey, one of them is required.
+type CISCertUpdaterConfig struct {
+	// URL is the HTTPS location of the PEM chain (the CIS certificate first, the root CA last), one for
+	// the demo or the production environment
+	URL string
+
+	// PublicKey verifies the detached signature of the chain, an ed25519.PublicKey (over the chain),
+	// *rsa.PublicKey (PKCS #1 v1.5 over the SHA-256 digest) or *ecdsa.PublicKey (ASN.1 over the SHA-256 digest)
+	PublicKey crypto.PublicKey
+
+	// SignatureURL is the location of the raw signature, URL + ".sig" by default
+	SignatureURL string
+
+	// SHA256 is the expected hex SHA-256 hash of the chain, e.g. published with the rotation announcement
+	SHA256 string
+
+	// CachePath stores the last verified chain, so it's used after a restart before the next download. Optional.
+	CachePath string
+
+	// HTTPClient downloads the chain, http.DefaultClient by default
+	HTTPClient *http.Client
+}
+
+// CISCertUpdater downloads the CIS certificate chain from a configurable location, verifies it, caches it and
+// hot-swaps the CIS certificate of the attached entities, keeping long-lived deployments working across
+// the rotations of the Tax Administration certificates. Call Update periodically or use Run.
+type CISCertUpdater struct {
+	cfg    CISCertUpdaterConfig
+	client *http.Client
+
+	mu       sync.Mutex
+	current  []byte
+	leaf     *x509.Certificate
+	entities []*FiskalEntity
+}
+
+// NewCISCertUpdater creates the updater, a valid chain from the cache is loaded
+func NewCISCertUpdater(cfg CISCertUpdaterConfig) (*CISCertUpdater, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, errors.New("the CIS certificate URL must be a https URL")
+	}
+	if cfg.PublicKey == nil && cfg.SHA256 == "" {
+		return nil, errors.New("the public key or the SHA256 hash is required to verify the CIS certificate")
+	}
+	if cfg.PublicKey != nil && cfg.SignatureURL == "" {
+		cfg.SignatureURL = cfg.URL + ".sig"
+	}
+	cfg.SHA256 = strings.ToLower(strings.ReplaceAll(cfg.SHA256, ":", ""))
+
+	updater := &CISCertUpdater{cfg: cfg, client: cfg.HTTPClient}
+	if updater.client == nil {
+		updater.client = http.DefaultClient
+	}
+
+	if cfg.CachePath != "" {
+		if data, err := os.ReadFile(cfg.CachePath); err == nil {
+			if leaf, err := parseCISChainPEM(data); err == nil {
+				updater.current, updater.leaf = data, leaf
+			}
+		}
+	}
+	return updater, nil
+}
+
+// Attach hot-swaps the CIS certificate of the entity on updates, the current chain is applied immediately
+func (u *CISCertUpdater) Attach(fe *FiskalEntity) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.current != nil {
+		if err := fe.SetCISCertificatePEM(u.current); err != nil {
+			return err
+		}
+	}
+	u.entities = append(u.entities, fe)
+	return nil
+}
+
+// Certificate returns the CIS certificate of the last verified chain, nil if there is none yet
+func (u *CISCertUpdater) Certificate() *x509.Certificate {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.leaf
+}
+
+// Update downloads and verifies the chain and applies it to the attached entities if it changed.
+// It returns true if the CIS certificate was replaced.
+func (u *CISCertUpdater) Update(ctx context.Context) (bool, error) {
+	data, err := u.download(ctx, u.cfg.URL)
+	if err != nil {
+		return false, fmt.Errorf("failed to download the CIS certificate: %w", err)
+	}
+	if err := u.verify(ctx, data); err != nil {
+		return false, err
+	}
+	leaf, err := parseCISChainPEM(data)
+	if err != nil {
+		return false, err
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if bytes.Equal(data, u.current) {
+		return false, nil
+	}
+	// Never go back to an older certificate, e.g. from a stale mirror
+	if u.leaf != nil && leaf.NotBefore.Before(u.leaf.NotBefore) {
+		return false, fmt.Errorf("the downloaded CIS certificate is older than the current one")
+	}
+
+	var errs []error
+	for _, fe := range u.entities {
+		if err := fe.SetCISCertificatePEM(data); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return false, err
+	}
+	u.current, u.leaf = data, leaf
+
+	if u.cfg.CachePath != "" {
+		if err := writeFileAtomic(u.cfg.CachePath, data); err != nil {
+			return true, fmt.Errorf("failed to cache the CIS certificate: %w", err)
+		}
+	}
+	return true, nil
+}
+
+// Run calls Update immediately and then every interval until the context is done.
+// Errors are passed to onError (if not nil) and the current certificate is kept.
+func (u *CISCertUpdater) Run(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := u.Update(ctx); err != nil && onError != nil {
+			onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// verify checks the hash and the detached signature of the chain
+func (u *CISCertUpdater) verify(ctx context.Context, data []byte) error {
+	if u.cfg.SHA256 != "" {
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != u.cfg.SHA256 {
+			return errors.New("the CIS certificate does not match the SHA256 hash")
+		}
+	}
+	if u.cfg.PublicKey != nil {
+		signature, err := u.download(ctx, u.cfg.SignatureURL)
+		if err != nil {
+			return fmt.Errorf("failed to download the CIS certificate signature: %w", err)
+		}
+		if err := verifyDetachedSignature(u.cfg.PublicKey, data, signature); err != nil {
+			return fmt.Errorf("invalid CIS certificate signature: %w", err)
+		}
+	}
+	return nil
+}
+
+func (u *CISCertUpdater) download(ctx context.Context, location string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxCISCertSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxCISCertSize {
+		return nil, fmt.Errorf("response larger than %d bytes", maxCISCertSize)
+	}
+	return body, nil
+}
+
+// verifyDetachedSignature verifies the signature of the data with the public key
+func verifyDetachedSignature(publicKey crypto.PublicKey, data []byte, signature []byte) error {
+	digest := sha256.Sum256(data)
+	switch key := publicKey.(type) {
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, data, signature) {
+			return errors.New("ed25519 verification failed")
+		}
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature)
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, digest[:], signature) {
+			return errors.New("ECDSA verification failed")
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+	return nil
+}
+
+// parseCISChainPEM parses and verifies the CIS certificate chain, returning the CIS certificate
+func parseCISChainPEM(data []byte) (*x509.Certificate, error) {
+	certs, err := parsePEMCertificates(data)
+	if err != nil {
+		return nil, err
+	}
+	leaf, _, err := verifyCISChain(certs, time.Now())
+	return leaf, err
+}
+
+// writeFileAtomic writes the file through a temporary file, so a crash never leaves a partial file
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
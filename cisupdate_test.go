@@ -0,0 +1,131 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCISCertUpdater(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	chain, cert, _ := newCISChainPEM(t, time.Now().Add(365*24*time.Hour))
+	signature := ed25519.Sign(privateKey, chain)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/cis.pem":
+			w.Write(chain)
+		case "/cis.pem.sig":
+			w.Write(signature)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	if _, err := NewCISCertUpdater(CISCertUpdaterConfig{URL: "http://example.com/cis.pem", PublicKey: publicKey}); err == nil {
+		t.Errorf("Expected an error for a plain HTTP URL")
+	}
+	if _, err := NewCISCertUpdater(CISCertUpdaterConfig{URL: server.URL + "/cis.pem"}); err == nil {
+		t.Errorf("Expected an error without the public key and the hash")
+	}
+
+	cachePath := filepath.Join(t.TempDir(), "cis.pem")
+	cfg := CISCertUpdaterConfig{
+		URL:        server.URL + "/cis.pem",
+		PublicKey:  publicKey,
+		CachePath:  cachePath,
+		HTTPClient: server.Client(),
+	}
+	updater, err := NewCISCertUpdater(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create the updater: %v", err)
+	}
+	fe := newTestEntity(t)
+	if err := updater.Attach(fe); err != nil {
+		t.Fatalf("Failed to attach the entity: %v", err)
+	}
+
+	updated, err := updater.Update(context.Background())
+	if err != nil || !updated {
+		t.Fatalf("Expected the CIS certificate to be updated, got %v, %v", updated, err)
+	}
+	if !fe.cisCertificate().PublicCert.Equal(cert) || !updater.Certificate().Equal(cert) {
+		t.Errorf("Expected the downloaded CIS certificate to be used")
+	}
+	if cached, err := os.ReadFile(cachePath); err != nil || string(cached) != string(chain) {
+		t.Errorf("Expected the chain to be cached: %v", err)
+	}
+	if updated, err := updater.Update(context.Background()); err != nil || updated {
+		t.Errorf("Expected no update for the same chain, got %v, %v", updated, err)
+	}
+
+	// A chain with an invalid signature is rejected and the current certificate is kept
+	mu.Lock()
+	rotated, rotatedCert, _ := newCISChainPEM(t, time.Now().Add(2*365*24*time.Hour))
+	chain = rotated
+	mu.Unlock()
+	if _, err := updater.Update(context.Background()); err == nil {
+		t.Errorf("Expected an error for an invalid signature")
+	}
+	if !fe.cisCertificate().PublicCert.Equal(cert) {
+		t.Errorf("Expected the CIS certificate to be kept")
+	}
+
+	mu.Lock()
+	signature = ed25519.Sign(privateKey, rotated)
+	mu.Unlock()
+	if updated, err := updater.Update(context.Background()); err != nil || !updated {
+		t.Fatalf("Expected the rotated CIS certificate, got %v, %v", updated, err)
+	}
+	if !fe.cisCertificate().PublicCert.Equal(rotatedCert) {
+		t.Errorf("Expected the rotated CIS certificate to be used")
+	}
+
+	// After a restart the cached chain is used before the first download
+	restarted, err := NewCISCertUpdater(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !restarted.Certificate().Equal(rotatedCert) {
+		t.Errorf("Expected the cached CIS certificate")
+	}
+	other := newTestEntity(t)
+	if err := restarted.Attach(other); err != nil || !other.cisCertificate().PublicCert.Equal(rotatedCert) {
+		t.Errorf("Expected the cached CIS certificate to be applied on attach: %v", err)
+	}
+
+	// A pinned hash works without a signature
+	sum := sha256.Sum256(rotated)
+	pinned, err := NewCISCertUpdater(CISCertUpdaterConfig{URL: cfg.URL, SHA256: hex.EncodeToString(sum[:]), HTTPClient: server.Client()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated, err := pinned.Update(context.Background()); err != nil || !updated {
+		t.Errorf("Expected the pinned chain to be accepted, got %v, %v", updated, err)
+	}
+	pinned.cfg.SHA256 = hex.EncodeToString(make([]byte, sha256.Size))
+	pinned.current = nil
+	if _, err := pinned.Update(context.Background()); err == nil {
+		t.Errorf("Expected an error for a hash mismatch")
+	}
+}
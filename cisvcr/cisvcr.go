@@ -0,0 +1,300 @@
+// Package cisvcr records exchanges with CIS to fixture files and replays them, so tests that talk
+// to CIS can run without the network.
+//
+// The Transport is plugged in with FiskalEntity.SetTransportWrapper:
+//
+//	vcr, err := cisvcr.New("testdata/cis_fixtures.json", cisvcr.ModeReplay)
+//	if err != nil { ... }
+//	entity.SetTransportWrapper(vcr.Wrap)
+//
+// In ModeRecord the requests go to CIS (use the demo environment) and every exchange is appended
+// to the fixture file, with the identifying data (OIBs, certificate, signature values) redacted
+// from the requests and the OIBs from the responses. In ModeReplay nothing is sent, the recorded responses are returned in the recorded
+// order per operation, with the IdPoruke replaced by the one from the current request and the DatumVrijeme
+// by the current time.
+//
+// The recorded CIS signature doesn't match the changed response, so a client verifying the response signature
+// rejects it. Sign the replayed responses with a test key (see SetResponseSigner) and trust its certificate in
+// the client instead of the CIS one, or turn the verification off explicitly in replay mode.
+//
+// The package doesn't depend on fiskalhrgo, so it can be used from its internal tests too.
+package cisvcr
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+	_ "time/tzdata"
+)
+
+// Mode of the Transport
+type Mode string
+
+const (
+	// ModeReplay returns the recorded responses without sending anything
+	ModeReplay Mode = "replay"
+
+	// ModeRecord sends the requests and records the exchanges to the fixture file
+	ModeRecord Mode = "record"
+)
+
+// Interaction is a single recorded exchange
+type Interaction struct {
+	// Operation is the name of the request message, e.g. "RacunZahtjev"
+	Operation string `json:"operation"`
+
+	// Request is the sanitized request body, for reference only
+	Request string `json:"request"`
+
+	// StatusCode, ContentType and Response are the recorded response, sanitized with SanitizeResponse
+	StatusCode  int    `json:"status_code"`
+	ContentType string `json:"content_type"`
+	Response    string `json:"response"`
+}
+
+// Cassette is the content of a fixture file
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Transport is an http.RoundTripper recording or replaying the exchanges with CIS
+type Transport struct {
+	mode Mode
+	path string
+	next http.RoundTripper
+
+	mu       sync.Mutex
+	cassette *Cassette
+	played   map[string]int
+	sign     func(response []byte) ([]byte, error)
+}
+
+// New creates a Transport for the fixture file. In ModeReplay the file must exist,
+// in ModeRecord it is created (or overwritten) with the first recorded exchange.
+func New(path string, mode Mode) (*Transport, error) {
+	t := &Transport{
+		mode:     mode,
+		path:     path,
+		cassette: &Cassette{},
+		played:   make(map[string]int),
+	}
+
+	switch mode {
+	case ModeRecord:
+	case ModeReplay:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fixture file: %w", err)
+		}
+		if err := json.Unmarshal(data, t.cassette); err != nil {
+			return nil, fmt.Errorf("failed to parse fixture file: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown mode: %s", mode)
+	}
+
+	return t, nil
+}
+
+// SetResponseSigner sets the function signing the replayed responses again. It gets the changed response
+// (the whole SOAP envelope) without the recorded signature, only the responses recorded with a signature are signed.
+func (t *Transport) SetResponseSigner(sign func(response []byte) ([]byte, error)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sign = sign
+}
+
+// Wrap sets the transport used for recording and returns the Transport, use it with SetTransportWrapper
+func (t *Transport) Wrap(next http.RoundTripper) http.RoundTripper {
+	t.next = next
+	return t
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request: %w", err)
+		}
+	}
+	operation := operationName(body)
+
+	if t.mode == ModeReplay {
+		return t.replay(req, operation, body)
+	}
+	return t.record(req, operation, body)
+}
+
+// record sends the request and saves the exchange
+func (t *Transport) record(req *http.Request, operation string, body []byte) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	recorded := SanitizeResponse(respBody)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cassette.Interactions = append(t.cassette.Interactions, &Interaction{
+		Operation:   operation,
+		Request:     string(Sanitize(body)),
+		StatusCode:  resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Response:    string(recorded),
+	})
+	if err := t.saveLocked(); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// saveLocked writes the cassette to the fixture file
+func (t *Transport) saveLocked() error {
+	data, err := json.MarshalIndent(t.cassette, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode fixtures: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(t.path), 0755); err != nil {
+		return fmt.Errorf("failed to create fixture directory: %w", err)
+	}
+	if err := os.WriteFile(t.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write fixture file: %w", err)
+	}
+	return nil
+}
+
+// replay returns the next recorded response for the operation. When all recorded responses
+// of the operation were used, the last one is returned again.
+func (t *Transport) replay(req *http.Request, operation string, body []byte) (*http.Response, error) {
+	t.mu.Lock()
+	var matching []*Interaction
+	for _, interaction := range t.cassette.Interactions {
+		if interaction.Operation == operation {
+			matching = append(matching, interaction)
+		}
+	}
+	if len(matching) == 0 {
+		t.mu.Unlock()
+		return nil, fmt.Errorf("no recorded interaction for operation %s", operation)
+	}
+	index := t.played[operation]
+	if index >= len(matching) {
+		index = len(matching) - 1
+	}
+	t.played[operation]++
+	interaction := matching[index]
+	sign := t.sign
+	t.mu.Unlock()
+
+	respBody := []byte(interaction.Response)
+	if id := idPoruke.FindSubmatch(body); id != nil {
+		respBody = idPoruke.ReplaceAll(respBody, []byte("${1}"+string(id[2])+"${3}"))
+	}
+	respBody = datumVrijeme.ReplaceAll(respBody, []byte("${1}"+time.Now().In(cisLocation).Format("02.01.2006T15:04:05")+"${2}"))
+	if sign != nil && signature.Match(respBody) {
+		signed, err := sign(signature.ReplaceAll(respBody, nil))
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign the replayed response: %w", err)
+		}
+		respBody = signed
+	}
+
+	header := make(http.Header)
+	if interaction.ContentType != "" {
+		header.Set("Content-Type", interaction.ContentType)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", interaction.StatusCode, http.StatusText(interaction.StatusCode)),
+		StatusCode:    interaction.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(respBody)),
+		ContentLength: int64(len(respBody)),
+		Request:       req,
+	}, nil
+}
+
+var idPoruke = regexp.MustCompile(`(<(?:[\w-]+:)?IdPoruke>)([^<]*)(</(?:[\w-]+:)?IdPoruke>)`)
+
+var datumVrijeme = regexp.MustCompile(`(<(?:[\w-]+:)?DatumVrijeme>)[^<]*(</(?:[\w-]+:)?DatumVrijeme>)`)
+
+// signature matches the XML signature of the response message
+var signature = regexp.MustCompile(`(?s)<(?:[\w-]+:)?Signature[\s>].*</(?:[\w-]+:)?Signature>`)
+
+// cisLocation is the time zone of the CIS clock, the time zone database is embedded
+var cisLocation, _ = time.LoadLocation("Europe/Zagreb")
+
+// sensitive matches the elements removed from the recorded requests
+var sensitive = regexp.MustCompile(`(<(?:[\w-]+:)?(Oib|OibOper|OibPrimateljaNapojnice|X509Certificate|X509IssuerName|X509SerialNumber|SignatureValue|DigestValue)>)[^<]*(</(?:[\w-]+:)?(?:Oib|OibOper|OibPrimateljaNapojnice|X509Certificate|X509IssuerName|X509SerialNumber|SignatureValue|DigestValue)>)`)
+
+// oibElements matches the elements with an OIB
+var oibElements = regexp.MustCompile(`(<(?:[\w-]+:)?(Oib|OibOper|OibPrimateljaNapojnice)>)[^<]*(</(?:[\w-]+:)?(?:Oib|OibOper|OibPrimateljaNapojnice)>)`)
+
+// oibText matches an OIB anywhere in the text, e.g. in the error messages of CIS
+var oibText = regexp.MustCompile(`\b\d{11}\b`)
+
+// Sanitize redacts the OIBs, the certificate and the signature values from the XML
+func Sanitize(data []byte) []byte {
+	return oibText.ReplaceAll(sensitive.ReplaceAll(data, []byte("${1}REDACTED${3}")), []byte("REDACTED"))
+}
+
+// SanitizeResponse redacts the OIBs from the XML of a response. The signature and the certificate of CIS are kept,
+// they identify CIS and not the taxpayer, and they are needed to verify the recorded response.
+func SanitizeResponse(data []byte) []byte {
+	return oibText.ReplaceAll(oibElements.ReplaceAll(data, []byte("${1}REDACTED${3}")), []byte("REDACTED"))
+}
+
+// operationName returns the name of the first element in the SOAP Body
+func operationName(envelope []byte) string {
+	decoder := xml.NewDecoder(bytes.NewReader(envelope))
+	inBody := false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return "unknown"
+			}
+			return "invalid"
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if inBody {
+			return start.Name.Local
+		}
+		inBody = start.Name.Local == "Body"
+	}
+}
@@ -0,0 +1,136 @@
+package cisvcr
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testRequest = `<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/"><soapenv:Body><tns:RacunZahtjev xmlns:tns="http://www.apis-it.hr/fin/2012/types/f73" Id="%s"><tns:Zaglavlje><tns:IdPoruke>%s</tns:IdPoruke></tns:Zaglavlje><tns:Racun><tns:Oib>65049901548</tns:Oib></tns:Racun><Signature><SignatureValue>c2lnbmF0dXJl</SignatureValue></Signature></tns:RacunZahtjev></soapenv:Body></soapenv:Envelope>`
+
+func post(t *testing.T, client *http.Client, url string, idPoruke string) string {
+	t.Helper()
+	body := strings.ReplaceAll(testRequest, "%s", idPoruke)
+	resp, err := client.Post(url, "text/xml", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return string(data)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		io.WriteString(w, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><tns:RacunOdgovor xmlns:tns="http://www.apis-it.hr/fin/2012/types/f73"><tns:Zaglavlje><tns:IdPoruke>recorded-id</tns:IdPoruke></tns:Zaglavlje><tns:Jir>9d6f5bb6-da48-4fcd-a803-4586a025e0e4</tns:Jir></tns:RacunOdgovor></soap:Body></soap:Envelope>`)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "fixtures", "cis.json")
+
+	recorder, err := New(path, ModeRecord)
+	if err != nil {
+		t.Fatalf("Failed to create recorder: %v", err)
+	}
+	post(t, &http.Client{Transport: recorder.Wrap(http.DefaultTransport)}, server.URL, "recorded-id")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Fixture file not written: %v", err)
+	}
+	if strings.Contains(string(data), "65049901548") || strings.Contains(string(data), "c2lnbmF0dXJl") {
+		t.Errorf("Expected the OIB and the signature to be redacted, got %s", data)
+	}
+	server.Close()
+
+	replayer, err := New(path, ModeReplay)
+	if err != nil {
+		t.Fatalf("Failed to create replayer: %v", err)
+	}
+	client := &http.Client{Transport: replayer.Wrap(nil)}
+	for _, id := range []string{"first-id", "second-id"} {
+		resp := post(t, client, "https://cis.invalid/FiskalizacijaService", id)
+		if !strings.Contains(resp, "<tns:IdPoruke>"+id+"</tns:IdPoruke>") || !strings.Contains(resp, "9d6f5bb6-da48-4fcd-a803-4586a025e0e4") {
+			t.Errorf("Expected the replayed response with IdPoruke %s, got %s", id, resp)
+		}
+	}
+
+	if _, err := New(filepath.Join(t.TempDir(), "missing.json"), ModeReplay); err == nil {
+		t.Errorf("Expected error for a missing fixture file")
+	}
+}
+
+func TestOperationName(t *testing.T) {
+	if op := operationName([]byte(`<s:Envelope xmlns:s="x"><s:Body><tns:EchoRequest xmlns:tns="y">hi</tns:EchoRequest></s:Body></s:Envelope>`)); op != "EchoRequest" {
+		t.Errorf("Expected EchoRequest, got %s", op)
+	}
+}
+
+func TestReplayResponseSigner(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cis.json")
+	cassette := `{"interactions": [{"operation": "RacunZahtjev", "status_code": 200, "content_type": "text/xml", "response": "<soap:Envelope xmlns:soap=\"http://schemas.xmlsoap.org/soap/envelope/\"><soap:Body><tns:RacunOdgovor xmlns:tns=\"http://www.apis-it.hr/fin/2012/types/f73\" Id=\"G0x1\"><tns:Zaglavlje><tns:IdPoruke>recorded-id</tns:IdPoruke><tns:DatumVrijeme>01.01.2020T10:00:00</tns:DatumVrijeme></tns:Zaglavlje><tns:Jir>9d6f5bb6-da48-4fcd-a803-4586a025e0e4</tns:Jir><Signature xmlns=\"http://www.w3.org/2000/09/xmldsig#\"><SignatureValue>recorded</SignatureValue></Signature></tns:RacunOdgovor></soap:Body></soap:Envelope>"}]}`
+	if err := os.WriteFile(path, []byte(cassette), 0600); err != nil {
+		t.Fatal(err)
+	}
+	replayer, err := New(path, ModeReplay)
+	if err != nil {
+		t.Fatalf("Failed to create replayer: %v", err)
+	}
+	var signed string
+	replayer.SetResponseSigner(func(response []byte) ([]byte, error) {
+		signed = string(response)
+		return []byte(strings.Replace(signed, "</tns:RacunOdgovor>", "<Signature>resigned</Signature></tns:RacunOdgovor>", 1)), nil
+	})
+
+	resp := post(t, &http.Client{Transport: replayer.Wrap(nil)}, "https://cis.invalid/FiskalizacijaService", "current-id")
+	if !strings.Contains(signed, "<tns:IdPoruke>current-id</tns:IdPoruke>") || strings.Contains(signed, "01.01.2020T10:00:00") || strings.Contains(signed, "Signature") {
+		t.Errorf("Expected the changed response without the recorded signature to be signed, got %s", signed)
+	}
+	if !strings.Contains(resp, "resigned") || strings.Contains(resp, "recorded") {
+		t.Errorf("Expected the signed response, got %s", resp)
+	}
+}
+
+func TestSanitizeResponse(t *testing.T) {
+	response := `<tns:RacunOdgovor><tns:Greske><tns:Greska><tns:SifraGreske>s005</tns:SifraGreske><tns:PorukaGreske>OIB 65049901548 ne odgovara</tns:PorukaGreske></tns:Greska></tns:Greske><tns:Oib>65049901548</tns:Oib><Signature><SignatureValue>c2lnbmF0dXJl</SignatureValue><X509SerialNumber>123456789012345</X509SerialNumber></Signature></tns:RacunOdgovor>`
+	sanitized := string(SanitizeResponse([]byte(response)))
+	if strings.Contains(sanitized, "65049901548") {
+		t.Errorf("Expected the OIBs to be redacted, got %s", sanitized)
+	}
+	if !strings.Contains(sanitized, "c2lnbmF0dXJl") || !strings.Contains(sanitized, "123456789012345") {
+		t.Errorf("Expected the CIS signature to be kept, got %s", sanitized)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		io.WriteString(w, response)
+	}))
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "cis.json")
+	recorder, err := New(path, ModeRecord)
+	if err != nil {
+		t.Fatalf("Failed to create recorder: %v", err)
+	}
+	post(t, &http.Client{Transport: recorder.Wrap(http.DefaultTransport)}, server.URL, "recorded-id")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cassette Cassette
+	if err := json.Unmarshal(data, &cassette); err != nil {
+		t.Fatal(err)
+	}
+	if len(cassette.Interactions) != 1 || strings.Contains(cassette.Interactions[0].Response, "65049901548") {
+		t.Errorf("Expected the OIBs to be redacted from the recorded response, got %s", data)
+	}
+}
@@ -0,0 +1,106 @@
+// Package client has the contract between the fiscalization client and the transport delivering its messages
+// to CIS: the Transport interface, the requests and responses it exchanges and the metadata of the HTTP responses,
+// without any dependency on the rest of the library, so alternative transports (a relay over a message queue,
+// a recorded or mocked CIS...) can be implemented without importing fiskalhrgo.
+//
+// The fiskalhrgo package keeps the same types under their old names (TransportRequest, TransportResponse,
+// Transport and ResponseMetadata), set a transport with FiskalEntity.SetTransport.
+package client
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io"
+	"net/http"
+)
+
+// Request is a request message ready to be delivered to CIS
+type Request struct {
+	// Operation is the name of the request message, e.g. "RacunZahtjev" or "EchoRequest"
+	Operation string
+
+	// Endpoint is the URL of the CIS service for the request, the entity endpoint or the one of the message type.
+	// Transports not based on HTTP can ignore it.
+	Endpoint string
+
+	// Envelope is the complete SOAP envelope, with the request message already signed if required
+	Envelope []byte
+
+	// Header holds the extra HTTP headers for this request (can be nil), transports not based on HTTP can ignore them
+	Header http.Header
+}
+
+// Response is the response to a Request
+type Response struct {
+	// StatusCode is the HTTP status code of the response, transports not based on HTTP should use 200
+	// for delivered responses (CIS errors are in the response message itself)
+	StatusCode int
+
+	// Body is the raw response body, the SOAP envelope with the response message
+	Body []byte
+
+	// Metadata describes the HTTP response and the TLS connection, nil for the transports not based on HTTP
+	Metadata *ResponseMetadata
+}
+
+// Transport delivers the SOAP envelopes to CIS and returns the responses.
+// Implementations must be safe for concurrent use.
+type Transport interface {
+	// Send delivers the request and returns the response. An error means no (complete) response was received,
+	// a response with an error status code should be returned as a Response.
+	Send(req *Request) (*Response, error)
+}
+
+// ResponseMetadata describes the HTTP response of CIS and the TLS connection it came over. The support of APIS-IT
+// (the CIS operator) asks for these details when a connectivity issue is escalated.
+type ResponseMetadata struct {
+	// Header holds the response headers, without the cookies
+	Header http.Header `json:"header,omitempty"`
+
+	// Proto is the HTTP protocol of the response, e.g. "HTTP/1.1"
+	Proto string `json:"proto,omitempty"`
+
+	// TLSVersion and CipherSuite of the connection, e.g. "TLS 1.2" and "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+	// empty without TLS
+	TLSVersion  string `json:"tls_version,omitempty"`
+	CipherSuite string `json:"cipher_suite,omitempty"`
+
+	// ServerCertSerial and ServerCertSubject identify the TLS certificate presented by the server, the serial
+	// in decimal like the fiscal certificate serials
+	ServerCertSerial  string `json:"server_cert_serial,omitempty"`
+	ServerCertSubject string `json:"server_cert_subject,omitempty"`
+}
+
+// NewResponseMetadata returns the metadata of the HTTP response
+func NewResponseMetadata(resp *http.Response) *ResponseMetadata {
+	meta := &ResponseMetadata{Header: resp.Header.Clone(), Proto: resp.Proto}
+	if meta.Header != nil {
+		meta.Header.Del("Set-Cookie")
+	}
+	if state := resp.TLS; state != nil {
+		meta.TLSVersion = tls.VersionName(state.Version)
+		meta.CipherSuite = tls.CipherSuiteName(state.CipherSuite)
+		if len(state.PeerCertificates) > 0 {
+			leaf := state.PeerCertificates[0]
+			meta.ServerCertSerial = leaf.SerialNumber.String()
+			meta.ServerCertSubject = leaf.Subject.String()
+		}
+	}
+	return meta
+}
+
+// ReadLimited reads the response body up to the limit plus one byte, so an oversized body is detected.
+// The buffer is allocated once when the size is known (contentLength >= 0), instead of growing while reading.
+func ReadLimited(r io.Reader, contentLength int64, limit int64) ([]byte, error) {
+	r = io.LimitReader(r, limit+1)
+	if contentLength < 0 || contentLength > limit {
+		return io.ReadAll(r)
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, contentLength+bytes.MinRead))
+	_, err := buf.ReadFrom(r)
+	return buf.Bytes(), err
+}
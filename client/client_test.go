@@ -0,0 +1,40 @@
+package client
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestReadLimited(t *testing.T) {
+	for _, contentLength := range []int64{-1, 5, 100} {
+		body, err := ReadLimited(strings.NewReader("hello"), contentLength, 10)
+		if err != nil || string(body) != "hello" {
+			t.Errorf("Content-Length %d: expected the whole body, got %q, %v", contentLength, body, err)
+		}
+	}
+	// One byte over the limit is read, so the caller can tell the body is too large
+	if body, err := ReadLimited(strings.NewReader("hello world"), -1, 5); err != nil || string(body) != "hello " {
+		t.Errorf("Expected the limit plus one byte, got %q, %v", body, err)
+	}
+}
+
+func TestNewResponseMetadata(t *testing.T) {
+	header := http.Header{}
+	header.Set("X-Request-Id", "cis-123")
+	header.Set("Set-Cookie", "session=secret")
+	meta := NewResponseMetadata(&http.Response{Proto: "HTTP/1.1", Header: header})
+	if meta.Header.Get("X-Request-Id") != "cis-123" || meta.Header.Get("Set-Cookie") != "" || meta.Proto != "HTTP/1.1" {
+		t.Errorf("Unexpected metadata %+v", meta)
+	}
+	if header.Get("Set-Cookie") == "" {
+		t.Error("Expected the response headers unchanged")
+	}
+	if meta.TLSVersion != "" || meta.ServerCertSerial != "" {
+		t.Errorf("Expected no TLS details without TLS, got %+v", meta)
+	}
+}
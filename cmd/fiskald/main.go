@@ -0,0 +1,186 @@
+// Command fiskald is a small HTTP/JSON daemon for fiscalization, so POS systems written in other languages
+// (PHP, Java...) can fiscalize invoices through localhost HTTP instead of linking Go code.
+//
+// Usage:
+//
+//	FISKALD_API_KEY=secret FISKALD_CERT_PASSWORD=pass fiskald -oib 12345678901 -location POS1 -cert fiskal.p12 -demo
+//
+// or with the entity from a configuration file (see package fiskalconfig):
+//
+//	FISKALD_API_KEY=secret fiskald -config fiskal.yaml -entity shop1
+//
+// Endpoints (all require the API key in the "Authorization: Bearer <key>" or the "X-API-Key" header):
+//
+//	POST /echo            {"text": "..."}                                  echo request to CIS
+//	POST /zki             {"issued_at", "number", "device", "total"}       compute the ZKI
+//	POST /invoice         invoice JSON                                     fiscalize, queue if CIS is not reachable
+//	GET  /queue                                                            invoices waiting in the offline queue
+//	POST /queue/dispatch                                                   send the queued invoices now
+//	GET  /queue/failed                                                     queued invoices failed permanently
+//
+// The invoice JSON:
+//
+//	{
+//	  "issued_at": "2024-10-01T12:00:00+02:00", "number": 1, "device": 1,
+//	  "vat": [{"rate": "25.00", "base": "100.00", "amount": "25.00"}],
+//	  "total": "125.00", "payment_method": "G", "operator_oib": "12345678901"
+//	}
+//
+// Invoices that could not be fiscalized because of a network or CIS problem are kept in the offline queue
+// (a bbolt file with -queue, in memory otherwise) and sent again every -dispatch-interval.
+// On SIGTERM or SIGINT the requests in flight are finished and the queue is closed before exiting.
+package main
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	fiskalhrgo "github.com/l-d-t/fiskalhrgo"
+	"github.com/l-d-t/fiskalhrgo/boltstore"
+	"github.com/l-d-t/fiskalhrgo/fiskalconfig"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "fiskald: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	listen := flag.String("listen", "127.0.0.1:8089", "address to listen on")
+	oib := flag.String("oib", "", "OIB of the taxpayer")
+	location := flag.String("location", "", "business location ID (oznaka poslovnog prostora)")
+	vat := flag.Bool("vat", true, "the taxpayer is in the VAT system")
+	centralized := flag.Bool("centralized", true, "invoice numbers are centralized per location")
+	demo := flag.Bool("demo", false, "use the demo CIS environment")
+	certPath := flag.String("cert", "", "path to the P12 fiscal certificate")
+	queuePath := flag.String("queue", "", "path to the bbolt file of the offline queue (in memory if empty)")
+	dispatchInterval := flag.Duration("dispatch-interval", time.Minute, "how often to send the queued invoices")
+	configPath := flag.String("config", "", "path to a YAML or TOML entity configuration, replaces the entity flags")
+	entityName := flag.String("entity", "", "name of the entity in the configuration, may be empty if it has only one")
+	flag.Parse()
+
+	apiKey := os.Getenv("FISKALD_API_KEY")
+	if apiKey == "" {
+		return errors.New("FISKALD_API_KEY environment variable must be set")
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	var entity *fiskalhrgo.FiskalEntity
+	var err error
+	if *configPath != "" {
+		entity, err = entityFromConfig(*configPath, *entityName)
+	} else {
+		entity, err = fiskalhrgo.NewFiskalEntity(*oib, *vat, *location, *centralized, *demo, true, *certPath, os.Getenv("FISKALD_CERT_PASSWORD"))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create entity: %w", err)
+	}
+	entity.SetLogger(logger)
+
+	var store fiskalhrgo.QueueStore = fiskalhrgo.NewMemoryQueueStore()
+	if *queuePath != "" {
+		if store, err = boltstore.Open(*queuePath); err != nil {
+			return err
+		}
+	}
+
+	queue, err := entity.NewOfflineQueue(store)
+	if err != nil {
+		store.Close()
+		return err
+	}
+
+	// On shutdown the requests in flight are finished first, then the queue is closed
+	group := fiskalhrgo.NewShutdownGroup()
+	group.Add(entity, queue)
+
+	srv := &server{entity: entity, queue: queue, apiKey: apiKey, logger: logger}
+	httpServer := &http.Server{
+		Addr:              *listen,
+		Handler:           srv.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	group.Go(func(ctx context.Context) { dispatchLoop(ctx, queue, *dispatchInterval, logger) })
+
+	errCh := make(chan error, 1)
+	go func() {
+		logger.Info("fiskald listening", "address", *listen, "demo", entity.DemoMode())
+		errCh <- httpServer.ListenAndServe()
+	}()
+
+	var serveErr error
+	select {
+	case serveErr = <-errCh:
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if serveErr == nil {
+		serveErr = httpServer.Shutdown(shutdownCtx)
+	}
+	if err := group.Shutdown(shutdownCtx); err != nil {
+		logger.Error("graceful shutdown failed", "error", err)
+		return errors.Join(serveErr, err)
+	}
+	logger.Info("fiskald stopped")
+	return serveErr
+}
+
+// entityFromConfig creates the named entity from the configuration file
+func entityFromConfig(path string, name string) (*fiskalhrgo.FiskalEntity, error) {
+	cfg, err := fiskalconfig.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	ec, err := cfg.Entity(name)
+	if err != nil {
+		return nil, err
+	}
+	return ec.NewEntity()
+}
+
+// dispatchLoop sends the queued invoices periodically until the context is done
+func dispatchLoop(ctx context.Context, queue *fiskalhrgo.OfflineQueue, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		results, err := queue.Dispatch()
+		if err != nil {
+			logger.Error("failed to dispatch the offline queue", "error", err)
+			continue
+		}
+		for _, res := range results {
+			if res.Err != nil {
+				logger.Warn("queued invoice not delivered", "zki", res.ZKI, "error", res.Err)
+			} else {
+				logger.Info("queued invoice delivered", "zki", res.ZKI, "jir", res.JIR)
+			}
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	fiskalhrgo "github.com/l-d-t/fiskalhrgo"
+	"github.com/l-d-t/fiskalhrgo/internal/invoicejson"
+)
+
+// maxRequestSize limits the size of the JSON request bodies
+const maxRequestSize = 1 << 20
+
+// server exposes a FiskalEntity over HTTP/JSON
+type server struct {
+	entity *fiskalhrgo.FiskalEntity
+	queue  *fiskalhrgo.OfflineQueue
+	apiKey string
+	logger *slog.Logger
+}
+
+// handler returns the HTTP handler with all endpoints, protected by the API key
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /echo", s.handleEcho)
+	mux.HandleFunc("POST /zki", s.handleZKI)
+	mux.HandleFunc("POST /invoice", s.handleInvoice)
+	mux.HandleFunc("GET /queue", s.handleQueue)
+	mux.HandleFunc("POST /queue/dispatch", s.handleDispatch)
+	mux.HandleFunc("GET /queue/failed", s.handleFailed)
+	return s.authenticate(mux)
+}
+
+// authenticate checks the API key from the Authorization (Bearer) or the X-API-Key header
+func (s *server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("X-API-Key")
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			key = strings.TrimPrefix(auth, "Bearer ")
+		}
+		if subtle.ConstantTimeCompare([]byte(key), []byte(s.apiKey)) != 1 {
+			writeJSON(w, http.StatusUnauthorized, errorResponse{Error: &errorBody{Message: "invalid API key"}})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type echoRequest struct {
+	Text string `json:"text"`
+}
+
+type zkiRequest struct {
+	IssuedAt time.Time `json:"issued_at"`
+	Number   uint      `json:"number"`
+	Device   uint      `json:"device"`
+	Total    string    `json:"total"`
+}
+
+type zkiResponse struct {
+	ZKI string `json:"zki"`
+}
+
+type invoiceResponse struct {
+	ZKI    string     `json:"zki"`
+	JIR    string     `json:"jir,omitempty"`
+	Queued bool       `json:"queued"`
+	Error  *errorBody `json:"error,omitempty"`
+}
+
+type errorResponse struct {
+	Error *errorBody `json:"error"`
+}
+
+type errorBody struct {
+	Message   string `json:"message"`
+	Category  string `json:"category,omitempty"`
+	Code      string `json:"code,omitempty"`
+	Retriable bool   `json:"retriable"`
+}
+
+type dispatchResult struct {
+	ZKI   string     `json:"zki"`
+	JIR   string     `json:"jir,omitempty"`
+	Error *errorBody `json:"error,omitempty"`
+}
+
+func (s *server) handleEcho(w http.ResponseWriter, r *http.Request) {
+	var req echoRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	text, err := s.entity.EchoRequest(req.Text)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, echoRequest{Text: text})
+}
+
+func (s *server) handleZKI(w http.ResponseWriter, r *http.Request) {
+	var req zkiRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if !fiskalhrgo.IsValidCurrencyFormat(req.Total) {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: &errorBody{Message: "the total amount must be a valid currency format", Category: string(fiskalhrgo.CategoryInput)}})
+		return
+	}
+	zki, err := s.entity.GenerateZKI(req.IssuedAt, req.Number, req.Device, req.Total)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, zkiResponse{ZKI: zki})
+}
+
+// handleInvoice fiscalizes the invoice. If CIS is not reachable, the invoice is put in the offline queue
+// and the response has queued set to true, the ZKI must be printed on the receipt either way.
+func (s *server) handleInvoice(w http.ResponseWriter, r *http.Request) {
+	var in invoicejson.Invoice
+	if !decodeJSON(w, r, &in) {
+		return
+	}
+
+	invoice, zki, err := in.Build(s.entity)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: &errorBody{Message: err.Error(), Category: string(fiskalhrgo.CategoryInput)}})
+		return
+	}
+
+	jir, _, err := invoice.InvoiceRequest()
+	if err == nil {
+		writeJSON(w, http.StatusOK, invoiceResponse{ZKI: zki, JIR: jir})
+		return
+	}
+
+	if fiskalhrgo.IsRetriable(err) {
+		if qerr := s.queue.Enqueue(invoice, err); qerr == nil {
+			s.logger.Warn("invoice queued for later delivery", "zki", zki, "error", err)
+			writeJSON(w, http.StatusAccepted, invoiceResponse{ZKI: zki, Queued: true, Error: newErrorBody(err)})
+			return
+		} else {
+			s.logger.Error("failed to queue invoice", "zki", zki, "error", qerr)
+		}
+	}
+
+	writeJSON(w, statusFor(err), invoiceResponse{ZKI: zki, Error: newErrorBody(err)})
+}
+
+func (s *server) handleQueue(w http.ResponseWriter, r *http.Request) {
+	pending, err := s.queue.Pending()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, pending)
+}
+
+func (s *server) handleFailed(w http.ResponseWriter, r *http.Request) {
+	failed, err := s.queue.Failed()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, failed)
+}
+
+func (s *server) handleDispatch(w http.ResponseWriter, r *http.Request) {
+	results, err := s.queue.Dispatch()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	out := make([]dispatchResult, 0, len(results))
+	for _, res := range results {
+		out = append(out, dispatchResult{ZKI: res.ZKI, JIR: res.JIR, Error: newErrorBody(res.Err)})
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// decodeJSON decodes the request body, writing the error response if it fails
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: &errorBody{Message: "invalid JSON: " + err.Error(), Category: string(fiskalhrgo.CategoryInput)}})
+		return false
+	}
+	return true
+}
+
+// newErrorBody describes the error, nil for a nil error
+func newErrorBody(err error) *errorBody {
+	if err == nil {
+		return nil
+	}
+	body := &errorBody{Message: err.Error(), Retriable: fiskalhrgo.IsRetriable(err)}
+	var fErr *fiskalhrgo.FiskalError
+	if errors.As(err, &fErr) {
+		body.Category = string(fErr.Category)
+		body.Code = fErr.Code
+	}
+	return body
+}
+
+// statusFor maps the error category to the HTTP status code
+func statusFor(err error) int {
+	var fErr *fiskalhrgo.FiskalError
+	if !errors.As(err, &fErr) {
+		return http.StatusInternalServerError
+	}
+	switch fErr.Category {
+	case fiskalhrgo.CategoryInput:
+		return http.StatusBadRequest
+	case fiskalhrgo.CategoryCISValidation, fiskalhrgo.CategorySignature:
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	writeJSON(w, statusFor(err), errorResponse{Error: newErrorBody(err)})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
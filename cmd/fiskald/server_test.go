@@ -0,0 +1,127 @@
+package main
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	fiskalhrgo "github.com/l-d-t/fiskalhrgo"
+	"github.com/l-d-t/fiskalhrgo/ciscmock"
+	"github.com/l-d-t/fiskalhrgo/fiskaltest"
+)
+
+// newTestServer creates the daemon for an entity using a mock CIS
+func newTestServer(t *testing.T) (*ciscmock.Server, *httptest.Server) {
+	t.Helper()
+	certBase64 := os.Getenv("CIS_P12_BASE64")
+	certPassword := os.Getenv("FISKALHRGO_TEST_CERT_PASSWORD")
+	oib := os.Getenv("FISKALHRGO_TEST_CERT_OIB")
+	if certBase64 == "" || certPassword == "" || oib == "" {
+		t.Skip("CIS_P12_BASE64, FISKALHRGO_TEST_CERT_PASSWORD or FISKALHRGO_TEST_CERT_OIB not set")
+	}
+	certData, err := base64.StdEncoding.DecodeString(certBase64)
+	if err != nil {
+		t.Fatalf("Failed to decode base64 certificate: %v", err)
+	}
+	certPath := filepath.Join(t.TempDir(), "fiskal.p12")
+	if err := os.WriteFile(certPath, certData, 0600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+
+	entity, err := fiskalhrgo.NewFiskalEntityWithOptions(oib, fiskalhrgo.WithLocation("TESTD"), fiskalhrgo.WithDemoMode(true),
+		fiskalhrgo.WithCertFile(certPath, certPassword), fiskalhrgo.WithClock(fiskaltest.Clock))
+	if err != nil {
+		t.Fatalf("Failed to create entity: %v", err)
+	}
+	mock := ciscmock.NewServer()
+	t.Cleanup(mock.Close)
+	if err := mock.Configure(entity); err != nil {
+		t.Fatalf("Failed to configure mock: %v", err)
+	}
+
+	queue, _ := entity.NewOfflineQueue(fiskalhrgo.NewMemoryQueueStore())
+	srv := &server{entity: entity, queue: queue, apiKey: "secret", logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	httpServer := httptest.NewServer(srv.handler())
+	t.Cleanup(httpServer.Close)
+	return mock, httpServer
+}
+
+func post(t *testing.T, url string, body string) (int, map[string]interface{}) {
+	t.Helper()
+	req, _ := http.NewRequest("POST", url, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var out map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&out)
+	return resp.StatusCode, out
+}
+
+func TestAuthentication(t *testing.T) {
+	srv := &server{apiKey: "secret"}
+	for _, header := range []http.Header{{}, {"X-Api-Key": []string{"wrong"}}, {"Authorization": []string{"Bearer wrong"}}} {
+		req := httptest.NewRequest("GET", "/queue", nil)
+		req.Header = header
+		rec := httptest.NewRecorder()
+		srv.handler().ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for %v, got %d", header, rec.Code)
+		}
+	}
+}
+
+func TestInvoiceEndpoint(t *testing.T) {
+	mock, httpServer := newTestServer(t)
+
+	invoice := `{"issued_at": "` + time.Now().Format(time.RFC3339) + `", "number": 7, "device": 1,
+		"vat": [{"rate": "25.00", "base": "8.00", "amount": "2.00"}],
+		"total": "10.00", "payment_method": "G", "operator_oib": "12345678901"}`
+
+	status, out := post(t, httpServer.URL+"/invoice", invoice)
+	if status != http.StatusOK || !fiskalhrgo.ValidateJIR(out["jir"].(string)) || !fiskalhrgo.ValidateZKI(out["zki"].(string)) {
+		t.Fatalf("Unexpected response: %d %v", status, out)
+	}
+
+	// CIS not available, the invoice is queued
+	mock.SetResponder(func(req *ciscmock.Request) *ciscmock.Response {
+		return &ciscmock.Response{StatusCode: http.StatusServiceUnavailable, Raw: []byte("maintenance")}
+	})
+	status, out = post(t, httpServer.URL+"/invoice", invoice)
+	if status != http.StatusAccepted || out["queued"] != true {
+		t.Fatalf("Expected the invoice to be queued, got %d %v", status, out)
+	}
+
+	mock.Reset()
+	req, _ := http.NewRequest("POST", httpServer.URL+"/queue/dispatch", nil)
+	req.Header.Set("X-API-Key", "secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Dispatch failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var results []dispatchResult
+	json.NewDecoder(resp.Body).Decode(&results)
+	if len(results) != 1 || results[0].JIR == "" || !mock.LastRequest().NakDost {
+		t.Errorf("Expected the queued invoice to be delivered late, got %+v", results)
+	}
+
+	status, out = post(t, httpServer.URL+"/invoice", `{"total": "abc"}`)
+	if status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid invoice, got %d %v", status, out)
+	}
+}
@@ -0,0 +1,305 @@
+// Command fiskalhr is a command line tool for fiscalization tasks: echo to CIS, computing and verifying the ZKI,
+// displaying the certificate info and sending invoices from JSON or XML files.
+//
+// Usage:
+//
+//	FISKALHR_CERT_PASSWORD=pass fiskalhr <command> -oib 12345678901 -location POS1 -cert fiskal.p12 -demo [flags]
+//	fiskalhr <command> -config fiskal.yaml -entity shop1 [flags]
+//
+// Commands:
+//
+//	echo          [-text "..."]                                        echo request to CIS
+//	zki           -time -number -device -total                         compute the ZKI
+//	verify-zki    -zki -time -number -device -total                    check the ZKI, exit status 1 if it doesn't match
+//	cert-info     [-json]                                              display the certificate info
+//	send-invoice  -file invoice.json|invoice.xml                       fiscalize the invoice from the file
+//
+// The -time flag is in RFC 3339 format (2024-10-01T12:00:00+02:00). The invoice file has the same format
+// as the fiskald invoice JSON, the XML has the same field names with the <invoice> root element.
+package main
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	fiskalhrgo "github.com/l-d-t/fiskalhrgo"
+	"github.com/l-d-t/fiskalhrgo/fiskalconfig"
+	"github.com/l-d-t/fiskalhrgo/internal/invoicejson"
+)
+
+// errZKIMismatch is returned by verify-zki when the ZKI doesn't match
+var errZKIMismatch = errors.New("ZKI does not match")
+
+const usage = `usage: fiskalhr <command> [flags]
+
+commands:
+  echo          send an echo request to CIS
+  zki           compute the ZKI
+  verify-zki    check the ZKI
+  cert-info     display the certificate info
+  send-invoice  fiscalize an invoice from a JSON or XML file
+
+Run "fiskalhr <command> -h" for the command flags.
+`
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintf(os.Stderr, "fiskalhr: %v\n", err)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return flag.ErrHelp
+	}
+
+	command, args := args[0], args[1:]
+	switch command {
+	case "echo":
+		return runEcho(args, out)
+	case "zki":
+		return runZKI(args, out)
+	case "verify-zki":
+		return runVerifyZKI(args, out)
+	case "cert-info":
+		return runCertInfo(args, out)
+	case "send-invoice":
+		return runSendInvoice(args, out)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(out, usage)
+		return nil
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command: %s", command)
+	}
+}
+
+// entityFlags are the flags common to all commands, used to create the FiskalEntity
+type entityFlags struct {
+	oib         string
+	location    string
+	cert        string
+	vat         bool
+	centralized bool
+	demo        bool
+	config      string
+	name        string
+}
+
+func newFlagSet(name string) (*flag.FlagSet, *entityFlags) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	ef := &entityFlags{}
+	fs.StringVar(&ef.oib, "oib", "", "OIB of the taxpayer")
+	fs.StringVar(&ef.location, "location", "", "business location ID (oznaka poslovnog prostora)")
+	fs.StringVar(&ef.cert, "cert", "", "path to the P12 fiscal certificate, the password is read from FISKALHR_CERT_PASSWORD")
+	fs.BoolVar(&ef.vat, "vat", true, "the taxpayer is in the VAT system")
+	fs.BoolVar(&ef.centralized, "centralized", true, "invoice numbers are centralized per location")
+	fs.BoolVar(&ef.demo, "demo", false, "use the demo CIS environment")
+	fs.StringVar(&ef.config, "config", "", "path to a YAML or TOML entity configuration, replaces the entity flags")
+	fs.StringVar(&ef.name, "entity", "", "name of the entity in the configuration, may be empty if it has only one")
+	return fs, ef
+}
+
+// clock checks the validity of the CIS certificates, replaced in the tests
+var clock = time.Now
+
+// entity creates the FiskalEntity, an expired certificate is accepted so cert-info and zki work with it
+func (ef *entityFlags) entity() (*fiskalhrgo.FiskalEntity, error) {
+	if ef.config != "" {
+		cfg, err := fiskalconfig.Load(ef.config)
+		if err != nil {
+			return nil, err
+		}
+		ec, err := cfg.Entity(ef.name)
+		if err != nil {
+			return nil, err
+		}
+		ec.AllowExpired = true
+		return ec.NewEntity(fiskalhrgo.WithClock(clock))
+	}
+	entity, err := fiskalhrgo.NewFiskalEntityWithOptions(ef.oib, fiskalhrgo.WithVAT(ef.vat), fiskalhrgo.WithLocation(ef.location),
+		fiskalhrgo.WithCentralizedInvoiceNumber(ef.centralized), fiskalhrgo.WithDemoMode(ef.demo), fiskalhrgo.WithExpiredCheck(false),
+		fiskalhrgo.WithCertFile(ef.cert, os.Getenv("FISKALHR_CERT_PASSWORD")), fiskalhrgo.WithClock(clock))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create entity: %w", err)
+	}
+	return entity, nil
+}
+
+// zkiFlags are the ZKI input parameters
+type zkiFlags struct {
+	issued string
+	number uint
+	device uint
+	total  string
+}
+
+func (zf *zkiFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&zf.issued, "time", "", "date and time of the invoice in RFC 3339 format")
+	fs.UintVar(&zf.number, "number", 0, "invoice number")
+	fs.UintVar(&zf.device, "device", 0, "device (naplatni uređaj) number")
+	fs.StringVar(&zf.total, "total", "", "total amount, e.g. 125.00")
+}
+
+func (zf *zkiFlags) compute(entity *fiskalhrgo.FiskalEntity) (string, error) {
+	issued, err := time.Parse(time.RFC3339, zf.issued)
+	if err != nil {
+		return "", fmt.Errorf("invalid -time: %w", err)
+	}
+	if !fiskalhrgo.IsValidCurrencyFormat(zf.total) {
+		return "", errors.New("invalid -total, must be a valid currency format")
+	}
+	return entity.GenerateZKI(issued, zf.number, zf.device, zf.total)
+}
+
+func runEcho(args []string, out io.Writer) error {
+	fs, ef := newFlagSet("echo")
+	text := fs.String("text", "fiskalhr echo", "text to send")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	entity, err := ef.entity()
+	if err != nil {
+		return err
+	}
+	reply, err := entity.EchoRequest(*text)
+	if err != nil {
+		return describeError(err)
+	}
+	fmt.Fprintln(out, reply)
+	return nil
+}
+
+func runZKI(args []string, out io.Writer) error {
+	fs, ef := newFlagSet("zki")
+	var zf zkiFlags
+	zf.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	entity, err := ef.entity()
+	if err != nil {
+		return err
+	}
+	zki, err := zf.compute(entity)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, zki)
+	return nil
+}
+
+func runVerifyZKI(args []string, out io.Writer) error {
+	fs, ef := newFlagSet("verify-zki")
+	var zf zkiFlags
+	zf.register(fs)
+	expected := fs.String("zki", "", "the ZKI to verify")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *expected == "" {
+		return errors.New("-zki is required")
+	}
+	entity, err := ef.entity()
+	if err != nil {
+		return err
+	}
+	zki, err := zf.compute(entity)
+	if err != nil {
+		return err
+	}
+	if zki != *expected {
+		fmt.Fprintf(out, "MISMATCH: computed %s\n", zki)
+		return errZKIMismatch
+	}
+	fmt.Fprintln(out, "OK")
+	return nil
+}
+
+func runCertInfo(args []string, out io.Writer) error {
+	fs, ef := newFlagSet("cert-info")
+	asJSON := fs.Bool("json", false, "print the certificate info as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	entity, err := ef.entity()
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		fmt.Fprintln(out, entity.DisplayCertInfoJSON())
+		return nil
+	}
+	fmt.Fprint(out, entity.DisplayCertInfoText())
+	switch {
+	case entity.IsExpired():
+		fmt.Fprintln(out, "The certificate is EXPIRED")
+	case entity.IsExpiringSoon():
+		fmt.Fprintf(out, "The certificate expires soon, in %d days\n", entity.DaysUntilExpire())
+	default:
+		fmt.Fprintf(out, "The certificate expires in %d days\n", entity.DaysUntilExpire())
+	}
+	return nil
+}
+
+func runSendInvoice(args []string, out io.Writer) error {
+	fs, ef := newFlagSet("send-invoice")
+	file := fs.String("file", "", "path to the invoice JSON or XML file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return errors.New("-file is required")
+	}
+	in, err := loadInvoice(*file)
+	if err != nil {
+		return err
+	}
+	entity, err := ef.entity()
+	if err != nil {
+		return err
+	}
+
+	invoice, zki, err := in.Build(entity)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "ZKI: %s\n", zki)
+
+	jir, _, err := invoice.InvoiceRequest()
+	if err != nil {
+		return describeError(err)
+	}
+	fmt.Fprintf(out, "JIR: %s\n", jir)
+	return nil
+}
+
+// loadInvoice reads the invoice from a JSON or XML file
+func loadInvoice(path string) (*invoicejson.Invoice, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read invoice file: %w", err)
+	}
+	return invoicejson.Parse(data)
+}
+
+// describeError adds the category and whether the request can be retried to the error message
+func describeError(err error) error {
+	var fErr *fiskalhrgo.FiskalError
+	if !errors.As(err, &fErr) {
+		return err
+	}
+	return fmt.Errorf("%w [category: %s, retriable: %t]", err, fErr.Category, fErr.Retriable())
+}
@@ -0,0 +1,93 @@
+package main
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/l-d-t/fiskalhrgo/fiskaltest"
+)
+
+func TestLoadInvoice(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"invoice.json": `{"issued_at": "2024-10-01T12:00:00+02:00", "number": 7, "device": 1, "total": "10.00", "payment_method": "G"}`,
+		"invoice.xml":  `<invoice><issued_at>2024-10-01T12:00:00+02:00</issued_at><number>7</number><device>1</device><total>10.00</total><payment_method>G</payment_method></invoice>`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		in, err := loadInvoice(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if in.Number != 7 || in.Total != "10.00" {
+			t.Errorf("%s: unexpected invoice: %+v", name, in)
+		}
+	}
+
+	if _, err := loadInvoice(filepath.Join(dir, "missing.json")); err == nil {
+		t.Errorf("Expected error for a missing file")
+	}
+}
+
+func TestRunUnknownCommand(t *testing.T) {
+	var out bytes.Buffer
+	if err := run([]string{"nope"}, &out); err == nil || !strings.Contains(err.Error(), "unknown command") {
+		t.Errorf("Expected unknown command error, got %v", err)
+	}
+	if err := run([]string{"help"}, &out); err != nil || !strings.Contains(out.String(), "send-invoice") {
+		t.Errorf("Expected usage, got %v %q", err, out.String())
+	}
+}
+
+func TestVerifyZKI(t *testing.T) {
+	certBase64 := os.Getenv("CIS_P12_BASE64")
+	password := os.Getenv("FISKALHRGO_TEST_CERT_PASSWORD")
+	oib := os.Getenv("FISKALHRGO_TEST_CERT_OIB")
+	if certBase64 == "" || password == "" || oib == "" {
+		t.Skip("CIS_P12_BASE64, FISKALHRGO_TEST_CERT_PASSWORD or FISKALHRGO_TEST_CERT_OIB not set")
+	}
+	certData, err := base64.StdEncoding.DecodeString(certBase64)
+	if err != nil {
+		t.Fatalf("Failed to decode base64 certificate: %v", err)
+	}
+	certPath := filepath.Join(t.TempDir(), "fiskal.p12")
+	if err := os.WriteFile(certPath, certData, 0600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	t.Setenv("FISKALHR_CERT_PASSWORD", password)
+	clock = fiskaltest.Clock
+	t.Cleanup(func() { clock = time.Now })
+
+	common := []string{"-oib", oib, "-location", "POS1", "-cert", certPath, "-demo", "-time", "2024-10-01T12:00:00+02:00", "-number", "1", "-device", "1", "-total", "10.00"}
+
+	var out bytes.Buffer
+	if err := run(append([]string{"zki"}, common...), &out); err != nil {
+		t.Fatalf("zki failed: %v", err)
+	}
+	zki := strings.TrimSpace(out.String())
+
+	out.Reset()
+	if err := run(append([]string{"verify-zki", "-zki", zki}, common...), &out); err != nil {
+		t.Errorf("verify-zki failed for the computed ZKI: %v", err)
+	}
+	if err := run(append([]string{"verify-zki", "-zki", "00000000000000000000000000000000"}, common...), &out); err != errZKIMismatch {
+		t.Errorf("Expected ZKI mismatch, got %v", err)
+	}
+	out.Reset()
+	if err := run([]string{"cert-info", "-json", "-oib", oib, "-location", "POS1", "-cert", certPath, "-demo"}, &out); err != nil || !json.Valid(out.Bytes()) {
+		t.Errorf("Expected the certificate info as JSON, got %v %s", err, out.String())
+	}
+}
@@ -0,0 +1,232 @@
+// Command fiskalload is a load-testing harness: it fires a configurable volume of signed invoices at the mock CIS
+// (package ciscmock) and reports the throughput, the allocations and the latency percentiles of the whole request
+// path (ZKI, signing, TLS, response signature verification), to validate the library on small POS hardware
+// such as a Raspberry Pi.
+//
+// Usage:
+//
+//	fiskalload -invoices 1000 -concurrency 4
+//	fiskalload -invoices 5000 -concurrency 8 -json
+//
+// The invoices are signed with a synthetic certificate (package fiskaltest) unless -cert is set, the password of
+// the P12 file is read from FISKALLOAD_CERT_PASSWORD. The mock runs in the same process, so the allocations
+// include the mock side of the exchange. Build for the target board with "make load-arm64" or "make load-armv7".
+package main
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	fiskalhrgo "github.com/l-d-t/fiskalhrgo"
+	"github.com/l-d-t/fiskalhrgo/ciscmock"
+	"github.com/l-d-t/fiskalhrgo/fiskaltest"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintf(os.Stderr, "fiskalload: %v\n", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// config of a load test run
+type config struct {
+	invoices    int
+	concurrency int
+	warmup      int
+	oib         string
+	cert        string
+}
+
+func run(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("fiskalload", flag.ContinueOnError)
+	cfg := config{}
+	fs.IntVar(&cfg.invoices, "invoices", 1000, "number of invoices to send")
+	fs.IntVar(&cfg.concurrency, "concurrency", runtime.NumCPU(), "number of invoices sent at the same time")
+	fs.IntVar(&cfg.warmup, "warmup", 20, "number of invoices sent before the measurement (TLS handshake, caches)")
+	fs.StringVar(&cfg.oib, "oib", "", "OIB of the certificate set with -cert")
+	fs.StringVar(&cfg.cert, "cert", "", "path to a P12 certificate, a synthetic one is used if empty")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	rep, err := loadTest(cfg)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(rep)
+	}
+	rep.print(out)
+	return nil
+}
+
+// report is the outcome of a load test run
+type report struct {
+	Platform    string  `json:"platform"`
+	CPUs        int     `json:"cpus"`
+	Invoices    int     `json:"invoices"`
+	Errors      int     `json:"errors"`
+	Concurrency int     `json:"concurrency"`
+	Seconds     float64 `json:"seconds"`
+	PerSecond   float64 `json:"invoices_per_second"`
+
+	// Latencies of a single invoice request in milliseconds
+	P50 float64 `json:"p50_ms"`
+	P90 float64 `json:"p90_ms"`
+	P99 float64 `json:"p99_ms"`
+	Max float64 `json:"max_ms"`
+
+	// Allocations per invoice, both sides of the exchange
+	AllocsPerInvoice uint64 `json:"allocs_per_invoice"`
+	BytesPerInvoice  uint64 `json:"bytes_per_invoice"`
+
+	// FirstError is the first failed request, empty if all succeeded
+	FirstError string `json:"first_error,omitempty"`
+}
+
+func (r *report) print(out io.Writer) {
+	fmt.Fprintf(out, "platform:     %s, %d CPUs\n", r.Platform, r.CPUs)
+	fmt.Fprintf(out, "invoices:     %d (%d errors), concurrency %d\n", r.Invoices, r.Errors, r.Concurrency)
+	fmt.Fprintf(out, "duration:     %.2fs, %.1f invoices/s\n", r.Seconds, r.PerSecond)
+	fmt.Fprintf(out, "latency:      p50 %.2fms, p90 %.2fms, p99 %.2fms, max %.2fms\n", r.P50, r.P90, r.P99, r.Max)
+	fmt.Fprintf(out, "allocations:  %d allocs, %d bytes per invoice\n", r.AllocsPerInvoice, r.BytesPerInvoice)
+	if r.FirstError != "" {
+		fmt.Fprintf(out, "first error:  %s\n", r.FirstError)
+	}
+}
+
+// loadTest runs the load test against a new mock
+func loadTest(cfg config) (*report, error) {
+	if cfg.invoices <= 0 || cfg.concurrency <= 0 || cfg.warmup < 0 {
+		return nil, errors.New("invoices and concurrency must be positive, warmup can't be negative")
+	}
+	fe, err := newEntity(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer fe.Close()
+	server := ciscmock.NewServer()
+	defer server.Close()
+	if err := server.Configure(fe); err != nil {
+		return nil, err
+	}
+
+	var number atomic.Uint64
+	send := func() (time.Duration, error) {
+		invoice, _, err := fe.NewCISInvoice(time.Now(), uint(number.Add(1)), 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "10.00", fiskalhrgo.CISCash, "")
+		if err != nil {
+			return 0, err
+		}
+		started := time.Now()
+		_, _, err = invoice.InvoiceRequest()
+		return time.Since(started), err
+	}
+	for i := 0; i < cfg.warmup; i++ {
+		if _, err := send(); err != nil {
+			return nil, fmt.Errorf("warmup failed: %w", err)
+		}
+	}
+
+	latencies := make([]time.Duration, cfg.invoices)
+	errs := make([]error, cfg.invoices)
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	started := time.Now()
+	for w := 0; w < cfg.concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := int(next.Add(1)) - 1; i < cfg.invoices; i = int(next.Add(1)) - 1 {
+				latencies[i], errs[i] = send()
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(started)
+	runtime.ReadMemStats(&after)
+
+	rep := &report{
+		Platform:         runtime.GOOS + "/" + runtime.GOARCH,
+		CPUs:             runtime.NumCPU(),
+		Invoices:         cfg.invoices,
+		Concurrency:      cfg.concurrency,
+		Seconds:          elapsed.Seconds(),
+		PerSecond:        float64(cfg.invoices) / elapsed.Seconds(),
+		AllocsPerInvoice: (after.Mallocs - before.Mallocs) / uint64(cfg.invoices),
+		BytesPerInvoice:  (after.TotalAlloc - before.TotalAlloc) / uint64(cfg.invoices),
+	}
+	for _, err := range errs {
+		if err != nil {
+			if rep.Errors == 0 {
+				rep.FirstError = err.Error()
+			}
+			rep.Errors++
+		}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	rep.P50 = milliseconds(percentile(latencies, 50))
+	rep.P90 = milliseconds(percentile(latencies, 90))
+	rep.P99 = milliseconds(percentile(latencies, 99))
+	rep.Max = milliseconds(latencies[len(latencies)-1])
+	return rep, nil
+}
+
+// newEntity creates the entity with the certificate from the flags or a synthetic one
+func newEntity(cfg config) (*fiskalhrgo.FiskalEntity, error) {
+	options := []fiskalhrgo.Option{fiskalhrgo.WithLocation("LOAD1"), fiskalhrgo.WithDemoMode(true), fiskalhrgo.WithChainVerification(false)}
+	oib := cfg.oib
+	if cfg.cert != "" {
+		if oib == "" {
+			return nil, errors.New("-oib is required with -cert")
+		}
+		options = append(options, fiskalhrgo.WithCertFile(cfg.cert, os.Getenv("FISKALLOAD_CERT_PASSWORD")))
+	} else {
+		cert, err := fiskaltest.NewCertificate(fiskaltest.OIB)
+		if err != nil {
+			return nil, err
+		}
+		p12, err := cert.P12("fiskalload")
+		if err != nil {
+			return nil, err
+		}
+		oib = fiskaltest.OIB
+		// The mock CIS replaces the CIS certificate, the embedded one is only checked at the fixed time
+		options = append(options, fiskalhrgo.WithCertP12(p12, "fiskalload"), fiskalhrgo.WithClock(fiskaltest.Clock))
+	}
+	return fiskalhrgo.NewFiskalEntityWithOptions(oib, options...)
+}
+
+// percentile returns the nearest-rank percentile of the sorted latencies
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,49 @@
+package main
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestLoadTest(t *testing.T) {
+	var out bytes.Buffer
+	if err := run([]string{"-invoices", "20", "-concurrency", "4", "-warmup", "2", "-json"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	var rep report
+	if err := json.Unmarshal(out.Bytes(), &rep); err != nil {
+		t.Fatalf("Invalid report %s: %v", out.String(), err)
+	}
+	if rep.Invoices != 20 || rep.Errors != 0 || rep.PerSecond <= 0 {
+		t.Errorf("Unexpected report %+v", rep)
+	}
+	if rep.P50 <= 0 || rep.P50 > rep.P99 || rep.P99 > rep.Max || rep.AllocsPerInvoice == 0 {
+		t.Errorf("Unexpected latencies or allocations %+v", rep)
+	}
+
+	if err := run([]string{"-invoices", "0"}, &out); err == nil {
+		t.Error("Expected an error for no invoices")
+	}
+	if err := run([]string{"-cert", "fiskal.p12"}, &out); err == nil {
+		t.Error("Expected an error for a certificate without the OIB")
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var sorted []time.Duration
+	for i := 1; i <= 200; i++ {
+		sorted = append(sorted, time.Duration(i))
+	}
+	if p := percentile(sorted, 99); p != 198 {
+		t.Errorf("Expected the 198th value as p99, got %d", p)
+	}
+	if p := percentile(sorted[:1], 50); p != 1 {
+		t.Errorf("Expected the only value, got %d", p)
+	}
+}
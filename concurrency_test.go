@@ -0,0 +1,109 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+// TestConcurrentRequests runs many invoice and echo requests on one entity at the same time as the entity settings
+// change, run it with -race to find the shared state issues
+func TestConcurrentRequests(t *testing.T) {
+	key, cert := newTestCISSigningCert(t)
+	fe := newTestServerEntity(t, func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		doc := etree.NewDocument()
+		if err := doc.ReadFromBytes(body); err != nil {
+			t.Error(err)
+			return
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		if echo := doc.FindElement("//EchoRequest"); echo != nil {
+			fmt.Fprintf(w, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><tns:EchoResponse xmlns:tns="http://www.apis-it.hr/fin/2012/types/f73">%s</tns:EchoResponse></soap:Body></soap:Envelope>`, echo.Text())
+			return
+		}
+		response := fmt.Sprintf(testCISResponse, "G0x1", doc.FindElement("//IdPoruke").Text(), doc.FindElement("//DatumVrijeme").Text(), "9d6f5bb6-da48-4fcd-a803-4586a025e0e4")
+		fmt.Fprint(w, signTestCISResponse(t, key, response, MakeC14N10RecCanonicalizer()))
+	})
+	fe.ciscert = newSignatureCheckCIScert(cert, fe.ciscert.SSLverifyPoll)
+	fe.SetJournal(NewMemoryJournal())
+	fe.SetMessageStore(NewMemoryMessageStore())
+	fe.OnJIRReceived(func(*RacunType, string) {})
+
+	const workers, requests = 8, 5
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*requests*2)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < requests; i++ {
+				invoice, zki, err := fe.NewCISInvoice(time.Now(), uint(w*requests+i+1), 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "10.00", CISCash, "12345678901")
+				if err != nil {
+					errs <- err
+					continue
+				}
+				invoice.SetRequestHeaders(http.Header{"X-Request": {zki}})
+				result, err := invoice.InvoiceRequestResult()
+				if err != nil {
+					errs <- fmt.Errorf("invoice %d/%d: %w", w, i, err)
+				} else if result.ZKI != zki || result.JIR == "" {
+					errs <- fmt.Errorf("invoice %d/%d: unexpected result %+v", w, i, result)
+				}
+				text := fmt.Sprintf("echo %d/%d", w, i)
+				if echo, err := fe.EchoRequest(text); err != nil || echo != text {
+					errs <- fmt.Errorf("echo %d/%d: %q %v", w, i, echo, err)
+				}
+			}
+		}(w)
+	}
+
+	// The settings that may change while the requests run
+	endpoint := fe.Endpoint()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < requests; i++ {
+			if err := fe.SetEndpoint(endpoint); err != nil {
+				t.Error(err)
+			}
+			fe.SetJournal(NewMemoryJournal())
+			fe.SetMaxResponseSize(1 << 20)
+			fe.SetRequestHeader("X-Terminal", fmt.Sprint(i))
+			fe.SetUserAgent(fmt.Sprintf("pos/%d", i))
+			fe.SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+			fe.SetLanguage(LangEN)
+			if err := fe.AddTrustedRoot(cert); err != nil {
+				t.Error(err)
+			}
+			fe.SetMetrics(nil)
+			fe.Stats()
+			fe.InFlightMessages()
+			fe.GetCertSERIAL()
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if stats := fe.Stats(); stats.Fiscalized != workers*requests || stats.Requests != workers*requests*2 {
+		t.Errorf("Expected every request to be counted, got %+v", stats)
+	}
+}
@@ -0,0 +1,80 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync/atomic"
+)
+
+// WithDebugDump writes every exchange with CIS to the directory, see SetDebugDump
+func WithDebugDump(dir string) Option {
+	return func(o *entityOptions) {
+		o.debugDumpDir = dir
+	}
+}
+
+// SetDebugDump enables the debug dump for troubleshooting the CIS rejections on site: every SOAP envelope sent
+// to CIS and the raw response are written to the directory (created if missing) as
+// <time>-<sequence>-<operation>-request.xml and -response.xml, e.g. 20241015T093012.123456789-000001-RacunZahtjev-request.xml.
+// Use an empty dir to disable it, it's disabled by default.
+//
+// The dumped messages are redacted: the certificate in the signature is removed and the text goes through the
+// redaction of the entity (see SetRedaction), so the OIBs are masked by default. The dump is for debugging only,
+// use WithMessageArchive to keep the exact signed messages. A failure to write the dump is logged and doesn't fail
+// the request.
+func (fe *FiskalEntity) SetDebugDump(dir string) {
+	fe.hooksMu.Lock()
+	defer fe.hooksMu.Unlock()
+	fe.debugDumpDir = dir
+}
+
+// dumpSequence orders the dumped exchanges with the same time
+var dumpSequence atomic.Uint64
+
+// dumpCertificate matches the certificate elements of the signature removed from the dump
+var dumpCertificate = regexp.MustCompile(`(<(?:[\w-]+:)?(X509Certificate|X509IssuerName|X509SerialNumber)>)[^<]*(</(?:[\w-]+:)?(?:X509Certificate|X509IssuerName|X509SerialNumber)>)`)
+
+// dumpNamePattern matches the characters of the operation not used in the file names
+var dumpNamePattern = regexp.MustCompile(`[^0-9A-Za-z_-]`)
+
+// dumpExchange writes the redacted exchange to the debug dump directory if the dump is enabled
+func (fe *FiskalEntity) dumpExchange(exchange *Exchange) {
+	fe.hooksMu.RLock()
+	dir := fe.debugDumpDir
+	redaction := fe.redactionLocked()
+	fe.hooksMu.RUnlock()
+	if dir == "" {
+		return
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		fe.log(failureLevel, "failed to write the debug dump", errorAttrs(err)...)
+		return
+	}
+	operation := dumpNamePattern.ReplaceAllString(exchange.Operation, "_")
+	prefix := fmt.Sprintf("%s-%06d-%s", exchange.Started.Format("20060102T150405.000000000"), dumpSequence.Add(1), operation)
+	files := []struct {
+		suffix string
+		data   []byte
+	}{{"request", exchange.Request}, {"response", exchange.Response}}
+	for _, file := range files {
+		if file.data == nil {
+			continue
+		}
+		data := dumpCertificate.ReplaceAll(file.data, []byte("${1}REDACTED${3}"))
+		data = []byte(redaction.Redact(string(data)))
+		path := filepath.Join(dir, prefix+"-"+file.suffix+".xml")
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			fe.log(failureLevel, "failed to write the debug dump", append(errorAttrs(err), slog.String("path", path))...)
+			return
+		}
+	}
+	fe.log(lifecycleLevel, "CIS exchange dumped", slog.String("path", filepath.Join(dir, prefix)))
+}
@@ -0,0 +1,69 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDebugDump(t *testing.T) {
+	fe := newTestServerEntity(t, echoHandler)
+	dir := filepath.Join(t.TempDir(), "dump")
+
+	// Disabled by default
+	if _, err := fe.EchoRequest("no dump"); err != nil {
+		t.Fatalf("EchoRequest failed: %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("Expected no dump directory, got %v", err)
+	}
+
+	fe.SetDebugDump(dir)
+	if _, err := fe.EchoRequest("dump 12345678901"); err != nil {
+		t.Fatalf("EchoRequest failed: %v", err)
+	}
+	requests, _ := filepath.Glob(filepath.Join(dir, "*-EchoRequest-request.xml"))
+	responses, _ := filepath.Glob(filepath.Join(dir, "*-EchoRequest-response.xml"))
+	if len(requests) != 1 || len(responses) != 1 {
+		t.Fatalf("Expected one dumped request and response, got %v %v", requests, responses)
+	}
+	if strings.TrimSuffix(requests[0], "-request.xml") != strings.TrimSuffix(responses[0], "-response.xml") {
+		t.Errorf("Expected the same prefix of the request and the response, got %s %s", requests[0], responses[0])
+	}
+	for _, path := range append(requests, responses...) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(data), "12345678901") || !strings.Contains(string(data), "dump 12*******01") {
+			t.Errorf("Expected the redacted echo in %s, got:\n%s", path, data)
+		}
+	}
+
+	// The certificate of the signature is removed
+	fe.dumpExchange(&Exchange{
+		Operation: "RacunZahtjev",
+		Started:   time.Now(),
+		Request:   []byte("<tns:Oib>" + fe.OIB() + "</tns:Oib><X509Certificate>MIIBsecret</X509Certificate><X509IssuerName>CN=Fina</X509IssuerName>"),
+	})
+	dumped, _ := filepath.Glob(filepath.Join(dir, "*-RacunZahtjev-request.xml"))
+	if len(dumped) != 1 {
+		t.Fatalf("Expected the dumped request, got %v", dumped)
+	}
+	data, err := os.ReadFile(dumped[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<tns:Oib>" + redactOIB(fe.OIB()) + "</tns:Oib><X509Certificate>REDACTED</X509Certificate><X509IssuerName>REDACTED</X509IssuerName>"; string(data) != want {
+		t.Errorf("Unexpected dumped request %s", data)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*-RacunZahtjev-response.xml")); len(matches) != 0 {
+		t.Errorf("Expected no response file without a response, got %v", matches)
+	}
+}
@@ -5,183 +5,108 @@ package fiskalhrgo
 // Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
 
 import (
-	"crypto"
-	"crypto/rsa"
-	"crypto/sha1"
+	"bytes"
 	"crypto/x509"
-	"encoding/base64"
+	"errors"
 	"fmt"
+	"log/slog"
 
-	"github.com/beevik/etree"
+	"github.com/l-d-t/fiskalhrgo/sign"
 )
 
-// doc14n applies Exclusive Canonical XML (http://www.w3.org/2001/10/xml-exc-c14n#) to the input XML data
-func doc14n(xmlData []byte) ([]byte, error) {
-	// Parse the input XML string into an etree.Document
-	doc := etree.NewDocument()
-	if err := doc.ReadFromBytes(xmlData); err != nil {
-		return nil, fmt.Errorf("failed to parse XML: %v", err)
-	}
-
-	canonicalizer := MakeC14N10ExclusiveCanonicalizerWithPrefixList("") // No prefix list
-	canonicalizedXML, err := canonicalizer.Canonicalize(doc.Root())
-	if err != nil {
-		return nil, fmt.Errorf("failed to canonicalize the XML: %v", err)
-	}
-
-	return canonicalizedXML, nil
-}
-
-func createSignedInfoElement(referenceURI, digestValue string) *etree.Element {
-	signedInfo := etree.NewElement("SignedInfo")
-	signedInfo.CreateAttr("xmlns", "http://www.w3.org/2000/09/xmldsig#")
-
-	canonicalizationMethod := signedInfo.CreateElement("CanonicalizationMethod")
-	canonicalizationMethod.CreateAttr("Algorithm", "http://www.w3.org/2001/10/xml-exc-c14n#")
-
-	signatureMethod := signedInfo.CreateElement("SignatureMethod")
-	signatureMethod.CreateAttr("Algorithm", "http://www.w3.org/2000/09/xmldsig#rsa-sha1")
-
-	reference := signedInfo.CreateElement("Reference")
-	reference.CreateAttr("URI", "#"+referenceURI)
-
-	transforms := reference.CreateElement("Transforms")
-
-	transform1 := transforms.CreateElement("Transform")
-	transform1.CreateAttr("Algorithm", "http://www.w3.org/2000/09/xmldsig#enveloped-signature")
-
-	transform2 := transforms.CreateElement("Transform")
-	transform2.CreateAttr("Algorithm", "http://www.w3.org/2001/10/xml-exc-c14n#")
-
-	digestMethod := reference.CreateElement("DigestMethod")
-	digestMethod.CreateAttr("Algorithm", "http://www.w3.org/2000/09/xmldsig#sha1")
-
-	digestValueElement := reference.CreateElement("DigestValue")
-	digestValueElement.SetText(digestValue)
-
-	return signedInfo
+// signXML signs the root element of the document with an enveloped signature referencing its Id, see sign.Enveloped
+func (fe *FiskalEntity) signXML(xmlRequest []byte) ([]byte, error) {
+	// The certificate is taken once, so a concurrent reload can't mix the signature method, the signature and the KeyInfo
+	cert := fe.certificate()
+	return sign.Enveloped(xmlRequest, cert.publicCert, cert.signatureMethod(), cert.signSHA1)
 }
 
-func createSignatureElement(signedInfoElement *etree.Element, signatureValue string, cert *x509.Certificate) *etree.Element {
-	signatureElement := etree.NewElement("Signature")
-	signatureElement.CreateAttr("xmlns", "http://www.w3.org/2000/09/xmldsig#")
-
-	// Add the canonicalized SignedInfo element
-	signatureElement.AddChild(signedInfoElement)
-
-	// Add the SignatureValue
-	signatureValueElement := signatureElement.CreateElement("SignatureValue")
-	signatureValueElement.SetText(signatureValue)
-
-	// Add the KeyInfo
-	keyInfoElement := signatureElement.CreateElement("KeyInfo")
-	x509DataElement := keyInfoElement.CreateElement("X509Data")
-
-	// Add the X509Certificate
-	x509CertificateElement := x509DataElement.CreateElement("X509Certificate")
-	x509CertificateElement.SetText(base64.StdEncoding.EncodeToString(cert.Raw))
-
-	// Add the X509IssuerSerial
-	x509IssuerSerialElement := x509DataElement.CreateElement("X509IssuerSerial")
-
-	x509IssuerNameElement := x509IssuerSerialElement.CreateElement("X509IssuerName")
-	x509IssuerNameElement.SetText(cert.Issuer.String())
-
-	x509SerialNumberElement := x509IssuerSerialElement.CreateElement("X509SerialNumber")
-	x509SerialNumberElement.SetText(cert.SerialNumber.String())
+// ErrResponseSignature is returned when the signature of a CIS response is missing or invalid,
+// the response (and its JIR) must not be trusted
+var ErrResponseSignature = errors.New("invalid CIS response signature")
 
-	return signatureElement
+// ResponseVerifier verifies the signature of a CIS response (the complete SOAP envelope) with the CIS certificate,
+// replacing the built-in verification, e.g. with the xmlsec1 tool (see the xmlsec package)
+type ResponseVerifier interface {
+	VerifyResponse(response []byte, cisCert *x509.Certificate) error
 }
 
-func (fe *FiskalEntity) signXML(xmlRequest []byte) ([]byte, error) {
-	// Step 1: Parse and Canonicalize the XML document using etree
-	doc := etree.NewDocument()
-	if err := doc.ReadFromBytes(xmlRequest); err != nil {
-		return nil, fmt.Errorf("failed to parse XML document: %v", err)
+// verifyXML verifies the enveloped XML signature of the response message in the SOAP Body with the CIS certificate,
+// so a spoofed response (e.g. with a made up JIR) is rejected. CIS responses are signed with RSA-SHA1 and
+// canonicalized with inclusive C14N 1.0, the algorithms declared in the signature are used.
+// The verification is delegated to the ResponseVerifier if one is set.
+func (fe *FiskalEntity) verifyXML(xmlData []byte) (bool, error) {
+	ciscert := fe.cisCertificate()
+	if ciscert == nil || ciscert.PublicCert == nil {
+		return false, fmt.Errorf("%w: the CIS certificate is not loaded", ErrResponseSignature)
 	}
-
-	// Step 6: Insert the Signature block before the closing tag of the root element
-	root := doc.Root()
-	if root == nil {
-		return nil, fmt.Errorf("invalid XML: root element not found")
+	cert, err := ciscert.responseSigner(xmlData)
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrResponseSignature, err)
 	}
-
-	referenceID := root.SelectAttrValue("Id", "")
-	if referenceID == "" {
-		return nil, fmt.Errorf("no Id attribute found in the root element")
+	if cert != ciscert.PublicCert {
+		fe.log(lifecycleLevel, "CIS response signed by a renewed CIS certificate, update the CIS certificate",
+			slog.String("serial", cert.SerialNumber.String()), slog.Time("valid_until", cert.NotAfter))
 	}
-
-	// Canonicalize the XML document
-	xmlCanonical, err := doc14n(xmlRequest)
-	if err != nil {
-		return nil, fmt.Errorf("failed to canonicalize XML document: %v", err)
+	verify := sign.VerifyEnvelope
+	if fe.responseVerifier != nil {
+		verify = fe.responseVerifier.VerifyResponse
 	}
-
-	// DigestValue calculation using SHA-1
-	digest := sha1.New()
-	if _, err := digest.Write([]byte(xmlCanonical)); err != nil {
-		return nil, fmt.Errorf("failed to calculate digest: %v", err)
+	if err := verify(xmlData, cert); err != nil {
+		return false, fmt.Errorf("%w: %v", ErrResponseSignature, err)
 	}
-	digestValue := base64.StdEncoding.EncodeToString(digest.Sum(nil))
-
-	// Step 2: Create SignedInfo block with DigestValue using etree
-	signedInfoElement := createSignedInfoElement(referenceID, digestValue)
+	return true, nil
+}
 
-	// Convert the SignedInfo element to a string
-	signedInfoDocument := etree.NewDocument()
-	signedInfoDocument.SetRoot(signedInfoElement)
-	signedInfoString, err := signedInfoDocument.WriteToBytes()
-	if err != nil {
-		return nil, fmt.Errorf("failed to serialize SignedInfo: %v", err)
+// responseSigner returns the certificate to verify the CIS response with. The certificate in the KeyInfo of
+// the signature must be the CIS certificate, or a renewed CIS certificate (the same subject) issued by the CIS CA,
+// so CIS can rotate its certificate before the library is updated. Any other certificate is rejected.
+// Without a KeyInfo certificate the response is verified with the CIS certificate.
+func (c *signatureCheckCIScert) responseSigner(xmlData []byte) (*x509.Certificate, error) {
+	signature, err := sign.EnvelopeSignature(xmlData)
+	if err != nil || signature == nil {
+		// The verification reports the invalid structure
+		return c.PublicCert, nil
 	}
-
-	// Canonicalize the SignedInfo block
-	canonicalizedSignedInfo, err := doc14n(signedInfoString)
+	cert, err := sign.KeyInfoCertificate(signature)
 	if err != nil {
-		return nil, fmt.Errorf("failed to canonicalize SignedInfo: %v", err)
+		return nil, err
 	}
-
-	// Step 3: Compute hash of canonicalized SignedInfo
-	hashedSignedInfo := sha1.Sum(canonicalizedSignedInfo)
-
-	// Step 4: Generate the SignatureValue using the private key
-	signature, err := rsa.SignPKCS1v15(nil, fe.cert.privateKey, crypto.SHA1, hashedSignedInfo[:])
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate signature: %v", err)
+	if cert == nil || cert.Equal(c.PublicCert) {
+		return c.PublicCert, nil
 	}
-	signatureValue := base64.StdEncoding.EncodeToString(signature)
-
-	// Step 5: Build the Signature block with certificate details using etree
-	signatureBlock := createSignatureElement(
-		signedInfoElement,
-		signatureValue,
-		fe.cert.publicCert,
-	)
-
-	root.AddChild(signatureBlock)
+	if bytes.Equal(cert.RawSubject, c.PublicCert.RawSubject) && c.SSLverifyPoll != nil {
+		opts := x509.VerifyOptions{
+			Roots:     c.SSLverifyPoll,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		}
+		if _, err := cert.Verify(opts); err == nil {
+			return cert, nil
+		}
+	}
+	return nil, fmt.Errorf("response signed by an unknown certificate (subject %s, serial %s)", cert.Subject, cert.SerialNumber)
+}
 
-	// Serialize the updated document back to bytes
-	output, err := doc.WriteToBytes()
-	if err != nil {
-		return nil, fmt.Errorf("failed to serialize signed XML: %v", err)
+// SignXML signs the XML document with the entity certificate the same way as the fiscalization requests:
+// an enveloped signature (exclusive C14N, SHA-1 digest, RSA-SHA1 or ECDSA-SHA1) of the root element, referenced
+// by its Id attribute, with the certificate in the KeyInfo. Use it for other XML documents for the Tax
+// Administration, e.g. archival copies, the root element must have an Id attribute.
+func (fe *FiskalEntity) SignXML(xmlData []byte) ([]byte, error) {
+	if fe == nil {
+		return nil, errors.New("entity is nil")
 	}
+	return fe.signXML(xmlData)
+}
 
-	return output, nil
+// VerifyXML verifies the enveloped XML signature of the document root element (referenced by its Id) with the
+// certificate. The certificate in the KeyInfo of the signature is ignored, only the given certificate is trusted.
+func VerifyXML(xmlData []byte, cert *x509.Certificate) error {
+	return sign.Verify(xmlData, cert)
 }
 
-// verifyXML is currently a placeholder function for verifying signed XML documents.
-// It always returns true without performing any actual verification and should not be used in production environments
-// until proper XML signature verification is fully implemented.
-//
-// The primary challenge is the absence of a reliable pure Go implementation for the Canonicalization Method
-// (http://www.w3.org/TR/2001/REC-xml-c14n-20010315). Several libraries were evaluated, but all encountered subtle
-// issues during implementation. Without a robust xml canonicalization solution, xml signature verification is not possible.
-//
-// While the library supports Exclusive Canonicalization (http://www.w3.org/2001/10/xml-exc-c14n#), which suffices
-// for signing requests, the Croatian CIS system's responses use non-exclusive canonicalization, preventing verification at this time.
-//
-// This limitation will remain unresolved until a suitable library is found or a custom implementation is built,
-// or until fixes are contributed and merged into existing libraries.
-func (fe *FiskalEntity) verifyXML(xmlData []byte) (bool, error) {
-	return true, nil
+// VerifyXMLSigner verifies the enveloped XML signature of the document root element with the certificate from
+// the KeyInfo of the signature and returns the certificate. The signature only proves the document was signed
+// with the key of the returned certificate, check that the certificate is trusted, e.g. with VerifyFinaCertificate.
+func VerifyXMLSigner(xmlData []byte) (*x509.Certificate, error) {
+	return sign.VerifySigner(xmlData)
 }
@@ -0,0 +1,412 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/l-d-t/fiskalhrgo/etreeutils"
+	"github.com/l-d-t/fiskalhrgo/sign"
+)
+
+const testCISResponse = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><tns:RacunOdgovor xmlns:tns="http://www.apis-it.hr/fin/2012/types/f73" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" Id="%s">
+	<tns:Zaglavlje><tns:IdPoruke>%s</tns:IdPoruke><tns:DatumVrijeme>%s</tns:DatumVrijeme></tns:Zaglavlje>
+	<tns:Jir>%s</tns:Jir>
+</tns:RacunOdgovor></soap:Body></soap:Envelope>`
+
+// signTestCISResponse signs the message in the SOAP Body like CIS does, with the canonicalization algorithm
+func signTestCISResponse(t testing.TB, key *rsa.PrivateKey, envelope string, canonicalizer Canonicalizer) string {
+	t.Helper()
+	signed, err := signCISResponse(key, envelope, canonicalizer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// signCISResponse signs the message in the SOAP Body like CIS does, it is used outside of the tests too (TestMain)
+func signCISResponse(key *rsa.PrivateKey, envelope string, canonicalizer Canonicalizer) (string, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(envelope); err != nil {
+		return "", err
+	}
+	body := doc.Root().SelectElement("Body")
+	if body == nil || len(body.ChildElements()) == 0 {
+		return "", errors.New("no message in the SOAP Body")
+	}
+	message := body.ChildElements()[0]
+
+	canonicalize := func(el *etree.Element) ([]byte, error) {
+		if canonicalizer.Algorithm() == CanonicalXML10RecAlgorithmId {
+			// The inclusive canonicalizer takes the namespaces declared on the ancestors itself
+			return canonicalizer.Canonicalize(el)
+		}
+		ctx, err := etreeutils.NSBuildParentContext(el)
+		if err != nil {
+			return nil, err
+		}
+		detached, err := etreeutils.NSDetatch(ctx, el)
+		if err != nil {
+			return nil, err
+		}
+		return canonicalizer.Canonicalize(detached)
+	}
+	canonical, err := canonicalize(message)
+	if err != nil {
+		return "", err
+	}
+	digest := sha1.Sum(canonical)
+
+	signature := message.CreateElement("Signature")
+	signature.CreateAttr("xmlns", Namespace)
+	signedInfo := signature.CreateElement("SignedInfo")
+	signedInfo.CreateElement("CanonicalizationMethod").CreateAttr("Algorithm", string(canonicalizer.Algorithm()))
+	signedInfo.CreateElement("SignatureMethod").CreateAttr("Algorithm", RSASHA1SignatureMethod)
+	reference := signedInfo.CreateElement("Reference")
+	reference.CreateAttr("URI", "#"+message.SelectAttrValue("Id", ""))
+	transforms := reference.CreateElement("Transforms")
+	transforms.CreateElement("Transform").CreateAttr("Algorithm", string(EnvelopedSignatureAltorithmId))
+	transforms.CreateElement("Transform").CreateAttr("Algorithm", string(canonicalizer.Algorithm()))
+	reference.CreateElement("DigestMethod").CreateAttr("Algorithm", "http://www.w3.org/2000/09/xmldsig#sha1")
+	reference.CreateElement("DigestValue").SetText(base64.StdEncoding.EncodeToString(digest[:]))
+
+	canonicalSignedInfo, err := canonicalize(signedInfo)
+	if err != nil {
+		return "", err
+	}
+	hashed := sha1.Sum(canonicalSignedInfo)
+	signatureValue, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA1, hashed[:])
+	if err != nil {
+		return "", err
+	}
+	signature.CreateElement("SignatureValue").SetText(base64.StdEncoding.EncodeToString(signatureValue))
+	return doc.WriteToString()
+}
+
+func newTestCISSigningCert(t testing.TB) (*rsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+	key, cert, err := newCISSigningCert(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, cert
+}
+
+// newCISSigningCert creates a self-signed certificate standing in for the CIS one, valid for the duration
+func newCISSigningCert(valid time.Duration) (*rsa.PrivateKey, *x509.Certificate, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "fiskalcistest"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(valid),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, cert, nil
+}
+
+func TestVerifyEnvelopedSignature(t *testing.T) {
+	key, cert := newTestCISSigningCert(t)
+	otherKey, _ := newTestCISSigningCert(t)
+	response := fmt.Sprintf(testCISResponse, "G0x1", "f81d4fae-7dec-11d0-a765-00a0c91e6bf6", "01.01.2026T10:00:00", "9d6f5bb6-da48-4fcd-a803-4586a025e0e4")
+
+	for _, canonicalizer := range []Canonicalizer{MakeC14N10RecCanonicalizer(), MakeC14N10ExclusiveCanonicalizerWithPrefixList("")} {
+		signed := signTestCISResponse(t, key, response, canonicalizer)
+		if err := sign.VerifyEnvelope([]byte(signed), cert); err != nil {
+			t.Errorf("%s: expected a valid signature, got %v", canonicalizer.Algorithm(), err)
+		}
+	}
+
+	signed := signTestCISResponse(t, key, response, MakeC14N10RecCanonicalizer())
+	wrapped := strings.Replace(signed, "<soap:Body>", `<soap:Body><tns:RacunOdgovor xmlns:tns="http://www.apis-it.hr/fin/2012/types/f73"><tns:Jir>00000000-0000-0000-0000-000000000000</tns:Jir></tns:RacunOdgovor>`, 1)
+	for name, invalid := range map[string]string{
+		"unsigned":       response,
+		"modified JIR":   strings.Replace(signed, "9d6f5bb6", "00000000", 1),
+		"other key":      signTestCISResponse(t, otherKey, response, MakeC14N10RecCanonicalizer()),
+		"wrapped":        wrapped,
+		"wrong Id":       strings.Replace(signed, `Id="G0x1"`, `Id="G0x2"`, 1),
+		"no SOAP Body":   `<RacunOdgovor Id="G0x1"/>`,
+		"invalid base64": strings.Replace(signed, "<SignatureValue>", "<SignatureValue>!", 1),
+	} {
+		if err := sign.VerifyEnvelope([]byte(invalid), cert); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestInvoiceRequestVerifiesResponseSignature(t *testing.T) {
+	key, cert := newTestCISSigningCert(t)
+	var signedResponse bool
+	fe := newTestServerEntity(t, func(w http.ResponseWriter, r *http.Request) {
+		doc := etree.NewDocument()
+		if _, err := doc.ReadFrom(r.Body); err != nil {
+			t.Error(err)
+			return
+		}
+		idPoruke := doc.FindElement("//IdPoruke").Text()
+		response := fmt.Sprintf(testCISResponse, "G0x1", idPoruke, doc.FindElement("//DatumVrijeme").Text(), "9d6f5bb6-da48-4fcd-a803-4586a025e0e4")
+		if signedResponse {
+			response = signTestCISResponse(t, key, response, MakeC14N10RecCanonicalizer())
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprint(w, response)
+	})
+	fe.ciscert = newSignatureCheckCIScert(cert, fe.ciscert.SSLverifyPoll)
+
+	invoice, _, err := fe.NewCISInvoice(time.Now(), 1, 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "10.00", CISCash, "12345678901")
+	if err != nil {
+		t.Fatalf("Failed to create invoice: %v", err)
+	}
+
+	// A spoofed JIR without the CIS signature is rejected
+	jir, _, err := invoice.InvoiceRequest()
+	var fErr *FiskalError
+	if !errors.Is(err, ErrResponseSignature) || !errors.As(err, &fErr) || fErr.Category != CategoryOutcomeUnknown || jir != "" {
+		t.Fatalf("Expected ErrResponseSignature, got %s, %v", jir, err)
+	}
+
+	signedResponse = true
+	if jir, _, err = invoice.InvoiceRequest(); err != nil || jir != "9d6f5bb6-da48-4fcd-a803-4586a025e0e4" {
+		t.Fatalf("Expected the JIR from the signed response, got %s, %v", jir, err)
+	}
+}
+
+func TestStrictResponseVerification(t *testing.T) {
+	unsigned := func(w http.ResponseWriter, r *http.Request) {
+		doc := etree.NewDocument()
+		if _, err := doc.ReadFrom(r.Body); err != nil {
+			t.Error(err)
+			return
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprintf(w, testCISResponse, "G0x1", doc.FindElement("//IdPoruke").Text(), doc.FindElement("//DatumVrijeme").Text(), "9d6f5bb6-da48-4fcd-a803-4586a025e0e4")
+	}
+	unsignedErrors := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><tns:RacunOdgovor xmlns:tns="http://www.apis-it.hr/fin/2012/types/f73" Id="G0x1"><tns:Greske><tns:Greska><tns:SifraGreske>s006</tns:SifraGreske><tns:PorukaGreske>Sistemska pogreška</tns:PorukaGreske></tns:Greska></tns:Greske></tns:RacunOdgovor></soap:Body></soap:Envelope>`)
+	}
+	newInvoice := func(fe *FiskalEntity) *RacunType {
+		invoice, _, err := fe.NewCISInvoice(time.Now(), 1, 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "10.00", CISCash, "12345678901")
+		if err != nil {
+			t.Fatalf("Failed to create invoice: %v", err)
+		}
+		return invoice
+	}
+
+	// Strict by default, the errors of an unsigned response are not trusted either
+	fe := newTestServerEntity(t, unsignedErrors)
+	if _, _, err := newInvoice(fe).InvoiceRequest(); !errors.Is(err, ErrResponseSignature) || errors.Is(err, ErrCISSystemError) {
+		t.Errorf("Expected ErrResponseSignature for unsigned errors, got %v", err)
+	}
+
+	fe = newTestServerEntity(t, unsignedErrors)
+	fe.unverifiedResponses = true
+	if _, _, err := newInvoice(fe).InvoiceRequest(); !errors.Is(err, ErrCISSystemError) {
+		t.Errorf("Expected the CIS error when not strict, got %v", err)
+	}
+
+	fe = newTestServerEntity(t, unsigned)
+	fe.unverifiedResponses = true
+	result, err := newInvoice(fe).InvoiceRequestResult()
+	if err != nil || result.JIR != "9d6f5bb6-da48-4fcd-a803-4586a025e0e4" {
+		t.Fatalf("Expected the unverified JIR to be accepted when not strict, got %+v, %v", result, err)
+	}
+	if len(result.Warnings) == 0 || !strings.Contains(result.Warnings[0], "without a valid signature") {
+		t.Errorf("Expected a warning about the unverified response, got %v", result.Warnings)
+	}
+}
+
+func TestSignAndVerifyXML(t *testing.T) {
+	fe := newTestEntity(t)
+	cert := fe.certificate().publicCert
+	document := `<arhiva:Dokument xmlns:arhiva="urn:example:arhiva" Id="doc-1"><arhiva:Naziv>Račun 1/P1/1</arhiva:Naziv><arhiva:Iznos>125.00</arhiva:Iznos></arhiva:Dokument>`
+
+	signed, err := fe.SignXML([]byte(document))
+	if err != nil {
+		t.Fatalf("SignXML failed: %v", err)
+	}
+	if err := VerifyXML(signed, cert); err != nil {
+		t.Errorf("expected a valid signature, got %v", err)
+	}
+	signer, err := VerifyXMLSigner(signed)
+	if err != nil {
+		t.Fatalf("VerifyXMLSigner failed: %v", err)
+	}
+	if !signer.Equal(cert) {
+		t.Error("expected the signing certificate from the KeyInfo")
+	}
+
+	_, otherCert := newTestCISSigningCert(t)
+	if err := VerifyXML(signed, otherCert); err == nil {
+		t.Error("expected an error for the wrong certificate")
+	}
+	tampered := []byte(strings.Replace(string(signed), "125.00", "1.00", 1))
+	if err := VerifyXML(tampered, cert); err == nil {
+		t.Error("expected an error for a modified document")
+	}
+	if _, err := VerifyXMLSigner(tampered); err == nil {
+		t.Error("expected an error for a modified document")
+	}
+	if err := VerifyXML([]byte(document), cert); err == nil {
+		t.Error("expected an error for an unsigned document")
+	}
+	if _, err := fe.SignXML([]byte(`<Dokument/>`)); err == nil {
+		t.Error("expected an error for a document without the Id attribute")
+	}
+}
+
+func TestResponseKeyInfoCertificate(t *testing.T) {
+	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CIS CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, _ := x509.ParseCertificate(caDER)
+	issue := func(serial int64, commonName string, parent *x509.Certificate, parentKey *rsa.PrivateKey) (*rsa.PrivateKey, *x509.Certificate) {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: commonName, Organization: []string{"Ministarstvo financija"}},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		if parent == nil {
+			parent, parentKey = template, key
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, _ := x509.ParseCertificate(der)
+		return key, cert
+	}
+	cisKey, cisCert := issue(2, "fiskalcistest", caCert, caKey)
+	renewedKey, renewedCert := issue(3, "fiskalcistest", caCert, caKey)
+	otherKey, otherCert := issue(4, "fiskal 1", caCert, caKey)
+	selfKey, selfCert := issue(5, "fiskalcistest", nil, nil)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+	fe := newTestEntity(t)
+	fe.ciscert = newSignatureCheckCIScert(cisCert, pool)
+
+	response := fmt.Sprintf(testCISResponse, "G0x1", "f81d4fae-7dec-11d0-a765-00a0c91e6bf6", "01.01.2026T10:00:00", "9d6f5bb6-da48-4fcd-a803-4586a025e0e4")
+	signed := func(key *rsa.PrivateKey, cert *x509.Certificate) []byte {
+		signed := signTestCISResponse(t, key, response, MakeC14N10RecCanonicalizer())
+		if cert != nil {
+			keyInfo := "</SignatureValue><KeyInfo><X509Data><X509Certificate>" + base64.StdEncoding.EncodeToString(cert.Raw) + "</X509Certificate></X509Data></KeyInfo>"
+			signed = strings.Replace(signed, "</SignatureValue>", keyInfo, 1)
+		}
+		return []byte(signed)
+	}
+
+	for name, valid := range map[string][]byte{
+		"CIS certificate":     signed(cisKey, cisCert),
+		"no KeyInfo":          signed(cisKey, nil),
+		"renewed certificate": signed(renewedKey, renewedCert),
+	} {
+		if _, err := fe.verifyXML(valid); err != nil {
+			t.Errorf("%s: expected a valid response, got %v", name, err)
+		}
+	}
+	for name, invalid := range map[string][]byte{
+		"other subject":         signed(otherKey, otherCert),
+		"self-signed":           signed(selfKey, selfCert),
+		"renewed key, CIS cert": signed(renewedKey, cisCert),
+		"no KeyInfo, renewed":   signed(renewedKey, nil),
+	} {
+		if _, err := fe.verifyXML(invalid); !errors.Is(err, ErrResponseSignature) {
+			t.Errorf("%s: expected ErrResponseSignature, got %v", name, err)
+		}
+	}
+}
+
+func TestSignXMLKeepsTheDocument(t *testing.T) {
+	fe := newTestEntity(t)
+	cert := fe.certificate().publicCert
+
+	// The signature is inserted into the original bytes, the rest of the document is unchanged
+	document := "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<tns:RacunZahtjev xmlns:tns=\"http://www.apis-it.hr/fin/2012/types/f73\" Id=\"r1\">\n <tns:Iznos b=\"2\" a=\"1\">10.00</tns:Iznos>\n</tns:RacunZahtjev>\n"
+	signed, err := fe.signXML([]byte(document))
+	if err != nil {
+		t.Fatal(err)
+	}
+	end := strings.LastIndex(document, "</tns:RacunZahtjev>")
+	if !strings.HasPrefix(string(signed), document[:end]+"<Signature") || !strings.HasSuffix(string(signed), document[end:]) {
+		t.Errorf("Expected the signature before the closing tag of the original document, got %s", signed)
+	}
+	if err := VerifyXML(signed, cert); err != nil {
+		t.Errorf("Expected a valid signature, got %v", err)
+	}
+
+	// A self-closing root element is expanded
+	signed, err = fe.signXML([]byte(`<Dokument Id="d1"/>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyXML(signed, cert); err != nil {
+		t.Errorf("Expected a valid signature of the self-closing element, got %v", err)
+	}
+}
+
+func BenchmarkSignXML(b *testing.B) {
+	invoice, _, err := testEntity.NewCISInvoice(time.Now(), 1, 1, [][]interface{}{{"25.00", "1000.00", "250.00"}, {"13.00", "100.00", "13.00"}},
+		nil, nil, "0.00", "0.00", "0.00", nil, "1363.00", CISCash, "12345678901")
+	if err != nil {
+		b.Fatal(err)
+	}
+	data, err := xml.MarshalIndent(RacunZahtjev{Zaglavlje: newFiskalHeader(GenerateID()), Racun: invoice, Xmlns: DefaultNamespace, IdAttr: GenerateID()}, "", " ")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := testEntity.signXML(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/l-d-t/fiskalhrgo/client"
+)
+
+// ErrEInvoiceRejected is returned when the e-invoice intermediary rejects the e-invoice, sending it again
+// won't help until the data is fixed
+var ErrEInvoiceRejected = errors.New("e-invoice rejected by the intermediary")
+
+// EInvoice is a fiscalized invoice forwarded to an e-invoice intermediary
+type EInvoice struct {
+	// Number of the invoice (BrOznRac/OznPosPr/OznNapUr)
+	Number string
+
+	// SellerOIB and BuyerOIB, the buyer OIB is empty if it is not known
+	SellerOIB string
+	BuyerOIB  string
+
+	// JIR and ZKI of the fiscalized invoice
+	JIR string
+	ZKI string
+
+	// Document is the UBL 2.1 invoice, see RacunType.UBL
+	Document []byte
+}
+
+// EInvoiceReceipt is the confirmation of the intermediary that it received the e-invoice
+type EInvoiceReceipt struct {
+	// ID of the e-invoice at the intermediary, empty if the intermediary didn't return one
+	ID string
+
+	// StatusCode is the HTTP status code of the response, 0 for the intermediaries not using HTTP
+	StatusCode int
+
+	// Received is the time the e-invoice was accepted
+	Received time.Time
+
+	// Response is the raw response of the intermediary, for the archive
+	Response []byte
+}
+
+// EInvoiceProvider forwards the e-invoices to an e-invoice intermediary (FINA e-Račun or another information
+// intermediary). Implement it for the intermediary in use, FinaEInvoiceClient is the reference implementation.
+// A rejected e-invoice should be returned as an error wrapping ErrEInvoiceRejected.
+type EInvoiceProvider interface {
+	SendEInvoice(ctx context.Context, einvoice *EInvoice) (*EInvoiceReceipt, error)
+}
+
+// SendEInvoice is the "fiscalize then e-invoice" pipeline in one call: it fiscalizes the invoice if options.JIR
+// is empty (see InvoiceRequestResult, with WithIdempotency an already fiscalized invoice is not sent again),
+// exports it as UBL with the options (see UBL) and forwards it to the provider.
+//
+// The fiscalization errors are returned as they are (*FiskalError). If the invoice is fiscalized but not
+// forwarded, the error doesn't affect the fiscalization, forward it again later with the JIR in options.
+func (invoice *RacunType) SendEInvoice(ctx context.Context, provider EInvoiceProvider, options UBLOptions) (*EInvoiceReceipt, error) {
+	if provider == nil {
+		return nil, errors.New("e-invoice provider is nil")
+	}
+	if invoice == nil || invoice.pointerToEntity == nil {
+		return nil, errors.New("invoice is nil or not created by an entity")
+	}
+	if options.JIR == "" {
+		result, err := invoice.InvoiceRequestResult()
+		if err != nil {
+			return nil, err
+		}
+		options.JIR = result.JIR
+	}
+	document, err := invoice.UBL(options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export the e-invoice: %w", err)
+	}
+	einvoice := &EInvoice{
+		Number:    invoiceNumber(invoice),
+		SellerOIB: invoice.Oib,
+		BuyerOIB:  options.Buyer.OIB,
+		JIR:       options.JIR,
+		ZKI:       invoice.ZastKod,
+		Document:  document,
+	}
+
+	fe := invoice.pointerToEntity
+	attrs := []slog.Attr{slog.String("invoice", einvoice.Number), slog.String("jir", einvoice.JIR)}
+	receipt, err := provider.SendEInvoice(ctx, einvoice)
+	if err != nil {
+		err = fmt.Errorf("failed to forward the e-invoice: %w", err)
+		fe.log(failureLevel, "e-invoice not forwarded", append(attrs, errorAttrs(err)...)...)
+		return nil, fe.redactError(err)
+	}
+	if receipt == nil {
+		receipt = &EInvoiceReceipt{Received: time.Now()}
+	}
+	fe.log(successLevel, "e-invoice forwarded", append(attrs, slog.String("id", receipt.ID))...)
+	return receipt, nil
+}
+
+// defaultMaxEInvoiceResponseSize limits the response body read by FinaEInvoiceClient
+const defaultMaxEInvoiceResponseSize = 1 << 20
+
+// FinaEInvoiceClient is the reference EInvoiceProvider for the FINA e-Račun service. It posts the UBL document
+// to the Endpoint with the Client, which has to be configured for the authentication required by the service
+// (usually the TLS client certificate issued by FINA for the e-Račun, not the fiscal certificate).
+//
+// The client is provisional: the message format of the FINA service is agreed in the service contract, so the
+// client sends the bare UBL document and the parsing of the receipt is left to ParseReceipt. Use the Header to add
+// the headers required by the contract and ParseReceipt to read the ID of the e-invoice from the response.
+type FinaEInvoiceClient struct {
+	// Endpoint is the HTTPS address of the service
+	Endpoint string
+
+	// Client sends the requests, http.DefaultClient if nil
+	Client *http.Client
+
+	// Header are the extra headers of every request
+	Header http.Header
+
+	// ParseReceipt reads the receipt from a successful (2xx) response. If nil, any 2xx response is a receipt
+	// without the ID, with the response body in Response.
+	ParseReceipt func(statusCode int, header http.Header, body []byte) (*EInvoiceReceipt, error)
+}
+
+// NewFinaEInvoiceClient returns the client for the HTTPS endpoint of the FINA e-Račun service
+func NewFinaEInvoiceClient(endpoint string, client *http.Client) (*FinaEInvoiceClient, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("invalid e-Račun endpoint %q, an https URL is required", endpoint)
+	}
+	return &FinaEInvoiceClient{Endpoint: endpoint, Client: client}, nil
+}
+
+// SendEInvoice posts the UBL document of the e-invoice. A 4xx response is returned as ErrEInvoiceRejected,
+// other failures can be retried.
+func (c *FinaEInvoiceClient) SendEInvoice(ctx context.Context, einvoice *EInvoice) (*EInvoiceReceipt, error) {
+	if einvoice == nil || len(einvoice.Document) == 0 {
+		return nil, errors.New("e-invoice document is empty")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Endpoint, bytes.NewReader(einvoice.Document))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the request: %w", err)
+	}
+	for key, values := range c.Header {
+		req.Header[key] = append([]string(nil), values...)
+	}
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+
+	httpClient := c.Client
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send the e-invoice: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := client.ReadLimited(resp.Body, resp.ContentLength, defaultMaxEInvoiceResponseSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the response: %w", err)
+	}
+	if int64(len(body)) > defaultMaxEInvoiceResponseSize {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrResponseTooLarge, defaultMaxEInvoiceResponseSize)
+	}
+
+	switch {
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests:
+		return nil, fmt.Errorf("%w: status %d: %s", ErrEInvoiceRejected, resp.StatusCode, responseSnippet(body))
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return nil, fmt.Errorf("unexpected e-Račun response status %d: %s", resp.StatusCode, responseSnippet(body))
+	}
+	if c.ParseReceipt != nil {
+		return c.ParseReceipt(resp.StatusCode, resp.Header, body)
+	}
+	return &EInvoiceReceipt{StatusCode: resp.StatusCode, Received: time.Now(), Response: body}, nil
+}
+
+// responseSnippet returns the beginning of the response body for the error messages
+func responseSnippet(body []byte) string {
+	const maxSnippet = 200
+	snippet := strings.TrimSpace(string(body))
+	if len(snippet) > maxSnippet {
+		snippet = strings.ToValidUTF8(snippet[:maxSnippet], "") + "..."
+	}
+	return snippet
+}
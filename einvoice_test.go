@@ -0,0 +1,73 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSendEInvoice(t *testing.T) {
+	var received []byte
+	var status int
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Ugovor") != "123" || r.Header.Get("Content-Type") != "application/xml; charset=utf-8" {
+			t.Errorf("Unexpected headers %v", r.Header)
+		}
+		received, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+		w.Write([]byte("ID-42"))
+	}))
+	defer srv.Close()
+
+	if _, err := NewFinaEInvoiceClient("http://example.com", nil); err == nil {
+		t.Error("Expected an error for a plain HTTP endpoint")
+	}
+	client, err := NewFinaEInvoiceClient(srv.URL, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Header = http.Header{"X-Ugovor": {"123"}}
+	client.ParseReceipt = func(statusCode int, header http.Header, body []byte) (*EInvoiceReceipt, error) {
+		return &EInvoiceReceipt{ID: string(body), StatusCode: statusCode, Received: time.Now()}, nil
+	}
+
+	fe := newTestEntity(t)
+	invoice, _, err := fe.NewCISInvoice(time.Now(), 3, 1, [][]interface{}{{"25.00", "8.00", "2.00"}}, nil, nil, "0.00", "0.00", "0.00", nil, "10.00", CISBankTransfer, "12345678901")
+	if err != nil {
+		t.Fatalf("Failed to create invoice: %v", err)
+	}
+	options := UBLOptions{JIR: "9d6f5bb6-da48-4fcd-a803-4586a025e0e4", Seller: UBLParty{Name: "Prodavatelj d.o.o."}, Buyer: UBLParty{Name: "Kupac d.o.o."}}
+
+	status = http.StatusCreated
+	receipt, err := invoice.SendEInvoice(context.Background(), client, options)
+	if err != nil || receipt.ID != "ID-42" || receipt.StatusCode != http.StatusCreated {
+		t.Fatalf("Unexpected receipt %+v, %v", receipt, err)
+	}
+	if expected, _ := invoice.UBL(options); string(received) != string(expected) {
+		t.Error("Expected the UBL document to be sent")
+	}
+
+	status = http.StatusBadRequest
+	if _, err := invoice.SendEInvoice(context.Background(), client, options); !errors.Is(err, ErrEInvoiceRejected) {
+		t.Errorf("Expected ErrEInvoiceRejected, got %v", err)
+	}
+	status = http.StatusServiceUnavailable
+	if _, err := invoice.SendEInvoice(context.Background(), client, options); err == nil || errors.Is(err, ErrEInvoiceRejected) {
+		t.Errorf("Expected a retriable error, got %v", err)
+	}
+
+	// Nothing is sent for an invoice that can't be exported
+	received = nil
+	options.Buyer.Name = ""
+	if _, err := invoice.SendEInvoice(context.Background(), client, options); err == nil || received != nil {
+		t.Errorf("Expected an export error, got %v", err)
+	}
+}
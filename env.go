@@ -0,0 +1,79 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// DefaultEnvPrefix is the prefix of the environment variables read by NewFiskalEntityFromEnv when no prefix is given
+const DefaultEnvPrefix = "FISKALHR_"
+
+// NewFiskalEntityFromEnv creates a FiskalEntity from environment variables, so containerized deployments can pass
+// the certificate as a secret without writing it to disk. The variables (with the prefix, FISKALHR_ by default):
+//
+//   - CERT_P12_BASE64: the P12 certificate encoded in base64 (base64 -w 0 fiskal.p12), or
+//   - CERT_PATH: the path to the P12 certificate, used when CERT_P12_BASE64 is not set
+//   - CERT_PASSWORD: the certificate password
+//   - OIB: the taxpayer's OIB
+//   - LOCATION: the business location ID
+//   - VAT: the entity is in the VAT system, true by default
+//   - CENTRALIZED: the invoice numbers are centralized per location, true by default
+//   - DEMO: use the demo CIS environment, false by default
+//   - ALLOW_EXPIRED: allow an expired certificate, false by default
+//   - ALLOW_UNTRUSTED_CERT: allow a certificate not issued by FINA (test certificates), false by default
+//   - CERT_HISTORICAL_<n>_...: older certificates, see NewEnvCertProvider
+//   - CIS_CERT_PATH: the PEM chain of the CIS certificate overriding the embedded one, see SetCISCertificatePEM
+//   - DEBUG_DUMP_DIR: the directory of the debug dump, disabled if empty, see SetDebugDump
+//
+// The boolean values are parsed with strconv.ParseBool ("1", "true", "0", "false"...).
+func NewFiskalEntityFromEnv(prefix string) (*FiskalEntity, error) {
+	if prefix == "" {
+		prefix = DefaultEnvPrefix
+	}
+	env := func(name string) string {
+		return os.Getenv(prefix + name)
+	}
+
+	var flags [5]bool
+	for i, opt := range []struct {
+		name string
+		def  bool
+	}{{"VAT", true}, {"CENTRALIZED", true}, {"DEMO", false}, {"ALLOW_EXPIRED", false}, {"ALLOW_UNTRUSTED_CERT", false}} {
+		value, err := envBool(env(opt.name), opt.def)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s%s: %w", prefix, opt.name, err)
+		}
+		flags[i] = value
+	}
+	vat, centralized, demo, allowExpired, allowUntrusted := flags[0], flags[1], flags[2], flags[3], flags[4]
+
+	provider, err := NewEnvCertProvider(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewFiskalEntityWithOptions(env("OIB"),
+		WithVAT(vat),
+		WithLocation(env("LOCATION")),
+		WithCentralizedInvoiceNumber(centralized),
+		WithDemoMode(demo),
+		WithExpiredCheck(!allowExpired),
+		WithChainVerification(!allowUntrusted),
+		WithCertProvider(provider),
+		WithCISCertificateFile(env("CIS_CERT_PATH")),
+		WithDebugDump(env("DEBUG_DUMP_DIR")),
+	)
+}
+
+// envBool parses a boolean environment variable, def is returned for an empty value
+func envBool(value string, def bool) (bool, error) {
+	if value == "" {
+		return def, nil
+	}
+	return strconv.ParseBool(value)
+}
@@ -0,0 +1,49 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestNewFiskalEntityFromEnv(t *testing.T) {
+	const prefix = "FISKALHRGO_ENV_TEST_"
+	t.Setenv(prefix+"CERT_P12_BASE64", os.Getenv("CIS_P12_BASE64"))
+	t.Setenv(prefix+"CERT_PASSWORD", certPassword)
+	t.Setenv(prefix+"OIB", testOIB)
+	t.Setenv(prefix+"LOCATION", "ENV1")
+	t.Setenv(prefix+"VAT", "false")
+	t.Setenv(prefix+"DEMO", "1")
+
+	entity, err := NewFiskalEntityFromEnv(prefix)
+	if err != nil {
+		t.Fatalf("Failed to create entity from environment: %v", err)
+	}
+	if entity.OIB() != testOIB || entity.LocationID() != "ENV1" || entity.SustPDV() || !entity.CentralizedInvoiceNumber() || !entity.DemoMode() {
+		t.Errorf("Unexpected entity settings")
+	}
+	if entity.GetCertSERIAL() != testEntity.GetCertSERIAL() {
+		t.Errorf("Expected the same certificate as the test entity")
+	}
+
+	t.Setenv(prefix+"DEMO", "maybe")
+	if _, err := NewFiskalEntityFromEnv(prefix); err == nil || !strings.Contains(err.Error(), prefix+"DEMO") {
+		t.Errorf("Expected invalid DEMO error, got %v", err)
+	}
+	t.Setenv(prefix+"DEMO", "true")
+
+	t.Setenv(prefix+"CERT_P12_BASE64", "")
+	t.Setenv(prefix+"CERT_PATH", certPath)
+	if _, err := NewFiskalEntityFromEnv(prefix); err != nil {
+		t.Errorf("Failed to create entity from the certificate path: %v", err)
+	}
+
+	t.Setenv(prefix+"CERT_PATH", "")
+	if _, err := NewFiskalEntityFromEnv(prefix); err == nil {
+		t.Errorf("Expected error without certificate")
+	}
+}
@@ -0,0 +1,186 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import "strings"
+
+// Language of the messages produced by the library
+type Language string
+
+const (
+	LangHR Language = "hr" // Croatian (default, the language of CIS)
+	LangEN Language = "en" // English
+)
+
+// IsValid checks if the language is supported
+func (l Language) IsValid() bool {
+	return l == LangHR || l == LangEN
+}
+
+// CISErrorAction is the suggested reaction to a CIS error
+type CISErrorAction string
+
+const (
+	// CISActionFixData means the invoice data must be corrected before sending it again
+	CISActionFixData CISErrorAction = "fix_data"
+
+	// CISActionRenewCertificate means the fiscal certificate must be renewed or replaced
+	CISActionRenewCertificate CISErrorAction = "renew_certificate"
+
+	// CISActionCheckSetup means the setup of the application is wrong (the certificate used, the signing),
+	// the same request will fail until it is fixed
+	CISActionCheckSetup CISErrorAction = "check_setup"
+
+	// CISActionRetryLater means the request can be sent again later unchanged, the invoice stays valid with the ZKI
+	CISActionRetryLater CISErrorAction = "retry_later"
+)
+
+// CISErrorInfo describes a CIS error code from the knowledge base of the library
+type CISErrorInfo struct {
+	// Code is the CIS error code, e.g. "s004"
+	Code string
+
+	// DescriptionHR and DescriptionEN are the short descriptions of the error in Croatian and English
+	DescriptionHR string
+	DescriptionEN string
+
+	// HintHR and HintEN are the remediation hints, empty if there are none
+	HintHR string
+	HintEN string
+
+	// Action is the suggested reaction, empty if it is not known
+	Action CISErrorAction
+}
+
+// Description returns the description in the language, Croatian for an unsupported language
+func (i CISErrorInfo) Description(lang Language) string {
+	if lang == LangEN {
+		return i.DescriptionEN
+	}
+	return i.DescriptionHR
+}
+
+// Hint returns the remediation hint in the language, Croatian for an unsupported language
+func (i CISErrorInfo) Hint(lang Language) string {
+	if lang == LangEN {
+		return i.HintEN
+	}
+	return i.HintHR
+}
+
+// LookupCISError returns the description, the hint and the suggested action of a CIS error code, e.g. to show
+// them to the user or to decide whether to queue the invoice. The codes are matched case insensitive. For a code
+// that is not in the knowledge base the description of its series is returned (v: data validation, p: later
+// changes, s: system) with ok set to false, CIS adds its own message (PorukaGreske) to every error anyway.
+func LookupCISError(code string) (info CISErrorInfo, ok bool) {
+	code = strings.ToLower(strings.TrimSpace(code))
+	info, ok = cisErrorCatalog[code]
+	if !ok && code != "" {
+		info = cisSeriesCatalog[code[:1]]
+	}
+	info.Code = code
+	return info, ok
+}
+
+// cisErrorCatalog is the knowledge base of the CIS error codes from the CIS technical specification.
+// The data validation codes (v series) are covered by their series, CIS describes the wrong field in the message.
+var cisErrorCatalog = map[string]CISErrorInfo{
+	"s001": {
+		DescriptionHR: "Poruka nije u skladu s XML shemom",
+		DescriptionEN: "The message does not conform to the XML schema",
+		HintHR:        "provjerite format i obavezne podatke računa",
+		HintEN:        "check the invoice data format and the mandatory fields",
+		Action:        CISActionFixData,
+	},
+	"s002": {
+		DescriptionHR: "Certifikat nije izdan od strane FINA RDC CA ili je istekao ili je ukinut",
+		DescriptionEN: "The certificate is not issued by FINA RDC CA, or it is expired or revoked",
+		HintHR:        "obnovite ili zamijenite fiskalni certifikat",
+		HintEN:        "renew or replace the fiscal certificate",
+		Action:        CISActionRenewCertificate,
+	},
+	"s003": {
+		DescriptionHR: "Certifikat ne sadrži naziv 'Fiskal'",
+		DescriptionEN: "The certificate is not a fiscal certificate (the name does not contain 'Fiskal')",
+		HintHR:        "koristite fiskalni certifikat, a ne neki drugi FINA certifikat",
+		HintEN:        "use the fiscal certificate, not another FINA certificate",
+		Action:        CISActionCheckSetup,
+	},
+	"s004": {
+		DescriptionHR: "Neispravan digitalni potpis",
+		DescriptionEN: "Invalid digital signature",
+		HintHR:        "provjerite da poruka nije mijenjana nakon potpisivanja i da se koristi ispravan certifikat",
+		HintEN:        "make sure the message is not modified after signing and the right certificate is used",
+		Action:        CISActionCheckSetup,
+	},
+	"s005": {
+		DescriptionHR: "OIB iz poruke zahtjeva nije jednak OIB-u iz certifikata",
+		DescriptionEN: "The OIB in the request does not match the OIB in the certificate",
+		HintHR:        "koristite certifikat izdan za OIB obveznika na računu",
+		HintEN:        "use the certificate issued for the OIB of the taxpayer on the invoice",
+		Action:        CISActionCheckSetup,
+	},
+	"s006": {
+		DescriptionHR: "Sistemska pogreška prilikom obrade zahtjeva",
+		DescriptionEN: "System error on the CIS side while processing the request",
+		HintHR:        "pokušajte ponovno kasnije, račun ostaje valjan sa ZKI",
+		HintEN:        "retry later, the invoice stays valid with the ZKI",
+		Action:        CISActionRetryLater,
+	},
+	"s007": {
+		DescriptionHR: "Neispravan datum i vrijeme izdavanja računa",
+		DescriptionEN: "Invalid invoice issue date and time",
+		HintHR:        "provjerite sat uređaja i oznaku naknadne dostave",
+		HintEN:        "check the device clock and the late delivery flag (NakDost)",
+		Action:        CISActionFixData,
+	},
+}
+
+// cisSeriesCatalog is the fallback description for the codes of a series not in the knowledge base
+var cisSeriesCatalog = map[string]CISErrorInfo{
+	"s": {
+		DescriptionHR: "Sistemska pogreška",
+		DescriptionEN: "System error",
+	},
+	"v": {
+		DescriptionHR: "Pogreška u podacima računa",
+		DescriptionEN: "Invoice data validation error",
+		HintHR:        "ispravite podatke računa",
+		HintEN:        "correct the invoice data",
+		Action:        CISActionFixData,
+	},
+	"p": {
+		DescriptionHR: "Pogreška naknadne promjene računa",
+		DescriptionEN: "Error in a later change of the invoice (payment method or tip)",
+		Action:        CISActionFixData,
+	},
+}
+
+// localizeCISError builds a CISError for the code and the original CIS message in the requested language
+func localizeCISError(code string, original string, lang Language) *CISError {
+	cisErr := &CISError{
+		Code:     code,
+		Message:  original,
+		Original: original,
+	}
+
+	info, known := LookupCISError(code)
+	cisErr.Action = info.Action
+	cisErr.Hint = info.Hint(lang)
+	switch lang {
+	case LangEN:
+		if known {
+			cisErr.Message = info.DescriptionEN
+		} else if info.DescriptionEN != "" {
+			cisErr.Message = info.DescriptionEN + ": " + original
+		}
+	default:
+		if cisErr.Message == "" {
+			cisErr.Message = info.DescriptionHR
+		}
+	}
+
+	return cisErr
+}
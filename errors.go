@@ -0,0 +1,182 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// CISError is a single error returned by CIS in the Greske element of a response.
+//
+// Use errors.Is with the Err* variables below to check for a specific code, for example
+//
+//	if errors.Is(err, fiskalhrgo.ErrInvalidCertificate) { ... }
+//
+// or errors.As to get the code and the original message.
+type CISError struct {
+	// Code is the CIS error code (SifraGreske), e.g. "s004"
+	Code string
+
+	// Message is the error message in the entity language (see SetLanguage).
+	// For Croatian it is the message returned by CIS.
+	Message string
+
+	// Original is the message exactly as returned by CIS (PorukaGreske), always in Croatian
+	Original string
+
+	// Hint is a short remediation hint in the entity language, empty if there is none for the code
+	Hint string
+
+	// Action is the suggested reaction from the knowledge base (see LookupCISError), empty if it is not known
+	Action CISErrorAction
+}
+
+func (e *CISError) Error() string {
+	if e.Hint != "" {
+		return fmt.Sprintf("%s: %s (%s)", e.Code, e.Message, e.Hint)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// Is reports whether the target is a CISError with the same code.
+// A target with a single letter code matches the whole series, e.g. ErrCISValidation matches every v code.
+func (e *CISError) Is(target error) bool {
+	t, ok := target.(*CISError)
+	if !ok || t.Code == "" {
+		return false
+	}
+	if len(t.Code) == 1 {
+		return strings.HasPrefix(strings.ToLower(e.Code), t.Code)
+	}
+	return strings.EqualFold(e.Code, t.Code)
+}
+
+// Series returns the error series letter: "s" for system/security errors,
+// "v" for data validation errors and "p" for errors of the later changes (payment method change, tip).
+func (e *CISError) Series() string {
+	if e.Code == "" {
+		return ""
+	}
+	return strings.ToLower(e.Code[:1])
+}
+
+// Known CIS error codes, see the CIS technical specification for the complete list
+var (
+	// ErrInvalidXMLSchema s001 - the message is not valid according to the XML schema
+	ErrInvalidXMLSchema = &CISError{Code: "s001", Message: "Poruka nije u skladu s XML shemom"}
+
+	// ErrInvalidCertificate s002 - the certificate is not issued by FINA RDC CA, or is expired or revoked
+	ErrInvalidCertificate = &CISError{Code: "s002", Message: "Certifikat nije izdan od strane FINA RDC CA ili je istekao ili je ukinut"}
+
+	// ErrCertificateNotFiskal s003 - the certificate does not contain the name "Fiskal"
+	ErrCertificateNotFiskal = &CISError{Code: "s003", Message: "Certifikat ne sadrži naziv 'Fiskal'"}
+
+	// ErrInvalidSignature s004 - invalid digital signature
+	ErrInvalidSignature = &CISError{Code: "s004", Message: "Neispravan digitalni potpis"}
+
+	// ErrOIBMismatch s005 - the OIB in the message is not equal to the OIB in the certificate
+	ErrOIBMismatch = &CISError{Code: "s005", Message: "OIB iz poruke zahtjeva nije jednak OIB-u iz certifikata"}
+
+	// ErrCISSystemError s006 - system error while processing the request on the CIS side
+	ErrCISSystemError = &CISError{Code: "s006", Message: "Sistemska pogreška prilikom obrade zahtjeva"}
+
+	// ErrInvalidIssueDateTime s007 - the invoice issue date and time is not valid
+	ErrInvalidIssueDateTime = &CISError{Code: "s007", Message: "Neispravan datum i vrijeme izdavanja računa"}
+
+	// ErrCISValidation matches every data validation error (v100 series)
+	ErrCISValidation = &CISError{Code: "v"}
+
+	// ErrCISLaterChange matches every error of the payment method change and tip messages (p series)
+	ErrCISLaterChange = &CISError{Code: "p"}
+)
+
+// CISErrors holds all errors returned by CIS in a single response.
+// errors.Is and errors.As check every contained error.
+type CISErrors []*CISError
+
+func (e CISErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, cisErr := range e {
+		messages[i] = cisErr.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Unwrap returns the contained errors for errors.Is and errors.As
+func (e CISErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, cisErr := range e {
+		errs[i] = cisErr
+	}
+	return errs
+}
+
+// newCISErrors converts the Greske element of a response to CISErrors in the requested language,
+// or returns nil if there are no errors
+func newCISErrors(greske *GreskeType, lang Language) error {
+	var cisErrors CISErrors
+	for _, greska := range greske.Errors() {
+		cisErrors = append(cisErrors, localizeCISError(
+			strings.TrimSpace(greska.SifraGreske),
+			strings.TrimSpace(greska.PorukaGreske),
+			lang,
+		))
+	}
+	if len(cisErrors) == 0 {
+		return nil
+	}
+	return cisErrors
+}
+
+// SOAPFaultError is returned when CIS (or a proxy in front of it) answers with a SOAP Fault
+// instead of a regular response message.
+type SOAPFaultError struct {
+	// Code is the faultcode, e.g. "soap:Server" or "soap:Client"
+	Code string
+
+	// String is the human readable faultstring
+	String string
+
+	// Actor is the optional faultactor
+	Actor string
+
+	// Detail is the raw inner XML of the optional detail element
+	Detail string
+
+	// StatusCode is the HTTP status code of the response
+	StatusCode int
+}
+
+func (e *SOAPFaultError) Error() string {
+	return fmt.Sprintf("SOAP fault %s: %s", e.Code, e.String)
+}
+
+// iSOAPFault represents a SOAP 1.1 Fault element
+type iSOAPFault struct {
+	XMLName xml.Name `xml:"Fault"`
+	Code    string   `xml:"faultcode"`
+	String  string   `xml:"faultstring"`
+	Actor   string   `xml:"faultactor"`
+	Detail  struct {
+		Content string `xml:",innerxml"`
+	} `xml:"detail"`
+}
+
+// parseSOAPFault returns a SOAPFaultError if the SOAP body content is a Fault, otherwise nil
+func parseSOAPFault(content []byte, statusCode int) *SOAPFaultError {
+	var fault iSOAPFault
+	if err := xml.Unmarshal(content, &fault); err != nil {
+		return nil
+	}
+	return &SOAPFaultError{
+		Code:       strings.TrimSpace(fault.Code),
+		String:     strings.TrimSpace(fault.String),
+		Actor:      strings.TrimSpace(fault.Actor),
+		Detail:     strings.TrimSpace(fault.Detail.Content),
+		StatusCode: statusCode,
+	}
+}
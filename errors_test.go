@@ -0,0 +1,260 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSOAPFaultError(t *testing.T) {
+	fe := newTestServerEntity(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault><faultcode>soap:Server</faultcode><faultstring>Internal error</faultstring><detail><code>42</code></detail></soap:Fault></soap:Body></soap:Envelope>`)
+	})
+
+	_, err := fe.EchoRequest("test")
+
+	var fault *SOAPFaultError
+	if !errors.As(err, &fault) {
+		t.Fatalf("Expected SOAPFaultError, got %v", err)
+	}
+	if fault.Code != "soap:Server" {
+		t.Errorf("Expected faultcode soap:Server, got %q", fault.Code)
+	}
+	if fault.String != "Internal error" {
+		t.Errorf("Expected faultstring, got %q", fault.String)
+	}
+	if fault.Detail != "<code>42</code>" {
+		t.Errorf("Expected detail, got %q", fault.Detail)
+	}
+	if fault.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", fault.StatusCode)
+	}
+}
+
+func TestCISErrorsIsAndAs(t *testing.T) {
+	err := fmt.Errorf("errors in response: %w", newCISErrors(&GreskeType{Greska: []*GreskaType{
+		{SifraGreske: "s002", PorukaGreske: "Certifikat nije izdan od strane FINA RDC CA ili je istekao ili je ukinut"},
+		{SifraGreske: "v152", PorukaGreske: "Neispravan OIB operatera"},
+	}}, LangHR))
+
+	if !errors.Is(err, ErrInvalidCertificate) {
+		t.Errorf("Expected errors.Is to match ErrInvalidCertificate")
+	}
+	if !errors.Is(err, ErrCISValidation) {
+		t.Errorf("Expected errors.Is to match the v series")
+	}
+	if errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected errors.Is not to match ErrInvalidSignature")
+	}
+	if errors.Is(err, ErrCISLaterChange) {
+		t.Errorf("Expected errors.Is not to match the p series")
+	}
+
+	var cisErr *CISError
+	if !errors.As(err, &cisErr) {
+		t.Fatalf("Expected errors.As to find a CISError")
+	}
+	if cisErr.Code != "s002" || cisErr.Series() != "s" {
+		t.Errorf("Expected the first error s002, got %s", cisErr.Code)
+	}
+
+	if cisErr.Original != cisErr.Message {
+		t.Errorf("Expected the original CIS message for Croatian, got %q", cisErr.Message)
+	}
+
+	if newCISErrors(nil, LangHR) != nil || newCISErrors(&GreskeType{}, LangHR) != nil {
+		t.Errorf("Expected nil for no errors")
+	}
+}
+
+func TestInvoiceRequestReturnsCISErrors(t *testing.T) {
+	key, cert := newTestCISSigningCert(t)
+	fe := newTestServerEntity(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, signTestCISResponse(t, key, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><tns:RacunOdgovor xmlns:tns="http://www.apis-it.hr/fin/2012/types/f73" Id="G0x1"><tns:Zaglavlje><tns:IdPoruke>x</tns:IdPoruke><tns:DatumVrijeme>01.01.2024T10:00:00</tns:DatumVrijeme></tns:Zaglavlje><tns:Greske><tns:Greska><tns:SifraGreske>s004</tns:SifraGreske><tns:PorukaGreske>Neispravan digitalni potpis.</tns:PorukaGreske></tns:Greska></tns:Greske></tns:RacunOdgovor></soap:Body></soap:Envelope>`, MakeC14N10RecCanonicalizer()))
+	})
+	fe.ciscert = newSignatureCheckCIScert(cert, fe.ciscert.SSLverifyPoll)
+
+	invoice, _, err := fe.NewCISInvoice(time.Now(), 1, 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "10.00", CISCash, "12345678901")
+	if err != nil {
+		t.Fatalf("Failed to create invoice: %v", err)
+	}
+
+	_, _, err = invoice.InvoiceRequest()
+	if !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("Expected ErrInvalidSignature, got %v", err)
+	}
+}
+
+func TestCISErrorsEnglish(t *testing.T) {
+	err := newCISErrors(&GreskeType{Greska: []*GreskaType{
+		{SifraGreske: "s005", PorukaGreske: "OIB iz poruke zahtjeva nije jednak OIB-u iz certifikata."},
+		{SifraGreske: "v999", PorukaGreske: "Nepoznata pogreška"},
+	}}, LangEN)
+
+	var cisErrs CISErrors
+	if !errors.As(err, &cisErrs) || len(cisErrs) != 2 {
+		t.Fatalf("Expected 2 CIS errors, got %v", err)
+	}
+
+	if cisErrs[0].Message != "The OIB in the request does not match the OIB in the certificate" {
+		t.Errorf("Unexpected English message: %q", cisErrs[0].Message)
+	}
+	if cisErrs[0].Hint == "" {
+		t.Errorf("Expected a remediation hint")
+	}
+	if cisErrs[0].Original != "OIB iz poruke zahtjeva nije jednak OIB-u iz certifikata." {
+		t.Errorf("Expected the original message to be kept, got %q", cisErrs[0].Original)
+	}
+
+	// Unknown codes fall back to the series explanation and keep the CIS message
+	if !strings.Contains(cisErrs[1].Message, "Nepoznata pogreška") {
+		t.Errorf("Expected the CIS message for an unknown code, got %q", cisErrs[1].Message)
+	}
+
+	fe := newTestEntity(t)
+	if fe.Language() != LangHR {
+		t.Errorf("Expected Croatian as the default language")
+	}
+	if err := fe.SetLanguage("de"); err == nil {
+		t.Errorf("Expected error for an unsupported language")
+	}
+	if err := fe.SetLanguage(LangEN); err != nil || fe.Language() != LangEN {
+		t.Errorf("Expected English to be set, got %v", err)
+	}
+}
+
+func TestFiskalErrorClassification(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       *FiskalError
+		category  ErrorCategory
+		retriable bool
+	}{
+		{"system only", newCISFiskalError(newCISErrors(&GreskeType{Greska: []*GreskaType{{SifraGreske: "s006"}}}, LangHR), 500), CategoryCISSystem, true},
+		{"certificate", newCISFiskalError(newCISErrors(&GreskeType{Greska: []*GreskaType{{SifraGreske: "s006"}, {SifraGreske: "s002"}}}, LangHR), 500), CategorySignature, false},
+		{"validation", newCISFiskalError(newCISErrors(&GreskeType{Greska: []*GreskaType{{SifraGreske: "v152"}}}, LangHR), 500), CategoryCISValidation, false},
+		{"server fault", newSOAPFaultFiskalError(&SOAPFaultError{Code: "soap:Server", StatusCode: 500}), CategoryCISSystem, true},
+		{"client fault", newSOAPFaultFiskalError(&SOAPFaultError{Code: "soap:Client", StatusCode: 500}), CategoryCISValidation, false},
+		{"not found", &FiskalError{Category: CategoryResponse, StatusCode: 404}, CategoryResponse, false},
+		{"garbled", &FiskalError{Category: CategoryResponse, StatusCode: 200}, CategoryResponse, false},
+		{"garbled by proxy", &FiskalError{Category: CategoryResponse, StatusCode: 502}, CategoryResponse, true},
+		{"outcome unknown", &FiskalError{Category: CategoryOutcomeUnknown, StatusCode: 200}, CategoryOutcomeUnknown, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.err.Category != tt.category {
+				t.Errorf("Expected category %s, got %s", tt.category, tt.err.Category)
+			}
+			if tt.err.Retriable() != tt.retriable {
+				t.Errorf("Expected Retriable %v", tt.retriable)
+			}
+		})
+	}
+
+	wrapped := wrapFiskalError("failed to make request", CategoryTransport, newCISFiskalError(newCISErrors(&GreskeType{Greska: []*GreskaType{{SifraGreske: "s004"}}}, LangHR), 500))
+	if wrapped.Category != CategorySignature || wrapped.Code != "s004" || !errors.Is(wrapped, ErrInvalidSignature) {
+		t.Errorf("Expected the classification to be kept when wrapping, got %+v", wrapped)
+	}
+}
+
+func TestFiskalErrorFromRequests(t *testing.T) {
+	// Nothing listens on the port, so the request fails on the network level
+	fe := newTestEntity(t)
+	fe.url = "https://127.0.0.1:1/FiskalizacijaService"
+	err := fe.PingCIS()
+
+	var fErr *FiskalError
+	if !errors.As(err, &fErr) {
+		t.Fatalf("Expected FiskalError, got %v", err)
+	}
+	if fErr.Category != CategoryTransport || !IsRetriable(err) {
+		t.Errorf("Expected a retriable transport error, got %s", fErr.Category)
+	}
+
+	// The test server certificate is not trusted, so the TLS handshake fails
+	server := httptest.NewTLSServer(http.HandlerFunc(echoHandler))
+	defer server.Close()
+	fe.url = server.URL
+	_, err = fe.EchoRequest("test")
+	if !errors.As(err, &fErr) || fErr.Category != CategoryTLS || IsRetriable(err) {
+		t.Errorf("Expected a TLS error, got %v", err)
+	}
+
+	// Invalid input is detected before sending
+	_, _, err = (&RacunType{}).InvoiceRequest()
+	if !errors.As(err, &fErr) || fErr.Category != CategoryInput {
+		t.Errorf("Expected an input error, got %v", err)
+	}
+}
+
+// TestOutcomeUnknown checks a response that can't be trusted after the request reached CIS is not retried
+func TestOutcomeUnknown(t *testing.T) {
+	key, cert := newTestCISSigningCert(t)
+	fe := newTestServerEntity(t, func(w http.ResponseWriter, r *http.Request) {
+		response := fmt.Sprintf(testCISResponse, "G0x1", "f81d4fae-7dec-11d0-a765-00a0c91e6bf6", time.Now().Format(zaglavljeTimeLayout), "9d6f5bb6-da48-4fcd-a803-4586a025e0e4")
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprint(w, signTestCISResponse(t, key, response, MakeC14N10RecCanonicalizer()))
+	})
+	fe.ciscert = newSignatureCheckCIScert(cert, fe.ciscert.SSLverifyPoll)
+
+	invoice, _, err := fe.NewCISInvoice(time.Now(), 1, 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "10.00", CISCash, "12345678901")
+	if err != nil {
+		t.Fatalf("Failed to create invoice: %v", err)
+	}
+	_, _, err = invoice.InvoiceRequest()
+	var fErr *FiskalError
+	if !errors.As(err, &fErr) || fErr.Category != CategoryOutcomeUnknown || IsRetriable(err) {
+		t.Errorf("Expected an IdPoruke mismatch with an unknown outcome, got %v", err)
+	}
+}
+
+func TestLookupCISError(t *testing.T) {
+	info, ok := LookupCISError(" S002 ")
+	if !ok || info.Code != "s002" || info.Action != CISActionRenewCertificate {
+		t.Errorf("Unexpected info %+v %v", info, ok)
+	}
+	if info.Description(LangEN) == "" || info.Description(LangHR) == info.Description(LangEN) || info.Hint(LangEN) == "" {
+		t.Errorf("Expected the descriptions and the hint in both languages, got %+v", info)
+	}
+	if info, _ := LookupCISError("s006"); info.Action != CISActionRetryLater {
+		t.Errorf("Expected s006 to be retried later, got %q", info.Action)
+	}
+
+	info, ok = LookupCISError("v152")
+	if ok || info.Code != "v152" || info.Action != CISActionFixData || info.DescriptionEN != "Invoice data validation error" {
+		t.Errorf("Expected the v series fallback, got %+v %v", info, ok)
+	}
+	if info, ok := LookupCISError("x1"); ok || info.Action != "" || info.DescriptionHR != "" {
+		t.Errorf("Expected nothing for an unknown series, got %+v", info)
+	}
+	if _, ok := LookupCISError(""); ok {
+		t.Error("Expected nothing for an empty code")
+	}
+
+	// Every catalog entry is complete
+	for code, info := range cisErrorCatalog {
+		if info.DescriptionHR == "" || info.DescriptionEN == "" || info.Action == "" {
+			t.Errorf("Incomplete catalog entry %s: %+v", code, info)
+		}
+	}
+
+	// The returned errors carry the suggested action
+	var cisErrs CISErrors
+	err := newCISErrors(&GreskeType{Greska: []*GreskaType{{SifraGreske: "s004", PorukaGreske: "Neispravan digitalni potpis."}}}, LangHR)
+	if !errors.As(err, &cisErrs) || cisErrs[0].Action != CISActionCheckSetup {
+		t.Errorf("Expected the action in the CIS error, got %v", err)
+	}
+}
@@ -34,44 +34,51 @@ func transformExcC14n(ctx, declared NSContext, el *etree.Element, inclusiveNames
 		return err
 	}
 
-	visiblyUtilizedPrefixes := map[string]struct{}{
-		el.Space: {},
+	// Usually just a few prefixes, a slice is cheaper than a map
+	visiblyUtilizedPrefixes := make([]string, 1, 4)
+	visiblyUtilizedPrefixes[0] = el.Space
+	utilize := func(prefix string) {
+		for _, p := range visiblyUtilizedPrefixes {
+			if p == prefix {
+				return
+			}
+		}
+		visiblyUtilizedPrefixes = append(visiblyUtilizedPrefixes, prefix)
 	}
 
-	filteredAttrs := []etree.Attr{}
-
-	// Filter out all namespace declarations
+	// Filter out all namespace declarations, in place
+	n := 0
 	for _, attr := range el.Attr {
 		switch {
 		case attr.Space == xmlnsPrefix:
 			if _, ok := inclusiveNamespaces[attr.Key]; ok {
-				visiblyUtilizedPrefixes[attr.Key] = struct{}{}
+				utilize(attr.Key)
 			}
 
 		case attr.Space == defaultPrefix && attr.Key == xmlnsPrefix:
 			if _, ok := inclusiveNamespaces[defaultPrefix]; ok {
-				visiblyUtilizedPrefixes[defaultPrefix] = struct{}{}
+				utilize(defaultPrefix)
 			}
 
 		default:
 			if attr.Space != defaultPrefix {
-				visiblyUtilizedPrefixes[attr.Space] = struct{}{}
+				utilize(attr.Space)
 			}
 
-			filteredAttrs = append(filteredAttrs, attr)
+			el.Attr[n] = attr
+			n++
 		}
 	}
-
-	el.Attr = filteredAttrs
-
-	declared = declared.Copy()
+	el.Attr = el.Attr[:n]
 
 	// Declare all visibly utilized prefixes that are in-scope but haven't
 	// been declared in the canonicalized form yet. These might have been
 	// declared on this element but then filtered out above, or they might
 	// have been declared on an ancestor (before canonicalization) which
 	// didn't visibly utilize and thus had them removed.
-	for prefix := range visiblyUtilizedPrefixes {
+	// The declared context is shared with the parent until the first declaration.
+	copied := false
+	for _, prefix := range visiblyUtilizedPrefixes {
 		// Skip redundant declarations - they have to already have the same
 		// value.
 		if declaredNamespace, ok := declared.prefixes[prefix]; ok {
@@ -85,6 +92,9 @@ func transformExcC14n(ctx, declared NSContext, el *etree.Element, inclusiveNames
 			return err
 		}
 
+		if !copied {
+			declared, copied = declared.Copy(), true
+		}
 		el.Attr = append(el.Attr, declared.declare(prefix, namespace))
 	}
 
@@ -102,10 +112,11 @@ func transformExcC14n(ctx, declared NSContext, el *etree.Element, inclusiveNames
 	}
 
 	// Transform child elements
-	for _, child := range el.ChildElements() {
-		err := transformExcC14n(scope, declared, child, inclusiveNamespaces, comments)
-		if err != nil {
-			return err
+	for _, token := range el.Child {
+		if child, ok := token.(*etree.Element); ok {
+			if err := transformExcC14n(scope, declared, child, inclusiveNamespaces, comments); err != nil {
+				return err
+			}
 		}
 	}
 
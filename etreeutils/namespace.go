@@ -93,8 +93,15 @@ func (ctx NSContext) declare(prefix, namespace string) etree.Attr {
 }
 
 func (ctx NSContext) SubContext(el *etree.Element) (NSContext, error) {
-	// The subcontext should inherit existing declared prefixes
-	newCtx := ctx.Copy()
+	// The subcontext should inherit existing declared prefixes, the map is copied
+	// only if the element declares a namespace
+	newCtx := ctx
+	for _, attr := range el.Attr {
+		if attr.Space == xmlnsPrefix || (attr.Space == defaultPrefix && attr.Key == xmlnsPrefix) {
+			newCtx = ctx.Copy()
+			break
+		}
+	}
 
 	// Merge new namespace declarations on top of existing ones.
 	for _, attr := range el.Attr {
@@ -0,0 +1,190 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// certExpiryNotifyInterval is the minimal interval between two OnCertificateExpiringSoon notifications
+const certExpiryNotifyInterval = 24 * time.Hour
+
+// eventHandlers holds the callbacks registered on the entity
+type eventHandlers struct {
+	invoiceSent    []func(invoice *RacunType)
+	jirReceived    []func(invoice *RacunType, jir string)
+	cisError       []func(invoice *RacunType, err error)
+	retryScheduled []func(item *QueuedInvoice)
+	certExpiring   []*certExpiringHandler
+	slowRequest    []slowRequestHandler
+}
+
+// slowRequestHandler is a callback for the slow requests with its threshold
+type slowRequestHandler struct {
+	threshold time.Duration
+	fn        func(exchange *Exchange)
+}
+
+// certExpiringHandler is a callback for the certificate expiry with its threshold
+type certExpiringHandler struct {
+	within       time.Duration
+	fn           func(notAfter time.Time)
+	lastNotified time.Time
+}
+
+// All callbacks are called synchronously from the request methods, so they should return quickly
+// and do any slow work (UI updates, sending alerts...) in a separate goroutine.
+
+// OnInvoiceSent registers a callback called right before the invoice is sent to CIS.
+func (fe *FiskalEntity) OnInvoiceSent(fn func(invoice *RacunType)) {
+	fe.hooksMu.Lock()
+	defer fe.hooksMu.Unlock()
+	fe.events.invoiceSent = append(fe.events.invoiceSent, fn)
+}
+
+// OnJIRReceived registers a callback called when the invoice is successfully fiscalized.
+func (fe *FiskalEntity) OnJIRReceived(fn func(invoice *RacunType, jir string)) {
+	fe.hooksMu.Lock()
+	defer fe.hooksMu.Unlock()
+	fe.events.jirReceived = append(fe.events.jirReceived, fn)
+}
+
+// OnCISError registers a callback called when sending the invoice to CIS fails.
+// It is not called for invalid input detected before sending (CategoryInput errors).
+func (fe *FiskalEntity) OnCISError(fn func(invoice *RacunType, err error)) {
+	fe.hooksMu.Lock()
+	defer fe.hooksMu.Unlock()
+	fe.events.cisError = append(fe.events.cisError, fn)
+}
+
+// OnRetryScheduled registers a callback called when an invoice is put in an offline queue of the entity
+// or stays in it after a failed delivery attempt.
+func (fe *FiskalEntity) OnRetryScheduled(fn func(item *QueuedInvoice)) {
+	fe.hooksMu.Lock()
+	defer fe.hooksMu.Unlock()
+	fe.events.retryScheduled = append(fe.events.retryScheduled, fn)
+}
+
+// OnCertificateExpiringSoon registers a callback called when the certificate expires within the duration
+// (or is already expired). It is checked on registration and before every request to CIS,
+// and called at most once a day.
+func (fe *FiskalEntity) OnCertificateExpiringSoon(within time.Duration, fn func(notAfter time.Time)) {
+	fe.hooksMu.Lock()
+	fe.events.certExpiring = append(fe.events.certExpiring, &certExpiringHandler{within: within, fn: fn})
+	fe.hooksMu.Unlock()
+	fe.checkCertificateExpiry()
+}
+
+// OnSlowRequest registers a callback called after every request to CIS that took longer than the threshold,
+// successful or not, so the operators see the degradation of CIS or the network before the timeouts start failing
+// the sales. Every slow request is also logged as a failure. The exchange must not be modified.
+func (fe *FiskalEntity) OnSlowRequest(threshold time.Duration, fn func(exchange *Exchange)) {
+	fe.hooksMu.Lock()
+	defer fe.hooksMu.Unlock()
+	fe.events.slowRequest = append(fe.events.slowRequest, slowRequestHandler{threshold: threshold, fn: fn})
+}
+
+// emitInvoiceSent calls the OnInvoiceSent callbacks
+func (fe *FiskalEntity) emitInvoiceSent(invoice *RacunType) {
+	if fe == nil {
+		return
+	}
+	fe.hooksMu.RLock()
+	handlers := fe.events.invoiceSent
+	fe.hooksMu.RUnlock()
+	for _, fn := range handlers {
+		fn(invoice)
+	}
+}
+
+// emitInvoiceResult calls the OnJIRReceived or the OnCISError callbacks
+func (fe *FiskalEntity) emitInvoiceResult(invoice *RacunType, jir string, err error) {
+	if fe == nil {
+		return
+	}
+	fe.hooksMu.RLock()
+	jirHandlers := fe.events.jirReceived
+	errHandlers := fe.events.cisError
+	fe.hooksMu.RUnlock()
+
+	if err == nil {
+		for _, fn := range jirHandlers {
+			fn(invoice, jir)
+		}
+		return
+	}
+
+	var fErr *FiskalError
+	if errors.As(err, &fErr) && fErr.Category == CategoryInput {
+		return
+	}
+	for _, fn := range errHandlers {
+		fn(invoice, err)
+	}
+}
+
+// emitRetryScheduled calls the OnRetryScheduled callbacks
+func (fe *FiskalEntity) emitRetryScheduled(item *QueuedInvoice) {
+	if fe == nil {
+		return
+	}
+	fe.hooksMu.RLock()
+	handlers := fe.events.retryScheduled
+	fe.hooksMu.RUnlock()
+	for _, fn := range handlers {
+		cpy := *item
+		fn(&cpy)
+	}
+}
+
+// emitSlowRequest calls the OnSlowRequest callbacks with a threshold below the duration of the exchange
+func (fe *FiskalEntity) emitSlowRequest(exchange *Exchange) {
+	fe.hooksMu.RLock()
+	handlers := fe.events.slowRequest
+	fe.hooksMu.RUnlock()
+
+	logged := false
+	for _, h := range handlers {
+		if exchange.Duration <= h.threshold {
+			continue
+		}
+		if !logged {
+			fe.log(failureLevel, "slow CIS request", slog.String("operation", exchange.Operation),
+				slog.Duration("duration", exchange.Duration), slog.Duration("threshold", h.threshold))
+			logged = true
+		}
+		h.fn(exchange)
+	}
+}
+
+// checkCertificateExpiry calls the OnCertificateExpiringSoon callbacks if the certificate expires soon
+func (fe *FiskalEntity) checkCertificateExpiry() {
+	if fe == nil {
+		return
+	}
+	cert := fe.certificate()
+	if cert == nil || cert.publicCert == nil {
+		return
+	}
+	notAfter := cert.publicCert.NotAfter
+	now := time.Now()
+
+	var due []func(time.Time)
+	fe.hooksMu.Lock()
+	for _, h := range fe.events.certExpiring {
+		if notAfter.Sub(now) > h.within || now.Sub(h.lastNotified) < certExpiryNotifyInterval {
+			continue
+		}
+		h.lastNotified = now
+		due = append(due, h.fn)
+	}
+	fe.hooksMu.Unlock()
+
+	for _, fn := range due {
+		fn(notAfter)
+	}
+}
@@ -0,0 +1,107 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLifecycleEvents(t *testing.T) {
+	fe := newTestServerEntity(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault><faultcode>soap:Server</faultcode><faultstring>down</faultstring></soap:Fault></soap:Body></soap:Envelope>`)
+	})
+
+	var sent, jirs, cisErrors, retries int
+	fe.OnInvoiceSent(func(invoice *RacunType) { sent++ })
+	fe.OnJIRReceived(func(invoice *RacunType, jir string) { jirs++ })
+	fe.OnCISError(func(invoice *RacunType, err error) { cisErrors++ })
+	fe.OnRetryScheduled(func(item *QueuedInvoice) { retries++ })
+
+	invoice, _, err := fe.NewCISInvoice(time.Now(), 1, 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "10.00", CISCash, "12345678901")
+	if err != nil {
+		t.Fatalf("Failed to create invoice: %v", err)
+	}
+
+	_, _, err = invoice.InvoiceRequest()
+	if err == nil {
+		t.Fatalf("Expected the request to fail")
+	}
+	if sent != 1 || cisErrors != 1 || jirs != 0 {
+		t.Errorf("Unexpected events: sent %d, CIS errors %d, JIRs %d", sent, cisErrors, jirs)
+	}
+
+	queue, err := fe.NewOfflineQueue(NewMemoryQueueStore())
+	if err != nil {
+		t.Fatalf("Failed to create queue: %v", err)
+	}
+	queue.Enqueue(invoice, err)
+	queue.Dispatch()
+	if retries != 2 {
+		t.Errorf("Expected 2 scheduled retries (enqueue and failed dispatch), got %d", retries)
+	}
+
+	// Invalid input is not a CIS error
+	(&RacunType{pointerToEntity: fe}).InvoiceRequest()
+	if cisErrors != 2 {
+		t.Errorf("Expected only the dispatch failure as a new CIS error, got %d", cisErrors)
+	}
+}
+
+func TestCertificateExpiringSoon(t *testing.T) {
+	fe := newTestEntity(t)
+
+	var notified []time.Time
+	fe.OnCertificateExpiringSoon(100*365*24*time.Hour, func(notAfter time.Time) {
+		notified = append(notified, notAfter)
+	})
+	if len(notified) != 1 || !notified[0].Equal(fe.cert.publicCert.NotAfter) {
+		t.Fatalf("Expected a notification on registration, got %v", notified)
+	}
+
+	// Notified at most once a day
+	fe.checkCertificateExpiry()
+	if len(notified) != 1 {
+		t.Errorf("Expected no repeated notification, got %d", len(notified))
+	}
+
+	var never bool
+	fe.OnCertificateExpiringSoon(0, func(notAfter time.Time) { never = true })
+	if never && time.Now().Before(fe.cert.publicCert.NotAfter) {
+		t.Errorf("Expected no notification for a valid certificate with zero threshold")
+	}
+}
+
+func TestSlowRequest(t *testing.T) {
+	var delay atomic.Int64
+	delay.Store(int64(100 * time.Millisecond))
+	fe := newTestServerEntity(t, func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Duration(delay.Load()))
+		fmt.Fprint(w, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><tns:EchoResponse xmlns:tns="http://www.apis-it.hr/fin/2012/types/f73">ping</tns:EchoResponse></soap:Body></soap:Envelope>`)
+	})
+
+	var slow, verySlow []*Exchange
+	fe.OnSlowRequest(50*time.Millisecond, func(exchange *Exchange) { slow = append(slow, exchange) })
+	fe.OnSlowRequest(time.Minute, func(exchange *Exchange) { verySlow = append(verySlow, exchange) })
+
+	if _, err := fe.EchoRequest("ping"); err != nil {
+		t.Fatal(err)
+	}
+	if len(slow) != 1 || slow[0].Operation != "EchoRequest" || slow[0].Duration < 100*time.Millisecond || len(verySlow) != 0 {
+		t.Errorf("Expected only the 50ms callback to be called, got %v and %v", slow, verySlow)
+	}
+
+	delay.Store(0)
+	if _, err := fe.EchoRequest("ping"); err != nil {
+		t.Fatal(err)
+	}
+	if len(slow) != 1 {
+		t.Errorf("Expected no callback for a fast request, got %d", len(slow))
+	}
+}
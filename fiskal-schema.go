@@ -6,13 +6,14 @@ package fiskalhrgo
 
 import (
 	"encoding/xml"
-	"fmt"
+	"net/http"
 	"time"
 
-	"github.com/google/uuid"
+	"github.com/l-d-t/fiskalhrgo/schema"
 )
 
-const DefaultNamespace = "http://www.apis-it.hr/fin/2012/types/f73"
+// DefaultNamespace is the namespace of the CIS messages, see schema.Namespace
+const DefaultNamespace = schema.Namespace
 
 // RacunZahtjev ...
 type RacunZahtjev struct {
@@ -104,37 +105,6 @@ type NapojnicaOdgovor struct {
 	Greske         *GreskeType           `xml:"Greske"`
 }
 
-// EchoRequest represents a simple request with a text body
-type EchoRequest struct {
-	XMLName xml.Name `xml:"tns:EchoRequest"`
-	Xmlns   string   `xml:"xmlns:tns,attr"` // Declare the tns namespace
-	Text    string   `xml:",chardata"`
-}
-
-// EchoResponse represents a simple response with a text body
-type EchoResponse struct {
-	XMLName xml.Name `xml:"EchoResponse"`
-	Text    string   `xml:",chardata"`
-}
-
-// PorukaOdgovoraType ...
-type PorukaOdgovoraType struct {
-	SifraPoruke string `xml:"SifraPoruke"`
-	Poruka      string `xml:"Poruka"`
-}
-
-// ZaglavljeType is Datum i vrijeme slanja poruke.
-type ZaglavljeType struct {
-	IdPoruke     string `xml:"tns:IdPoruke"`
-	DatumVrijeme string `xml:"tns:DatumVrijeme"`
-}
-
-// ZaglavljeOdgovorType ...
-type ZaglavljeOdgovorType struct {
-	IdPoruke     string `xml:"IdPoruke"`
-	DatumVrijeme string `xml:"DatumVrijeme"`
-}
-
 // RacunType represents the invoice type with various details required for fiscalization.
 type RacunType struct {
 	XMLName               xml.Name              `xml:"tns:Racun"`
@@ -162,119 +132,88 @@ type RacunType struct {
 	Napojnica             *NapojnicaType        `xml:"tns:Napojnica,omitempty"`
 
 	// Additional functional non XML fields
-	pointerToEntity    *FiskalEntity // Pointer to the FiskalEntity
-	oldEntityForOldZKI *FiskalEntity // Pointer to the old FiskalEntity for the old ZKI
+	pointerToEntity *FiskalEntity // Pointer to the FiskalEntity
+	requestHeaders  http.Header   // Extra HTTP headers sent with the request of this invoice only
+	selfService     string        // The ID of the self-service device that issued the invoice, see SetSelfServiceDevice
+	zkiCert         *certManager  // The certificate that produced the ZKI, if it's not the current one
 	// This is used in the edge case that the ZKI was generated with one certificate and the fiscalization failed
 	// But the certificate expired or had to be changed and now fiscalization have to be repeated with new certificate
 	// If we replace the original ZKI its a problem we already gave the invoice with old ZKI out
 	// So we have to keep the old ZKI and validate it with the old certificate before signing and sending with new one
-	// In any case this is set by IhaveZKIwithExpiredCertificateEdgeCase(EntityWithOldCertLoaded *FiskalEntity) method
+	// In any case this is set by SetLateDelivery, the certificate is found in the entity archive
 }
 
-// PrateciDokumentType ...
-type PrateciDokumentType struct {
-	Oib                 string      `xml:"tns:Oib"`
-	DatVrijeme          string      `xml:"tns:DatVrijeme"`
-	BrPratecegDokumenta *BrojPDType `xml:"tns:BrPratecegDokumenta"`
-	IznosUkupno         string      `xml:"tns:IznosUkupno"`
-	ZastKodPD           string      `xml:"tns:ZastKodPD"`
-	NakDost             bool        `xml:"tns:NakDost"`
+// GreskeType ...
+type GreskeType struct {
+	Greska []*GreskaType `xml:"Greska"`
 }
 
+// EchoRequest represents a simple request with a text body
+type EchoRequest = schema.EchoRequest
+
+// EchoResponse represents a simple response with a text body
+type EchoResponse = schema.EchoResponse
+
+// PorukaOdgovoraType ...
+type PorukaOdgovoraType = schema.PorukaOdgovoraType
+
+// ZaglavljeType is Datum i vrijeme slanja poruke.
+type ZaglavljeType = schema.ZaglavljeType
+
+// ZaglavljeOdgovorType ...
+type ZaglavljeOdgovorType = schema.ZaglavljeOdgovorType
+
+// PrateciDokumentType ...
+type PrateciDokumentType = schema.PrateciDokumentType
+
 // PrateciDokument ...
-type PrateciDokument struct {
-	JirPD     string `xml:"tns:JirPD"`
-	ZastKodPD string `xml:"tns:ZastKodPD"`
-}
+type PrateciDokument = schema.PrateciDokument
 
 // NapojnicaType ...
-type NapojnicaType struct {
-	IznosNapojnice         string `xml:"tns:iznosNapojnice"`
-	NacinPlacanjaNapojnice string `xml:"tns:nacinPlacanjaNapojnice"`
-}
-
-// GreskeType ...
-type GreskeType struct {
-	Greska []*GreskaType `xml:"Greska"`
-}
+type NapojnicaType = schema.NapojnicaType
 
 // GreskaType ...
-type GreskaType struct {
-	SifraGreske  string `xml:"SifraGreske"`
-	PorukaGreske string `xml:"PorukaGreske"`
-}
+type GreskaType = schema.GreskaType
 
 // NaknadeType ...
-type NaknadeType struct {
-	Naknada []*NaknadaType `xml:"tns:Naknada"`
-}
+type NaknadeType = schema.NaknadeType
 
 // NaknadaType ...
-type NaknadaType struct {
-	NazivN string `xml:"tns:NazivN"`
-	IznosN string `xml:"tns:IznosN"`
-}
+type NaknadaType = schema.NaknadaType
 
 // OstaliPoreziType ...
-type OstaliPoreziType struct {
-	Porez []*PorezOstaloType `xml:"tns:Porez"`
-}
+type OstaliPoreziType = schema.OstaliPoreziType
 
 // PorezNaPotrosnjuType ...
-type PorezNaPotrosnjuType struct {
-	Porez []*PorezType `xml:"tns:Porez"`
-}
+type PorezNaPotrosnjuType = schema.PorezNaPotrosnjuType
 
 // PdvType ...
-type PdvType struct {
-	Porez []*PorezType `xml:"tns:Porez"`
-}
+type PdvType = schema.PdvType
 
 // PorezOstaloType ...
-type PorezOstaloType struct {
-	Naziv    string `xml:"tns:Naziv"`
-	Stopa    string `xml:"tns:Stopa"`
-	Osnovica string `xml:"tns:Osnovica"`
-	Iznos    string `xml:"tns:Iznos"`
-}
+type PorezOstaloType = schema.PorezOstaloType
 
 // PorezType ...
-type PorezType struct {
-	Stopa    string `xml:"tns:Stopa"`
-	Osnovica string `xml:"tns:Osnovica"`
-	Iznos    string `xml:"tns:Iznos"`
-}
+type PorezType = schema.PorezType
 
 // BrojRacunaType ...
-type BrojRacunaType struct {
-	BrOznRac uint   `xml:"tns:BrOznRac"`
-	OznPosPr string `xml:"tns:OznPosPr"`
-	OznNapUr uint   `xml:"tns:OznNapUr"`
-}
+type BrojRacunaType = schema.BrojRacunaType
 
 // BrojPDType ...
-type BrojPDType struct {
-	BrOznPD  int    `xml:"tns:BrOznPD"`
-	OznPosPr string `xml:"tns:OznPosPr"`
-	OznNapUr int    `xml:"tns:OznNapUr"`
-}
-
-// generateUniqueID generates a unique ID
-func generateUniqueID() string {
-	return fmt.Sprintf("%x", time.Now().UnixNano())
-}
+type BrojPDType = schema.BrojPDType
 
-// newFiskalHeader creates a new instance of ZaglavljeType with a unique message ID and the current timestamp
+// newFiskalHeader creates a new instance of ZaglavljeType with the message ID and the current timestamp
 //
-// This function generates a new UUIDv4 for the IdPoruke field to ensure that each message has a unique identifier.
-// It also sets the DatumVrijeme field to the current time formatted as "2006-01-02T15:04:05" to indicate when the message was created.
+// The IdPoruke must be unique for every message, use GenerateID (a UUIDv4 by default) or the IDProvider of the entity.
+// It also sets the DatumVrijeme field to the current Croatian time formatted as "02.01.2006T15:04:05" to indicate when the message was created,
+// CIS expects the Croatian time whatever the time zone of the host is.
 //
 // Returns:
 //
 //	*ZaglavljeType: A pointer to a new ZaglavljeType instance with the IdPoruke and DatumVrijeme fields populated.
-func newFiskalHeader() *ZaglavljeType {
+func newFiskalHeader(idPoruke string) *ZaglavljeType {
 	return &ZaglavljeType{
-		IdPoruke:     uuid.New().String(),
-		DatumVrijeme: time.Now().Format("02.01.2006T15:04:05"),
+		IdPoruke:     idPoruke,
+		DatumVrijeme: time.Now().In(cisLocation).Format(zaglavljeTimeLayout),
 	}
 }
@@ -27,15 +27,15 @@ func TestEchoRequestMarshal(t *testing.T) {
 // Test for RacunZahtjev structure
 func TestRacunZahtjevMarshal(t *testing.T) {
 	racun := RacunZahtjev{
-		Zaglavlje: newFiskalHeader(),
+		Zaglavlje: newFiskalHeader(GenerateID()),
 		Racun: &RacunType{
 			Oib:         "12345678901",
 			USustPdv:    true,
 			DatVrijeme:  "2024-09-19T10:00:00",
 			OznSlijed:   "P",
-			BrRac:       &BrojRacunaType{100, "POS1", 1},
+			BrRac:       &BrojRacunaType{BrOznRac: 100, OznPosPr: "POS1", OznNapUr: 1},
 			IznosUkupno: "150.50",
-			Pdv:         &PdvType{[]*PorezType{{"25.00", "120.40", "30.10"}}},
+			Pdv:         &PdvType{Porez: []*PorezType{{Stopa: "25.00", Osnovica: "120.40", Iznos: "30.10"}}},
 			NacinPlac:   "G",
 			OibOper:     "98765432100",
 			ZastKod:     "c3b2ecf807f56e294fbb3d536aad0f6c",
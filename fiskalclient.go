@@ -0,0 +1,76 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import "errors"
+
+// FiskalClient is the small set of the CIS calls of a checkout flow. Depend on it instead of the entity to
+// unit-test the flow without a certificate or network, with the mock of the fiskalmock package:
+//
+//	func Checkout(client fiskalhrgo.FiskalClient, invoice *fiskalhrgo.RacunType) error {
+//		jir, zki, err := client.InvoiceRequest(invoice)
+//		...
+//	}
+//
+//	err := Checkout(entity.Client(), invoice) // in the application
+//	err := Checkout(&fiskalmock.Client{}, invoice) // in the tests
+type FiskalClient interface {
+	// InvoiceRequest fiscalizes the invoice, see RacunType.InvoiceRequest
+	InvoiceRequest(invoice *RacunType) (jir string, zki string, err error)
+
+	// AddTipRequest reports a tip on the fiscalized invoice, see RacunType.AddTipRequest
+	AddTipRequest(invoice *RacunType, amount string, method PaymentMethod) (*NapojnicaOdgovor, error)
+
+	// ChangePaymentMethodRequest changes the payment method of the fiscalized invoice, see RacunType.ChangePaymentMethodRequest
+	ChangePaymentMethodRequest(invoice *RacunType, method PaymentMethod) (*PromijeniNacPlacOdgovor, error)
+
+	// EchoRequest checks the connection to CIS, see FiskalEntity.EchoRequest
+	EchoRequest(text string) (string, error)
+}
+
+// entityClient is the FiskalClient of an entity
+type entityClient struct {
+	fe *FiskalEntity
+}
+
+var _ FiskalClient = entityClient{}
+
+// Client returns the entity as a FiskalClient. The invoices passed to it must be created by the entity.
+func (fe *FiskalEntity) Client() FiskalClient {
+	return entityClient{fe: fe}
+}
+
+// checkInvoice checks that the invoice was created by the entity of the client
+func (c entityClient) checkInvoice(invoice *RacunType) error {
+	if invoice == nil || invoice.pointerToEntity != c.fe {
+		return newFiskalError(CategoryInput, errors.New("invoice is nil or not created by the entity of the client"))
+	}
+	return nil
+}
+
+func (c entityClient) InvoiceRequest(invoice *RacunType) (string, string, error) {
+	if err := c.checkInvoice(invoice); err != nil {
+		return "", "", err
+	}
+	return invoice.InvoiceRequest()
+}
+
+func (c entityClient) AddTipRequest(invoice *RacunType, amount string, method PaymentMethod) (*NapojnicaOdgovor, error) {
+	if err := c.checkInvoice(invoice); err != nil {
+		return nil, err
+	}
+	return invoice.AddTipRequest(amount, method)
+}
+
+func (c entityClient) ChangePaymentMethodRequest(invoice *RacunType, method PaymentMethod) (*PromijeniNacPlacOdgovor, error) {
+	if err := c.checkInvoice(invoice); err != nil {
+		return nil, err
+	}
+	return invoice.ChangePaymentMethodRequest(method)
+}
+
+func (c entityClient) EchoRequest(text string) (string, error) {
+	return c.fe.EchoRequest(text)
+}
@@ -0,0 +1,36 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEntityClient(t *testing.T) {
+	fe := newTestServerEntity(t, echoHandler)
+	client := fe.Client()
+	if text, err := client.EchoRequest("checkout"); err != nil || text != "checkout" {
+		t.Fatalf("Unexpected echo %q, %v", text, err)
+	}
+
+	// The invoices of another entity are refused before sending
+	other := newTestEntity(t)
+	invoice, _, err := other.NewCISInvoice(time.Now(), 1, 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "10.00", CISCash, "12345678901")
+	if err != nil {
+		t.Fatalf("Failed to create invoice: %v", err)
+	}
+	var fErr *FiskalError
+	if _, _, err := client.InvoiceRequest(invoice); !errors.As(err, &fErr) || fErr.Category != CategoryInput {
+		t.Errorf("Expected an input error, got %v", err)
+	}
+	if _, err := client.AddTipRequest(nil, "1.00", CISCash); !errors.As(err, &fErr) || fErr.Category != CategoryInput {
+		t.Errorf("Expected an input error, got %v", err)
+	}
+	if _, err := client.ChangePaymentMethodRequest(invoice, CISCard); !errors.As(err, &fErr) || fErr.Category != CategoryInput {
+		t.Errorf("Expected an input error, got %v", err)
+	}
+}
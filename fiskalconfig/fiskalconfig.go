@@ -0,0 +1,337 @@
+// Package fiskalconfig creates FiskalEntity instances from YAML or TOML configuration files,
+// for the fiskald daemon, the fiskalhr tool and applications serving many taxpayers (tenants).
+//
+// A configuration file lists the entities by name:
+//
+//	entities:
+//	  - name: shop1
+//	    oib: "12345678901"
+//	    location: POS1
+//	    cert_path: /etc/fiskal/shop1.p12
+//	    cert_password_env: SHOP1_CERT_PASSWORD
+//	    demo: true
+//	    timeout: 15s
+//
+// or the same in TOML with [[entities]] tables. The certificate password should be read from the
+// environment (cert_password_env), environment variables in cert_path ($VAR or ${VAR}) are expanded.
+//
+// All entities are validated, the returned *Error lists the problem of every invalid entity,
+// so a single bad tenant doesn't hide the others.
+package fiskalconfig
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	fiskalhrgo "github.com/l-d-t/fiskalhrgo"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the content of a configuration file
+type Config struct {
+	Entities []EntityConfig `yaml:"entities" toml:"entities"`
+}
+
+// EntityConfig holds the settings of a single FiskalEntity
+type EntityConfig struct {
+	// Name identifies the entity in the configuration, must be unique
+	Name string `yaml:"name" toml:"name"`
+
+	// OIB, Location, VAT, Centralized and Demo are the NewFiskalEntity parameters,
+	// VAT and Centralized default to true
+	OIB         string `yaml:"oib" toml:"oib"`
+	Location    string `yaml:"location" toml:"location"`
+	VAT         *bool  `yaml:"vat" toml:"vat"`
+	Centralized *bool  `yaml:"centralized" toml:"centralized"`
+	Demo        bool   `yaml:"demo" toml:"demo"`
+
+	// CertPath is the path to the P12 certificate, environment variables are expanded
+	CertPath string `yaml:"cert_path" toml:"cert_path"`
+
+	// CertPasswordEnv is the name of the environment variable holding the certificate password,
+	// CertPassword is used when it is empty (not recommended, the password ends up in the file)
+	CertPasswordEnv string `yaml:"cert_password_env" toml:"cert_password_env"`
+	CertPassword    string `yaml:"cert_password" toml:"cert_password"`
+
+	// AllowExpired allows loading an expired certificate, e.g. to recalculate the ZKI of old invoices
+	AllowExpired bool `yaml:"allow_expired" toml:"allow_expired"`
+
+	// AllowUntrustedCert allows a certificate not issued by FINA, only for self-made test certificates
+	AllowUntrustedCert bool `yaml:"allow_untrusted_cert" toml:"allow_untrusted_cert"`
+
+	// AllowUnverifiedResponses accepts the CIS responses without a valid signature, only as a temporary workaround
+	AllowUnverifiedResponses bool `yaml:"allow_unverified_responses" toml:"allow_unverified_responses"`
+
+	// ValidateSchema validates the requests against the CIS XML schema before sending
+	ValidateSchema bool `yaml:"validate_schema" toml:"validate_schema"`
+
+	// CISCertPath is the PEM chain of the CIS certificate overriding the embedded one, environment variables are expanded
+	CISCertPath string `yaml:"cis_cert_path" toml:"cis_cert_path"`
+
+	// Timeout of the requests to CIS, the library default if zero
+	Timeout time.Duration `yaml:"timeout" toml:"timeout"`
+
+	// ResponseMaxSkew is the allowed difference between the request and the CIS response time,
+	// the library default if zero, negative disables the check
+	ResponseMaxSkew time.Duration `yaml:"response_max_skew" toml:"response_max_skew"`
+
+	// Endpoint overrides the CIS endpoint URL, UserAgent the User-Agent header
+	Endpoint  string `yaml:"endpoint" toml:"endpoint"`
+	UserAgent string `yaml:"user_agent" toml:"user_agent"`
+
+	// Language of the error messages, "hr" or "en"
+	Language string `yaml:"language" toml:"language"`
+}
+
+// EntityError is the problem of a single entity in the configuration
+type EntityError struct {
+	Name string
+	Err  error
+}
+
+func (e *EntityError) Error() string {
+	return fmt.Sprintf("entity %q: %v", e.Name, e.Err)
+}
+
+func (e *EntityError) Unwrap() error {
+	return e.Err
+}
+
+// Error lists all invalid entities of the configuration
+type Error struct {
+	Entities []*EntityError
+}
+
+func (e *Error) Error() string {
+	msgs := make([]string, 0, len(e.Entities))
+	for _, ee := range e.Entities {
+		msgs = append(msgs, ee.Error())
+	}
+	return fmt.Sprintf("%d invalid entities in the configuration: %s", len(e.Entities), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the errors of the entities, so errors.Is and errors.As look through all of them
+func (e *Error) Unwrap() []error {
+	errs := make([]error, 0, len(e.Entities))
+	for _, ee := range e.Entities {
+		errs = append(errs, ee)
+	}
+	return errs
+}
+
+// Load reads the configuration file, the format is chosen by the extension: .toml for TOML,
+// YAML otherwise (.yaml, .yml, JSON is valid YAML too).
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration: %w", err)
+	}
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		return ParseTOML(data)
+	}
+	return ParseYAML(data)
+}
+
+// ParseYAML parses a YAML configuration, unknown keys are rejected
+func ParseYAML(data []byte) (*Config, error) {
+	var cfg Config
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("invalid YAML configuration: %w", err)
+	}
+	return &cfg, nil
+}
+
+// ParseTOML parses a TOML configuration, unknown keys are rejected
+func ParseTOML(data []byte) (*Config, error) {
+	var cfg Config
+	meta, err := toml.Decode(string(data), &cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TOML configuration: %w", err)
+	}
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("invalid TOML configuration: unknown key %s", undecoded[0])
+	}
+	return &cfg, nil
+}
+
+// Validate checks the configuration without loading the certificates
+func (c *Config) Validate() error {
+	if errs := c.validate(); len(errs) > 0 {
+		return &Error{Entities: entityErrors(errs)}
+	}
+	return nil
+}
+
+// validate returns the problems of the entities by their index
+func (c *Config) validate() map[int]*EntityError {
+	errs := make(map[int]*EntityError)
+	seen := make(map[string]bool)
+	for i := range c.Entities {
+		ec := &c.Entities[i]
+		name := ec.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		err := ec.Validate()
+		if ec.Name != "" && seen[ec.Name] {
+			err = errors.New("duplicate entity name")
+		}
+		seen[ec.Name] = true
+		if err != nil {
+			errs[i] = &EntityError{Name: name, Err: err}
+		}
+	}
+	return errs
+}
+
+// entityErrors returns the errors in the order of the entities
+func entityErrors(errs map[int]*EntityError) []*EntityError {
+	indexes := make([]int, 0, len(errs))
+	for i := range errs {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	out := make([]*EntityError, 0, len(errs))
+	for _, i := range indexes {
+		out = append(out, errs[i])
+	}
+	return out
+}
+
+// Validate checks the entity settings without loading the certificate
+func (ec *EntityConfig) Validate() error {
+	var problems []error
+	if ec.Name == "" {
+		problems = append(problems, errors.New("name is required"))
+	}
+	if !fiskalhrgo.ValidateOIB(ec.OIB) {
+		problems = append(problems, errors.New("invalid OIB"))
+	}
+	if !fiskalhrgo.ValidateLocationID(ec.Location) {
+		problems = append(problems, errors.New("invalid location ID"))
+	}
+	if ec.CertPath == "" {
+		problems = append(problems, errors.New("cert_path is required"))
+	}
+	if ec.CertPasswordEnv != "" {
+		if _, ok := os.LookupEnv(ec.CertPasswordEnv); !ok {
+			problems = append(problems, fmt.Errorf("environment variable %s is not set", ec.CertPasswordEnv))
+		}
+	}
+	if ec.Timeout < 0 {
+		problems = append(problems, errors.New("timeout must not be negative"))
+	}
+	if ec.Language != "" && !fiskalhrgo.Language(ec.Language).IsValid() {
+		problems = append(problems, fmt.Errorf("unsupported language: %s", ec.Language))
+	}
+	return errors.Join(problems...)
+}
+
+// NewEntity validates the settings and creates the entity, the extra options are applied after the settings,
+// e.g. the logger or the clock (fiskalhrgo.WithClock) of the tests
+func (ec *EntityConfig) NewEntity(extra ...fiskalhrgo.Option) (*fiskalhrgo.FiskalEntity, error) {
+	if err := ec.Validate(); err != nil {
+		return nil, err
+	}
+
+	password := ec.CertPassword
+	if ec.CertPasswordEnv != "" {
+		password = os.Getenv(ec.CertPasswordEnv)
+	}
+
+	opts := []fiskalhrgo.Option{
+		fiskalhrgo.WithLocation(ec.Location),
+		fiskalhrgo.WithVAT(boolOr(ec.VAT, true)),
+		fiskalhrgo.WithCentralizedInvoiceNumber(boolOr(ec.Centralized, true)),
+		fiskalhrgo.WithDemoMode(ec.Demo),
+		fiskalhrgo.WithExpiredCheck(!ec.AllowExpired),
+		fiskalhrgo.WithChainVerification(!ec.AllowUntrustedCert),
+		fiskalhrgo.WithStrictResponseVerification(!ec.AllowUnverifiedResponses),
+		fiskalhrgo.WithSchemaValidation(ec.ValidateSchema),
+		fiskalhrgo.WithCertFile(os.ExpandEnv(ec.CertPath), password),
+		fiskalhrgo.WithTimeout(ec.Timeout),
+		fiskalhrgo.WithCISCertificateFile(os.ExpandEnv(ec.CISCertPath)),
+	}
+	if ec.ResponseMaxSkew != 0 {
+		opts = append(opts, fiskalhrgo.WithResponseMaxSkew(max(ec.ResponseMaxSkew, 0)))
+	}
+	entity, err := fiskalhrgo.NewFiskalEntityWithOptions(ec.OIB, append(opts, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	if ec.Endpoint != "" {
+		if err := entity.SetEndpoint(ec.Endpoint); err != nil {
+			return nil, err
+		}
+	}
+	if ec.UserAgent != "" {
+		entity.SetUserAgent(ec.UserAgent)
+	}
+	if ec.Language != "" {
+		if err := entity.SetLanguage(fiskalhrgo.Language(ec.Language)); err != nil {
+			return nil, err
+		}
+	}
+	return entity, nil
+}
+
+// NewEntities creates all entities of the configuration with the extra options (see NewEntity), keyed by name.
+// The valid entities are always returned, the error is an *Error listing the ones that failed.
+func (c *Config) NewEntities(extra ...fiskalhrgo.Option) (map[string]*fiskalhrgo.FiskalEntity, error) {
+	entities := make(map[string]*fiskalhrgo.FiskalEntity, len(c.Entities))
+	errs := c.validate()
+	for i := range c.Entities {
+		if errs[i] != nil {
+			continue
+		}
+		ec := &c.Entities[i]
+		entity, err := ec.NewEntity(extra...)
+		if err != nil {
+			errs[i] = &EntityError{Name: ec.Name, Err: err}
+			continue
+		}
+		entities[ec.Name] = entity
+	}
+
+	if len(errs) > 0 {
+		return entities, &Error{Entities: entityErrors(errs)}
+	}
+	return entities, nil
+}
+
+// Entity returns the settings of the named entity, or the only entity when name is empty
+func (c *Config) Entity(name string) (*EntityConfig, error) {
+	if name == "" {
+		if len(c.Entities) != 1 {
+			return nil, fmt.Errorf("the configuration has %d entities, select one by name", len(c.Entities))
+		}
+		return &c.Entities[0], nil
+	}
+	for i := range c.Entities {
+		if c.Entities[i].Name == name {
+			return &c.Entities[i], nil
+		}
+	}
+	return nil, fmt.Errorf("entity %q not found in the configuration", name)
+}
+
+func boolOr(v *bool, def bool) bool {
+	if v == nil {
+		return def
+	}
+	return *v
+}
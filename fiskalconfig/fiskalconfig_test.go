@@ -0,0 +1,170 @@
+package fiskalconfig
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	fiskalhrgo "github.com/l-d-t/fiskalhrgo"
+	"github.com/l-d-t/fiskalhrgo/fiskaltest"
+)
+
+const yamlConfig = `
+entities:
+  - name: shop1
+    oib: "65049901548"
+    location: POS1
+    cert_path: $FISKALCONFIG_TEST_DIR/fiskal.p12
+    cert_password_env: FISKALCONFIG_TEST_PASSWORD
+    demo: true
+    vat: false
+    timeout: 15s
+    language: en
+  - name: shop2
+    oib: "12345678900"
+    location: "POS 2"
+`
+
+const tomlConfig = `
+[[entities]]
+name = "shop1"
+oib = "65049901548"
+location = "POS1"
+cert_path = "$FISKALCONFIG_TEST_DIR/fiskal.p12"
+cert_password_env = "FISKALCONFIG_TEST_PASSWORD"
+demo = true
+vat = false
+timeout = "15s"
+language = "en"
+
+[[entities]]
+name = "shop2"
+oib = "12345678900"
+location = "POS 2"
+`
+
+func TestParse(t *testing.T) {
+	t.Setenv("FISKALCONFIG_TEST_PASSWORD", "secret")
+	for name, parse := range map[string]func([]byte) (*Config, error){
+		"yaml": func(b []byte) (*Config, error) { return ParseYAML(b) },
+		"toml": func(b []byte) (*Config, error) { return ParseTOML(b) },
+	} {
+		data := yamlConfig
+		if name == "toml" {
+			data = tomlConfig
+		}
+		cfg, err := parse([]byte(data))
+		if err != nil {
+			t.Fatalf("%s: failed to parse: %v", name, err)
+		}
+		if len(cfg.Entities) != 2 {
+			t.Fatalf("%s: expected 2 entities, got %d", name, len(cfg.Entities))
+		}
+		shop1 := cfg.Entities[0]
+		if shop1.Name != "shop1" || !shop1.Demo || shop1.VAT == nil || *shop1.VAT || shop1.Timeout != 15*time.Second || shop1.Language != "en" {
+			t.Errorf("%s: unexpected entity: %+v", name, shop1)
+		}
+
+		err = cfg.Validate()
+		var cfgErr *Error
+		if !errors.As(err, &cfgErr) {
+			t.Fatalf("%s: expected *Error, got %v", name, err)
+		}
+		if len(cfgErr.Entities) != 1 || cfgErr.Entities[0].Name != "shop2" {
+			t.Fatalf("%s: expected only shop2 to be invalid, got %v", name, err)
+		}
+		for _, problem := range []string{"invalid OIB", "invalid location ID", "cert_path is required"} {
+			if !strings.Contains(err.Error(), problem) {
+				t.Errorf("%s: expected %q in %v", name, problem, err)
+			}
+		}
+	}
+}
+
+func TestParseUnknownKey(t *testing.T) {
+	if _, err := ParseYAML([]byte("entities:\n  - name: a\n    oibb: 1\n")); err == nil {
+		t.Errorf("Expected error for unknown YAML key")
+	}
+	if _, err := ParseTOML([]byte("[[entities]]\nname = \"a\"\noibb = 1\n")); err == nil {
+		t.Errorf("Expected error for unknown TOML key")
+	}
+}
+
+func TestValidateDuplicateAndMissingEnv(t *testing.T) {
+	entity := EntityConfig{Name: "a", OIB: "65049901548", Location: "POS1", CertPath: "a.p12", CertPasswordEnv: "FISKALCONFIG_TEST_UNSET"}
+	cfg := &Config{Entities: []EntityConfig{entity, entity}}
+	err := cfg.Validate()
+	var cfgErr *Error
+	if !errors.As(err, &cfgErr) || len(cfgErr.Entities) != 2 {
+		t.Fatalf("Expected 2 entity errors, got %v", err)
+	}
+	if !strings.Contains(cfgErr.Entities[0].Error(), "FISKALCONFIG_TEST_UNSET is not set") {
+		t.Errorf("Expected missing environment variable, got %v", cfgErr.Entities[0])
+	}
+	if !strings.Contains(cfgErr.Entities[1].Error(), "duplicate entity name") {
+		t.Errorf("Expected duplicate name, got %v", cfgErr.Entities[1])
+	}
+}
+
+func TestEntity(t *testing.T) {
+	cfg := &Config{Entities: []EntityConfig{{Name: "a"}, {Name: "b"}}}
+	if _, err := cfg.Entity(""); err == nil {
+		t.Errorf("Expected error selecting from multiple entities without a name")
+	}
+	if ec, err := cfg.Entity("b"); err != nil || ec.Name != "b" {
+		t.Errorf("Expected entity b, got %v %v", ec, err)
+	}
+	if _, err := cfg.Entity("c"); err == nil {
+		t.Errorf("Expected error for a missing entity")
+	}
+}
+
+func TestNewEntities(t *testing.T) {
+	certBase64 := os.Getenv("CIS_P12_BASE64")
+	password := os.Getenv("FISKALHRGO_TEST_CERT_PASSWORD")
+	oib := os.Getenv("FISKALHRGO_TEST_CERT_OIB")
+	if certBase64 == "" || password == "" || oib == "" {
+		t.Skip("CIS_P12_BASE64, FISKALHRGO_TEST_CERT_PASSWORD or FISKALHRGO_TEST_CERT_OIB not set")
+	}
+	certData, err := base64.StdEncoding.DecodeString(certBase64)
+	if err != nil {
+		t.Fatalf("Failed to decode base64 certificate: %v", err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "fiskal.p12"), certData, 0600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	t.Setenv("FISKALCONFIG_TEST_DIR", dir)
+	t.Setenv("FISKALCONFIG_TEST_PASSWORD", password)
+
+	configPath := filepath.Join(dir, "fiskal.yaml")
+	data := strings.Replace(yamlConfig, "65049901548", oib, 1)
+	if err := os.WriteFile(configPath, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+	entities, err := cfg.NewEntities(fiskalhrgo.WithClock(fiskaltest.Clock))
+	var cfgErr *Error
+	if !errors.As(err, &cfgErr) || len(cfgErr.Entities) != 1 {
+		t.Fatalf("Expected shop2 to fail, got %v", err)
+	}
+	shop1, ok := entities["shop1"]
+	if !ok {
+		t.Fatalf("Expected shop1 to be created")
+	}
+	if shop1.OIB() != oib || shop1.SustPDV() || !shop1.DemoMode() || shop1.Language() != "en" {
+		t.Errorf("Unexpected entity settings")
+	}
+}
@@ -0,0 +1,203 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ErrorCategory classifies the errors returned by the request methods
+type ErrorCategory string
+
+const (
+	// CategoryInput is invalid input data or configuration, detected before anything is sent to CIS
+	CategoryInput ErrorCategory = "input"
+
+	// CategoryTransport is a network problem: DNS, connection refused or reset, timeout...
+	CategoryTransport ErrorCategory = "transport"
+
+	// CategoryTLS is a TLS handshake or server certificate verification problem
+	CategoryTLS ErrorCategory = "tls"
+
+	// CategorySignature is a problem with signing the request or the ZKI,
+	// including the certificate and signature errors reported by CIS (s002 - s005)
+	CategorySignature ErrorCategory = "signature"
+
+	// CategoryCISValidation is the request rejected by CIS because of the data (s001, s007, v and p series)
+	CategoryCISValidation ErrorCategory = "cis-validation"
+
+	// CategoryCISSystem is an error on the CIS side (s006, HTTP 5xx, SOAP server fault)
+	CategoryCISSystem ErrorCategory = "cis-system"
+
+	// CategoryResponse is a malformed or unexpected response (invalid XML, too large...)
+	CategoryResponse ErrorCategory = "response"
+
+	// CategoryOutcomeUnknown is a response that was received but can't be trusted (IdPoruke mismatch, invalid JIR,
+	// invalid signature, replayed or stale response). CIS may have fiscalized the invoice anyway, so check the
+	// status of the invoice (e.g. with ReceiptChecker) before sending it again, resending blindly can fiscalize it twice.
+	CategoryOutcomeUnknown ErrorCategory = "outcome-unknown"
+)
+
+// FiskalError is the error returned by all request methods (InvoiceRequest, EchoRequest, PingCIS, GetResponse...).
+// Use errors.As to get it and branch on the Category or Retriable instead of parsing error messages:
+//
+//	var fErr *fiskalhrgo.FiskalError
+//	if errors.As(err, &fErr) && fErr.Retriable() {
+//		queue.Enqueue(invoice, err)
+//	}
+//
+// The underlying error is available with errors.Unwrap, so errors.Is and errors.As still work
+// for CISError, SOAPFaultError, ErrResponseTooLarge, net.Error...
+type FiskalError struct {
+	// Category of the error
+	Category ErrorCategory
+
+	// Code is the CIS error code (the first one if there are more) or the SOAP fault code, empty otherwise
+	Code string
+
+	// Message is the error message
+	Message string
+
+	// StatusCode is the HTTP status code of the CIS response, 0 if there was no response
+	StatusCode int
+
+	// Err is the underlying error
+	Err error
+}
+
+func (e *FiskalError) Error() string {
+	if e.Message == "" && e.Err != nil {
+		return e.Err.Error()
+	}
+	return e.Message
+}
+
+// Unwrap returns the underlying error
+func (e *FiskalError) Unwrap() error {
+	return e.Err
+}
+
+// Retriable reports whether sending the same request again later can succeed.
+// Network problems and errors on the CIS side are retriable, invalid data, certificate and signature problems are not.
+// Neither is a response with an unknown outcome (CategoryOutcomeUnknown), the request may have been processed already.
+func (e *FiskalError) Retriable() bool {
+	switch e.Category {
+	case CategoryTransport, CategoryCISSystem:
+		return true
+	case CategoryResponse:
+		// A garbled response from a proxy (5xx, a redirect of a captive portal...) is usually transient, a 4xx status
+		// is not. A garbled 2xx response may come from CIS after the request was processed, so it is not retried either.
+		if e.StatusCode >= 200 && e.StatusCode < 300 {
+			return false
+		}
+		return e.StatusCode < 400 || e.StatusCode >= 500 ||
+			e.StatusCode == http.StatusRequestTimeout || e.StatusCode == http.StatusTooManyRequests
+	default:
+		return false
+	}
+}
+
+// IsRetriable reports whether the error is a FiskalError that can be retried
+func IsRetriable(err error) bool {
+	var fErr *FiskalError
+	return errors.As(err, &fErr) && fErr.Retriable()
+}
+
+// newFiskalError wraps the error in a FiskalError of the category
+func newFiskalError(category ErrorCategory, err error) *FiskalError {
+	return &FiskalError{Category: category, Message: err.Error(), Err: err}
+}
+
+// wrapFiskalError prefixes the message of the error, keeping the classification
+// if it is already a FiskalError, or classifying it in the fallback category otherwise
+func wrapFiskalError(message string, fallback ErrorCategory, err error) *FiskalError {
+	wrapped := &FiskalError{Category: fallback, Message: message + ": " + err.Error(), Err: err}
+	var fErr *FiskalError
+	if errors.As(err, &fErr) {
+		wrapped.Category = fErr.Category
+		wrapped.Code = fErr.Code
+		wrapped.StatusCode = fErr.StatusCode
+	}
+	return wrapped
+}
+
+// classifyRequestError returns the category of an error returned by http.Client.Do
+func classifyRequestError(err error) ErrorCategory {
+	var recordErr tls.RecordHeaderError
+	var verifyErr *tls.CertificateVerificationError
+	var unknownAuthErr x509.UnknownAuthorityError
+	var invalidErr x509.CertificateInvalidError
+	var hostnameErr x509.HostnameError
+	var alertErr tls.AlertError
+	switch {
+	case errors.As(err, &recordErr), errors.As(err, &verifyErr), errors.As(err, &unknownAuthErr),
+		errors.As(err, &invalidErr), errors.As(err, &hostnameErr), errors.As(err, &alertErr):
+		return CategoryTLS
+	default:
+		return CategoryTransport
+	}
+}
+
+// classifyStatus returns the category of an unexpected HTTP status code
+func classifyStatus(statusCode int) ErrorCategory {
+	if statusCode >= 500 {
+		return CategoryCISSystem
+	}
+	return CategoryResponse
+}
+
+// newCISFiskalError classifies the errors returned by CIS in the Greske element
+func newCISFiskalError(cisErrors error, statusCode int) *FiskalError {
+	fErr := &FiskalError{
+		Category:   CategoryCISValidation,
+		Message:    "errors in response: " + cisErrors.Error(),
+		StatusCode: statusCode,
+		Err:        cisErrors,
+	}
+
+	var list CISErrors
+	if !errors.As(cisErrors, &list) || len(list) == 0 {
+		return fErr
+	}
+	fErr.Code = list[0].Code
+
+	// The suggested actions of the knowledge base decide: only transient errors (s006) on their own are worth
+	// retrying, anything else will fail again until the data or the setup is fixed
+	transientOnly := true
+	for _, cisErr := range list {
+		info, _ := LookupCISError(cisErr.Code)
+		switch info.Action {
+		case CISActionRenewCertificate, CISActionCheckSetup:
+			fErr.Category = CategorySignature
+			return fErr
+		case CISActionRetryLater:
+		default:
+			transientOnly = false
+		}
+	}
+	if transientOnly {
+		fErr.Category = CategoryCISSystem
+	}
+	return fErr
+}
+
+// newSOAPFaultFiskalError classifies a SOAP fault, server faults are errors on the CIS side
+func newSOAPFaultFiskalError(fault *SOAPFaultError) *FiskalError {
+	category := CategoryCISValidation
+	if strings.HasSuffix(strings.ToLower(fault.Code), "server") {
+		category = CategoryCISSystem
+	}
+	return &FiskalError{
+		Category:   category,
+		Code:       fault.Code,
+		Message:    fault.Error(),
+		StatusCode: fault.StatusCode,
+		Err:        fault,
+	}
+}
@@ -5,15 +5,16 @@ package fiskalhrgo
 // Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
 
 import (
-	"crypto"
 	"crypto/md5"
-	"crypto/rand"
-	"crypto/rsa"
 	"crypto/sha1"
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -21,10 +22,19 @@ import (
 const production_url = "https://cis.porezna-uprava.hr:8449/FiskalizacijaService"
 const demo_url = "https://cistest.apis-it.hr:8449/FiskalizacijaServiceTest"
 const cistimeout = 10 //how long to wait at max for CIS response in seconds
+const defaultUserAgent = "FiskalhrGo"
 
 // FiskalEntity represents an entity involved in the fiscalization process.
 // It contains essential information and configurations required for generating
 // and verifying fiscal invoices in compliance with Croatian fiscalization laws.
+//
+// A FiskalEntity is safe for concurrent use: create one per taxpayer and share it between the goroutines
+// (the HTTP handlers of a web service, the POS terminals...), the requests to CIS reuse its connections.
+// The setters (SetEndpoint, SetLogger, SetJournal, SetRequestHeader...) and the certificate rotation can be
+// called while requests run, a request in progress uses either the old or the new setting. An invoice
+// (RacunType) is not safe for concurrent use, send each invoice from one goroutine at a time.
+// The hooks, callbacks and storage backends set on the entity are called concurrently and must be safe
+// for concurrent use.
 type FiskalEntity struct {
 	// oib is the taxpayer's identification number in Croatia (oib) and must match the oib in the certificate.
 	// This is a mandatory field for fiscalization.
@@ -46,6 +56,52 @@ type FiskalEntity struct {
 	// cert holds the certificate and private key used to sign invoices.
 	cert *certManager
 
+	// certProvider supplies the current and the historical certificates
+	certProvider CertProvider
+
+	// certRecheck is when the current certificate of a time selecting provider must be checked again, zero if never
+	certRecheck time.Time
+
+	// archive keeps the old certificates, see CertArchive
+	archive *CertArchive
+
+	// verifyChain requires the certificates to be issued by FINA, also when they are reloaded
+	verifyChain bool
+
+	// revocation checks the certificate revocation when it's loaded, nil if disabled
+	revocation *revocationChecker
+
+	// wipeKeys wipes the private keys on Close, see WithKeyWipe
+	wipeKeys bool
+
+	// unverifiedResponses accepts the CIS responses with a missing or invalid signature, see WithStrictResponseVerification
+	unverifiedResponses bool
+
+	// idempotency returns the JIR from the journal for an already fiscalized invoice, see WithIdempotency
+	idempotency bool
+
+	// schemaValidation validates the requests with ValidateRequestXML before sending, see WithSchemaValidation
+	schemaValidation bool
+
+	// responseVerifier replaces the built-in response signature verification, nil if not set
+	responseVerifier ResponseVerifier
+
+	// responseGuard rejects the stale and the replayed CIS responses, see WithResponseMaxSkew
+	responseGuard *responseGuard
+
+	// closed is set by Close, the entity can't sign afterwards
+	closed bool
+
+	// certMu guards cert, certProvider, certRecheck, archive, revocation and closed, which are replaced when the certificate is reloaded
+	certMu sync.RWMutex
+
+	// shuttingDown is set by Shutdown, new requests are refused while the requests in flight finish
+	shuttingDown bool
+
+	// requests counts the requests in flight, requestsMu guards it together with shuttingDown
+	requests   sync.WaitGroup
+	requestsMu sync.RWMutex
+
 	// ciscert holds the public key, issuer, subject, serial number, and validity dates of a CIS certificate.
 	// It is used to check the signature on CIS responses and contains the SSL root CA pool for SSL verification.
 	ciscert *signatureCheckCIScert
@@ -57,6 +113,76 @@ type FiskalEntity struct {
 	// url is the endpoint URL for the CIS service.
 	// This URL is used to send fiscalization requests to the CIS system.
 	url string
+
+	// httpClient is an optional user provided HTTP client used as a template for the communication with CIS.
+	// The TLS settings (CIS CA pool and minimal TLS version) are always enforced by the library.
+	httpClient *http.Client
+
+	// wrapTransport optionally wraps the transport used for the communication with CIS (tracing, logging...)
+	wrapTransport func(http.RoundTripper) http.RoundTripper
+
+	// transport delivers the requests to CIS, nil means the default HTTPS transport
+	transport Transport
+
+	// client is the cached HTTP client, reused for all requests so keep-alive connections
+	// to CIS are reused instead of doing a full TLS handshake for every invoice
+	client *http.Client
+
+	// userAgent and headers are sent with every request to CIS
+	userAgent string
+	headers   http.Header
+
+	// maxResponseSize limits the size of the CIS response body, 0 means the default
+	maxResponseSize int64
+
+	// clientMu guards the HTTP settings above and ciscert
+	clientMu sync.Mutex
+
+	// language of the error messages and hints produced by the library, Croatian by default
+	language Language
+
+	// version is the FiscalizationVersion of the messages sent with SendMessage, 0 for Fiscalization1
+	version atomic.Int32
+
+	// exchangeHook receives the raw request and response of every call to CIS
+	exchangeHook ExchangeHook
+
+	// messageArchive stores the signed requests and the CIS responses, nil if not set
+	messageArchive MessageArchive
+
+	// debugDumpDir is the directory of the debug dump, empty if it is disabled
+	debugDumpDir string
+
+	// clock checks the validity of the CIS certificates, nil for defaultClock, see WithClock
+	clock func() time.Time
+
+	// journal records every invoice request, nil if not set
+	journal Journal
+
+	// messageStore keeps the issued IdPoruke values with their outcomes, nil if not set
+	messageStore MessageStore
+
+	// idProvider creates the IDs of the invoice requests, nil for GenerateID
+	idProvider IDProvider
+
+	// logger and logLevels for the structured logging, nothing is logged if logger is nil
+	logger    *slog.Logger
+	logLevels *LogLevels
+
+	// redaction of the log records and the error messages, DefaultRedaction if nil
+	redaction *Redaction
+
+	// metrics receives the request measurements, nil if not set
+	metrics Metrics
+
+	// events holds the registered lifecycle callbacks
+	events eventHandlers
+
+	// hooksMu guards the hooks above
+	hooksMu sync.RWMutex
+
+	// stats are the in-memory statistics returned by Stats, guarded by their own mutex
+	stats statsCollector
 }
 
 // NewFiskalEntity creates a new FiskalEntity with provided values, validates certificates and input before returning an entity.
@@ -82,51 +208,64 @@ type FiskalEntity struct {
 //     not modified after the original fiscalization took place. It is recommended to save for each invoice a pointer or identifier of
 //     certificate used to generate the ZKI at the time not only the ZKI itself. And to keep in store old certificates. Normally fiskal certificates
 //     are valid for 5 years.
+//   - The certificate must be issued by the FINA production or demo CA (embedded in certProd and certDemo), otherwise
+//     ErrUntrustedCertificate is returned. Self-made test certificates need NewFiskalEntityWithOptions with WithChainVerification(false).
 //
 // Best Practices:
 //   - It is advisable to retain old certificates even after they expire, along with the ZKI, JIR, and the certificate's
 //     serial number or fingerprint. This ensures traceability and proof of which certificate was used to sign each invoice.
+//     The Journal (WithJournal) records this for every invoice request.
 //   - While expired certificates may be loaded to handle historical cases, it is mandatory to always use a valid,
 //     non-expired certificate when generating and sending new invoices.
 //
 // Returns:
 //   - (*FiskalEntity, error): A pointer to a new FiskalEntity instance with the provided values, or an error if the input is invalid.
+//
+// NewFiskalEntity is a wrapper around NewFiskalEntityWithOptions, use that for more settings (timeouts, logger, HTTP client...).
 func NewFiskalEntity(oib string, sustavPDV bool, locationID string, centralizedInvoiceNumber bool, demoMode bool, chk_expired bool, certPath string, certPassword string) (*FiskalEntity, error) {
+	return NewFiskalEntityWithOptions(oib,
+		WithVAT(sustavPDV),
+		WithLocation(locationID),
+		WithCentralizedInvoiceNumber(centralizedInvoiceNumber),
+		WithDemoMode(demoMode),
+		WithExpiredCheck(chk_expired),
+		WithCertFile(certPath, certPassword),
+	)
+}
 
-	// Check if OIB is valid
-	if !ValidateOIB(oib) {
-		return nil, errors.New("invalid OIB")
-	}
-
-	//check if locationID is valid
-	if !ValidateLocationID(locationID) {
-		return nil, errors.New("invalid locationID")
-	}
-
-	//check path is valid
-	if !IsFileReadable(certPath) {
-		return nil, errors.New("invalid certificate path or file not readable")
-	}
+// NewFiskalEntityFromP12 creates a new FiskalEntity like NewFiskalEntity, but with the P12 certificate
+// passed as data instead of a file path, so the certificate doesn't have to be written to disk
+// (e.g. when it comes from a secret store or an environment variable).
+func NewFiskalEntityFromP12(oib string, sustavPDV bool, locationID string, centralizedInvoiceNumber bool, demoMode bool, chk_expired bool, p12 []byte, certPassword string) (*FiskalEntity, error) {
+	return NewFiskalEntityWithOptions(oib,
+		WithVAT(sustavPDV),
+		WithLocation(locationID),
+		WithCentralizedInvoiceNumber(centralizedInvoiceNumber),
+		WithDemoMode(demoMode),
+		WithExpiredCheck(chk_expired),
+		WithCertP12(p12, certPassword),
+	)
+}
 
+// newFiskalEntityWithCert creates the entity with the decoded certificate, the input must be already validated
+func newFiskalEntityWithCert(oib string, sustavPDV bool, locationID string, centralizedInvoiceNumber bool, demoMode bool, chk_expired bool, cert *certManager, clock func() time.Time) (*FiskalEntity, error) {
 	var CIScert *signatureCheckCIScert
 	var CIScerterror error
 
+	now := defaultClock()
+	if clock != nil {
+		now = clock()
+	}
 	if demoMode {
-		CIScert, CIScerterror = getDemoPublicKey()
+		CIScert, CIScerterror = getDemoPublicKey(now)
 	} else {
-		CIScert, CIScerterror = getProductionPublicKey()
+		CIScert, CIScerterror = getProductionPublicKey(now)
 	}
 
 	if CIScerterror != nil {
 		return nil, fmt.Errorf("failed to get CIS public key and CA pool: %v", CIScerterror)
 	}
 
-	cert := newCertManager()
-	err := cert.decodeP12Cert(certPath, certPassword)
-	if err != nil {
-		return nil, fmt.Errorf("certificate decode fail: %v", err)
-	}
-
 	if !cert.init_ok {
 		return nil, errors.New("failed to initialize the certificate manager")
 	}
@@ -150,9 +289,13 @@ func NewFiskalEntity(oib string, sustavPDV bool, locationID string, centralizedI
 		locationID:               locationID,
 		centralizedInvoiceNumber: centralizedInvoiceNumber,
 		cert:                     cert,
+		archive:                  NewCertArchive(),
 		demoMode:                 demoMode,
 		ciscert:                  CIScert,
+		clock:                    clock,
 		url:                      url,
+		responseGuard:            newResponseGuard(defaultResponseMaxSkew),
+		stats:                    statsCollector{statsData: statsData{since: time.Now()}},
 	}, nil
 }
 
@@ -181,52 +324,91 @@ func (fe *FiskalEntity) DemoMode() bool {
 	return fe.demoMode
 }
 
+// SetLanguage sets the language of the CIS error explanations and hints (LangHR or LangEN).
+// CIS always returns Croatian messages, with LangEN they are translated using the built in catalog.
+func (fe *FiskalEntity) SetLanguage(lang Language) error {
+	if !lang.IsValid() {
+		return fmt.Errorf("unsupported language: %s", lang)
+	}
+	fe.language = lang
+	return nil
+}
+
+// Language returns the language of the CIS error explanations and hints.
+func (fe *FiskalEntity) Language() Language {
+	if fe == nil || fe.language == "" {
+		return LangHR
+	}
+	return fe.language
+}
+
 func (fe *FiskalEntity) DisplayCertInfoText() string {
-	return fe.cert.displayCertInfoText()
+	return fe.certificate().displayCertInfoText()
 }
 
 func (fe *FiskalEntity) DisplayCertInfoMarkdown() string {
-	return fe.cert.displayCertInfoMarkdown()
+	return fe.certificate().displayCertInfoMarkdown()
 }
 
 func (fe *FiskalEntity) DisplayCertInfoHTML() string {
 
-	return fe.cert.displayCertInfoHTML()
+	return fe.certificate().displayCertInfoHTML()
+}
+
+// DisplayCertInfoJSON returns the certificate details as indented JSON (see CertInfo), for dashboards and APIs
+func (fe *FiskalEntity) DisplayCertInfoJSON() string {
+	return fe.certificate().displayCertInfoJSON()
+}
+
+// GetCertInfo returns the certificate details, nil if no certificate is loaded
+func (fe *FiskalEntity) GetCertInfo() *CertInfo {
+	return fe.certificate().certInfo()
 }
 
 func (fe *FiskalEntity) DisplayCertInfoKeyPoints() [][2]string {
 
-	return fe.cert.displayCertInfoKeyPoints()
+	return fe.certificate().displayCertInfoKeyPoints()
 }
 
 // GetCertORG returns the organization name from the certificate.
 // The organization name is typically included in the certificate's subject field.
 func (fe *FiskalEntity) GetCertORG() string {
-	return fe.cert.certORG
+	return fe.certificate().certORG
 }
 
 // GetCertSERIAL returns the serial number from the certificate.
 // The serial number is a unique identifier assigned by the certificate issuer.
 func (fe *FiskalEntity) GetCertSERIAL() string {
-	return fe.cert.certSERIAL
+	return fe.certificate().certSERIAL
+}
+
+// GetCertFingerprintSHA1 returns the SHA-1 fingerprint of the certificate (lowercase hex of the DER encoding).
+// Store it with every invoice, together with the ZKI and the JIR, to prove which certificate produced the ZKI.
+func (fe *FiskalEntity) GetCertFingerprintSHA1() string {
+	return fe.certificate().fingerprintSHA1
+}
+
+// GetCertFingerprintSHA256 returns the SHA-256 fingerprint of the certificate (lowercase hex of the DER encoding).
+func (fe *FiskalEntity) GetCertFingerprintSHA256() string {
+	return fe.certificate().fingerprintSHA256
 }
 
 // IsExpired returns whether the certificate is expired.
 // This indicates if the certificate's validity period has ended.
 func (fe *FiskalEntity) IsExpired() bool {
-	return fe.cert.expired
+	return fe.certificate().expired
 }
 
 // IsExpiringSoon returns whether the certificate is expiring soon.
 // This indicates if the certificate is approaching its expiration date.
 func (fe *FiskalEntity) IsExpiringSoon() bool {
-	return fe.cert.expire_soon
+	return fe.certificate().expire_soon
 }
 
 // DaysUntilExpire returns the number of days until the certificate expires.
 // This provides a countdown of days remaining before the certificate becomes invalid.
 func (fe *FiskalEntity) DaysUntilExpire() uint16 {
-	return fe.cert.expire_days
+	return fe.certificate().expire_days
 }
 
 // GenerateZKI generates the ZKI (Zaštitni Kod Izdavatelja) based on the given data.
@@ -244,41 +426,75 @@ func (fe *FiskalEntity) DaysUntilExpire() uint16 {
 //   - string: The generated ZKI as a hexadecimal string.
 //   - error: An error if the ZKI generation fails, otherwise nil.
 func (entity *FiskalEntity) GenerateZKI(issueDateTime time.Time, invoiceNumber uint, deviceID uint, totalAmount string) (string, error) {
+	return entity.generateZKI(entity.certificate(), issueDateTime, invoiceNumber, deviceID, totalAmount)
+}
 
-	formattedTime := issueDateTime.Format("02.01.2006 15:04:05")
+// GenerateZKIWithCertificate generates the ZKI like GenerateZKI, but signed with the certificate with the
+// serial number or the SHA-1 or SHA-256 fingerprint, from the certificate provider or the archive (see CertArchive),
+// usually an expired one. It is used to prove during an inspection that an old invoice was not modified,
+// by recalculating its ZKI with the certificate used at the time.
+func (entity *FiskalEntity) GenerateZKIWithCertificate(ref string, issueDateTime time.Time, invoiceNumber uint, deviceID uint, totalAmount string) (string, error) {
+	historical, err := entity.FindCertificate(ref)
+	if err != nil {
+		return "", err
+	}
+	cert, err := entity.certManagerFor(historical)
+	if err != nil {
+		return "", err
+	}
+	return entity.generateZKI(cert, issueDateTime, invoiceNumber, deviceID, totalAmount)
+}
+
+// generateZKI generates the ZKI signed with the certificate
+func (entity *FiskalEntity) generateZKI(cert *certManager, issueDateTime time.Time, invoiceNumber uint, deviceID uint, totalAmount string) (string, error) {
+
+	hashed, err := zkiDigest(entity.oib, issueDateTime, invoiceNumber, entity.locationID, deviceID, totalAmount)
+	if err != nil {
+		return "", err
+	}
+
+	// Use the signer from the CertManager to sign the hashed data with SHA1
+	signature, err := cert.signZKI(hashed[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign data: %w", err)
+	}
 
+	return zkiFromSignature(signature), nil
+}
+
+// zkiDigest returns the SHA1 digest of the ZKI data (OIB, date, invoice number, location, device ID, total amount)
+func zkiDigest(oib string, issueDateTime time.Time, invoiceNumber uint, locationID string, deviceID uint, totalAmount string) ([sha1.Size]byte, error) {
 	// Ensure totalAmount is a valid decimal string with 2 decimal places
 	if !IsValidCurrencyFormat(totalAmount) {
-		return "", errors.New("invalid totalAmount format; expected a string with 2 decimal places (e.g., 100.00)")
+		return [sha1.Size]byte{}, errors.New("invalid totalAmount format; expected a string with 2 decimal places (e.g., 100.00)")
 	}
 
+	formattedTime := issueDateTime.Format("02.01.2006 15:04:05")
+
 	// Convert invoiceNumber and deviceID from uint to string
 	invoiceNumberStr := strconv.FormatUint(uint64(invoiceNumber), 10)
 	deviceIDStr := strconv.FormatUint(uint64(deviceID), 10)
 
 	// Concatenate the required data (oib, date, invoice number, location, device ID, total amount)
-	guardCode := entity.oib + formattedTime + invoiceNumberStr + entity.locationID + deviceIDStr + totalAmount
+	guardCode := oib + formattedTime + invoiceNumberStr + locationID + deviceIDStr + totalAmount
 
 	// Hash the concatenated data using SHA1
-	hashed := sha1.Sum([]byte(guardCode))
-
-	// Use the private key from the CertManager to sign the hashed data with RSA and SHA1
-	var signature []byte
-	signature, err := rsa.SignPKCS1v15(rand.Reader, entity.cert.privateKey, crypto.SHA1, hashed[:])
-	if err != nil {
-		return "", fmt.Errorf("failed to sign data: %v", err)
-	}
+	return sha1.Sum([]byte(guardCode)), nil
+}
 
-	// Generate the MD5 hash of the signature
+// zkiFromSignature returns the ZKI, the hexadecimal MD5 hash of the signature
+func zkiFromSignature(signature []byte) string {
 	md5Hash := md5.Sum(signature)
-
-	// Return the ZKI as a hexadecimal string
-	zki := fmt.Sprintf("%x", md5Hash[:])
-	return zki, nil
+	return fmt.Sprintf("%x", md5Hash[:])
 }
 
 // EchoRequest sends an echo request to CIS and processes the response.
 func (fe *FiskalEntity) EchoRequest(text string) (string, error) {
+	return fe.EchoRequestWithHeaders(text, nil)
+}
+
+// EchoRequestWithHeaders sends an echo request to CIS like EchoRequest, adding the extra HTTP headers to this request only.
+func (fe *FiskalEntity) EchoRequestWithHeaders(text string, header http.Header) (string, error) {
 	// Create an XML payload for the echo request
 	echoRequest := &EchoRequest{
 		Xmlns: DefaultNamespace,
@@ -287,20 +503,25 @@ func (fe *FiskalEntity) EchoRequest(text string) (string, error) {
 
 	xmlPayload, err := xml.Marshal(echoRequest)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal XML payload: %w", err)
+		return "", newFiskalError(CategoryInput, fmt.Errorf("failed to marshal XML payload: %w", err))
 	}
 
-	body, _, err := fe.GetResponse(xmlPayload, false)
+	body, status, err := fe.GetResponseWithHeaders(xmlPayload, false, header)
 	if err != nil {
-		return "", err
+		fe.log(failureLevel, "CIS echo request failed", errorAttrs(err)...)
+		return "", fe.redactError(err)
 	}
 
 	// Process the XML response
 	var echoResponse EchoResponse
 	if err := xml.Unmarshal(body, &echoResponse); err != nil {
-		return "", fmt.Errorf("failed to unmarshal XML response: %w", err)
+		fErr := newFiskalError(CategoryResponse, fmt.Errorf("failed to unmarshal XML response: %w", err))
+		fErr.StatusCode = status
+		fe.log(failureLevel, "CIS echo request failed", errorAttrs(fErr)...)
+		return "", fe.redactError(fErr)
 	}
 
+	fe.log(successLevel, "CIS echo request successful")
 	return echoResponse.Text, nil
 }
 
@@ -313,10 +534,10 @@ func (fe *FiskalEntity) PingCIS() error {
 	echoText := "Hello, CIS, from FiskalhrGo!"
 	response, err := fe.EchoRequest(echoText)
 	if err != nil {
-		return fmt.Errorf("CIS ping failed: %v", err)
+		return wrapFiskalError("CIS ping failed", CategoryTransport, err)
 	}
 	if response != echoText {
-		return fmt.Errorf("CIS ping failed: unexpected response")
+		return newFiskalError(CategoryResponse, errors.New("CIS ping failed: unexpected response"))
 	}
 	return nil
 }
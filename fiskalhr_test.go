@@ -6,19 +6,30 @@ package fiskalhrgo
 
 import (
 	"encoding/base64"
+	"encoding/json"
 	"encoding/xml"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
 	"testing"
 	"time"
 
 	"math/rand"
+
+	"github.com/l-d-t/fiskalhrgo/cisvcr"
+	"github.com/l-d-t/fiskalhrgo/fiskaltest"
 )
 
 var testEntity *FiskalEntity
 var testOIB, certPath, certPassword string
 
+// syntheticCert is set when the tests run with a synthetic certificate instead of the real one
+var syntheticCert bool
+
+// replayingCIS is set when the exchanges with CIS are replayed from the fixtures (see useCISFixtures)
+var replayingCIS bool
+
 // TestMain is run before any other tests. It sets up the shared instances and read env variables.
 func TestMain(m *testing.M) {
 
@@ -33,6 +44,9 @@ ___________.__        __           .__    ___ _____________    ________
 
 	fmt.Println("Setting up...")
 
+	// The embedded CIS certificates are checked at a fixed time, so the tests don't depend on their expiry
+	defaultClock = fiskaltest.Clock
+
 	certBase64 := os.Getenv("CIS_P12_BASE64")
 	certPassword = os.Getenv("FISKALHRGO_TEST_CERT_PASSWORD")
 	testOIB = os.Getenv("FISKALHRGO_TEST_CERT_OIB")
@@ -40,10 +54,12 @@ ___________.__        __           .__    ___ _____________    ________
 	if certBase64 == "" || certPassword == "" || testOIB == "" {
 		fmt.Println("CIS_P12_BASE64 or FISKALHRGO_TEST_CERT_PASSWORD or FISKALHRGO_TEST_CERT_OIB environment variables are not set")
 		fmt.Println(`
-		The CIS_P12_BASE64 environment variable must contain a single-line base64 
-		encoded string of the original valid Fiskal certificate in P12 format. This 
-		encoded string is essential for the tests to  interact with the CIS 
-		(Croatian Fiscalization System).
+		Using a synthetic certificate (see the fiskaltest package), the tests talking
+		to CIS replay the fixture exchanges or are skipped. To run them against CIS,
+		the CIS_P12_BASE64 environment variable must
+		contain a single-line base64 encoded string of the original valid Fiskal
+		certificate in P12 format. This encoded string is essential for the tests to
+		interact with the CIS (Croatian Fiscalization System).
 		
 		To encode your P12 certificate file (e.g., fiskalDemo1.p12) to a single-line 
 		base64 string on a Linux system, use the following command:
@@ -61,7 +77,9 @@ ___________.__        __           .__    ___ _____________    ________
 		environment variables. This makes it easy and convenient to manage. The 
 		certificate, password, and OIB for tests can be easily stored as GitHub 
 		Action secrets, for example.`)
-		os.Exit(1)
+
+		syntheticCert = true
+		certBase64, certPassword, testOIB = syntheticP12Base64()
 	}
 
 	fmt.Printf("Test OIB: %s\n", testOIB)
@@ -88,6 +106,13 @@ ___________.__        __           .__    ___ _____________    ________
 		os.Exit(1)
 	}
 
+	// The replayed responses don't depend on the certificate, so the synthetic one works too
+	replayingCIS, err = useCISFixtures(testEntity, cisFixtures)
+	if err != nil {
+		fmt.Printf("Failed to set up CIS fixtures: %v\n", err)
+		os.Exit(1)
+	}
+
 	fmt.Println("Running tests...")
 	// Run tests
 	code := m.Run()
@@ -96,6 +121,135 @@ ___________.__        __           .__    ___ _____________    ________
 	os.Exit(code)
 }
 
+// syntheticP12Base64 creates a synthetic certificate for the fake OIB when the real one is not available.
+// Its CA is trusted as a FINA CA and the environment variables are set, so the tests reading them get it too.
+func syntheticP12Base64() (string, string, string) {
+	const password = "fiskaltest"
+	cert, err := fiskaltest.NewCertificate(fiskaltest.OIB)
+	if err != nil {
+		fmt.Printf("Failed to create the synthetic certificate: %v\n", err)
+		os.Exit(1)
+	}
+	data, err := cert.P12(password)
+	if err != nil {
+		fmt.Printf("Failed to encode the synthetic certificate: %v\n", err)
+		os.Exit(1)
+	}
+	roots, _, err := loadFinaCAs()
+	if err != nil {
+		fmt.Printf("Failed to load the FINA CA certificates: %v\n", err)
+		os.Exit(1)
+	}
+	roots.AddCert(cert.CACert)
+
+	certBase64 := base64.StdEncoding.EncodeToString(data)
+	os.Setenv("CIS_P12_BASE64", certBase64)
+	os.Setenv("FISKALHRGO_TEST_CERT_PASSWORD", password)
+	os.Setenv("FISKALHRGO_TEST_CERT_OIB", fiskaltest.OIB)
+	return certBase64, password, fiskaltest.OIB
+}
+
+// requireRealCert skips the test with the synthetic certificate, CIS accepts only the real one.
+// The replayed exchanges don't need it.
+func requireRealCert(t *testing.T) {
+	t.Helper()
+	if syntheticCert && !replayingCIS {
+		t.Skip("CIS_P12_BASE64 not set, the test needs the real certificate")
+	}
+}
+
+// cisFixtures is the file with the CIS exchanges replayed by the tests. The committed one is synthetic,
+// generated against the ciscmock server, not recorded from the demo CIS.
+const cisFixtures = "testdata/cis_fixtures.json"
+
+// useCISFixtures replays the CIS exchanges if the fixture file exists, or records them
+// with FISKALHRGO_VCR=record. With FISKALHRGO_VCR=live the tests always talk to the demo CIS.
+// It reports whether the exchanges are replayed.
+//
+// The replayed responses have the IdPoruke and the time of the current request, so they are signed again with
+// a test key and its certificate is trusted by the entity instead of the CIS one, the response signature is
+// still verified.
+func useCISFixtures(fe *FiskalEntity, path string) (bool, error) {
+	mode := os.Getenv("FISKALHRGO_VCR")
+	switch mode {
+	case "live":
+		return false, nil
+	case "record":
+		fmt.Printf("Recording CIS exchanges to %s\n", path)
+		vcr, err := cisvcr.New(path, cisvcr.ModeRecord)
+		if err != nil {
+			return false, err
+		}
+		fe.SetTransportWrapper(vcr.Wrap)
+		return false, nil
+	case "", "replay":
+		if _, err := os.Stat(path); err != nil {
+			if mode == "replay" {
+				return false, err
+			}
+			return false, nil
+		}
+		fmt.Printf("Replaying CIS exchanges from %s\n", path)
+		vcr, err := cisvcr.New(path, cisvcr.ModeReplay)
+		if err != nil {
+			return false, err
+		}
+		key, cert, err := newCISSigningCert(24 * time.Hour)
+		if err != nil {
+			return false, err
+		}
+		vcr.SetResponseSigner(func(response []byte) ([]byte, error) {
+			signed, err := signCISResponse(key, string(response), MakeC14N10RecCanonicalizer())
+			return []byte(signed), err
+		})
+		fe.clientMu.Lock()
+		fe.ciscert = newSignatureCheckCIScert(cert, fe.cisCertificateLocked().SSLverifyPoll)
+		fe.clientMu.Unlock()
+		fe.SetTransportWrapper(vcr.Wrap)
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown FISKALHRGO_VCR mode: %s", mode)
+	}
+}
+
+// TestCISFixturesReplay checks the replayed responses pass the response signature verification
+func TestCISFixturesReplay(t *testing.T) {
+	// The recorded response is signed by CIS, its signature doesn't match after the IdPoruke is replaced
+	recordedKey, _ := newTestCISSigningCert(t)
+	response := fmt.Sprintf(testCISResponse, "G0x1", "f81d4fae-7dec-11d0-a765-00a0c91e6bf6", "01.01.2026T10:00:00", "9d6f5bb6-da48-4fcd-a803-4586a025e0e4")
+	data, err := json.Marshal(&cisvcr.Cassette{Interactions: []*cisvcr.Interaction{{
+		Operation:   "RacunZahtjev",
+		StatusCode:  http.StatusOK,
+		ContentType: "text/xml",
+		Response:    signTestCISResponse(t, recordedKey, response, MakeC14N10RecCanonicalizer()),
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "cis.json")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("FISKALHRGO_VCR", "replay")
+
+	fe := newTestEntity(t)
+	if replaying, err := useCISFixtures(fe, path); err != nil || !replaying {
+		t.Fatalf("Failed to replay the fixtures: %v", err)
+	}
+	if fe.unverifiedResponses {
+		t.Fatal("Expected the response signature to be verified")
+	}
+	for i := uint(1); i <= 2; i++ {
+		invoice, _, err := fe.NewCISInvoice(time.Now(), i, 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "10.00", CISCash, "12345678901")
+		if err != nil {
+			t.Fatalf("Failed to create invoice: %v", err)
+		}
+		if jir, _, err := invoice.InvoiceRequest(); err != nil || jir != "9d6f5bb6-da48-4fcd-a803-4586a025e0e4" {
+			t.Fatalf("Expected the replayed JIR, got %s, %v", jir, err)
+		}
+	}
+}
+
 func TestCertOutput(t *testing.T) {
 	t.Logf("Testing certificate output...")
 
@@ -184,6 +338,7 @@ func TestKnownZKI(t *testing.T) {
 
 // Test CISEcho
 func TestCISEcho(t *testing.T) {
+	requireRealCert(t)
 	t.Logf("Testing CISEcho...")
 	msg := "Hello, CIS, from FiskalhrGo!"
 
@@ -203,6 +358,7 @@ func TestCISEcho(t *testing.T) {
 }
 
 func TestPing(t *testing.T) {
+	requireRealCert(t)
 	t.Log("Testing Ping...")
 	err := testEntity.PingCIS()
 	if err != nil {
@@ -235,6 +391,7 @@ func TestProductionPing(t *testing.T) {
 
 // Test CIS invoice with helper functions
 func TestNewCISInvoice(t *testing.T) {
+	requireRealCert(t)
 	pdvValues := [][]interface{}{
 		{"25.00", "1000.00", "250.00"},
 	}
@@ -362,7 +519,7 @@ func TestNewCISInvoice(t *testing.T) {
 }
 
 func TestSimpleInvoiceFromReadme(t *testing.T) {
-
+	requireRealCert(t)
 	invoice, _, err := testEntity.NewCISInvoice(
 		time.Now(),
 		uint(1236), // invoice number
@@ -402,3 +559,13 @@ func TestSimpleInvoiceFromReadme(t *testing.T) {
 	t.Logf("We got a JIR!: %v, ZKI: %v", jir, zkiR)
 
 }
+
+func BenchmarkGenerateZKI(b *testing.B) {
+	issued := time.Now()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := testEntity.GenerateZKI(issued, uint(i+1), 1, "100.00"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Package fiskalmock has the mocks of the fiskalhrgo interfaces for the unit tests of the applications, to test
+// a checkout flow without a certificate or network:
+//
+//	client := &fiskalmock.Client{
+//		InvoiceRequestFunc: func(invoice *fiskalhrgo.RacunType) (string, string, error) {
+//			return "9d6f5bb6-da48-4fcd-a803-4586a025e0e4", invoice.ZastKod, nil
+//		},
+//	}
+//	err := Checkout(client, invoice)
+//	if client.CallCount("InvoiceRequest") != 1 { ... }
+//
+// A method without the function set returns the zero values and ErrNotStubbed. The mocks are generated from
+// the interfaces, run go generate after changing them.
+package fiskalmock
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+//go:generate go run ../internal/mockgen -o mocks_gen.go
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrNotStubbed is returned by a method of a mock without its function set
+var ErrNotStubbed = errors.New("method not stubbed")
+
+// Call is a recorded call of a mock method
+type Call struct {
+	Method string
+	Args   []any
+}
+
+// Recorder records the calls of a mock, it is safe for concurrent use
+type Recorder struct {
+	mu    sync.Mutex
+	calls []Call
+}
+
+// Calls returns the recorded calls in order
+func (r *Recorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Call(nil), r.calls...)
+}
+
+// CallCount returns the number of the recorded calls of the method
+func (r *Recorder) CallCount(method string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	count := 0
+	for _, call := range r.calls {
+		if call.Method == method {
+			count++
+		}
+	}
+	return count
+}
+
+// Reset forgets the recorded calls
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = nil
+}
+
+func (r *Recorder) record(method string, args ...any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, Call{Method: method, Args: args})
+}
+
+// notStubbed returns ErrNotStubbed for the method
+func notStubbed(method string) error {
+	return fmt.Errorf("%s: %w", method, ErrNotStubbed)
+}
@@ -0,0 +1,54 @@
+package fiskalmock
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/l-d-t/fiskalhrgo"
+)
+
+// checkout is a checkout flow of an application under test
+func checkout(client fiskalhrgo.FiskalClient, invoice *fiskalhrgo.RacunType, tip string) (string, error) {
+	jir, _, err := client.InvoiceRequest(invoice)
+	if err != nil {
+		return "", err
+	}
+	if tip != "" {
+		if _, err := client.AddTipRequest(invoice, tip, fiskalhrgo.CISCard); err != nil {
+			return jir, err
+		}
+	}
+	return jir, nil
+}
+
+func TestClient(t *testing.T) {
+	const jir = "9d6f5bb6-da48-4fcd-a803-4586a025e0e4"
+	invoice := &fiskalhrgo.RacunType{ZastKod: "e3a4d7bd1d5c2b4a8f0c9e6d7b1a2c3f"}
+	client := &Client{
+		InvoiceRequestFunc: func(invoice *fiskalhrgo.RacunType) (string, string, error) {
+			return jir, invoice.ZastKod, nil
+		},
+	}
+
+	if got, err := checkout(client, invoice, ""); err != nil || got != jir {
+		t.Fatalf("Unexpected checkout %s, %v", got, err)
+	}
+
+	// A method without the function fails with ErrNotStubbed
+	if _, err := checkout(client, invoice, "2.00"); !errors.Is(err, ErrNotStubbed) {
+		t.Errorf("Expected ErrNotStubbed, got %v", err)
+	}
+
+	calls := client.Calls()
+	if len(calls) != 3 || client.CallCount("InvoiceRequest") != 2 || calls[2].Method != "AddTipRequest" || calls[2].Args[1] != "2.00" {
+		t.Errorf("Unexpected calls %+v", calls)
+	}
+	client.Reset()
+	if len(client.Calls()) != 0 {
+		t.Error("Expected no calls after Reset")
+	}
+}
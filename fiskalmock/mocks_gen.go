@@ -0,0 +1,69 @@
+// Code generated by internal/mockgen. DO NOT EDIT.
+
+package fiskalmock
+
+import "github.com/l-d-t/fiskalhrgo"
+
+// Client is the mock of fiskalhrgo.FiskalClient
+type Client struct {
+	Recorder
+
+	// AddTipRequestFunc is called by AddTipRequest
+	AddTipRequestFunc func(*fiskalhrgo.RacunType, string, fiskalhrgo.PaymentMethod) (*fiskalhrgo.NapojnicaOdgovor, error)
+
+	// ChangePaymentMethodRequestFunc is called by ChangePaymentMethodRequest
+	ChangePaymentMethodRequestFunc func(*fiskalhrgo.RacunType, fiskalhrgo.PaymentMethod) (*fiskalhrgo.PromijeniNacPlacOdgovor, error)
+
+	// EchoRequestFunc is called by EchoRequest
+	EchoRequestFunc func(string) (string, error)
+
+	// InvoiceRequestFunc is called by InvoiceRequest
+	InvoiceRequestFunc func(*fiskalhrgo.RacunType) (string, string, error)
+}
+
+var _ fiskalhrgo.FiskalClient = (*Client)(nil)
+
+// AddTipRequest records the call and calls AddTipRequestFunc
+func (m *Client) AddTipRequest(a0 *fiskalhrgo.RacunType, a1 string, a2 fiskalhrgo.PaymentMethod) (*fiskalhrgo.NapojnicaOdgovor, error) {
+	m.record("AddTipRequest", a0, a1, a2)
+	if m.AddTipRequestFunc != nil {
+		return m.AddTipRequestFunc(a0, a1, a2)
+	}
+	var r0 *fiskalhrgo.NapojnicaOdgovor
+	r1 := notStubbed("Client.AddTipRequest")
+	return r0, r1
+}
+
+// ChangePaymentMethodRequest records the call and calls ChangePaymentMethodRequestFunc
+func (m *Client) ChangePaymentMethodRequest(a0 *fiskalhrgo.RacunType, a1 fiskalhrgo.PaymentMethod) (*fiskalhrgo.PromijeniNacPlacOdgovor, error) {
+	m.record("ChangePaymentMethodRequest", a0, a1)
+	if m.ChangePaymentMethodRequestFunc != nil {
+		return m.ChangePaymentMethodRequestFunc(a0, a1)
+	}
+	var r0 *fiskalhrgo.PromijeniNacPlacOdgovor
+	r1 := notStubbed("Client.ChangePaymentMethodRequest")
+	return r0, r1
+}
+
+// EchoRequest records the call and calls EchoRequestFunc
+func (m *Client) EchoRequest(a0 string) (string, error) {
+	m.record("EchoRequest", a0)
+	if m.EchoRequestFunc != nil {
+		return m.EchoRequestFunc(a0)
+	}
+	var r0 string
+	r1 := notStubbed("Client.EchoRequest")
+	return r0, r1
+}
+
+// InvoiceRequest records the call and calls InvoiceRequestFunc
+func (m *Client) InvoiceRequest(a0 *fiskalhrgo.RacunType) (string, string, error) {
+	m.record("InvoiceRequest", a0)
+	if m.InvoiceRequestFunc != nil {
+		return m.InvoiceRequestFunc(a0)
+	}
+	var r0 string
+	var r1 string
+	r2 := notStubbed("Client.InvoiceRequest")
+	return r0, r1, r2
+}
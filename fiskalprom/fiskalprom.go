@@ -0,0 +1,135 @@
+// Package fiskalprom exposes fiskalhrgo metrics to Prometheus.
+//
+// A single Collector can be shared by all entities in a process and registered once:
+//
+//	collector := fiskalprom.New("fiskalhr")
+//	prometheus.MustRegister(collector)
+//	entity.SetMetrics(collector)
+//	collector.WatchQueue("main", queue)
+//
+// and served with promhttp.Handler() as usual.
+package fiskalprom
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"sync"
+	"time"
+
+	fiskalhrgo "github.com/l-d-t/fiskalhrgo"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector implements fiskalhrgo.Metrics and prometheus.Collector.
+//
+// Exposed metrics (with the namespace prefix):
+//   - requests_total{operation,outcome}: number of requests to CIS by outcome ("success" or the error category)
+//   - request_duration_seconds{operation,outcome}: CIS request latency
+//   - signing_duration_seconds: time spent signing the request messages
+//   - queue_depth{queue}: number of invoices waiting in the watched offline queues
+//   - queue_errors_total{queue}: number of failures reading the queue depth
+type Collector struct {
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	signDuration    prometheus.Histogram
+	queueDepth      *prometheus.Desc
+	queueErrors     *prometheus.CounterVec
+
+	mu     sync.Mutex
+	queues map[string]*fiskalhrgo.OfflineQueue
+}
+
+var _ fiskalhrgo.Metrics = (*Collector)(nil)
+var _ prometheus.Collector = (*Collector)(nil)
+
+// New creates a Collector with the metric names prefixed by the namespace (can be empty).
+func New(namespace string) *Collector {
+	return &Collector{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "requests_total",
+			Help:      "Number of requests to CIS by operation and outcome.",
+		}, []string{"operation", "outcome"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "request_duration_seconds",
+			Help:      "Latency of the requests to CIS.",
+			Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 3, 5, 10},
+		}, []string{"operation", "outcome"}),
+		signDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "signing_duration_seconds",
+			Help:      "Time spent signing the request messages.",
+			Buckets:   []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1},
+		}),
+		queueDepth: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "queue_depth"),
+			"Number of invoices waiting in the offline queue.",
+			[]string{"queue"}, nil,
+		),
+		queueErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "queue_errors_total",
+			Help:      "Number of failures reading the offline queue depth.",
+		}, []string{"queue"}),
+		queues: make(map[string]*fiskalhrgo.OfflineQueue),
+	}
+}
+
+// ObserveRequest implements fiskalhrgo.Metrics
+func (c *Collector) ObserveRequest(operation string, outcome string, duration time.Duration) {
+	c.requests.WithLabelValues(operation, outcome).Inc()
+	c.requestDuration.WithLabelValues(operation, outcome).Observe(duration.Seconds())
+}
+
+// ObserveSigning implements fiskalhrgo.Metrics
+func (c *Collector) ObserveSigning(duration time.Duration) {
+	c.signDuration.Observe(duration.Seconds())
+}
+
+// WatchQueue reports the depth of the offline queue under the name on every scrape. The depth is the number
+// kept by the queue (see OfflineQueue.Len), the store is not listed on every scrape. Watching another queue with the same name replaces it, nil stops watching.
+func (c *Collector) WatchQueue(name string, queue *fiskalhrgo.OfflineQueue) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if queue == nil {
+		delete(c.queues, name)
+		return
+	}
+	c.queues[name] = queue
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.requests.Describe(ch)
+	c.requestDuration.Describe(ch)
+	c.signDuration.Describe(ch)
+	c.queueErrors.Describe(ch)
+	ch <- c.queueDepth
+}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	queues := make(map[string]*fiskalhrgo.OfflineQueue, len(c.queues))
+	for name, queue := range c.queues {
+		queues[name] = queue
+	}
+	c.mu.Unlock()
+
+	for name, queue := range queues {
+		depth, err := queue.Len()
+		if err != nil {
+			c.queueErrors.WithLabelValues(name).Inc()
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.queueDepth, prometheus.GaugeValue, float64(depth), name)
+	}
+
+	c.requests.Collect(ch)
+	c.requestDuration.Collect(ch)
+	c.signDuration.Collect(ch)
+	c.queueErrors.Collect(ch)
+}
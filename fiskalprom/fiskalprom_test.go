@@ -0,0 +1,59 @@
+package fiskalprom
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	fiskalhrgo "github.com/l-d-t/fiskalhrgo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	c := New("fiskalhr")
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(c); err != nil {
+		t.Fatalf("Failed to register collector: %v", err)
+	}
+
+	c.ObserveRequest("RacunZahtjev", "success", 150*time.Millisecond)
+	c.ObserveRequest("RacunZahtjev", "success", 250*time.Millisecond)
+	c.ObserveRequest("RacunZahtjev", "transport", 3*time.Second)
+	c.ObserveSigning(2 * time.Millisecond)
+
+	expected := `
+# HELP fiskalhr_requests_total Number of requests to CIS by operation and outcome.
+# TYPE fiskalhr_requests_total counter
+fiskalhr_requests_total{operation="RacunZahtjev",outcome="success"} 2
+fiskalhr_requests_total{operation="RacunZahtjev",outcome="transport"} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "fiskalhr_requests_total"); err != nil {
+		t.Errorf("Unexpected requests metric: %v", err)
+	}
+
+	if count := testutil.CollectAndCount(c, "fiskalhr_signing_duration_seconds"); count != 1 {
+		t.Errorf("Expected the signing histogram, got %d metrics", count)
+	}
+
+	queue, err := (&fiskalhrgo.FiskalEntity{}).NewOfflineQueue(fiskalhrgo.NewMemoryQueueStore())
+	if err != nil {
+		t.Fatalf("Failed to create queue: %v", err)
+	}
+	queue.Enqueue(&fiskalhrgo.RacunType{ZastKod: "a1"}, nil)
+	queue.Enqueue(&fiskalhrgo.RacunType{ZastKod: "b2"}, nil)
+	c.WatchQueue("main", queue)
+
+	expected = `
+# HELP fiskalhr_queue_depth Number of invoices waiting in the offline queue.
+# TYPE fiskalhr_queue_depth gauge
+fiskalhr_queue_depth{queue="main"} 2
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "fiskalhr_queue_depth"); err != nil {
+		t.Errorf("Unexpected queue depth metric: %v", err)
+	}
+}
@@ -0,0 +1,25 @@
+module github.com/l-d-t/fiskalhrgo/fiskalprom
+
+go 1.22
+
+require (
+	github.com/l-d-t/fiskalhrgo v0.0.0-20261017065920-6ae870992c34
+	github.com/prometheus/client_golang v1.20.5
+)
+
+require (
+	github.com/beevik/etree v1.4.1 // indirect
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/kylelemons/godebug v1.1.0 // indirect
+	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
+	github.com/prometheus/client_model v0.6.1 // indirect
+	github.com/prometheus/common v0.55.0 // indirect
+	github.com/prometheus/procfs v0.15.1 // indirect
+	golang.org/x/crypto v0.28.0 // indirect
+	golang.org/x/sys v0.26.0 // indirect
+	google.golang.org/protobuf v1.35.1 // indirect
+	rsc.io/qr v0.2.0 // indirect
+	software.sslmate.com/src/go-pkcs12 v0.7.3 // indirect
+)
@@ -0,0 +1,276 @@
+// Package fiskalstream publishes the fiscalization events of an entity (invoice sent, JIR received, failed,
+// queued for a retry) to a message broker, so the back-office systems consume the fiscal data in real time
+// without polling the journal.
+//
+// The package doesn't depend on a broker client, the Publisher adapts the client the application already uses.
+// With NATS (github.com/nats-io/nats.go) the subject is the topic:
+//
+//	stream := fiskalstream.Attach(entity, fiskalstream.NATS(nc.Publish), fiskalstream.Options{})
+//	defer stream.Close(context.Background())
+//
+// and with Kafka (github.com/segmentio/kafka-go) the messages are keyed by the ZKI, so the events of an invoice
+// stay in order in a partition:
+//
+//	publisher := fiskalstream.Kafka(func(ctx context.Context, topic string, key, value []byte) error {
+//		return writer.WriteMessages(ctx, kafka.Message{Topic: topic, Key: key, Value: value})
+//	})
+//
+// The events are published asynchronously from a buffer, a slow or unavailable broker never delays a sale.
+// When the buffer is full the events are dropped and counted (see Dropped), the journal stays the complete record.
+package fiskalstream
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	fiskalhrgo "github.com/l-d-t/fiskalhrgo"
+)
+
+const (
+	// defaultPrefix is the default prefix of the topics
+	defaultPrefix = "fiskal"
+
+	// defaultBuffer is the default number of events waiting to be published
+	defaultBuffer = 1000
+
+	// defaultTimeout is the default timeout of a single publish
+	defaultTimeout = 5 * time.Second
+)
+
+// EventType is the kind of the fiscalization event, the last part of the topic
+type EventType string
+
+const (
+	EventSent       EventType = "sent"       // The invoice is being sent to CIS
+	EventFiscalized EventType = "fiscalized" // CIS returned the JIR
+	EventFailed     EventType = "failed"     // Sending the invoice to CIS failed
+	EventQueued     EventType = "queued"     // The invoice is in the offline queue waiting for a retry
+)
+
+// Event is the JSON payload of the published messages
+type Event struct {
+	Type          EventType `json:"type"`
+	Time          time.Time `json:"time"`
+	OIB           string    `json:"oib"`
+	InvoiceNumber string    `json:"invoice_number,omitempty"`
+	IssuedAt      string    `json:"issued_at,omitempty"`
+	Total         string    `json:"total,omitempty"`
+	PaymentMethod string    `json:"payment_method,omitempty"`
+	ZKI           string    `json:"zki"`
+	JIR           string    `json:"jir,omitempty"`
+	LateDelivery  bool      `json:"late_delivery,omitempty"`
+
+	// Error and Category (see fiskalhrgo.ErrorCategory) of a failed request
+	Error    string `json:"error,omitempty"`
+	Category string `json:"category,omitempty"`
+
+	// Attempts is the number of the delivery attempts of a queued invoice
+	Attempts int `json:"attempts,omitempty"`
+}
+
+// Message is a message for the broker
+type Message struct {
+	Topic string
+	Key   []byte
+	Value []byte
+}
+
+// Publisher sends the messages to the broker
+type Publisher interface {
+	Publish(ctx context.Context, msg *Message) error
+}
+
+// PublisherFunc adapts a function to the Publisher interface
+type PublisherFunc func(ctx context.Context, msg *Message) error
+
+// Publish calls the function
+func (f PublisherFunc) Publish(ctx context.Context, msg *Message) error {
+	return f(ctx, msg)
+}
+
+// NATS returns the Publisher using the publish function of a NATS connection (nats.Conn.Publish),
+// the topic is the subject
+func NATS(publish func(subject string, data []byte) error) Publisher {
+	return PublisherFunc(func(_ context.Context, msg *Message) error {
+		return publish(msg.Topic, msg.Value)
+	})
+}
+
+// Kafka returns the Publisher using the function writing a message to a Kafka topic
+func Kafka(write func(ctx context.Context, topic string, key, value []byte) error) Publisher {
+	return PublisherFunc(func(ctx context.Context, msg *Message) error {
+		return write(ctx, msg.Topic, msg.Key, msg.Value)
+	})
+}
+
+// Options configure the Stream
+type Options struct {
+	// Prefix of the topics, "fiskal" by default, e.g. "fiskal.fiscalized"
+	Prefix string
+
+	// Buffer is the number of events waiting to be published, 1000 by default
+	Buffer int
+
+	// Timeout of a single publish, 5 seconds by default
+	Timeout time.Duration
+
+	// OnError is called with the failed publishes, from the publishing goroutine. Optional.
+	OnError func(event *Event, err error)
+}
+
+// Stream publishes the events of an entity
+type Stream struct {
+	publisher Publisher
+	opts      Options
+	oib       string
+
+	mu     sync.RWMutex
+	closed bool
+	events chan *Event
+	done   chan struct{}
+
+	dropped atomic.Uint64
+	failed  atomic.Uint64
+}
+
+// Attach registers the event callbacks on the entity and starts publishing its events.
+// Close the stream to publish the buffered events and stop, the callbacks do nothing afterwards.
+func Attach(fe *fiskalhrgo.FiskalEntity, publisher Publisher, opts Options) *Stream {
+	if opts.Prefix == "" {
+		opts.Prefix = defaultPrefix
+	}
+	if opts.Buffer <= 0 {
+		opts.Buffer = defaultBuffer
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	s := &Stream{
+		publisher: publisher,
+		opts:      opts,
+		oib:       fe.OIB(),
+		events:    make(chan *Event, opts.Buffer),
+		done:      make(chan struct{}),
+	}
+
+	fe.OnInvoiceSent(func(invoice *fiskalhrgo.RacunType) {
+		s.enqueue(s.invoiceEvent(EventSent, invoice))
+	})
+	fe.OnJIRReceived(func(invoice *fiskalhrgo.RacunType, jir string) {
+		event := s.invoiceEvent(EventFiscalized, invoice)
+		event.JIR = jir
+		s.enqueue(event)
+	})
+	fe.OnCISError(func(invoice *fiskalhrgo.RacunType, err error) {
+		event := s.invoiceEvent(EventFailed, invoice)
+		event.Error = err.Error()
+		var fErr *fiskalhrgo.FiskalError
+		if errors.As(err, &fErr) {
+			event.Category = string(fErr.Category)
+		}
+		s.enqueue(event)
+	})
+	fe.OnRetryScheduled(func(item *fiskalhrgo.QueuedInvoice) {
+		event := s.invoiceEvent(EventQueued, item.Invoice)
+		event.ZKI, event.Attempts, event.Error = item.ZKI, item.Attempts, item.LastError
+		s.enqueue(event)
+	})
+
+	go s.run()
+	return s
+}
+
+// invoiceEvent returns the event with the invoice data
+func (s *Stream) invoiceEvent(eventType EventType, invoice *fiskalhrgo.RacunType) *Event {
+	event := &Event{Type: eventType, Time: time.Now(), OIB: s.oib}
+	if invoice == nil {
+		return event
+	}
+	event.IssuedAt = invoice.DatVrijeme
+	event.Total = invoice.IznosUkupno
+	event.PaymentMethod = invoice.NacinPlac
+	event.ZKI = invoice.ZastKod
+	event.LateDelivery = invoice.NakDost
+	if invoice.BrRac != nil {
+		event.InvoiceNumber = fmt.Sprintf("%d/%s/%d", invoice.BrRac.BrOznRac, invoice.BrRac.OznPosPr, invoice.BrRac.OznNapUr)
+	}
+	return event
+}
+
+// enqueue adds the event to the buffer, the event is dropped if the buffer is full or the stream is closed
+func (s *Stream) enqueue(event *Event) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.events <- event:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// run publishes the buffered events until the stream is closed
+func (s *Stream) run() {
+	defer close(s.done)
+	for event := range s.events {
+		if err := s.publish(event); err != nil {
+			s.failed.Add(1)
+			if s.opts.OnError != nil {
+				s.opts.OnError(event, err)
+			}
+		}
+	}
+}
+
+// publish sends a single event
+func (s *Stream) publish(event *Event) error {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.opts.Timeout)
+	defer cancel()
+	return s.publisher.Publish(ctx, &Message{
+		Topic: s.opts.Prefix + "." + string(event.Type),
+		Key:   []byte(event.ZKI),
+		Value: value,
+	})
+}
+
+// Dropped returns the number of events dropped because the buffer was full
+func (s *Stream) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Failed returns the number of events the publisher failed to publish
+func (s *Stream) Failed() uint64 {
+	return s.failed.Load()
+}
+
+// Close stops accepting the events and waits until the buffered ones are published or the context is done
+func (s *Stream) Close(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.events)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
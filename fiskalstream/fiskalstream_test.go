@@ -0,0 +1,162 @@
+package fiskalstream
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	fiskalhrgo "github.com/l-d-t/fiskalhrgo"
+	"github.com/l-d-t/fiskalhrgo/fiskaltest"
+)
+
+// recorder is a Publisher keeping the published messages
+type recorder struct {
+	mu       sync.Mutex
+	messages []*Message
+}
+
+func (r *recorder) Publish(_ context.Context, msg *Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = append(r.messages, msg)
+	return nil
+}
+
+func newTestEntity(t *testing.T) *fiskalhrgo.FiskalEntity {
+	t.Helper()
+	cert, err := fiskaltest.NewCertificate(fiskaltest.OIB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p12, err := cert.P12("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: &http.Transport{DialContext: func(context.Context, string, string) (net.Conn, error) {
+		return nil, errors.New("cis is down")
+	}}}
+	fe, err := fiskalhrgo.NewFiskalEntityWithOptions(fiskaltest.OIB, fiskalhrgo.WithLocation("TEST1"),
+		fiskalhrgo.WithCertP12(p12, "secret"), fiskalhrgo.WithDemoMode(true), fiskalhrgo.WithChainVerification(false),
+		fiskalhrgo.WithHTTPClient(client), fiskalhrgo.WithClock(fiskaltest.Clock))
+	if err != nil {
+		t.Fatalf("Failed to create entity: %v", err)
+	}
+	return fe
+}
+
+func TestStream(t *testing.T) {
+	fe := newTestEntity(t)
+	rec := &recorder{}
+	stream := Attach(fe, rec, Options{Prefix: "pos"})
+
+	invoice, zki, err := fe.NewCISInvoice(time.Now(), 7, 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "10.00", fiskalhrgo.CISCash, "12345678901")
+	if err != nil {
+		t.Fatalf("Failed to create invoice: %v", err)
+	}
+	if _, _, err := invoice.InvoiceRequest(); err == nil {
+		t.Fatal("Expected the request to fail")
+	}
+	queue, err := fe.NewOfflineQueue(fiskalhrgo.NewMemoryQueueStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := queue.Enqueue(invoice, errors.New("cis is down")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := stream.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// Events after Close are ignored
+	stream.enqueue(&Event{Type: EventSent})
+
+	topics := []string{"pos.sent", "pos.failed", "pos.queued"}
+	if len(rec.messages) != len(topics) {
+		t.Fatalf("Expected %d messages, got %d", len(topics), len(rec.messages))
+	}
+	for i, msg := range rec.messages {
+		if msg.Topic != topics[i] || string(msg.Key) != zki {
+			t.Errorf("Unexpected message %s %s", msg.Topic, msg.Key)
+		}
+		var event Event
+		if err := json.Unmarshal(msg.Value, &event); err != nil {
+			t.Fatalf("Invalid event: %v", err)
+		}
+		if event.OIB != fiskaltest.OIB || event.InvoiceNumber != "7/TEST1/1" || event.Total != "10.00" || event.ZKI != zki {
+			t.Errorf("Unexpected event %+v", event)
+		}
+		switch event.Type {
+		case EventFailed:
+			if event.Error == "" || event.Category != string(fiskalhrgo.CategoryTransport) {
+				t.Errorf("Expected the transport error, got %q %q", event.Error, event.Category)
+			}
+		case EventQueued:
+			if event.Error != "cis is down" {
+				t.Errorf("Expected the queueing cause, got %q", event.Error)
+			}
+		}
+	}
+}
+
+func TestStreamDropped(t *testing.T) {
+	release := make(chan struct{})
+	var failed []*Event
+	publisher := PublisherFunc(func(ctx context.Context, msg *Message) error {
+		<-release
+		return errors.New("broker is down")
+	})
+	stream := Attach(&fiskalhrgo.FiskalEntity{}, publisher, Options{Buffer: 1, OnError: func(event *Event, err error) {
+		failed = append(failed, event)
+	}})
+
+	// The first event is being published, the second waits in the buffer and the third is dropped
+	stream.enqueue(&Event{Type: EventSent})
+	time.Sleep(50 * time.Millisecond)
+	stream.enqueue(&Event{Type: EventFiscalized})
+	stream.enqueue(&Event{Type: EventFailed})
+	if stream.Dropped() != 1 {
+		t.Errorf("Expected a dropped event, got %d", stream.Dropped())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := stream.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the close to time out, got %v", err)
+	}
+	close(release)
+	if err := stream.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if stream.Failed() != 2 || len(failed) != 2 || failed[1].Type != EventFiscalized {
+		t.Errorf("Expected both published events to fail, got %d", stream.Failed())
+	}
+}
+
+func TestAdapters(t *testing.T) {
+	msg := &Message{Topic: "fiskal.sent", Key: []byte("zki"), Value: []byte("{}")}
+	var subject string
+	NATS(func(s string, data []byte) error {
+		subject = s
+		return nil
+	}).Publish(context.Background(), msg)
+	if subject != msg.Topic {
+		t.Errorf("Expected the topic as the NATS subject, got %q", subject)
+	}
+	var key []byte
+	Kafka(func(ctx context.Context, topic string, k, value []byte) error {
+		key = k
+		return nil
+	}).Publish(context.Background(), msg)
+	if string(key) != "zki" {
+		t.Errorf("Expected the ZKI as the Kafka key, got %q", key)
+	}
+}
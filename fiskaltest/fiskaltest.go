@@ -0,0 +1,130 @@
+// Package fiskaltest generates synthetic fiscal certificates for tests, so the tests of the ZKI, the signing
+// and the application logic can run in forks and CI without the real (secret) FINA certificate.
+//
+// The certificates have the FINA subject format (the OIB in the organization, country HR) and are issued
+// by a generated CA. They are not issued by FINA, so the entity must be created with
+// fiskalhrgo.WithChainVerification(false), and CIS rejects them: only the true CIS round trips
+// need the real certificate.
+//
+//	cert, err := fiskaltest.NewCertificate(fiskaltest.OIB)
+//	p12, err := cert.P12("secret")
+//	entity, err := fiskalhrgo.NewFiskalEntityWithOptions(fiskaltest.OIB, fiskalhrgo.WithLocation("TEST1"),
+//		fiskalhrgo.WithCertP12(p12, "secret"), fiskalhrgo.WithDemoMode(true), fiskalhrgo.WithChainVerification(false),
+//		fiskalhrgo.WithClock(fiskaltest.Clock))
+package fiskaltest
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	gopkcs12 "software.sslmate.com/src/go-pkcs12"
+)
+
+// OIB is a fake OIB with a valid check digit for the synthetic certificates
+const OIB = "99999999994"
+
+// CISCertTime is a fixed time within the validity of the embedded CIS certificates. Create the test entities
+// with fiskalhrgo.WithClock(fiskaltest.Clock), so the tests don't start failing when the embedded CIS
+// certificates expire.
+var CISCertTime = time.Date(2025, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+// Clock returns CISCertTime, for fiskalhrgo.WithClock
+func Clock() time.Time {
+	return CISCertTime
+}
+
+// Certificate is a synthetic fiscal certificate with its private key and the issuing CA
+type Certificate struct {
+	Key    *rsa.PrivateKey
+	Cert   *x509.Certificate
+	CACert *x509.Certificate
+}
+
+// NewCertificate creates a certificate for the OIB, valid from an hour ago for a year
+func NewCertificate(oib string) (*Certificate, error) {
+	now := time.Now()
+	return NewCertificateValidity(oib, now.Add(-time.Hour), now.Add(365*24*time.Hour))
+}
+
+// NewCertificateValidity creates a certificate for the OIB with the validity period, e.g. an expired one.
+// The CA is valid from an hour before notBefore until a year after notAfter.
+func NewCertificateValidity(oib string, notBefore time.Time, notAfter time.Time) (*Certificate, error) {
+	if !notAfter.After(notBefore) {
+		return nil, fmt.Errorf("notAfter must be after notBefore")
+	}
+	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate the CA key: %w", err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Fiskal Test CA", Organization: []string{"fiskaltest"}, Country: []string{"HR"}},
+		NotBefore:             notBefore.Add(-time.Hour),
+		NotAfter:              notAfter.Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the CA certificate: %w", err)
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate the key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 63))
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   "FISKAL 1",
+			Organization: []string{"FISKALTEST D.O.O. HR" + oib},
+			Locality:     []string{"ZAGREB"},
+			Country:      []string{"HR"},
+		},
+		NotBefore: notBefore,
+		NotAfter:  notAfter,
+		KeyUsage:  x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &Certificate{Key: key, Cert: cert, CACert: caCert}, nil
+}
+
+// P12 encodes the certificate, the key and the CA as a P12 bundle with the password
+func (c *Certificate) P12(password string) ([]byte, error) {
+	return gopkcs12.Modern.Encode(c.Key, c.Cert, []*x509.Certificate{c.CACert}, password)
+}
+
+// WriteP12 writes the P12 bundle to the file
+func (c *Certificate) WriteP12(path string, password string) error {
+	data, err := c.P12(password)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
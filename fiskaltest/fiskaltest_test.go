@@ -0,0 +1,60 @@
+package fiskaltest
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	fiskalhrgo "github.com/l-d-t/fiskalhrgo"
+)
+
+func TestCertificateEntity(t *testing.T) {
+	if !fiskalhrgo.ValidateOIB(OIB) {
+		t.Fatalf("Invalid fake OIB %s", OIB)
+	}
+	cert, err := NewCertificate(OIB)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "fiskal.p12")
+	if err := cert.WriteP12(path, "secret"); err != nil {
+		t.Fatalf("Failed to write P12: %v", err)
+	}
+
+	fe, err := fiskalhrgo.NewFiskalEntityWithOptions(OIB, fiskalhrgo.WithLocation("TEST1"), fiskalhrgo.WithDemoMode(true),
+		fiskalhrgo.WithCertFile(path, "secret"), fiskalhrgo.WithChainVerification(false), fiskalhrgo.WithClock(Clock))
+	if err != nil {
+		t.Fatalf("Failed to create entity: %v", err)
+	}
+	if fe.GetCertSERIAL() != cert.Cert.SerialNumber.String() {
+		t.Errorf("Unexpected certificate serial %s", fe.GetCertSERIAL())
+	}
+	zki, err := fe.GenerateZKI(time.Now(), 1, 1, "10.00")
+	if err != nil || !fiskalhrgo.ValidateZKI(zki) {
+		t.Errorf("Failed to generate ZKI: %s %v", zki, err)
+	}
+
+	// Not issued by FINA
+	if _, err := fiskalhrgo.NewFiskalEntityWithOptions(OIB, fiskalhrgo.WithLocation("TEST1"), fiskalhrgo.WithDemoMode(true),
+		fiskalhrgo.WithCertFile(path, "secret"), fiskalhrgo.WithClock(Clock)); err == nil {
+		t.Errorf("Expected the synthetic certificate to be rejected with the chain verification")
+	}
+}
+
+func TestCertificateValidity(t *testing.T) {
+	notAfter := time.Now().Add(-time.Hour).Truncate(time.Second)
+	cert, err := NewCertificateValidity(OIB, notAfter.Add(-24*time.Hour), notAfter)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	if !cert.Cert.NotAfter.Equal(notAfter) {
+		t.Errorf("Expected the certificate to expire at %v, got %v", notAfter, cert.Cert.NotAfter)
+	}
+	if _, err := NewCertificateValidity(OIB, notAfter, notAfter); err == nil {
+		t.Errorf("Expected an error for an empty validity period")
+	}
+}
@@ -0,0 +1,95 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"crypto/x509"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/l-d-t/fiskalhrgo/sign"
+)
+
+// The fuzz targets feed malformed and adversarial CIS responses to the response processing,
+// which must return an error instead of panicking or hanging. Run one with e.g.
+//
+//	go test -run XXX -fuzz FuzzParseRacunOdgovor -fuzztime 1m
+
+// fuzzTimeout is the longest time the processing of a single input may take
+const fuzzTimeout = 5 * time.Second
+
+// addResponseSeeds adds valid and broken CIS responses to the corpus
+func addResponseSeeds(f *testing.F) {
+	key, _ := newTestCISSigningCert(f)
+	response := fmt.Sprintf(testCISResponse, "G0x1", "f81d4fae-7dec-11d0-a765-00a0c91e6bf6", "01.01.2026T10:00:00", "9d6f5bb6-da48-4fcd-a803-4586a025e0e4")
+	signed := signTestCISResponse(f, key, response, MakeC14N10RecCanonicalizer())
+	for _, seed := range []string{
+		response,
+		signed,
+		signed[:len(signed)/2],
+		`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault><faultcode>soap:Server</faultcode><faultstring>Internal error</faultstring></soap:Fault></soap:Body></soap:Envelope>`,
+		`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><tns:RacunOdgovor xmlns:tns="http://www.apis-it.hr/fin/2012/types/f73" Id="G0x1"><tns:Greske><tns:Greska><tns:SifraGreske>s006</tns:SifraGreske><tns:PorukaGreske>Sistemska pogreška</tns:PorukaGreske></tns:Greska></tns:Greske></tns:RacunOdgovor></soap:Body></soap:Envelope>`,
+		`<tns:RacunOdgovor xmlns:tns="http://www.apis-it.hr/fin/2012/types/f73"><tns:Jir>x</tns:Jir></tns:RacunOdgovor>`,
+		`<Envelope><Body><a Id="x"><Signature><SignedInfo><Reference URI="#x"/></SignedInfo><KeyInfo><X509Data><X509Certificate>AAAA</X509Certificate></X509Data></KeyInfo></Signature></a></Body></Envelope>`,
+		`<!DOCTYPE a [<!ENTITY b "bbbbbbbb">]><a>&b;&b;&b;</a>`,
+		"",
+	} {
+		f.Add([]byte(seed))
+	}
+}
+
+// checkDuration fails the input that took too long to process
+func checkDuration(t *testing.T, started time.Time) {
+	if elapsed := time.Since(started); elapsed > fuzzTimeout {
+		t.Errorf("processing took %v", elapsed)
+	}
+}
+
+// FuzzResponseContent covers the SOAP envelope unmarshaling and the SOAP Fault detection
+func FuzzResponseContent(f *testing.F) {
+	addResponseSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		defer checkDuration(t, time.Now())
+		responseContent(data)
+	})
+}
+
+// FuzzParseRacunOdgovor covers the parsing of the invoice responses and their errors
+func FuzzParseRacunOdgovor(f *testing.F) {
+	addResponseSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		defer checkDuration(t, time.Now())
+		if racunOdgovor, err := ParseRacunOdgovor(data); err == nil && racunOdgovor == nil {
+			t.Error("Expected the response or an error")
+		}
+		for _, lang := range []Language{LangHR, LangEN} {
+			ParseGreske(data, lang)
+		}
+	})
+}
+
+// FuzzResponseSignature covers the extraction of the signature element and the KeyInfo certificate
+// and the verification of the signature
+func FuzzResponseSignature(f *testing.F) {
+	addResponseSeeds(f)
+	_, cert := newTestCISSigningCert(f)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	ciscert := newSignatureCheckCIScert(cert, pool)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		defer checkDuration(t, time.Now())
+		if signature, err := sign.EnvelopeSignature(data); err == nil && signature != nil {
+			sign.KeyInfoCertificate(signature)
+		}
+		if signer, err := ciscert.responseSigner(data); err == nil && signer == nil {
+			t.Error("Expected the signer or an error")
+		}
+		if err := sign.VerifyEnvelope(data, cert); err == nil {
+			t.Errorf("Unexpected valid signature of %q", data)
+		}
+		VerifyXMLSigner(data)
+	})
+}
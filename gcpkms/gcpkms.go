@@ -0,0 +1,123 @@
+// Package gcpkms signs fiscalization messages with an RSA key held in Google Cloud KMS,
+// so the private key never leaves the KMS.
+//
+// CIS requires RSA PKCS #1 v1.5 signatures over SHA-1 digests, which Cloud KMS supports only through the raw
+// PKCS #1 algorithms, so the key version must use RSA_SIGN_RAW_PKCS1_2048, _3072 or _4096. The FINA certificate
+// is issued for the key (create a CSR signed by the KMS key), and is passed together with the signer:
+//
+//	client, err := kms.NewKeyManagementClient(ctx)
+//	signer, err := gcpkms.New(client, "projects/p/locations/l/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1", cert)
+//	entity, err := fiskalhrgo.NewFiskalEntityWithOptions(oib, fiskalhrgo.WithLocation("POS1"), fiskalhrgo.WithSigner(signer, cert))
+//
+// AWS KMS has no SHA-1 or raw PKCS #1 signing and can't produce signatures accepted by CIS,
+// use AWS CloudHSM through its PKCS #11 library instead.
+package gcpkms
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"time"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// DefaultTimeout of a signing request
+const DefaultTimeout = 10 * time.Second
+
+// Client is the part of the Cloud KMS client used by the Signer, implemented by *kms.KeyManagementClient
+type Client interface {
+	AsymmetricSign(ctx context.Context, req *kmspb.AsymmetricSignRequest, opts ...gax.CallOption) (*kmspb.AsymmetricSignResponse, error)
+}
+
+// Signer is a crypto.Signer using a Cloud KMS key version
+type Signer struct {
+	client  Client
+	name    string
+	public  *rsa.PublicKey
+	timeout time.Duration
+}
+
+// New creates the signer for the key version resource name, the certificate must be issued for the key
+func New(client Client, keyVersionName string, cert *x509.Certificate) (*Signer, error) {
+	if client == nil {
+		return nil, errors.New("client is nil")
+	}
+	if keyVersionName == "" {
+		return nil, errors.New("key version name is required")
+	}
+	if cert == nil {
+		return nil, errors.New("certificate is nil")
+	}
+	public, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("certificate public key is not of RSA type")
+	}
+	return &Signer{client: client, name: keyVersionName, public: public, timeout: DefaultTimeout}, nil
+}
+
+// SetTimeout sets the timeout of a signing request, DefaultTimeout if zero or negative
+func (s *Signer) SetTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	s.timeout = timeout
+}
+
+// Public implements crypto.Signer
+func (s *Signer) Public() crypto.PublicKey {
+	return s.public
+}
+
+// Sign implements crypto.Signer, it signs the digest with RSA PKCS #1 v1.5, PSS is not supported
+func (s *Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if _, ok := opts.(*rsa.PSSOptions); ok {
+		return nil, errors.New("PSS signatures are not supported")
+	}
+	hash := opts.HashFunc()
+	data, err := digestInfo(hash, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	resp, err := s.client.AsymmetricSign(ctx, &kmspb.AsymmetricSignRequest{
+		Name:       s.name,
+		Data:       data,
+		DataCrc32C: wrapperspb.Int64(crc32c(data)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cloud KMS signing failed: %w", err)
+	}
+
+	// Detect corruption in transit, as recommended by Google
+	if !resp.GetVerifiedDataCrc32C() {
+		return nil, errors.New("cloud KMS signing failed: request corrupted in transit")
+	}
+	if resp.GetSignatureCrc32C() == nil || resp.GetSignatureCrc32C().GetValue() != crc32c(resp.GetSignature()) {
+		return nil, errors.New("cloud KMS signing failed: response corrupted in transit")
+	}
+
+	signature := resp.GetSignature()
+	if err := rsa.VerifyPKCS1v15(s.public, hash, digest, signature); err != nil {
+		return nil, fmt.Errorf("cloud KMS signature does not match the certificate: %w", err)
+	}
+	return signature, nil
+}
+
+func crc32c(data []byte) int64 {
+	return int64(crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli)))
+}
@@ -0,0 +1,87 @@
+package gcpkms
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"testing"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// fakeKMS signs like a RSA_SIGN_RAW_PKCS1 key version
+type fakeKMS struct {
+	key     *rsa.PrivateKey
+	corrupt bool
+	req     *kmspb.AsymmetricSignRequest
+}
+
+func (f *fakeKMS) AsymmetricSign(ctx context.Context, req *kmspb.AsymmetricSignRequest, opts ...gax.CallOption) (*kmspb.AsymmetricSignResponse, error) {
+	f.req = req
+	signature, err := rsa.SignPKCS1v15(nil, f.key, 0, req.Data)
+	if err != nil {
+		return nil, err
+	}
+	crc := crc32c(signature)
+	if f.corrupt {
+		crc++
+	}
+	return &kmspb.AsymmetricSignResponse{
+		Name:               req.Name,
+		Signature:          signature,
+		SignatureCrc32C:    wrapperspb.Int64(crc),
+		VerifiedDataCrc32C: req.DataCrc32C.GetValue() == crc32c(req.Data),
+	}, nil
+}
+
+func TestSigner(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := &x509.Certificate{PublicKey: &key.PublicKey}
+	client := &fakeKMS{key: key}
+
+	signer, err := New(client, "projects/p/locations/l/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1", cert)
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+
+	digest := sha1.Sum([]byte("ZKI data"))
+	signature, err := signer.Sign(rand.Reader, digest[:], crypto.SHA1)
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	expected, _ := rsa.SignPKCS1v15(nil, key, crypto.SHA1, digest[:])
+	if string(signature) != string(expected) {
+		t.Errorf("Expected the same signature as a local RSA key")
+	}
+	if client.req.Name != "projects/p/locations/l/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1" {
+		t.Errorf("Unexpected key version name: %s", client.req.Name)
+	}
+
+	client.corrupt = true
+	if _, err := signer.Sign(rand.Reader, digest[:], crypto.SHA1); err == nil {
+		t.Errorf("Expected error for a corrupted response")
+	}
+	client.corrupt = false
+
+	if _, err := signer.Sign(rand.Reader, digest[:], &rsa.PSSOptions{Hash: crypto.SHA1}); err == nil {
+		t.Errorf("Expected error for PSS")
+	}
+
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	wrongSigner, _ := New(&fakeKMS{key: otherKey}, "k", cert)
+	if _, err := wrongSigner.Sign(rand.Reader, digest[:], crypto.SHA1); err == nil {
+		t.Errorf("Expected error for a key not matching the certificate")
+	}
+}
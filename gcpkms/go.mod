@@ -0,0 +1,20 @@
+module github.com/l-d-t/fiskalhrgo/gcpkms
+
+go 1.22
+
+require (
+	cloud.google.com/go/kms v1.20.1
+	github.com/googleapis/gax-go/v2 v2.13.0
+	google.golang.org/protobuf v1.35.1
+)
+
+require (
+	cloud.google.com/go/longrunning v0.6.1 // indirect
+	golang.org/x/net v0.30.0 // indirect
+	golang.org/x/sys v0.26.0 // indirect
+	golang.org/x/text v0.19.0 // indirect
+	google.golang.org/api v0.203.0 // indirect
+	google.golang.org/genproto/googleapis/api v0.0.0-20241007155032-5fefd90f89a9 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20241015192408-796eee8c2d53 // indirect
+	google.golang.org/grpc v1.67.1 // indirect
+)
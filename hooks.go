@@ -0,0 +1,58 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import "time"
+
+// Exchange is a single request/response exchange with CIS, as passed to the ExchangeHook
+type Exchange struct {
+	// Operation is the name of the request message, e.g. "RacunZahtjev" or "EchoRequest"
+	Operation string
+
+	// Request is the exact SOAP envelope sent to CIS, including the signature for signed messages
+	Request []byte
+
+	// Response is the raw response body as received from CIS, nil if no response was received
+	Response []byte
+
+	// StatusCode is the HTTP status code of the response, 0 if no response was received
+	StatusCode int
+
+	// Metadata describes the HTTP response and the TLS connection, nil if no response was received
+	// or the transport is not based on HTTP
+	Metadata *ResponseMetadata
+
+	// Started is the time the request was sent
+	Started time.Time
+
+	// Duration is the time from sending the request to processing the response
+	Duration time.Duration
+
+	// Err is the error returned to the caller, nil on success
+	Err error
+}
+
+// ExchangeHook is called after every exchange with CIS, successful or not.
+// It is called synchronously from the request method, so it should return quickly,
+// and it must not modify the Request and Response slices.
+type ExchangeHook func(exchange *Exchange)
+
+// SetExchangeHook sets the hook receiving the raw request and response of every call to CIS,
+// e.g. for archiving the signed messages for audit or for support debugging. Use nil to remove it.
+func (fe *FiskalEntity) SetExchangeHook(hook ExchangeHook) {
+	fe.hooksMu.Lock()
+	defer fe.hooksMu.Unlock()
+	fe.exchangeHook = hook
+}
+
+// notifyExchange calls the exchange hook if one is set
+func (fe *FiskalEntity) notifyExchange(exchange *Exchange) {
+	fe.hooksMu.RLock()
+	hook := fe.exchangeHook
+	fe.hooksMu.RUnlock()
+	if hook != nil {
+		hook(exchange)
+	}
+}
@@ -0,0 +1,51 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+)
+
+func TestExchangeHook(t *testing.T) {
+	fe := newTestServerEntity(t, echoHandler)
+
+	var exchanges []*Exchange
+	fe.SetExchangeHook(func(exchange *Exchange) {
+		exchanges = append(exchanges, exchange)
+	})
+
+	if _, err := fe.EchoRequest("audit me"); err != nil {
+		t.Fatalf("EchoRequest failed: %v", err)
+	}
+
+	if len(exchanges) != 1 {
+		t.Fatalf("Expected 1 exchange, got %d", len(exchanges))
+	}
+	ex := exchanges[0]
+	if !bytes.Contains(ex.Request, []byte("audit me")) || !bytes.Contains(ex.Request, []byte("Envelope")) {
+		t.Errorf("Expected the full SOAP request, got %s", ex.Request)
+	}
+	if !bytes.Contains(ex.Response, []byte("<tns:EchoResponse")) || !bytes.Contains(ex.Response, []byte("soap:Envelope")) {
+		t.Errorf("Expected the raw SOAP response, got %s", ex.Response)
+	}
+	if ex.StatusCode != http.StatusOK || ex.Err != nil || ex.Started.IsZero() {
+		t.Errorf("Unexpected exchange: %+v", ex)
+	}
+
+	// Failed exchanges are reported too
+	fe.url = "https://127.0.0.1:1/FiskalizacijaService"
+	_, err := fe.EchoRequest("fail")
+	if len(exchanges) != 2 || exchanges[1].Err != err || exchanges[1].Response != nil {
+		t.Errorf("Expected the failed exchange to be reported, got %+v", exchanges)
+	}
+
+	fe.SetExchangeHook(nil)
+	fe.EchoRequest("no hook")
+	if len(exchanges) != 2 {
+		t.Errorf("Expected no exchange after removing the hook")
+	}
+}
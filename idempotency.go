@@ -0,0 +1,71 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"log/slog"
+)
+
+// WithIdempotency sets whether an invoice already fiscalized according to the journal is sent again, false by default.
+// When enabled, the invoice request looks up the ZKI in the journal (see WithJournal) before sending and returns the
+// stored JIR if there is one, with InvoiceResult.FromJournal set. This prevents a duplicate fiscalization when the
+// application retries an invoice after a crash that happened after the CIS response was received.
+// Without a journal the option has no effect.
+func WithIdempotency(enabled bool) Option {
+	return func(o *entityOptions) {
+		o.idempotency = enabled
+	}
+}
+
+// fiscalizedEntry returns the journal entry of the invoice with the JIR, nil if the invoice is not fiscalized
+func fiscalizedEntry(journal Journal, zki string) (*JournalEntry, error) {
+	entries, err := journal.FindByZKI(zki)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.JIR != "" {
+			return entry, nil
+		}
+	}
+	return nil, nil
+}
+
+// journaledResult fills the result from the journal if idempotency is enabled and the invoice is already fiscalized.
+// A journal that can't be read is logged and the invoice is sent, failing the sale would be worse than a duplicate.
+func (fe *FiskalEntity) journaledResult(invoice *RacunType, result *InvoiceResult) bool {
+	if !fe.idempotency {
+		return false
+	}
+	fe.hooksMu.RLock()
+	journal := fe.journal
+	fe.hooksMu.RUnlock()
+	if journal == nil {
+		return false
+	}
+
+	entry, err := fiscalizedEntry(journal, invoice.ZastKod)
+	if err != nil {
+		fe.log(failureLevel, "failed to look up the invoice in the journal", append(errorAttrs(err), slog.String("zki", invoice.ZastKod))...)
+		return false
+	}
+	if entry == nil {
+		return false
+	}
+	if entry.InvoiceNumber != invoiceNumber(invoice) || entry.Total != invoice.IznosUkupno {
+		fe.log(failureLevel, "journaled invoice with the same ZKI differs, sending the invoice",
+			slog.String("zki", invoice.ZastKod), slog.String("journaled_invoice", entry.InvoiceNumber))
+		return false
+	}
+	result.JIR = entry.JIR
+	result.IdPoruke = entry.IdPoruke
+	result.DatumVrijeme = entry.ResponseTime
+	result.StatusCode = entry.StatusCode
+	result.CertSerial = entry.CertSerial
+	result.FromJournal = true
+	result.Warnings = append(result.Warnings, "the invoice was already fiscalized, the JIR is from the journal")
+	fe.log(successLevel, "invoice already fiscalized, not sent again", slog.String("zki", invoice.ZastKod), slog.String("jir", entry.JIR))
+	return true
+}
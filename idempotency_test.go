@@ -0,0 +1,76 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+func TestIdempotency(t *testing.T) {
+	key, cert := newTestCISSigningCert(t)
+	var requests atomic.Int32
+	fe := newTestServerEntity(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		doc := etree.NewDocument()
+		if _, err := doc.ReadFrom(r.Body); err != nil {
+			t.Error(err)
+			return
+		}
+		response := fmt.Sprintf(testCISResponse, "G0x1", doc.FindElement("//IdPoruke").Text(), doc.FindElement("//DatumVrijeme").Text(), "9d6f5bb6-da48-4fcd-a803-4586a025e0e4")
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprint(w, signTestCISResponse(t, key, response, MakeC14N10RecCanonicalizer()))
+	})
+	fe.ciscert = newSignatureCheckCIScert(cert, fe.ciscert.SSLverifyPoll)
+	fe.idempotency = true
+
+	invoice, _, err := fe.NewCISInvoice(time.Now(), 1, 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "10.00", CISCash, "12345678901")
+	if err != nil {
+		t.Fatalf("Failed to create invoice: %v", err)
+	}
+
+	// Without a journal the option has no effect
+	if _, _, err := invoice.InvoiceRequest(); err != nil {
+		t.Fatalf("Failed to send invoice: %v", err)
+	}
+	fe.SetJournal(NewMemoryJournal())
+	first, err := invoice.InvoiceRequestResult()
+	if err != nil || first.FromJournal {
+		t.Fatalf("Expected the invoice to be sent, got %+v %v", first, err)
+	}
+	if requests.Load() != 2 {
+		t.Fatalf("Expected 2 requests, got %d", requests.Load())
+	}
+
+	second, err := invoice.InvoiceRequestResult()
+	if err != nil {
+		t.Fatalf("Failed to get the journaled result: %v", err)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("Expected the fiscalized invoice not to be sent again, got %d requests", requests.Load())
+	}
+	if !second.FromJournal || second.JIR != first.JIR || second.IdPoruke != first.IdPoruke || second.DatumVrijeme != first.DatumVrijeme || len(second.Warnings) == 0 {
+		t.Errorf("Expected the stored result, got %+v", second)
+	}
+
+	// An invoice with a different ZKI is sent
+	other, _, err := fe.NewCISInvoice(time.Now(), 2, 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "10.00", CISCash, "12345678901")
+	if err != nil {
+		t.Fatalf("Failed to create invoice: %v", err)
+	}
+	if result, err := other.InvoiceRequestResult(); err != nil || result.FromJournal || requests.Load() != 3 {
+		t.Errorf("Expected the other invoice to be sent, got %+v %v", result, err)
+	}
+
+	fe.idempotency = false
+	if result, err := invoice.InvoiceRequestResult(); err != nil || result.FromJournal || requests.Load() != 4 {
+		t.Errorf("Expected the invoice to be sent without idempotency, got %+v %v", result, err)
+	}
+}
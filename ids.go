@@ -0,0 +1,89 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"fmt"
+	"regexp"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+	"github.com/l-d-t/fiskalhrgo/schema"
+)
+
+// idGenerator is the generator set with SetIDGenerator, nil for the default
+var idGenerator atomic.Pointer[func() string]
+
+// GenerateID returns a new unique ID, used for the Id attribute of the signed requests and the IdPoruke
+// of the message header. It is a random (version 4) UUID, unless another generator is set with SetIDGenerator.
+func GenerateID() string {
+	if generate := idGenerator.Load(); generate != nil {
+		return (*generate)()
+	}
+	return uuid.NewString()
+}
+
+// SetIDGenerator replaces the generator used by GenerateID for all entities, e.g. to use time-ordered UUIDs
+// (version 7) or deterministic IDs in tests. Use nil to restore the random UUIDs.
+// The generator must be safe for concurrent use and return a UUID, CIS requires the IdPoruke to be a UUID.
+func SetIDGenerator(generate func() string) {
+	if generate == nil {
+		idGenerator.Store(nil)
+		return
+	}
+	idGenerator.Store(&generate)
+}
+
+// IDProvider controls the IDs of the invoice requests, e.g. to embed the transaction identifiers of an ERP
+// for cross-referencing the CIS messages. Both methods are called once for every new message sent to CIS, also for
+// a repeated request of an already fiscalized invoice, which must get new IDs. A message still in flight in the
+// message store (see WithMessageStore) is resent with its original IDs without calling the provider.
+// Implementations must be safe for concurrent use.
+type IDProvider interface {
+	// RequestID returns the Id attribute of the RacunZahtjev element, referenced by the signature.
+	// It may contain letters, digits and the characters _ . : - (up to 128 characters).
+	RequestID(invoice *RacunType) string
+
+	// MessageID returns the IdPoruke of the message header, it must be a lowercase UUID. CIS echoes it
+	// in the response and the response of an already used IdPoruke is rejected as ErrReplayedResponse.
+	MessageID(invoice *RacunType) string
+}
+
+// WithIDProvider sets the provider of the request IDs, see SetIDProvider
+func WithIDProvider(provider IDProvider) Option {
+	return func(o *entityOptions) {
+		o.idProvider = provider
+	}
+}
+
+// SetIDProvider sets the provider of the Id attribute and the IdPoruke of the invoice requests.
+// Use nil to restore the default, both are generated with GenerateID.
+func (fe *FiskalEntity) SetIDProvider(provider IDProvider) {
+	fe.hooksMu.Lock()
+	defer fe.hooksMu.Unlock()
+	fe.idProvider = provider
+}
+
+// requestIDPattern limits the Id attribute to the characters safe in the signature reference
+var requestIDPattern = regexp.MustCompile(`^[0-9A-Za-z_.:-]{1,128}$`)
+
+// invoiceRequestIDs returns the Id attribute and the IdPoruke for the invoice request
+func (fe *FiskalEntity) invoiceRequestIDs(invoice *RacunType) (string, string, error) {
+	fe.hooksMu.RLock()
+	provider := fe.idProvider
+	fe.hooksMu.RUnlock()
+	if provider == nil {
+		return GenerateID(), GenerateID(), nil
+	}
+
+	requestID, messageID := provider.RequestID(invoice), provider.MessageID(invoice)
+	if !requestIDPattern.MatchString(requestID) {
+		return "", "", fmt.Errorf("invalid request Id %q from the IDProvider", requestID)
+	}
+	if problem := schema.UUID(messageID); problem != "" {
+		return "", "", fmt.Errorf("invalid IdPoruke from the IDProvider: %s", problem)
+	}
+	return requestID, messageID, nil
+}
@@ -0,0 +1,116 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/google/uuid"
+)
+
+func TestGenerateID(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		id := GenerateID()
+		if parsed, err := uuid.Parse(id); err != nil || parsed.Version() != 4 {
+			t.Fatalf("Expected a random UUID, got %q", id)
+		}
+		if seen[id] {
+			t.Fatalf("Duplicate ID %s", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestSetIDGenerator(t *testing.T) {
+	var counter atomic.Int64
+	SetIDGenerator(func() string {
+		return fmt.Sprintf("00000000-0000-4000-8000-%012d", counter.Add(1))
+	})
+	defer SetIDGenerator(nil)
+
+	header := newFiskalHeader(GenerateID())
+	if header.IdPoruke != "00000000-0000-4000-8000-000000000001" {
+		t.Errorf("Expected the custom IdPoruke, got %s", header.IdPoruke)
+	}
+	if id := GenerateID(); id != "00000000-0000-4000-8000-000000000002" {
+		t.Errorf("Expected the custom ID, got %s", id)
+	}
+
+	SetIDGenerator(nil)
+	if _, err := uuid.Parse(GenerateID()); err != nil {
+		t.Errorf("Expected a random UUID after the reset, got %v", err)
+	}
+}
+
+// erpIDs embeds the ERP transaction number in the request IDs
+type erpIDs struct {
+	transaction string
+	messageID   string
+}
+
+func (p *erpIDs) RequestID(invoice *RacunType) string {
+	return "ERP-" + p.transaction
+}
+
+func (p *erpIDs) MessageID(invoice *RacunType) string {
+	return p.messageID
+}
+
+func TestIDProvider(t *testing.T) {
+	key, cert := newTestCISSigningCert(t)
+	var requestID, messageID string
+	fe := newTestServerEntity(t, func(w http.ResponseWriter, r *http.Request) {
+		doc := etree.NewDocument()
+		if _, err := doc.ReadFrom(r.Body); err != nil {
+			t.Error(err)
+			return
+		}
+		requestID = doc.FindElement("//RacunZahtjev").SelectAttrValue("Id", "")
+		messageID = doc.FindElement("//IdPoruke").Text()
+		response := fmt.Sprintf(testCISResponse, "G0x1", messageID, doc.FindElement("//DatumVrijeme").Text(), "9d6f5bb6-da48-4fcd-a803-4586a025e0e4")
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprint(w, signTestCISResponse(t, key, response, MakeC14N10RecCanonicalizer()))
+	})
+	fe.ciscert = newSignatureCheckCIScert(cert, fe.ciscert.SSLverifyPoll)
+	provider := &erpIDs{transaction: "2024.000123", messageID: "00000000-0000-4000-8000-000000000123"}
+	fe.SetIDProvider(provider)
+
+	invoice, _, err := fe.NewCISInvoice(time.Now(), 1, 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "10.00", CISCash, "12345678901")
+	if err != nil {
+		t.Fatalf("Failed to create invoice: %v", err)
+	}
+	if _, _, err := invoice.InvoiceRequest(); err != nil {
+		t.Fatalf("InvoiceRequest failed: %v", err)
+	}
+	if requestID != "ERP-2024.000123" || messageID != provider.messageID {
+		t.Errorf("Expected the IDs from the provider, got %s and %s", requestID, messageID)
+	}
+
+	// Invalid IDs are rejected before anything is sent
+	requestID = ""
+	for _, invalid := range []erpIDs{{transaction: "with space", messageID: provider.messageID}, {transaction: "1", messageID: "TX-1"}} {
+		fe.SetIDProvider(&invalid)
+		_, _, err := invoice.InvoiceRequest()
+		var fErr *FiskalError
+		if !errors.As(err, &fErr) || fErr.Category != CategoryInput || requestID != "" {
+			t.Errorf("Expected an input error for %+v, got %v", invalid, err)
+		}
+	}
+
+	fe.SetIDProvider(nil)
+	if _, _, err := invoice.InvoiceRequest(); err != nil {
+		t.Fatalf("InvoiceRequest failed: %v", err)
+	}
+	if _, err := uuid.Parse(requestID); err != nil || messageID == provider.messageID {
+		t.Errorf("Expected the generated IDs, got %s and %s", requestID, messageID)
+	}
+}
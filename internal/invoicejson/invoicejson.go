@@ -0,0 +1,135 @@
+// Package invoicejson defines the JSON (and XML) representation of an invoice used by the command line tools.
+package invoicejson
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"time"
+
+	fiskalhrgo "github.com/l-d-t/fiskalhrgo"
+)
+
+// Tax is a VAT or consumption tax entry
+type Tax struct {
+	Rate   string `json:"rate" xml:"rate"`
+	Base   string `json:"base" xml:"base"`
+	Amount string `json:"amount" xml:"amount"`
+}
+
+// OtherTax is an other tax entry
+type OtherTax struct {
+	Name   string `json:"name" xml:"name"`
+	Rate   string `json:"rate" xml:"rate"`
+	Base   string `json:"base" xml:"base"`
+	Amount string `json:"amount" xml:"amount"`
+}
+
+// Fee is a fee (naknada) entry, e.g. the bottle deposit
+type Fee struct {
+	Name   string `json:"name" xml:"name"`
+	Amount string `json:"amount" xml:"amount"`
+}
+
+// Invoice is the JSON (or XML, with the <invoice> root element) representation of an invoice,
+// the amounts are strings with two decimals ("10.00")
+type Invoice struct {
+	XMLName        xml.Name   `json:"-" xml:"invoice"`
+	IssuedAt       time.Time  `json:"issued_at" xml:"issued_at"`
+	Number         uint       `json:"number" xml:"number"`
+	Device         uint       `json:"device" xml:"device"`
+	VAT            []Tax      `json:"vat,omitempty" xml:"vat,omitempty"`
+	ConsumptionTax []Tax      `json:"consumption_tax,omitempty" xml:"consumption_tax,omitempty"`
+	OtherTaxes     []OtherTax `json:"other_taxes,omitempty" xml:"other_taxes,omitempty"`
+	Exempt         string     `json:"exempt,omitempty" xml:"exempt,omitempty"`
+	Margin         string     `json:"margin,omitempty" xml:"margin,omitempty"`
+	NotTaxable     string     `json:"not_taxable,omitempty" xml:"not_taxable,omitempty"`
+	Fees           []Fee      `json:"fees,omitempty" xml:"fees,omitempty"`
+	Total          string     `json:"total" xml:"total"`
+	PaymentMethod  string     `json:"payment_method" xml:"payment_method"`
+	OperatorOIB    string     `json:"operator_oib" xml:"operator_oib"`
+
+	// LateDeliveryZKI is the ZKI printed on the receipt when the invoice was issued without CIS,
+	// set it to deliver such an invoice late (NakDost)
+	LateDeliveryZKI string `json:"late_delivery_zki,omitempty" xml:"late_delivery_zki,omitempty"`
+}
+
+// Build creates the invoice for the entity and returns it with its ZKI
+func (in *Invoice) Build(fe *fiskalhrgo.FiskalEntity) (*fiskalhrgo.RacunType, string, error) {
+	if in.IssuedAt.IsZero() {
+		return nil, "", errors.New("issued_at is required")
+	}
+
+	var vat, pnp, other [][]interface{}
+	for _, tax := range in.VAT {
+		vat = append(vat, []interface{}{tax.Rate, tax.Base, tax.Amount})
+	}
+	for _, tax := range in.ConsumptionTax {
+		pnp = append(pnp, []interface{}{tax.Rate, tax.Base, tax.Amount})
+	}
+	for _, tax := range in.OtherTaxes {
+		other = append(other, []interface{}{tax.Name, tax.Rate, tax.Base, tax.Amount})
+	}
+	var fees [][]string
+	for _, fee := range in.Fees {
+		fees = append(fees, []string{fee.Name, fee.Amount})
+	}
+
+	invoice, zki, err := fe.NewCISInvoice(
+		in.IssuedAt,
+		in.Number,
+		in.Device,
+		vat,
+		pnp,
+		other,
+		amountOrZero(in.Exempt),
+		amountOrZero(in.Margin),
+		amountOrZero(in.NotTaxable),
+		fees,
+		in.Total,
+		fiskalhrgo.PaymentMethod(in.PaymentMethod),
+		in.OperatorOIB,
+	)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if in.LateDeliveryZKI != "" {
+		if err := invoice.SetLateDelivery(in.LateDeliveryZKI); err != nil {
+			return nil, "", fmt.Errorf("late delivery: %w", err)
+		}
+		zki = in.LateDeliveryZKI
+	}
+
+	return invoice, zki, nil
+}
+
+// Parse decodes an invoice from JSON or XML data, XML is detected by the leading '<'
+func Parse(data []byte) (*Invoice, error) {
+	var in Invoice
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '<' {
+		if err := xml.Unmarshal(trimmed, &in); err != nil {
+			return nil, fmt.Errorf("invalid invoice XML: %w", err)
+		}
+		return &in, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&in); err != nil {
+		return nil, fmt.Errorf("invalid invoice JSON: %w", err)
+	}
+	return &in, nil
+}
+
+func amountOrZero(amount string) string {
+	if amount == "" {
+		return "0.00"
+	}
+	return amount
+}
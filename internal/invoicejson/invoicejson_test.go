@@ -0,0 +1,35 @@
+package invoicejson
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	jsonInvoice := `{"issued_at": "2024-10-01T12:00:00+02:00", "number": 5, "device": 2,
+		"vat": [{"rate": "25.00", "base": "100.00", "amount": "25.00"}],
+		"total": "125.00", "payment_method": "K", "operator_oib": "12345678901"}`
+	xmlInvoice := `<invoice><issued_at>2024-10-01T12:00:00+02:00</issued_at><number>5</number><device>2</device>
+		<vat><rate>25.00</rate><base>100.00</base><amount>25.00</amount></vat>
+		<total>125.00</total><payment_method>K</payment_method><operator_oib>12345678901</operator_oib></invoice>`
+
+	for name, data := range map[string]string{"json": jsonInvoice, "xml": xmlInvoice} {
+		in, err := Parse([]byte(data))
+		if err != nil {
+			t.Fatalf("%s: failed to parse: %v", name, err)
+		}
+		if in.Number != 5 || in.Device != 2 || in.Total != "125.00" || in.PaymentMethod != "K" || in.IssuedAt.IsZero() {
+			t.Errorf("%s: unexpected invoice: %+v", name, in)
+		}
+		if len(in.VAT) != 1 || in.VAT[0].Amount != "25.00" {
+			t.Errorf("%s: unexpected VAT: %+v", name, in.VAT)
+		}
+	}
+
+	if _, err := Parse([]byte(`{"unknown": 1}`)); err == nil {
+		t.Errorf("Expected error for unknown fields")
+	}
+}
@@ -0,0 +1,123 @@
+// Command mockgen generates the mocks of the fiskalmock package from the interfaces of the fiskalhrgo package.
+// Every method of a mock records the call and calls the function field of the same name with the Func suffix,
+// or returns the zero values (and ErrNotStubbed for the error result) if the field is nil.
+//
+//	go generate ./fiskalmock
+package main
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/l-d-t/fiskalhrgo"
+)
+
+// mocks are the generated mocks, the name of the mock and the interface
+var mocks = []struct {
+	name string
+	typ  reflect.Type
+}{
+	{"Client", reflect.TypeOf((*fiskalhrgo.FiskalClient)(nil)).Elem()},
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+func main() {
+	output := flag.String("o", "mocks_gen.go", "output file")
+	flag.Parse()
+
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by internal/mockgen. DO NOT EDIT.\n\npackage fiskalmock\n\n")
+	buf.WriteString("import \"github.com/l-d-t/fiskalhrgo\"\n")
+	for _, mock := range mocks {
+		writeMock(&buf, mock.name, mock.typ)
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatalf("failed to format the mocks: %v\n%s", err, buf.Bytes())
+	}
+	if err := os.WriteFile(*output, src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// writeMock writes the mock of the interface
+func writeMock(buf *bytes.Buffer, name string, typ reflect.Type) {
+	fmt.Fprintf(buf, "\n// %s is the mock of fiskalhrgo.%s\n", name, typ.Name())
+	fmt.Fprintf(buf, "type %s struct {\n\tRecorder\n", name)
+	for i := 0; i < typ.NumMethod(); i++ {
+		method := typ.Method(i)
+		fmt.Fprintf(buf, "\n\t// %sFunc is called by %s\n\t%sFunc %s\n", method.Name, method.Name, method.Name, funcType(method.Type))
+	}
+	buf.WriteString("}\n\n")
+	fmt.Fprintf(buf, "var _ fiskalhrgo.%s = (*%s)(nil)\n", typ.Name(), name)
+
+	for i := 0; i < typ.NumMethod(); i++ {
+		method := typ.Method(i)
+		params, args := make([]string, method.Type.NumIn()), make([]string, method.Type.NumIn())
+		for j := range params {
+			args[j] = fmt.Sprintf("a%d", j)
+			params[j] = args[j] + " " + typeName(method.Type.In(j))
+		}
+		results := make([]string, method.Type.NumOut())
+		zero := make([]string, method.Type.NumOut())
+		for j := range results {
+			results[j] = typeName(method.Type.Out(j))
+			zero[j] = fmt.Sprintf("r%d", j)
+		}
+
+		fmt.Fprintf(buf, "\n// %s records the call and calls %sFunc\n", method.Name, method.Name)
+		fmt.Fprintf(buf, "func (m *%s) %s(%s) (%s) {\n", name, method.Name, strings.Join(params, ", "), strings.Join(results, ", "))
+		fmt.Fprintf(buf, "\tm.record(%q%s)\n", method.Name, prefixed(args))
+		fmt.Fprintf(buf, "\tif m.%sFunc != nil {\n\t\treturn m.%sFunc(%s)\n\t}\n", method.Name, method.Name, strings.Join(args, ", "))
+		for j, result := range results {
+			if method.Type.Out(j) == errorType {
+				fmt.Fprintf(buf, "\tr%d := notStubbed(%q)\n", j, name+"."+method.Name)
+			} else {
+				fmt.Fprintf(buf, "\tvar r%d %s\n", j, result)
+			}
+		}
+		fmt.Fprintf(buf, "\treturn %s\n}\n", strings.Join(zero, ", "))
+	}
+}
+
+// funcType returns the type of the function field of the method
+func funcType(typ reflect.Type) string {
+	params := make([]string, typ.NumIn())
+	for i := range params {
+		params[i] = typeName(typ.In(i))
+	}
+	results := make([]string, typ.NumOut())
+	for i := range results {
+		results[i] = typeName(typ.Out(i))
+	}
+	return fmt.Sprintf("func(%s) (%s)", strings.Join(params, ", "), strings.Join(results, ", "))
+}
+
+// typeName returns the name of the type in the generated package
+func typeName(typ reflect.Type) string {
+	switch typ.Kind() {
+	case reflect.Pointer:
+		return "*" + typeName(typ.Elem())
+	case reflect.Slice:
+		return "[]" + typeName(typ.Elem())
+	}
+	return typ.String()
+}
+
+func prefixed(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	return ", " + strings.Join(args, ", ")
+}
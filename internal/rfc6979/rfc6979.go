@@ -0,0 +1,93 @@
+// Package rfc6979 signs with ECDSA using the deterministic nonce of RFC 6979. The ZKI is derived from the
+// signature and must be recalculated to be verified, which is only possible with deterministic signatures.
+package rfc6979
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"errors"
+	"math/big"
+)
+
+// Sign signs the digest (made with hash) with the private key, the same key and digest always give the same signature
+func Sign(priv *ecdsa.PrivateKey, hash crypto.Hash, digest []byte) (*big.Int, *big.Int, error) {
+	if priv == nil || priv.D == nil {
+		return nil, nil, errors.New("private key is nil")
+	}
+	if !hash.Available() {
+		return nil, nil, errors.New("hash function not available")
+	}
+	params := priv.Curve.Params()
+	q := params.N
+	qlen := q.BitLen()
+	rlen := (qlen + 7) / 8
+
+	// bits2int takes the leftmost qlen bits, as ECDSA does with the digest
+	bits2int := func(b []byte) *big.Int {
+		v := new(big.Int).SetBytes(b)
+		if excess := len(b)*8 - qlen; excess > 0 {
+			v.Rsh(v, uint(excess))
+		}
+		return v
+	}
+	int2octets := func(v *big.Int) []byte {
+		out := make([]byte, rlen)
+		return v.FillBytes(out)
+	}
+	h1 := bits2int(digest)
+	h1octets := int2octets(new(big.Int).Mod(h1, q))
+	x := int2octets(priv.D)
+
+	mac := func(key []byte, data ...[]byte) []byte {
+		m := hmac.New(hash.New, key)
+		for _, d := range data {
+			m.Write(d)
+		}
+		return m.Sum(nil)
+	}
+
+	// Section 3.2, steps b to g
+	hlen := hash.Size()
+	v := make([]byte, hlen)
+	for i := range v {
+		v[i] = 0x01
+	}
+	k := make([]byte, hlen)
+	k = mac(k, v, []byte{0x00}, x, h1octets)
+	v = mac(k, v)
+	k = mac(k, v, []byte{0x01}, x, h1octets)
+	v = mac(k, v)
+
+	for {
+		// Step h, generate the candidate nonce
+		var t []byte
+		for len(t) < rlen {
+			v = mac(k, v)
+			t = append(t, v...)
+		}
+		nonce := bits2int(t)
+
+		if nonce.Sign() > 0 && nonce.Cmp(q) < 0 {
+			rx, _ := priv.Curve.ScalarBaseMult(int2octets(nonce))
+			r := new(big.Int).Mod(rx, q)
+			if r.Sign() != 0 {
+				// s = nonce^-1 * (h1 + r * d) mod q
+				s := new(big.Int).Mul(r, priv.D)
+				s.Add(s, h1)
+				s.Mul(s, new(big.Int).ModInverse(nonce, q))
+				s.Mod(s, q)
+				if s.Sign() != 0 {
+					return r, s, nil
+				}
+			}
+		}
+
+		k = mac(k, v, []byte{0x00})
+		v = mac(k, v)
+	}
+}
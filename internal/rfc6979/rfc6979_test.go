@@ -0,0 +1,54 @@
+package rfc6979
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha1"
+	"crypto/sha256"
+	"math/big"
+	"testing"
+)
+
+func hexInt(t *testing.T, s string) *big.Int {
+	t.Helper()
+	v, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		t.Fatalf("invalid hex %s", s)
+	}
+	return v
+}
+
+// TestVectors checks the P-256 test vectors from RFC 6979 appendix A.2.5
+func TestVectors(t *testing.T) {
+	priv := &ecdsa.PrivateKey{D: hexInt(t, "C9AFA9D845BA75166B5C215767B1D6934E50C3DB36E89B127B8A622B120F6721")}
+	priv.Curve = elliptic.P256()
+	priv.X, priv.Y = priv.Curve.ScalarBaseMult(priv.D.Bytes())
+
+	sha1Sum := sha1.Sum([]byte("sample"))
+	sha256Sum := sha256.Sum256([]byte("sample"))
+	tests := []struct {
+		hash   crypto.Hash
+		digest []byte
+		r, s   string
+	}{
+		{crypto.SHA1, sha1Sum[:], "61340C88C3AAEBEB4F6D667F672CA9759A6CCAA9FA8811313039EE4A35471D32", "6D7F147DAC089441BB2E2FE8F7A3FA264B9C475098FDCF6E00D7C996E1B8B7EB"},
+		{crypto.SHA256, sha256Sum[:], "EFD48B2AACB6A8FD1140DD9CD45E81D69D2C877B56AAF991C34D0EA84EAF3716", "F7CB1C942D657C41D436C7A1B6E29F65F3E900DBB9AFF4064DC4AB2F843ACDA8"},
+	}
+	for _, tt := range tests {
+		r, s, err := Sign(priv, tt.hash, tt.digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Cmp(hexInt(t, tt.r)) != 0 || s.Cmp(hexInt(t, tt.s)) != 0 {
+			t.Errorf("%v: unexpected signature r=%X s=%X", tt.hash, r, s)
+		}
+		if !ecdsa.Verify(&priv.PublicKey, tt.digest, r, s) {
+			t.Errorf("%v: the signature does not verify", tt.hash)
+		}
+	}
+}
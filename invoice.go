@@ -8,7 +8,8 @@ import (
 	"encoding/xml"
 	"errors"
 	"fmt"
-	"strings"
+	"log/slog"
+	"net/http"
 	"time"
 )
 
@@ -172,25 +173,24 @@ func (fe *FiskalEntity) NewCISInvoice(
 	}
 
 	return &RacunType{
-		Oib:                fe.oib,
-		USustPdv:           fe.sustPDV,
-		DatVrijeme:         formattedDate,
-		OznSlijed:          oznSlijed,
-		BrRac:              brRac,
-		Pdv:                pdv,
-		Pnp:                pnp,
-		OstaliPor:          ostaliPor,
-		IznosOslobPdv:      iznosOslobPdv,
-		IznosMarza:         iznosMarza,
-		IznosNePodlOpor:    iznosNePodlOpor,
-		Naknade:            naknade,
-		IznosUkupno:        iznosUkupno,
-		NacinPlac:          string(paymentMethod),
-		OibOper:            oibOper,
-		ZastKod:            zki,
-		NakDost:            false,
-		pointerToEntity:    fe,
-		oldEntityForOldZKI: nil,
+		Oib:             fe.oib,
+		USustPdv:        fe.sustPDV,
+		DatVrijeme:      formattedDate,
+		OznSlijed:       oznSlijed,
+		BrRac:           brRac,
+		Pdv:             pdv,
+		Pnp:             pnp,
+		OstaliPor:       ostaliPor,
+		IznosOslobPdv:   iznosOslobPdv,
+		IznosMarza:      iznosMarza,
+		IznosNePodlOpor: iznosNePodlOpor,
+		Naknade:         naknade,
+		IznosUkupno:     iznosUkupno,
+		NacinPlac:       string(paymentMethod),
+		OibOper:         oibOper,
+		ZastKod:         zki,
+		NakDost:         false,
+		pointerToEntity: fe,
 	}, zki, nil
 }
 
@@ -202,12 +202,66 @@ func (invoice *RacunType) GetOib() string {
 	return invoice.Oib
 }
 
+// SetRequestHeaders sets extra HTTP headers sent to CIS with the request for this invoice only,
+// for example a correlation ID. They override the entity headers with the same name.
+func (invoice *RacunType) SetRequestHeaders(header http.Header) {
+	invoice.requestHeaders = header.Clone()
+}
+
+// clone returns a deep copy of the invoice, changing the copy doesn't change the original.
+// The entity and the ZKI certificate are shared, they are not part of the invoice data.
+func (invoice *RacunType) clone() *RacunType {
+	racun := *invoice
+	if invoice.BrRac != nil {
+		brRac := *invoice.BrRac
+		racun.BrRac = &brRac
+	}
+	if invoice.Pdv != nil {
+		racun.Pdv = &PdvType{Porez: clonePointers(invoice.Pdv.Porez)}
+	}
+	if invoice.Pnp != nil {
+		racun.Pnp = &PorezNaPotrosnjuType{Porez: clonePointers(invoice.Pnp.Porez)}
+	}
+	if invoice.OstaliPor != nil {
+		racun.OstaliPor = &OstaliPoreziType{Porez: clonePointers(invoice.OstaliPor.Porez)}
+	}
+	if invoice.Naknade != nil {
+		racun.Naknade = &NaknadeType{Naknada: clonePointers(invoice.Naknade.Naknada)}
+	}
+	if invoice.PrateciDokument != nil {
+		prateci := *invoice.PrateciDokument
+		racun.PrateciDokument = &prateci
+	}
+	if invoice.Napojnica != nil {
+		napojnica := *invoice.Napojnica
+		racun.Napojnica = &napojnica
+	}
+	racun.requestHeaders = invoice.requestHeaders.Clone()
+	return &racun
+}
+
+// clonePointers returns a copy of the slice with a copy of every element
+func clonePointers[T any](items []*T) []*T {
+	if items == nil {
+		return nil
+	}
+	cpy := make([]*T, len(items))
+	for i, item := range items {
+		if item != nil {
+			value := *item
+			cpy[i] = &value
+		}
+	}
+	return cpy
+}
+
 // Set late delivery to true, and set the ZKI you pass from saved data when you issued the invoice to customer
-// Don't worry the ZKI you set will be validated with the current certificate before sending unless to set
-// IhaveZKIwithExpiredCertificateEdgeCase method then the old certificate provided will be used to validate the ZKI
+// Don't worry the ZKI you set will be validated before sending, with the current certificate or, if the certificate
+// was renewed in the meantime, with the old certificate that produced it (see CertArchive and FindZKICertificate).
+// ErrZKIMismatch is returned if no known certificate produced the ZKI.
 //
 // So just set the ZKI you got from the invoice you issued to the customer,
-// and the system will validate it with the current certificate
+// and the system will validate it with the right certificate
 func (invoice *RacunType) SetLateDelivery(ZKI string) error {
 	invoice.ZastKod = ZKI
 	invoice.NakDost = true
@@ -217,63 +271,65 @@ func (invoice *RacunType) SetLateDelivery(ZKI string) error {
 		return fmt.Errorf("failed to parse date: %w", err)
 	}
 
-	// Validate the ZKI with the current certificate
-	calculatedZKI, err := invoice.pointerToEntity.GenerateZKI(invoiceTime, uint(invoice.BrRac.BrOznRac), uint(invoice.BrRac.OznNapUr), invoice.IznosUkupno)
-
+	// Find the certificate that produced the ZKI, the current one first
+	cert, err := invoice.pointerToEntity.FindZKICertificate(ZKI, invoiceTime, uint(invoice.BrRac.BrOznRac), uint(invoice.BrRac.OznNapUr), invoice.IznosUkupno)
 	if err != nil {
-		return fmt.Errorf("failed to generate ZKI: %w", err)
+		return err
 	}
-
-	if calculatedZKI != invoice.ZastKod {
-		return errors.New("ZKI is not valid")
+	zkiCert, err := invoice.pointerToEntity.certManagerFor(cert)
+	if err != nil {
+		return err
 	}
+	invoice.zkiCert = zkiCert
 
 	return nil
 }
 
-// IhaveZKIwithExpiredCertificateEdgeCase sets the old FiskalEntity instance for the old ZKI verification
+// IhaveZKIwithExpiredCertificateEdgeCase adds the old certificate to the entity archive and sets the late delivery
+// with the old ZKI, see SetLateDelivery.
 // This is used in the edge case that the ZKI was generated with one certificate and the fiscalization failed
 // But the certificate expired or had to be changed and now fiscalization have to be repeated with new certificate
 // If we replace the original ZKI its a problem we already gave the invoice with old ZKI out
 // So we have to keep the old ZKI and validate it with the old certificate before signing and sending with new one
+//
+// Deprecated: add the old certificates to the archive (FiskalEntity.CertArchive) once and use SetLateDelivery,
+// the right certificate is found automatically.
 func (invoice *RacunType) IhaveZKIwithExpiredCertificateEdgeCase(oldZKI string, oldCertPath string, oldCertPassword string) error {
-	invoice.ZastKod = oldZKI
-	invoice.NakDost = true
-
-	// Create a new old FiskalEntity
-	oldFiskalEntity, err := NewFiskalEntity(
-		invoice.pointerToEntity.oib,
-		invoice.pointerToEntity.sustPDV,
-		invoice.pointerToEntity.locationID,
-		invoice.pointerToEntity.centralizedInvoiceNumber,
-		invoice.pointerToEntity.demoMode,
-		false,
-		oldCertPath,
-		oldCertPassword,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to create FiskalEntity: %v", err)
+	if err := invoice.pointerToEntity.CertArchive().AddFile(oldCertPath, oldCertPassword); err != nil {
+		return fmt.Errorf("failed to load the old certificate: %v", err)
 	}
+	return invoice.SetLateDelivery(oldZKI)
+}
 
-	invoice.oldEntityForOldZKI = oldFiskalEntity
-
-	invoiceTime, err := time.Parse("02.01.2006T15:04:05", invoice.DatVrijeme)
-	if err != nil {
-		return fmt.Errorf("failed to parse date: %w", err)
+// IhaveZKIwithExpiredCertificate is IhaveZKIwithExpiredCertificateEdgeCase with an already loaded old certificate,
+// e.g. from a secret store or an HSM, without filesystem access. The certificate is added to the entity archive.
+func (invoice *RacunType) IhaveZKIwithExpiredCertificate(oldZKI string, oldCert *Certificate) error {
+	if err := invoice.pointerToEntity.CertArchive().Add(oldCert); err != nil {
+		return fmt.Errorf("failed to archive the old certificate: %v", err)
 	}
+	return invoice.SetLateDelivery(oldZKI)
+}
 
-	// Validate the ZKI with the current certificate
-	calculatedZKI, err := invoice.oldEntityForOldZKI.GenerateZKI(invoiceTime, uint(invoice.BrRac.BrOznRac), uint(invoice.BrRac.OznNapUr), invoice.IznosUkupno)
-
-	if err != nil {
-		return fmt.Errorf("failed to generate ZKI: %w", err)
+// IhaveZKIwithExpiredCertificateP12 is IhaveZKIwithExpiredCertificateEdgeCase with the old P12 certificate
+// passed as data instead of a file path. The certificate is added to the entity archive.
+func (invoice *RacunType) IhaveZKIwithExpiredCertificateP12(oldZKI string, p12 []byte, password string) error {
+	if err := invoice.pointerToEntity.CertArchive().AddP12(p12, password); err != nil {
+		return fmt.Errorf("failed to load the old certificate: %v", err)
 	}
+	return invoice.SetLateDelivery(oldZKI)
+}
 
-	if calculatedZKI != invoice.ZastKod {
-		return errors.New("ZKI is not valid")
+// IhaveZKIwithExpiredCertificateEntity is IhaveZKIwithExpiredCertificateEdgeCase with an already created entity
+// holding the old certificate, it must have the same OIB. The certificate is added to the entity archive.
+func (invoice *RacunType) IhaveZKIwithExpiredCertificateEntity(oldZKI string, oldEntity *FiskalEntity) error {
+	if oldEntity == nil {
+		return errors.New("old entity is nil")
 	}
-
-	return nil
+	if oldEntity.oib != invoice.pointerToEntity.oib {
+		return errors.New("OIB of the old entity does not match")
+	}
+	cm := oldEntity.certificate()
+	return invoice.IhaveZKIwithExpiredCertificate(oldZKI, &Certificate{Signer: cm.signer, Cert: cm.publicCert, CACerts: cm.caCerts})
 }
 
 // InvoiceRequest sends an invoice request to the CIS (Croatian Fiscalization System) and processes the response.
@@ -311,97 +367,243 @@ func (invoice *RacunType) IhaveZKIwithExpiredCertificateEdgeCase(oldZKI string,
 // - If the response status is not 200 and there are errors in the response.
 // - If the JIR in the response is empty.
 // - If an unexpected error occurs.
+//
+// All errors are *FiskalError, use Category or Retriable to decide whether to queue the invoice for later.
 func (invoice *RacunType) InvoiceRequest() (string, string, error) {
+	result, err := invoice.InvoiceRequestResult()
+	if result == nil {
+		return "", "", err
+	}
+	return result.JIR, result.ZKI, err
+}
+
+// InvoiceResult is the outcome of an invoice request with the details needed for the audit trail
+type InvoiceResult struct {
+	// JIR assigned by CIS, empty if the invoice was not fiscalized
+	JIR string
+
+	// ZKI of the invoice
+	ZKI string
+
+	// IdPoruke of the request, empty if the request was not built
+	IdPoruke string
+
+	// DatumVrijeme is the time from the header of the CIS response (02.01.2006T15:04:05), empty without a valid response
+	DatumVrijeme string
+
+	// StatusCode is the HTTP status code of the CIS response, 0 if no response was received
+	StatusCode int
+
+	// Metadata describes the HTTP response and the TLS connection (headers, TLS version, cipher, server
+	// certificate), nil if no response was received or the transport is not based on HTTP
+	Metadata *ResponseMetadata
+
+	// Request is the exact signed SOAP envelope sent to CIS, nil if the request was not sent
+	Request []byte
+
+	// Response is the raw response body as received from CIS, nil if no response was received
+	Response []byte
+
+	// CertSerial is the serial number of the certificate that produced the ZKI
+	CertSerial string
+
+	// Sent is the time the request was sent, zero if it was not sent
+	Sent time.Time
+
+	// Duration is the round-trip time of the request to CIS, zero if it was not sent
+	Duration time.Duration
 
-	//some basic tests for invoice
+	// Warnings about the fiscalized invoice that need attention, e.g. an expiring certificate
+	Warnings []string
+
+	// FromJournal is true when the invoice was already fiscalized and the JIR is from the journal, see WithIdempotency
+	FromJournal bool
+}
+
+// InvoiceRequestResult sends the invoice to CIS like InvoiceRequest, returning the details of the exchange instead of
+// just the JIR and the ZKI. The result is returned with the error too (it is nil only for a nil invoice), so the IdPoruke,
+// the status and the raw response of a rejected request can be kept for the audit trail.
+//
+// All errors are *FiskalError, use Category or Retriable to decide whether to queue the invoice for later.
+func (invoice *RacunType) InvoiceRequestResult() (*InvoiceResult, error) {
 	if invoice == nil {
-		return "", "", errors.New("invoice is nil")
+		return nil, newFiskalError(CategoryInput, errors.New("invoice is nil"))
+	}
+	result := &InvoiceResult{ZKI: invoice.ZastKod}
+	if err := invoice.pointerToEntity.beginRequest(); err != nil {
+		return result, err
+	}
+	defer invoice.pointerToEntity.endRequest()
+	err := invoice.invoiceRequest(result)
+	attrs := []slog.Attr{slog.String("invoice", invoiceNumber(invoice)), slog.String("zki", result.ZKI)}
+	if err != nil {
+		invoice.pointerToEntity.log(failureLevel, "invoice fiscalization failed", append(attrs, errorAttrs(err)...)...)
+	} else {
+		invoice.pointerToEntity.log(successLevel, "invoice fiscalized", append(attrs, slog.String("jir", result.JIR))...)
 	}
+	invoice.pointerToEntity.recordMessageOutcome(result, err)
+	invoice.pointerToEntity.journalInvoice(invoice, result, err)
+	invoice.pointerToEntity.recordStats(invoice, result, err)
+	invoice.pointerToEntity.emitInvoiceResult(invoice, result.JIR, err)
+	return result, invoice.pointerToEntity.redactError(err)
+}
 
+// invoiceRequest does the work of InvoiceRequestResult, it fills the result as the request progresses
+func (invoice *RacunType) invoiceRequest(result *InvoiceResult) error {
 	if invoice.SpecNamj != "" {
-		return "", "", errors.New("invoice SpecNamj must be empty")
+		return newFiskalError(CategoryInput, errors.New("invoice SpecNamj must be empty"))
 	}
 
 	if invoice.ZastKod == "" {
-		return "", "", errors.New("invoice ZKI (Zastitni Kod Izdavatelja) must be set")
+		return newFiskalError(CategoryInput, errors.New("invoice ZKI (Zastitni Kod Izdavatelja) must be set"))
 	}
 
-	//check ZKI
-	invoiceTime, err := time.Parse("02.01.2006T15:04:05", invoice.DatVrijeme)
+	certSerial, err := invoice.checkZKI()
+	result.CertSerial = certSerial
 	if err != nil {
-		return "", invoice.ZastKod, fmt.Errorf("failed to parse date: %w", err)
+		return err
 	}
 
-	var chkEntity *FiskalEntity
-	if invoice.oldEntityForOldZKI != nil {
-		chkEntity = invoice.oldEntityForOldZKI
-	} else {
-		chkEntity = invoice.pointerToEntity
+	if invoice.pointerToEntity.journaledResult(invoice, result) {
+		return nil
 	}
 
-	// Validate the ZKI with the old certificate
-	calculatedZKI, err := chkEntity.GenerateZKI(invoiceTime, uint(invoice.BrRac.BrOznRac), uint(invoice.BrRac.OznNapUr), invoice.IznosUkupno)
-
+	requestID, messageID, err := invoice.pointerToEntity.messageIDs(invoice)
 	if err != nil {
-		return "", invoice.ZastKod, fmt.Errorf("failed to check ZKI: %w", err)
-	}
-
-	if calculatedZKI != invoice.ZastKod {
-		return "", invoice.ZastKod, errors.New("ZKI is not valid")
+		return newFiskalError(CategoryInput, err)
 	}
 
 	//Combine with zahtjev for final XML
 	zahtjev := RacunZahtjev{
-		Zaglavlje: newFiskalHeader(),
+		Zaglavlje: newFiskalHeader(messageID),
 		Racun:     invoice,
 		Xmlns:     DefaultNamespace,
-		IdAttr:    generateUniqueID(),
+		IdAttr:    requestID,
 	}
+	result.IdPoruke = messageID
 
 	// Marshal the RacunZahtjev to XML
 	xmlData, err := xml.MarshalIndent(zahtjev, "", " ")
 	if err != nil {
-		return "", invoice.ZastKod, fmt.Errorf("error marshalling RacunZahtjev: %w", err)
+		return newFiskalError(CategoryInput, fmt.Errorf("error marshalling RacunZahtjev: %w", err))
+	}
+	if invoice.pointerToEntity.schemaValidation {
+		if err := ValidateRequestXML(xmlData); err != nil {
+			return newFiskalError(CategoryInput, err)
+		}
 	}
 
+	invoice.pointerToEntity.log(lifecycleLevel, "invoice request built",
+		slog.String("invoice", invoiceNumber(invoice)),
+		slog.String("zki", invoice.ZastKod),
+		slog.String("id_poruke", zahtjev.Zaglavlje.IdPoruke),
+		slog.Bool("late_delivery", invoice.NakDost),
+	)
+
+	invoice.pointerToEntity.emitInvoiceSent(invoice)
+
 	// Let's send it to CIS
-	body, status, errComm := invoice.pointerToEntity.GetResponse(xmlData, true)
+	invoice.pointerToEntity.recordMessageSent(requestID, messageID, invoice.ZastKod)
+	result.Sent = time.Now()
+	resp, errComm := invoice.pointerToEntity.send("", xmlData, true, invoice.requestHeaders)
+	result.Request, result.StatusCode, result.Response, result.Duration = resp.request, resp.status, resp.body, resp.duration
+	result.Metadata = resp.meta
+	body, status := resp.content, resp.status
 
-	if errComm != nil {
-		return "", invoice.ZastKod, fmt.Errorf("failed to make request: %w", errComm)
+	// CIS answers with a non 200 status when the request is rejected, the reasons are
+	// in the Greske element of the body, so try to parse it even if the request returned an error
+	if errComm != nil && len(body) == 0 {
+		return wrapFiskalError("failed to make request", CategoryTransport, errComm)
+	}
+
+	// Nothing from a response without a valid CIS signature is trusted, not even the errors
+	if errors.Is(errComm, ErrResponseSignature) {
+		return wrapFiskalError("failed to make request", CategoryOutcomeUnknown, errComm)
 	}
 
 	//unmarshad body to get Racun Odgovor
-	var racunOdgovor RacunOdgovor
-	if err := xml.Unmarshal(body, &racunOdgovor); err != nil {
-		return "", invoice.ZastKod, fmt.Errorf("failed to unmarshal XML response: %w", err)
+	racunOdgovor, err := ParseRacunOdgovor(body)
+	if err != nil {
+		if errComm != nil {
+			return wrapFiskalError("failed to make request", CategoryTransport, errComm)
+		}
+		fErr := newFiskalError(CategoryResponse, fmt.Errorf("failed to unmarshal XML response: %w", err))
+		fErr.StatusCode = status
+		return fErr
 	}
 
-	if zahtjev.Zaglavlje.IdPoruke != racunOdgovor.Zaglavlje.IdPoruke {
-		return "", invoice.ZastKod, errors.New("IdPoruke mismatch")
+	// Return all errors from the response, they can be checked with errors.Is / errors.As
+	if cisErrors := newCISErrors(racunOdgovor.Greske, invoice.pointerToEntity.Language()); cisErrors != nil {
+		return newCISFiskalError(cisErrors, status)
 	}
 
+	if errComm != nil {
+		return wrapFiskalError("failed to make request", CategoryTransport, errComm)
+	}
+
+	if racunOdgovor.Zaglavlje == nil || zahtjev.Zaglavlje.IdPoruke != racunOdgovor.Zaglavlje.IdPoruke {
+		fErr := newFiskalError(CategoryOutcomeUnknown, errors.New("IdPoruke mismatch"))
+		fErr.StatusCode = status
+		return fErr
+	}
+	result.DatumVrijeme = racunOdgovor.Zaglavlje.DatumVrijeme
+
 	if status != 200 {
+		fErr := newFiskalError(classifyStatus(status), fmt.Errorf("unexpected CIS response status: %d", status))
+		fErr.StatusCode = status
+		return fErr
+	}
 
-		// Aggregate all errors into a single error message
-		var errorMessages []string
-		for _, greska := range racunOdgovor.Greske.Greska {
-			errorMessages = append(errorMessages, fmt.Sprintf("%s: %s", greska.SifraGreske, greska.PorukaGreske))
-		}
-		if len(errorMessages) > 0 {
-			return "", invoice.ZastKod, fmt.Errorf("errors in response: %s", strings.Join(errorMessages, "; "))
-		}
+	if err := invoice.pointerToEntity.responseGuard.check(racunOdgovor.Zaglavlje, result.Sent, time.Now()); err != nil {
+		fErr := newFiskalError(CategoryOutcomeUnknown, err)
+		fErr.StatusCode = status
+		return fErr
+	}
 
-	} else {
-		if ValidateJIR(racunOdgovor.Jir) {
-			return racunOdgovor.Jir, invoice.ZastKod, nil
-		} else {
-			return "", invoice.ZastKod, errors.New("JIR is not valid")
-		}
+	if !ValidateJIR(racunOdgovor.Jir) {
+		fErr := newFiskalError(CategoryOutcomeUnknown, errors.New("JIR is not valid"))
+		fErr.StatusCode = status
+		return fErr
+	}
+
+	// Remembered only now, a rejected response must not make the genuine one look like a replay
+	if err := invoice.pointerToEntity.responseGuard.accept(racunOdgovor.Zaglavlje, time.Now()); err != nil {
+		fErr := newFiskalError(CategoryOutcomeUnknown, err)
+		fErr.StatusCode = status
+		return fErr
+	}
+
+	result.JIR = racunOdgovor.Jir
+	result.Warnings = append(result.Warnings, resp.warnings...)
+	if cert := invoice.pointerToEntity.certificate().publicCert; time.Until(cert.NotAfter) <= expireSoonDays*24*time.Hour {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("the fiscal certificate expires on %s, renew it in time", cert.NotAfter.Format("02.01.2006")))
+	}
+	return nil
+}
+
+// checkZKI validates the ZKI of the invoice with the certificate that produced it, the current one if not set
+// by SetLateDelivery, and returns the serial number of that certificate
+func (invoice *RacunType) checkZKI() (string, error) {
+	invoiceTime, err := time.Parse("02.01.2006T15:04:05", invoice.DatVrijeme)
+	if err != nil {
+		return "", newFiskalError(CategoryInput, fmt.Errorf("failed to parse date: %w", err))
 	}
 
-	// Add a default return statement to handle unexpected cases
-	return "", invoice.ZastKod, errors.New("unexpected error")
+	zkiCert := invoice.zkiCert
+	if zkiCert == nil {
+		zkiCert = invoice.pointerToEntity.certificate()
+	}
+	if invoice.BrRac == nil {
+		return zkiCert.certSERIAL, newFiskalError(CategoryInput, errors.New("invoice number (BrRac) must be set"))
+	}
+	calculatedZKI, err := invoice.pointerToEntity.generateZKI(zkiCert, invoiceTime, uint(invoice.BrRac.BrOznRac), uint(invoice.BrRac.OznNapUr), invoice.IznosUkupno)
+	if err != nil {
+		return zkiCert.certSERIAL, newFiskalError(CategorySignature, fmt.Errorf("failed to check ZKI: %w", err))
+	}
+	if calculatedZKI != invoice.ZastKod {
+		return zkiCert.certSERIAL, newFiskalError(CategoryInput, errors.New("ZKI is not valid"))
+	}
+	return zkiCert.certSERIAL, nil
 }
 
 // genNaknade initializes and returns a NaknadeType instance
@@ -0,0 +1,366 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// JournalEntry records a single attempt to fiscalize an invoice
+type JournalEntry struct {
+	// Time the invoice request was made
+	Time time.Time `json:"time"`
+
+	// InvoiceNumber is the number of the invoice (BrOznRac/OznPosPr/OznNapUr)
+	InvoiceNumber string `json:"invoice_number"`
+
+	// Location (OznPosPr) and Device (OznNapUr) of the invoice
+	Location string `json:"location"`
+	Device   uint   `json:"device"`
+
+	// IssuedAt is the issue date and time of the invoice (DatVrijeme)
+	IssuedAt string `json:"issued_at"`
+
+	// Total is the total amount of the invoice
+	Total string `json:"total"`
+
+	// PaymentMethod of the invoice (NacinPlac)
+	PaymentMethod string `json:"payment_method"`
+
+	// Taxes of the invoice, by type and rate
+	Taxes []JournalTax `json:"taxes,omitempty"`
+
+	// Exempt (IznosOslobPdv), Margin (IznosMarza) and NotTaxable (IznosNePodlOpor) are the amounts
+	// of the invoice outside of the taxes
+	Exempt     string `json:"exempt,omitempty"`
+	Margin     string `json:"margin,omitempty"`
+	NotTaxable string `json:"not_taxable,omitempty"`
+
+	// ZKI of the invoice
+	ZKI string `json:"zki"`
+
+	// JIR assigned by CIS, empty if the invoice was not fiscalized
+	JIR string `json:"jir,omitempty"`
+
+	// IdPoruke of the request
+	IdPoruke string `json:"id_poruke"`
+
+	// LateDelivery is true for an invoice delivered after it was issued (NakDost)
+	LateDelivery bool `json:"late_delivery,omitempty"`
+
+	// CertSerial is the serial number of the certificate that produced the ZKI
+	CertSerial string `json:"cert_serial"`
+
+	// RequestHash and ResponseHash are the hex SHA-256 hashes of the exact signed request and the raw CIS response,
+	// ResponseHash is empty if no response was received
+	RequestHash  string `json:"request_hash"`
+	ResponseHash string `json:"response_hash,omitempty"`
+
+	// ResponseTime is the DatumVrijeme from the header of the CIS response, empty without a valid response
+	ResponseTime string `json:"response_time,omitempty"`
+
+	// StatusCode is the HTTP status code of the CIS response, 0 if no response was received
+	StatusCode int `json:"status_code,omitempty"`
+
+	// Error is the error of a failed attempt, empty on success
+	Error string `json:"error,omitempty"`
+}
+
+// JournalTax is a tax of the journaled invoice
+type JournalTax struct {
+	// Type is "PDV", "PNP" or the name of the other tax
+	Type   string `json:"type"`
+	Rate   string `json:"rate"`
+	Base   string `json:"base"`
+	Amount string `json:"amount"`
+}
+
+// journalTaxes returns the taxes of the invoice
+func journalTaxes(invoice *RacunType) []JournalTax {
+	var taxes []JournalTax
+	if invoice.Pdv != nil {
+		for _, tax := range invoice.Pdv.Porez {
+			taxes = append(taxes, JournalTax{Type: "PDV", Rate: tax.Stopa, Base: tax.Osnovica, Amount: tax.Iznos})
+		}
+	}
+	if invoice.Pnp != nil {
+		for _, tax := range invoice.Pnp.Porez {
+			taxes = append(taxes, JournalTax{Type: "PNP", Rate: tax.Stopa, Base: tax.Osnovica, Amount: tax.Iznos})
+		}
+	}
+	if invoice.OstaliPor != nil {
+		for _, tax := range invoice.OstaliPor.Porez {
+			taxes = append(taxes, JournalTax{Type: tax.Naziv, Rate: tax.Stopa, Base: tax.Osnovica, Amount: tax.Iznos})
+		}
+	}
+	return taxes
+}
+
+// Journal keeps the fiscalization record of every issued invoice: the ZKI, the JIR, the certificate that produced
+// the ZKI and the hashes of the exact messages exchanged with CIS, for the traceability required during a tax inspection.
+//
+// Append is called synchronously after every invoice request that was sent, successful or not. A failure to append
+// is logged and doesn't fail the request, the invoice is already issued at that point. Implementations must be safe
+// for concurrent use, NewFileJournal is the file implementation and NewMemoryJournal is for tests.
+type Journal interface {
+	// Append records the entry
+	Append(entry *JournalEntry) error
+
+	// FindByZKI returns the entries of the invoice with the ZKI, oldest first
+	FindByZKI(zki string) ([]*JournalEntry, error)
+
+	// FindByJIR returns the entries with the JIR, oldest first
+	FindByJIR(jir string) ([]*JournalEntry, error)
+
+	// Range returns the entries with the Time in [from, to), oldest first
+	Range(from, to time.Time) ([]*JournalEntry, error)
+}
+
+// WithJournal records every invoice request in the journal, see SetJournal
+func WithJournal(journal Journal) Option {
+	return func(o *entityOptions) {
+		o.journal = journal
+	}
+}
+
+// SetJournal sets the journal recording every invoice request. Use nil to remove it.
+func (fe *FiskalEntity) SetJournal(journal Journal) {
+	fe.hooksMu.Lock()
+	defer fe.hooksMu.Unlock()
+	fe.journal = journal
+}
+
+// journalInvoice records the invoice request in the journal if one is set, the requests that were not sent are skipped
+func (fe *FiskalEntity) journalInvoice(invoice *RacunType, result *InvoiceResult, err error) {
+	if fe == nil {
+		return
+	}
+	fe.hooksMu.RLock()
+	journal := fe.journal
+	fe.hooksMu.RUnlock()
+	if journal == nil || result.Request == nil {
+		return
+	}
+
+	entry := &JournalEntry{
+		Time:          result.Sent,
+		InvoiceNumber: invoiceNumber(invoice),
+		IssuedAt:      invoice.DatVrijeme,
+		Total:         invoice.IznosUkupno,
+		PaymentMethod: invoice.NacinPlac,
+		Taxes:         journalTaxes(invoice),
+		Exempt:        invoice.IznosOslobPdv,
+		Margin:        invoice.IznosMarza,
+		NotTaxable:    invoice.IznosNePodlOpor,
+		ZKI:           result.ZKI,
+		JIR:           result.JIR,
+		IdPoruke:      result.IdPoruke,
+		LateDelivery:  invoice.NakDost,
+		CertSerial:    result.CertSerial,
+		RequestHash:   hashHex(result.Request),
+		ResponseTime:  result.DatumVrijeme,
+		StatusCode:    result.StatusCode,
+	}
+	if invoice.BrRac != nil {
+		entry.Location, entry.Device = invoice.BrRac.OznPosPr, invoice.BrRac.OznNapUr
+	}
+	if result.Response != nil {
+		entry.ResponseHash = hashHex(result.Response)
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if err := journal.Append(entry); err != nil {
+		fe.log(failureLevel, "failed to append to the fiscalization journal",
+			append(errorAttrs(err), slog.String("zki", entry.ZKI), slog.String("id_poruke", entry.IdPoruke))...)
+	}
+}
+
+// hashHex returns the hex SHA-256 hash of the data
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// journalFilter selects the entries of a journal query
+type journalFilter func(*JournalEntry) bool
+
+func journalByZKI(zki string) journalFilter {
+	return func(entry *JournalEntry) bool { return entry.ZKI == zki }
+}
+
+func journalByJIR(jir string) journalFilter {
+	return func(entry *JournalEntry) bool { return entry.JIR == jir }
+}
+
+func journalByTime(from, to time.Time) journalFilter {
+	return func(entry *JournalEntry) bool { return !entry.Time.Before(from) && entry.Time.Before(to) }
+}
+
+// sortJournal orders the entries by time, oldest first
+func sortJournal(entries []*JournalEntry) {
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+}
+
+// memoryJournal is a simple in-memory Journal
+type memoryJournal struct {
+	mu      sync.Mutex
+	entries []*JournalEntry
+}
+
+// NewMemoryJournal returns a Journal that keeps everything in memory.
+// The entries are lost when the process exits, so use it only for tests.
+func NewMemoryJournal() Journal {
+	return &memoryJournal{}
+}
+
+func (j *memoryJournal) Append(entry *JournalEntry) error {
+	if entry == nil {
+		return errors.New("journal entry is nil")
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	cpy := *entry
+	cpy.Taxes = slices.Clone(entry.Taxes)
+	j.entries = append(j.entries, &cpy)
+	return nil
+}
+
+func (j *memoryJournal) FindByZKI(zki string) ([]*JournalEntry, error) {
+	return j.find(journalByZKI(zki)), nil
+}
+
+func (j *memoryJournal) FindByJIR(jir string) ([]*JournalEntry, error) {
+	return j.find(journalByJIR(jir)), nil
+}
+
+func (j *memoryJournal) Range(from, to time.Time) ([]*JournalEntry, error) {
+	return j.find(journalByTime(from, to)), nil
+}
+
+func (j *memoryJournal) find(match journalFilter) []*JournalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var entries []*JournalEntry
+	for _, entry := range j.entries {
+		if match(entry) {
+			cpy := *entry
+			cpy.Taxes = slices.Clone(entry.Taxes)
+			entries = append(entries, &cpy)
+		}
+	}
+	sortJournal(entries)
+	return entries
+}
+
+// FileJournal is a Journal appending the entries to a file as JSON lines. The file is only ever appended to,
+// every entry is synced to the disk before Append returns.
+type FileJournal struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// NewFileJournal opens the journal file, it is created if it doesn't exist
+func NewFileJournal(path string) (*FileJournal, error) {
+	if path == "" {
+		return nil, errors.New("journal path is required")
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the journal: %w", err)
+	}
+	return &FileJournal{path: path, file: file}, nil
+}
+
+// Append writes the entry as a line at the end of the file
+func (j *FileJournal) Append(entry *JournalEntry) error {
+	if entry == nil {
+		return errors.New("journal entry is nil")
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return errors.New("journal is closed")
+	}
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+// FindByZKI returns the entries of the invoice with the ZKI, oldest first
+func (j *FileJournal) FindByZKI(zki string) ([]*JournalEntry, error) {
+	return j.find(journalByZKI(zki))
+}
+
+// FindByJIR returns the entries with the JIR, oldest first
+func (j *FileJournal) FindByJIR(jir string) ([]*JournalEntry, error) {
+	return j.find(journalByJIR(jir))
+}
+
+// Range returns the entries with the Time in [from, to), oldest first
+func (j *FileJournal) Range(from, to time.Time) ([]*JournalEntry, error) {
+	return j.find(journalByTime(from, to))
+}
+
+// find scans the file for the matching entries
+func (j *FileJournal) find(match journalFilter) ([]*JournalEntry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	file, err := os.Open(j.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the journal: %w", err)
+	}
+	defer file.Close()
+
+	var entries []*JournalEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("invalid journal entry on line %d: %w", line, err)
+		}
+		if match(&entry) {
+			entries = append(entries, &entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read the journal: %w", err)
+	}
+	sortJournal(entries)
+	return entries, nil
+}
+
+// Close closes the journal file
+func (j *FileJournal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
@@ -0,0 +1,157 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+func TestFileJournal(t *testing.T) {
+	key, cert := newTestCISSigningCert(t)
+	var signedResponse bool
+	var lastResponse string
+	fe := newTestServerEntity(t, func(w http.ResponseWriter, r *http.Request) {
+		doc := etree.NewDocument()
+		if _, err := doc.ReadFrom(r.Body); err != nil {
+			t.Error(err)
+			return
+		}
+		response := fmt.Sprintf(testCISResponse, "G0x1", doc.FindElement("//IdPoruke").Text(), doc.FindElement("//DatumVrijeme").Text(), "9d6f5bb6-da48-4fcd-a803-4586a025e0e4")
+		if signedResponse {
+			response = signTestCISResponse(t, key, response, MakeC14N10RecCanonicalizer())
+		}
+		lastResponse = response
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprint(w, response)
+	})
+	fe.ciscert = newSignatureCheckCIScert(cert, fe.ciscert.SSLverifyPoll)
+
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	journal, err := NewFileJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+	fe.SetJournal(journal)
+
+	invoice, zki, err := fe.NewCISInvoice(time.Now(), 1, 1, nil, nil, nil, "5.00", "0.00", "0.00", nil, "10.00", CISCash, "12345678901")
+	if err != nil {
+		t.Fatalf("Failed to create invoice: %v", err)
+	}
+	if _, _, err := invoice.InvoiceRequest(); err == nil {
+		t.Fatal("Expected the unsigned response to be rejected")
+	}
+	signedResponse = true
+	result, err := invoice.InvoiceRequestResult()
+	if err != nil {
+		t.Fatalf("Failed to send invoice: %v", err)
+	}
+
+	entries, err := journal.FindByZKI(zki)
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("Expected both attempts of the invoice, got %d %v", len(entries), err)
+	}
+	failed, accepted := entries[0], entries[1]
+	if failed.Error == "" || failed.JIR != "" {
+		t.Errorf("Expected the failed attempt without the JIR, got %+v", failed)
+	}
+	if accepted.JIR != result.JIR || accepted.Error != "" || accepted.IdPoruke != result.IdPoruke || accepted.InvoiceNumber != "1/"+fe.locationID+"/1" {
+		t.Errorf("Unexpected journal entry %+v", accepted)
+	}
+	if accepted.Location != fe.locationID || accepted.Device != 1 {
+		t.Errorf("Expected the location and the device, got %q %d", accepted.Location, accepted.Device)
+	}
+	if accepted.Exempt != "5.00" || accepted.Margin != "" || accepted.NotTaxable != "" {
+		t.Errorf("Expected the amounts outside of the taxes, got %q %q %q", accepted.Exempt, accepted.Margin, accepted.NotTaxable)
+	}
+	if accepted.PaymentMethod != string(CISCash) || accepted.Total != "10.00" {
+		t.Errorf("Expected the payment method and the total, got %q %q", accepted.PaymentMethod, accepted.Total)
+	}
+	if accepted.CertSerial == "" || accepted.CertSerial != fe.certificate().certSERIAL {
+		t.Errorf("Expected the certificate serial, got %q", accepted.CertSerial)
+	}
+	if accepted.RequestHash != hashHex(result.Request) || accepted.ResponseHash != hashHex([]byte(lastResponse)) {
+		t.Error("Expected the hashes of the exchanged messages")
+	}
+	if accepted.ResponseTime == "" || accepted.StatusCode != http.StatusOK || accepted.Time.IsZero() {
+		t.Errorf("Expected the response details, got %+v", accepted)
+	}
+
+	// The entries survive reopening the journal
+	if err := journal.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := NewFileJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if byJIR, err := reopened.FindByJIR(result.JIR); err != nil || len(byJIR) != 1 || byJIR[0].IdPoruke != result.IdPoruke {
+		t.Errorf("Expected the entry by the JIR, got %v", err)
+	}
+	if inRange, err := reopened.Range(accepted.Time.Add(-time.Minute), accepted.Time); err != nil || len(inRange) != 1 {
+		t.Errorf("Expected only the failed attempt before the accepted one, got %d %v", len(inRange), err)
+	}
+	if err := journal.Append(&JournalEntry{}); err == nil {
+		t.Error("Expected an error appending to a closed journal")
+	}
+
+	// Requests that were not sent are not journaled
+	invoice.ZastKod = "00000000000000000000000000000000"
+	if _, _, err := invoice.InvoiceRequest(); err == nil {
+		t.Fatal("Expected an error for an invalid ZKI")
+	}
+	if entries, _ := reopened.FindByZKI(invoice.ZastKod); len(entries) != 0 {
+		t.Errorf("Expected no entry for the invoice that was not sent, got %d", len(entries))
+	}
+}
+
+func TestFileJournalInvalidEntry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	if err := os.WriteFile(path, []byte("{\"zki\":\"a\"}\nnot json\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	journal, err := NewFileJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+	if _, err := journal.FindByZKI("a"); err == nil {
+		t.Error("Expected an error for the invalid line")
+	}
+}
+
+func TestMemoryJournal(t *testing.T) {
+	journal := NewMemoryJournal()
+	now := time.Now()
+	for i, zki := range []string{"b", "a", "b"} {
+		entry := &JournalEntry{Time: now.Add(-time.Duration(i) * time.Hour), ZKI: zki, JIR: fmt.Sprintf("jir%d", i)}
+		if err := journal.Append(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := journal.Append(nil); err == nil {
+		t.Error("Expected an error for a nil entry")
+	}
+
+	entries, _ := journal.FindByZKI("b")
+	if len(entries) != 2 || entries[0].JIR != "jir2" {
+		t.Errorf("Expected both entries oldest first, got %+v", entries)
+	}
+	entries[0].JIR = "changed"
+	if byJIR, _ := journal.FindByJIR("jir2"); len(byJIR) != 1 {
+		t.Error("Expected the journal to return copies")
+	}
+	if inRange, _ := journal.Range(now.Add(-90*time.Minute), now); len(inRange) != 1 || inRange[0].ZKI != "a" {
+		t.Errorf("Expected the entry in the range, got %+v", inRange)
+	}
+}
@@ -0,0 +1,111 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+)
+
+// journalCSVHeader are the columns of the CSV export
+var journalCSVHeader = []string{
+	"time", "invoice_number", "location", "device", "issued_at", "total", "payment_method", "zki", "jir", "id_poruke",
+	"late_delivery", "cert_serial", "request_hash", "response_hash", "response_time", "status_code", "error",
+}
+
+// JournalExport selects the journal entries to export for the accountants or for external BI tools
+type JournalExport struct {
+	// From and To is the time range of the entries, [From, To)
+	From, To time.Time
+
+	// Location selects the entries of a single business location, all locations if empty
+	Location string
+
+	// Device selects the entries of a single device, all devices if zero
+	Device uint
+
+	// Comma is the CSV field delimiter, ',' by default. Use ';' for Excel with the Croatian locale.
+	Comma rune
+}
+
+// Entries returns the selected journal entries, oldest first
+func (e *JournalExport) Entries(journal Journal) ([]*JournalEntry, error) {
+	if journal == nil {
+		return nil, errors.New("journal is nil")
+	}
+	if !e.From.Before(e.To) {
+		return nil, errors.New("export range is empty, From must be before To")
+	}
+	entries, err := journal.Range(e.From, e.To)
+	if err != nil {
+		return nil, err
+	}
+	selected := entries[:0]
+	for _, entry := range entries {
+		if (e.Location == "" || entry.Location == e.Location) && (e.Device == 0 || entry.Device == e.Device) {
+			selected = append(selected, entry)
+		}
+	}
+	return selected, nil
+}
+
+// CSV writes the selected entries as CSV with a header row, the times in RFC 3339
+func (e *JournalExport) CSV(w io.Writer, journal Journal) error {
+	entries, err := e.Entries(journal)
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	if e.Comma != 0 {
+		cw.Comma = e.Comma
+	}
+	if err := cw.Write(journalCSVHeader); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		err := cw.Write([]string{
+			entry.Time.Format(time.RFC3339),
+			entry.InvoiceNumber,
+			entry.Location,
+			strconv.FormatUint(uint64(entry.Device), 10),
+			entry.IssuedAt,
+			entry.Total,
+			entry.PaymentMethod,
+			entry.ZKI,
+			entry.JIR,
+			entry.IdPoruke,
+			strconv.FormatBool(entry.LateDelivery),
+			entry.CertSerial,
+			entry.RequestHash,
+			entry.ResponseHash,
+			entry.ResponseTime,
+			strconv.Itoa(entry.StatusCode),
+			entry.Error,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// JSON writes the selected entries as a JSON array, an empty array if there are none
+func (e *JournalExport) JSON(w io.Writer, journal Journal) error {
+	entries, err := e.Entries(journal)
+	if err != nil {
+		return err
+	}
+	if entries == nil {
+		entries = []*JournalEntry{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(entries)
+}
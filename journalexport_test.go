@@ -0,0 +1,104 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func newTestJournal(t *testing.T, day time.Time) Journal {
+	t.Helper()
+	journal := NewMemoryJournal()
+	for i, entry := range []*JournalEntry{
+		{Time: day.Add(8 * time.Hour), InvoiceNumber: "1/POS1/1", Location: "POS1", Device: 1, Total: "10.00", ZKI: "a", JIR: "jir-a"},
+		{Time: day.Add(9 * time.Hour), InvoiceNumber: "1/POS1/2", Location: "POS1", Device: 2, Total: "20.00", ZKI: "b", Error: "CIS is not available, \"s001\""},
+		{Time: day.Add(10 * time.Hour), InvoiceNumber: "1/POS2/1", Location: "POS2", Device: 1, Total: "30.00", ZKI: "c", JIR: "jir-c"},
+		{Time: day.Add(26 * time.Hour), InvoiceNumber: "2/POS1/1", Location: "POS1", Device: 1, Total: "40.00", ZKI: "d", JIR: "jir-d"},
+	} {
+		if err := journal.Append(entry); err != nil {
+			t.Fatalf("Failed to append entry %d: %v", i, err)
+		}
+	}
+	return journal
+}
+
+func TestJournalExport(t *testing.T) {
+	day := time.Date(2024, 5, 17, 0, 0, 0, 0, time.Local)
+	journal := newTestJournal(t, day)
+
+	tests := []struct {
+		name   string
+		export JournalExport
+		want   []string
+	}{
+		{"day", JournalExport{From: day, To: day.AddDate(0, 0, 1)}, []string{"a", "b", "c"}},
+		{"location", JournalExport{From: day, To: day.AddDate(0, 0, 2), Location: "POS1"}, []string{"a", "b", "d"}},
+		{"device", JournalExport{From: day, To: day.AddDate(0, 0, 1), Location: "POS1", Device: 2}, []string{"b"}},
+		{"nothing", JournalExport{From: day, To: day.AddDate(0, 0, 1), Location: "POS3"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tt.export.JSON(&buf, journal); err != nil {
+				t.Fatalf("JSON export failed: %v", err)
+			}
+			var entries []*JournalEntry
+			if err := json.Unmarshal(buf.Bytes(), &entries); err != nil || entries == nil {
+				t.Fatalf("Invalid JSON export %q: %v", buf.String(), err)
+			}
+			if len(entries) != len(tt.want) {
+				t.Fatalf("Expected %d entries, got %d", len(tt.want), len(entries))
+			}
+			for i, zki := range tt.want {
+				if entries[i].ZKI != zki {
+					t.Errorf("Entry %d: expected ZKI %s, got %s", i, zki, entries[i].ZKI)
+				}
+			}
+
+			buf.Reset()
+			tt.export.Comma = ';'
+			if err := tt.export.CSV(&buf, journal); err != nil {
+				t.Fatalf("CSV export failed: %v", err)
+			}
+			reader := csv.NewReader(&buf)
+			reader.Comma = ';'
+			records, err := reader.ReadAll()
+			if err != nil {
+				t.Fatalf("Invalid CSV export: %v", err)
+			}
+			if len(records) != len(tt.want)+1 || records[0][0] != "time" {
+				t.Fatalf("Expected the header and %d rows, got %d", len(tt.want), len(records))
+			}
+			for i, zki := range tt.want {
+				if records[i+1][7] != zki {
+					t.Errorf("Row %d: expected ZKI %s, got %s", i, zki, records[i+1][7])
+				}
+			}
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := (&JournalExport{From: day, To: day.AddDate(0, 0, 1), Device: 2}).CSV(&buf, journal); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil || len(records) != 2 {
+		t.Fatalf("Expected one row, got %v %v", records, err)
+	}
+	if records[1][16] != "CIS is not available, \"s001\"" || records[1][0] != day.Add(9*time.Hour).Format(time.RFC3339) {
+		t.Errorf("Unexpected row %v", records[1])
+	}
+
+	if err := (&JournalExport{From: day, To: day}).JSON(&buf, journal); err == nil {
+		t.Error("Expected an error for an empty range")
+	}
+	if err := (&JournalExport{From: day, To: day.AddDate(0, 0, 1)}).JSON(&buf, nil); err == nil {
+		t.Error("Expected an error for a nil journal")
+	}
+}
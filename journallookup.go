@@ -0,0 +1,87 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNotInJournal is returned when the invoice is not in the journal
+var ErrNotInJournal = errors.New("invoice not in the journal")
+
+// LookupJIR returns the JIR of the invoice with the ZKI, empty if the invoice is journaled but not fiscalized yet.
+// ErrNotInJournal is returned for an unknown ZKI.
+func LookupJIR(journal Journal, zki string) (string, error) {
+	if journal == nil {
+		return "", errors.New("journal is nil")
+	}
+	entries, err := journal.FindByZKI(zki)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		return "", fmt.Errorf("%w: ZKI %s", ErrNotInJournal, zki)
+	}
+	for _, entry := range entries {
+		if entry.JIR != "" {
+			return entry.JIR, nil
+		}
+	}
+	return "", nil
+}
+
+// LookupZKI returns the ZKI of the invoice with the JIR, e.g. to help a customer verifying a receipt.
+// ErrNotInJournal is returned for an unknown JIR.
+func LookupZKI(journal Journal, jir string) (string, error) {
+	if journal == nil {
+		return "", errors.New("journal is nil")
+	}
+	if jir == "" {
+		return "", errors.New("JIR is required")
+	}
+	entries, err := journal.FindByJIR(jir)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		return "", fmt.Errorf("%w: JIR %s", ErrNotInJournal, jir)
+	}
+	return entries[0].ZKI, nil
+}
+
+// MissingJIR returns the invoices journaled in [from, to) that never got the JIR, also not in a later attempt,
+// the last attempt of every invoice, oldest first. These invoices must still be delivered to CIS.
+func MissingJIR(journal Journal, from, to time.Time) ([]*JournalEntry, error) {
+	if journal == nil {
+		return nil, errors.New("journal is nil")
+	}
+	entries, err := journal.Range(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	last := make(map[string]*JournalEntry)
+	var order []string
+	for _, entry := range entries {
+		if _, seen := last[entry.ZKI]; !seen {
+			order = append(order, entry.ZKI)
+		}
+		last[entry.ZKI] = entry
+	}
+
+	var missing []*JournalEntry
+	for _, zki := range order {
+		jir, err := LookupJIR(journal, zki)
+		if err != nil {
+			return nil, err
+		}
+		if jir == "" {
+			missing = append(missing, last[zki])
+		}
+	}
+	return missing, nil
+}
@@ -0,0 +1,59 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestJournalLookup(t *testing.T) {
+	now := time.Now()
+	journal := NewMemoryJournal()
+	for _, entry := range []*JournalEntry{
+		{Time: now.Add(-5 * time.Hour), ZKI: "a", JIR: "jir-a"},
+		{Time: now.Add(-4 * time.Hour), ZKI: "b", Error: "timeout"},
+		{Time: now.Add(-3 * time.Hour), ZKI: "c", Error: "timeout"},
+		{Time: now.Add(-2 * time.Hour), ZKI: "b", Error: "timeout"},
+		// Delivered after the range
+		{Time: now.Add(-1 * time.Hour), ZKI: "c", JIR: "jir-c", LateDelivery: true},
+	} {
+		if err := journal.Append(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if jir, err := LookupJIR(journal, "a"); err != nil || jir != "jir-a" {
+		t.Errorf("LookupJIR(a) = %q %v", jir, err)
+	}
+	if jir, err := LookupJIR(journal, "c"); err != nil || jir != "jir-c" {
+		t.Errorf("LookupJIR(c) = %q %v", jir, err)
+	}
+	if jir, err := LookupJIR(journal, "b"); err != nil || jir != "" {
+		t.Errorf("LookupJIR(b) = %q %v, want no JIR", jir, err)
+	}
+	if _, err := LookupJIR(journal, "x"); !errors.Is(err, ErrNotInJournal) {
+		t.Errorf("LookupJIR(x) error = %v, want ErrNotInJournal", err)
+	}
+
+	if zki, err := LookupZKI(journal, "jir-c"); err != nil || zki != "c" {
+		t.Errorf("LookupZKI(jir-c) = %q %v", zki, err)
+	}
+	if _, err := LookupZKI(journal, "jir-x"); !errors.Is(err, ErrNotInJournal) {
+		t.Errorf("LookupZKI(jir-x) error = %v, want ErrNotInJournal", err)
+	}
+	if _, err := LookupZKI(journal, ""); err == nil {
+		t.Error("Expected an error for an empty JIR")
+	}
+
+	missing, err := MissingJIR(journal, now.Add(-6*time.Hour), now.Add(-90*time.Minute))
+	if err != nil {
+		t.Fatalf("MissingJIR failed: %v", err)
+	}
+	if len(missing) != 1 || missing[0].ZKI != "b" || !missing[0].Time.Equal(now.Add(-2*time.Hour)) {
+		t.Errorf("Expected the last attempt of b, got %+v", missing)
+	}
+}
@@ -0,0 +1,119 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"io"
+	"math/big"
+	"time"
+)
+
+// ErrEntityClosed is returned when signing with an entity after Close
+var ErrEntityClosed = errors.New("entity is closed")
+
+// WithKeyWipe sets whether the key material is wiped from memory: the P12 data passed to WithCertP12 is
+// overwritten once decoded, and Close wipes the private keys of all known certificates (the current one,
+// the certificate provider and the archive) and closes the signers with a Close method (e.g. oskeystore).
+// False by default. Don't enable it when the certificate provider or the archive is shared with other entities.
+func WithKeyWipe(wipe bool) Option {
+	return func(o *entityOptions) {
+		o.wipeKeys = wipe
+	}
+}
+
+// closedSigner replaces the signer of a closed entity
+type closedSigner struct {
+	public crypto.PublicKey
+}
+
+func (s closedSigner) Public() crypto.PublicKey {
+	return s.public
+}
+
+func (s closedSigner) Sign(io.Reader, []byte, crypto.SignerOpts) ([]byte, error) {
+	return nil, ErrEntityClosed
+}
+
+// Close releases the entity, it can't sign afterwards (ErrEntityClosed) and the certificate can't be reloaded.
+// The idle connections to CIS are closed, and with WithKeyWipe the private keys are wiped. The certificate
+// information stays available. Go keeps internal copies of the RSA primes that can't be wiped, so wiping
+// only reduces the exposure of the key in the memory and core dumps.
+func (fe *FiskalEntity) Close() error {
+	fe.certMu.RLock()
+	closed := fe.closed
+	fe.certMu.RUnlock()
+	if closed {
+		return nil
+	}
+	certs := fe.knownCertificates()
+
+	fe.certMu.Lock()
+	if fe.closed {
+		fe.certMu.Unlock()
+		return nil
+	}
+	fe.closed = true
+	cm := *fe.cert
+	cm.signer = closedSigner{public: cm.publicCert.PublicKey}
+	fe.cert = &cm
+	fe.certRecheck = time.Time{}
+	wipe := fe.wipeKeys
+	fe.certMu.Unlock()
+
+	fe.CloseIdleConnections()
+
+	if !wipe {
+		return nil
+	}
+	var errs []error
+	for _, cert := range certs {
+		if err := wipePrivateKey(cert.Signer); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// wipePrivateKey overwrites the private key, a signer with a Close method is closed instead
+func wipePrivateKey(signer crypto.Signer) error {
+	switch key := signer.(type) {
+	case *rsa.PrivateKey:
+		wipeBigInt(key.D)
+		for _, prime := range key.Primes {
+			wipeBigInt(prime)
+		}
+		wipeBigInt(key.Precomputed.Dp)
+		wipeBigInt(key.Precomputed.Dq)
+		wipeBigInt(key.Precomputed.Qinv)
+		for _, crt := range key.Precomputed.CRTValues {
+			wipeBigInt(crt.Exp)
+			wipeBigInt(crt.Coeff)
+			wipeBigInt(crt.R)
+		}
+	case *ecdsa.PrivateKey:
+		wipeBigInt(key.D)
+	case interface{ Close() error }:
+		return key.Close()
+	}
+	return nil
+}
+
+// wipeBigInt overwrites the words of the number and sets it to zero
+func wipeBigInt(x *big.Int) {
+	if x == nil {
+		return
+	}
+	clear(x.Bits())
+	x.SetInt64(0)
+}
+
+// wipeBytes overwrites the data, e.g. the decoded P12 bundle
+func wipeBytes(data []byte) {
+	clear(data)
+}
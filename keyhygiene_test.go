@@ -0,0 +1,107 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"testing"
+	"time"
+
+	gopkcs12 "software.sslmate.com/src/go-pkcs12"
+)
+
+// closingSigner records the Close call, like the oskeystore signer
+type closingSigner struct {
+	*ecdsa.PrivateKey
+	closed bool
+}
+
+func (s *closingSigner) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestCloseWipesKeys(t *testing.T) {
+	key, cert, caCert := newP12TestCert(t, testOIB)
+	data, err := gopkcs12.Modern.Encode(key, cert, []*x509.Certificate{caCert}, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fe, err := NewFiskalEntityWithOptions(testOIB, WithLocation("WIPE1"), WithCertP12(data, "secret"),
+		WithChainVerification(false), WithKeyWipe(true))
+	if err != nil {
+		t.Fatalf("Failed to create entity: %v", err)
+	}
+	if !bytes.Equal(data, make([]byte, len(data))) {
+		t.Errorf("Expected the P12 data to be wiped")
+	}
+
+	oldKey, oldCert, _ := newP12TestCert(t, testOIB)
+	if err := fe.CertArchive().Add(&Certificate{Signer: oldKey, Cert: oldCert}); err != nil {
+		t.Fatal(err)
+	}
+	ecKey, ecCert, _ := newP12TestECCert(t, testOIB)
+	closer := &closingSigner{PrivateKey: ecKey}
+	if err := fe.CertArchive().Add(&Certificate{Signer: closer, Cert: ecCert}); err != nil {
+		t.Fatal(err)
+	}
+
+	issued := time.Now()
+	if _, err := fe.GenerateZKI(issued, 1, 1, "10.00"); err != nil {
+		t.Fatalf("Failed to generate ZKI: %v", err)
+	}
+	serial := fe.GetCertSERIAL()
+
+	if err := fe.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := fe.Close(); err != nil {
+		t.Errorf("Expected the second Close to do nothing, got %v", err)
+	}
+
+	current, _ := fe.CertProvider().GetCurrent()
+	if current.Signer.(*rsa.PrivateKey).D.Sign() != 0 || oldKey.D.Sign() != 0 {
+		t.Errorf("Expected the private keys to be wiped")
+	}
+	if !closer.closed {
+		t.Errorf("Expected the signer to be closed")
+	}
+
+	if _, err := fe.GenerateZKI(issued, 1, 1, "10.00"); !errors.Is(err, ErrEntityClosed) {
+		t.Errorf("Expected ErrEntityClosed for the ZKI, got %v", err)
+	}
+	if _, err := fe.signXML([]byte(`<Test Id="t1"><A>1</A></Test>`)); !errors.Is(err, ErrEntityClosed) {
+		t.Errorf("Expected ErrEntityClosed for the XML signature, got %v", err)
+	}
+	if fe.GetCertSERIAL() != serial {
+		t.Errorf("Expected the certificate info to stay available")
+	}
+
+	path, _ := writeTestP12(t, testOIB)
+	if err := fe.ReloadCertificate(path, "renewed"); !errors.Is(err, ErrEntityClosed) {
+		t.Errorf("Expected the reload to fail after Close, got %v", err)
+	}
+}
+
+func TestCloseWithoutWipe(t *testing.T) {
+	key, cert, caCert := newP12TestCert(t, testOIB)
+	fe, err := NewFiskalEntityWithOptions(testOIB, WithLocation("WIPE1"), WithSigner(key, cert, caCert), WithChainVerification(false))
+	if err != nil {
+		t.Fatalf("Failed to create entity: %v", err)
+	}
+	if err := fe.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if key.D.Sign() == 0 {
+		t.Errorf("Expected the key not to be wiped without WithKeyWipe")
+	}
+	if _, err := fe.GenerateZKI(time.Now(), 1, 1, "10.00"); !errors.Is(err, ErrEntityClosed) {
+		t.Errorf("Expected ErrEntityClosed, got %v", err)
+	}
+}
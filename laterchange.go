@@ -0,0 +1,96 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// laterChangeResponse is the response to a later change of a fiscalized invoice (NapojnicaOdgovor,
+// PromijeniNacPlacOdgovor)
+type laterChangeResponse interface {
+	header() *ZaglavljeOdgovorType
+	greske() *GreskeType
+}
+
+func (o *NapojnicaOdgovor) header() *ZaglavljeOdgovorType        { return o.Zaglavlje }
+func (o *PromijeniNacPlacOdgovor) header() *ZaglavljeOdgovorType { return o.Zaglavlje }
+
+// checkLaterChange checks the invoice before a later change is built, the invoice must be the one fiscalized
+func (invoice *RacunType) checkLaterChange() error {
+	if invoice == nil || invoice.pointerToEntity == nil {
+		return newFiskalError(CategoryInput, errors.New("invoice is nil or not created by an entity"))
+	}
+	if invoice.ZastKod == "" {
+		return newFiskalError(CategoryInput, errors.New("invoice ZKI (Zastitni Kod Izdavatelja) must be set"))
+	}
+	_, err := invoice.checkZKI()
+	return err
+}
+
+// laterChangeRequest sends the request of a later change and unmarshals the response into odgovor. It reports
+// whether the response was parsed, the response is worth returning to the caller then, even with an error.
+func (fe *FiskalEntity) laterChangeRequest(zaglavlje *ZaglavljeType, xmlData []byte, header http.Header, odgovor laterChangeResponse) (bool, error) {
+	if err := fe.beginRequest(); err != nil {
+		return false, err
+	}
+	defer fe.endRequest()
+
+	sent := time.Now()
+	resp, errComm := fe.send("", xmlData, true, header)
+	body, status := resp.content, resp.status
+	if errComm != nil && len(body) == 0 {
+		return false, wrapFiskalError("failed to make request", CategoryTransport, errComm)
+	}
+	if errors.Is(errComm, ErrResponseSignature) {
+		return false, wrapFiskalError("failed to make request", CategoryOutcomeUnknown, errComm)
+	}
+
+	content, err := responseContent(body)
+	if err == nil {
+		err = xml.Unmarshal(content, odgovor)
+	}
+	if err != nil {
+		if errComm != nil {
+			return false, wrapFiskalError("failed to make request", CategoryTransport, errComm)
+		}
+		fErr := newFiskalError(CategoryResponse, fmt.Errorf("failed to unmarshal the CIS response: %w", err))
+		fErr.StatusCode = status
+		return false, fErr
+	}
+
+	if cisErrors := newCISErrors(odgovor.greske(), fe.Language()); cisErrors != nil {
+		return true, newCISFiskalError(cisErrors, status)
+	}
+	if errComm != nil {
+		return true, wrapFiskalError("failed to make request", CategoryTransport, errComm)
+	}
+	if odgovor.header() == nil || zaglavlje.IdPoruke != odgovor.header().IdPoruke {
+		fErr := newFiskalError(CategoryOutcomeUnknown, errors.New("IdPoruke mismatch"))
+		fErr.StatusCode = status
+		return true, fErr
+	}
+	if status != http.StatusOK {
+		fErr := newFiskalError(classifyStatus(status), fmt.Errorf("unexpected CIS response status: %d", status))
+		fErr.StatusCode = status
+		return true, fErr
+	}
+	now := time.Now()
+	if err := fe.responseGuard.check(odgovor.header(), sent, now); err != nil {
+		fErr := newFiskalError(CategoryOutcomeUnknown, err)
+		fErr.StatusCode = status
+		return true, fErr
+	}
+	if err := fe.responseGuard.accept(odgovor.header(), now); err != nil {
+		fErr := newFiskalError(CategoryOutcomeUnknown, err)
+		fErr.StatusCode = status
+		return true, fErr
+	}
+	return true, nil
+}
@@ -0,0 +1,111 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// LogLevels are the slog levels used for the different kinds of log records
+type LogLevels struct {
+	// Lifecycle is used for the request lifecycle: built, signed, sent, response received
+	Lifecycle slog.Level
+
+	// Success is used for successfully fiscalized invoices and echo requests
+	Success slog.Level
+
+	// Failure is used for failed requests
+	Failure slog.Level
+}
+
+// DefaultLogLevels are used if SetLogLevels was not called
+var DefaultLogLevels = LogLevels{
+	Lifecycle: slog.LevelDebug,
+	Success:   slog.LevelInfo,
+	Failure:   slog.LevelError,
+}
+
+// SetLogger sets the structured logger for the entity. By default (and with nil) nothing is logged.
+// The log records are redacted as set with SetRedaction, by default only the first and the last two digits
+// of the OIBs are kept.
+func (fe *FiskalEntity) SetLogger(logger *slog.Logger) {
+	fe.hooksMu.Lock()
+	defer fe.hooksMu.Unlock()
+	fe.logger = logger
+}
+
+// SetLogLevels sets the slog levels used for the log records, see DefaultLogLevels.
+func (fe *FiskalEntity) SetLogLevels(levels LogLevels) {
+	fe.hooksMu.Lock()
+	defer fe.hooksMu.Unlock()
+	fe.logLevels = &levels
+}
+
+// log writes a record if a logger is set and enabled for the level of the kind
+func (fe *FiskalEntity) log(kind func(LogLevels) slog.Level, msg string, attrs ...slog.Attr) {
+	if fe == nil {
+		return
+	}
+	fe.hooksMu.RLock()
+	logger := fe.logger
+	levels := DefaultLogLevels
+	if fe.logLevels != nil {
+		levels = *fe.logLevels
+	}
+	redaction := fe.redactionLocked()
+	fe.hooksMu.RUnlock()
+	if logger == nil {
+		return
+	}
+
+	ctx := context.Background()
+	level := kind(levels)
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+	redacted := make([]slog.Attr, 0, len(attrs)+2)
+	for _, attr := range attrs {
+		redacted = append(redacted, redaction.attr(attr))
+	}
+	redacted = append(redacted, redaction.attr(slog.String("oib", fe.oib)), slog.Bool("demo", fe.demoMode))
+	logger.LogAttrs(ctx, level, redaction.Redact(msg), redacted...)
+}
+
+func lifecycleLevel(l LogLevels) slog.Level { return l.Lifecycle }
+func successLevel(l LogLevels) slog.Level   { return l.Success }
+func failureLevel(l LogLevels) slog.Level   { return l.Failure }
+
+// errorAttrs returns the log attributes describing the error
+func errorAttrs(err error) []slog.Attr {
+	attrs := []slog.Attr{slog.String("error", err.Error())}
+	var fErr *FiskalError
+	if errors.As(err, &fErr) {
+		attrs = append(attrs, slog.String("category", string(fErr.Category)), slog.Bool("retriable", fErr.Retriable()))
+		if fErr.Code != "" {
+			attrs = append(attrs, slog.String("code", fErr.Code))
+		}
+	}
+	return attrs
+}
+
+// invoiceNumber returns the invoice number in the printed form, e.g. 1/POS1/1
+func invoiceNumber(invoice *RacunType) string {
+	if invoice == nil || invoice.BrRac == nil {
+		return ""
+	}
+	return fmt.Sprintf("%d/%s/%d", invoice.BrRac.BrOznRac, invoice.BrRac.OznPosPr, invoice.BrRac.OznNapUr)
+}
+
+// redactOIB hides all but the first and the last two digits of the OIB
+func redactOIB(oib string) string {
+	if len(oib) <= 4 {
+		return strings.Repeat("*", len(oib))
+	}
+	return oib[:2] + strings.Repeat("*", len(oib)-4) + oib[len(oib)-2:]
+}
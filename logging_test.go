@@ -0,0 +1,58 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	fe := newTestServerEntity(t, echoHandler)
+
+	var buf bytes.Buffer
+	fe.SetLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	if _, err := fe.EchoRequest("log me"); err != nil {
+		t.Fatalf("EchoRequest failed: %v", err)
+	}
+
+	out := buf.String()
+	for _, msg := range []string{"sending CIS request", "CIS response received", "CIS echo request successful"} {
+		if !strings.Contains(out, msg) {
+			t.Errorf("Expected %q in the log, got:\n%s", msg, out)
+		}
+	}
+	if strings.Contains(out, testOIB) {
+		t.Errorf("The OIB must be redacted in the log, got:\n%s", out)
+	}
+	if !strings.Contains(out, "oib="+redactOIB(testOIB)) {
+		t.Errorf("Expected the redacted OIB in the log, got:\n%s", out)
+	}
+
+	// With the lifecycle moved below the handler level only the result is logged
+	buf.Reset()
+	fe.SetLogLevels(LogLevels{Lifecycle: slog.LevelDebug - 4, Success: slog.LevelInfo, Failure: slog.LevelError})
+	fe.url = "https://127.0.0.1:1/FiskalizacijaService"
+	fe.EchoRequest("fail")
+	out = buf.String()
+	if strings.Contains(out, "sending CIS request") || !strings.Contains(out, "level=ERROR msg=\"CIS echo request failed\"") {
+		t.Errorf("Unexpected log output:\n%s", out)
+	}
+	if !strings.Contains(out, "category=transport") || !strings.Contains(out, "retriable=true") {
+		t.Errorf("Expected the error classification in the log, got:\n%s", out)
+	}
+}
+
+func TestRedactOIB(t *testing.T) {
+	if got := redactOIB("65049901548"); got != "65*******48" {
+		t.Errorf("Unexpected redacted OIB: %s", got)
+	}
+	if got := redactOIB("123"); got != "***" {
+		t.Errorf("Unexpected redacted short OIB: %s", got)
+	}
+}
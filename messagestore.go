@@ -0,0 +1,235 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"errors"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MessageState is the outcome of a message sent to CIS
+type MessageState string
+
+const (
+	MessageInFlight MessageState = "in-flight" // Sent, the outcome is unknown (no valid response was received)
+	MessageRejected MessageState = "rejected"  // CIS rejected the request with a validation error
+)
+
+// MessageRecord is an IdPoruke issued for an invoice with the outcome of the request
+type MessageRecord struct {
+	IdPoruke  string       `json:"id_poruke"`
+	RequestID string       `json:"request_id"`
+	ZKI       string       `json:"zki"`
+	State     MessageState `json:"state"`
+
+	// Created is the time of the first attempt, Updated of the last change
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+
+	// Attempts is the number of times the message was sent
+	Attempts int `json:"attempts"`
+
+	// Error of the last attempt
+	Error string `json:"error,omitempty"`
+}
+
+// MessageStore persists the issued IdPoruke values with their outcomes. An invoice whose message is still in flight
+// after a crash or a timeout is resent with the original IdPoruke and request Id, so CIS sees the same message again
+// instead of a new one. The record is deleted once CIS returns the JIR, so the store holds only the messages in
+// flight and the rejected ones. A reference implementation using bbolt is available in the boltstore subpackage,
+// NewMemoryMessageStore is for tests. Implementations must be safe for concurrent use.
+type MessageStore interface {
+	// Put inserts or replaces the record with the same IdPoruke
+	Put(record *MessageRecord) error
+
+	// Get returns the record with the IdPoruke, nil if it is not in the store
+	Get(idPoruke string) (*MessageRecord, error)
+
+	// Lookup returns the last stored record of the invoice with the ZKI, nil if there is none. It is called for
+	// every invoice request, so it must not scan the whole store.
+	Lookup(zki string) (*MessageRecord, error)
+
+	// InFlight returns the records in the MessageInFlight state, oldest first
+	InFlight() ([]*MessageRecord, error)
+
+	// Delete removes the record, e.g. an accepted or an old rejected one. Deleting a missing record is not an error.
+	Delete(idPoruke string) error
+}
+
+// WithMessageStore keeps the issued IdPoruke values in the store, see SetMessageStore
+func WithMessageStore(store MessageStore) Option {
+	return func(o *entityOptions) {
+		o.messageStore = store
+	}
+}
+
+// SetMessageStore sets the store of the issued IdPoruke values. Use nil to remove it.
+func (fe *FiskalEntity) SetMessageStore(store MessageStore) {
+	fe.hooksMu.Lock()
+	defer fe.hooksMu.Unlock()
+	fe.messageStore = store
+}
+
+// getMessageStore returns the message store, nil if not set
+func (fe *FiskalEntity) getMessageStore() MessageStore {
+	fe.hooksMu.RLock()
+	defer fe.hooksMu.RUnlock()
+	return fe.messageStore
+}
+
+// InFlightMessages returns the messages sent without a known outcome, e.g. after a restart. Send their invoices
+// again (e.g. from the OfflineQueue), they go out with the original IdPoruke.
+func (fe *FiskalEntity) InFlightMessages() ([]*MessageRecord, error) {
+	store := fe.getMessageStore()
+	if store == nil {
+		return nil, errors.New("message store is not set")
+	}
+	return store.InFlight()
+}
+
+// messageIDs returns the request Id and IdPoruke of the invoice request, the original ones
+// if a message of the invoice is still in flight
+func (fe *FiskalEntity) messageIDs(invoice *RacunType) (string, string, error) {
+	if store := fe.getMessageStore(); store != nil {
+		record, err := store.Lookup(invoice.ZastKod)
+		if err != nil {
+			fe.log(failureLevel, "failed to read the message store", append(errorAttrs(err), slog.String("zki", invoice.ZastKod))...)
+		}
+		if err == nil && record != nil && record.State == MessageInFlight {
+			fe.log(lifecycleLevel, "resending the message in flight", slog.String("zki", record.ZKI), slog.String("id_poruke", record.IdPoruke))
+			return record.RequestID, record.IdPoruke, nil
+		}
+	}
+	return fe.invoiceRequestIDs(invoice)
+}
+
+// recordMessageSent stores the message as in flight before it is sent
+func (fe *FiskalEntity) recordMessageSent(requestID, idPoruke, zki string) {
+	store := fe.getMessageStore()
+	if store == nil {
+		return
+	}
+	now := time.Now()
+	record, err := store.Get(idPoruke)
+	if err == nil && record == nil {
+		record = &MessageRecord{IdPoruke: idPoruke, RequestID: requestID, ZKI: zki, Created: now}
+	}
+	if err == nil {
+		record.State, record.Updated = MessageInFlight, now
+		record.Attempts++
+		err = store.Put(record)
+	}
+	if err != nil {
+		fe.log(failureLevel, "failed to store the message", append(errorAttrs(err), slog.String("id_poruke", idPoruke))...)
+	}
+}
+
+// recordMessageOutcome updates the message with the outcome of the invoice request. The message stays in flight
+// unless CIS returned the JIR or rejected the request, so an unknown outcome is resent with the same IdPoruke.
+// An accepted message is deleted, the JIR is kept by the caller and the message archive.
+func (fe *FiskalEntity) recordMessageOutcome(result *InvoiceResult, reqErr error) {
+	if fe == nil || result.Request == nil {
+		return
+	}
+	store := fe.getMessageStore()
+	if store == nil {
+		return
+	}
+	if result.JIR != "" {
+		if err := store.Delete(result.IdPoruke); err != nil {
+			fe.log(failureLevel, "failed to delete the accepted message", append(errorAttrs(err), slog.String("id_poruke", result.IdPoruke))...)
+		}
+		return
+	}
+	record, err := store.Get(result.IdPoruke)
+	if err == nil && record != nil {
+		var fErr *FiskalError
+		switch {
+		case errors.As(reqErr, &fErr) && fErr.Category == CategoryCISValidation:
+			record.State, record.Error = MessageRejected, reqErr.Error()
+		case reqErr != nil:
+			record.Error = reqErr.Error()
+		}
+		record.Updated = time.Now()
+		err = store.Put(record)
+	}
+	if err != nil {
+		fe.log(failureLevel, "failed to store the message outcome", append(errorAttrs(err), slog.String("id_poruke", result.IdPoruke))...)
+	}
+}
+
+// memoryMessageStore is a simple in-memory MessageStore
+type memoryMessageStore struct {
+	mu      sync.Mutex
+	records map[string]*MessageRecord
+	byZKI   map[string]string // ZKI to the IdPoruke of its last record
+}
+
+// NewMemoryMessageStore returns a MessageStore that keeps everything in memory.
+// The records are lost when the process exits, so use it only for tests.
+func NewMemoryMessageStore() MessageStore {
+	return &memoryMessageStore{records: make(map[string]*MessageRecord), byZKI: make(map[string]string)}
+}
+
+func (s *memoryMessageStore) Put(record *MessageRecord) error {
+	if record == nil || record.IdPoruke == "" {
+		return errors.New("message record must have an IdPoruke")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cpy := *record
+	s.records[record.IdPoruke] = &cpy
+	s.byZKI[record.ZKI] = record.IdPoruke
+	return nil
+}
+
+func (s *memoryMessageStore) Get(idPoruke string) (*MessageRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.records[idPoruke]
+	if !ok {
+		return nil, nil
+	}
+	cpy := *record
+	return &cpy, nil
+}
+
+func (s *memoryMessageStore) Lookup(zki string) (*MessageRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.records[s.byZKI[zki]]
+	if !ok {
+		return nil, nil
+	}
+	cpy := *record
+	return &cpy, nil
+}
+
+func (s *memoryMessageStore) InFlight() ([]*MessageRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []*MessageRecord
+	for _, record := range s.records {
+		if record.State == MessageInFlight {
+			cpy := *record
+			list = append(list, &cpy)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	return list, nil
+}
+
+func (s *memoryMessageStore) Delete(idPoruke string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if record, ok := s.records[idPoruke]; ok && s.byZKI[record.ZKI] == idPoruke {
+		delete(s.byZKI, record.ZKI)
+	}
+	delete(s.records, idPoruke)
+	return nil
+}
@@ -0,0 +1,119 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+func TestMessageStore(t *testing.T) {
+	key, cert := newTestCISSigningCert(t)
+	var fail bool
+	var idPoruke []string
+	fe := newTestServerEntity(t, func(w http.ResponseWriter, r *http.Request) {
+		doc := etree.NewDocument()
+		if _, err := doc.ReadFrom(r.Body); err != nil {
+			t.Error(err)
+			return
+		}
+		idPoruke = append(idPoruke, doc.FindElement("//IdPoruke").Text())
+		if fail {
+			// The request was received, but the response is lost
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		response := fmt.Sprintf(testCISResponse, "G0x1", doc.FindElement("//IdPoruke").Text(), doc.FindElement("//DatumVrijeme").Text(), "9d6f5bb6-da48-4fcd-a803-4586a025e0e4")
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprint(w, signTestCISResponse(t, key, response, MakeC14N10RecCanonicalizer()))
+	})
+	fe.ciscert = newSignatureCheckCIScert(cert, fe.ciscert.SSLverifyPoll)
+
+	if _, err := fe.InFlightMessages(); err == nil {
+		t.Error("Expected an error without a message store")
+	}
+	store := &scanCountingStore{MessageStore: NewMemoryMessageStore()}
+	fe.SetMessageStore(store)
+
+	invoice, zki, err := fe.NewCISInvoice(time.Now(), 1, 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "10.00", CISCash, "12345678901")
+	if err != nil {
+		t.Fatalf("Failed to create invoice: %v", err)
+	}
+
+	fail = true
+	if _, _, err := invoice.InvoiceRequest(); err == nil {
+		t.Fatal("Expected the request to fail")
+	}
+	inFlight, err := fe.InFlightMessages()
+	if err != nil || len(inFlight) != 1 || inFlight[0].ZKI != zki || inFlight[0].IdPoruke != idPoruke[0] || inFlight[0].Error == "" {
+		t.Fatalf("Expected the message in flight, got %+v %v", inFlight, err)
+	}
+
+	// The retry goes out with the original IdPoruke
+	fail = false
+	result, err := invoice.InvoiceRequestResult()
+	if err != nil {
+		t.Fatalf("Failed to send invoice: %v", err)
+	}
+	if len(idPoruke) != 2 || idPoruke[1] != idPoruke[0] || result.IdPoruke != idPoruke[0] {
+		t.Errorf("Expected the retry with the original IdPoruke, got %v", idPoruke)
+	}
+	if record, err := store.Get(idPoruke[0]); err != nil || record != nil {
+		t.Errorf("Expected the accepted message to be deleted, got %+v %v", record, err)
+	}
+	if record, err := store.Lookup(zki); err != nil || record != nil {
+		t.Errorf("Expected no message of the fiscalized invoice, got %+v %v", record, err)
+	}
+	if inFlight, _ := fe.InFlightMessages(); len(inFlight) != 0 {
+		t.Errorf("Expected no messages in flight, got %d", len(inFlight))
+	}
+
+	// A new attempt of the fiscalized invoice gets a new IdPoruke
+	if _, _, err := invoice.InvoiceRequest(); err != nil {
+		t.Fatalf("Failed to send invoice: %v", err)
+	}
+	if len(idPoruke) != 3 || idPoruke[2] == idPoruke[0] {
+		t.Errorf("Expected a new IdPoruke, got %v", idPoruke)
+	}
+	// The requests look the invoice up by its ZKI, only InFlightMessages scans the store
+	if store.scans != 2 {
+		t.Errorf("Expected the store to be scanned only by InFlightMessages, got %d scans", store.scans)
+	}
+}
+
+// scanCountingStore counts the InFlight calls of the store
+type scanCountingStore struct {
+	MessageStore
+	scans int
+}
+
+func (s *scanCountingStore) InFlight() ([]*MessageRecord, error) {
+	s.scans++
+	return s.MessageStore.InFlight()
+}
+
+func TestMessageStoreRejected(t *testing.T) {
+	fe := newTestEntity(t)
+	store := NewMemoryMessageStore()
+	fe.SetMessageStore(store)
+	if err := store.Put(&MessageRecord{IdPoruke: "id", ZKI: "zki", State: MessageInFlight}); err != nil {
+		t.Fatal(err)
+	}
+
+	rejected := newFiskalError(CategoryCISValidation, errors.New("s006 invalid OIB"))
+	fe.recordMessageOutcome(&InvoiceResult{IdPoruke: "id", Request: []byte("<request/>")}, rejected)
+	if record, _ := store.Lookup("zki"); record == nil || record.State != MessageRejected || record.Error == "" {
+		t.Errorf("Expected the rejected message, got %+v", record)
+	}
+	// The corrected invoice is sent as a new message
+	if requestID, idPoruke, _ := fe.messageIDs(&RacunType{ZastKod: "zki"}); idPoruke == "id" || requestID == "" {
+		t.Errorf("Expected new IDs after the rejection, got %s %s", requestID, idPoruke)
+	}
+}
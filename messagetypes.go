@@ -0,0 +1,278 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+
+	"github.com/l-d-t/fiskalhrgo/schema"
+)
+
+// FiscalizationVersion is the generation of the fiscalization messages an entity may send
+type FiscalizationVersion int
+
+const (
+	// Fiscalization1 are the CIS messages of the fiscalization of cash transactions in use since 2013 (default)
+	Fiscalization1 FiscalizationVersion = 1
+
+	// Fiscalization2 is for the messages of the Fiskalizacija 2.0 reform (fiscalization of the B2B eRačun).
+	// None is built in, they are registered with RegisterMessageType from the published schemas and must
+	// have their own endpoint, see MessageType.Endpoint.
+	Fiscalization2 FiscalizationVersion = 2
+)
+
+// IsValid checks if the version is supported
+func (v FiscalizationVersion) IsValid() bool {
+	return v == Fiscalization1 || v == Fiscalization2
+}
+
+// MessageType describes a request message known to the library, see RegisterMessageType
+type MessageType struct {
+	// Name is the root element of the request, e.g. "RacunZahtjev"
+	Name string
+
+	// Response is the root element of the response, e.g. "RacunOdgovor"
+	Response string
+
+	// Namespace of the request root element, not checked if empty
+	Namespace string
+
+	// Version is the fiscalization version that introduced the message, an entity sends it only
+	// if its version (see WithFiscalizationVersion) is the same or newer
+	Version FiscalizationVersion
+
+	// Endpoint is the https URL of the CIS service receiving the message, empty for the entity endpoint
+	// (see SetEndpoint). Required for the messages newer than Fiscalization1, they are not sent to the
+	// Fiscalization1 service.
+	Endpoint string
+
+	// Signed is true if the request is signed and the signature of the response is verified
+	Signed bool
+}
+
+// messageTypes is the registry of the message types, keyed by name
+var messageTypes = struct {
+	mu    sync.RWMutex
+	types map[string]MessageType
+}{types: make(map[string]MessageType)}
+
+func init() {
+	for _, mt := range []MessageType{
+		{Name: "RacunZahtjev", Response: "RacunOdgovor", Namespace: DefaultNamespace, Version: Fiscalization1, Signed: true},
+		{Name: "PromijeniNacPlacZahtjev", Response: "PromijeniNacPlacOdgovor", Namespace: DefaultNamespace, Version: Fiscalization1, Signed: true},
+		{Name: "NapojnicaZahtjev", Response: "NapojnicaOdgovor", Namespace: DefaultNamespace, Version: Fiscalization1, Signed: true},
+		{Name: "PrateciDokumentiZahtjev", Response: "PrateciDokumentiOdgovor", Namespace: DefaultNamespace, Version: Fiscalization1, Signed: true},
+		{Name: "RacunPDZahtjev", Response: "RacunPDOdgovor", Namespace: DefaultNamespace, Version: Fiscalization1, Signed: true},
+		{Name: "EchoRequest", Response: "EchoResponse", Namespace: DefaultNamespace, Version: Fiscalization1},
+	} {
+		messageTypes.types[mt.Name] = mt
+	}
+}
+
+// RegisterMessageType adds a message type to the registry or replaces the one with the same name, e.g. to pilot
+// a new message from its published schema or to follow a new version of a schema without waiting for
+// a library release. The registry is shared by all entities.
+func RegisterMessageType(mt MessageType) error {
+	if mt.Name == "" || mt.Response == "" {
+		return errors.New("message type name and response must be set")
+	}
+	if !mt.Version.IsValid() {
+		return fmt.Errorf("unsupported fiscalization version: %d", mt.Version)
+	}
+	if mt.Endpoint != "" {
+		if u, err := url.Parse(mt.Endpoint); err != nil || u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("endpoint of %s must be an absolute https URL", mt.Name)
+		}
+	} else if mt.Version > Fiscalization1 {
+		return fmt.Errorf("%s of fiscalization version %d must have its endpoint", mt.Name, mt.Version)
+	}
+	messageTypes.mu.Lock()
+	defer messageTypes.mu.Unlock()
+	messageTypes.types[mt.Name] = mt
+	return nil
+}
+
+// LookupMessageType returns the registered message type with the name (the root element of the request)
+func LookupMessageType(name string) (MessageType, bool) {
+	messageTypes.mu.RLock()
+	defer messageTypes.mu.RUnlock()
+	mt, ok := messageTypes.types[name]
+	return mt, ok
+}
+
+// MessageTypes returns all registered message types ordered by version and name
+func MessageTypes() []MessageType {
+	messageTypes.mu.RLock()
+	list := make([]MessageType, 0, len(messageTypes.types))
+	for _, mt := range messageTypes.types {
+		list = append(list, mt)
+	}
+	messageTypes.mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Version != list[j].Version {
+			return list[i].Version < list[j].Version
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// SetFiscalizationVersion sets the newest fiscalization version whose messages the entity may send with
+// SendMessage, see WithFiscalizationVersion
+func (fe *FiskalEntity) SetFiscalizationVersion(version FiscalizationVersion) error {
+	if !version.IsValid() {
+		return fmt.Errorf("unsupported fiscalization version: %d", version)
+	}
+	fe.version.Store(int32(version))
+	return nil
+}
+
+// FiscalizationVersion returns the fiscalization version of the entity, Fiscalization1 by default
+func (fe *FiskalEntity) FiscalizationVersion() FiscalizationVersion {
+	if v := FiscalizationVersion(fe.version.Load()); v.IsValid() {
+		return v
+	}
+	return Fiscalization1
+}
+
+// RawMessage is a request already marshaled to XML, e.g. from types generated from a new schema.
+// The root element must have the Id attribute if the message is signed.
+type RawMessage []byte
+
+// MessageResult is the outcome of SendMessage
+type MessageResult struct {
+	// Type of the sent message
+	Type MessageType
+
+	// StatusCode is the HTTP status code of the CIS response, 0 if no response was received
+	StatusCode int
+
+	// Metadata describes the HTTP response and the TLS connection, nil if no response was received
+	// or the transport is not based on HTTP
+	Metadata *ResponseMetadata
+
+	// Content is the inner content of the SOAP Body of the response (the response message)
+	Content []byte
+}
+
+// SendMessage sends a request of any registered message type (see MessageType) and unmarshals the response message
+// into response, if it is not nil. The request is a struct marshaled with encoding/xml or a RawMessage. The message
+// type is found by the root element of the request, it must be registered and allowed by the fiscalization version
+// of the entity. Signed messages are signed with the fiscal certificate and the signature of the response is verified.
+//
+// It is the generic path for the messages without a dedicated method, e.g. the Fiskalizacija 2.0 messages
+// registered from their published schemas. The messages unknown to the registry are refused, with the schema
+// validation (see WithSchemaValidation) also the ones without a known schema. If the response has an Errors() []GreskaType method (like RacunOdgovor), the errors
+// are returned as CISErrors. The header of the response is not checked, unlike in the dedicated methods.
+// All errors are *FiskalError.
+func (fe *FiskalEntity) SendMessage(request any, response any) (*MessageResult, error) {
+	var xmlData []byte
+	switch r := request.(type) {
+	case RawMessage:
+		xmlData = r
+	case nil:
+		return nil, newFiskalError(CategoryInput, errors.New("request is nil"))
+	default:
+		var err error
+		if xmlData, err = xml.Marshal(request); err != nil {
+			return nil, newFiskalError(CategoryInput, fmt.Errorf("failed to marshal the request: %w", err))
+		}
+	}
+	mt, err := fe.messageType(xmlData)
+	if err != nil {
+		return nil, newFiskalError(CategoryInput, err)
+	}
+	result := &MessageResult{Type: mt}
+	if fe.schemaValidation {
+		if !schema.Has(mt.Name) {
+			return result, newFiskalError(CategoryInput, fmt.Errorf("no schema to validate %s", mt.Name))
+		}
+		if err := ValidateRequestXML(xmlData); err != nil {
+			return result, newFiskalError(CategoryInput, err)
+		}
+	}
+
+	if err := fe.beginRequest(); err != nil {
+		return result, err
+	}
+	defer fe.endRequest()
+	resp, errComm := fe.send(mt.Endpoint, xmlData, mt.Signed, nil)
+	result.StatusCode, result.Content, result.Metadata = resp.status, resp.content, resp.meta
+	err = fe.messageResponse(mt, resp, errComm, response)
+	if err != nil {
+		fe.log(failureLevel, "CIS message failed", append(errorAttrs(err), slog.String("message", mt.Name))...)
+	} else {
+		fe.log(successLevel, "CIS message successful", slog.String("message", mt.Name))
+	}
+	return result, fe.redactError(err)
+}
+
+// messageType returns the registered type of the request, if the entity may send it
+func (fe *FiskalEntity) messageType(xmlData []byte) (MessageType, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(xmlData))
+	root, err := nextStartElement(decoder)
+	if err != nil {
+		return MessageType{}, fmt.Errorf("invalid request XML: %w", err)
+	}
+	mt, ok := LookupMessageType(root.Name.Local)
+	if !ok {
+		return MessageType{}, fmt.Errorf("unknown message type %s, see RegisterMessageType", root.Name.Local)
+	}
+	if mt.Namespace != "" && root.Name.Space != mt.Namespace {
+		return mt, fmt.Errorf("the namespace of %s must be %s", mt.Name, mt.Namespace)
+	}
+	if version := fe.FiscalizationVersion(); mt.Version > version {
+		return mt, fmt.Errorf("%s requires fiscalization version %d, the entity uses version %d (see WithFiscalizationVersion)", mt.Name, mt.Version, version)
+	}
+	return mt, nil
+}
+
+// messageResponse checks the response of SendMessage and unmarshals it into response
+func (fe *FiskalEntity) messageResponse(mt MessageType, resp *cisResponse, errComm error, response any) error {
+	if errComm != nil && (len(resp.content) == 0 || errors.Is(errComm, ErrResponseSignature)) {
+		return errComm
+	}
+	if response != nil && len(resp.content) > 0 {
+		if err := xml.Unmarshal(resp.content, response); err != nil {
+			if errComm != nil {
+				return errComm
+			}
+			fErr := newFiskalError(CategoryResponse, fmt.Errorf("failed to unmarshal %s: %w", mt.Response, err))
+			fErr.StatusCode = resp.status
+			return fErr
+		}
+		if withErrors, ok := response.(interface{ Errors() []GreskaType }); ok {
+			if cisErrors := newCISErrors(&GreskeType{Greska: greskaPointers(withErrors.Errors())}, fe.Language()); cisErrors != nil {
+				return newCISFiskalError(cisErrors, resp.status)
+			}
+		}
+	}
+	if errComm != nil {
+		return errComm
+	}
+	if resp.status != http.StatusOK {
+		fErr := newFiskalError(classifyStatus(resp.status), fmt.Errorf("unexpected CIS response status: %d", resp.status))
+		fErr.StatusCode = resp.status
+		return fErr
+	}
+	return nil
+}
+
+// greskaPointers returns pointers to the errors
+func greskaPointers(errs []GreskaType) []*GreskaType {
+	pointers := make([]*GreskaType, len(errs))
+	for i := range errs {
+		pointers[i] = &errs[i]
+	}
+	return pointers
+}
@@ -0,0 +1,135 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/beevik/etree"
+)
+
+func TestMessageTypeRegistry(t *testing.T) {
+	mt, ok := LookupMessageType("RacunZahtjev")
+	if !ok || mt.Response != "RacunOdgovor" || !mt.Signed || mt.Version != Fiscalization1 || mt.Namespace != DefaultNamespace {
+		t.Errorf("Unexpected RacunZahtjev %+v", mt)
+	}
+	if mt, ok := LookupMessageType("EvidentirajERacunZahtjev"); ok {
+		t.Errorf("Expected no built-in message without a published schema, got %+v", mt)
+	}
+
+	types := MessageTypes()
+	for i := 1; i < len(types); i++ {
+		if types[i-1].Version > types[i].Version {
+			t.Fatalf("Expected the types ordered by version, got %v", types)
+		}
+	}
+
+	if err := RegisterMessageType(MessageType{Name: "TestZahtjev"}); err == nil {
+		t.Error("Expected an error without the response")
+	}
+	if err := RegisterMessageType(MessageType{Name: "TestZahtjev", Response: "TestOdgovor", Version: 3}); err == nil {
+		t.Error("Expected an error for an unsupported version")
+	}
+	if err := RegisterMessageType(MessageType{Name: "TestZahtjev", Response: "TestOdgovor", Version: Fiscalization2}); err == nil {
+		t.Error("Expected an error for a new message without its endpoint")
+	}
+	if err := RegisterMessageType(MessageType{Name: "TestZahtjev", Response: "TestOdgovor", Version: Fiscalization2, Endpoint: "http://cis.example/test"}); err == nil {
+		t.Error("Expected an error for an endpoint without https")
+	}
+	if _, ok := LookupMessageType("TestZahtjev"); ok {
+		t.Error("Expected the invalid message types not to be registered")
+	}
+}
+
+func TestSendMessage(t *testing.T) {
+	key, cert := newTestCISSigningCert(t)
+	fe := newTestServerEntity(t, func(w http.ResponseWriter, r *http.Request) {
+		doc := etree.NewDocument()
+		if _, err := doc.ReadFrom(r.Body); err != nil {
+			t.Error(err)
+			return
+		}
+		if doc.FindElement("//Body/EchoRequest") != nil {
+			w.Header().Set("Content-Type", "text/xml")
+			fmt.Fprintf(w, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><tns:EchoResponse xmlns:tns="http://www.apis-it.hr/fin/2012/types/f73">%s</tns:EchoResponse></soap:Body></soap:Envelope>`, doc.FindElement("//EchoRequest").Text())
+			return
+		}
+		if r.URL.Path != "/pilot" {
+			t.Errorf("Expected the pilot message at its endpoint, got %s", r.URL.Path)
+		}
+		if doc.FindElement("//Body/PilotZahtjev/Signature") == nil {
+			t.Error("Expected the signed pilot message")
+		}
+		greske := ""
+		if doc.FindElement("//Body/PilotZahtjev/Broj").Text() == "2" {
+			greske = `<Greske><Greska><SifraGreske>v101</SifraGreske><PorukaGreske>Neispravan broj</PorukaGreske></Greska></Greske>`
+		}
+		response := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><PilotOdgovor Id="G1"><Status>OK</Status>` + greske + `</PilotOdgovor></soap:Body></soap:Envelope>`
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprint(w, signTestCISResponse(t, key, response, MakeC14N10RecCanonicalizer()))
+	})
+	fe.ciscert = newSignatureCheckCIScert(cert, fe.ciscert.SSLverifyPoll)
+
+	// A registered message of the current version
+	var echo EchoResponse
+	result, err := fe.SendMessage(&EchoRequest{Xmlns: DefaultNamespace, Text: "hello"}, &echo)
+	if err != nil || echo.Text != "hello" || result.Type.Name != "EchoRequest" || result.StatusCode != http.StatusOK {
+		t.Fatalf("Unexpected echo %q %+v %v", echo.Text, result, err)
+	}
+
+	// Unknown messages and the wrong namespace are refused
+	for _, raw := range []string{`<tns:Nepoznato xmlns:tns="x"/>`, `<EchoRequest>x</EchoRequest>`, `not xml`} {
+		var fErr *FiskalError
+		if _, err := fe.SendMessage(RawMessage(raw), nil); !errors.As(err, &fErr) || fErr.Category != CategoryInput {
+			t.Errorf("Expected an input error for %s, got %v", raw, err)
+		}
+	}
+
+	// A new message is sent only with the new version
+	if err := RegisterMessageType(MessageType{Name: "PilotZahtjev", Response: "PilotOdgovor", Version: Fiscalization2, Endpoint: fe.url + "/pilot", Signed: true}); err != nil {
+		t.Fatal(err)
+	}
+	pilot := func(number int) RawMessage {
+		return RawMessage(fmt.Sprintf(`<PilotZahtjev Id="pilot%d"><Broj>%d</Broj></PilotZahtjev>`, number, number))
+	}
+	if _, err := fe.SendMessage(pilot(1), nil); err == nil || !strings.Contains(err.Error(), "version") {
+		t.Errorf("Expected the version to be required, got %v", err)
+	}
+	if err := fe.SetFiscalizationVersion(5); err == nil {
+		t.Error("Expected an error for an unsupported version")
+	}
+	if err := fe.SetFiscalizationVersion(Fiscalization2); err != nil || fe.FiscalizationVersion() != Fiscalization2 {
+		t.Fatalf("Failed to set the version: %v", err)
+	}
+
+	var odgovor pilotOdgovor
+	if _, err := fe.SendMessage(pilot(1), &odgovor); err != nil || odgovor.Status != "OK" {
+		t.Errorf("Unexpected pilot response %+v %v", odgovor, err)
+	}
+	if _, err := fe.SendMessage(pilot(2), &pilotOdgovor{}); !errors.Is(err, ErrCISValidation) {
+		t.Errorf("Expected the CIS errors of the response, got %v", err)
+	}
+
+	// A message without a known schema is not sent unvalidated
+	fe.schemaValidation = true
+	var fErr *FiskalError
+	if _, err := fe.SendMessage(pilot(3), nil); !errors.As(err, &fErr) || fErr.Category != CategoryInput {
+		t.Errorf("Expected an input error without the schema, got %v", err)
+	}
+}
+
+// pilotOdgovor is the response of the pilot message, with the errors like the CIS responses
+type pilotOdgovor struct {
+	Status string      `xml:"Status"`
+	Greske *GreskeType `xml:"Greske"`
+}
+
+func (o *pilotOdgovor) Errors() []GreskaType {
+	return o.Greske.Errors()
+}
@@ -0,0 +1,69 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"time"
+)
+
+// OutcomeSuccess is the outcome reported to Metrics for successful requests,
+// failed requests are reported with the ErrorCategory of the error
+const OutcomeSuccess = "success"
+
+// Metrics receives the measurements of the communication with CIS.
+// A Prometheus implementation is available in the fiskalprom subpackage.
+// Implementations must be safe for concurrent use and should return quickly.
+type Metrics interface {
+	// ObserveRequest is called after every request to CIS with the operation (the name of the
+	// request message, e.g. "RacunZahtjev"), the outcome (OutcomeSuccess or the error category) and the duration
+	ObserveRequest(operation string, outcome string, duration time.Duration)
+
+	// ObserveSigning is called after every signing of a request message
+	ObserveSigning(duration time.Duration)
+}
+
+// SetMetrics sets the receiver of the request measurements, nil disables them.
+// The same Metrics can be shared by many entities.
+func (fe *FiskalEntity) SetMetrics(metrics Metrics) {
+	fe.hooksMu.Lock()
+	defer fe.hooksMu.Unlock()
+	fe.metrics = metrics
+}
+
+// getMetrics returns the metrics receiver or nil
+func (fe *FiskalEntity) getMetrics() Metrics {
+	fe.hooksMu.RLock()
+	defer fe.hooksMu.RUnlock()
+	return fe.metrics
+}
+
+// outcomeOf returns the outcome label of the error
+func outcomeOf(err error) string {
+	if err == nil {
+		return OutcomeSuccess
+	}
+	var fErr *FiskalError
+	if errors.As(err, &fErr) {
+		return string(fErr.Category)
+	}
+	return "unknown"
+}
+
+// operationName returns the local name of the root element of the request message, e.g. "RacunZahtjev"
+func operationName(xmlPayload []byte) string {
+	decoder := xml.NewDecoder(bytes.NewReader(xmlPayload))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "unknown"
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingMetrics struct {
+	mu       sync.Mutex
+	requests []string
+	signings int
+}
+
+func (m *recordingMetrics) ObserveRequest(operation string, outcome string, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests = append(m.requests, operation+"/"+outcome)
+}
+
+func (m *recordingMetrics) ObserveSigning(duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.signings++
+}
+
+func TestMetrics(t *testing.T) {
+	fe := newTestServerEntity(t, echoHandler)
+	metrics := &recordingMetrics{}
+	fe.SetMetrics(metrics)
+
+	if _, err := fe.EchoRequest("count me"); err != nil {
+		t.Fatalf("EchoRequest failed: %v", err)
+	}
+	fe.url = "https://127.0.0.1:1/FiskalizacijaService"
+	fe.EchoRequest("fail")
+
+	if len(metrics.requests) != 2 || metrics.requests[0] != "EchoRequest/success" || metrics.requests[1] != "EchoRequest/transport" {
+		t.Errorf("Unexpected observed requests: %v", metrics.requests)
+	}
+	if metrics.signings != 0 {
+		t.Errorf("Echo requests are not signed, got %d signings", metrics.signings)
+	}
+}
@@ -0,0 +1,93 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// multiCertProvider holds several certificates of one OIB and selects the current one by their validity
+type multiCertProvider struct {
+	certs []*Certificate
+	now   func() time.Time
+}
+
+// NewMultiCertProvider returns a CertProvider for several certificates of the same OIB, e.g. the old and the
+// renewed certificate during the renewal overlap. The current certificate is the valid one with the latest
+// expiry, chosen again whenever a certificate becomes valid or expires, so the entity switches to the renewed
+// certificate by itself. If no certificate is valid, the one with the latest expiry is current.
+// All certificates stay available to GenerateZKIWithCertificate.
+func NewMultiCertProvider(certs ...*Certificate) (CertProvider, error) {
+	if len(certs) == 0 {
+		return nil, errors.New("no certificates")
+	}
+	sorted := make([]*Certificate, 0, len(certs))
+	for _, cert := range certs {
+		if cert == nil || cert.Cert == nil {
+			return nil, errors.New("certificate is nil")
+		}
+		sorted = append(sorted, cert)
+	}
+	// Newest first
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Cert.NotAfter.After(sorted[j].Cert.NotAfter)
+	})
+	return &multiCertProvider{certs: sorted, now: time.Now}, nil
+}
+
+// WithCertificates uses several certificates of the entity OIB with automatic selection, see NewMultiCertProvider
+func WithCertificates(certs ...*Certificate) Option {
+	return func(o *entityOptions) {
+		o.certSource = func() (CertProvider, error) {
+			return NewMultiCertProvider(certs...)
+		}
+	}
+}
+
+func (p *multiCertProvider) GetCurrent() (*Certificate, error) {
+	now := p.now()
+	for _, cert := range p.certs {
+		if !now.Before(cert.Cert.NotBefore) && !now.After(cert.Cert.NotAfter) {
+			return cert, nil
+		}
+	}
+	return p.certs[0], nil
+}
+
+func (p *multiCertProvider) GetBySerial(serial string) (*Certificate, error) {
+	return findBySerial(p.certs, serial)
+}
+
+func (p *multiCertProvider) ListHistorical() ([]*Certificate, error) {
+	return append([]*Certificate(nil), p.certs...), nil
+}
+
+// nextSelection returns when the current certificate may change next, zero if never
+func (p *multiCertProvider) nextSelection(now time.Time) time.Time {
+	var next time.Time
+	for _, cert := range p.certs {
+		for _, t := range []time.Time{cert.Cert.NotBefore, cert.Cert.NotAfter.Add(time.Second)} {
+			if t.After(now) && (next.IsZero() || t.Before(next)) {
+				next = t
+			}
+		}
+	}
+	return next
+}
+
+// timeSelectingProvider is implemented by providers whose current certificate depends on the time
+type timeSelectingProvider interface {
+	nextSelection(now time.Time) time.Time
+}
+
+// certRecheckTime returns when the entity must ask the provider for the current certificate again, zero if never
+func certRecheckTime(provider CertProvider) time.Time {
+	if selecting, ok := provider.(timeSelectingProvider); ok {
+		return selecting.nextSelection(time.Now())
+	}
+	return time.Time{}
+}
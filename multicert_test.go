@@ -0,0 +1,80 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMultiCertProviderSelection(t *testing.T) {
+	now := time.Now()
+	oldKey, oldCert, _ := newP12TestCertValidity(t, testOIB, now.Add(-365*24*time.Hour), now.Add(24*time.Hour))
+	newKey, newCert, _ := newP12TestCertValidity(t, testOIB, now.Add(time.Hour), now.Add(2*365*24*time.Hour))
+	expiredKey, expiredCert, _ := newP12TestCertValidity(t, testOIB, now.Add(-3*365*24*time.Hour), now.Add(-365*24*time.Hour))
+
+	old := &Certificate{Signer: oldKey, Cert: oldCert}
+	renewed := &Certificate{Signer: newKey, Cert: newCert}
+	expired := &Certificate{Signer: expiredKey, Cert: expiredCert}
+
+	provider, err := NewMultiCertProvider(expired, renewed, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := provider.(*multiCertProvider)
+
+	tests := []struct {
+		at       time.Time
+		expected *Certificate
+	}{
+		{now, old},                                   // the renewed certificate is not valid yet
+		{now.Add(2 * time.Hour), renewed},            // overlap, the renewed one expires later
+		{now.Add(48 * time.Hour), renewed},           // the old one expired
+		{now.Add(3 * 365 * 24 * time.Hour), renewed}, // all expired, the newest one
+	}
+	for _, tt := range tests {
+		p.now = func() time.Time { return tt.at }
+		if current, _ := p.GetCurrent(); current != tt.expected {
+			t.Errorf("At %v expected serial %s, got %s", tt.at, tt.expected.Serial(), current.Serial())
+		}
+	}
+
+	if next := p.nextSelection(now); !next.Equal(newCert.NotBefore) {
+		t.Errorf("Expected the next selection when the renewed certificate becomes valid, got %v", next)
+	}
+	if all, _ := p.ListHistorical(); len(all) != 3 || all[0] != renewed || all[2] != expired {
+		t.Errorf("Expected all certificates, newest first")
+	}
+}
+
+func TestMultiCertEntitySwitch(t *testing.T) {
+	now := time.Now()
+	oldKey, oldCert, _ := newP12TestCertValidity(t, testOIB, now.Add(-365*24*time.Hour), now.Add(24*time.Hour))
+	// certificate times have a one second resolution
+	newKey, newCert, _ := newP12TestCertValidity(t, testOIB, time.Now().Add(2*time.Second), now.Add(365*24*time.Hour))
+
+	fe, err := NewFiskalEntityWithOptions(testOIB, WithLocation("MULTI1"), WithCertificates(
+		&Certificate{Signer: oldKey, Cert: oldCert},
+		&Certificate{Signer: newKey, Cert: newCert},
+	), WithChainVerification(false))
+	if err != nil {
+		t.Fatalf("Failed to create entity: %v", err)
+	}
+	if fe.GetCertSERIAL() != oldCert.SerialNumber.String() {
+		t.Fatalf("Expected the old certificate before the renewed one is valid")
+	}
+
+	issued := time.Date(2024, 10, 1, 12, 0, 0, 0, time.Local)
+	oldZKI, _ := fe.GenerateZKI(issued, 1, 1, "10.00")
+
+	time.Sleep(time.Until(newCert.NotBefore) + 50*time.Millisecond)
+
+	if fe.GetCertSERIAL() != newCert.SerialNumber.String() {
+		t.Errorf("Expected the entity to switch to the renewed certificate")
+	}
+	if zki, err := fe.GenerateZKIWithCertificate(oldCert.SerialNumber.String(), issued, 1, 1, "10.00"); err != nil || zki != oldZKI {
+		t.Errorf("Expected the old certificate to stay available, got %s %v", zki, err)
+	}
+}
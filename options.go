@@ -0,0 +1,373 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Option configures the FiskalEntity created by NewFiskalEntityWithOptions
+type Option func(*entityOptions)
+
+// entityOptions collects the settings of NewFiskalEntityWithOptions
+type entityOptions struct {
+	sustPDV                  bool
+	locationID               string
+	centralizedInvoiceNumber bool
+	demoMode                 bool
+	checkExpired             bool
+	verifyChain              bool
+	strictResponses          bool
+	responseVerifier         ResponseVerifier
+	schemaValidation         bool
+	idempotency              bool
+	responseMaxSkew          time.Duration
+	messageArchive           MessageArchive
+	debugDumpDir             string
+	clock                    func() time.Time
+	journal                  Journal
+	messageStore             MessageStore
+	idProvider               IDProvider
+	version                  FiscalizationVersion
+
+	// certSource returns the certificate provider, nil if no certificate option was given
+	certSource func() (CertProvider, error)
+
+	timeout    time.Duration
+	httpClient *http.Client
+	logger     *slog.Logger
+	redaction  *Redaction
+	revocation *RevocationConfig
+	archive    *CertArchive
+	wipeKeys   bool
+
+	// cisCertPEM and cisCertFile override the embedded CIS certificate
+	cisCertPEM  []byte
+	cisCertFile string
+}
+
+// WithLocation sets the business location ID (oznaka poslovnog prostora), required
+func WithLocation(locationID string) Option {
+	return func(o *entityOptions) {
+		o.locationID = locationID
+	}
+}
+
+// WithCertFile loads the P12 certificate from the file
+func WithCertFile(path string, password string) Option {
+	return func(o *entityOptions) {
+		o.certSource = func() (CertProvider, error) {
+			return NewFileCertProvider(CertFile{Path: path, Password: password})
+		}
+	}
+}
+
+// WithCertP12 loads the P12 certificate from the data, so it doesn't have to be written to disk.
+// With WithKeyWipe the data is overwritten once decoded.
+func WithCertP12(data []byte, password string) Option {
+	return func(o *entityOptions) {
+		o.certSource = func() (CertProvider, error) {
+			cert, err := ParseP12(data, password)
+			if o.wipeKeys {
+				wipeBytes(data)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("certificate decode fail: %v", err)
+			}
+			return NewMemoryCertProvider(cert)
+		}
+	}
+}
+
+// WithSigner uses the signer and its certificate instead of a P12 file, for private keys held in an HSM,
+// a TPM or a cloud KMS that never leave it. The signer must be an RSA or ECDSA key and is called with crypto.SHA1
+// (PKCS #1 v1.5 or ASN.1 ECDSA signatures) for the ZKI and the XML signature. The ZKI has to be deterministic,
+// so an ECDSA key can only sign it as an *ecdsa.PrivateKey. The CA certificates are optional.
+func WithSigner(signer crypto.Signer, cert *x509.Certificate, caCerts ...*x509.Certificate) Option {
+	return func(o *entityOptions) {
+		o.certSource = func() (CertProvider, error) {
+			return NewMemoryCertProvider(&Certificate{Signer: signer, Cert: cert, CACerts: caCerts})
+		}
+	}
+}
+
+// WithCertProvider takes the certificates from the provider, the current one signs the invoices and
+// the historical ones are used by GenerateZKIWithCertificate
+func WithCertProvider(provider CertProvider) Option {
+	return func(o *entityOptions) {
+		o.certSource = func() (CertProvider, error) {
+			if provider == nil {
+				return nil, errors.New("certificate provider is nil")
+			}
+			return provider, nil
+		}
+	}
+}
+
+// WithVAT sets whether the entity is in the VAT system, true by default
+func WithVAT(sustPDV bool) Option {
+	return func(o *entityOptions) {
+		o.sustPDV = sustPDV
+	}
+}
+
+// WithCentralizedInvoiceNumber sets whether the invoice numbers are centralized per location, true by default
+func WithCentralizedInvoiceNumber(centralized bool) Option {
+	return func(o *entityOptions) {
+		o.centralizedInvoiceNumber = centralized
+	}
+}
+
+// WithDemoMode uses the demo CIS certificate and endpoint, false by default
+func WithDemoMode(demo bool) Option {
+	return func(o *entityOptions) {
+		o.demoMode = demo
+	}
+}
+
+// WithExpiredCheck sets whether an expired certificate is rejected, true by default (recommended),
+// see NewFiskalEntity for when an expired certificate is needed
+func WithExpiredCheck(check bool) Option {
+	return func(o *entityOptions) {
+		o.checkExpired = check
+	}
+}
+
+// WithChainVerification sets whether the certificate must be issued by the FINA production or demo CA,
+// true by default. Disable it only for self-made test certificates, CIS rejects them anyway.
+func WithChainVerification(verify bool) Option {
+	return func(o *entityOptions) {
+		o.verifyChain = verify
+	}
+}
+
+// WithStrictResponseVerification sets whether a CIS response whose signature can't be positively verified is an error
+// (ErrResponseSignature), true by default. When disabled, such a response is logged and accepted, only use it as
+// a temporary workaround, e.g. until the rotated CIS certificate is supplied with SetCISCertificatePEM.
+func WithStrictResponseVerification(strict bool) Option {
+	return func(o *entityOptions) {
+		o.strictResponses = strict
+	}
+}
+
+// WithResponseVerifier delegates the verification of the CIS response signatures to the verifier,
+// e.g. xmlsec.Verifier running the xmlsec1 tool, instead of the built-in pure Go verification
+func WithResponseVerifier(verifier ResponseVerifier) Option {
+	return func(o *entityOptions) {
+		o.responseVerifier = verifier
+	}
+}
+
+// WithSchemaValidation sets whether the requests are validated against the CIS XML schema before sending
+// (see ValidateRequestXML), false by default. An invalid request is not sent and the error lists the invalid elements.
+func WithSchemaValidation(validate bool) Option {
+	return func(o *entityOptions) {
+		o.schemaValidation = validate
+	}
+}
+
+// WithFiscalizationVersion sets the newest fiscalization version whose messages the entity may send with
+// SendMessage, Fiscalization1 by default. Set Fiscalization2 to pilot the Fiskalizacija 2.0 messages
+// registered with RegisterMessageType.
+func WithFiscalizationVersion(version FiscalizationVersion) Option {
+	return func(o *entityOptions) {
+		o.version = version
+	}
+}
+
+// WithTimeout sets the timeout of the requests to CIS, 10 seconds by default
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *entityOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithHTTPClient sets the HTTP client used as a template for the communication with CIS, see SetHTTPClient
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *entityOptions) {
+		o.httpClient = client
+	}
+}
+
+// WithLogger sets the structured logger, see SetLogger
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *entityOptions) {
+		o.logger = logger
+	}
+}
+
+// WithRedaction sets the redaction of the personal data in the log records and the error messages, see SetRedaction
+func WithRedaction(redaction Redaction) Option {
+	return func(o *entityOptions) {
+		o.redaction = &redaction
+	}
+}
+
+// WithRevocationCheck checks that the certificate was not revoked, see SetRevocationCheck
+func WithRevocationCheck(cfg RevocationConfig) Option {
+	return func(o *entityOptions) {
+		o.revocation = &cfg
+	}
+}
+
+// WithCISCertificatePEM overrides the embedded CIS certificate with the PEM chain, see SetCISCertificatePEM
+func WithCISCertificatePEM(pemData []byte) Option {
+	return func(o *entityOptions) {
+		o.cisCertPEM, o.cisCertFile = pemData, ""
+	}
+}
+
+// WithCISCertificateFile overrides the embedded CIS certificate with the PEM chain from the file, see SetCISCertificatePEM
+func WithCISCertificateFile(path string) Option {
+	return func(o *entityOptions) {
+		o.cisCertPEM, o.cisCertFile = nil, path
+	}
+}
+
+// NewFiskalEntityWithOptions creates a new FiskalEntity for the OIB configured with the options.
+// The location (WithLocation) and the certificate (WithCertFile, WithCertP12, WithSigner or WithCertProvider) are required,
+// the other options have the defaults: in the VAT system, centralized invoice numbers, production
+// CIS, expired certificates, certificates not issued by FINA and responses without a valid CIS signature rejected.
+//
+//	entity, err := fiskalhrgo.NewFiskalEntityWithOptions("12345678901",
+//		fiskalhrgo.WithLocation("POS1"),
+//		fiskalhrgo.WithCertFile("fiskal.p12", password),
+//		fiskalhrgo.WithDemoMode(true),
+//		fiskalhrgo.WithTimeout(15*time.Second),
+//	)
+func NewFiskalEntityWithOptions(oib string, opts ...Option) (*FiskalEntity, error) {
+	o := &entityOptions{
+		sustPDV:                  true,
+		centralizedInvoiceNumber: true,
+		checkExpired:             true,
+		verifyChain:              true,
+		strictResponses:          true,
+		responseMaxSkew:          defaultResponseMaxSkew,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	// Check if OIB is valid
+	if !ValidateOIB(oib) {
+		return nil, errors.New("invalid OIB")
+	}
+
+	//check if locationID is valid
+	if !ValidateLocationID(o.locationID) {
+		return nil, errors.New("invalid locationID")
+	}
+
+	if o.timeout < 0 {
+		return nil, errors.New("timeout must not be negative")
+	}
+
+	if o.responseMaxSkew < 0 {
+		return nil, errors.New("response max skew must not be negative")
+	}
+
+	if o.certSource == nil {
+		return nil, errors.New("the certificate is not set")
+	}
+	provider, err := o.certSource()
+	if err != nil {
+		return nil, err
+	}
+	current, err := provider.GetCurrent()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the current certificate: %w", err)
+	}
+
+	cert := newCertManager()
+	if err := cert.setSigner(current.Signer, current.Cert, current.CACerts); err != nil {
+		return nil, fmt.Errorf("certificate setup fail: %v", err)
+	}
+	if o.verifyChain {
+		if err := verifyFinaChain(cert.publicCert, cert.caCerts); err != nil {
+			return nil, err
+		}
+	}
+
+	fe, err := newFiskalEntityWithCert(oib, o.sustPDV, o.locationID, o.centralizedInvoiceNumber, o.demoMode, o.checkExpired, cert, o.clock)
+	if err != nil {
+		return nil, err
+	}
+	fe.certProvider = provider
+	fe.verifyChain = o.verifyChain
+	fe.wipeKeys = o.wipeKeys
+	fe.unverifiedResponses = !o.strictResponses
+	fe.responseVerifier = o.responseVerifier
+	fe.schemaValidation = o.schemaValidation
+	fe.idempotency = o.idempotency
+	fe.responseGuard = newResponseGuard(o.responseMaxSkew)
+	if o.version != 0 {
+		if err := fe.SetFiscalizationVersion(o.version); err != nil {
+			return nil, err
+		}
+	}
+
+	if o.cisCertPEM != nil {
+		if err := fe.SetCISCertificatePEM(o.cisCertPEM); err != nil {
+			return nil, err
+		}
+	} else if o.cisCertFile != "" {
+		if err := fe.SetCISCertificateFile(o.cisCertFile); err != nil {
+			return nil, err
+		}
+	}
+	if o.archive != nil {
+		fe.archive = o.archive
+	}
+	fe.certRecheck = certRecheckTime(provider)
+
+	if o.httpClient != nil || o.timeout > 0 {
+		client := &http.Client{}
+		if o.httpClient != nil {
+			clone := *o.httpClient
+			client = &clone
+		}
+		if o.timeout > 0 {
+			client.Timeout = o.timeout
+		}
+		if err := fe.SetHTTPClient(client); err != nil {
+			return nil, err
+		}
+	}
+	if o.logger != nil {
+		fe.SetLogger(o.logger)
+	}
+	if o.redaction != nil {
+		fe.SetRedaction(*o.redaction)
+	}
+	if o.messageArchive != nil {
+		fe.SetMessageArchive(o.messageArchive)
+	}
+	if o.debugDumpDir != "" {
+		fe.SetDebugDump(o.debugDumpDir)
+	}
+	if o.journal != nil {
+		fe.SetJournal(o.journal)
+	}
+	if o.messageStore != nil {
+		fe.SetMessageStore(o.messageStore)
+	}
+	if o.idProvider != nil {
+		fe.SetIDProvider(o.idProvider)
+	}
+	if o.revocation != nil {
+		fe.SetRevocationCheck(o.revocation)
+		if err := fe.checkNotRevoked(cert); err != nil {
+			return nil, err
+		}
+	}
+
+	return fe, nil
+}
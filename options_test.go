@@ -0,0 +1,135 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestNewFiskalEntityWithOptions(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+
+	fe, err := NewFiskalEntityWithOptions(testOIB,
+		WithLocation("OPT1"),
+		WithCertFile(certPath, certPassword),
+		WithDemoMode(true),
+		WithVAT(false),
+		WithTimeout(3*time.Second),
+		WithHTTPClient(&http.Client{Timeout: time.Minute}),
+		WithLogger(logger),
+		WithStrictResponseVerification(false),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create entity: %v", err)
+	}
+
+	if fe.LocationID() != "OPT1" || fe.SustPDV() || !fe.CentralizedInvoiceNumber() || !fe.DemoMode() {
+		t.Errorf("Unexpected entity settings")
+	}
+	if fe.Endpoint() != demo_url {
+		t.Errorf("Expected demo endpoint, got %s", fe.Endpoint())
+	}
+	if fe.httpClient == nil || fe.httpClient.Timeout != 3*time.Second {
+		t.Errorf("Expected the timeout to override the HTTP client timeout")
+	}
+	if fe.logger != logger {
+		t.Errorf("Expected the logger to be set")
+	}
+	if !fe.unverifiedResponses {
+		t.Errorf("Expected the unverified responses to be accepted")
+	}
+}
+
+func TestNewFiskalEntityWithOptionsP12(t *testing.T) {
+	data, err := os.ReadFile(certPath)
+	if err != nil {
+		t.Fatalf("Failed to read certificate: %v", err)
+	}
+	fe, err := NewFiskalEntityWithOptions(testOIB, WithLocation("OPT2"), WithCertP12(data, certPassword))
+	if err != nil {
+		t.Fatalf("Failed to create entity: %v", err)
+	}
+	if !fe.SustPDV() || fe.DemoMode() || fe.Endpoint() != production_url || fe.unverifiedResponses {
+		t.Errorf("Unexpected default settings")
+	}
+}
+
+func TestNewFiskalEntityWithOptionsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		oib  string
+		opts []Option
+	}{
+		{"invalid OIB", "123", []Option{WithLocation("OPT1"), WithCertFile(certPath, certPassword)}},
+		{"missing location", testOIB, []Option{WithCertFile(certPath, certPassword)}},
+		{"missing certificate", testOIB, []Option{WithLocation("OPT1")}},
+		{"empty certificate data", testOIB, []Option{WithLocation("OPT1"), WithCertP12([]byte{}, certPassword)}},
+		{"wrong password", testOIB, []Option{WithLocation("OPT1"), WithCertFile(certPath, "wrong")}},
+		{"negative timeout", testOIB, []Option{WithLocation("OPT1"), WithCertFile(certPath, certPassword), WithTimeout(-time.Second)}},
+	}
+	for _, tt := range tests {
+		if _, err := NewFiskalEntityWithOptions(tt.oib, tt.opts...); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+}
+
+// opaqueSigner hides the private key like an HSM or KMS would
+type opaqueSigner struct {
+	signer crypto.Signer
+	calls  int
+}
+
+func (s *opaqueSigner) Public() crypto.PublicKey {
+	return s.signer.Public()
+}
+
+func (s *opaqueSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	s.calls++
+	return s.signer.Sign(rand, digest, opts)
+}
+
+func TestNewFiskalEntityWithSigner(t *testing.T) {
+	signer := &opaqueSigner{signer: testEntity.cert.signer}
+	fe, err := NewFiskalEntityWithOptions(testOIB, WithLocation(testEntity.LocationID()), WithSigner(signer, testEntity.cert.publicCert))
+	if err != nil {
+		t.Fatalf("Failed to create entity with signer: %v", err)
+	}
+
+	issued := time.Date(2024, 10, 1, 12, 0, 0, 0, time.Local)
+	zki, err := fe.GenerateZKI(issued, 1, 1, "10.00")
+	if err != nil {
+		t.Fatalf("Failed to generate ZKI: %v", err)
+	}
+	expected, _ := testEntity.GenerateZKI(issued, 1, 1, "10.00")
+	if zki != expected {
+		t.Errorf("Expected the same ZKI as with the P12 key, got %s and %s", zki, expected)
+	}
+
+	if _, err := fe.signXML([]byte(`<tns:EchoRequest xmlns:tns="http://www.apis-it.hr/fin/2012/types/f73" Id="x">test</tns:EchoRequest>`)); err != nil {
+		t.Fatalf("Failed to sign XML: %v", err)
+	}
+	if signer.calls != 2 {
+		t.Errorf("Expected the signer to be used twice, got %d", signer.calls)
+	}
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFiskalEntityWithOptions(testOIB, WithLocation("OPT1"), WithSigner(otherKey, testEntity.cert.publicCert)); err == nil {
+		t.Errorf("Expected error for a key not matching the certificate")
+	}
+}
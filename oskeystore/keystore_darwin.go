@@ -0,0 +1,136 @@
+//go:build darwin && cgo
+
+package oskeystore
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+/*
+#cgo LDFLAGS: -framework CoreFoundation -framework Security
+#include <CoreFoundation/CoreFoundation.h>
+#include <Security/Security.h>
+
+// copyIdentities returns all identities (certificates with a private key) of the Keychain search list
+static CFArrayRef copyIdentities(OSStatus *status) {
+	const void *keys[] = {kSecClass, kSecReturnRef, kSecMatchLimit};
+	const void *values[] = {kSecClassIdentity, kCFBooleanTrue, kSecMatchLimitAll};
+	CFDictionaryRef query = CFDictionaryCreate(NULL, keys, values, 3, &kCFTypeDictionaryKeyCallBacks, &kCFTypeDictionaryValueCallBacks);
+	CFTypeRef result = NULL;
+	*status = SecItemCopyMatching(query, &result);
+	CFRelease(query);
+	return (CFArrayRef)result;
+}
+*/
+import "C"
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha1"
+	"crypto/x509"
+	"fmt"
+	"unsafe"
+)
+
+// keychainKey is a Keychain private key
+type keychainKey struct {
+	ref   C.SecKeyRef
+	ecdsa bool
+}
+
+// keychainAlgorithms are the Keychain signature algorithms for a digest, RSA PKCS #1 v1.5 and ECDSA (ASN.1)
+var keychainAlgorithms = map[bool]map[crypto.Hash]C.SecKeyAlgorithm{
+	false: {
+		crypto.SHA1:   C.kSecKeyAlgorithmRSASignatureDigestPKCS1v15SHA1,
+		crypto.SHA256: C.kSecKeyAlgorithmRSASignatureDigestPKCS1v15SHA256,
+		crypto.SHA384: C.kSecKeyAlgorithmRSASignatureDigestPKCS1v15SHA384,
+		crypto.SHA512: C.kSecKeyAlgorithmRSASignatureDigestPKCS1v15SHA512,
+	},
+	true: {
+		crypto.SHA1:   C.kSecKeyAlgorithmECDSASignatureDigestX962SHA1,
+		crypto.SHA256: C.kSecKeyAlgorithmECDSASignatureDigestX962SHA256,
+		crypto.SHA384: C.kSecKeyAlgorithmECDSASignatureDigestX962SHA384,
+		crypto.SHA512: C.kSecKeyAlgorithmECDSASignatureDigestX962SHA512,
+	},
+}
+
+// openPlatform finds the identity with the certificate thumbprint in the Keychain
+func openPlatform(thumbprint []byte) (*x509.Certificate, platformKey, error) {
+	var status C.OSStatus
+	identities := C.copyIdentities(&status)
+	if status == C.errSecItemNotFound {
+		return nil, nil, ErrNotFound
+	}
+	if status != C.errSecSuccess {
+		return nil, nil, fmt.Errorf("failed to search the Keychain: OSStatus %d", int(status))
+	}
+	defer C.CFRelease(C.CFTypeRef(identities))
+
+	for i := C.CFIndex(0); i < C.CFArrayGetCount(identities); i++ {
+		identity := C.SecIdentityRef(uintptr(C.CFArrayGetValueAtIndex(identities, i)))
+		der, ok := identityCertificate(identity)
+		if !ok {
+			continue
+		}
+		sum := sha1.Sum(der)
+		if !bytes.Equal(sum[:], thumbprint) {
+			continue
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse the certificate: %w", err)
+		}
+		var key C.SecKeyRef
+		if status := C.SecIdentityCopyPrivateKey(identity, &key); status != C.errSecSuccess {
+			return nil, nil, fmt.Errorf("failed to open the private key: OSStatus %d", int(status))
+		}
+		return cert, &keychainKey{ref: key, ecdsa: cert.PublicKeyAlgorithm == x509.ECDSA}, nil
+	}
+	return nil, nil, ErrNotFound
+}
+
+// identityCertificate returns the DER encoded certificate of the identity
+func identityCertificate(identity C.SecIdentityRef) ([]byte, bool) {
+	var cert C.SecCertificateRef
+	if C.SecIdentityCopyCertificate(identity, &cert) != C.errSecSuccess {
+		return nil, false
+	}
+	defer C.CFRelease(C.CFTypeRef(cert))
+	data := C.SecCertificateCopyData(cert)
+	if data == 0 {
+		return nil, false
+	}
+	defer C.CFRelease(C.CFTypeRef(data))
+	return C.GoBytes(unsafe.Pointer(C.CFDataGetBytePtr(data)), C.int(C.CFDataGetLength(data))), true
+}
+
+func (k *keychainKey) sign(digest []byte, hash crypto.Hash) ([]byte, error) {
+	algorithm, ok := keychainAlgorithms[k.ecdsa][hash]
+	if !ok {
+		return nil, fmt.Errorf("unsupported hash function %v", hash)
+	}
+	data := C.CFDataCreate(0, (*C.UInt8)(unsafe.Pointer(&digest[0])), C.CFIndex(len(digest)))
+	defer C.CFRelease(C.CFTypeRef(data))
+
+	var cfErr C.CFErrorRef
+	signature := C.SecKeyCreateSignature(k.ref, algorithm, data, &cfErr)
+	if signature == 0 {
+		code := 0
+		if cfErr != 0 {
+			code = int(C.CFErrorGetCode(cfErr))
+			C.CFRelease(C.CFTypeRef(cfErr))
+		}
+		return nil, fmt.Errorf("SecKeyCreateSignature failed: error %d", code)
+	}
+	defer C.CFRelease(C.CFTypeRef(signature))
+	return C.GoBytes(unsafe.Pointer(C.CFDataGetBytePtr(signature)), C.int(C.CFDataGetLength(signature))), nil
+}
+
+func (k *keychainKey) close() error {
+	if k.ref != 0 {
+		C.CFRelease(C.CFTypeRef(k.ref))
+		k.ref = 0
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !windows && !(darwin && cgo)
+
+package oskeystore
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import "crypto/x509"
+
+func openPlatform(thumbprint []byte) (*x509.Certificate, platformKey, error) {
+	return nil, nil, ErrNotSupported
+}
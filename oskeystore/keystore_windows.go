@@ -0,0 +1,170 @@
+//go:build windows
+
+package oskeystore
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+	"unsafe"
+
+	"golang.org/x/crypto/cryptobyte"
+	"golang.org/x/crypto/cryptobyte/asn1"
+	"golang.org/x/sys/windows"
+)
+
+var (
+	ncrypt             = windows.NewLazySystemDLL("ncrypt.dll")
+	procNCryptSignHash = ncrypt.NewProc("NCryptSignHash")
+	procNCryptFree     = ncrypt.NewProc("NCryptFreeObject")
+)
+
+const bcryptPadPKCS1 = 0x00000002
+
+// bcryptPKCS1PaddingInfo is BCRYPT_PKCS1_PADDING_INFO
+type bcryptPKCS1PaddingInfo struct {
+	algID *uint16
+}
+
+// cngHashAlgorithms are the CNG names of the hash algorithms for the PKCS #1 padding
+var cngHashAlgorithms = map[crypto.Hash]string{
+	crypto.SHA1:   "SHA1",
+	crypto.SHA256: "SHA256",
+	crypto.SHA384: "SHA384",
+	crypto.SHA512: "SHA512",
+}
+
+// cngKey is a CNG (NCrypt) private key handle
+type cngKey struct {
+	handle   windows.Handle
+	mustFree bool
+	ecdsa    bool
+}
+
+// openPlatform finds the certificate in the personal store of the current user, then of the local machine
+func openPlatform(thumbprint []byte) (*x509.Certificate, platformKey, error) {
+	for _, location := range []uint32{windows.CERT_SYSTEM_STORE_CURRENT_USER, windows.CERT_SYSTEM_STORE_LOCAL_MACHINE} {
+		cert, key, err := openFromStore(location, thumbprint)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		return cert, key, err
+	}
+	return nil, nil, ErrNotFound
+}
+
+func openFromStore(location uint32, thumbprint []byte) (*x509.Certificate, platformKey, error) {
+	storeName, err := windows.UTF16PtrFromString("MY")
+	if err != nil {
+		return nil, nil, err
+	}
+	store, err := windows.CertOpenStore(windows.CERT_STORE_PROV_SYSTEM, 0, 0,
+		location|windows.CERT_STORE_READONLY_FLAG, uintptr(unsafe.Pointer(storeName)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open the certificate store: %w", err)
+	}
+	defer windows.CertCloseStore(store, 0)
+
+	blob := windows.CryptHashBlob{Size: uint32(len(thumbprint)), Data: &thumbprint[0]}
+	ctx, err := windows.CertFindCertificateInStore(store, windows.X509_ASN_ENCODING|windows.PKCS_7_ASN_ENCODING, 0,
+		windows.CERT_FIND_HASH, unsafe.Pointer(&blob), nil)
+	if err != nil {
+		return nil, nil, ErrNotFound
+	}
+	defer windows.CertFreeCertificateContext(ctx)
+
+	der := append([]byte(nil), unsafe.Slice(ctx.EncodedCert, ctx.Length)...)
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse the certificate: %w", err)
+	}
+
+	// Legacy CSP keys are opened through the CNG key storage providers as well
+	var handle windows.Handle
+	var keySpec uint32
+	var mustFree bool
+	if err := windows.CryptAcquireCertificatePrivateKey(ctx, windows.CRYPT_ACQUIRE_ONLY_NCRYPT_KEY_FLAG|windows.CRYPT_ACQUIRE_SILENT_FLAG,
+		nil, &handle, &keySpec, &mustFree); err != nil {
+		return nil, nil, fmt.Errorf("failed to open the private key: %w", err)
+	}
+
+	key := &cngKey{handle: handle, mustFree: mustFree}
+	if cert.PublicKeyAlgorithm == x509.ECDSA {
+		key.ecdsa = true
+	}
+	return cert, key, nil
+}
+
+func (k *cngKey) sign(digest []byte, hash crypto.Hash) ([]byte, error) {
+	var padding unsafe.Pointer
+	var flags uint32
+	if !k.ecdsa {
+		name, ok := cngHashAlgorithms[hash]
+		if !ok {
+			return nil, fmt.Errorf("unsupported hash function %v", hash)
+		}
+		algID, err := windows.UTF16PtrFromString(name)
+		if err != nil {
+			return nil, err
+		}
+		padding, flags = unsafe.Pointer(&bcryptPKCS1PaddingInfo{algID: algID}), bcryptPadPKCS1
+	}
+
+	// The first call returns the signature size
+	var size uint32
+	if err := ncryptSignHash(k.handle, padding, digest, nil, &size, flags); err != nil {
+		return nil, err
+	}
+	signature := make([]byte, size)
+	if err := ncryptSignHash(k.handle, padding, digest, signature, &size, flags); err != nil {
+		return nil, err
+	}
+	signature = signature[:size]
+	if k.ecdsa {
+		return ecdsaASN1(signature)
+	}
+	return signature, nil
+}
+
+func (k *cngKey) close() error {
+	if !k.mustFree {
+		return nil
+	}
+	if r, _, _ := procNCryptFree.Call(uintptr(k.handle)); r != 0 {
+		return fmt.Errorf("NCryptFreeObject failed: 0x%x", r)
+	}
+	return nil
+}
+
+func ncryptSignHash(handle windows.Handle, padding unsafe.Pointer, digest []byte, signature []byte, size *uint32, flags uint32) error {
+	var out *byte
+	if len(signature) > 0 {
+		out = &signature[0]
+	}
+	r, _, _ := procNCryptSignHash.Call(uintptr(handle), uintptr(padding), uintptr(unsafe.Pointer(&digest[0])), uintptr(len(digest)),
+		uintptr(unsafe.Pointer(out)), uintptr(len(signature)), uintptr(unsafe.Pointer(size)), uintptr(flags))
+	if r != 0 {
+		return fmt.Errorf("NCryptSignHash failed: 0x%x", r)
+	}
+	return nil
+}
+
+// ecdsaASN1 converts the CNG ECDSA signature (r and s concatenated) to ASN.1
+func ecdsaASN1(signature []byte) ([]byte, error) {
+	if len(signature) == 0 || len(signature)%2 != 0 {
+		return nil, errors.New("invalid ECDSA signature length")
+	}
+	half := len(signature) / 2
+	var b cryptobyte.Builder
+	b.AddASN1(asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1BigInt(new(big.Int).SetBytes(signature[:half]))
+		b.AddASN1BigInt(new(big.Int).SetBytes(signature[half:]))
+	})
+	return b.Bytes()
+}
@@ -0,0 +1,153 @@
+// Package oskeystore signs fiscalization messages with a certificate installed in the operating system
+// key store, so the fiscal certificate doesn't have to be exported to a P12 file. On Windows the certificate
+// is taken from the personal ("MY") certificate store of the current user or the local machine and signs through
+// CNG, on macOS it is taken from the Keychain (requires cgo). Other platforms return ErrNotSupported.
+//
+// The certificate is located by its SHA-1 thumbprint, as shown by the Windows certificate manager
+// or fiskalhrgo.GetCertFingerprintSHA1:
+//
+//	signer, err := oskeystore.Open("3f 2a 9c ...")
+//	defer signer.Close()
+//	entity, err := fiskalhrgo.NewFiskalEntityWithOptions(oib, fiskalhrgo.WithLocation("POS1"),
+//		fiskalhrgo.WithSigner(signer, signer.Certificate()))
+//
+// The ZKI must be signed deterministically, so only RSA keys can sign it through the key store.
+package oskeystore
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// ErrNotSupported is returned on platforms without a supported key store
+var ErrNotSupported = errors.New("OS key store not supported on this platform")
+
+// ErrNotFound is returned when no certificate with a private key matches the thumbprint
+var ErrNotFound = errors.New("certificate not found in the OS key store")
+
+// platformKey is the private key handle of the platform key store
+type platformKey interface {
+	// sign signs the digest, RSA with PKCS #1 v1.5 and ECDSA in the ASN.1 format of crypto.Signer
+	sign(digest []byte, hash crypto.Hash) ([]byte, error)
+	close() error
+}
+
+// Signer is a crypto.Signer using a private key of the OS key store
+type Signer struct {
+	mu     sync.Mutex
+	cert   *x509.Certificate
+	public crypto.PublicKey
+	key    platformKey
+}
+
+// Open finds the certificate with the SHA-1 thumbprint (hex, spaces, colons and the case are ignored)
+// and opens its private key. The signer must be closed to release the key handle.
+func Open(thumbprint string) (*Signer, error) {
+	hash, err := parseThumbprint(thumbprint)
+	if err != nil {
+		return nil, err
+	}
+	cert, key, err := openPlatform(hash)
+	if err != nil {
+		return nil, err
+	}
+	return newSigner(cert, key)
+}
+
+// newSigner checks the certificate key type and creates the signer
+func newSigner(cert *x509.Certificate, key platformKey) (*Signer, error) {
+	switch cert.PublicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		key.close()
+		return nil, errors.New("certificate public key is not of RSA or ECDSA type")
+	}
+	return &Signer{cert: cert, public: cert.PublicKey, key: key}, nil
+}
+
+// parseThumbprint decodes the SHA-1 thumbprint
+func parseThumbprint(thumbprint string) ([]byte, error) {
+	// The thumbprint copied from the Windows certificate dialog starts with an invisible left-to-right mark
+	cleaned := strings.Map(func(r rune) rune {
+		if r == ' ' || r == ':' || r == '\u200e' {
+			return -1
+		}
+		return r
+	}, thumbprint)
+	hash, err := hex.DecodeString(cleaned)
+	if err != nil || len(hash) != sha1.Size {
+		return nil, fmt.Errorf("invalid SHA-1 thumbprint: %q", thumbprint)
+	}
+	return hash, nil
+}
+
+// Certificate returns the certificate of the key
+func (s *Signer) Certificate() *x509.Certificate {
+	return s.cert
+}
+
+// Public implements crypto.Signer
+func (s *Signer) Public() crypto.PublicKey {
+	return s.public
+}
+
+// Sign implements crypto.Signer, RSA keys sign with PKCS #1 v1.5, PSS is not supported. The signature is
+// verified with the certificate, so a key store returning a wrong key is detected.
+func (s *Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if _, ok := opts.(*rsa.PSSOptions); ok {
+		return nil, errors.New("PSS signatures are not supported")
+	}
+	hash := opts.HashFunc()
+	if hash == 0 || len(digest) != hash.Size() {
+		return nil, errors.New("digest does not match the hash function")
+	}
+
+	s.mu.Lock()
+	if s.key == nil {
+		s.mu.Unlock()
+		return nil, errors.New("signer is closed")
+	}
+	signature, err := s.key.sign(digest, hash)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("OS key store signing failed: %w", err)
+	}
+
+	switch public := s.public.(type) {
+	case *rsa.PublicKey:
+		err = rsa.VerifyPKCS1v15(public, hash, digest, signature)
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(public, digest, signature) {
+			err = errors.New("ECDSA verification failed")
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("OS key store signature does not match the certificate: %w", err)
+	}
+	return signature, nil
+}
+
+// Close releases the private key handle, the signer can't be used afterwards
+func (s *Signer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.key == nil {
+		return nil
+	}
+	err := s.key.close()
+	s.key = nil
+	return err
+}
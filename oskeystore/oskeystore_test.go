@@ -0,0 +1,99 @@
+package oskeystore
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"testing"
+)
+
+// fakeKey signs like the platform key store, with another key when wrongKey is set
+type fakeKey struct {
+	key      *rsa.PrivateKey
+	wrongKey *rsa.PrivateKey
+	closed   bool
+}
+
+func (f *fakeKey) sign(digest []byte, hash crypto.Hash) ([]byte, error) {
+	if f.wrongKey != nil {
+		return rsa.SignPKCS1v15(nil, f.wrongKey, hash, digest)
+	}
+	return rsa.SignPKCS1v15(nil, f.key, hash, digest)
+}
+
+func (f *fakeKey) close() error {
+	f.closed = true
+	return nil
+}
+
+func TestParseThumbprint(t *testing.T) {
+	valid := []string{
+		"3f2a9c0d1e4b5a6978c8d9e0f1a2b3c4d5e6f708",
+		"3F 2A 9C 0D 1E 4B 5A 69 78 C8 D9 E0 F1 A2 B3 C4 D5 E6 F7 08",
+		"3f:2a:9c:0d:1e:4b:5a:69:78:c8:d9:e0:f1:a2:b3:c4:d5:e6:f7:08",
+		"\u200e3f2a9c0d1e4b5a6978c8d9e0f1a2b3c4d5e6f708",
+	}
+	for _, thumbprint := range valid {
+		if hash, err := parseThumbprint(thumbprint); err != nil || len(hash) != sha1.Size || hash[0] != 0x3f {
+			t.Errorf("Failed to parse %q: %v", thumbprint, err)
+		}
+	}
+	for _, thumbprint := range []string{"", "3f2a", "zz2a9c0d1e4b5a6978c8d9e0f1a2b3c4d5e6f708"} {
+		if _, err := parseThumbprint(thumbprint); err == nil {
+			t.Errorf("Expected an error for %q", thumbprint)
+		}
+	}
+	if _, err := Open("invalid"); err == nil {
+		t.Errorf("Expected an error for an invalid thumbprint")
+	}
+}
+
+func TestSigner(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	platform := &fakeKey{key: key}
+	signer, err := newSigner(&x509.Certificate{PublicKey: &key.PublicKey}, platform)
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+
+	digest := sha1.Sum([]byte("ZKI data"))
+	signature, err := signer.Sign(rand.Reader, digest[:], crypto.SHA1)
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA1, digest[:], signature); err != nil {
+		t.Errorf("Invalid signature: %v", err)
+	}
+
+	if _, err := signer.Sign(rand.Reader, digest[:], &rsa.PSSOptions{Hash: crypto.SHA1}); err == nil {
+		t.Errorf("Expected an error for PSS")
+	}
+	if _, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256); err == nil {
+		t.Errorf("Expected an error for a digest of the wrong size")
+	}
+
+	// A key not matching the certificate is detected
+	platform.wrongKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := signer.Sign(rand.Reader, digest[:], crypto.SHA1); err == nil {
+		t.Errorf("Expected an error for a signature not matching the certificate")
+	}
+
+	if err := signer.Close(); err != nil || !platform.closed {
+		t.Errorf("Expected the key to be closed, got %v", err)
+	}
+	if _, err := signer.Sign(rand.Reader, digest[:], crypto.SHA1); err == nil {
+		t.Errorf("Expected an error after Close")
+	}
+}
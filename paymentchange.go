@@ -0,0 +1,97 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// ErrPaymentMethodChange is returned for a payment method change that is not allowed, see ValidatePaymentMethodChange
+var ErrPaymentMethodChange = errors.New("payment method change not allowed")
+
+// paymentMethodChanges are the allowed changes of the payment method of a fiscalized invoice. The cheque (C)
+// is no longer a payment method, so nothing can change to it, only from it.
+var paymentMethodChanges = map[PaymentMethod][]PaymentMethod{
+	CISCash:         {CISCard, CISMixOther, CISBankTransfer},
+	CISCard:         {CISCash, CISMixOther, CISBankTransfer},
+	CISMixOther:     {CISCash, CISCard, CISBankTransfer},
+	CISBankTransfer: {CISCash, CISCard, CISMixOther},
+	CISCheck:        {CISCash, CISCard, CISMixOther, CISBankTransfer},
+}
+
+// ValidatePaymentMethodChange checks the change of the payment method of a fiscalized invoice before it is sent
+// to CIS: both methods must be valid and different, and the new one can't be the cheque (C), which is no longer
+// a payment method. The returned error wraps ErrPaymentMethodChange and describes the problem.
+func ValidatePaymentMethodChange(from, to PaymentMethod) error {
+	if err := from.IsValid(); err != nil {
+		return fmt.Errorf("%w: invalid original payment method %q: %w", ErrPaymentMethodChange, from, err)
+	}
+	if err := to.IsValid(); err != nil {
+		return fmt.Errorf("%w: invalid new payment method %q: %w", ErrPaymentMethodChange, to, err)
+	}
+	if from == to {
+		return fmt.Errorf("%w: the invoice is already paid with %s", ErrPaymentMethodChange, to)
+	}
+	for _, allowed := range paymentMethodChanges[from] {
+		if to == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: from %s to %s", ErrPaymentMethodChange, from, to)
+}
+
+// ChangePaymentMethodRequest reports the change of the payment method of an already fiscalized invoice to CIS
+// (PromijeniNacPlac), e.g. an invoice issued as paid by card and paid in cash. The request carries the original
+// invoice data unchanged, with the ZKI validated like in InvoiceRequest, and the new payment method. The change
+// is checked with ValidatePaymentMethodChange first, a change that is not allowed is refused without contacting CIS.
+// The invoice itself is not changed, the new payment method is kept in PromijenjeniNacinPlac only in the request.
+//
+// It returns the CIS response with the confirmation in PorukaOdgovora. All errors are *FiskalError, the errors
+// returned by CIS are CISErrors (usually of the p series, see ErrCISLaterChange).
+func (invoice *RacunType) ChangePaymentMethodRequest(method PaymentMethod) (*PromijeniNacPlacOdgovor, error) {
+	if err := invoice.checkLaterChange(); err != nil {
+		return nil, err
+	}
+	if invoice.PromijenjeniNacinPlac != "" {
+		return nil, newFiskalError(CategoryInput, fmt.Errorf("%w: the invoice already has a changed payment method", ErrPaymentMethodChange))
+	}
+	if err := ValidatePaymentMethodChange(PaymentMethod(invoice.NacinPlac), method); err != nil {
+		return nil, newFiskalError(CategoryInput, err)
+	}
+
+	racun := *invoice
+	racun.PromijenjeniNacinPlac = string(method)
+
+	// The IDProvider derives the ids from the invoice, they would be the ones of the invoice request
+	zahtjev := PromijeniNacPlacZahtjev{
+		Zaglavlje: newFiskalHeader(GenerateID()),
+		Racun:     &racun,
+		Xmlns:     DefaultNamespace,
+		IdAttr:    GenerateID(),
+	}
+	xmlData, err := xml.MarshalIndent(zahtjev, "", " ")
+	if err != nil {
+		return nil, newFiskalError(CategoryInput, fmt.Errorf("error marshalling PromijeniNacPlacZahtjev: %w", err))
+	}
+
+	fe := invoice.pointerToEntity
+	attrs := []slog.Attr{slog.String("invoice", invoiceNumber(invoice)), slog.String("zki", invoice.ZastKod),
+		slog.String("from", invoice.NacinPlac), slog.String("to", string(method))}
+	var odgovor PromijeniNacPlacOdgovor
+	parsed, err := fe.laterChangeRequest(zahtjev.Zaglavlje, xmlData, invoice.requestHeaders, &odgovor)
+	if err != nil {
+		fe.log(failureLevel, "payment method change failed", append(attrs, errorAttrs(err)...)...)
+		err = fe.redactError(err)
+		if !parsed {
+			return nil, err
+		}
+		return &odgovor, err
+	}
+	fe.log(successLevel, "payment method changed", attrs...)
+	return &odgovor, nil
+}
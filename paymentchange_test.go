@@ -0,0 +1,93 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+const testPromijeniNacPlacOdgovor = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><tns:PromijeniNacPlacOdgovor xmlns:tns="http://www.apis-it.hr/fin/2012/types/f73" Id="G0x3">
+	<tns:Zaglavlje><tns:IdPoruke>%s</tns:IdPoruke><tns:DatumVrijeme>%s</tns:DatumVrijeme></tns:Zaglavlje>
+	<tns:PorukaOdgovora><tns:SifraPoruke>p001</tns:SifraPoruke><tns:Poruka>Promjena zaprimljena</tns:Poruka></tns:PorukaOdgovora>
+</tns:PromijeniNacPlacOdgovor></soap:Body></soap:Envelope>`
+
+func TestValidatePaymentMethodChange(t *testing.T) {
+	for _, change := range []struct {
+		from, to PaymentMethod
+		allowed  bool
+	}{
+		{CISCard, CISCash, true},
+		{CISCash, CISCard, true},
+		{CISMixOther, CISBankTransfer, true},
+		{CISCheck, CISCard, true},
+		{CISCash, CISCash, false},
+		{CISCard, CISCheck, false},
+		{CISCash, "X", false},
+		{"", CISCash, false},
+	} {
+		err := ValidatePaymentMethodChange(change.from, change.to)
+		if change.allowed && err != nil {
+			t.Errorf("Expected %s -> %s to be allowed, got %v", change.from, change.to, err)
+		}
+		if !change.allowed && !errors.Is(err, ErrPaymentMethodChange) {
+			t.Errorf("Expected %s -> %s to be refused, got %v", change.from, change.to, err)
+		}
+	}
+}
+
+func TestChangePaymentMethodRequest(t *testing.T) {
+	key, cert := newTestCISSigningCert(t)
+	var requests int
+	var request *etree.Document
+	fe := newTestServerEntity(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		request = etree.NewDocument()
+		if _, err := request.ReadFrom(r.Body); err != nil {
+			t.Error(err)
+			return
+		}
+		response := fmt.Sprintf(testPromijeniNacPlacOdgovor, request.FindElement("//IdPoruke").Text(), request.FindElement("//DatumVrijeme").Text())
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprint(w, signTestCISResponse(t, key, response, MakeC14N10RecCanonicalizer()))
+	})
+	fe.ciscert = newSignatureCheckCIScert(cert, fe.ciscert.SSLverifyPoll)
+
+	invoice, zki, err := fe.NewCISInvoice(time.Now(), 6, 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "20.00", CISCard, "12345678901")
+	if err != nil {
+		t.Fatalf("Failed to create invoice: %v", err)
+	}
+
+	odgovor, err := invoice.ChangePaymentMethodRequest(CISCash)
+	if err != nil {
+		t.Fatalf("Failed to change the payment method: %v", err)
+	}
+	if odgovor.PorukaOdgovora == nil || odgovor.PorukaOdgovora.Poruka != "Promjena zaprimljena" {
+		t.Errorf("Unexpected response %+v", odgovor)
+	}
+	if request.FindElement("//Body/PromijeniNacPlacZahtjev") == nil || request.FindElement("//Racun/ZastKod").Text() != zki ||
+		request.FindElement("//Racun/NacinPlac").Text() != "K" || request.FindElement("//Racun/PromijenjeniNacinPlac").Text() != "G" {
+		t.Error("Expected the original invoice data with the new payment method in the request")
+	}
+	if invoice.NacinPlac != "K" || invoice.PromijenjeniNacinPlac != "" {
+		t.Error("Expected the invoice not to be changed")
+	}
+
+	// Changes that are not allowed are refused before contacting CIS
+	for _, method := range []PaymentMethod{CISCard, CISCheck, "X"} {
+		var fErr *FiskalError
+		if _, err := invoice.ChangePaymentMethodRequest(method); !errors.Is(err, ErrPaymentMethodChange) || !errors.As(err, &fErr) || fErr.Category != CategoryInput {
+			t.Errorf("Expected the change to %q to be refused, got %v", method, err)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("Expected only the allowed change to be sent, got %d requests", requests)
+	}
+}
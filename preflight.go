@@ -0,0 +1,221 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// expireSoonDays is the number of days before the certificate expiry when it's considered expiring soon
+const expireSoonDays = 30
+
+// PreflightStatus is the result of a single pre-flight check
+type PreflightStatus string
+
+const (
+	PreflightOK      PreflightStatus = "ok"
+	PreflightWarning PreflightStatus = "warning"
+	PreflightFailed  PreflightStatus = "failed"
+)
+
+// Names of the pre-flight checks
+const (
+	CheckCertificate    = "certificate"
+	CheckOIB            = "oib"
+	CheckCISCertificate = "cis-certificate"
+	CheckClock          = "clock"
+	CheckCISPing        = "cis-ping"
+	CheckCertRevocation = "revocation"
+)
+
+// PreflightCheck is the result of a single pre-flight check
+type PreflightCheck struct {
+	Name    string
+	Status  PreflightStatus
+	Message string
+
+	// Err is the error of a failed check, if any
+	Err error
+}
+
+// PreflightReport is the readiness report returned by Preflight
+type PreflightReport struct {
+	Checks   []PreflightCheck
+	Started  time.Time
+	Duration time.Duration
+}
+
+// Ready returns true if no check failed, warnings don't prevent fiscalization
+func (r *PreflightReport) Ready() bool {
+	return len(r.Failed()) == 0
+}
+
+// Failed returns the failed checks
+func (r *PreflightReport) Failed() []PreflightCheck {
+	return r.withStatus(PreflightFailed)
+}
+
+// Warnings returns the checks with a warning
+func (r *PreflightReport) Warnings() []PreflightCheck {
+	return r.withStatus(PreflightWarning)
+}
+
+// Check returns the result of the named check, nil if it wasn't performed
+func (r *PreflightReport) Check(name string) *PreflightCheck {
+	for i := range r.Checks {
+		if r.Checks[i].Name == name {
+			return &r.Checks[i]
+		}
+	}
+	return nil
+}
+
+func (r *PreflightReport) withStatus(status PreflightStatus) []PreflightCheck {
+	var checks []PreflightCheck
+	for _, check := range r.Checks {
+		if check.Status == status {
+			checks = append(checks, check)
+		}
+	}
+	return checks
+}
+
+// String returns the report as text, one check per line
+func (r *PreflightReport) String() string {
+	var sb strings.Builder
+	for _, check := range r.Checks {
+		fmt.Fprintf(&sb, "[%s] %s: %s\n", check.Status, check.Name, check.Message)
+	}
+	if r.Ready() {
+		sb.WriteString("READY\n")
+	} else {
+		sb.WriteString("NOT READY\n")
+	}
+	return sb.String()
+}
+
+// Preflight checks whether the entity is ready for fiscalization: the certificate validity and expiry,
+// the OIB match, the CIS certificate and CA pool, the sanity of the local clock, the certificate revocation
+// if enabled (SetRevocationCheck), and finally it pings CIS.
+// Run it at POS startup and show the report to the operator, the report is returned even if checks fail.
+func (fe *FiskalEntity) Preflight() *PreflightReport {
+	report := &PreflightReport{Started: time.Now()}
+	now := report.Started
+
+	report.Checks = append(report.Checks,
+		fe.preflightCertificate(now),
+		fe.preflightOIB(),
+		fe.preflightCISCertificate(now),
+		fe.preflightClock(now),
+	)
+	if fe.revocationChecker() != nil {
+		report.Checks = append(report.Checks, fe.preflightRevocation())
+	}
+	report.Checks = append(report.Checks, fe.preflightPing())
+
+	report.Duration = time.Since(report.Started)
+	return report
+}
+
+func (fe *FiskalEntity) preflightCertificate(now time.Time) PreflightCheck {
+	check := PreflightCheck{Name: CheckCertificate}
+	cm := fe.certificate()
+	if cm == nil || !cm.init_ok || cm.publicCert == nil || cm.signer == nil {
+		check.Status, check.Message = PreflightFailed, "the certificate is not loaded"
+		return check
+	}
+
+	cert := cm.publicCert
+	days := int(cert.NotAfter.Sub(now).Hours() / 24)
+	switch {
+	case now.Before(cert.NotBefore):
+		check.Status, check.Message = PreflightFailed, fmt.Sprintf("the certificate is not valid before %s", cert.NotBefore.Format(time.RFC3339))
+	case now.After(cert.NotAfter):
+		check.Status, check.Message = PreflightFailed, fmt.Sprintf("the certificate expired on %s", cert.NotAfter.Format(time.RFC3339))
+	case days <= expireSoonDays:
+		check.Status, check.Message = PreflightWarning, fmt.Sprintf("the certificate expires in %d days, on %s", days, cert.NotAfter.Format(time.RFC3339))
+	default:
+		check.Status, check.Message = PreflightOK, fmt.Sprintf("valid until %s (%d days), serial %s", cert.NotAfter.Format(time.RFC3339), days, cert.SerialNumber)
+	}
+	return check
+}
+
+func (fe *FiskalEntity) preflightOIB() PreflightCheck {
+	check := PreflightCheck{Name: CheckOIB}
+	cm := fe.certificate()
+	switch {
+	case cm == nil || cm.certOIB == "":
+		check.Status, check.Message = PreflightFailed, "the certificate OIB is unknown"
+	case !ValidateOIB(fe.oib):
+		check.Status, check.Message = PreflightFailed, "the entity OIB is invalid"
+	case cm.certOIB != fe.oib:
+		check.Status, check.Message = PreflightFailed, "the entity OIB does not match the certificate"
+	default:
+		check.Status, check.Message = PreflightOK, "the entity OIB matches the certificate"
+	}
+	return check
+}
+
+func (fe *FiskalEntity) preflightCISCertificate(now time.Time) PreflightCheck {
+	check := PreflightCheck{Name: CheckCISCertificate}
+	ciscert := fe.cisCertificate()
+	switch {
+	case ciscert == nil || ciscert.PublicCert == nil:
+		check.Status, check.Message = PreflightFailed, "the CIS certificate is not loaded"
+	case ciscert.SSLverifyPoll == nil:
+		check.Status, check.Message = PreflightFailed, "the CIS CA pool is not loaded"
+	case now.After(ciscert.ValidUntil) && ciscert.Runtime:
+		check.Status, check.Message = PreflightWarning, fmt.Sprintf("the supplied CIS certificate expired on %s, supply the new one", ciscert.ValidUntil.Format(time.RFC3339))
+	case now.After(ciscert.ValidUntil):
+		check.Status, check.Message = PreflightWarning, fmt.Sprintf("the embedded CIS certificate expired on %s, update the library or supply the new one with SetCISCertificatePEM", ciscert.ValidUntil.Format(time.RFC3339))
+	default:
+		check.Status, check.Message = PreflightOK, fmt.Sprintf("%s valid until %s", ciscert.Subject, ciscert.ValidUntil.Format(time.RFC3339))
+	}
+	return check
+}
+
+// preflightClock checks that the local clock is not obviously wrong, the invoice time is part of the ZKI
+// and CIS rejects messages from the future, so a POS with a reset clock must not fiscalize.
+func (fe *FiskalEntity) preflightClock(now time.Time) PreflightCheck {
+	check := PreflightCheck{Name: CheckClock, Status: PreflightOK, Message: "local time " + now.Format(time.RFC3339)}
+	if ciscert := fe.cisCertificate(); ciscert != nil && now.Before(ciscert.ValidFrom) {
+		check.Status = PreflightFailed
+		check.Message = fmt.Sprintf("local time %s is before the CIS certificate was issued, the clock is wrong", now.Format(time.RFC3339))
+	} else if cm := fe.certificate(); cm != nil && cm.publicCert != nil && now.Before(cm.publicCert.NotBefore) {
+		check.Status = PreflightFailed
+		check.Message = fmt.Sprintf("local time %s is before the certificate was issued, the clock is wrong", now.Format(time.RFC3339))
+	}
+	return check
+}
+
+// preflightRevocation fails for a revoked certificate, an unknown status is only a warning
+func (fe *FiskalEntity) preflightRevocation() PreflightCheck {
+	check := PreflightCheck{Name: CheckCertRevocation}
+	result, err := fe.CheckRevocation(context.Background())
+	switch {
+	case err != nil:
+		check.Status, check.Message, check.Err = PreflightWarning, "the revocation status is unknown: "+err.Error(), err
+	case result.Status == RevocationRevoked:
+		check.Status, check.Message = PreflightFailed, fmt.Sprintf("the certificate was revoked on %s", result.RevokedAt.Format(time.RFC3339))
+		check.Err = ErrCertificateRevoked
+	default:
+		check.Status, check.Message = PreflightOK, fmt.Sprintf("the certificate is not revoked (%s)", result.Source)
+	}
+	return check
+}
+
+func (fe *FiskalEntity) preflightPing() PreflightCheck {
+	check := PreflightCheck{Name: CheckCISPing}
+	started := time.Now()
+	if err := fe.PingCIS(); err != nil {
+		check.Status, check.Message, check.Err = PreflightFailed, err.Error(), err
+		return check
+	}
+	check.Status, check.Message = PreflightOK, fmt.Sprintf("CIS %s responded in %s", fe.Endpoint(), time.Since(started).Round(time.Millisecond))
+	return check
+}
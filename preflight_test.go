@@ -0,0 +1,58 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPreflight(t *testing.T) {
+	fe := newTestServerEntity(t, echoHandler)
+
+	report := fe.Preflight()
+	t.Log("\n" + report.String())
+
+	for _, name := range []string{CheckCertificate, CheckOIB, CheckCISCertificate, CheckClock, CheckCISPing} {
+		if report.Check(name) == nil {
+			t.Errorf("Missing check %s", name)
+		}
+	}
+	for _, name := range []string{CheckOIB, CheckClock, CheckCISPing} {
+		if check := report.Check(name); check.Status != PreflightOK {
+			t.Errorf("Expected %s to be ok, got %s: %s", name, check.Status, check.Message)
+		}
+	}
+	if report.Check(CheckCertificate).Status != PreflightFailed && !report.Ready() {
+		t.Errorf("Expected the report to be ready, failed: %v", report.Failed())
+	}
+}
+
+func TestPreflightPingFailure(t *testing.T) {
+	fe := newTestServerEntity(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+
+	report := fe.Preflight()
+	if report.Ready() {
+		t.Fatalf("Expected the report not to be ready")
+	}
+	ping := report.Check(CheckCISPing)
+	if ping.Status != PreflightFailed || ping.Err == nil || !IsRetriable(ping.Err) {
+		t.Errorf("Expected a retriable ping failure, got %+v", ping)
+	}
+	if !strings.Contains(report.String(), "NOT READY") {
+		t.Errorf("Expected NOT READY in the report")
+	}
+}
+
+func TestPreflightOIBMismatch(t *testing.T) {
+	fe := newTestEntity(t)
+	fe.oib = "12345678903"
+	if check := fe.preflightOIB(); check.Status != PreflightFailed {
+		t.Errorf("Expected OIB mismatch to fail, got %+v", check)
+	}
+}
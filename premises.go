@@ -0,0 +1,118 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+
+	"github.com/beevik/etree"
+)
+
+// The business premises registration (PoslovniProstorZahtjev) was a CIS message of the fiscalization until the
+// premises registration moved to ePorezna. CIS doesn't accept it anymore, the types are kept so the archived
+// fiscalization traffic can still be parsed and reproduced. The elements have no prefix, like the responses,
+// so they are parsed with any namespace prefix, XML adds the tns prefix when serializing.
+
+// PoslovniProstorZahtjev is the legacy business premises registration request
+type PoslovniProstorZahtjev struct {
+	XMLName         xml.Name              `xml:"PoslovniProstorZahtjev"`
+	IdAttr          string                `xml:"Id,attr,omitempty"`
+	Zaglavlje       *ZaglavljeOdgovorType `xml:"Zaglavlje"`
+	PoslovniProstor *PoslovniProstorType  `xml:"PoslovniProstor"`
+}
+
+// PoslovniProstorOdgovor is the CIS response to the legacy business premises registration
+type PoslovniProstorOdgovor struct {
+	XMLName   xml.Name              `xml:"PoslovniProstorOdgovor"`
+	IdAttr    string                `xml:"Id,attr,omitempty"`
+	Zaglavlje *ZaglavljeOdgovorType `xml:"Zaglavlje"`
+	Greske    *GreskeType           `xml:"Greske"`
+}
+
+// PoslovniProstorType is the registered business premises
+type PoslovniProstorType struct {
+	Oib                  string              `xml:"Oib"`
+	OznPoslProstora      string              `xml:"OznPoslProstora"`
+	AdresniPodatak       *AdresniPodatakType `xml:"AdresniPodatak"`
+	RadnoVrijeme         string              `xml:"RadnoVrijeme"`
+	DatumPocetkaPrimjene string              `xml:"DatumPocetkaPrimjene"`
+	OznakaZatvaranja     string              `xml:"OznakaZatvaranja,omitempty"`
+	SpecNamj             string              `xml:"SpecNamj,omitempty"`
+}
+
+// AdresniPodatakType is the address of the premises, or the other premises type (OstaliTipoviPP) for the premises
+// without an address, e.g. a mobile shop
+type AdresniPodatakType struct {
+	Adresa         *AdresaType `xml:"Adresa,omitempty"`
+	OstaliTipoviPP string      `xml:"OstaliTipoviPP,omitempty"`
+}
+
+// AdresaType ...
+type AdresaType struct {
+	Ulica            string `xml:"Ulica,omitempty"`
+	KucniBroj        string `xml:"KucniBroj,omitempty"`
+	KucniBrojDodatak string `xml:"KucniBrojDodatak,omitempty"`
+	BrojPoste        string `xml:"BrojPoste,omitempty"`
+	Naselje          string `xml:"Naselje,omitempty"`
+	Opcina           string `xml:"Opcina,omitempty"`
+}
+
+// ParsePoslovniProstorZahtjev parses an archived legacy business premises registration request, either the SOAP
+// envelope or just the PoslovniProstorZahtjev element. The signature is not verified.
+func ParsePoslovniProstorZahtjev(data []byte) (*PoslovniProstorZahtjev, error) {
+	content, err := responseContent(data)
+	if err != nil {
+		return nil, err
+	}
+	var zahtjev PoslovniProstorZahtjev
+	if err := xml.Unmarshal(content, &zahtjev); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal PoslovniProstorZahtjev: %w", err)
+	}
+	return &zahtjev, nil
+}
+
+// ParsePoslovniProstorOdgovor parses an archived CIS response to the legacy business premises registration,
+// either the SOAP envelope or just the PoslovniProstorOdgovor element. A SOAP Fault is returned as *SOAPFaultError.
+// The signature is not verified.
+func ParsePoslovniProstorOdgovor(data []byte) (*PoslovniProstorOdgovor, error) {
+	content, err := responseContent(data)
+	if err != nil {
+		return nil, err
+	}
+	var odgovor PoslovniProstorOdgovor
+	if err := xml.Unmarshal(content, &odgovor); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal PoslovniProstorOdgovor: %w", err)
+	}
+	return &odgovor, nil
+}
+
+// XML serializes the request like the other CIS requests, with the elements in the CIS namespace (tns)
+func (zahtjev *PoslovniProstorZahtjev) XML() ([]byte, error) {
+	if zahtjev == nil {
+		return nil, errors.New("request is nil")
+	}
+	data, err := xml.Marshal(zahtjev)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling PoslovniProstorZahtjev: %w", err)
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return nil, err
+	}
+	root := doc.Root()
+	var prefix func(el *etree.Element)
+	prefix = func(el *etree.Element) {
+		el.Space = "tns"
+		for _, child := range el.ChildElements() {
+			prefix(child)
+		}
+	}
+	prefix(root)
+	root.CreateAttr("xmlns:tns", DefaultNamespace)
+	doc.Indent(1)
+	return doc.WriteToBytes()
+}
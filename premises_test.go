@@ -0,0 +1,61 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testPoslovniProstorZahtjev = `<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/"><soapenv:Body>
+<tns:PoslovniProstorZahtjev xmlns:tns="http://www.apis-it.hr/fin/2012/types/f73" Id="ppz">
+ <tns:Zaglavlje><tns:IdPoruke>f81d4fae-7dec-11d0-a765-00a0c91e6bf6</tns:IdPoruke><tns:DatumVrijeme>01.07.2013T08:00:00</tns:DatumVrijeme></tns:Zaglavlje>
+ <tns:PoslovniProstor>
+  <tns:Oib>65049901548</tns:Oib>
+  <tns:OznPoslProstora>POS1</tns:OznPoslProstora>
+  <tns:AdresniPodatak><tns:Adresa><tns:Ulica>Ilica</tns:Ulica><tns:KucniBroj>1</tns:KucniBroj><tns:BrojPoste>10000</tns:BrojPoste><tns:Naselje>Zagreb</tns:Naselje><tns:Opcina>Zagreb</tns:Opcina></tns:Adresa></tns:AdresniPodatak>
+  <tns:RadnoVrijeme>Pon-Pet 08-16</tns:RadnoVrijeme>
+  <tns:DatumPocetkaPrimjene>01.07.2013</tns:DatumPocetkaPrimjene>
+  <tns:SpecNamj>12345678901</tns:SpecNamj>
+ </tns:PoslovniProstor>
+</tns:PoslovniProstorZahtjev></soapenv:Body></soapenv:Envelope>`
+
+func TestPoslovniProstor(t *testing.T) {
+	zahtjev, err := ParsePoslovniProstorZahtjev([]byte(testPoslovniProstorZahtjev))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	pp := zahtjev.PoslovniProstor
+	if zahtjev.IdAttr != "ppz" || zahtjev.Zaglavlje.DatumVrijeme != "01.07.2013T08:00:00" || pp.OznPoslProstora != "POS1" ||
+		pp.AdresniPodatak.Adresa.Naselje != "Zagreb" || pp.DatumPocetkaPrimjene != "01.07.2013" {
+		t.Errorf("Unexpected request %+v", pp)
+	}
+
+	// The serialized request is parsed back unchanged
+	data, err := zahtjev.XML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `<tns:PoslovniProstorZahtjev Id="ppz" xmlns:tns="`+DefaultNamespace+`">`) ||
+		!strings.Contains(string(data), "<tns:Ulica>Ilica</tns:Ulica>") || strings.Contains(string(data), "OstaliTipoviPP") {
+		t.Errorf("Unexpected XML %s", data)
+	}
+	parsed, err := ParsePoslovniProstorZahtjev(data)
+	if err != nil || !reflect.DeepEqual(parsed.PoslovniProstor, zahtjev.PoslovniProstor) {
+		t.Errorf("Expected the same request, got %+v, %v", parsed, err)
+	}
+
+	odgovor, err := ParsePoslovniProstorOdgovor([]byte(`<tns:PoslovniProstorOdgovor xmlns:tns="http://www.apis-it.hr/fin/2012/types/f73" Id="G1">
+<tns:Zaglavlje><tns:IdPoruke>f81d4fae-7dec-11d0-a765-00a0c91e6bf6</tns:IdPoruke><tns:DatumVrijeme>01.07.2013T08:00:01</tns:DatumVrijeme></tns:Zaglavlje>
+<tns:Greske><tns:Greska><tns:SifraGreske>v100</tns:SifraGreske><tns:PorukaGreske>Neispravan podatak</tns:PorukaGreske></tns:Greska></tns:Greske>
+</tns:PoslovniProstorOdgovor>`))
+	if err != nil || odgovor.Zaglavlje.IdPoruke != zahtjev.Zaglavlje.IdPoruke || odgovor.Greske.FirstErrorCode() != "v100" {
+		t.Errorf("Unexpected response %+v, %v", odgovor, err)
+	}
+	if _, err := ParsePoslovniProstorZahtjev([]byte("<RacunZahtjev/>")); err == nil {
+		t.Error("Expected an error for another message")
+	}
+}
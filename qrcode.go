@@ -0,0 +1,136 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/l-d-t/fiskalhrgo/validate"
+	"rsc.io/qr"
+)
+
+// receiptQRBaseURL is the receipt verification service of the Tax Administration encoded in the QR code
+const receiptQRBaseURL = "https://porezna.gov.hr/rn"
+
+// qrQuietZone is the number of white modules around the QR code required by the standard
+const qrQuietZone = 4
+
+// ReceiptQRURL returns the content of the verification QR code printed on the receipt: the address of the receipt
+// check of the Tax Administration with the JIR, or with the ZKI if the invoice is not fiscalized yet (jir is empty),
+// the issue date and time (to the minute) and the total amount without the decimal point (10.55 is 1055).
+func ReceiptQRURL(jir string, zki string, issueDateTime time.Time, totalAmount string) (string, error) {
+	return receiptURL(receiptQRBaseURL, jir, zki, issueDateTime, totalAmount)
+}
+
+// receiptURL returns the address of the receipt check at the base address
+func receiptURL(base string, jir string, zki string, issueDateTime time.Time, totalAmount string) (string, error) {
+	var key, value string
+	switch {
+	case jir != "":
+		if !ValidateJIR(jir) {
+			return "", errors.New("invalid JIR")
+		}
+		key, value = "jir", jir
+	case zki != "":
+		if !ValidateZKI(zki) {
+			return "", errors.New("invalid ZKI")
+		}
+		key, value = "zki", zki
+	default:
+		return "", errors.New("JIR or ZKI is required")
+	}
+	if issueDateTime.IsZero() {
+		return "", errors.New("issue date and time is required")
+	}
+	if !validate.SignedAmount(totalAmount) {
+		return "", fmt.Errorf("invalid total amount %q", totalAmount)
+	}
+	amount, err := strconv.ParseInt(strings.Replace(totalAmount, ".", "", 1), 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid total amount %q: %w", totalAmount, err)
+	}
+	return fmt.Sprintf("%s?%s=%s&datv=%s&izn=%d", base, key, value, issueDateTime.Format("20060102_1504"), amount), nil
+}
+
+// QRCodeURL returns the content of the verification QR code of the invoice (see ReceiptQRURL), with the JIR
+// or with the ZKI of the invoice if the JIR is empty (the invoice is not fiscalized yet)
+func (invoice *RacunType) QRCodeURL(jir string) (string, error) {
+	if invoice == nil {
+		return "", errors.New("invoice is nil")
+	}
+	issued, err := time.ParseInLocation("02.01.2006T15:04:05", invoice.DatVrijeme, time.Local)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse date: %w", err)
+	}
+	return ReceiptQRURL(jir, invoice.ZastKod, issued, invoice.IznosUkupno)
+}
+
+// QRCodePNG renders the QR code with the content (e.g. from QRCodeURL) as a PNG image with scale pixels per module.
+// The code uses the low error correction level and has the quiet zone around it. It must be printed at least
+// 2 x 2 cm in size, choose the scale for the printer resolution.
+func QRCodePNG(content string, scale int) ([]byte, error) {
+	if scale < 1 {
+		return nil, errors.New("scale must be at least 1")
+	}
+	code, err := qr.Encode(content, qr.L)
+	if err != nil {
+		return nil, err
+	}
+
+	size := (code.Size + 2*qrQuietZone) * scale
+	img := image.NewGray(image.Rect(0, 0, size, size))
+	for i := range img.Pix {
+		img.Pix[i] = 0xFF
+	}
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if !code.Black(x, y) {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetGray((x+qrQuietZone)*scale+dx, (y+qrQuietZone)*scale+dy, color.Gray{})
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// QRCodeSVG renders the QR code with the content (e.g. from QRCodeURL) as an SVG image, one unit per module
+// with the quiet zone around it. Set the width and height when embedding it, at least 2 x 2 cm on the receipt.
+func QRCodeSVG(content string) ([]byte, error) {
+	code, err := qr.Encode(content, qr.L)
+	if err != nil {
+		return nil, err
+	}
+
+	size := code.Size + 2*qrQuietZone
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, size, size)
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if code.Black(x, y) {
+				fmt.Fprintf(&buf, "M%d %dh1v1h-1z", x+qrQuietZone, y+qrQuietZone)
+			}
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,98 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReceiptQRURL(t *testing.T) {
+	issued := time.Date(2024, 3, 12, 15, 12, 45, 0, time.Local)
+	const jir = "9d6f5bb6-da48-4fcd-a803-4586a025e0e4"
+	const zki = "3b8e6f5a2c1d4e7f9a0b1c2d3e4f5a6b"
+
+	tests := []struct {
+		jir, zki, amount string
+		expected         string
+	}{
+		{jir, zki, "10.55", "https://porezna.gov.hr/rn?jir=" + jir + "&datv=20240312_1512&izn=1055"},
+		{"", zki, "1250.00", "https://porezna.gov.hr/rn?zki=" + zki + "&datv=20240312_1512&izn=125000"},
+		{jir, "", "0.50", "https://porezna.gov.hr/rn?jir=" + jir + "&datv=20240312_1512&izn=50"},
+		{jir, "", "-10.00", "https://porezna.gov.hr/rn?jir=" + jir + "&datv=20240312_1512&izn=-1000"},
+	}
+	for _, tt := range tests {
+		got, err := ReceiptQRURL(tt.jir, tt.zki, issued, tt.amount)
+		if err != nil || got != tt.expected {
+			t.Errorf("Expected %s, got %s, %v", tt.expected, got, err)
+		}
+	}
+
+	for name, call := range map[string]func() (string, error){
+		"no JIR or ZKI":  func() (string, error) { return ReceiptQRURL("", "", issued, "10.00") },
+		"invalid JIR":    func() (string, error) { return ReceiptQRURL("123", zki, issued, "10.00") },
+		"invalid ZKI":    func() (string, error) { return ReceiptQRURL("", "xyz", issued, "10.00") },
+		"invalid amount": func() (string, error) { return ReceiptQRURL(jir, "", issued, "10,00") },
+		"no time":        func() (string, error) { return ReceiptQRURL(jir, "", time.Time{}, "10.00") },
+	} {
+		if _, err := call(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestInvoiceQRCodeURL(t *testing.T) {
+	issued := time.Date(2024, 3, 12, 15, 12, 45, 0, time.Local)
+	invoice, zki, err := testEntity.NewCISInvoice(issued, 1, 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "10.00", CISCash, "12345678901")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Offline with the ZKI, with the JIR once fiscalized
+	if url, err := invoice.QRCodeURL(""); err != nil || url != "https://porezna.gov.hr/rn?zki="+zki+"&datv=20240312_1512&izn=1000" {
+		t.Errorf("Unexpected QR code URL %s, %v", url, err)
+	}
+	if url, err := invoice.QRCodeURL("9d6f5bb6-da48-4fcd-a803-4586a025e0e4"); err != nil || !strings.Contains(url, "?jir=9d6f5bb6-da48-4fcd-a803-4586a025e0e4&") {
+		t.Errorf("Unexpected QR code URL %s, %v", url, err)
+	}
+}
+
+func TestQRCodeImages(t *testing.T) {
+	content := "https://porezna.gov.hr/rn?jir=9d6f5bb6-da48-4fcd-a803-4586a025e0e4&datv=20240312_1512&izn=1055"
+
+	data, err := QRCodePNG(content, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Version 5 (37 modules) with the quiet zone of 4 modules, the finder pattern starts after the quiet zone
+	if size := img.Bounds().Dx(); size != (37+2*qrQuietZone)*4 {
+		t.Errorf("Unexpected image size %d", size)
+	}
+	if gray := color.GrayModel.Convert(img.At(0, 0)).(color.Gray); gray.Y != 0xFF {
+		t.Error("Expected a white quiet zone")
+	}
+	if gray := color.GrayModel.Convert(img.At(qrQuietZone*4, qrQuietZone*4)).(color.Gray); gray.Y != 0 {
+		t.Error("Expected the black finder pattern")
+	}
+	if _, err := QRCodePNG(content, 0); err == nil {
+		t.Error("Expected an error for a zero scale")
+	}
+
+	svg, err := QRCodeSVG(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(svg, []byte(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 45 45"`)) || !bytes.Contains(svg, []byte("M4 4h1v1h-1z")) {
+		t.Errorf("Unexpected SVG %s", svg)
+	}
+}
@@ -0,0 +1,441 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// QueuedInvoice is a single invoice waiting in the offline queue to be (re)sent to CIS.
+//
+// The invoice is keyed by its ZKI. The ZKI was already printed on the receipt given to the customer,
+// so it must never change while the invoice waits in the queue.
+type QueuedInvoice struct {
+	// ZKI of the invoice, used as the unique key in the store
+	ZKI string
+
+	// Invoice is the invoice data exactly as it was created when issued to the customer
+	Invoice *RacunType
+
+	// SelfServiceDevice is the self-service device of the invoice (see SetSelfServiceDevice), it is not part
+	// of the invoice data, so it is kept here for the persistent stores
+	SelfServiceDevice string `json:",omitempty"`
+
+	// QueuedAt is the time the invoice was added to the queue
+	QueuedAt time.Time
+
+	// Attempts is the number of delivery attempts made from the queue
+	Attempts int
+
+	// LastAttempt is the time of the last delivery attempt (zero if never attempted)
+	LastAttempt time.Time
+
+	// LastError is the error message of the last failed attempt (or the original failure)
+	LastError string
+
+	// Failed is set when the last attempt failed permanently (invalid data, certificate...), sending the invoice
+	// again would fail the same way, or with an unknown outcome (CategoryOutcomeUnknown), CIS may have fiscalized
+	// the invoice already. Failed invoices are not sent by Dispatch, see OfflineQueue.Failed.
+	Failed bool `json:",omitempty"`
+}
+
+// QueueStore is the storage backend of the offline queue.
+//
+// Implementations must be safe for concurrent use and should persist data durably,
+// so invoices queued before a crash or power loss are still there after a restart.
+// A reference implementation using bbolt is available in the boltstore subpackage.
+// NewMemoryQueueStore provides a non persistent implementation for tests.
+type QueueStore interface {
+	// Put inserts or replaces the queued invoice with the same ZKI
+	Put(item *QueuedInvoice) error
+
+	// Get returns the queued invoice for the ZKI, or nil if it is not in the store
+	Get(zki string) (*QueuedInvoice, error)
+
+	// Delete removes the queued invoice with the ZKI, deleting a missing one is not an error
+	Delete(zki string) error
+
+	// List returns all queued invoices ordered by QueuedAt (oldest first)
+	List() ([]*QueuedInvoice, error)
+
+	// Close releases the resources held by the store
+	Close() error
+}
+
+// clone returns a deep copy of the queued invoice, so the copy doesn't share the invoice data
+func (item *QueuedInvoice) clone() *QueuedInvoice {
+	cpy := *item
+	if item.Invoice != nil {
+		cpy.Invoice = item.Invoice.clone()
+	}
+	return &cpy
+}
+
+// memoryQueueStore is a simple in-memory QueueStore, it keeps its own copies of the queued invoices
+type memoryQueueStore struct {
+	mu    sync.Mutex
+	items map[string]*QueuedInvoice
+}
+
+// NewMemoryQueueStore returns a QueueStore that keeps everything in memory.
+// Queued invoices are lost when the process exits, so use it only for tests or as a fallback.
+func NewMemoryQueueStore() QueueStore {
+	return &memoryQueueStore{items: make(map[string]*QueuedInvoice)}
+}
+
+func (s *memoryQueueStore) Put(item *QueuedInvoice) error {
+	if item == nil || item.ZKI == "" {
+		return errors.New("queued invoice must have a ZKI")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[item.ZKI] = item.clone()
+	return nil
+}
+
+func (s *memoryQueueStore) Get(zki string) (*QueuedInvoice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, ok := s.items[zki]
+	if !ok {
+		return nil, nil
+	}
+	return item.clone(), nil
+}
+
+func (s *memoryQueueStore) Delete(zki string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.items, zki)
+	return nil
+}
+
+func (s *memoryQueueStore) List() ([]*QueuedInvoice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]*QueuedInvoice, 0, len(s.items))
+	for _, item := range s.items {
+		list = append(list, item.clone())
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].QueuedAt.Before(list[j].QueuedAt)
+	})
+	return list, nil
+}
+
+func (s *memoryQueueStore) Close() error {
+	return nil
+}
+
+// OfflineQueue holds invoices that could not be fiscalized at the time of issue
+// (no internet, CIS not available...) and sends them later.
+//
+// By law the invoice must be issued to the customer even if CIS is not reachable, with the ZKI only,
+// and delivered to CIS later (within 2 working days). The queue stores such invoices
+// in a QueueStore so they survive restarts and crashes.
+type OfflineQueue struct {
+	entity *FiskalEntity
+	store  QueueStore
+	mu     sync.Mutex // serializes Dispatch runs
+
+	// closing stops a running Dispatch after the current invoice, set by Shutdown
+	closing atomic.Bool
+
+	// closed is set when the store is closed by Shutdown, closeMu guards it
+	closed  bool
+	closeMu sync.RWMutex
+
+	// pending are the ZKIs of the pending invoices, read from the store on the first use and then kept up to date
+	// by the queue, so Len doesn't list the store. nil until read, pendingMu guards it.
+	pending   map[string]struct{}
+	pendingMu sync.Mutex
+}
+
+// ErrQueueClosed is returned by the queue after Shutdown
+var ErrQueueClosed = errors.New("offline queue is closed")
+
+// ErrPermanentFailure is returned by Enqueue for an invoice failed with an error that is not retriable
+// (see IsRetriable), e.g. a CIS data validation error. Sending it again unchanged would fail the same way.
+var ErrPermanentFailure = errors.New("invoice failed permanently, it can't be queued")
+
+// ErrOutcomeUnknown is returned by Enqueue for an invoice failed with an unknown outcome (CategoryOutcomeUnknown),
+// CIS may have fiscalized it already and sending it again could fiscalize it twice.
+var ErrOutcomeUnknown = errors.New("invoice outcome is unknown, check its status before queueing it")
+
+// DispatchResult is the outcome of sending a single queued invoice
+type DispatchResult struct {
+	ZKI string
+	JIR string
+	Err error
+
+	// Permanent is set if Err is not retriable, the invoice stays in the queue marked as Failed
+	Permanent bool
+}
+
+// NewOfflineQueue creates an offline queue for the entity backed by the provided store.
+func (fe *FiskalEntity) NewOfflineQueue(store QueueStore) (*OfflineQueue, error) {
+	if store == nil {
+		return nil, errors.New("queue store is nil")
+	}
+	return &OfflineQueue{entity: fe, store: store}, nil
+}
+
+// Enqueue stores the invoice in the queue to be sent later, replacing the queued invoice with the same ZKI
+// (e.g. a Failed one corrected by the caller). The cause is the error from the failed attempt (can be nil)
+// and is kept for diagnostics. A cause that is a FiskalError and not retriable is refused with
+// ErrPermanentFailure, the invoice has to be corrected first instead of being retried until the deadline.
+// A cause with an unknown outcome (CategoryOutcomeUnknown) is refused with ErrOutcomeUnknown, CIS may have
+// fiscalized the invoice already, so check its status first and queue it only if it was not.
+func (q *OfflineQueue) Enqueue(invoice *RacunType, cause error) error {
+	if invoice == nil {
+		return errors.New("invoice is nil")
+	}
+	if invoice.ZastKod == "" {
+		return errors.New("invoice ZKI (Zastitni Kod Izdavatelja) must be set")
+	}
+	var fErr *FiskalError
+	if errors.As(cause, &fErr) && fErr.Category == CategoryOutcomeUnknown {
+		return fmt.Errorf("%w: %w", ErrOutcomeUnknown, cause)
+	}
+	if isPermanent(cause) {
+		return fmt.Errorf("%w: %w", ErrPermanentFailure, cause)
+	}
+	q.closeMu.RLock()
+	defer q.closeMu.RUnlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	item := &QueuedInvoice{
+		ZKI:               invoice.ZastKod,
+		Invoice:           invoice.clone(),
+		SelfServiceDevice: invoice.selfService,
+		QueuedAt:          time.Now(),
+	}
+	if cause != nil {
+		item.LastError = cause.Error()
+	}
+
+	if err := q.store.Put(item); err != nil {
+		return fmt.Errorf("failed to store queued invoice: %w", err)
+	}
+	q.track(item.ZKI, true)
+	q.entity.emitRetryScheduled(item)
+	return nil
+}
+
+// Pending returns all invoices currently waiting in the queue to be sent, oldest first.
+// The Failed invoices are not included.
+func (q *OfflineQueue) Pending() ([]*QueuedInvoice, error) {
+	return q.list(false)
+}
+
+// Failed returns the invoices that failed permanently when sent from the queue, oldest first. They stay in the
+// queue until they are corrected and queued again with Enqueue, or removed with Remove.
+func (q *OfflineQueue) Failed() ([]*QueuedInvoice, error) {
+	return q.list(true)
+}
+
+// Remove removes the invoice with the ZKI from the queue, e.g. a Failed invoice handled by the caller
+func (q *OfflineQueue) Remove(zki string) error {
+	q.closeMu.RLock()
+	defer q.closeMu.RUnlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	if err := q.store.Delete(zki); err != nil {
+		return fmt.Errorf("failed to remove queued invoice: %w", err)
+	}
+	q.track(zki, false)
+	return nil
+}
+
+// list returns the failed or the pending invoices
+func (q *OfflineQueue) list(failed bool) ([]*QueuedInvoice, error) {
+	items, err := q.store.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list queued invoices: %w", err)
+	}
+	selected := items[:0]
+	for _, item := range items {
+		if item.Failed == failed {
+			selected = append(selected, item)
+		}
+	}
+	return selected, nil
+}
+
+// Len returns the number of invoices waiting in the queue. The store is listed only on the first call, afterwards
+// the number is kept by the queue, so it is cheap enough for frequent polling (e.g. a metrics scrape). Changes of
+// the store made by others than the queue are not seen.
+func (q *OfflineQueue) Len() (int, error) {
+	q.pendingMu.Lock()
+	defer q.pendingMu.Unlock()
+	if q.pending == nil {
+		items, err := q.Pending()
+		if err != nil {
+			return 0, err
+		}
+		q.pending = make(map[string]struct{}, len(items))
+		for _, item := range items {
+			q.pending[item.ZKI] = struct{}{}
+		}
+	}
+	return len(q.pending), nil
+}
+
+// track records the change of the invoice with the ZKI in the store, pending if it is stored as pending
+func (q *OfflineQueue) track(zki string, pending bool) {
+	q.pendingMu.Lock()
+	defer q.pendingMu.Unlock()
+	if q.pending == nil {
+		return
+	}
+	if pending {
+		q.pending[zki] = struct{}{}
+	} else {
+		delete(q.pending, zki)
+	}
+}
+
+// Dispatch tries to send all pending invoices to CIS, oldest first.
+// Every invoice is sent with SetLateDelivery and its original ZKI (NakDost set to true, the ZKI checked with the
+// certificate that produced it), so the caller doesn't have to take care of that. An invoice whose ZKI doesn't
+// match with any known certificate (see FindZKICertificate) fails permanently.
+// Successfully fiscalized invoices are removed from the queue, failed ones stay
+// with the attempt counter and error updated. An invoice failed with an error that is not retriable
+// (e.g. a CIS data validation error) is marked as Failed and is not sent again, see Failed.
+//
+// Returns the result for every attempted invoice, or an error if the store could not be read.
+func (q *OfflineQueue) Dispatch() ([]DispatchResult, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closeMu.RLock()
+	defer q.closeMu.RUnlock()
+	if q.closed {
+		return nil, ErrQueueClosed
+	}
+
+	items, err := q.Pending()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]DispatchResult, 0, len(items))
+	for _, item := range items {
+		// The remaining invoices stay in the queue for the next run
+		if q.closing.Load() || q.entity.isShuttingDown() {
+			break
+		}
+		results = append(results, q.dispatchOne(item))
+	}
+	return results, nil
+}
+
+// Shutdown stops the queue gracefully: a running Dispatch stops after the invoice being sent, and then the store
+// is closed. The invoices not sent stay in the store for the next start. Enqueue still works until the store is
+// closed, afterwards Enqueue and Dispatch return ErrQueueClosed. If the context is done first, the context error
+// is returned and the store is not closed.
+func (q *OfflineQueue) Shutdown(ctx context.Context) error {
+	q.closing.Store(true)
+	idle := make(chan struct{})
+	go func() {
+		q.mu.Lock()
+		close(idle)
+	}()
+	select {
+	case <-idle:
+	case <-ctx.Done():
+		// Release the lock once the running Dispatch finishes
+		go func() {
+			<-idle
+			q.mu.Unlock()
+		}()
+		return ctx.Err()
+	}
+	defer q.mu.Unlock()
+
+	q.closeMu.Lock()
+	defer q.closeMu.Unlock()
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+	return q.store.Close()
+}
+
+// dispatchOne sends a single queued invoice and updates the store
+func (q *OfflineQueue) dispatchOne(item *QueuedInvoice) DispatchResult {
+	res := DispatchResult{ZKI: item.ZKI}
+
+	if item.Invoice == nil {
+		res.Err = errors.New("queued invoice has no invoice data")
+		return res
+	}
+
+	// The invoice is changed for the delivery, work on a copy so the invoice of the caller or the store isn't changed
+	item = item.clone()
+
+	// Invoices loaded from a persistent store lost the pointer to the entity and the device
+	item.Invoice.pointerToEntity = q.entity
+	item.Invoice.selfService = item.SelfServiceDevice
+
+	item.Attempts++
+	item.LastAttempt = time.Now()
+
+	jir, err := sendLate(item.Invoice, item.ZKI)
+	if err != nil {
+		res.Err = err
+		res.Permanent = isPermanent(err)
+		item.LastError = err.Error()
+		item.Failed = res.Permanent
+		if perr := q.store.Put(item); perr != nil {
+			res.Err = errors.Join(err, fmt.Errorf("failed to update queued invoice: %w", perr))
+			return res
+		}
+		q.track(item.ZKI, !item.Failed)
+		if !res.Permanent {
+			q.entity.emitRetryScheduled(item)
+		}
+		return res
+	}
+
+	res.JIR = jir
+	if err := q.store.Delete(item.ZKI); err != nil {
+		res.Err = fmt.Errorf("invoice fiscalized (JIR %s) but failed to remove it from the queue: %w", jir, err)
+		return res
+	}
+	q.track(item.ZKI, false)
+	return res
+}
+
+// sendLate sends the queued invoice. Everything sent from the queue is by definition delivered late: the invoice
+// was already issued to the customer with this ZKI, so the original ZKI is kept and late delivery (NakDost) is set
+// with SetLateDelivery, which finds the certificate that produced the ZKI, also after the certificate was replaced.
+func sendLate(invoice *RacunType, zki string) (string, error) {
+	if err := invoice.SetLateDelivery(zki); err != nil {
+		// No known certificate produces the ZKI for the invoice data, sending it again can't help
+		var parseErr *time.ParseError
+		if errors.Is(err, ErrZKIMismatch) || errors.As(err, &parseErr) {
+			return "", newFiskalError(CategoryInput, fmt.Errorf("failed to set the late delivery: %w", err))
+		}
+		return "", fmt.Errorf("failed to set the late delivery: %w", err)
+	}
+	jir, _, err := invoice.InvoiceRequest()
+	return jir, err
+}
+
+// isPermanent reports whether the error is a FiskalError that is not retriable. Other errors (e.g. from the
+// caller's own code) are not classified, they are retried.
+func isPermanent(err error) bool {
+	var fErr *FiskalError
+	return errors.As(err, &fErr) && !fErr.Retriable()
+}
@@ -0,0 +1,320 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOfflineQueueEnqueue(t *testing.T) {
+	queue, err := testEntity.NewOfflineQueue(NewMemoryQueueStore())
+	if err != nil {
+		t.Fatalf("Failed to create queue: %v", err)
+	}
+
+	invoice, zki, err := testEntity.NewCISInvoice(time.Now(), 42, 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "10.00", CISCash, "12345678901")
+	if err != nil {
+		t.Fatalf("Failed to create invoice: %v", err)
+	}
+
+	if err := queue.Enqueue(invoice, errors.New("no route to host")); err != nil {
+		t.Fatalf("Failed to enqueue invoice: %v", err)
+	}
+
+	pending, err := queue.Pending()
+	if err != nil {
+		t.Fatalf("Failed to list pending invoices: %v", err)
+	}
+	if len(pending) != 1 {
+		t.Fatalf("Expected 1 pending invoice, got %d", len(pending))
+	}
+	if pending[0].ZKI != zki {
+		t.Errorf("Expected ZKI %s, got %s", zki, pending[0].ZKI)
+	}
+	if pending[0].LastError != "no route to host" {
+		t.Errorf("Expected the original failure to be kept, got %q", pending[0].LastError)
+	}
+
+	if err := queue.Enqueue(nil, nil); err == nil {
+		t.Errorf("Expected error when enqueueing nil invoice")
+	}
+}
+
+func TestOfflineQueueDispatchSetsLateDelivery(t *testing.T) {
+	// CIS is not available, the invoice stays in the queue
+	fe := newTestServerEntity(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	store := NewMemoryQueueStore()
+	queue, err := fe.NewOfflineQueue(store)
+	if err != nil {
+		t.Fatalf("Failed to create queue: %v", err)
+	}
+
+	invoice, zki, err := fe.NewCISInvoice(time.Now(), 43, 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "10.00", CISCash, "12345678901")
+	if err != nil {
+		t.Fatalf("Failed to create invoice: %v", err)
+	}
+	if err := queue.Enqueue(invoice, nil); err != nil {
+		t.Fatalf("Failed to enqueue invoice: %v", err)
+	}
+
+	// Simulate the application touching the invoice after it was queued
+	invoice.ZastKod = "00000000000000000000000000000000"
+
+	item, err := store.Get(zki)
+	if err != nil || item == nil {
+		t.Fatalf("Expected queued invoice, got %v, %v", item, err)
+	}
+
+	if res := queue.dispatchOne(item); res.Err == nil || res.Permanent {
+		t.Fatalf("Expected a retriable failure, got %+v", res)
+	}
+
+	if item.Invoice.NakDost || item.Attempts != 0 {
+		t.Errorf("Expected the dispatch not to change the item passed in")
+	}
+	if invoice.NakDost {
+		t.Errorf("Expected the dispatch not to change the invoice of the caller")
+	}
+	item, err = store.Get(zki)
+	if err != nil || item == nil {
+		t.Fatalf("Expected queued invoice after the dispatch, got %v, %v", item, err)
+	}
+	if !item.Invoice.NakDost {
+		t.Errorf("Expected NakDost to be set on dispatch from the queue")
+	}
+	if item.Invoice.ZastKod != zki {
+		t.Errorf("Expected original ZKI %s to be kept, got %s", zki, item.Invoice.ZastKod)
+	}
+	if item.Attempts != 1 {
+		t.Errorf("Expected 1 attempt, got %d", item.Attempts)
+	}
+}
+
+func TestOfflineQueueDispatchAfterCertificateRotation(t *testing.T) {
+	fe := newTestServerEntity(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	fe.verifyChain = false // the renewed certificate is synthetic
+	queue, err := fe.NewOfflineQueue(NewMemoryQueueStore())
+	if err != nil {
+		t.Fatalf("Failed to create queue: %v", err)
+	}
+	invoice, _, err := fe.NewCISInvoice(time.Now(), 46, 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "10.00", CISCash, "12345678901")
+	if err != nil {
+		t.Fatalf("Failed to create invoice: %v", err)
+	}
+	if err := queue.Enqueue(invoice, nil); err != nil {
+		t.Fatalf("Failed to enqueue invoice: %v", err)
+	}
+
+	// The ZKI was produced by the replaced certificate, it is found in the archive
+	path, _ := writeTestP12(t, testOIB)
+	if err := fe.ReloadCertificate(path, "renewed"); err != nil {
+		t.Fatalf("Failed to reload the certificate: %v", err)
+	}
+	results, err := queue.Dispatch()
+	if err != nil || len(results) != 1 {
+		t.Fatalf("Expected 1 result, got %+v %v", results, err)
+	}
+	if res := results[0]; res.Permanent || !IsRetriable(res.Err) {
+		t.Errorf("Expected CIS to be unavailable, not the ZKI to be refused, got %+v", res)
+	}
+	if failed, _ := queue.Failed(); len(failed) != 0 {
+		t.Errorf("Expected the invoice to stay pending, got %d failed", len(failed))
+	}
+
+	// Without the certificate that produced it the ZKI can't be delivered, retrying doesn't help
+	if err := queue.Enqueue(&RacunType{ZastKod: strings.Repeat("0", 32), DatVrijeme: invoice.DatVrijeme, BrRac: invoice.BrRac, IznosUkupno: invoice.IznosUkupno}, nil); err != nil {
+		t.Fatalf("Failed to enqueue invoice: %v", err)
+	}
+	results, _ = queue.Dispatch()
+	permanent := 0
+	for _, res := range results {
+		if res.Permanent {
+			permanent++
+			if !errors.Is(res.Err, ErrZKIMismatch) {
+				t.Errorf("Expected ErrZKIMismatch, got %v", res.Err)
+			}
+		}
+	}
+	if permanent != 1 {
+		t.Errorf("Expected the unknown ZKI to fail permanently, got %+v", results)
+	}
+}
+
+func TestOfflineQueuePermanentFailure(t *testing.T) {
+	faultCode := "soap:Client"
+	fe := newTestServerEntity(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault><faultcode>%s</faultcode><faultstring>rejected</faultstring></soap:Fault></soap:Body></soap:Envelope>`, faultCode)
+	})
+	var retries int
+	fe.OnRetryScheduled(func(item *QueuedInvoice) { retries++ })
+	queue, err := fe.NewOfflineQueue(NewMemoryQueueStore())
+	if err != nil {
+		t.Fatalf("Failed to create queue: %v", err)
+	}
+	invoice, zki, err := fe.NewCISInvoice(time.Now(), 44, 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "10.00", CISCash, "12345678901")
+	if err != nil {
+		t.Fatalf("Failed to create invoice: %v", err)
+	}
+
+	// A permanent failure is refused right away
+	validation := newCISFiskalError(newCISErrors(&GreskeType{Greska: []*GreskaType{{SifraGreske: "v152"}}}, LangHR), 200)
+	if err := queue.Enqueue(invoice, validation); !errors.Is(err, ErrPermanentFailure) || !errors.Is(err, ErrCISValidation) {
+		t.Errorf("Expected ErrPermanentFailure, got %v", err)
+	}
+	// So is a failure with an unknown outcome, CIS may have fiscalized the invoice
+	mismatch := &FiskalError{Category: CategoryOutcomeUnknown, Message: "IdPoruke mismatch", StatusCode: 200}
+	if err := queue.Enqueue(invoice, mismatch); !errors.Is(err, ErrOutcomeUnknown) || errors.Is(err, ErrPermanentFailure) {
+		t.Errorf("Expected ErrOutcomeUnknown, got %v", err)
+	}
+	if n, _ := queue.Len(); n != 0 {
+		t.Fatalf("Expected the invoice not to be queued, got %d", n)
+	}
+
+	// An invoice rejected when sent from the queue is marked as failed and not retried
+	if err := queue.Enqueue(invoice, nil); err != nil {
+		t.Fatalf("Failed to enqueue invoice: %v", err)
+	}
+	results, err := queue.Dispatch()
+	if err != nil || len(results) != 1 || !results[0].Permanent || results[0].Err == nil {
+		t.Fatalf("Expected a permanent failure, got %+v %v", results, err)
+	}
+	if results, _ := queue.Dispatch(); len(results) != 0 {
+		t.Errorf("Expected the failed invoice not to be sent again, got %+v", results)
+	}
+	failed, err := queue.Failed()
+	if err != nil || len(failed) != 1 || failed[0].ZKI != zki || !failed[0].Failed || failed[0].Attempts != 1 {
+		t.Fatalf("Expected the failed invoice, got %+v %v", failed, err)
+	}
+	if n, _ := queue.Len(); n != 0 {
+		t.Errorf("Expected the failed invoice not to be counted as waiting, got %d", n)
+	}
+	if retries != 1 {
+		t.Errorf("Expected only the enqueue to schedule a retry, got %d", retries)
+	}
+
+	// Queued again after the correction, a transient failure keeps it pending
+	faultCode = "soap:Server"
+	if err := queue.Enqueue(invoice, nil); err != nil {
+		t.Fatalf("Failed to enqueue invoice: %v", err)
+	}
+	if failed, _ := queue.Failed(); len(failed) != 0 {
+		t.Errorf("Expected no failed invoices after the correction, got %d", len(failed))
+	}
+	if results, _ := queue.Dispatch(); len(results) != 1 || results[0].Permanent {
+		t.Errorf("Expected a transient failure, got %+v", results)
+	}
+	if n, _ := queue.Len(); n != 1 {
+		t.Errorf("Expected the invoice to stay pending, got %d", n)
+	}
+
+	if err := queue.Remove(zki); err != nil {
+		t.Fatalf("Failed to remove invoice: %v", err)
+	}
+	if n, _ := queue.Len(); n != 0 {
+		t.Errorf("Expected an empty queue, got %d", n)
+	}
+}
+
+func TestMemoryQueueStoreCopies(t *testing.T) {
+	store := NewMemoryQueueStore()
+	invoice, zki, err := testEntity.NewCISInvoice(time.Now(), 44, 1, [][]interface{}{{"25.00", "8.00", "2.00"}}, nil, nil, "0.00", "0.00", "0.00", nil, "10.00", CISCash, "12345678901")
+	if err != nil {
+		t.Fatalf("Failed to create invoice: %v", err)
+	}
+	if err := store.Put(&QueuedInvoice{ZKI: zki, Invoice: invoice}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Changing the invoice of the caller or a returned copy must not change the stored invoice
+	invoice.BrRac.BrOznRac = 99
+	invoice.Pdv.Porez[0].Iznos = "99.00"
+	item, err := store.Get(zki)
+	if err != nil || item == nil {
+		t.Fatalf("Expected queued invoice, got %v, %v", item, err)
+	}
+	item.Invoice.NakDost = true
+	item.Invoice.Pdv.Porez[0].Osnovica = "99.00"
+
+	for _, check := range []func() (*QueuedInvoice, error){
+		func() (*QueuedInvoice, error) { return store.Get(zki) },
+		func() (*QueuedInvoice, error) {
+			list, err := store.List()
+			if err != nil || len(list) != 1 {
+				return nil, fmt.Errorf("expected 1 queued invoice, got %d: %v", len(list), err)
+			}
+			return list[0], nil
+		},
+	} {
+		stored, err := check()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.Invoice.BrRac.BrOznRac != 44 || stored.Invoice.NakDost {
+			t.Errorf("Expected the stored invoice not to change, got %+v", stored.Invoice)
+		}
+		if porez := stored.Invoice.Pdv.Porez[0]; porez.Iznos != "2.00" || porez.Osnovica != "8.00" {
+			t.Errorf("Expected the stored taxes not to change, got %+v", porez)
+		}
+	}
+}
+
+// listCountingStore counts the List calls of the store
+type listCountingStore struct {
+	QueueStore
+	lists int
+}
+
+func (s *listCountingStore) List() ([]*QueuedInvoice, error) {
+	s.lists++
+	return s.QueueStore.List()
+}
+
+func TestOfflineQueueLen(t *testing.T) {
+	store := &listCountingStore{QueueStore: NewMemoryQueueStore()}
+	invoice, zki, err := testEntity.NewCISInvoice(time.Now(), 45, 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "10.00", CISCash, "12345678901")
+	if err != nil {
+		t.Fatalf("Failed to create invoice: %v", err)
+	}
+	// Invoices queued before the queue was created (e.g. by the previous run) are counted
+	if err := store.Put(&QueuedInvoice{ZKI: "earlier", Invoice: invoice}); err != nil {
+		t.Fatal(err)
+	}
+	queue, err := testEntity.NewOfflineQueue(store)
+	if err != nil {
+		t.Fatalf("Failed to create queue: %v", err)
+	}
+	if n, err := queue.Len(); n != 1 || err != nil {
+		t.Fatalf("Expected 1 waiting invoice, got %d %v", n, err)
+	}
+
+	if err := queue.Enqueue(invoice, nil); err != nil {
+		t.Fatalf("Failed to enqueue invoice: %v", err)
+	}
+	if err := queue.Enqueue(invoice, nil); err != nil {
+		t.Fatalf("Failed to enqueue invoice again: %v", err)
+	}
+	if n, _ := queue.Len(); n != 2 {
+		t.Errorf("Expected 2 waiting invoices, got %d", n)
+	}
+	if err := queue.Remove(zki); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := queue.Len(); n != 1 {
+		t.Errorf("Expected 1 waiting invoice after the removal, got %d", n)
+	}
+	if store.lists != 1 {
+		t.Errorf("Expected the store to be listed once, got %d", store.lists)
+	}
+}
@@ -0,0 +1,190 @@
+package receipt
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	fiskalhrgo "github.com/l-d-t/fiskalhrgo"
+)
+
+// Element is a legally required element of the receipt
+type Element string
+
+const (
+	ElementSeller        Element = "seller"         // Name and address of the seller
+	ElementOIB           Element = "oib"            // OIB of the seller
+	ElementNumber        Element = "number"         // Invoice number
+	ElementDateTime      Element = "datetime"       // Issue date and time
+	ElementTotal         Element = "total"          // Total amount
+	ElementPaymentMethod Element = "payment_method" // Payment method
+	ElementOperator      Element = "operator"       // Operator label
+	ElementZKI           Element = "zki"            // Protective code of the issuer
+	ElementJIR           Element = "jir"            // Unique invoice identifier from CIS
+	ElementQRCode        Element = "qr_code"        // Verification QR code
+)
+
+// PrintedReceipt is the data an application prints on the receipt, as printed
+type PrintedReceipt struct {
+	SellerName    string
+	SellerAddress []string
+	OIB           string
+	InvoiceNumber string
+	IssuedAt      time.Time
+	Total         string
+	PaymentMethod fiskalhrgo.PaymentMethod
+	Operator      string
+	ZKI           string
+	JIR           string
+	QRCode        string
+}
+
+// Check is the result of the check of a single receipt element
+type Check struct {
+	Element Element
+	Passed  bool
+
+	// Problem describes the gap, empty if the check passed
+	Problem string
+}
+
+// Checklist is the result of the check of all receipt elements
+type Checklist []Check
+
+// OK reports if all elements passed
+func (c Checklist) OK() bool {
+	return len(c.Gaps()) == 0
+}
+
+// Gaps returns the checks that failed
+func (c Checklist) Gaps() []Check {
+	var gaps []Check
+	for _, check := range c {
+		if !check.Passed {
+			gaps = append(gaps, check)
+		}
+	}
+	return gaps
+}
+
+// String lists the gaps, one per line
+func (c Checklist) String() string {
+	var sb strings.Builder
+	for _, gap := range c.Gaps() {
+		fmt.Fprintf(&sb, "%s: %s\n", gap.Element, gap.Problem)
+	}
+	return sb.String()
+}
+
+// CheckCompliance verifies that the receipt has all legally required elements and that they match the
+// fiscalized invoice and the JIR returned by CIS (empty if the invoice is not fiscalized yet).
+// Every element is checked, the checklist lists the gaps of all of them. A receipt without the JIR
+// (printed while CIS was not available) always has the JIR gap until the invoice is delivered.
+func CheckCompliance(printed *PrintedReceipt, fiscalized *fiskalhrgo.RacunType, jir string) Checklist {
+	if printed == nil {
+		printed = &PrintedReceipt{}
+	}
+	if fiscalized == nil {
+		fiscalized = &fiskalhrgo.RacunType{}
+	}
+	var list Checklist
+	add := func(element Element, problem string) {
+		list = append(list, Check{Element: element, Passed: problem == "", Problem: problem})
+	}
+
+	switch {
+	case strings.TrimSpace(printed.SellerName) == "":
+		add(ElementSeller, "seller name is missing")
+	case len(printed.SellerAddress) == 0:
+		add(ElementSeller, "seller address is missing")
+	default:
+		add(ElementSeller, "")
+	}
+
+	add(ElementOIB, compare("OIB", printed.OIB, fiscalized.Oib))
+
+	add(ElementNumber, compare("invoice number", printed.InvoiceNumber, invoiceNumber(fiscalized)))
+
+	issued, err := time.ParseInLocation("02.01.2006T15:04:05", fiscalized.DatVrijeme, time.Local)
+	switch {
+	case printed.IssuedAt.IsZero():
+		add(ElementDateTime, "issue date and time is missing")
+	case err != nil:
+		add(ElementDateTime, "fiscalized invoice has an invalid date and time")
+	case !printed.IssuedAt.Truncate(time.Second).Equal(issued):
+		add(ElementDateTime, fmt.Sprintf("printed %s, fiscalized %s",
+			printed.IssuedAt.Format("02.01.2006. 15:04:05"), issued.Format("02.01.2006. 15:04:05")))
+	default:
+		add(ElementDateTime, "")
+	}
+
+	add(ElementTotal, compare("total amount", printed.Total, fiscalized.IznosUkupno))
+
+	add(ElementPaymentMethod, compare("payment method", string(printed.PaymentMethod), fiscalized.NacinPlac))
+
+	if strings.TrimSpace(printed.Operator) == "" {
+		add(ElementOperator, "operator is missing")
+	} else {
+		add(ElementOperator, "")
+	}
+
+	add(ElementZKI, compare("ZKI", printed.ZKI, fiscalized.ZastKod))
+
+	switch {
+	case jir == "" && printed.JIR != "":
+		add(ElementJIR, "JIR is printed but the invoice is not fiscalized")
+	case jir == "":
+		add(ElementJIR, "invoice is not fiscalized, it must be delivered to CIS later")
+	default:
+		add(ElementJIR, compare("JIR", printed.JIR, jir))
+	}
+
+	if qrCode, err := fiscalized.QRCodeURL(jir); err != nil {
+		add(ElementQRCode, "failed to create the QR code of the fiscalized invoice: "+err.Error())
+	} else {
+		add(ElementQRCode, compare("QR code", printed.QRCode, qrCode))
+	}
+
+	return list
+}
+
+// compare returns the problem of a printed value not matching the fiscalized one, empty if they match
+func compare(name, printed, fiscalized string) string {
+	switch {
+	case printed == "":
+		return name + " is missing"
+	case printed != fiscalized:
+		return fmt.Sprintf("printed %s %q doesn't match the fiscalized %q", name, printed, fiscalized)
+	}
+	return ""
+}
+
+// Printed returns the elements the receipt prints, to check them with CheckCompliance
+func (r *Receipt) Printed() *PrintedReceipt {
+	if r == nil || r.Invoice == nil {
+		return &PrintedReceipt{}
+	}
+	issued, _ := r.IssuedAt()
+	qrCode, _ := r.Invoice.QRCodeURL(r.JIR)
+	operator := r.Operator
+	if operator == "" {
+		operator = r.Invoice.OibOper
+	}
+	return &PrintedReceipt{
+		SellerName:    r.Seller.Name,
+		SellerAddress: r.Seller.Address,
+		OIB:           r.Invoice.Oib,
+		InvoiceNumber: r.InvoiceNumber(),
+		IssuedAt:      issued,
+		Total:         r.Invoice.IznosUkupno,
+		PaymentMethod: fiskalhrgo.PaymentMethod(r.Invoice.NacinPlac),
+		Operator:      operator,
+		ZKI:           r.Invoice.ZastKod,
+		JIR:           r.JIR,
+		QRCode:        qrCode,
+	}
+}
@@ -0,0 +1,81 @@
+package receipt
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckComplianceOfReceipt(t *testing.T) {
+	r := newTestReceipt()
+	list := CheckCompliance(r.Printed(), r.Invoice, r.JIR)
+	if !list.OK() {
+		t.Errorf("rendered receipt is not compliant:\n%s", list)
+	}
+	if len(list) != 10 {
+		t.Errorf("checklist has %d elements, want 10", len(list))
+	}
+}
+
+func TestCheckComplianceGaps(t *testing.T) {
+	r := newTestReceipt()
+	printed := r.Printed()
+	printed.SellerAddress = nil
+	printed.Total = "120.00"
+	printed.PaymentMethod = "G"
+	printed.IssuedAt = printed.IssuedAt.Add(time.Minute)
+	printed.ZKI = ""
+
+	list := CheckCompliance(printed, r.Invoice, r.JIR)
+	gaps := make(map[Element]string)
+	for _, gap := range list.Gaps() {
+		gaps[gap.Element] = gap.Problem
+	}
+	for _, element := range []Element{ElementSeller, ElementTotal, ElementPaymentMethod, ElementDateTime, ElementZKI} {
+		if gaps[element] == "" {
+			t.Errorf("no gap for %s", element)
+		}
+	}
+	if len(gaps) != 5 {
+		t.Errorf("got %d gaps, want 5:\n%s", len(gaps), list)
+	}
+	if !strings.Contains(gaps[ElementTotal], `"120.00"`) || !strings.Contains(gaps[ElementTotal], `"125.00"`) {
+		t.Errorf("total gap doesn't show both amounts: %s", gaps[ElementTotal])
+	}
+}
+
+func TestCheckComplianceJIR(t *testing.T) {
+	r := newTestReceipt()
+
+	// Printed with the JIR of another invoice
+	printed := r.Printed()
+	printed.JIR = "0b3c9c1d-2a8b-4e1f-9d3a-6c5b4a3f2e1d"
+	gaps := CheckCompliance(printed, r.Invoice, r.JIR).Gaps()
+	if len(gaps) != 1 || gaps[0].Element != ElementJIR {
+		t.Errorf("gaps = %v, want the JIR gap", gaps)
+	}
+
+	// Printed offline, the QR code has the ZKI
+	r.JIR = ""
+	gaps = CheckCompliance(r.Printed(), r.Invoice, "").Gaps()
+	if len(gaps) != 1 || gaps[0].Element != ElementJIR {
+		t.Errorf("gaps = %v, want only the JIR gap", gaps)
+	}
+
+	// The QR code with the ZKI once the invoice is fiscalized
+	gaps = CheckCompliance(r.Printed(), r.Invoice, testJIR).Gaps()
+	if len(gaps) != 2 {
+		t.Errorf("gaps = %v, want the JIR and the QR code gaps", gaps)
+	}
+}
+
+func TestCheckComplianceEmpty(t *testing.T) {
+	list := CheckCompliance(nil, nil, "")
+	if list.OK() || len(list.Gaps()) != len(list) {
+		t.Errorf("empty receipt passed some checks:\n%v", list)
+	}
+}
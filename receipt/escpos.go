@@ -0,0 +1,167 @@
+package receipt
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+const (
+	// defaultWidth is the number of characters in a line on 80 mm paper with the default font
+	defaultWidth = 48
+
+	// defaultQRSize is the size of a QR code module in dots, 4 prints the code about 2.5 cm wide on a 203 dpi printer
+	defaultQRSize = 4
+
+	// codePage852 is the ESC t code page number of CP852 (Latin 2), the code page with the Croatian letters
+	codePage852 = 18
+)
+
+// ESC/POS commands
+var (
+	escInit      = []byte{0x1b, '@'}
+	escCodePage  = []byte{0x1b, 't', codePage852}
+	escBoldOn    = []byte{0x1b, 'E', 1}
+	escBoldOff   = []byte{0x1b, 'E', 0}
+	escAlignLeft = []byte{0x1b, 'a', 0}
+	escAlignMid  = []byte{0x1b, 'a', 1}
+	gsSizeNormal = []byte{0x1d, '!', 0x00}
+	gsSizeDouble = []byte{0x1d, '!', 0x01}
+	gsCut        = []byte{0x1d, 'V', 66, 3}
+)
+
+// ESCPOS renders receipts to ESC/POS commands for thermal receipt printers. The text is encoded in CP852,
+// the QR code is printed with the native printer QR command (GS ( k).
+type ESCPOS struct {
+	// Width is the number of characters in a line, 48 by default (80 mm paper), use 32 for 58 mm paper
+	Width int
+
+	// QRSize is the size of a QR code module in dots (1-16), 4 by default
+	QRSize int
+
+	// NoQRCode skips the QR code, for printers without the native QR command
+	NoQRCode bool
+
+	// Cut feeds the paper and cuts it after the receipt
+	Cut bool
+}
+
+// Render returns the ESC/POS commands printing the receipt
+func (p *ESCPOS) Render(r *Receipt) ([]byte, error) {
+	width := p.Width
+	if width == 0 {
+		width = defaultWidth
+	}
+	if width < 24 {
+		return nil, errors.New("width must be at least 24 characters")
+	}
+	qrSize := p.QRSize
+	if qrSize == 0 {
+		qrSize = defaultQRSize
+	}
+	if qrSize < 1 || qrSize > 16 {
+		return nil, errors.New("QR code size must be between 1 and 16")
+	}
+
+	lines, err := r.lines()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.Write(escInit)
+	buf.Write(escCodePage)
+	for _, l := range lines {
+		switch l.style {
+		case styleTitle:
+			buf.Write(escAlignMid)
+			buf.Write(escBoldOn)
+			buf.Write(gsSizeDouble)
+			writeText(&buf, l.left)
+			buf.Write(gsSizeNormal)
+			buf.Write(escBoldOff)
+			buf.Write(escAlignLeft)
+		case styleCenter:
+			buf.Write(escAlignMid)
+			writeText(&buf, l.left)
+			buf.Write(escAlignLeft)
+		case styleTotal:
+			buf.Write(escBoldOn)
+			writeText(&buf, columns(l.left, l.right, width))
+			buf.Write(escBoldOff)
+		case styleSeparator:
+			writeText(&buf, strings.Repeat("-", width))
+		default:
+			writeText(&buf, columns(l.left, l.right, width))
+		}
+	}
+
+	if !p.NoQRCode {
+		content, err := r.Invoice.QRCodeURL(r.JIR)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the QR code: %w", err)
+		}
+		buf.WriteByte('\n')
+		buf.Write(escAlignMid)
+		writeQRCode(&buf, content, qrSize)
+		buf.Write(escAlignLeft)
+	}
+
+	if len(r.Footer) > 0 {
+		buf.WriteByte('\n')
+		buf.Write(escAlignMid)
+		for _, footer := range r.Footer {
+			writeText(&buf, footer)
+		}
+		buf.Write(escAlignLeft)
+	}
+
+	if p.Cut {
+		buf.Write(gsCut)
+	}
+	return buf.Bytes(), nil
+}
+
+// columns lays out the left and the right text in a line of width characters,
+// the right text goes to its own line when both don't fit
+func columns(left, right string, width int) string {
+	if right == "" {
+		return left
+	}
+	gap := width - utf8.RuneCountInString(left) - utf8.RuneCountInString(right)
+	if gap < 1 {
+		return left + "\n" + strings.Repeat(" ", max(width-utf8.RuneCountInString(right), 0)) + right
+	}
+	return left + strings.Repeat(" ", gap) + right
+}
+
+// writeText writes the text as a line encoded in CP852, the characters not in CP852 are replaced
+func writeText(buf *bytes.Buffer, text string) {
+	encoded, err := encoding.ReplaceUnsupported(charmap.CodePage852.NewEncoder()).String(text)
+	if err != nil {
+		encoded = text
+	}
+	buf.WriteString(encoded)
+	buf.WriteByte('\n')
+}
+
+// writeQRCode writes the native QR code commands: model 2, the module size, the low error correction level,
+// store the data and print the stored code
+func writeQRCode(buf *bytes.Buffer, content string, size int) {
+	store := len(content) + 3
+	buf.Write([]byte{0x1d, '(', 'k', 4, 0, '1', 'A', '2', 0})
+	buf.Write([]byte{0x1d, '(', 'k', 3, 0, '1', 'C', byte(size)})
+	buf.Write([]byte{0x1d, '(', 'k', 3, 0, '1', 'E', '0'})
+	buf.Write([]byte{0x1d, '(', 'k', byte(store % 256), byte(store / 256), '1', 'P', '0'})
+	buf.WriteString(content)
+	buf.Write([]byte{0x1d, '(', 'k', 3, 0, '1', 'Q', '0'})
+}
@@ -0,0 +1,166 @@
+package receipt
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	fiskalhrgo "github.com/l-d-t/fiskalhrgo"
+	"golang.org/x/text/encoding/charmap"
+)
+
+const (
+	testJIR = "fb3c9c1d-2a8b-4e1f-9d3a-6c5b4a3f2e1d"
+	testZKI = "3f1f6a1b2c3d4e5f60718293a4b5c6d7"
+)
+
+func newTestReceipt() *Receipt {
+	return &Receipt{
+		Invoice: &fiskalhrgo.RacunType{
+			Oib:         "12345678903",
+			USustPdv:    true,
+			DatVrijeme:  "15.03.2024T14:30:05",
+			OznSlijed:   "P",
+			BrRac:       &fiskalhrgo.BrojRacunaType{BrOznRac: 42, OznPosPr: "POS1", OznNapUr: 2},
+			Pdv:         &fiskalhrgo.PdvType{Porez: []*fiskalhrgo.PorezType{{Stopa: "25.00", Osnovica: "100.00", Iznos: "25.00"}}},
+			IznosUkupno: "125.00",
+			NacinPlac:   string(fiskalhrgo.CISCard),
+			OibOper:     "98765432106",
+			ZastKod:     testZKI,
+		},
+		JIR:      testJIR,
+		Seller:   Seller{Name: "Trgovina d.o.o.", Address: []string{"Ilica 1, Zagreb"}},
+		Operator: "Ana",
+		Items:    []Item{{Name: "Kava", Quantity: "2", UnitPrice: "62.50", Amount: "125.00"}},
+		Footer:   []string{"Hvala na kupnji"},
+	}
+}
+
+// decode returns the printed text, the command bytes are kept as they are
+func decode(t *testing.T, data []byte) string {
+	t.Helper()
+	text, err := charmap.CodePage852.NewDecoder().Bytes(data)
+	if err != nil {
+		t.Fatalf("failed to decode the receipt: %v", err)
+	}
+	return string(text)
+}
+
+func TestESCPOSRender(t *testing.T) {
+	r := newTestReceipt()
+	data, err := (&ESCPOS{Width: 48, Cut: true}).Render(r)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+
+	if !bytes.HasPrefix(data, append(escInit, escCodePage...)) {
+		t.Errorf("receipt doesn't start with the init and the code page commands: % x", data[:5])
+	}
+	if !bytes.HasSuffix(data, gsCut) {
+		t.Error("receipt doesn't end with the cut command")
+	}
+
+	text := decode(t, data)
+	for _, want := range []string{
+		"Trgovina d.o.o.",
+		"OIB: 12345678903",
+		"Račun br." + strings.Repeat(" ", 48-9-9) + "42/POS1/2",
+		"15.03.2024. 14:30:05",
+		"Ana (98765432106)",
+		"  2 x 62.50",
+		"UKUPNO EUR",
+		"Kartica",
+		"PDV 25.00% na 100.00",
+		"ZKI: " + testZKI,
+		"JIR: " + testJIR,
+		"Hvala na kupnji",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("receipt doesn't contain %q", want)
+		}
+	}
+	if strings.Contains(text, "nije u sustavu PDV-a") {
+		t.Error("receipt of a VAT payer contains the not in the VAT system notice")
+	}
+
+	// The encoded Croatian letters
+	if !bytes.Contains(data, []byte{'R', 'a', 0x9f, 'u', 'n'}) {
+		t.Error("č is not encoded in CP852")
+	}
+
+	url, err := r.Invoice.QRCodeURL(testJIR)
+	if err != nil {
+		t.Fatalf("QRCodeURL failed: %v", err)
+	}
+	store := len(url) + 3
+	qr := append([]byte{0x1d, '(', 'k', byte(store % 256), byte(store / 256), '1', 'P', '0'}, url...)
+	if !bytes.Contains(data, qr) {
+		t.Error("receipt doesn't contain the QR code with the verification URL")
+	}
+}
+
+func TestESCPOSRenderOffline(t *testing.T) {
+	r := newTestReceipt()
+	r.JIR = ""
+	r.Invoice.USustPdv = false
+	r.Invoice.Pdv = nil
+
+	data, err := (&ESCPOS{NoQRCode: true}).Render(r)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	text := decode(t, data)
+	if strings.Contains(text, "JIR") {
+		t.Error("receipt without the JIR contains the JIR line")
+	}
+	if !strings.Contains(text, "Obveznik nije u sustavu PDV-a") {
+		t.Error("receipt doesn't contain the not in the VAT system notice")
+	}
+	if bytes.Contains(data, []byte{0x1d, '(', 'k'}) {
+		t.Error("receipt contains the QR code with NoQRCode")
+	}
+	if bytes.HasSuffix(data, gsCut) {
+		t.Error("receipt is cut without Cut")
+	}
+}
+
+func TestESCPOSRenderInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		printer *ESCPOS
+		modify  func(r *Receipt)
+	}{
+		{"no invoice", &ESCPOS{}, func(r *Receipt) { r.Invoice = nil }},
+		{"no number", &ESCPOS{}, func(r *Receipt) { r.Invoice.BrRac = nil }},
+		{"no seller", &ESCPOS{}, func(r *Receipt) { r.Seller.Name = "" }},
+		{"invalid JIR", &ESCPOS{}, func(r *Receipt) { r.JIR = "not-a-jir" }},
+		{"invalid date", &ESCPOS{}, func(r *Receipt) { r.Invoice.DatVrijeme = "2024-03-15" }},
+		{"narrow", &ESCPOS{Width: 10}, func(r *Receipt) {}},
+		{"QR size", &ESCPOS{QRSize: 17}, func(r *Receipt) {}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestReceipt()
+			tt.modify(r)
+			if _, err := tt.printer.Render(r); err == nil {
+				t.Error("Render succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestColumns(t *testing.T) {
+	if got := columns("UKUPNO", "10.00", 16); got != "UKUPNO     10.00" {
+		t.Errorf("columns = %q", got)
+	}
+	if got := columns("A long item name", "10.00", 16); got != "A long item name\n           10.00" {
+		t.Errorf("columns = %q", got)
+	}
+	if got := columns("Only left", "", 16); got != "Only left" {
+		t.Errorf("columns = %q", got)
+	}
+}
@@ -0,0 +1,112 @@
+package receipt
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"fmt"
+	"maps"
+
+	fiskalhrgo "github.com/l-d-t/fiskalhrgo"
+)
+
+// Labels are the texts printed on the receipt in one language. The receipt is always printed in Croatian,
+// Receipt.SecondaryLabels adds the labels in another language, e.g. "Račun br. / Invoice no.".
+type Labels struct {
+	InvoiceNumber  string
+	DateTime       string
+	Operator       string
+	Total          string
+	PaymentMethod  string
+	PaymentMethods map[fiskalhrgo.PaymentMethod]string
+	VAT            string
+	ConsumptionTax string
+	TaxBase        string
+	VATExempt      string
+	Margin         string
+	NotTaxable     string
+	NotInVATSystem string
+}
+
+// labelsHR are the mandatory Croatian labels
+var labelsHR = Labels{
+	InvoiceNumber: "Račun br.",
+	DateTime:      "Datum i vrijeme",
+	Operator:      "Operater",
+	Total:         "UKUPNO EUR",
+	PaymentMethod: "Način plaćanja",
+	PaymentMethods: map[fiskalhrgo.PaymentMethod]string{
+		fiskalhrgo.CISCash:         "Gotovina",
+		fiskalhrgo.CISCard:         "Kartica",
+		fiskalhrgo.CISMixOther:     "Ostalo",
+		fiskalhrgo.CISBankTransfer: "Transakcijski račun",
+		fiskalhrgo.CISCheck:        "Ček",
+	},
+	VAT:            "PDV",
+	ConsumptionTax: "PNP",
+	TaxBase:        "na",
+	VATExempt:      "Oslobođeno PDV-a",
+	Margin:         "Oporezivanje marže",
+	NotTaxable:     "Ne podliježe oporezivanju",
+	NotInVATSystem: "Obveznik nije u sustavu PDV-a",
+}
+
+// labelsEN are the English labels for the bilingual receipts
+var labelsEN = Labels{
+	InvoiceNumber: "Invoice no.",
+	DateTime:      "Date and time",
+	Operator:      "Operator",
+	Total:         "TOTAL EUR",
+	PaymentMethod: "Payment method",
+	PaymentMethods: map[fiskalhrgo.PaymentMethod]string{
+		fiskalhrgo.CISCash:         "Cash",
+		fiskalhrgo.CISCard:         "Card",
+		fiskalhrgo.CISMixOther:     "Other",
+		fiskalhrgo.CISBankTransfer: "Bank transfer",
+		fiskalhrgo.CISCheck:        "Cheque",
+	},
+	VAT:            "VAT",
+	ConsumptionTax: "Consumption tax",
+	TaxBase:        "on",
+	VATExempt:      "VAT exempt",
+	Margin:         "Margin scheme",
+	NotTaxable:     "Not subject to tax",
+	NotInVATSystem: "The seller is not registered for VAT",
+}
+
+// LabelsFor returns a copy of the built-in labels in the language (LangHR or LangEN),
+// to use as Receipt.SecondaryLabels or as the base of the labels in another language
+func LabelsFor(lang fiskalhrgo.Language) (*Labels, error) {
+	var labels Labels
+	switch lang {
+	case fiskalhrgo.LangHR:
+		labels = labelsHR
+	case fiskalhrgo.LangEN:
+		labels = labelsEN
+	default:
+		return nil, fmt.Errorf("unsupported language: %s", lang)
+	}
+	labels.PaymentMethods = maps.Clone(labels.PaymentMethods)
+	return &labels, nil
+}
+
+// label returns the Croatian label with the secondary one, if there is one
+func (r *Receipt) label(pick func(*Labels) string) string {
+	primary := pick(&labelsHR)
+	if r.SecondaryLabels == nil {
+		return primary
+	}
+	if secondary := pick(r.SecondaryLabels); secondary != "" && secondary != primary {
+		return primary + " / " + secondary
+	}
+	return primary
+}
+
+// paymentMethodLabel returns the name of the payment method, the code if it is unknown
+func (r *Receipt) paymentMethodLabel(method fiskalhrgo.PaymentMethod) string {
+	if _, ok := labelsHR.PaymentMethods[method]; !ok {
+		return string(method)
+	}
+	return r.label(func(l *Labels) string { return l.PaymentMethods[method] })
+}
@@ -0,0 +1,70 @@
+package receipt
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"strings"
+	"testing"
+
+	fiskalhrgo "github.com/l-d-t/fiskalhrgo"
+)
+
+func TestBilingualReceipt(t *testing.T) {
+	en, err := LabelsFor(fiskalhrgo.LangEN)
+	if err != nil {
+		t.Fatalf("LabelsFor failed: %v", err)
+	}
+	r := newTestReceipt()
+	r.SecondaryLabels = en
+
+	data, err := (&ESCPOS{}).Render(r)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	text := decode(t, data)
+	for _, want := range []string{
+		"Račun br. / Invoice no.",
+		"Datum i vrijeme / Date and time",
+		"UKUPNO EUR / TOTAL EUR",
+		"Način plaćanja / Payment method",
+		"Kartica / Card",
+		"PDV / VAT 25.00% na / on 100.00",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("receipt doesn't contain %q", want)
+		}
+	}
+}
+
+func TestSecondaryLabelsPartial(t *testing.T) {
+	r := newTestReceipt()
+	r.SecondaryLabels = &Labels{Total: "GESAMT EUR"}
+
+	data, err := (&ESCPOS{}).Render(r)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	text := decode(t, data)
+	if !strings.Contains(text, "UKUPNO EUR / GESAMT EUR") {
+		t.Error("receipt doesn't contain the secondary label")
+	}
+	if !strings.Contains(text, "Račun br.  ") || !strings.Contains(text, "Kartica\n") {
+		t.Error("missing secondary labels are not left out")
+	}
+}
+
+func TestLabelsFor(t *testing.T) {
+	hr, err := LabelsFor(fiskalhrgo.LangHR)
+	if err != nil {
+		t.Fatalf("LabelsFor failed: %v", err)
+	}
+	hr.PaymentMethods[fiskalhrgo.CISCash] = "Keš"
+	if labelsHR.PaymentMethods[fiskalhrgo.CISCash] != "Gotovina" {
+		t.Error("LabelsFor doesn't return a copy")
+	}
+	if _, err := LabelsFor("de"); err == nil {
+		t.Error("LabelsFor accepted an unsupported language")
+	}
+}
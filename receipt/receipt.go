@@ -0,0 +1,219 @@
+// Package receipt renders fiscal receipts from the fiscalized invoice, with all mandatory elements:
+// the seller and its OIB, the invoice number, the date and time, the amounts and taxes, the payment method,
+// the operator, the ZKI, the JIR and the verification QR code.
+//
+// The invoice and the JIR returned by InvoiceRequest are printed as they were fiscalized, the application
+// adds only what is not sent to CIS (the seller name and address, the items, the operator name):
+//
+//	jir, _, err := invoice.InvoiceRequest()
+//	r := &receipt.Receipt{Invoice: invoice, JIR: jir, Seller: receipt.Seller{Name: "Shop d.o.o.", Address: []string{"Ilica 1, Zagreb"}}}
+//	data, err := (&receipt.ESCPOS{Width: 48, Cut: true}).Render(r)
+//
+// A receipt without the JIR (CIS not available) is printed with the ZKI only, the invoice must be delivered later.
+//
+// CheckCompliance verifies a receipt printed by the application itself against the fiscalized invoice.
+package receipt
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	fiskalhrgo "github.com/l-d-t/fiskalhrgo"
+)
+
+// Seller is the business issuing the receipt, its OIB is taken from the invoice
+type Seller struct {
+	Name    string
+	Address []string
+}
+
+// Item is a line of the receipt, the amounts are printed as given
+type Item struct {
+	Name      string
+	Quantity  string
+	UnitPrice string
+	Amount    string
+}
+
+// Receipt is the data printed on the receipt
+type Receipt struct {
+	// Invoice is the fiscalized invoice
+	Invoice *fiskalhrgo.RacunType
+
+	// JIR returned by CIS, empty if the invoice is not fiscalized yet
+	JIR string
+
+	// Seller name and address printed in the header
+	Seller Seller
+
+	// Operator is the label or the name of the operator printed with the OIB of the operator from the invoice
+	Operator string
+
+	// Items are the lines of the receipt, optional
+	Items []Item
+
+	// Footer lines printed at the end of the receipt, e.g. a thank you note
+	Footer []string
+
+	// SecondaryLabels are printed next to the Croatian labels, e.g. LabelsFor(fiskalhrgo.LangEN)
+	// for a bilingual receipt. Optional, the receipt is printed in Croatian only if nil.
+	SecondaryLabels *Labels
+}
+
+// validate checks that the receipt has the invoice data needed for the mandatory elements
+func (r *Receipt) validate() error {
+	if r == nil || r.Invoice == nil {
+		return errors.New("receipt has no invoice")
+	}
+	if r.Invoice.BrRac == nil {
+		return errors.New("invoice has no number")
+	}
+	if r.Seller.Name == "" {
+		return errors.New("seller name is required")
+	}
+	if r.JIR != "" && !fiskalhrgo.ValidateJIR(r.JIR) {
+		return errors.New("invalid JIR")
+	}
+	return nil
+}
+
+// InvoiceNumber returns the invoice number as printed: number/location/device
+func (r *Receipt) InvoiceNumber() string {
+	if r == nil {
+		return ""
+	}
+	return invoiceNumber(r.Invoice)
+}
+
+// invoiceNumber formats the number of the invoice, empty if it has none
+func invoiceNumber(invoice *fiskalhrgo.RacunType) string {
+	if invoice == nil || invoice.BrRac == nil {
+		return ""
+	}
+	return fmt.Sprintf("%d/%s/%d", invoice.BrRac.BrOznRac, invoice.BrRac.OznPosPr, invoice.BrRac.OznNapUr)
+}
+
+// IssuedAt returns the issue date and time of the invoice
+func (r *Receipt) IssuedAt() (time.Time, error) {
+	if r == nil || r.Invoice == nil {
+		return time.Time{}, errors.New("receipt has no invoice")
+	}
+	return time.ParseInLocation("02.01.2006T15:04:05", r.Invoice.DatVrijeme, time.Local)
+}
+
+// line is a line of the rendered receipt, independent of the output format
+type line struct {
+	left, right string
+	style       lineStyle
+}
+
+// lineStyle is the formatting of a line
+type lineStyle int
+
+const (
+	styleNormal lineStyle = iota
+	styleCenter
+	styleTitle
+	styleTotal
+	styleSeparator
+)
+
+// lines lays out the receipt, the output formats only print the lines
+func (r *Receipt) lines() ([]line, error) {
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+	invoice := r.Invoice
+	issued, err := r.IssuedAt()
+	if err != nil {
+		return nil, fmt.Errorf("invalid invoice date: %w", err)
+	}
+
+	lines := []line{{left: r.Seller.Name, style: styleTitle}}
+	for _, address := range r.Seller.Address {
+		lines = append(lines, line{left: address, style: styleCenter})
+	}
+	lines = append(lines,
+		line{left: "OIB: " + invoice.Oib, style: styleCenter},
+		line{style: styleSeparator},
+		line{left: r.label(func(l *Labels) string { return l.InvoiceNumber }), right: r.InvoiceNumber()},
+		line{left: r.label(func(l *Labels) string { return l.DateTime }), right: issued.Format("02.01.2006. 15:04:05")},
+	)
+	operator := invoice.OibOper
+	if r.Operator != "" {
+		operator = r.Operator + " (" + invoice.OibOper + ")"
+	}
+	lines = append(lines, line{left: r.label(func(l *Labels) string { return l.Operator }), right: operator})
+
+	if len(r.Items) > 0 {
+		lines = append(lines, line{style: styleSeparator})
+		for _, item := range r.Items {
+			lines = append(lines, line{left: item.Name})
+			lines = append(lines, line{left: "  " + item.Quantity + " x " + item.UnitPrice, right: item.Amount})
+		}
+	}
+
+	lines = append(lines, line{style: styleSeparator})
+	lines = append(lines,
+		line{left: r.label(func(l *Labels) string { return l.Total }), right: invoice.IznosUkupno, style: styleTotal},
+		line{left: r.label(func(l *Labels) string { return l.PaymentMethod }), right: r.paymentMethodLabel(fiskalhrgo.PaymentMethod(invoice.NacinPlac))},
+	)
+
+	lines = append(lines, r.taxLines()...)
+	if !invoice.USustPdv {
+		lines = append(lines, line{left: r.label(func(l *Labels) string { return l.NotInVATSystem })})
+	}
+
+	lines = append(lines, line{style: styleSeparator}, line{left: "ZKI: " + invoice.ZastKod})
+	if r.JIR != "" {
+		lines = append(lines, line{left: "JIR: " + r.JIR})
+	}
+	return lines, nil
+}
+
+// taxLines lists the taxes, the exempt amounts and the fees of the invoice
+func (r *Receipt) taxLines() []line {
+	invoice := r.Invoice
+	taxBase := r.label(func(l *Labels) string { return l.TaxBase })
+	var lines []line
+	if invoice.Pdv != nil {
+		name := r.label(func(l *Labels) string { return l.VAT })
+		for _, tax := range invoice.Pdv.Porez {
+			lines = append(lines, line{left: fmt.Sprintf("%s %s%% %s %s", name, tax.Stopa, taxBase, tax.Osnovica), right: tax.Iznos})
+		}
+	}
+	if invoice.Pnp != nil {
+		name := r.label(func(l *Labels) string { return l.ConsumptionTax })
+		for _, tax := range invoice.Pnp.Porez {
+			lines = append(lines, line{left: fmt.Sprintf("%s %s%% %s %s", name, tax.Stopa, taxBase, tax.Osnovica), right: tax.Iznos})
+		}
+	}
+	if invoice.OstaliPor != nil {
+		for _, tax := range invoice.OstaliPor.Porez {
+			lines = append(lines, line{left: fmt.Sprintf("%s %s%% %s %s", tax.Naziv, tax.Stopa, taxBase, tax.Osnovica), right: tax.Iznos})
+		}
+	}
+	for _, amount := range []struct{ label, value string }{
+		{r.label(func(l *Labels) string { return l.VATExempt }), invoice.IznosOslobPdv},
+		{r.label(func(l *Labels) string { return l.Margin }), invoice.IznosMarza},
+		{r.label(func(l *Labels) string { return l.NotTaxable }), invoice.IznosNePodlOpor},
+	} {
+		if amount.value != "" && amount.value != "0.00" {
+			lines = append(lines, line{left: amount.label, right: amount.value})
+		}
+	}
+	if invoice.Naknade != nil {
+		for _, fee := range invoice.Naknade.Naknada {
+			lines = append(lines, line{left: fee.NazivN, right: fee.IznosN})
+		}
+	}
+	if len(lines) > 0 {
+		lines = append([]line{{style: styleSeparator}}, lines...)
+	}
+	return lines
+}
@@ -0,0 +1,126 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/l-d-t/fiskalhrgo/client"
+)
+
+// ReceiptStatus is the outcome of the receipt check
+type ReceiptStatus string
+
+const (
+	// ReceiptStatusUnknown is a response of the service that was not interpreted, see ReceiptChecker.Interpret
+	ReceiptStatusUnknown ReceiptStatus = "unknown"
+
+	// ReceiptRegistered is a receipt registered in CIS
+	ReceiptRegistered ReceiptStatus = "registered"
+
+	// ReceiptNotFound is a receipt not registered in CIS (or with a wrong date, time or amount)
+	ReceiptNotFound ReceiptStatus = "not-found"
+)
+
+// ReceiptCheck is the result of ReceiptChecker.Check
+type ReceiptCheck struct {
+	// URL is the checked address, the same as in the QR code of the receipt
+	URL string
+
+	// Status of the receipt
+	Status ReceiptStatus
+
+	// StatusCode and Body are the response of the service
+	StatusCode int
+	Body       []byte
+
+	// Checked is the time of the check
+	Checked time.Time
+}
+
+// ReceiptChecker checks the receipts with the public receipt check service of the Tax Administration
+// (Provjera računa), the service the QR code of the receipt points to. It confirms the JIR or the ZKI with the date,
+// the time and the total amount of the receipt, e.g. in expense management tools or in self-audits.
+//
+// The service is a web page for the consumers, its response is not a documented interface. The checker fetches
+// it and leaves the interpretation to Interpret, without it every answered check is ReceiptStatusUnknown
+// with the page in Body. Don't check receipts in bulk, the service is meant for single receipts.
+type ReceiptChecker struct {
+	// BaseURL of the service, the address of the QR code if empty
+	BaseURL string
+
+	// Client sends the requests, http.DefaultClient if nil
+	Client *http.Client
+
+	// Interpret returns the status of the receipt from the response of the service
+	Interpret func(statusCode int, body []byte) (ReceiptStatus, error)
+}
+
+// defaultMaxReceiptCheckSize limits the response body read by ReceiptChecker
+const defaultMaxReceiptCheckSize = 1 << 20
+
+// Check checks the receipt with the JIR (or with the ZKI if the JIR is empty), the issue date and time
+// and the total amount, the same data as in the QR code (see ReceiptQRURL)
+func (c *ReceiptChecker) Check(ctx context.Context, jir string, zki string, issueDateTime time.Time, totalAmount string) (*ReceiptCheck, error) {
+	base := c.BaseURL
+	if base == "" {
+		base = receiptQRBaseURL
+	}
+	checkURL, err := receiptURL(base, jir, zki, issueDateTime, totalAmount)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, checkURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the request: %w", err)
+	}
+	httpClient := c.Client
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check the receipt: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := client.ReadLimited(resp.Body, resp.ContentLength, defaultMaxReceiptCheckSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the response: %w", err)
+	}
+	if int64(len(body)) > defaultMaxReceiptCheckSize {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrResponseTooLarge, defaultMaxReceiptCheckSize)
+	}
+
+	check := &ReceiptCheck{URL: checkURL, Status: ReceiptStatusUnknown, StatusCode: resp.StatusCode, Body: body, Checked: time.Now()}
+	if c.Interpret != nil {
+		if check.Status, err = c.Interpret(resp.StatusCode, body); err != nil {
+			return check, err
+		}
+		return check, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return check, fmt.Errorf("unexpected receipt check response status %d", resp.StatusCode)
+	}
+	return check, nil
+}
+
+// CheckReceipt checks the fiscalized invoice with the JIR with the checker, see ReceiptChecker.Check
+func (invoice *RacunType) CheckReceipt(ctx context.Context, checker *ReceiptChecker, jir string) (*ReceiptCheck, error) {
+	if invoice == nil {
+		return nil, errors.New("invoice is nil")
+	}
+	if checker == nil {
+		checker = &ReceiptChecker{}
+	}
+	issued, err := time.ParseInLocation("02.01.2006T15:04:05", invoice.DatVrijeme, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse date: %w", err)
+	}
+	return checker.Check(ctx, jir, invoice.ZastKod, issued, invoice.IznosUkupno)
+}
@@ -0,0 +1,56 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReceiptChecker(t *testing.T) {
+	const jir = "9d6f5bb6-da48-4fcd-a803-4586a025e0e4"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("jir") == jir {
+			w.Write([]byte("<p>Račun je evidentiran</p>"))
+			return
+		}
+		w.Write([]byte("<p>Račun nije pronađen</p>"))
+	}))
+	defer srv.Close()
+
+	issued := time.Date(2026, 3, 2, 10, 15, 0, 0, time.Local)
+	checker := &ReceiptChecker{BaseURL: srv.URL, Client: srv.Client()}
+
+	// Without Interpret the page is returned as it is
+	check, err := checker.Check(context.Background(), jir, "", issued, "12.50")
+	if err != nil || check.Status != ReceiptStatusUnknown || check.URL != srv.URL+"?jir="+jir+"&datv=20260302_1015&izn=1250" {
+		t.Fatalf("Unexpected check %+v, %v", check, err)
+	}
+
+	checker.Interpret = func(statusCode int, body []byte) (ReceiptStatus, error) {
+		if bytes.Contains(body, []byte("evidentiran")) {
+			return ReceiptRegistered, nil
+		}
+		return ReceiptNotFound, nil
+	}
+	fe := newTestEntity(t)
+	invoice, _, err := fe.NewCISInvoice(issued, 4, 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "12.50", CISCash, "12345678901")
+	if err != nil {
+		t.Fatalf("Failed to create invoice: %v", err)
+	}
+	if check, err := invoice.CheckReceipt(context.Background(), checker, jir); err != nil || check.Status != ReceiptRegistered {
+		t.Errorf("Expected the receipt to be registered, got %+v, %v", check, err)
+	}
+	if check, err := invoice.CheckReceipt(context.Background(), checker, ""); err != nil || check.Status != ReceiptNotFound {
+		t.Errorf("Expected the receipt with the ZKI not to be found, got %+v, %v", check, err)
+	}
+	if _, err := checker.Check(context.Background(), "", "", issued, "12.50"); err == nil {
+		t.Error("Expected an error without the JIR and the ZKI")
+	}
+}
@@ -0,0 +1,222 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// digitsPattern matches the runs of digits, the ones of 11 digits are the OIBs, e.g. in the subject
+// of a certificate (HR12345678901). Longer runs (the serials of the certificates) are not OIBs.
+var digitsPattern = regexp.MustCompile(`\d+`)
+
+// redactOIBs masks the OIBs in the text with redactOIB
+func redactOIBs(text string) string {
+	return digitsPattern.ReplaceAllStringFunc(text, func(digits string) string {
+		if len(digits) != 11 {
+			return digits
+		}
+		return redactOIB(digits)
+	})
+}
+
+// subjectPattern matches the distinguished names of the certificates, e.g. "CN=FISKAL 1,O=FIRMA D.O.O.,C=HR".
+// The values may contain spaces, so the name ends at a quote, a parenthesis or the end of the line.
+var subjectPattern = regexp.MustCompile(`\b(?:CN|O|OU|C|L|ST|STREET|POSTALCODE|SERIALNUMBER|2\.5\.4\.\d+)=[^,()"'\n]*(?:,(?:CN|O|OU|C|L|ST|STREET|POSTALCODE|SERIALNUMBER|2\.5\.4\.\d+)=[^,()"'\n]*)*`)
+
+// Redaction configures the redaction of the personal data in the log records and the error messages
+// of an entity, to help with the GDPR requirements of the logs, see SetRedaction
+type Redaction struct {
+	// OIBs keeps only the first and the last two digits of the OIBs (and of any other number of 11 digits)
+	OIBs bool
+
+	// CertificateSubjects replaces the distinguished names of the certificates (they contain the names of the
+	// people and the companies) with "[certificate subject]"
+	CertificateSubjects bool
+
+	// Custom is applied after the other rules, e.g. to remove the names of the operators, nil if not needed
+	Custom func(text string) string
+}
+
+// DefaultRedaction is the redaction of the entities without SetRedaction, it masks the OIBs
+var DefaultRedaction = Redaction{OIBs: true}
+
+// Redact returns the text with the personal data redacted
+func (r Redaction) Redact(text string) string {
+	if r.CertificateSubjects {
+		text = subjectPattern.ReplaceAllString(text, "[certificate subject]")
+	}
+	if r.OIBs {
+		text = redactOIBs(text)
+	}
+	if r.Custom != nil {
+		text = r.Custom(text)
+	}
+	return text
+}
+
+// attr returns the log attribute with the string values redacted
+func (r Redaction) attr(attr slog.Attr) slog.Attr {
+	switch attr.Value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, r.Redact(attr.Value.String()))
+	case slog.KindGroup:
+		group := attr.Value.Group()
+		redacted := make([]any, len(group))
+		for i, a := range group {
+			redacted[i] = r.attr(a)
+		}
+		return slog.Group(attr.Key, redacted...)
+	}
+	return attr
+}
+
+// SetRedaction sets the redaction of the log records of the entity and of the messages of the errors returned by
+// its request methods (InvoiceRequest, EchoRequest, AddTipRequest, ChangePaymentMethodRequest, SendMessage...).
+// The unwrapped errors keep their messages, so errors.Is and errors.As work as before. DefaultRedaction is used
+// until it is set.
+func (fe *FiskalEntity) SetRedaction(redaction Redaction) {
+	fe.hooksMu.Lock()
+	defer fe.hooksMu.Unlock()
+	fe.redaction = &redaction
+}
+
+// Redact redacts the text like the log records and the errors of the entity, for the logs of the application
+func (fe *FiskalEntity) Redact(text string) string {
+	fe.hooksMu.RLock()
+	defer fe.hooksMu.RUnlock()
+	return fe.redactionLocked().Redact(text)
+}
+
+// redactionLocked returns the redaction of the entity, hooksMu must be held
+func (fe *FiskalEntity) redactionLocked() Redaction {
+	if fe.redaction == nil {
+		return DefaultRedaction
+	}
+	return *fe.redaction
+}
+
+// redactedError is an error with the message redacted, wrapping the original error
+type redactedError struct {
+	message string
+	err     error
+}
+
+func (e *redactedError) Error() string { return e.message }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// redactError returns the error with the message redacted, a FiskalError stays a FiskalError
+func (fe *FiskalEntity) redactError(err error) error {
+	if err == nil || fe == nil {
+		return err
+	}
+	message := err.Error()
+	redacted := fe.Redact(message)
+	if redacted == message {
+		return err
+	}
+	if fErr, ok := err.(*FiskalError); ok {
+		copied := *fErr
+		copied.Message = redacted
+		return &copied
+	}
+	return &redactedError{message: redacted, err: err}
+}
+
+// The String and Format methods print the useful debug information of the invoices, the entity, the certificates
+// and the results with the OIBs masked (see redactOIB) and without the key material or the raw messages, so an
+// accidental %v or %+v in a log doesn't leak the personal data. Format applies to all verbs, %#v included.
+
+// formatRedacted writes the redacted text for any verb, quoted for %q
+func formatRedacted(f fmt.State, verb rune, text string) {
+	if verb == 'q' {
+		fmt.Fprintf(f, "%q", text)
+		return
+	}
+	io.WriteString(f, text)
+}
+
+// String describes the invoice with the OIBs masked
+func (invoice RacunType) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "invoice %s issued %s, total %s", invoiceNumber(&invoice), invoice.DatVrijeme, invoice.IznosUkupno)
+	if invoice.NacinPlac != "" {
+		fmt.Fprintf(&b, ", payment %s", invoice.NacinPlac)
+	}
+	fmt.Fprintf(&b, ", OIB %s, operator %s", redactOIB(invoice.Oib), redactOIB(invoice.OibOper))
+	if invoice.ZastKod != "" {
+		fmt.Fprintf(&b, ", ZKI %s", invoice.ZastKod)
+	}
+	if invoice.NakDost {
+		b.WriteString(", late delivery")
+	}
+	return b.String()
+}
+
+// Format prints the invoice like String for all verbs
+func (invoice RacunType) Format(f fmt.State, verb rune) {
+	formatRedacted(f, verb, invoice.String())
+}
+
+// String describes the entity and its certificate with the OIB masked
+func (fe *FiskalEntity) String() string {
+	if fe == nil {
+		return "<nil>"
+	}
+	text := fmt.Sprintf("fiscal entity OIB %s, location %s, demo %t", redactOIB(fe.oib), fe.locationID, fe.demoMode)
+	if cert := fe.certificate(); cert != nil && cert.publicCert != nil {
+		text += fmt.Sprintf(", certificate %s expires %s", cert.certSERIAL, cert.publicCert.NotAfter.Format("02.01.2006"))
+	}
+	return text
+}
+
+// Format prints the entity like String for all verbs
+func (fe *FiskalEntity) Format(f fmt.State, verb rune) {
+	formatRedacted(f, verb, fe.String())
+}
+
+// String describes the certificate without the key, with the OIB of the subject masked
+func (c Certificate) String() string {
+	if c.Cert == nil {
+		return "certificate <nil>"
+	}
+	org := c.Cert.Subject.Organization
+	subject := ""
+	if len(org) > 0 {
+		subject = org[0]
+	}
+	subject = redactOIBs(subject)
+	return fmt.Sprintf("certificate %s of %q, valid %s - %s", c.Serial(), subject,
+		c.Cert.NotBefore.Format("02.01.2006"), c.Cert.NotAfter.Format("02.01.2006"))
+}
+
+// Format prints the certificate like String for all verbs
+func (c Certificate) Format(f fmt.State, verb rune) {
+	formatRedacted(f, verb, c.String())
+}
+
+// String describes the result without the raw messages, which contain the OIBs
+func (r InvoiceResult) String() string {
+	text := fmt.Sprintf("invoice result JIR %q, ZKI %q, IdPoruke %q, status %d, duration %s", r.JIR, r.ZKI, r.IdPoruke, r.StatusCode, r.Duration)
+	if len(r.Request) > 0 || len(r.Response) > 0 {
+		text += fmt.Sprintf(", request %d bytes, response %d bytes", len(r.Request), len(r.Response))
+	}
+	if r.FromJournal {
+		text += ", from journal"
+	}
+	if len(r.Warnings) > 0 {
+		text += ", warnings: " + strings.Join(r.Warnings, "; ")
+	}
+	return text
+}
+
+// Format prints the result like String for all verbs
+func (r InvoiceResult) Format(f fmt.State, verb rune) {
+	formatRedacted(f, verb, r.String())
+}
@@ -0,0 +1,108 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedactedFormat(t *testing.T) {
+	fe := newTestEntity(t)
+	invoice, zki, err := fe.NewCISInvoice(time.Now(), 9, 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "10.00", CISCash, "12345678901")
+	if err != nil {
+		t.Fatalf("Failed to create invoice: %v", err)
+	}
+	cert := fe.CertProvider()
+	current, err := cert.GetCurrent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := InvoiceResult{JIR: "9d6f5bb6-da48-4fcd-a803-4586a025e0e4", ZKI: zki, Request: []byte("<tns:Oib>" + fe.OIB() + "</tns:Oib>")}
+
+	for name, value := range map[string]any{"invoice": invoice, "invoice value": *invoice, "entity": fe, "certificate": current, "result": result} {
+		for _, verb := range []string{"%v", "%+v", "%#v", "%s", "%q"} {
+			text := fmt.Sprintf(verb, value)
+			if strings.Contains(text, fe.OIB()) || strings.Contains(text, "12345678901") || strings.Contains(text, "PRIVATE") {
+				t.Errorf("%s printed with %s leaks data: %s", name, verb, text)
+			}
+		}
+	}
+	if text := invoice.String(); !strings.Contains(text, invoiceNumber(invoice)) || !strings.Contains(text, zki) || !strings.Contains(text, redactOIB(fe.OIB())) {
+		t.Errorf("Expected the debug information in %s", text)
+	}
+	if text := fe.String(); !strings.Contains(text, fe.LocationID()) || !strings.Contains(text, fe.GetCertSERIAL()) {
+		t.Errorf("Expected the debug information in %s", text)
+	}
+	var nilEntity *FiskalEntity
+	if text := fmt.Sprint(nilEntity); text != "<nil>" {
+		t.Errorf("Unexpected nil entity %s", text)
+	}
+}
+
+func TestRedaction(t *testing.T) {
+	subject := "CN=FISKAL 1,O=FIRMA D.O.O.,C=HR"
+	text := "certificate \"" + subject + "\" of 12345678901 (Ivo Ivić)"
+	r := Redaction{OIBs: true, CertificateSubjects: true, Custom: func(s string) string { return strings.ReplaceAll(s, "Ivo Ivić", "[operator]") }}
+	if got := r.Redact(text); got != `certificate "[certificate subject]" of 12*******01 ([operator])` {
+		t.Errorf("Unexpected redacted text: %s", got)
+	}
+	if got := DefaultRedaction.Redact("serial 123456789012345678, OIB HR12345678901"); got != "serial 123456789012345678, OIB HR12*******01" {
+		t.Errorf("Expected only the OIB masked, got %s", got)
+	}
+	if got := (Redaction{}).Redact(text); got != text {
+		t.Errorf("Expected the text unchanged without the rules, got %s", got)
+	}
+
+	fe := newTestEntity(t)
+	var buf bytes.Buffer
+	fe.SetLogger(slog.New(slog.NewTextHandler(&buf, nil)))
+	fe.SetRedaction(r)
+	fe.log(successLevel, "message for 12345678901", slog.String("subject", subject), slog.Group("buyer", slog.String("oib", "12345678901")))
+	out := buf.String()
+	if strings.Contains(out, "12345678901") || strings.Contains(out, fe.OIB()) || strings.Contains(out, "FIRMA") {
+		t.Errorf("The log leaks data:\n%s", out)
+	}
+	if !strings.Contains(out, "buyer.oib=12*******01") || !strings.Contains(out, `subject="[certificate subject]"`) {
+		t.Errorf("Expected the redacted attributes in the log, got:\n%s", out)
+	}
+
+	// Without the OIB rule the OIBs are logged as they are
+	buf.Reset()
+	fe.SetRedaction(Redaction{})
+	fe.log(successLevel, "message")
+	if !strings.Contains(buf.String(), "oib="+fe.OIB()) {
+		t.Errorf("Expected the OIB in the log, got:\n%s", buf.String())
+	}
+}
+
+func TestRedactError(t *testing.T) {
+	fe := newTestEntity(t)
+
+	fErr := newFiskalError(CategoryInput, fmt.Errorf("invalid OIB 12345678901: %w", ErrResponseTooLarge))
+	err := fe.redactError(fErr)
+	var redacted *FiskalError
+	if !errors.As(err, &redacted) || redacted.Category != CategoryInput || redacted.Message != "invalid OIB 12*******01: "+ErrResponseTooLarge.Error() {
+		t.Fatalf("Unexpected redacted FiskalError %#v", err)
+	}
+	if !errors.Is(err, ErrResponseTooLarge) || fErr.Message == redacted.Message {
+		t.Errorf("Expected the original error unchanged and wrapped")
+	}
+
+	err = fe.redactError(fmt.Errorf("buyer 12345678901: %w", ErrEInvoiceRejected))
+	if err.Error() != "buyer 12*******01: "+ErrEInvoiceRejected.Error() || !errors.Is(err, ErrEInvoiceRejected) {
+		t.Errorf("Unexpected redacted error %v", err)
+	}
+
+	plain := errors.New("nothing to redact")
+	if fe.redactError(plain) != plain || fe.redactError(nil) != nil {
+		t.Errorf("Expected the error returned as it is")
+	}
+}
@@ -0,0 +1,131 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	// The CIS time zone is loaded also on hosts without the time zone database
+	_ "time/tzdata"
+)
+
+// ErrStaleResponse is returned when the DatumVrijeme of the CIS response is too far from the time the request was sent
+var ErrStaleResponse = errors.New("stale CIS response")
+
+// ErrReplayedResponse is returned when a CIS response with the same IdPoruke was already accepted
+var ErrReplayedResponse = errors.New("replayed CIS response")
+
+const (
+	// defaultResponseMaxSkew is the default allowed difference between the request and the response time
+	defaultResponseMaxSkew = 15 * time.Minute
+
+	// minReplayWindow is how long the accepted IdPoruke values are kept at least, also when the freshness check is disabled
+	minReplayWindow = time.Hour
+
+	// maxReplayEntries limits the memory used by the accepted IdPoruke values
+	maxReplayEntries = 100000
+)
+
+// zaglavljeTimeLayout is the format of the DatumVrijeme in the message header
+const zaglavljeTimeLayout = "02.01.2006T15:04:05"
+
+// cisLocation is the time zone of the DatumVrijeme in the message headers, CIS uses the Croatian time
+// whatever the time zone of the host is
+var cisLocation = loadCISLocation()
+
+func loadCISLocation() *time.Location {
+	loc, err := time.LoadLocation("Europe/Zagreb")
+	if err != nil {
+		// Not possible with the embedded time zone database
+		panic(fmt.Sprintf("failed to load the CIS time zone: %v", err))
+	}
+	return loc
+}
+
+// responseGuard rejects the stale and the replayed CIS responses. The response DatumVrijeme (the CIS clock) must be
+// within maxSkew of the time the request was sent and the response received (the local clock), and the IdPoruke of
+// a response can be accepted only once.
+type responseGuard struct {
+	maxSkew time.Duration
+
+	mu    sync.Mutex
+	seen  map[string]time.Time
+	order []string
+}
+
+func newResponseGuard(maxSkew time.Duration) *responseGuard {
+	return &responseGuard{maxSkew: maxSkew, seen: make(map[string]time.Time)}
+}
+
+// check validates the response header against the time the request was sent and the response received (now).
+// The IdPoruke is not remembered, accept does that once the whole response is accepted.
+func (g *responseGuard) check(response *ZaglavljeOdgovorType, sent, now time.Time) error {
+	if g == nil {
+		return nil
+	}
+	if g.maxSkew > 0 {
+		responseTime, err := time.ParseInLocation(zaglavljeTimeLayout, response.DatumVrijeme, cisLocation)
+		if err != nil {
+			return fmt.Errorf("%w: invalid DatumVrijeme %q", ErrStaleResponse, response.DatumVrijeme)
+		}
+		// DatumVrijeme has no fraction of a second, so the send time is truncated too
+		if skew := sent.Truncate(time.Second).Sub(responseTime); skew > g.maxSkew {
+			return fmt.Errorf("%w: DatumVrijeme %s is %s before the request was sent", ErrStaleResponse, response.DatumVrijeme, skew)
+		}
+		if skew := responseTime.Sub(now); skew > g.maxSkew {
+			return fmt.Errorf("%w: DatumVrijeme %s is %s after the response was received", ErrStaleResponse, response.DatumVrijeme, skew)
+		}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.prune(now)
+	if _, ok := g.seen[response.IdPoruke]; ok {
+		return fmt.Errorf("%w: IdPoruke %s", ErrReplayedResponse, response.IdPoruke)
+	}
+	return nil
+}
+
+// accept remembers the IdPoruke of a response that passed all the checks, a response with the same IdPoruke is
+// rejected as replayed afterwards. A rejected response is not accepted, so the genuine response to the message
+// resent with the same IdPoruke (see MessageStore) is not taken for a replay.
+func (g *responseGuard) accept(response *ZaglavljeOdgovorType, now time.Time) error {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.prune(now)
+	// Checked again, a concurrent request may have accepted it since check
+	if _, ok := g.seen[response.IdPoruke]; ok {
+		return fmt.Errorf("%w: IdPoruke %s", ErrReplayedResponse, response.IdPoruke)
+	}
+	g.seen[response.IdPoruke] = now
+	g.order = append(g.order, response.IdPoruke)
+	return nil
+}
+
+// prune forgets the IdPoruke values older than the replay window, a replay of those is stale anyway
+func (g *responseGuard) prune(now time.Time) {
+	window := max(2*g.maxSkew, minReplayWindow)
+	drop := 0
+	for drop < len(g.order) && (now.Sub(g.seen[g.order[drop]]) > window || len(g.order)-drop >= maxReplayEntries) {
+		delete(g.seen, g.order[drop])
+		drop++
+	}
+	g.order = g.order[drop:]
+}
+
+// WithResponseMaxSkew sets the allowed difference between the DatumVrijeme of the CIS response and the time the request
+// was sent, 15 minutes by default. An older or newer response is rejected with ErrStaleResponse, zero disables the check.
+// The IdPoruke of an accepted response is always remembered, a replay is rejected with ErrReplayedResponse.
+func WithResponseMaxSkew(maxSkew time.Duration) Option {
+	return func(o *entityOptions) {
+		o.responseMaxSkew = maxSkew
+	}
+}
@@ -0,0 +1,162 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+func TestResponseGuard(t *testing.T) {
+	now := time.Date(2026, 3, 2, 10, 0, 0, 0, cisLocation)
+	response := func(id string, sent time.Time) *ZaglavljeOdgovorType {
+		return &ZaglavljeOdgovorType{IdPoruke: id, DatumVrijeme: sent.In(cisLocation).Format(zaglavljeTimeLayout)}
+	}
+
+	guard := newResponseGuard(defaultResponseMaxSkew)
+	fresh := response("f81d4fae-7dec-11d0-a765-00a0c91e6bf6", now.Add(2*time.Second))
+	if err := guard.check(fresh, now, now.Add(3*time.Second)); err != nil {
+		t.Fatalf("Expected a fresh response to be accepted, got %v", err)
+	}
+	// Only an accepted response is remembered
+	if err := guard.check(fresh, now, now.Add(3*time.Second)); err != nil {
+		t.Fatalf("Expected a checked response not to be remembered, got %v", err)
+	}
+	if err := guard.accept(fresh, now.Add(3*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := guard.accept(fresh, now.Add(3*time.Second)); !errors.Is(err, ErrReplayedResponse) {
+		t.Errorf("Expected ErrReplayedResponse when accepted twice, got %v", err)
+	}
+	if err := guard.check(response("f81d4fae-7dec-11d0-a765-00a0c91e6bf6", now.Add(2*time.Second)), now, now.Add(3*time.Second)); !errors.Is(err, ErrReplayedResponse) {
+		t.Errorf("Expected ErrReplayedResponse, got %v", err)
+	}
+	for name, sent := range map[string]time.Time{"old": now.Add(-time.Hour), "future": now.Add(20 * time.Minute)} {
+		if err := guard.check(response(name, sent), now, now.Add(time.Second)); !errors.Is(err, ErrStaleResponse) {
+			t.Errorf("%s: expected ErrStaleResponse, got %v", name, err)
+		}
+	}
+	if err := guard.check(&ZaglavljeOdgovorType{IdPoruke: "invalid"}, now, now); !errors.Is(err, ErrStaleResponse) {
+		t.Errorf("Expected ErrStaleResponse for a missing DatumVrijeme, got %v", err)
+	}
+
+	// A slow response is measured from the time the request was sent to the time the response was received
+	if err := guard.check(response("slow", now.Add(20*time.Minute)), now, now.Add(21*time.Minute)); err != nil {
+		t.Errorf("Expected a slow response to be accepted, got %v", err)
+	}
+
+	// The accepted IdPoruke values are forgotten after the replay window
+	later := now.Add(2 * minReplayWindow)
+	if err := guard.check(response("f81d4fae-7dec-11d0-a765-00a0c91e6bf6", later), later, later); err != nil {
+		t.Errorf("Expected the IdPoruke to be forgotten, got %v", err)
+	}
+
+	disabled := newResponseGuard(0)
+	if err := disabled.check(response("old", now.Add(-48*time.Hour)), now, now); err != nil {
+		t.Errorf("Expected the freshness check to be disabled, got %v", err)
+	}
+	disabled.accept(response("old", now), now)
+	if err := disabled.check(response("old", now), now, now); !errors.Is(err, ErrReplayedResponse) {
+		t.Errorf("Expected ErrReplayedResponse with the freshness check disabled, got %v", err)
+	}
+}
+
+// TestResponseGuardHostTimeZone checks the header times are Croatian on a host in another time zone (TZ=UTC)
+func TestResponseGuardHostTimeZone(t *testing.T) {
+	local := time.Local
+	time.Local = time.UTC
+	t.Cleanup(func() { time.Local = local })
+
+	// CIS stamps the response with the Croatian time, one or two hours ahead of UTC
+	key, cert := newTestCISSigningCert(t)
+	fe := newTestServerEntity(t, func(w http.ResponseWriter, r *http.Request) {
+		doc := etree.NewDocument()
+		if _, err := doc.ReadFrom(r.Body); err != nil {
+			t.Error(err)
+			return
+		}
+		sent := doc.FindElement("//DatumVrijeme").Text()
+		if parsed, err := time.ParseInLocation(zaglavljeTimeLayout, sent, cisLocation); err != nil || time.Since(parsed).Abs() > time.Minute {
+			t.Errorf("Expected the request DatumVrijeme in the Croatian time, got %s", sent)
+		}
+		stamp := time.Now().In(cisLocation).Format(zaglavljeTimeLayout)
+		response := fmt.Sprintf(testCISResponse, "G0x1", doc.FindElement("//IdPoruke").Text(), stamp, "9d6f5bb6-da48-4fcd-a803-4586a025e0e4")
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprint(w, signTestCISResponse(t, key, response, MakeC14N10RecCanonicalizer()))
+	})
+	fe.ciscert = newSignatureCheckCIScert(cert, fe.ciscert.SSLverifyPoll)
+
+	invoice, _, err := fe.NewCISInvoice(time.Now(), 1, 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "10.00", CISCash, "12345678901")
+	if err != nil {
+		t.Fatalf("Failed to create invoice: %v", err)
+	}
+	if jir, _, err := invoice.InvoiceRequest(); err != nil || jir == "" {
+		t.Fatalf("Expected the response in the Croatian time to be accepted, got %s, %v", jir, err)
+	}
+}
+
+func TestRejectedResponseThenResend(t *testing.T) {
+	key, cert := newTestCISSigningCert(t)
+	var idPoruke []string
+	fe := newTestServerEntity(t, func(w http.ResponseWriter, r *http.Request) {
+		doc := etree.NewDocument()
+		if _, err := doc.ReadFrom(r.Body); err != nil {
+			t.Error(err)
+			return
+		}
+		idPoruke = append(idPoruke, doc.FindElement("//IdPoruke").Text())
+		// The first response has an invalid JIR, the outcome is unknown and the message stays in flight
+		jir := "9d6f5bb6-da48-4fcd-a803-4586a025e0e4"
+		if len(idPoruke) == 1 {
+			jir = "not-a-jir"
+		}
+		response := fmt.Sprintf(testCISResponse, "G0x1", doc.FindElement("//IdPoruke").Text(), doc.FindElement("//DatumVrijeme").Text(), jir)
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprint(w, signTestCISResponse(t, key, response, MakeC14N10RecCanonicalizer()))
+	})
+	fe.ciscert = newSignatureCheckCIScert(cert, fe.ciscert.SSLverifyPoll)
+	fe.SetMessageStore(NewMemoryMessageStore())
+
+	invoice, _, err := fe.NewCISInvoice(time.Now(), 1, 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "10.00", CISCash, "12345678901")
+	if err != nil {
+		t.Fatalf("Failed to create invoice: %v", err)
+	}
+	var fErr *FiskalError
+	if _, _, err := invoice.InvoiceRequest(); !errors.As(err, &fErr) || fErr.Category != CategoryOutcomeUnknown {
+		t.Fatalf("Expected the invalid JIR to be rejected, got %v", err)
+	}
+
+	// The resend has the same IdPoruke, its genuine response is not taken for a replay of the rejected one
+	jir, _, err := invoice.InvoiceRequest()
+	if err != nil || jir != "9d6f5bb6-da48-4fcd-a803-4586a025e0e4" {
+		t.Fatalf("Expected the resent invoice to be fiscalized, got %s %v", jir, err)
+	}
+	if len(idPoruke) != 2 || idPoruke[0] != idPoruke[1] {
+		t.Errorf("Expected the resend with the original IdPoruke, got %v", idPoruke)
+	}
+}
+
+func TestWithResponseMaxSkew(t *testing.T) {
+	key, cert, _ := newP12TestCert(t, testOIB)
+	fe, err := NewFiskalEntityWithOptions(testOIB, WithLocation("SKEW1"), WithSigner(key, cert), WithChainVerification(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fe.responseGuard.maxSkew != defaultResponseMaxSkew {
+		t.Errorf("Expected the default max skew, got %s", fe.responseGuard.maxSkew)
+	}
+	fe, err = NewFiskalEntityWithOptions(testOIB, WithLocation("SKEW1"), WithSigner(key, cert), WithChainVerification(false), WithResponseMaxSkew(time.Minute))
+	if err != nil || fe.responseGuard.maxSkew != time.Minute {
+		t.Errorf("Expected the max skew to be set, got %v", err)
+	}
+	if _, err := NewFiskalEntityWithOptions(testOIB, WithLocation("SKEW1"), WithSigner(key, cert), WithResponseMaxSkew(-time.Minute)); err == nil {
+		t.Error("Expected an error for a negative max skew")
+	}
+}
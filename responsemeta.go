@@ -0,0 +1,28 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"log/slog"
+
+	"github.com/l-d-t/fiskalhrgo/client"
+)
+
+// ResponseMetadata describes the HTTP response of CIS and the TLS connection it came over, see client.ResponseMetadata.
+// The support of APIS-IT (the CIS operator) asks for these details when a connectivity issue is escalated, so they
+// are kept with the results (InvoiceResult, MessageResult), the exchanges (Exchange) and the archived messages.
+type ResponseMetadata = client.ResponseMetadata
+
+// metadataLogAttrs returns the log attributes of the TLS connection
+func metadataLogAttrs(m *ResponseMetadata) []slog.Attr {
+	if m == nil || m.TLSVersion == "" {
+		return nil
+	}
+	return []slog.Attr{
+		slog.String("tls_version", m.TLSVersion),
+		slog.String("cipher_suite", m.CipherSuite),
+		slog.String("server_cert_serial", m.ServerCertSerial),
+	}
+}
@@ -0,0 +1,62 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResponseMetadata(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "cis-123")
+		w.Header().Set("Set-Cookie", "session=secret")
+		echoHandler(w, r)
+	}))
+	defer server.Close()
+
+	fe := newTestEntity(t)
+	fe.url = server.URL
+	if err := fe.AddTrustedRoot(server.Certificate()); err != nil {
+		t.Fatalf("Failed to add trusted root: %v", err)
+	}
+	var buf bytes.Buffer
+	fe.SetLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	var meta *ResponseMetadata
+	fe.SetExchangeHook(func(exchange *Exchange) { meta = exchange.Metadata })
+
+	if _, err := fe.EchoRequest("metadata"); err != nil {
+		t.Fatalf("EchoRequest failed: %v", err)
+	}
+	if meta == nil {
+		t.Fatal("Expected the response metadata in the exchange")
+	}
+	if meta.Header.Get("X-Request-Id") != "cis-123" || meta.Header.Get("Set-Cookie") != "" || meta.Proto == "" {
+		t.Errorf("Unexpected response headers %v %s", meta.Header, meta.Proto)
+	}
+	if !strings.HasPrefix(meta.TLSVersion, "TLS 1.") || meta.CipherSuite == "" {
+		t.Errorf("Unexpected TLS %q %q", meta.TLSVersion, meta.CipherSuite)
+	}
+	if serial := server.Certificate().SerialNumber.String(); meta.ServerCertSerial != serial || meta.ServerCertSubject == "" {
+		t.Errorf("Expected the server certificate %s, got %q %q", serial, meta.ServerCertSerial, meta.ServerCertSubject)
+	}
+	if !strings.Contains(buf.String(), "server_cert_serial="+meta.ServerCertSerial) {
+		t.Errorf("Expected the TLS details in the log, got:\n%s", buf.String())
+	}
+
+	// The transports not based on HTTP have no metadata
+	meta = &ResponseMetadata{}
+	fe.SetTransport(&staticTransport{resp: &TransportResponse{StatusCode: http.StatusOK, Body: []byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><tns:EchoResponse xmlns:tns="http://www.apis-it.hr/fin/2012/types/f73">relayed</tns:EchoResponse></soap:Body></soap:Envelope>`)}})
+	if _, err := fe.EchoRequest("relayed"); err != nil {
+		t.Fatalf("EchoRequest failed: %v", err)
+	}
+	if meta != nil {
+		t.Errorf("Expected no metadata from a custom transport, got %+v", meta)
+	}
+}
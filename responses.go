@@ -0,0 +1,166 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// ParseRacunOdgovor parses a stored CIS invoice response, either the complete SOAP envelope as received from CIS
+// (e.g. ArchivedMessage.Response) or just the RacunOdgovor element, so archived responses can be reprocessed later,
+// e.g. to backfill the JIRs. A SOAP Fault is returned as *SOAPFaultError.
+// The signature is not verified, only parse responses that were verified when they were received.
+func ParseRacunOdgovor(data []byte) (*RacunOdgovor, error) {
+	content, err := responseContent(data)
+	if err != nil {
+		return nil, err
+	}
+	var racunOdgovor RacunOdgovor
+	if err := xml.Unmarshal(content, &racunOdgovor); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal RacunOdgovor: %w", err)
+	}
+	return &racunOdgovor, nil
+}
+
+// ParseGreske returns the errors (Greske) from a stored CIS response of any message type, the SOAP envelope or just
+// the response element, with the messages in the language. It returns nil if the response has no errors.
+func ParseGreske(data []byte, lang Language) (CISErrors, error) {
+	content, err := responseContent(data)
+	if err != nil {
+		return nil, err
+	}
+	var response struct {
+		Greske *GreskeType `xml:"Greske"`
+	}
+	if err := xml.Unmarshal(content, &response); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal CIS response: %w", err)
+	}
+	if cisErrors, ok := newCISErrors(response.Greske, lang).(CISErrors); ok {
+		return cisErrors, nil
+	}
+	return nil, nil
+}
+
+// responseContent returns the content of the SOAP Body if the data is a SOAP envelope, otherwise the data itself
+func responseContent(data []byte) ([]byte, error) {
+	content := data
+	if body, err := soapBodyContent(data); err == nil {
+		content = body
+	}
+	if fault := parseSOAPFault(content, 0); fault != nil {
+		return nil, fault
+	}
+	return content, nil
+}
+
+// HasErrors reports whether there is at least one error, it is false for a nil GreskeType
+func (g *GreskeType) HasErrors() bool {
+	return len(g.Errors()) > 0
+}
+
+// Errors returns the errors, skipping the empty Greska elements. It returns nil for a nil GreskeType,
+// so the errors of a response can be ranged over without nil checks.
+func (g *GreskeType) Errors() []GreskaType {
+	if g == nil {
+		return nil
+	}
+	var errs []GreskaType
+	for _, greska := range g.Greska {
+		if greska != nil {
+			errs = append(errs, *greska)
+		}
+	}
+	return errs
+}
+
+// FirstErrorCode returns the code (SifraGreske) of the first error, e.g. "s006", or "" if there are no errors
+func (g *GreskeType) FirstErrorCode() string {
+	if errs := g.Errors(); len(errs) > 0 {
+		return strings.TrimSpace(errs[0].SifraGreske)
+	}
+	return ""
+}
+
+// HasErrors reports whether CIS returned errors, it is false for a nil response
+func (o *RacunOdgovor) HasErrors() bool { return o.greske().HasErrors() }
+
+// Errors returns the errors returned by CIS, nil for a nil response or a response without errors
+func (o *RacunOdgovor) Errors() []GreskaType { return o.greske().Errors() }
+
+// FirstErrorCode returns the code of the first error returned by CIS, "" if there are none
+func (o *RacunOdgovor) FirstErrorCode() string { return o.greske().FirstErrorCode() }
+
+func (o *RacunOdgovor) greske() *GreskeType {
+	if o == nil {
+		return nil
+	}
+	return o.Greske
+}
+
+// HasErrors reports whether CIS returned errors, it is false for a nil response
+func (o *PrateciDokumentiOdgovor) HasErrors() bool { return o.greske().HasErrors() }
+
+// Errors returns the errors returned by CIS, nil for a nil response or a response without errors
+func (o *PrateciDokumentiOdgovor) Errors() []GreskaType { return o.greske().Errors() }
+
+// FirstErrorCode returns the code of the first error returned by CIS, "" if there are none
+func (o *PrateciDokumentiOdgovor) FirstErrorCode() string { return o.greske().FirstErrorCode() }
+
+func (o *PrateciDokumentiOdgovor) greske() *GreskeType {
+	if o == nil {
+		return nil
+	}
+	return o.Greske
+}
+
+// HasErrors reports whether CIS returned errors, it is false for a nil response
+func (o *RacunPDOdgovor) HasErrors() bool { return o.greske().HasErrors() }
+
+// Errors returns the errors returned by CIS, nil for a nil response or a response without errors
+func (o *RacunPDOdgovor) Errors() []GreskaType { return o.greske().Errors() }
+
+// FirstErrorCode returns the code of the first error returned by CIS, "" if there are none
+func (o *RacunPDOdgovor) FirstErrorCode() string { return o.greske().FirstErrorCode() }
+
+func (o *RacunPDOdgovor) greske() *GreskeType {
+	if o == nil {
+		return nil
+	}
+	return o.Greske
+}
+
+// HasErrors reports whether CIS returned errors, it is false for a nil response
+func (o *PromijeniNacPlacOdgovor) HasErrors() bool { return o.greske().HasErrors() }
+
+// Errors returns the errors returned by CIS, nil for a nil response or a response without errors
+func (o *PromijeniNacPlacOdgovor) Errors() []GreskaType { return o.greske().Errors() }
+
+// FirstErrorCode returns the code of the first error returned by CIS, "" if there are none
+func (o *PromijeniNacPlacOdgovor) FirstErrorCode() string { return o.greske().FirstErrorCode() }
+
+func (o *PromijeniNacPlacOdgovor) greske() *GreskeType {
+	if o == nil {
+		return nil
+	}
+	return o.Greske
+}
+
+// HasErrors reports whether CIS returned errors, it is false for a nil response
+func (o *NapojnicaOdgovor) HasErrors() bool { return o.greske().HasErrors() }
+
+// Errors returns the errors returned by CIS, nil for a nil response or a response without errors
+func (o *NapojnicaOdgovor) Errors() []GreskaType { return o.greske().Errors() }
+
+// FirstErrorCode returns the code of the first error returned by CIS, "" if there are none
+func (o *NapojnicaOdgovor) FirstErrorCode() string { return o.greske().FirstErrorCode() }
+
+func (o *NapojnicaOdgovor) greske() *GreskeType {
+	if o == nil {
+		return nil
+	}
+	return o.Greske
+}
@@ -0,0 +1,92 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestParseRacunOdgovor(t *testing.T) {
+	envelope := fmt.Sprintf(testCISResponse, "G0x1", "f81d4fae-7dec-11d0-a765-00a0c91e6bf6", "01.01.2026T10:00:00", "9d6f5bb6-da48-4fcd-a803-4586a025e0e4")
+	message := `<tns:RacunOdgovor xmlns:tns="http://www.apis-it.hr/fin/2012/types/f73" Id="G0x1"><tns:Zaglavlje><tns:IdPoruke>f81d4fae-7dec-11d0-a765-00a0c91e6bf6</tns:IdPoruke><tns:DatumVrijeme>01.01.2026T10:00:00</tns:DatumVrijeme></tns:Zaglavlje><tns:Jir>9d6f5bb6-da48-4fcd-a803-4586a025e0e4</tns:Jir></tns:RacunOdgovor>`
+
+	for name, data := range map[string]string{"envelope": envelope, "message": message} {
+		odgovor, err := ParseRacunOdgovor([]byte(data))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if odgovor.Jir != "9d6f5bb6-da48-4fcd-a803-4586a025e0e4" || odgovor.Zaglavlje == nil || odgovor.Zaglavlje.IdPoruke != "f81d4fae-7dec-11d0-a765-00a0c91e6bf6" {
+			t.Errorf("%s: unexpected response %+v", name, odgovor)
+		}
+		if cisErrors, err := ParseGreske([]byte(data), LangHR); err != nil || cisErrors != nil {
+			t.Errorf("%s: expected no errors, got %v %v", name, cisErrors, err)
+		}
+	}
+
+	fault := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault><faultcode>soap:Server</faultcode><faultstring>Internal error</faultstring></soap:Fault></soap:Body></soap:Envelope>`
+	var faultErr *SOAPFaultError
+	if _, err := ParseRacunOdgovor([]byte(fault)); !errors.As(err, &faultErr) || faultErr.String != "Internal error" {
+		t.Errorf("Expected the SOAP fault, got %v", err)
+	}
+	if _, err := ParseRacunOdgovor([]byte(`<EchoResponse>test</EchoResponse>`)); err == nil {
+		t.Error("Expected an error for another message")
+	}
+}
+
+func TestParseGreske(t *testing.T) {
+	response := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><tns:PrateciDokumentiOdgovor xmlns:tns="http://www.apis-it.hr/fin/2012/types/f73" Id="G0x1"><tns:Greske>
+	<tns:Greska><tns:SifraGreske>s004</tns:SifraGreske><tns:PorukaGreske>Neispravan digitalni potpis.</tns:PorukaGreske></tns:Greska>
+	<tns:Greska><tns:SifraGreske>v100</tns:SifraGreske><tns:PorukaGreske>Neispravan OIB.</tns:PorukaGreske></tns:Greska>
+	</tns:Greske></tns:PrateciDokumentiOdgovor></soap:Body></soap:Envelope>`
+
+	cisErrors, err := ParseGreske([]byte(response), LangEN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cisErrors) != 2 || cisErrors[0].Code != "s004" || cisErrors[1].Original != "Neispravan OIB." {
+		t.Fatalf("Unexpected errors %v", cisErrors)
+	}
+	if cisErrors[0].Message == cisErrors[0].Original {
+		t.Errorf("Expected the message in English, got %s", cisErrors[0].Message)
+	}
+	if _, err := ParseGreske([]byte("<invalid"), LangHR); err == nil {
+		t.Error("Expected an error for invalid XML")
+	}
+}
+
+func TestResponseErrorAccessors(t *testing.T) {
+	var nilOdgovor *RacunOdgovor
+	if nilOdgovor.HasErrors() || nilOdgovor.Errors() != nil || nilOdgovor.FirstErrorCode() != "" {
+		t.Error("Expected no errors for a nil response")
+	}
+	if (&RacunOdgovor{}).HasErrors() || (&NapojnicaOdgovor{Greske: &GreskeType{}}).HasErrors() {
+		t.Error("Expected no errors for a response without Greske")
+	}
+
+	odgovor := &RacunOdgovor{Greske: &GreskeType{Greska: []*GreskaType{
+		nil,
+		{SifraGreske: " s006 ", PorukaGreske: "Sistemska pogreška"},
+		{SifraGreske: "v100", PorukaGreske: "Neispravan OIB"},
+	}}}
+	if !odgovor.HasErrors() {
+		t.Error("Expected errors")
+	}
+	if errs := odgovor.Errors(); len(errs) != 2 || errs[1].SifraGreske != "v100" {
+		t.Errorf("Unexpected errors %+v", errs)
+	}
+	if code := odgovor.FirstErrorCode(); code != "s006" {
+		t.Errorf("Expected s006, got %q", code)
+	}
+
+	var promjena *PromijeniNacPlacOdgovor
+	var napojnica *NapojnicaOdgovor
+	var prateci *PrateciDokumentiOdgovor
+	var pd *RacunPDOdgovor
+	if promjena.HasErrors() || napojnica.FirstErrorCode() != "" || prateci.Errors() != nil || pd.HasErrors() {
+		t.Error("Expected no errors for nil responses")
+	}
+}
@@ -0,0 +1,340 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// ErrCertificateRevoked is returned when the certificate was revoked by FINA
+var ErrCertificateRevoked = errors.New("certificate revoked")
+
+// RevocationStatus is the revocation status of the certificate
+type RevocationStatus string
+
+const (
+	RevocationGood    RevocationStatus = "good"
+	RevocationRevoked RevocationStatus = "revoked"
+
+	// RevocationUnknown means neither the OCSP responder nor the CRL could tell the status
+	RevocationUnknown RevocationStatus = "unknown"
+)
+
+// Sources of the revocation status
+const (
+	RevocationSourceOCSP = "ocsp"
+	RevocationSourceCRL  = "crl"
+)
+
+// defaultRevocationCacheTTL is how long a good status is cached if the response doesn't say otherwise
+const defaultRevocationCacheTTL = time.Hour
+
+// maxCRLSize limits the size of the downloaded CRL, FINA CRLs are a few MB
+const maxCRLSize = 32 << 20
+
+// RevocationConfig configures the revocation checking of the fiscal certificate
+type RevocationConfig struct {
+	// HTTPClient is used for the OCSP and CRL requests, nil means a client with a 10 second timeout
+	HTTPClient *http.Client
+
+	// CacheTTL is the longest time a good status is cached, 1 hour if zero. The status is checked
+	// again earlier if the OCSP response or the CRL has an earlier next update.
+	CacheTTL time.Duration
+}
+
+// RevocationResult is the revocation status of a certificate
+type RevocationResult struct {
+	Serial string
+	Status RevocationStatus
+
+	// Source is RevocationSourceOCSP or RevocationSourceCRL, empty if the status is unknown
+	Source string
+
+	// RevokedAt and Reason (RFC 5280 reason code) are set for a revoked certificate
+	RevokedAt time.Time
+	Reason    int
+
+	// CheckedAt is when the status was obtained, NextUpdate when the issuer publishes the next one (may be zero)
+	CheckedAt  time.Time
+	NextUpdate time.Time
+}
+
+// revocationChecker checks the revocation status over OCSP and CRL and caches the results per serial number
+type revocationChecker struct {
+	client *http.Client
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedRevocation
+}
+
+type cachedRevocation struct {
+	result  RevocationResult
+	expires time.Time
+}
+
+func newRevocationChecker(cfg RevocationConfig) *revocationChecker {
+	c := &revocationChecker{client: cfg.HTTPClient, ttl: cfg.CacheTTL, cache: make(map[string]cachedRevocation)}
+	if c.client == nil {
+		c.client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if c.ttl <= 0 {
+		c.ttl = defaultRevocationCacheTTL
+	}
+	return c
+}
+
+// SetRevocationCheck enables checking the revocation of the certificate against the FINA OCSP responder
+// and CRL, nil disables it. When enabled, a revoked certificate is rejected when it is loaded, reloaded
+// or rotated, and Preflight reports the revocation status. An unreachable OCSP responder and CRL don't
+// block fiscalization, they are logged and reported as a Preflight warning.
+func (fe *FiskalEntity) SetRevocationCheck(cfg *RevocationConfig) {
+	var checker *revocationChecker
+	if cfg != nil {
+		checker = newRevocationChecker(*cfg)
+	}
+	fe.certMu.Lock()
+	defer fe.certMu.Unlock()
+	fe.revocation = checker
+}
+
+// revocationChecker returns the checker if the revocation checking is enabled
+func (fe *FiskalEntity) revocationChecker() *revocationChecker {
+	fe.certMu.RLock()
+	defer fe.certMu.RUnlock()
+	return fe.revocation
+}
+
+// CheckRevocation checks whether the current certificate was revoked, first with the OCSP responder
+// and then with the CRL from the certificate. The issuer certificate must be in the P12 bundle (or
+// given as a CA certificate to WithSigner) to verify the responses. Results are cached, see RevocationConfig.
+// It works without SetRevocationCheck too, with the default settings and without the cache.
+func (fe *FiskalEntity) CheckRevocation(ctx context.Context) (*RevocationResult, error) {
+	cm := fe.certificate()
+	if cm == nil || cm.publicCert == nil {
+		return nil, errors.New("certificate not loaded")
+	}
+	checker := fe.revocationChecker()
+	if checker == nil {
+		checker = newRevocationChecker(RevocationConfig{})
+	}
+	return checker.check(ctx, cm.publicCert, cm.caCerts)
+}
+
+// checkNotRevoked returns ErrCertificateRevoked if the revocation checking is enabled and the certificate
+// was revoked. A failed check is only logged, FINA being unreachable must not stop the fiscalization.
+func (fe *FiskalEntity) checkNotRevoked(cm *certManager) error {
+	checker := fe.revocationChecker()
+	if checker == nil {
+		return nil
+	}
+	result, err := checker.check(context.Background(), cm.publicCert, cm.caCerts)
+	if err != nil {
+		fe.log(failureLevel, "certificate revocation check failed", append(errorAttrs(err), slog.String("serial", cm.certSERIAL))...)
+		return nil
+	}
+	if result.Status == RevocationRevoked {
+		fe.log(failureLevel, "certificate revoked", slog.String("serial", result.Serial), slog.Time("revoked_at", result.RevokedAt))
+		return fmt.Errorf("%w: serial %s revoked on %s", ErrCertificateRevoked, result.Serial, result.RevokedAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// check returns the revocation status of the certificate, from the cache if it's still valid
+func (c *revocationChecker) check(ctx context.Context, cert *x509.Certificate, caCerts []*x509.Certificate) (*RevocationResult, error) {
+	serial := cert.SerialNumber.String()
+	now := time.Now()
+
+	c.mu.Lock()
+	cached, ok := c.cache[serial]
+	c.mu.Unlock()
+	if ok && (cached.expires.IsZero() || now.Before(cached.expires)) {
+		result := cached.result
+		return &result, nil
+	}
+
+	issuer := findIssuer(cert, caCerts)
+	if issuer == nil {
+		return nil, fmt.Errorf("issuer certificate of %s not found", cert.Issuer)
+	}
+	if len(cert.OCSPServer) == 0 && len(cert.CRLDistributionPoints) == 0 {
+		return nil, errors.New("the certificate has no OCSP responder or CRL distribution point")
+	}
+
+	var errs []error
+	var result *RevocationResult
+	for _, server := range cert.OCSPServer {
+		res, err := c.checkOCSP(ctx, server, cert, issuer)
+		if err == nil && res.Status != RevocationUnknown {
+			result = res
+			break
+		}
+		if err == nil {
+			err = errors.New("the responder doesn't know the certificate")
+		}
+		errs = append(errs, fmt.Errorf("OCSP %s: %w", server, err))
+	}
+	for _, url := range cert.CRLDistributionPoints {
+		if result != nil {
+			break
+		}
+		res, err := c.checkCRL(ctx, url, cert, issuer)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("CRL %s: %w", url, err))
+			continue
+		}
+		result = res
+	}
+	if result == nil {
+		return &RevocationResult{Serial: serial, Status: RevocationUnknown, CheckedAt: now}, errors.Join(errs...)
+	}
+
+	// A revocation is final, a good status is checked again after the TTL or the next update
+	expires := time.Time{}
+	if result.Status == RevocationGood {
+		expires = now.Add(c.ttl)
+		if !result.NextUpdate.IsZero() && result.NextUpdate.Before(expires) {
+			expires = result.NextUpdate
+		}
+	}
+	c.mu.Lock()
+	c.cache[serial] = cachedRevocation{result: *result, expires: expires}
+	c.mu.Unlock()
+
+	return result, nil
+}
+
+// checkOCSP asks the OCSP responder for the status, the response must be signed by the issuer or its delegated responder
+func (c *revocationChecker) checkOCSP(ctx context.Context, server string, cert *x509.Certificate, issuer *x509.Certificate) (*RevocationResult, error) {
+	reqBytes, err := ocsp.CreateRequest(cert, issuer, &ocsp.RequestOptions{Hash: crypto.SHA1})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, server, bytes.NewReader(reqBytes))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/ocsp-request")
+	req.Header.Set("Accept", "application/ocsp-response")
+
+	body, err := c.fetch(req, 1<<20)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := ocsp.ParseResponseForCert(body, cert, issuer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+
+	now := time.Now()
+	if !resp.NextUpdate.IsZero() && now.After(resp.NextUpdate) {
+		return nil, fmt.Errorf("stale response, next update was %s", resp.NextUpdate.Format(time.RFC3339))
+	}
+
+	result := &RevocationResult{
+		Serial:     cert.SerialNumber.String(),
+		Source:     RevocationSourceOCSP,
+		CheckedAt:  now,
+		NextUpdate: resp.NextUpdate,
+	}
+	switch resp.Status {
+	case ocsp.Good:
+		result.Status = RevocationGood
+	case ocsp.Revoked:
+		result.Status = RevocationRevoked
+		result.RevokedAt = resp.RevokedAt
+		result.Reason = resp.RevocationReason
+	default:
+		result.Status = RevocationUnknown
+	}
+	return result, nil
+}
+
+// checkCRL downloads the CRL, verifies it was signed by the issuer and looks for the certificate serial number
+func (c *revocationChecker) checkCRL(ctx context.Context, url string, cert *x509.Certificate, issuer *x509.Certificate) (*RevocationResult, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.fetch(req, maxCRLSize)
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(body); block != nil {
+		body = block.Bytes
+	}
+	crl, err := x509.ParseRevocationList(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CRL: %w", err)
+	}
+	if err := crl.CheckSignatureFrom(issuer); err != nil {
+		return nil, fmt.Errorf("CRL signature: %w", err)
+	}
+
+	now := time.Now()
+	if !crl.NextUpdate.IsZero() && now.After(crl.NextUpdate) {
+		return nil, fmt.Errorf("stale CRL, next update was %s", crl.NextUpdate.Format(time.RFC3339))
+	}
+
+	result := &RevocationResult{
+		Serial:     cert.SerialNumber.String(),
+		Status:     RevocationGood,
+		Source:     RevocationSourceCRL,
+		CheckedAt:  now,
+		NextUpdate: crl.NextUpdate,
+	}
+	for _, entry := range crl.RevokedCertificateEntries {
+		if entry.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+			result.Status = RevocationRevoked
+			result.RevokedAt = entry.RevocationTime
+			result.Reason = entry.ReasonCode
+			break
+		}
+	}
+	return result, nil
+}
+
+// fetch sends the request and reads at most limit bytes of the successful response
+func (c *revocationChecker) fetch(req *http.Request, limit int64) ([]byte, error) {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, fmt.Errorf("response larger than %d bytes", limit)
+	}
+	return body, nil
+}
+
+// findIssuer returns the CA certificate that issued the certificate, nil if it's not among the CA certificates
+func findIssuer(cert *x509.Certificate, caCerts []*x509.Certificate) *x509.Certificate {
+	for _, ca := range caCerts {
+		if bytes.Equal(ca.RawSubject, cert.RawIssuer) && cert.CheckSignatureFrom(ca) == nil {
+			return ca
+		}
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// revocationServer is a FINA like OCSP responder and CRL distribution point, when revoked is set
+// all the certificates it issued are revoked
+type revocationServer struct {
+	caKey  *rsa.PrivateKey
+	caCert *x509.Certificate
+
+	mu        sync.Mutex
+	issued    []*big.Int
+	revoked   bool
+	ocspFails bool
+	crlFails  bool
+	ocspCalls int
+	crlCalls  int
+	revokedAt time.Time
+	serverURL string
+}
+
+func newRevocationServer(t *testing.T) *revocationServer {
+	t.Helper()
+	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Fina RDC", Country: []string{"HR"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, _ := x509.ParseCertificate(caDER)
+
+	s := &revocationServer{caKey: caKey, caCert: caCert, revokedAt: time.Now().Add(-time.Hour).Truncate(time.Second)}
+	httpServer := httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(httpServer.Close)
+	s.serverURL = httpServer.URL
+	return s
+}
+
+// issue creates a fiscal certificate with the OCSP and CRL endpoints of the server
+func (s *revocationServer) issue(t *testing.T, oib string) *Certificate {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "FISKAL 1", Organization: []string{"TEST D.O.O. HR" + oib}, Country: []string{"HR"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		OCSPServer:            []string{s.serverURL + "/ocsp"},
+		CRLDistributionPoints: []string{s.serverURL + "/crl"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, s.caCert, &key.PublicKey, s.caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	s.mu.Lock()
+	s.issued = append(s.issued, cert.SerialNumber)
+	s.mu.Unlock()
+	return &Certificate{Signer: key, Cert: cert, CACerts: []*x509.Certificate{s.caCert}}
+}
+
+func (s *revocationServer) set(revoked bool, ocspFails bool, crlFails bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revoked, s.ocspFails, s.crlFails = revoked, ocspFails, crlFails
+}
+
+func (s *revocationServer) calls() (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ocspCalls, s.crlCalls
+}
+
+func (s *revocationServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().Truncate(time.Second)
+
+	switch r.URL.Path {
+	case "/ocsp":
+		s.ocspCalls++
+		if s.ocspFails {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		req, err := ocsp.ParseRequest(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		template := ocsp.Response{Status: ocsp.Good, SerialNumber: req.SerialNumber, ThisUpdate: now, NextUpdate: now.Add(time.Hour)}
+		if s.revoked {
+			template.Status, template.RevokedAt, template.RevocationReason = ocsp.Revoked, s.revokedAt, ocsp.KeyCompromise
+		}
+		resp, err := ocsp.CreateResponse(s.caCert, s.caCert, template, s.caKey)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		w.Write(resp)
+	case "/crl":
+		s.crlCalls++
+		if s.crlFails {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		template := &x509.RevocationList{Number: big.NewInt(int64(s.crlCalls)), ThisUpdate: now, NextUpdate: now.Add(time.Hour)}
+		if s.revoked {
+			for _, serial := range s.issued {
+				template.RevokedCertificateEntries = append(template.RevokedCertificateEntries,
+					x509.RevocationListEntry{SerialNumber: serial, RevocationTime: s.revokedAt, ReasonCode: ocsp.KeyCompromise})
+			}
+		}
+		crl, err := x509.CreateRevocationList(rand.Reader, template, s.caCert, s.caKey)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(crl)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestCheckRevocationOCSP(t *testing.T) {
+	srv := newRevocationServer(t)
+	cert := srv.issue(t, testOIB)
+	fe, err := NewFiskalEntityWithOptions(testOIB, WithLocation("REVOC1"), WithSigner(cert.Signer, cert.Cert, cert.CACerts...),
+		WithChainVerification(false), WithRevocationCheck(RevocationConfig{}))
+	if err != nil {
+		t.Fatalf("Failed to create entity: %v", err)
+	}
+
+	result, err := fe.CheckRevocation(context.Background())
+	if err != nil || result.Status != RevocationGood || result.Source != RevocationSourceOCSP || result.Serial != cert.Serial() {
+		t.Fatalf("Expected a good OCSP status, got %+v %v", result, err)
+	}
+	if ocspCalls, _ := srv.calls(); ocspCalls != 1 {
+		t.Errorf("Expected the status from the entity creation to be cached, got %d OCSP calls", ocspCalls)
+	}
+
+	srv.set(true, false, false)
+	fe.SetRevocationCheck(&RevocationConfig{})
+	result, err = fe.CheckRevocation(context.Background())
+	if err != nil || result.Status != RevocationRevoked || !result.RevokedAt.Equal(srv.revokedAt) || result.Reason != ocsp.KeyCompromise {
+		t.Fatalf("Expected a revoked status, got %+v %v", result, err)
+	}
+	if check := fe.preflightRevocation(); check.Status != PreflightFailed || !errors.Is(check.Err, ErrCertificateRevoked) {
+		t.Errorf("Expected the preflight check to fail, got %+v", check)
+	}
+
+	// The renewed certificate is checked before it replaces the revoked one
+	if err := fe.replaceCertificate(srv.issue(t, testOIB), nil); !errors.Is(err, ErrCertificateRevoked) {
+		t.Errorf("Expected a revoked certificate to be rejected, got %v", err)
+	}
+
+	if _, err := NewFiskalEntityWithOptions(testOIB, WithLocation("REVOC1"), WithSigner(cert.Signer, cert.Cert, cert.CACerts...),
+		WithChainVerification(false), WithRevocationCheck(RevocationConfig{})); !errors.Is(err, ErrCertificateRevoked) {
+		t.Errorf("Expected the entity creation to fail with a revoked certificate, got %v", err)
+	}
+}
+
+func TestCheckRevocationCRLFallback(t *testing.T) {
+	srv := newRevocationServer(t)
+	cert := srv.issue(t, testOIB)
+	srv.set(false, true, false)
+
+	checker := newRevocationChecker(RevocationConfig{CacheTTL: time.Nanosecond})
+	result, err := checker.check(context.Background(), cert.Cert, cert.CACerts)
+	if err != nil || result.Status != RevocationGood || result.Source != RevocationSourceCRL {
+		t.Fatalf("Expected a good CRL status, got %+v %v", result, err)
+	}
+
+	srv.set(true, true, false)
+	result, err = checker.check(context.Background(), cert.Cert, cert.CACerts)
+	if err != nil || result.Status != RevocationRevoked || result.Source != RevocationSourceCRL || result.Reason != ocsp.KeyCompromise {
+		t.Fatalf("Expected a revoked CRL status, got %+v %v", result, err)
+	}
+
+	// A CRL signed by another CA is not trusted
+	other := newRevocationServer(t)
+	if _, err := newRevocationChecker(RevocationConfig{}).check(context.Background(), cert.Cert, []*x509.Certificate{other.caCert}); err == nil {
+		t.Errorf("Expected an error without the issuer certificate")
+	}
+}
+
+func TestCheckRevocationUnavailable(t *testing.T) {
+	srv := newRevocationServer(t)
+	cert := srv.issue(t, testOIB)
+	srv.set(false, true, true)
+
+	// FINA not reachable doesn't block the entity, the preflight only warns
+	fe, err := NewFiskalEntityWithOptions(testOIB, WithLocation("REVOC1"), WithSigner(cert.Signer, cert.Cert, cert.CACerts...),
+		WithChainVerification(false), WithRevocationCheck(RevocationConfig{}))
+	if err != nil {
+		t.Fatalf("Expected the entity to be created, got %v", err)
+	}
+	result, err := fe.CheckRevocation(context.Background())
+	if err == nil || result.Status != RevocationUnknown {
+		t.Errorf("Expected an unknown status, got %+v %v", result, err)
+	}
+	if check := fe.preflightRevocation(); check.Status != PreflightWarning {
+		t.Errorf("Expected a preflight warning, got %+v", check)
+	}
+}
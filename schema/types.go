@@ -0,0 +1,121 @@
+package schema
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import "encoding/xml"
+
+// EchoRequest represents a simple request with a text body
+type EchoRequest struct {
+	XMLName xml.Name `xml:"tns:EchoRequest"`
+	Xmlns   string   `xml:"xmlns:tns,attr"` // Declare the tns namespace
+	Text    string   `xml:",chardata"`
+}
+
+// EchoResponse represents a simple response with a text body
+type EchoResponse struct {
+	XMLName xml.Name `xml:"EchoResponse"`
+	Text    string   `xml:",chardata"`
+}
+
+// PorukaOdgovoraType ...
+type PorukaOdgovoraType struct {
+	SifraPoruke string `xml:"SifraPoruke"`
+	Poruka      string `xml:"Poruka"`
+}
+
+// ZaglavljeType is Datum i vrijeme slanja poruke.
+type ZaglavljeType struct {
+	IdPoruke     string `xml:"tns:IdPoruke"`
+	DatumVrijeme string `xml:"tns:DatumVrijeme"`
+}
+
+// ZaglavljeOdgovorType ...
+type ZaglavljeOdgovorType struct {
+	IdPoruke     string `xml:"IdPoruke"`
+	DatumVrijeme string `xml:"DatumVrijeme"`
+}
+
+// PrateciDokumentType ...
+type PrateciDokumentType struct {
+	Oib                 string      `xml:"tns:Oib"`
+	DatVrijeme          string      `xml:"tns:DatVrijeme"`
+	BrPratecegDokumenta *BrojPDType `xml:"tns:BrPratecegDokumenta"`
+	IznosUkupno         string      `xml:"tns:IznosUkupno"`
+	ZastKodPD           string      `xml:"tns:ZastKodPD"`
+	NakDost             bool        `xml:"tns:NakDost"`
+}
+
+// PrateciDokument ...
+type PrateciDokument struct {
+	JirPD     string `xml:"tns:JirPD"`
+	ZastKodPD string `xml:"tns:ZastKodPD"`
+}
+
+// NapojnicaType ...
+type NapojnicaType struct {
+	IznosNapojnice         string `xml:"tns:iznosNapojnice"`
+	NacinPlacanjaNapojnice string `xml:"tns:nacinPlacanjaNapojnice"`
+}
+
+// GreskaType ...
+type GreskaType struct {
+	SifraGreske  string `xml:"SifraGreske"`
+	PorukaGreske string `xml:"PorukaGreske"`
+}
+
+// NaknadeType ...
+type NaknadeType struct {
+	Naknada []*NaknadaType `xml:"tns:Naknada"`
+}
+
+// NaknadaType ...
+type NaknadaType struct {
+	NazivN string `xml:"tns:NazivN"`
+	IznosN string `xml:"tns:IznosN"`
+}
+
+// OstaliPoreziType ...
+type OstaliPoreziType struct {
+	Porez []*PorezOstaloType `xml:"tns:Porez"`
+}
+
+// PorezNaPotrosnjuType ...
+type PorezNaPotrosnjuType struct {
+	Porez []*PorezType `xml:"tns:Porez"`
+}
+
+// PdvType ...
+type PdvType struct {
+	Porez []*PorezType `xml:"tns:Porez"`
+}
+
+// PorezOstaloType ...
+type PorezOstaloType struct {
+	Naziv    string `xml:"tns:Naziv"`
+	Stopa    string `xml:"tns:Stopa"`
+	Osnovica string `xml:"tns:Osnovica"`
+	Iznos    string `xml:"tns:Iznos"`
+}
+
+// PorezType ...
+type PorezType struct {
+	Stopa    string `xml:"tns:Stopa"`
+	Osnovica string `xml:"tns:Osnovica"`
+	Iznos    string `xml:"tns:Iznos"`
+}
+
+// BrojRacunaType ...
+type BrojRacunaType struct {
+	BrOznRac uint   `xml:"tns:BrOznRac"`
+	OznPosPr string `xml:"tns:OznPosPr"`
+	OznNapUr uint   `xml:"tns:OznNapUr"`
+}
+
+// BrojPDType ...
+type BrojPDType struct {
+	BrOznPD  int    `xml:"tns:BrOznPD"`
+	OznPosPr string `xml:"tns:OznPosPr"`
+	OznNapUr int    `xml:"tns:OznNapUr"`
+}
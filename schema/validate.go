@@ -0,0 +1,305 @@
+// Package schema has the element types of the CIS fiscalization messages and the rules of the CIS
+// FiskalizacijaSchema.xsd the requests are validated with, without any dependency on the rest of the library.
+//
+// The fiskalhrgo package keeps the same types under their old names (e.g. fiskalhrgo.PorezType is schema.PorezType),
+// ValidateRequestXML, SchemaError and SchemaErrors are the Validate, Error and Errors of this package. The request
+// and response messages bound to a FiskalEntity (RacunType and the messages containing it) stay in fiskalhrgo.
+package schema
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/beevik/etree"
+)
+
+// Namespace is the namespace of the CIS messages
+const Namespace = "http://www.apis-it.hr/fin/2012/types/f73"
+
+// xmldsigNamespace is the namespace of the XML signature elements
+const xmldsigNamespace = "http://www.w3.org/2000/09/xmldsig#"
+
+// ErrInvalid matches the Errors returned by Validate with errors.Is
+var ErrInvalid = errors.New("request does not match the CIS XML schema")
+
+// Error is a single violation of the CIS XML schema
+type Error struct {
+	// Path of the element, e.g. /RacunZahtjev/Racun/BrRac/OznPosPr
+	Path    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// Errors are all the violations found in a request
+type Errors []*Error
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return ErrInvalid.Error() + ": " + strings.Join(messages, "; ")
+}
+
+// Is matches ErrInvalid
+func (e Errors) Is(target error) bool {
+	return target == ErrInvalid
+}
+
+// simpleType checks the text of an element, it returns the violation or an empty string
+type simpleType func(value string) string
+
+func patternType(pattern string) simpleType {
+	re := regexp.MustCompile("^(?:" + pattern + ")$")
+	return func(value string) string {
+		if !re.MatchString(value) {
+			return fmt.Sprintf("value %q does not match the pattern %s", value, pattern)
+		}
+		return ""
+	}
+}
+
+func stringType(minLength int, maxLength int) simpleType {
+	return func(value string) string {
+		if length := utf8.RuneCountInString(value); length < minLength || length > maxLength {
+			return fmt.Sprintf("value %q must be %d to %d characters long", value, minLength, maxLength)
+		}
+		return ""
+	}
+}
+
+func enumType(values ...string) simpleType {
+	return func(value string) string {
+		for _, v := range values {
+			if value == v {
+				return ""
+			}
+		}
+		return fmt.Sprintf("value %q is not one of %s", value, strings.Join(values, ", "))
+	}
+}
+
+// The simple types of the FiskalizacijaSchema.xsd
+var (
+	xsdOib          = patternType(`\d{11}`)
+	xsdDatumVrijeme = patternType(`[0-9]{2}\.[0-9]{2}\.[1-2][0-9]{3}T[0-9]{2}:[0-9]{2}:[0-9]{2}`)
+	xsdUUID         = patternType(`[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`)
+	xsdBoolean      = enumType("true", "false", "1", "0")
+	xsdIznos        = patternType(`([+-]?)[0-9]{1,15}\.[0-9]{2}`)
+	xsdStopa        = patternType(`([+-]?)[0-9]{1,3}\.[0-9]{2}`)
+	xsdBroj         = patternType(`\d{1,20}`)
+	xsdOznPosPr     = patternType(`[0-9a-zA-Z]{1,20}`)
+	xsdZastKod      = patternType(`[a-f0-9]{32}`)
+	xsdNacinPlac    = enumType("G", "K", "C", "T", "O")
+	xsdOznSlijed    = enumType("N", "P")
+	xsdNaziv        = stringType(1, 100)
+	xsdSpecNamj     = stringType(1, 1000)
+)
+
+// xsdUnbounded is the maxOccurs of the repeated elements
+const xsdUnbounded = -1
+
+// schemaElement is an element of the schema, with a simple type or a sequence of child elements
+type schemaElement struct {
+	name     string
+	min, max int
+	simple   simpleType
+	sequence []*schemaElement
+}
+
+func xsdRequired(name string, simple simpleType) *schemaElement {
+	return &schemaElement{name: name, min: 1, max: 1, simple: simple}
+}
+
+func xsdOptional(name string, simple simpleType) *schemaElement {
+	return &schemaElement{name: name, min: 0, max: 1, simple: simple}
+}
+
+func xsdComplex(name string, min int, max int, sequence ...*schemaElement) *schemaElement {
+	return &schemaElement{name: name, min: min, max: max, sequence: sequence}
+}
+
+func xsdPorezList(name string, porez ...*schemaElement) *schemaElement {
+	return xsdComplex(name, 0, 1, xsdComplex("Porez", 1, xsdUnbounded, porez...))
+}
+
+var (
+	xsdZaglavlje = xsdComplex("Zaglavlje", 1, 1,
+		xsdRequired("IdPoruke", xsdUUID),
+		xsdRequired("DatumVrijeme", xsdDatumVrijeme),
+	)
+
+	xsdPorez = []*schemaElement{
+		xsdRequired("Stopa", xsdStopa),
+		xsdRequired("Osnovica", xsdIznos),
+		xsdRequired("Iznos", xsdIznos),
+	}
+
+	// requestSchemas are the requests validated by Validate
+	requestSchemas = map[string]*schemaElement{
+		"RacunZahtjev": xsdComplex("RacunZahtjev", 1, 1,
+			xsdZaglavlje,
+			xsdComplex("Racun", 1, 1,
+				xsdRequired("Oib", xsdOib),
+				xsdRequired("USustPdv", xsdBoolean),
+				xsdRequired("DatVrijeme", xsdDatumVrijeme),
+				xsdRequired("OznSlijed", xsdOznSlijed),
+				xsdComplex("BrRac", 1, 1,
+					xsdRequired("BrOznRac", xsdBroj),
+					xsdRequired("OznPosPr", xsdOznPosPr),
+					xsdRequired("OznNapUr", xsdBroj),
+				),
+				xsdPorezList("Pdv", xsdPorez...),
+				xsdPorezList("Pnp", xsdPorez...),
+				xsdPorezList("OstaliPor", append([]*schemaElement{xsdRequired("Naziv", xsdNaziv)}, xsdPorez...)...),
+				xsdOptional("IznosOslobPdv", xsdIznos),
+				xsdOptional("IznosMarza", xsdIznos),
+				xsdOptional("IznosNePodlOpor", xsdIznos),
+				xsdComplex("Naknade", 0, 1, xsdComplex("Naknada", 1, xsdUnbounded,
+					xsdRequired("NazivN", xsdNaziv),
+					xsdRequired("IznosN", xsdIznos),
+				)),
+				xsdRequired("IznosUkupno", xsdIznos),
+				xsdRequired("NacinPlac", xsdNacinPlac),
+				xsdRequired("OibOper", xsdOib),
+				xsdRequired("ZastKod", xsdZastKod),
+				xsdRequired("NakDost", xsdBoolean),
+				xsdOptional("ParagonBrRac", xsdNaziv),
+				xsdOptional("SpecNamj", xsdSpecNamj),
+				xsdComplex("PrateciDokument", 0, 1,
+					xsdOptional("JirPD", xsdUUID),
+					xsdOptional("ZastKodPD", xsdZastKod),
+				),
+				xsdOptional("PromijenjeniNacinPlac", xsdNacinPlac),
+				xsdComplex("Napojnica", 0, 1,
+					xsdRequired("iznosNapojnice", xsdIznos),
+					xsdRequired("nacinPlacanjaNapojnice", xsdNacinPlac),
+				),
+			),
+		),
+		"PrateciDokumentiZahtjev": xsdComplex("PrateciDokumentiZahtjev", 1, 1,
+			xsdZaglavlje,
+			xsdComplex("PrateciDokument", 1, 1,
+				xsdRequired("Oib", xsdOib),
+				xsdRequired("DatVrijeme", xsdDatumVrijeme),
+				xsdComplex("BrPratecegDokumenta", 1, 1,
+					xsdRequired("BrOznPD", xsdBroj),
+					xsdRequired("OznPosPr", xsdOznPosPr),
+					xsdRequired("OznNapUr", xsdBroj),
+				),
+				xsdRequired("IznosUkupno", xsdIznos),
+				xsdRequired("ZastKodPD", xsdZastKod),
+				xsdRequired("NakDost", xsdBoolean),
+			),
+		),
+	}
+)
+
+// Validate validates the marshaled RacunZahtjev or PrateciDokumentiZahtjev against the rules of
+// the CIS FiskalizacijaSchema.xsd (element order, required elements, patterns and lengths), so a request that
+// CIS would reject with a schema error (s001) is caught before sending, with the path of every invalid element.
+// The rules are transcribed from the XSD, Go has no XSD validator in the standard library.
+// It returns Errors, matched by ErrInvalid.
+func Validate(data []byte) error {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return fmt.Errorf("failed to parse XML: %w", err)
+	}
+	root := doc.Root()
+	if root == nil {
+		return errors.New("invalid XML: root element not found")
+	}
+	schema, ok := requestSchemas[root.Tag]
+	if !ok {
+		return fmt.Errorf("no schema for the %s request", root.Tag)
+	}
+	var errs Errors
+	if root.NamespaceURI() != Namespace {
+		errs = append(errs, &Error{Path: "/" + root.Tag, Message: fmt.Sprintf("namespace must be %s", Namespace)})
+	}
+	validateElement(root, schema, "/"+root.Tag, &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Has reports whether there is a schema for the request message, e.g. "RacunZahtjev"
+func Has(name string) bool {
+	_, ok := requestSchemas[name]
+	return ok
+}
+
+// UUID checks the IdPoruke and the JIR, it returns the violation or an empty string
+func UUID(value string) string {
+	return xsdUUID(value)
+}
+
+// validateElement validates the element and its children, the violations are appended to errs
+func validateElement(el *etree.Element, schema *schemaElement, path string, errs *Errors) {
+	if schema.simple != nil {
+		if len(el.ChildElements()) > 0 {
+			*errs = append(*errs, &Error{Path: path, Message: "must not contain elements"})
+			return
+		}
+		if message := schema.simple(el.Text()); message != "" {
+			*errs = append(*errs, &Error{Path: path, Message: message})
+		}
+		return
+	}
+
+	var children []*etree.Element
+	for _, child := range el.ChildElements() {
+		// The enveloped signature of a signed request is not part of the schema
+		if child.Tag == "Signature" && child.NamespaceURI() == xmldsigNamespace {
+			continue
+		}
+		children = append(children, child)
+	}
+	for _, token := range el.Child {
+		if data, ok := token.(*etree.CharData); ok && strings.TrimSpace(data.Data) != "" {
+			*errs = append(*errs, &Error{Path: path, Message: fmt.Sprintf("unexpected text %q", strings.TrimSpace(data.Data))})
+		}
+	}
+
+	i := 0
+	for _, particle := range schema.sequence {
+		count := 0
+		for i < len(children) && children[i].Tag == particle.name && (particle.max == xsdUnbounded || count < particle.max) {
+			child := children[i]
+			childPath := path + "/" + particle.name
+			if particle.max != 1 {
+				childPath = fmt.Sprintf("%s[%d]", childPath, count+1)
+			}
+			if child.NamespaceURI() != Namespace {
+				*errs = append(*errs, &Error{Path: childPath, Message: fmt.Sprintf("namespace must be %s", Namespace)})
+			}
+			validateElement(child, particle, childPath, errs)
+			count++
+			i++
+		}
+		if count < particle.min {
+			*errs = append(*errs, &Error{Path: path + "/" + particle.name, Message: "required element is missing or out of order"})
+		}
+	}
+	for ; i < len(children); i++ {
+		message := "unexpected element"
+		for _, particle := range schema.sequence {
+			if particle.name == children[i].Tag {
+				message = "element is out of order or repeated"
+				break
+			}
+		}
+		*errs = append(*errs, &Error{Path: path + "/" + children[i].Tag, Message: message})
+	}
+}
@@ -0,0 +1,35 @@
+package schema
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testPrateciDokument = `<tns:PrateciDokumentiZahtjev xmlns:tns="http://www.apis-it.hr/fin/2012/types/f73" Id="x"><tns:Zaglavlje><tns:IdPoruke>f81d4fae-7dec-11d0-a765-00a0c91e6bf6</tns:IdPoruke><tns:DatumVrijeme>01.01.2026T10:00:00</tns:DatumVrijeme></tns:Zaglavlje><tns:PrateciDokument><tns:Oib>65049901548</tns:Oib><tns:DatVrijeme>01.01.2026T10:00:00</tns:DatVrijeme><tns:BrPratecegDokumenta><tns:BrOznPD>1</tns:BrOznPD><tns:OznPosPr>POS1</tns:OznPosPr><tns:OznNapUr>1</tns:OznNapUr></tns:BrPratecegDokumenta><tns:IznosUkupno>10.00</tns:IznosUkupno><tns:ZastKodPD>e4d909c290d0fb1ca068ffaddf22cbd0</tns:ZastKodPD><tns:NakDost>false</tns:NakDost></tns:PrateciDokument></tns:PrateciDokumentiZahtjev>`
+
+func TestValidate(t *testing.T) {
+	if err := Validate([]byte(testPrateciDokument)); err != nil {
+		t.Fatalf("Expected the request to be valid, got %v", err)
+	}
+
+	err := Validate([]byte(strings.Replace(testPrateciDokument, "<tns:IznosUkupno>10.00<", "<tns:IznosUkupno>10<", 1)))
+	var errs Errors
+	if !errors.Is(err, ErrInvalid) || !errors.As(err, &errs) || len(errs) != 1 || errs[0].Path != "/PrateciDokumentiZahtjev/PrateciDokument/IznosUkupno" {
+		t.Errorf("Expected an error for the amount, got %v", err)
+	}
+
+	if err := Validate([]byte(`<EchoRequest/>`)); err == nil || errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected an error for a request without a schema, got %v", err)
+	}
+	if !Has("RacunZahtjev") || Has("EchoRequest") {
+		t.Error("Expected a schema for RacunZahtjev and none for EchoRequest")
+	}
+	if UUID("f81d4fae-7dec-11d0-a765-00a0c91e6bf6") != "" || UUID("F81D4FAE-7DEC-11D0-A765-00A0C91E6BF6") == "" {
+		t.Error("Expected only the lowercase UUID to be valid")
+	}
+}
@@ -0,0 +1,22 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import "github.com/l-d-t/fiskalhrgo/schema"
+
+// ErrSchemaValidation matches the SchemaErrors returned by ValidateRequestXML with errors.Is
+var ErrSchemaValidation = schema.ErrInvalid
+
+// SchemaError is a single violation of the CIS XML schema, see schema.Error
+type SchemaError = schema.Error
+
+// SchemaErrors are all the violations found in a request, see schema.Errors
+type SchemaErrors = schema.Errors
+
+// ValidateRequestXML validates the marshaled RacunZahtjev or PrateciDokumentiZahtjev against the rules of
+// the CIS FiskalizacijaSchema.xsd, see schema.Validate. It returns SchemaErrors, matched by ErrSchemaValidation.
+func ValidateRequestXML(data []byte) error {
+	return schema.Validate(data)
+}
@@ -0,0 +1,93 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func marshalTestRequest(t *testing.T, invoice *RacunType) string {
+	t.Helper()
+	data, err := xml.MarshalIndent(RacunZahtjev{Zaglavlje: newFiskalHeader(GenerateID()), Racun: invoice, Xmlns: DefaultNamespace, IdAttr: GenerateID()}, "", " ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestValidateRequestXML(t *testing.T) {
+	fe := newTestEntity(t)
+	invoice, _, err := fe.NewCISInvoice(time.Now(), 1236, 1, [][]interface{}{{"25.00", "1000.00", "250.00"}, {"13.00", "100.00", "13.00"}},
+		nil, [][]interface{}{{"Porez na luksuz", "15.00", "10.00", "1.50"}}, "0.00", "0.00", "0.00", [][]string{{"Povratna naknada", "0.50"}}, "1264.50", CISCash, "12345678901")
+	if err != nil {
+		t.Fatalf("Failed to create invoice: %v", err)
+	}
+	request := marshalTestRequest(t, invoice)
+	if err := ValidateRequestXML([]byte(request)); err != nil {
+		t.Fatalf("Expected the request to be valid, got %v", err)
+	}
+
+	pd := `<tns:PrateciDokumentiZahtjev xmlns:tns="http://www.apis-it.hr/fin/2012/types/f73" Id="x"><tns:Zaglavlje><tns:IdPoruke>f81d4fae-7dec-11d0-a765-00a0c91e6bf6</tns:IdPoruke><tns:DatumVrijeme>01.01.2026T10:00:00</tns:DatumVrijeme></tns:Zaglavlje><tns:PrateciDokument><tns:Oib>65049901548</tns:Oib><tns:DatVrijeme>01.01.2026T10:00:00</tns:DatVrijeme><tns:BrPratecegDokumenta><tns:BrOznPD>1</tns:BrOznPD><tns:OznPosPr>POS1</tns:OznPosPr><tns:OznNapUr>1</tns:OznNapUr></tns:BrPratecegDokumenta><tns:IznosUkupno>10.00</tns:IznosUkupno><tns:ZastKodPD>e4d909c290d0fb1ca068ffaddf22cbd0</tns:ZastKodPD><tns:NakDost>false</tns:NakDost></tns:PrateciDokument></tns:PrateciDokumentiZahtjev>`
+	if err := ValidateRequestXML([]byte(pd)); err != nil {
+		t.Errorf("Expected the PrateciDokumentiZahtjev to be valid, got %v", err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		request string
+		path    string
+	}{
+		{"pattern", strings.Replace(request, "<tns:OznPosPr>"+invoice.BrRac.OznPosPr+"<", "<tns:OznPosPr>POS 1<", 1), "/RacunZahtjev/Racun/BrRac/OznPosPr"},
+		{"enum", strings.Replace(request, "<tns:NacinPlac>G<", "<tns:NacinPlac>X<", 1), "/RacunZahtjev/Racun/NacinPlac"},
+		{"amount", strings.Replace(request, "<tns:IznosUkupno>1264.50<", "<tns:IznosUkupno>1264.5<", 1), "/RacunZahtjev/Racun/IznosUkupno"},
+		{"repeated", strings.Replace(request, "<tns:Stopa>13.00<", "<tns:Stopa>13<", 1), "/RacunZahtjev/Racun/Pdv/Porez[2]/Stopa"},
+		{"missing", strings.Replace(request, "<tns:OibOper>12345678901</tns:OibOper>", "", 1), "/RacunZahtjev/Racun/OibOper"},
+		{"order", strings.Replace(strings.Replace(request, "<tns:NakDost>false</tns:NakDost>", "", 1), "<tns:ZastKod>", "<tns:NakDost>false</tns:NakDost><tns:ZastKod>", 1), "/RacunZahtjev/Racun/ZastKod"},
+		{"unknown", strings.Replace(request, "<tns:NakDost>", "<tns:Extra>1</tns:Extra><tns:NakDost>", 1), "/RacunZahtjev/Racun/Extra"},
+	} {
+		err := ValidateRequestXML([]byte(tc.request))
+		var schemaErrs SchemaErrors
+		if !errors.Is(err, ErrSchemaValidation) || !errors.As(err, &schemaErrs) {
+			t.Errorf("%s: expected SchemaErrors, got %v", tc.name, err)
+			continue
+		}
+		found := false
+		for _, e := range schemaErrs {
+			found = found || e.Path == tc.path
+		}
+		if !found {
+			t.Errorf("%s: expected an error for %s, got %v", tc.name, tc.path, err)
+		}
+	}
+
+	if err := ValidateRequestXML([]byte(`<EchoRequest/>`)); err == nil || errors.Is(err, ErrSchemaValidation) {
+		t.Errorf("Expected an error for a request without a schema, got %v", err)
+	}
+}
+
+func TestSchemaValidationOption(t *testing.T) {
+	requests := 0
+	fe := newTestServerEntity(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	})
+	fe.schemaValidation = true
+
+	invoice, _, err := fe.NewCISInvoice(time.Now(), 1, 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "10.00", CISCash, "12345678901")
+	if err != nil {
+		t.Fatalf("Failed to create invoice: %v", err)
+	}
+	invoice.ParagonBrRac = strings.Repeat("x", 101)
+
+	_, _, err = invoice.InvoiceRequest()
+	var fErr *FiskalError
+	if !errors.Is(err, ErrSchemaValidation) || !errors.As(err, &fErr) || fErr.Category != CategoryInput || requests != 0 {
+		t.Errorf("Expected the invalid request not to be sent, got %v after %d requests", err, requests)
+	}
+}
@@ -0,0 +1,55 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"errors"
+	"fmt"
+)
+
+// DeviceType is the type of the device (naplatni uređaj) that issued the invoice
+type DeviceType string
+
+const (
+	// DeviceCashRegister is a device operated by the staff of the taxpayer, the default
+	DeviceCashRegister DeviceType = "cash-register"
+
+	// DeviceSelfService is a self-service device (samoposlužni uređaj) operated by the customer,
+	// e.g. a vending machine, a self-checkout or a parking machine
+	DeviceSelfService DeviceType = "self-service"
+)
+
+// SetSelfServiceDevice marks the invoice as issued by the self-service device with the ID (its marking, digits
+// and letters, up to 20 characters), see DeviceType and SelfServiceDevice. The invoice data sent to CIS and the ZKI
+// don't change: there is no element for the device in the published CIS schema, so the device is not sent.
+// The OIB of the operator (OibOper) is kept as set when the invoice was created. The device is not part of the
+// invoice data, so it is lost when the invoice is marshaled (e.g. to JSON), the offline queue keeps it with the
+// queued invoice (QueuedInvoice.SelfServiceDevice).
+func (invoice *RacunType) SetSelfServiceDevice(deviceID string) error {
+	if invoice == nil || invoice.pointerToEntity == nil {
+		return errors.New("invoice is nil or not created by an entity")
+	}
+	if !ValidateLocationID(deviceID) {
+		return fmt.Errorf("invalid self-service device ID %q, it can contain only digits and letters, up to 20 characters", deviceID)
+	}
+	invoice.selfService = deviceID
+	return nil
+}
+
+// SelfServiceDevice returns the ID of the self-service device that issued the invoice, empty for a cash register
+func (invoice *RacunType) SelfServiceDevice() string {
+	if invoice == nil {
+		return ""
+	}
+	return invoice.selfService
+}
+
+// DeviceType returns the type of the device that issued the invoice
+func (invoice *RacunType) DeviceType() DeviceType {
+	if invoice != nil && invoice.selfService != "" {
+		return DeviceSelfService
+	}
+	return DeviceCashRegister
+}
@@ -0,0 +1,133 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+func TestSelfServiceDevice(t *testing.T) {
+	key, cert := newTestCISSigningCert(t)
+	var request *etree.Document
+	fe := newTestServerEntity(t, func(w http.ResponseWriter, r *http.Request) {
+		request = etree.NewDocument()
+		if _, err := request.ReadFrom(r.Body); err != nil {
+			t.Error(err)
+			return
+		}
+		response := fmt.Sprintf(testCISResponse, "G0x1", request.FindElement("//IdPoruke").Text(), request.FindElement("//DatumVrijeme").Text(), "9d6f5bb6-da48-4fcd-a803-4586a025e0e4")
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprint(w, signTestCISResponse(t, key, response, MakeC14N10RecCanonicalizer()))
+	})
+	fe.ciscert = newSignatureCheckCIScert(cert, fe.ciscert.SSLverifyPoll)
+
+	invoice, zki, err := fe.NewCISInvoice(time.Now(), 7, 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "3.20", CISCard, "12345678901")
+	if err != nil {
+		t.Fatalf("Failed to create invoice: %v", err)
+	}
+	if invoice.DeviceType() != DeviceCashRegister {
+		t.Errorf("Expected a cash register by default, got %s", invoice.DeviceType())
+	}
+	for _, id := range []string{"", "AUTOMAT-1", "A12345678901234567890"} {
+		if err := invoice.SetSelfServiceDevice(id); err == nil {
+			t.Errorf("Expected an error for the device ID %q", id)
+		}
+	}
+	if err := invoice.SetSelfServiceDevice("AUTOMAT1"); err != nil {
+		t.Fatalf("Failed to set the device: %v", err)
+	}
+	if invoice.DeviceType() != DeviceSelfService || invoice.SelfServiceDevice() != "AUTOMAT1" || invoice.OibOper != "12345678901" || invoice.ZastKod != zki {
+		t.Errorf("Unexpected self-service invoice %+v", invoice)
+	}
+
+	// The device is not in the published schema, the invoice is sent unchanged and validated against the schema
+	fe.schemaValidation = true
+	for _, version := range []FiscalizationVersion{Fiscalization1, Fiscalization2} {
+		if err := fe.SetFiscalizationVersion(version); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := invoice.InvoiceRequest(); err != nil {
+			t.Fatalf("Failed to send the invoice: %v", err)
+		}
+		if request.FindElement("//Racun/SamoposluzniUredaj") != nil || request.FindElement("//Racun/OibOper").Text() != "12345678901" {
+			t.Errorf("Expected the invoice without the device with version %d", version)
+		}
+	}
+}
+
+// jsonQueueStore keeps the queued invoices as JSON, like the persistent stores
+type jsonQueueStore struct {
+	items map[string][]byte
+}
+
+func (s *jsonQueueStore) Put(item *QueuedInvoice) error {
+	data, err := json.Marshal(item)
+	s.items[item.ZKI] = data
+	return err
+}
+
+func (s *jsonQueueStore) Get(zki string) (*QueuedInvoice, error) {
+	data, ok := s.items[zki]
+	if !ok {
+		return nil, nil
+	}
+	item := &QueuedInvoice{}
+	return item, json.Unmarshal(data, item)
+}
+
+func (s *jsonQueueStore) Delete(zki string) error {
+	delete(s.items, zki)
+	return nil
+}
+
+func (s *jsonQueueStore) List() ([]*QueuedInvoice, error) {
+	var list []*QueuedInvoice
+	for zki := range s.items {
+		item, err := s.Get(zki)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, item)
+	}
+	return list, nil
+}
+
+func (s *jsonQueueStore) Close() error { return nil }
+
+func TestSelfServiceDeviceQueued(t *testing.T) {
+	fe := newTestServerEntity(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	var device string
+	fe.OnInvoiceSent(func(invoice *RacunType) { device = invoice.SelfServiceDevice() })
+	queue, err := fe.NewOfflineQueue(&jsonQueueStore{items: make(map[string][]byte)})
+	if err != nil {
+		t.Fatalf("Failed to create queue: %v", err)
+	}
+	invoice, _, err := fe.NewCISInvoice(time.Now(), 8, 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "3.20", CISCard, "12345678901")
+	if err != nil {
+		t.Fatalf("Failed to create invoice: %v", err)
+	}
+	if err := invoice.SetSelfServiceDevice("AUTOMAT1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := queue.Enqueue(invoice, nil); err != nil {
+		t.Fatalf("Failed to enqueue invoice: %v", err)
+	}
+
+	// The device survives the JSON of the store
+	if _, err := queue.Dispatch(); err != nil {
+		t.Fatal(err)
+	}
+	if device != "AUTOMAT1" {
+		t.Errorf("Expected the queued invoice to keep the device, got %q", device)
+	}
+}
@@ -0,0 +1,182 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrShuttingDown is returned for the requests made after Shutdown was called. The request was not sent,
+// so the invoice can be sent again later (the error is retriable).
+var ErrShuttingDown = errors.New("entity is shutting down")
+
+// beginRequest registers a request in flight, it fails once Shutdown was called. Every successful call
+// must be followed by endRequest.
+func (fe *FiskalEntity) beginRequest() error {
+	if fe == nil {
+		return nil
+	}
+	fe.requestsMu.RLock()
+	defer fe.requestsMu.RUnlock()
+	if fe.shuttingDown {
+		return newFiskalError(CategoryTransport, ErrShuttingDown)
+	}
+	fe.requests.Add(1)
+	return nil
+}
+
+// endRequest marks a request registered with beginRequest as finished
+func (fe *FiskalEntity) endRequest() {
+	if fe == nil {
+		return
+	}
+	fe.requests.Done()
+}
+
+// isShuttingDown reports whether Shutdown was called
+func (fe *FiskalEntity) isShuttingDown() bool {
+	if fe == nil {
+		return false
+	}
+	fe.requestsMu.RLock()
+	defer fe.requestsMu.RUnlock()
+	return fe.shuttingDown
+}
+
+// Shutdown stops the entity gracefully: the new requests are refused with ErrShuttingDown, the requests in flight
+// are finished (with their journal, message store and event records) and then the entity is closed (see Close).
+// If the context is done first, the context error is returned and the entity is not closed, the requests
+// in flight continue. Calling Shutdown again waits for the requests in flight again.
+func (fe *FiskalEntity) Shutdown(ctx context.Context) error {
+	fe.requestsMu.Lock()
+	fe.shuttingDown = true
+	fe.requestsMu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		fe.requests.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	fe.log(lifecycleLevel, "entity shut down")
+	return fe.Close()
+}
+
+// Shutdowner is a component stopped gracefully with a ShutdownGroup, e.g. a FiskalEntity or an OfflineQueue
+type Shutdowner interface {
+	Shutdown(ctx context.Context) error
+}
+
+// ShutdownFunc adapts a function to the Shutdowner interface, e.g. ShutdownFunc(stream.Close)
+type ShutdownFunc func(ctx context.Context) error
+
+// Shutdown calls the function
+func (f ShutdownFunc) Shutdown(ctx context.Context) error {
+	return f(ctx)
+}
+
+// ShutdownGroup coordinates the shutdown of the background components, so a deployment stopped with SIGTERM
+// doesn't drop invoices: the background loops (WatchCertProvider, CISCertUpdater.Run, queue dispatching...)
+// started with Go are stopped, and the components are shut down in the order they were added. Add the entity
+// before its offline queues, so the invoices failed by the requests in flight can still be queued.
+//
+//	group := fiskalhrgo.NewShutdownGroup()
+//	group.Add(entity, queue)
+//	group.Go(func(ctx context.Context) { entity.WatchCertProvider(ctx, time.Hour, nil) })
+//	...
+//	<-sigterm
+//	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+//	defer cancel()
+//	err := group.Shutdown(ctx)
+type ShutdownGroup struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	loops  sync.WaitGroup
+
+	mu         sync.Mutex
+	components []Shutdowner
+	stopped    bool
+}
+
+// NewShutdownGroup returns an empty group
+func NewShutdownGroup() *ShutdownGroup {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ShutdownGroup{ctx: ctx, cancel: cancel}
+}
+
+// Add adds the components to be shut down, after the ones added before. Components added after Shutdown are ignored.
+func (g *ShutdownGroup) Add(components ...Shutdowner) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.stopped {
+		return
+	}
+	for _, c := range components {
+		if c != nil {
+			g.components = append(g.components, c)
+		}
+	}
+}
+
+// Go runs the background loop in a goroutine, its context is done when Shutdown is called.
+// Loops started after Shutdown are not run.
+func (g *ShutdownGroup) Go(loop func(ctx context.Context)) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.stopped {
+		return
+	}
+	g.loops.Add(1)
+	go func() {
+		defer g.loops.Done()
+		loop(g.ctx)
+	}()
+}
+
+// Shutdown stops the background loops, shuts the components down in order and waits for the loops to return.
+// The errors of all components are returned joined, a component is skipped if the context is already done.
+// Only the first call does the work, the later ones return nil.
+func (g *ShutdownGroup) Shutdown(ctx context.Context) error {
+	g.mu.Lock()
+	if g.stopped {
+		g.mu.Unlock()
+		return nil
+	}
+	g.stopped = true
+	components := g.components
+	g.mu.Unlock()
+
+	g.cancel()
+	var errs []error
+	for _, c := range components {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		if err := c.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		g.loops.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		if !errors.Is(errors.Join(errs...), ctx.Err()) {
+			errs = append(errs, ctx.Err())
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,120 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestShutdown(t *testing.T) {
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	fe := newTestServerEntity(t, func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+	journal := NewMemoryJournal()
+	fe.SetJournal(journal)
+	queue, err := fe.NewOfflineQueue(NewMemoryQueueStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invoice, zki, err := fe.NewCISInvoice(time.Now(), 1, 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "10.00", CISCash, "12345678901")
+	if err != nil {
+		t.Fatalf("Failed to create invoice: %v", err)
+	}
+	inFlight := make(chan error, 1)
+	go func() {
+		_, _, err := invoice.InvoiceRequest()
+		if err != nil {
+			// The invoice failed by the request in flight can still be queued
+			err = queue.Enqueue(invoice, err)
+		}
+		inFlight <- err
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	group := NewShutdownGroup()
+	group.Add(fe, queue)
+	loopStopped := make(chan struct{})
+	group.Go(func(ctx context.Context) {
+		<-ctx.Done()
+		close(loopStopped)
+	})
+	if err := fe.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the shutdown to wait for the request in flight, got %v", err)
+	}
+
+	// New requests are refused, they are retriable
+	if _, err := fe.EchoRequest("test"); !errors.Is(err, ErrShuttingDown) || !IsRetriable(err) {
+		t.Errorf("Expected ErrShuttingDown, got %v", err)
+	}
+	if results, err := queue.Dispatch(); err != nil || len(results) != 0 {
+		t.Errorf("Expected no dispatch while the entity is shutting down, got %v %v", results, err)
+	}
+
+	close(release)
+	if err := group.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Failed to shut down: %v", err)
+	}
+	select {
+	case <-loopStopped:
+	default:
+		t.Error("Expected the background loop to be stopped")
+	}
+	if err := <-inFlight; err != nil {
+		t.Errorf("Expected the failed invoice to be queued, got %v", err)
+	}
+	if entries, _ := journal.FindByZKI(zki); len(entries) != 1 {
+		t.Errorf("Expected the request in flight to be journaled, got %d entries", len(entries))
+	}
+
+	if err := queue.Enqueue(invoice, nil); !errors.Is(err, ErrQueueClosed) {
+		t.Errorf("Expected ErrQueueClosed, got %v", err)
+	}
+	if _, err := queue.Dispatch(); !errors.Is(err, ErrQueueClosed) {
+		t.Errorf("Expected ErrQueueClosed, got %v", err)
+	}
+	if _, err := fe.GenerateZKI(time.Now(), 1, 1, "10.00"); !errors.Is(err, ErrEntityClosed) {
+		t.Errorf("Expected the entity to be closed, got %v", err)
+	}
+	if err := group.Shutdown(context.Background()); err != nil {
+		t.Errorf("Expected the second shutdown to do nothing, got %v", err)
+	}
+}
+
+func TestShutdownGroupOrder(t *testing.T) {
+	var order []string
+	component := func(name string, err error) Shutdowner {
+		return ShutdownFunc(func(context.Context) error {
+			order = append(order, name)
+			return err
+		})
+	}
+	failed := errors.New("failed")
+	group := NewShutdownGroup()
+	group.Add(component("entity", nil), component("queue", failed), nil, component("stream", nil))
+	if err := group.Shutdown(context.Background()); !errors.Is(err, failed) {
+		t.Errorf("Expected the component error, got %v", err)
+	}
+	if len(order) != 3 || order[0] != "entity" || order[1] != "queue" || order[2] != "stream" {
+		t.Errorf("Unexpected shutdown order %v", order)
+	}
+
+	group.Add(component("late", nil))
+	group.Go(func(context.Context) { t.Error("Expected no loop after the shutdown") })
+	group.Shutdown(context.Background())
+	if len(order) != 3 {
+		t.Errorf("Expected no components after the shutdown, got %v", order)
+	}
+}
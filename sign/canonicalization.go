@@ -0,0 +1,461 @@
+package sign
+
+// SPDX-License-Identifier: Apache-2.0
+// This file is adapted from the github.com/russellhaering/goxmldsig project.
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/beevik/etree"
+	"github.com/l-d-t/fiskalhrgo/etreeutils" // Import the local etreeutils package
+)
+
+const (
+	DefaultPrefix = "ds"
+	Namespace     = "http://www.w3.org/2000/09/xmldsig#"
+)
+
+// Tags
+const (
+	SignatureTag              = "Signature"
+	SignedInfoTag             = "SignedInfo"
+	CanonicalizationMethodTag = "CanonicalizationMethod"
+	SignatureMethodTag        = "SignatureMethod"
+	ReferenceTag              = "Reference"
+	TransformsTag             = "Transforms"
+	TransformTag              = "Transform"
+	DigestMethodTag           = "DigestMethod"
+	DigestValueTag            = "DigestValue"
+	SignatureValueTag         = "SignatureValue"
+	KeyInfoTag                = "KeyInfo"
+	X509DataTag               = "X509Data"
+	X509CertificateTag        = "X509Certificate"
+	InclusiveNamespacesTag    = "InclusiveNamespaces"
+)
+
+const (
+	AlgorithmAttr  = "Algorithm"
+	URIAttr        = "URI"
+	DefaultIdAttr  = "Id"
+	PrefixListAttr = "PrefixList"
+)
+
+type AlgorithmID string
+
+func (id AlgorithmID) String() string {
+	return string(id)
+}
+
+const (
+	RSASHA1SignatureMethod     = "http://www.w3.org/2000/09/xmldsig#rsa-sha1"
+	RSASHA256SignatureMethod   = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	RSASHA384SignatureMethod   = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha384"
+	RSASHA512SignatureMethod   = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha512"
+	ECDSASHA1SignatureMethod   = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha1"
+	ECDSASHA256SignatureMethod = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha256"
+	ECDSASHA384SignatureMethod = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha384"
+	ECDSASHA512SignatureMethod = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha512"
+)
+
+// Well-known signature algorithms
+const (
+	// Supported canonicalization algorithms
+	CanonicalXML10ExclusiveAlgorithmId             AlgorithmID = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	CanonicalXML10ExclusiveWithCommentsAlgorithmId AlgorithmID = "http://www.w3.org/2001/10/xml-exc-c14n#WithComments"
+
+	CanonicalXML11AlgorithmId             AlgorithmID = "http://www.w3.org/2006/12/xml-c14n11"
+	CanonicalXML11WithCommentsAlgorithmId AlgorithmID = "http://www.w3.org/2006/12/xml-c14n11#WithComments"
+
+	CanonicalXML10RecAlgorithmId          AlgorithmID = "http://www.w3.org/TR/2001/REC-xml-c14n-20010315"
+	CanonicalXML10WithCommentsAlgorithmId AlgorithmID = "http://www.w3.org/TR/2001/REC-xml-c14n-20010315#WithComments"
+
+	EnvelopedSignatureAltorithmId AlgorithmID = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+)
+
+var digestAlgorithmIdentifiers = map[crypto.Hash]string{
+	crypto.SHA1:   "http://www.w3.org/2000/09/xmldsig#sha1",
+	crypto.SHA256: "http://www.w3.org/2001/04/xmlenc#sha256",
+	crypto.SHA384: "http://www.w3.org/2001/04/xmldsig-more#sha384",
+	crypto.SHA512: "http://www.w3.org/2001/04/xmlenc#sha512",
+}
+
+type signatureMethodInfo struct {
+	PublicKeyAlgorithm x509.PublicKeyAlgorithm
+	Hash               crypto.Hash
+}
+
+var digestAlgorithmsByIdentifier = map[string]crypto.Hash{}
+var signatureMethodsByIdentifier = map[string]signatureMethodInfo{}
+
+func init() {
+	for hash, id := range digestAlgorithmIdentifiers {
+		digestAlgorithmsByIdentifier[id] = hash
+	}
+	for algo, hashToMethod := range signatureMethodIdentifiers {
+		for hash, method := range hashToMethod {
+			signatureMethodsByIdentifier[method] = signatureMethodInfo{
+				PublicKeyAlgorithm: algo,
+				Hash:               hash,
+			}
+		}
+	}
+}
+
+var signatureMethodIdentifiers = map[x509.PublicKeyAlgorithm]map[crypto.Hash]string{
+	x509.RSA: {
+		crypto.SHA1:   RSASHA1SignatureMethod,
+		crypto.SHA256: RSASHA256SignatureMethod,
+		crypto.SHA384: RSASHA384SignatureMethod,
+		crypto.SHA512: RSASHA512SignatureMethod,
+	},
+	x509.ECDSA: {
+		crypto.SHA1:   ECDSASHA1SignatureMethod,
+		crypto.SHA256: ECDSASHA256SignatureMethod,
+		crypto.SHA384: ECDSASHA384SignatureMethod,
+		crypto.SHA512: ECDSASHA512SignatureMethod,
+	},
+}
+
+// SignatureMethod returns the XML-DSig signature method of the public key algorithm and the hash,
+// an empty string if there is none
+func SignatureMethod(algorithm x509.PublicKeyAlgorithm, hash crypto.Hash) string {
+	return signatureMethodIdentifiers[algorithm][hash]
+}
+
+// Canonicalizer is an implementation of a canonicalization algorithm.
+type Canonicalizer interface {
+	Canonicalize(el *etree.Element) ([]byte, error)
+	Algorithm() AlgorithmID
+}
+
+// StreamingCanonicalizer is a Canonicalizer that can write the canonical form directly to a writer, e.g. a hash,
+// without building the whole serialized document in memory. All canonicalizers of this package implement it.
+type StreamingCanonicalizer interface {
+	Canonicalizer
+	CanonicalizeTo(w io.Writer, el *etree.Element) error
+}
+
+// CanonicalizeTo writes the canonical form of the element, streaming it if the canonicalizer supports that
+func CanonicalizeTo(canonicalizer Canonicalizer, w io.Writer, el *etree.Element) error {
+	if streaming, ok := canonicalizer.(StreamingCanonicalizer); ok {
+		return streaming.CanonicalizeTo(w, el)
+	}
+	canonical, err := canonicalizer.Canonicalize(el)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(canonical)
+	return err
+}
+
+type NullCanonicalizer struct {
+}
+
+func MakeNullCanonicalizer() Canonicalizer {
+	return &NullCanonicalizer{}
+}
+
+func (c *NullCanonicalizer) Algorithm() AlgorithmID {
+	return AlgorithmID("NULL")
+}
+
+func (c *NullCanonicalizer) Canonicalize(el *etree.Element) ([]byte, error) {
+	return canonicalBytes(c, el)
+}
+
+func (c *NullCanonicalizer) CanonicalizeTo(w io.Writer, el *etree.Element) error {
+	return canonicalWrite(w, canonicalPrep(el, false, true))
+}
+
+type c14N10ExclusiveCanonicalizer struct {
+	prefixList string
+	comments   bool
+}
+
+// MakeC14N10ExclusiveCanonicalizerWithPrefixList constructs an exclusive Canonicalizer
+// from a PrefixList in NMTOKENS format (a white space separated list).
+func MakeC14N10ExclusiveCanonicalizerWithPrefixList(prefixList string) Canonicalizer {
+	return &c14N10ExclusiveCanonicalizer{
+		prefixList: prefixList,
+		comments:   false,
+	}
+}
+
+// MakeC14N10ExclusiveWithCommentsCanonicalizerWithPrefixList constructs an exclusive Canonicalizer
+// from a PrefixList in NMTOKENS format (a white space separated list).
+func MakeC14N10ExclusiveWithCommentsCanonicalizerWithPrefixList(prefixList string) Canonicalizer {
+	return &c14N10ExclusiveCanonicalizer{
+		prefixList: prefixList,
+		comments:   true,
+	}
+}
+
+// Canonicalize transforms the input Element into a serialized XML document in canonical form.
+func (c *c14N10ExclusiveCanonicalizer) Canonicalize(el *etree.Element) ([]byte, error) {
+	return canonicalBytes(c, el)
+}
+
+// CanonicalizeTo transforms the input Element and writes it in canonical form to w.
+func (c *c14N10ExclusiveCanonicalizer) CanonicalizeTo(w io.Writer, el *etree.Element) error {
+	err := etreeutils.TransformExcC14n(el, c.prefixList, c.comments)
+	if err != nil {
+		return err
+	}
+
+	return canonicalWrite(w, el)
+}
+
+func (c *c14N10ExclusiveCanonicalizer) Algorithm() AlgorithmID {
+	if c.comments {
+		return CanonicalXML10ExclusiveWithCommentsAlgorithmId
+	}
+	return CanonicalXML10ExclusiveAlgorithmId
+}
+
+type c14N11Canonicalizer struct {
+	comments bool
+}
+
+// MakeC14N11Canonicalizer constructs an inclusive canonicalizer.
+func MakeC14N11Canonicalizer() Canonicalizer {
+	return &c14N11Canonicalizer{
+		comments: false,
+	}
+}
+
+// MakeC14N11WithCommentsCanonicalizer constructs an inclusive canonicalizer.
+func MakeC14N11WithCommentsCanonicalizer() Canonicalizer {
+	return &c14N11Canonicalizer{
+		comments: true,
+	}
+}
+
+// Canonicalize transforms the input Element into a serialized XML document in canonical form.
+func (c *c14N11Canonicalizer) Canonicalize(el *etree.Element) ([]byte, error) {
+	return canonicalBytes(c, el)
+}
+
+// CanonicalizeTo writes the input Element in canonical form to w.
+func (c *c14N11Canonicalizer) CanonicalizeTo(w io.Writer, el *etree.Element) error {
+	return canonicalWrite(w, canonicalPrep(el, true, c.comments))
+}
+
+func (c *c14N11Canonicalizer) Algorithm() AlgorithmID {
+	if c.comments {
+		return CanonicalXML11WithCommentsAlgorithmId
+	}
+	return CanonicalXML11AlgorithmId
+}
+
+type c14N10RecCanonicalizer struct {
+	comments bool
+}
+
+// MakeC14N10RecCanonicalizer constructs an inclusive canonicalizer.
+func MakeC14N10RecCanonicalizer() Canonicalizer {
+	return &c14N10RecCanonicalizer{
+		comments: false,
+	}
+}
+
+// MakeC14N10WithCommentsCanonicalizer constructs an inclusive canonicalizer.
+func MakeC14N10WithCommentsCanonicalizer() Canonicalizer {
+	return &c14N10RecCanonicalizer{
+		comments: true,
+	}
+}
+
+// Canonicalize transforms the input Element into a serialized XML document in canonical form.
+func (c *c14N10RecCanonicalizer) Canonicalize(inputXML *etree.Element) ([]byte, error) {
+	return canonicalBytes(c, inputXML)
+}
+
+// CanonicalizeTo writes the input Element in canonical form to w.
+func (c *c14N10RecCanonicalizer) CanonicalizeTo(w io.Writer, inputXML *etree.Element) error {
+	parentNamespaceAttributes, parentXmlAttributes := getParentNamespaceAndXmlAttributes(inputXML)
+	inputXMLCopy := inputXML.Copy()
+	enhanceNamespaceAttributes(inputXMLCopy, parentNamespaceAttributes, parentXmlAttributes)
+	return canonicalWrite(w, canonicalPrepInPlace(inputXMLCopy, true, c.comments))
+}
+
+func (c *c14N10RecCanonicalizer) Algorithm() AlgorithmID {
+	if c.comments {
+		return CanonicalXML10WithCommentsAlgorithmId
+	}
+	return CanonicalXML10RecAlgorithmId
+
+}
+
+const nsSpace = "xmlns"
+
+// canonicalPrep accepts an *etree.Element and transforms it into one which is ready
+// for serialization into inclusive canonical form. Specifically this
+// entails:
+//
+// 1. Stripping re-declarations of namespaces
+// 2. Sorting attributes into canonical order
+//
+// Inclusive canonicalization does not strip unused namespaces.
+// The input element is not modified, the returned element is a copy.
+func canonicalPrep(el *etree.Element, strip bool, comments bool) *etree.Element {
+	return canonicalPrepInPlace(el.Copy(), strip, comments)
+}
+
+// canonicalPrepInPlace works like canonicalPrep, but transforms the element itself instead of a copy
+func canonicalPrepInPlace(el *etree.Element, strip bool, comments bool) *etree.Element {
+	canonicalPrepInner(el, map[string]string{}, strip, comments)
+	return el
+}
+
+// canonicalPrepInner transforms the element and its children in place. The map of the namespaces declared
+// so far is shared with the parent and only copied when the element declares a namespace.
+func canonicalPrepInner(el *etree.Element, seenSoFar map[string]string, strip bool, comments bool) {
+	sort.Sort(etreeutils.SortedAttrs(el.Attr))
+	copied := false
+	declare := func(key string, value string) {
+		if !copied {
+			seen := make(map[string]string, len(seenSoFar)+1)
+			for k, v := range seenSoFar {
+				seen[k] = v
+			}
+			seenSoFar, copied = seen, true
+		}
+		seenSoFar[key] = value
+	}
+
+	n := 0
+	for _, attr := range el.Attr {
+		if attr.Space != nsSpace && !(attr.Space == "" && attr.Key == nsSpace) {
+			el.Attr[n] = attr
+			n++
+			continue
+		}
+
+		if attr.Space == nsSpace {
+			key := attr.Space + ":" + attr.Key
+			if uri, seen := seenSoFar[key]; !seen || attr.Value != uri {
+				el.Attr[n] = attr
+				n++
+				declare(key, attr.Value)
+			}
+		} else {
+			if uri, seen := seenSoFar[nsSpace]; (!seen && attr.Value != "") || attr.Value != uri {
+				el.Attr[n] = attr
+				n++
+				declare(nsSpace, attr.Value)
+			}
+		}
+	}
+	el.Attr = el.Attr[:n]
+
+	if !comments {
+		c := 0
+		for c < len(el.Child) {
+			if _, ok := el.Child[c].(*etree.Comment); ok {
+				el.RemoveChildAt(c)
+			} else {
+				c++
+			}
+		}
+	}
+
+	for _, token := range el.Child {
+		if childElement, ok := token.(*etree.Element); ok {
+			canonicalPrepInner(childElement, seenSoFar, strip, comments)
+		}
+	}
+}
+
+// canonicalWriteSettings serialize the elements in canonical form
+var canonicalWriteSettings = etree.WriteSettings{
+	CanonicalAttrVal: true,
+	CanonicalEndTags: true,
+	CanonicalText:    true,
+}
+
+// canonicalBuffers reuses the serialization buffers, canonicalization runs for every signed and verified message
+var canonicalBuffers = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// canonicalWriters reuses the buffered writers for the writers etree can't write to directly
+var canonicalWriters = sync.Pool{
+	New: func() any { return bufio.NewWriterSize(nil, 4096) },
+}
+
+// canonicalBytes returns the canonical form of the element serialized into a pooled buffer
+func canonicalBytes(c StreamingCanonicalizer, el *etree.Element) ([]byte, error) {
+	buf := canonicalBuffers.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer canonicalBuffers.Put(buf)
+
+	if err := c.CanonicalizeTo(buf, el); err != nil {
+		return nil, err
+	}
+	return bytes.Clone(buf.Bytes()), nil
+}
+
+// canonicalWrite writes the element prepared for the canonical form, the element is not modified
+func canonicalWrite(w io.Writer, el *etree.Element) error {
+	if buf, ok := w.(*bytes.Buffer); ok {
+		el.WriteTo(buf, &canonicalWriteSettings)
+		return nil
+	}
+
+	bw := canonicalWriters.Get().(*bufio.Writer)
+	bw.Reset(w)
+	defer func() {
+		bw.Reset(nil)
+		canonicalWriters.Put(bw)
+	}()
+
+	el.WriteTo(bw, &canonicalWriteSettings)
+	return bw.Flush()
+}
+
+func getParentNamespaceAndXmlAttributes(el *etree.Element) (map[string]string, map[string]string) {
+	namespaceMap := make(map[string]string, 23)
+	xmlMap := make(map[string]string, 5)
+	parents := make([]*etree.Element, 0, 23)
+	n1 := el.Parent()
+	if n1 == nil {
+		return namespaceMap, xmlMap
+	}
+	parent := n1
+	for parent != nil {
+		parents = append(parents, parent)
+		parent = parent.Parent()
+	}
+	for i := len(parents) - 1; i > -1; i-- {
+		elementPos := parents[i]
+		for _, attr := range elementPos.Attr {
+			if attr.Space == "xmlns" && (attr.Key != "xml" || attr.Value != "http://www.w3.org/XML/1998/namespace") {
+				namespaceMap[attr.Key] = attr.Value
+			} else if attr.Space == "" && attr.Key == "xmlns" {
+				namespaceMap[attr.Key] = attr.Value
+			} else if attr.Space == "xml" {
+				xmlMap[attr.Key] = attr.Value
+			}
+		}
+	}
+	return namespaceMap, xmlMap
+}
+
+func enhanceNamespaceAttributes(el *etree.Element, parentNamespaces map[string]string, parentXmlAttributes map[string]string) {
+	for prefix, uri := range parentNamespaces {
+		if prefix == "xmlns" {
+			el.CreateAttr("xmlns", uri)
+		} else {
+			el.CreateAttr("xmlns:"+prefix, uri)
+		}
+	}
+	for attr, value := range parentXmlAttributes {
+		el.CreateAttr("xml:"+attr, value)
+	}
+}
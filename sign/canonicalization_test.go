@@ -1,9 +1,11 @@
-package fiskalhrgo
+package sign
 
 // SPDX-License-Identifier: Apache-2.0
 // This file is adapted from the github.com/russellhaering/goxmldsig project.
 
 import (
+	"crypto/sha1"
+	"errors"
 	"strings"
 	"testing"
 
@@ -33,6 +35,26 @@ func runCanonicalizationTest(t *testing.T, canonicalizer Canonicalizer, xmlstr s
 	canonicalized, err := canonicalizer.Canonicalize(raw.Root())
 	require.NoError(t, err)
 	require.Equal(t, canonicalXmlstr, string(canonicalized))
+
+	// The streamed canonical form is the same, also through a writer etree can't write to directly
+	streamed := etree.NewDocument()
+	require.NoError(t, streamed.ReadFromString(xmlstr))
+	var out strings.Builder
+	require.NoError(t, canonicalizer.(StreamingCanonicalizer).CanonicalizeTo(&out, streamed.Root()))
+	require.Equal(t, canonicalXmlstr, out.String())
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestCanonicalizeToWriteError(t *testing.T) {
+	raw := etree.NewDocument()
+	require.NoError(t, raw.ReadFromString(assertion))
+	err := MakeC14N11Canonicalizer().(StreamingCanonicalizer).CanonicalizeTo(failingWriter{}, raw.Root())
+	require.EqualError(t, err, "write failed")
 }
 
 func TestExcC14N10(t *testing.T) {
@@ -150,3 +172,67 @@ func TestC14N10RecCanonicalizerWithNamespaceInheritance(t *testing.T) {
 	require.Equal(t, strings.TrimSpace(expected), strings.TrimSpace(string(canonicalized)))
 
 }
+
+// benchmarkDocument returns a large request, nested elements with namespace declarations and a big text node
+// like an attachment
+func benchmarkDocument() []byte {
+	var b strings.Builder
+	b.WriteString(`<tns:RacunZahtjev xmlns:tns="http://www.apis-it.hr/fin/2012/types/f73" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" Id="bench"><tns:Racun><tns:Pdv>`)
+	for i := 0; i < 500; i++ {
+		b.WriteString(`<tns:Porez b="2" a="1"><tns:Stopa>25.00</tns:Stopa><tns:Osnovica>100.00</tns:Osnovica><!-- item --><tns:Iznos>25.00</tns:Iznos></tns:Porez>`)
+	}
+	b.WriteString(`</tns:Pdv><att:Prilog xmlns:att="urn:example:prilog">`)
+	b.WriteString(strings.Repeat("QUJDREVGR0hJSktMTU5PUFFSU1RVVldYWVo=", 2000))
+	b.WriteString(`</att:Prilog></tns:Racun></tns:RacunZahtjev>`)
+	return []byte(b.String())
+}
+
+func benchmarkCanonicalizer(b *testing.B, canonicalizer Canonicalizer) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(benchmarkDocument()); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		el := doc.Root().Copy()
+		b.StartTimer()
+		if _, err := canonicalizer.Canonicalize(el); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkExcC14N10(b *testing.B) {
+	benchmarkCanonicalizer(b, MakeC14N10ExclusiveCanonicalizerWithPrefixList(""))
+}
+
+// BenchmarkExcC14N10Digest streams the canonical form into the digest like signXML does
+func BenchmarkExcC14N10Digest(b *testing.B) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(benchmarkDocument()); err != nil {
+		b.Fatal(err)
+	}
+	canonicalizer := MakeC14N10ExclusiveCanonicalizerWithPrefixList("").(StreamingCanonicalizer)
+	digest := sha1.New()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		el := doc.Root().Copy()
+		digest.Reset()
+		b.StartTimer()
+		if err := canonicalizer.CanonicalizeTo(digest, el); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkC14N10Rec(b *testing.B) {
+	benchmarkCanonicalizer(b, MakeC14N10RecCanonicalizer())
+}
+
+func BenchmarkC14N11(b *testing.B) {
+	benchmarkCanonicalizer(b, MakeC14N11Canonicalizer())
+}
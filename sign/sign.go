@@ -0,0 +1,167 @@
+// Package sign creates and verifies the enveloped XML signatures (XML-DSig) of the fiscalization messages and
+// has the XML canonicalization algorithms they use, without any dependency on the rest of the library.
+//
+// The fiskalhrgo package signs the requests and verifies the CIS responses with it, its canonicalizers, VerifyXML
+// and VerifyXMLSigner are the ones of this package. Use the package directly to sign or verify other documents
+// with a key not held by a FiskalEntity, e.g. in a signing service.
+package sign
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// Enveloped signs the root element of the document with an enveloped signature referencing its Id: exclusive C14N,
+// a SHA-1 digest and the signature method (see SignatureMethod), with the certificate in the KeyInfo. signSHA1 signs
+// the SHA-1 hash of the canonical SignedInfo with the key of the certificate.
+//
+// The document is parsed once and canonicalized in place for the digest, the Signature is then inserted into
+// the original bytes before the closing tag of the root element, so the document is not serialized again.
+func Enveloped(xmlData []byte, cert *x509.Certificate, signatureMethod string, signSHA1 func(hashed []byte) ([]byte, error)) ([]byte, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(xmlData); err != nil {
+		return nil, fmt.Errorf("failed to parse XML document: %v", err)
+	}
+
+	root := doc.Root()
+	if root == nil {
+		return nil, fmt.Errorf("invalid XML: root element not found")
+	}
+
+	referenceID := root.SelectAttrValue("Id", "")
+	if referenceID == "" {
+		return nil, fmt.Errorf("no Id attribute found in the root element")
+	}
+	rootTag := root.FullTag()
+
+	// Canonicalize the root element straight into the SHA-1 DigestValue, the tree is not used afterwards
+	// so it's transformed in place
+	canonicalizer := MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+	digest := sha1.New()
+	if err := CanonicalizeTo(canonicalizer, digest, root); err != nil {
+		return nil, fmt.Errorf("failed to canonicalize XML document: %v", err)
+	}
+	digestValue := base64.StdEncoding.EncodeToString(digest.Sum(nil))
+
+	// Create the SignedInfo block with the DigestValue and hash a canonicalized copy of it
+	signedInfoElement := createSignedInfoElement(referenceID, digestValue, signatureMethod)
+	hashedSignedInfo := sha1.New()
+	if err := CanonicalizeTo(canonicalizer, hashedSignedInfo, signedInfoElement.Copy()); err != nil {
+		return nil, fmt.Errorf("failed to canonicalize SignedInfo: %v", err)
+	}
+
+	// Generate the SignatureValue of the hashed SignedInfo using the signer
+	signature, err := signSHA1(hashedSignedInfo.Sum(nil))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signature: %w", err)
+	}
+	signatureValue := base64.StdEncoding.EncodeToString(signature)
+
+	// Build the Signature block with certificate details using etree
+	signatureBlock := createSignatureElement(
+		signedInfoElement,
+		signatureValue,
+		cert,
+	)
+
+	return insertBeforeEndTag(xmlData, rootTag, signatureBlock)
+}
+
+func createSignedInfoElement(referenceURI, digestValue, signatureMethodID string) *etree.Element {
+	signedInfo := etree.NewElement("SignedInfo")
+	signedInfo.CreateAttr("xmlns", "http://www.w3.org/2000/09/xmldsig#")
+
+	canonicalizationMethod := signedInfo.CreateElement("CanonicalizationMethod")
+	canonicalizationMethod.CreateAttr("Algorithm", "http://www.w3.org/2001/10/xml-exc-c14n#")
+
+	signatureMethod := signedInfo.CreateElement("SignatureMethod")
+	signatureMethod.CreateAttr("Algorithm", signatureMethodID)
+
+	reference := signedInfo.CreateElement("Reference")
+	reference.CreateAttr("URI", "#"+referenceURI)
+
+	transforms := reference.CreateElement("Transforms")
+
+	transform1 := transforms.CreateElement("Transform")
+	transform1.CreateAttr("Algorithm", "http://www.w3.org/2000/09/xmldsig#enveloped-signature")
+
+	transform2 := transforms.CreateElement("Transform")
+	transform2.CreateAttr("Algorithm", "http://www.w3.org/2001/10/xml-exc-c14n#")
+
+	digestMethod := reference.CreateElement("DigestMethod")
+	digestMethod.CreateAttr("Algorithm", "http://www.w3.org/2000/09/xmldsig#sha1")
+
+	digestValueElement := reference.CreateElement("DigestValue")
+	digestValueElement.SetText(digestValue)
+
+	return signedInfo
+}
+
+func createSignatureElement(signedInfoElement *etree.Element, signatureValue string, cert *x509.Certificate) *etree.Element {
+	signatureElement := etree.NewElement("Signature")
+	signatureElement.CreateAttr("xmlns", "http://www.w3.org/2000/09/xmldsig#")
+
+	// Add the canonicalized SignedInfo element
+	signatureElement.AddChild(signedInfoElement)
+
+	// Add the SignatureValue
+	signatureValueElement := signatureElement.CreateElement("SignatureValue")
+	signatureValueElement.SetText(signatureValue)
+
+	// Add the KeyInfo
+	keyInfoElement := signatureElement.CreateElement("KeyInfo")
+	x509DataElement := keyInfoElement.CreateElement("X509Data")
+
+	// Add the X509Certificate
+	x509CertificateElement := x509DataElement.CreateElement("X509Certificate")
+	x509CertificateElement.SetText(base64.StdEncoding.EncodeToString(cert.Raw))
+
+	// Add the X509IssuerSerial
+	x509IssuerSerialElement := x509DataElement.CreateElement("X509IssuerSerial")
+
+	x509IssuerNameElement := x509IssuerSerialElement.CreateElement("X509IssuerName")
+	x509IssuerNameElement.SetText(cert.Issuer.String())
+
+	x509SerialNumberElement := x509IssuerSerialElement.CreateElement("X509SerialNumber")
+	x509SerialNumberElement.SetText(cert.SerialNumber.String())
+
+	return signatureElement
+}
+
+// insertBeforeEndTag inserts the element before the closing tag of the root element. A self-closing
+// root element is expanded by parsing and serializing the document again.
+func insertBeforeEndTag(xmlData []byte, rootTag string, el *etree.Element) ([]byte, error) {
+	var element bytes.Buffer
+	el.WriteTo(&element, &etree.WriteSettings{})
+
+	trimmed := bytes.TrimRight(xmlData, " \t\r\n")
+	end := bytes.LastIndex(trimmed, []byte("</"))
+	if end >= 0 && bytes.HasSuffix(trimmed, []byte(">")) &&
+		strings.TrimSpace(string(trimmed[end+2:len(trimmed)-1])) == rootTag {
+		output := make([]byte, 0, len(xmlData)+element.Len())
+		output = append(output, xmlData[:end]...)
+		output = append(output, element.Bytes()...)
+		return append(output, xmlData[end:]...), nil
+	}
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(xmlData); err != nil {
+		return nil, fmt.Errorf("failed to parse XML document: %v", err)
+	}
+	doc.Root().AddChild(el)
+	output, err := doc.WriteToBytes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize signed XML: %v", err)
+	}
+	return output, nil
+}
@@ -0,0 +1,73 @@
+package sign
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestCertificate(t *testing.T) (*rsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "fiskalsigntest"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, cert
+}
+
+func TestEnvelopedAndVerify(t *testing.T) {
+	key, cert := newTestCertificate(t)
+	_, other := newTestCertificate(t)
+	signSHA1 := func(hashed []byte) ([]byte, error) {
+		return rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA1, hashed)
+	}
+	document := `<tns:Arhiva xmlns:tns="http://www.apis-it.hr/fin/2012/types/f73" Id="A1"><tns:Jir>9d6f5bb6-da48-4fcd-a803-4586a025e0e4</tns:Jir></tns:Arhiva>`
+
+	signed, err := Enveloped([]byte(document), cert, SignatureMethod(cert.PublicKeyAlgorithm, crypto.SHA1), signSHA1)
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	if !strings.HasPrefix(string(signed), document[:len(document)-len("</tns:Arhiva>")]) || !strings.Contains(string(signed), RSASHA1SignatureMethod) {
+		t.Errorf("Expected the signature appended to the unchanged document, got %s", signed)
+	}
+	if err := Verify(signed, cert); err != nil {
+		t.Errorf("Expected a valid signature, got %v", err)
+	}
+	if signer, err := VerifySigner(signed); err != nil || !signer.Equal(cert) {
+		t.Errorf("Expected the KeyInfo certificate, got %v", err)
+	}
+	if err := Verify(signed, other); err == nil {
+		t.Error("Expected an error for another certificate")
+	}
+	if err := Verify([]byte(strings.Replace(string(signed), "9d6f5bb6", "00000000", 1)), cert); err == nil {
+		t.Error("Expected an error for a modified document")
+	}
+
+	if _, err := Enveloped([]byte(`<Arhiva/>`), cert, RSASHA1SignatureMethod, signSHA1); err == nil {
+		t.Error("Expected an error for a document without an Id")
+	}
+}
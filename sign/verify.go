@@ -0,0 +1,293 @@
+package sign
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+
+	"github.com/beevik/etree"
+	"github.com/l-d-t/fiskalhrgo/etreeutils"
+)
+
+// Verify verifies the enveloped XML signature of the document root element (referenced by its Id) with the
+// certificate. The certificate in the KeyInfo of the signature is ignored, only the given certificate is trusted.
+func Verify(xmlData []byte, cert *x509.Certificate) error {
+	if cert == nil {
+		return errors.New("certificate is nil")
+	}
+	root, err := parseSignedRoot(xmlData)
+	if err != nil {
+		return err
+	}
+	return verifyEnvelopedElement(root, cert)
+}
+
+// VerifySigner verifies the enveloped XML signature of the document root element with the certificate from
+// the KeyInfo of the signature and returns the certificate. The signature only proves the document was signed
+// with the key of the returned certificate, check that the certificate is trusted.
+func VerifySigner(xmlData []byte) (*x509.Certificate, error) {
+	root, err := parseSignedRoot(xmlData)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := envelopedSignature(root)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := KeyInfoCertificate(signature)
+	if err != nil {
+		return nil, err
+	}
+	if cert == nil {
+		return nil, errors.New("signature has no X509Certificate")
+	}
+	if err := verifyEnvelopedElement(root, cert); err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// VerifyEnvelope verifies the signature of the only message in the SOAP Body. The signature must be
+// a child of the message and reference it by its Id, so a signed element can't be wrapped in an unsigned message.
+func VerifyEnvelope(xmlData []byte, cert *x509.Certificate) error {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(xmlData); err != nil {
+		return fmt.Errorf("failed to parse XML: %v", err)
+	}
+	root := doc.Root()
+	if root == nil || root.Tag != "Envelope" {
+		return errors.New("SOAP Envelope not found")
+	}
+	body := root.SelectElement("Body")
+	if body == nil || len(body.ChildElements()) != 1 {
+		return errors.New("the SOAP Body must contain exactly one message")
+	}
+	return verifyEnvelopedElement(body.ChildElements()[0], cert)
+}
+
+// EnvelopeSignature returns the signature of the message in the SOAP Body, nil if there is none
+func EnvelopeSignature(xmlData []byte) (*etree.Element, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(xmlData); err != nil {
+		return nil, err
+	}
+	root := doc.Root()
+	if root == nil || root.Tag != "Envelope" {
+		return nil, nil
+	}
+	body := root.SelectElement("Body")
+	if body == nil || len(body.ChildElements()) != 1 {
+		return nil, nil
+	}
+	return envelopedSignature(body.ChildElements()[0])
+}
+
+// KeyInfoCertificate returns the certificate from the KeyInfo of the signature, nil if there is none
+func KeyInfoCertificate(signature *etree.Element) (*x509.Certificate, error) {
+	certElement := signature.FindElement("./KeyInfo/X509Data/X509Certificate")
+	if certElement == nil {
+		return nil, nil
+	}
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(certElement.Text()), ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid X509Certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("invalid X509Certificate: %v", err)
+	}
+	return cert, nil
+}
+
+// VerifySignatureValue verifies the XML-DSig signature value of the hash, RSA PKCS #1 v1.5 or ECDSA (r and s concatenated)
+func VerifySignatureValue(publicKey crypto.PublicKey, hash crypto.Hash, hashed []byte, signature []byte) error {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(key, hash, hashed, signature); err != nil {
+			return errors.New("signature verification failed")
+		}
+	case *ecdsa.PublicKey:
+		half := len(signature) / 2
+		r, s := new(big.Int).SetBytes(signature[:half]), new(big.Int).SetBytes(signature[half:])
+		if len(signature)%2 != 0 || !ecdsa.Verify(key, hashed, r, s) {
+			return errors.New("signature verification failed")
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+	return nil
+}
+
+// verifyEnvelopedElement verifies the signature enveloped in the message element, referencing it by its Id
+func verifyEnvelopedElement(message *etree.Element, cert *x509.Certificate) error {
+	signature, err := envelopedSignature(message)
+	if err != nil {
+		return err
+	}
+
+	signedInfo := signature.SelectElement("SignedInfo")
+	signatureValue := signature.SelectElement("SignatureValue")
+	if signedInfo == nil || signatureValue == nil {
+		return errors.New("signature has no SignedInfo or SignatureValue")
+	}
+	references := signedInfo.SelectElements("Reference")
+	if len(references) != 1 {
+		return errors.New("signature must have exactly one Reference")
+	}
+	reference := references[0]
+	id := message.SelectAttrValue("Id", "")
+	if id == "" || reference.SelectAttrValue("URI", "") != "#"+id {
+		return errors.New("signature reference does not match the message Id")
+	}
+
+	// Reference transforms, the result is canonicalized with inclusive C14N 1.0 if there is no canonicalization transform
+	enveloped := false
+	digestCanonicalizer := MakeC14N10RecCanonicalizer()
+	if transforms := reference.SelectElement("Transforms"); transforms != nil {
+		for _, transform := range transforms.SelectElements("Transform") {
+			algorithm := transform.SelectAttrValue("Algorithm", "")
+			if AlgorithmID(algorithm) == EnvelopedSignatureAltorithmId {
+				enveloped = true
+				continue
+			}
+			canonicalizer, err := canonicalizerFor(transform)
+			if err != nil {
+				return err
+			}
+			digestCanonicalizer = canonicalizer
+		}
+	}
+	if !enveloped {
+		return errors.New("signature is not enveloped")
+	}
+
+	digestMethod := reference.SelectElement("DigestMethod")
+	digestValue := reference.SelectElement("DigestValue")
+	if digestMethod == nil || digestValue == nil {
+		return errors.New("reference has no DigestMethod or DigestValue")
+	}
+	digestHash, ok := digestAlgorithmsByIdentifier[digestMethod.SelectAttrValue("Algorithm", "")]
+	if !ok {
+		return fmt.Errorf("unsupported digest method %s", digestMethod.SelectAttrValue("Algorithm", ""))
+	}
+
+	// Check the digest of the message without the signature
+	expectedDigest, err := base64.StdEncoding.DecodeString(strings.TrimSpace(digestValue.Text()))
+	if err != nil {
+		return fmt.Errorf("invalid DigestValue: %v", err)
+	}
+	digest := digestHash.New()
+	if err := canonicalizeInContext(digestCanonicalizer, digest, message, signature); err != nil {
+		return fmt.Errorf("failed to canonicalize the message: %v", err)
+	}
+	if !bytes.Equal(digest.Sum(nil), expectedDigest) {
+		return errors.New("digest mismatch, the message was modified after signing")
+	}
+
+	// Check the signature of SignedInfo
+	canonicalizationMethod := signedInfo.SelectElement("CanonicalizationMethod")
+	if canonicalizationMethod == nil {
+		return errors.New("signature has no CanonicalizationMethod")
+	}
+	signedInfoCanonicalizer, err := canonicalizerFor(canonicalizationMethod)
+	if err != nil {
+		return err
+	}
+
+	signatureMethod := signedInfo.SelectElement("SignatureMethod")
+	if signatureMethod == nil {
+		return errors.New("signature has no SignatureMethod")
+	}
+	method, ok := signatureMethodsByIdentifier[signatureMethod.SelectAttrValue("Algorithm", "")]
+	if !ok || method.PublicKeyAlgorithm != cert.PublicKeyAlgorithm {
+		return fmt.Errorf("unsupported signature method %s", signatureMethod.SelectAttrValue("Algorithm", ""))
+	}
+	signatureBytes, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(signatureValue.Text()), ""))
+	if err != nil {
+		return fmt.Errorf("invalid SignatureValue: %v", err)
+	}
+	hash := method.Hash.New()
+	if err := canonicalizeInContext(signedInfoCanonicalizer, hash, signedInfo, nil); err != nil {
+		return fmt.Errorf("failed to canonicalize SignedInfo: %v", err)
+	}
+	return VerifySignatureValue(cert.PublicKey, method.Hash, hash.Sum(nil), signatureBytes)
+}
+
+// envelopedSignature returns the only XML signature among the children of the element
+func envelopedSignature(el *etree.Element) (*etree.Element, error) {
+	var signature *etree.Element
+	for _, child := range el.ChildElements() {
+		if child.Tag == SignatureTag && child.NamespaceURI() == Namespace {
+			if signature != nil {
+				return nil, errors.New("more than one signature")
+			}
+			signature = child
+		}
+	}
+	if signature == nil {
+		return nil, errors.New("the message is not signed")
+	}
+	return signature, nil
+}
+
+// canonicalizerFor returns the canonicalizer of the CanonicalizationMethod or Transform element
+func canonicalizerFor(el *etree.Element) (Canonicalizer, error) {
+	algorithm := AlgorithmID(el.SelectAttrValue("Algorithm", ""))
+	switch algorithm {
+	case CanonicalXML10RecAlgorithmId:
+		return MakeC14N10RecCanonicalizer(), nil
+	case CanonicalXML10WithCommentsAlgorithmId:
+		return MakeC14N10WithCommentsCanonicalizer(), nil
+	case CanonicalXML10ExclusiveAlgorithmId, CanonicalXML10ExclusiveWithCommentsAlgorithmId:
+		prefixList := ""
+		if inclusiveNamespaces := el.SelectElement("InclusiveNamespaces"); inclusiveNamespaces != nil {
+			prefixList = inclusiveNamespaces.SelectAttrValue(PrefixListAttr, "")
+		}
+		if algorithm == CanonicalXML10ExclusiveWithCommentsAlgorithmId {
+			return MakeC14N10ExclusiveWithCommentsCanonicalizerWithPrefixList(prefixList), nil
+		}
+		return MakeC14N10ExclusiveCanonicalizerWithPrefixList(prefixList), nil
+	}
+	return nil, fmt.Errorf("unsupported canonicalization method %s", algorithm)
+}
+
+// canonicalizeInContext writes the canonical form of a copy of the element with the namespaces declared on its
+// ancestors, without the excluded child (the enveloped signature), the element itself is not modified
+func canonicalizeInContext(canonicalizer Canonicalizer, w io.Writer, el *etree.Element, exclude *etree.Element) error {
+	ctx, err := etreeutils.NSBuildParentContext(el)
+	if err != nil {
+		return err
+	}
+	detached, err := etreeutils.NSDetatch(ctx, el)
+	if err != nil {
+		return err
+	}
+	if exclude != nil {
+		detached.RemoveChildAt(exclude.Index())
+	}
+	return CanonicalizeTo(canonicalizer, w, detached)
+}
+
+func parseSignedRoot(xmlData []byte) (*etree.Element, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(xmlData); err != nil {
+		return nil, fmt.Errorf("failed to parse XML: %v", err)
+	}
+	root := doc.Root()
+	if root == nil {
+		return nil, errors.New("invalid XML: root element not found")
+	}
+	return root, nil
+}
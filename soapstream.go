@@ -0,0 +1,146 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// soapBodyContent returns the inner content of the SOAP Body, like unmarshaling into iSOAPEnvelopeNoNamespace.
+// The envelope is walked with a streaming decoder and the elements in the Body are skipped, not decoded, so the
+// content is a sub-slice of the data and a large response is not copied. The content is empty without a Body.
+func soapBodyContent(data []byte) ([]byte, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	root, err := nextStartElement(decoder)
+	if err != nil {
+		return nil, err
+	}
+	if root.Name.Local != "Envelope" {
+		return nil, fmt.Errorf("expected element type <Envelope> but have <%s>", root.Name.Local)
+	}
+
+	var content []byte
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "Body" && content == nil {
+				if content, err = elementContent(decoder, data); err != nil {
+					return nil, err
+				}
+			} else if err := decoder.Skip(); err != nil {
+				return nil, err
+			}
+		case xml.EndElement:
+			if content == nil {
+				content = []byte{}
+			}
+			return content, nil
+		}
+	}
+}
+
+// elementContent returns the inner content of the element whose start element was just read,
+// the child elements are skipped
+func elementContent(decoder *xml.Decoder, data []byte) ([]byte, error) {
+	start := decoder.InputOffset()
+	for {
+		end := decoder.InputOffset()
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch token.(type) {
+		case xml.StartElement:
+			if err := decoder.Skip(); err != nil {
+				return nil, err
+			}
+		case xml.EndElement:
+			return data[start:end:end], nil
+		}
+	}
+}
+
+// nextStartElement returns the next start element, skipping the prolog, comments and whitespace
+func nextStartElement(decoder *xml.Decoder) (xml.StartElement, error) {
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return xml.StartElement{}, err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start, nil
+		}
+	}
+}
+
+// truncatedSOAPFault returns the SOAP Fault at the start of a response cut at the size limit, or nil if there is
+// none. The faultcode, faultstring and faultactor are read as long as the data lasts, the detail is dropped.
+func truncatedSOAPFault(data []byte, statusCode int) *SOAPFaultError {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	root, err := nextStartElement(decoder)
+	if err != nil {
+		return nil
+	}
+	if root.Name.Local == "Envelope" {
+		body, err := nextStartElement(decoder)
+		if err == nil && body.Name.Local == "Header" {
+			if err = decoder.Skip(); err == nil {
+				body, err = nextStartElement(decoder)
+			}
+		}
+		if err != nil || body.Name.Local != "Body" {
+			return nil
+		}
+		if root, err = nextStartElement(decoder); err != nil {
+			return nil
+		}
+	}
+	if root.Name.Local != "Fault" {
+		return nil
+	}
+
+	fault := &SOAPFaultError{StatusCode: statusCode}
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		var field *string
+		switch start.Name.Local {
+		case "faultcode":
+			field = &fault.Code
+		case "faultstring":
+			field = &fault.String
+		case "faultactor":
+			field = &fault.Actor
+		}
+		if field == nil {
+			if err := decoder.Skip(); err != nil {
+				break
+			}
+			continue
+		}
+		var text string
+		if err := decoder.DecodeElement(&text, &start); err != nil {
+			break
+		}
+		*field = strings.TrimSpace(text)
+	}
+	if fault.Code == "" && fault.String == "" {
+		return nil
+	}
+	return fault
+}
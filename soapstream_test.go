@@ -0,0 +1,106 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSOAPBodyContent(t *testing.T) {
+	for _, data := range []string{
+		`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><tns:EchoResponse xmlns:tns="http://www.apis-it.hr/fin/2012/types/f73">hello</tns:EchoResponse></soap:Body></soap:Envelope>`,
+		`<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<Envelope><Header><Security/></Header><Body>` + "\n  <A><B>1</B><!-- comment --></A>\n" + `</Body></Envelope>`,
+		`<Envelope><Body/></Envelope>`,
+		`<Envelope></Envelope>`,
+	} {
+		content, err := soapBodyContent([]byte(data))
+		if err != nil {
+			t.Errorf("Failed to parse %s: %v", data, err)
+			continue
+		}
+		var envelope iSOAPEnvelopeNoNamespace
+		if err := xml.Unmarshal([]byte(data), &envelope); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(content, envelope.Body.Content) {
+			t.Errorf("Expected %q, got %q", envelope.Body.Content, content)
+		}
+		if len(content) > 0 && !strings.Contains(data, string(content)) {
+			t.Errorf("Expected the content to be a part of the data, got %q", content)
+		}
+	}
+
+	for _, data := range []string{
+		``,
+		`<Body>x</Body>`,
+		`<Envelope><Body><A></Body></Envelope>`,
+		`<Envelope><Body>x</Body>`,
+	} {
+		if _, err := soapBodyContent([]byte(data)); err == nil {
+			t.Errorf("Expected an error for %q", data)
+		}
+	}
+}
+
+func TestTruncatedSOAPFault(t *testing.T) {
+	data := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Header/><soap:Body><soap:Fault>` +
+		`<faultcode> soap:Server </faultcode><faultstring>Internal error</faultstring><detail>` + strings.Repeat("<trace>at x</trace>", 100)
+	fault := truncatedSOAPFault([]byte(data), http.StatusInternalServerError)
+	if fault == nil {
+		t.Fatal("Expected the fault")
+	}
+	if fault.Code != "soap:Server" || fault.String != "Internal error" || fault.Detail != "" || fault.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Unexpected fault %+v", fault)
+	}
+
+	for _, data := range []string{
+		`<Envelope><Body><RacunOdgovor>` + strings.Repeat("x", 100),
+		`<Envelope><Body><Fault><detail>`,
+		`<Env`,
+	} {
+		if fault := truncatedSOAPFault([]byte(data), 0); fault != nil {
+			t.Errorf("Expected no fault for %q, got %+v", data, fault)
+		}
+	}
+}
+
+func TestOversizedSOAPFault(t *testing.T) {
+	fe := newTestServerEntity(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault>` +
+			`<faultcode>soap:Server</faultcode><faultstring>Internal error</faultstring><detail>` +
+			strings.Repeat("<trace>at hr.apis.cis.Service</trace>", 1000) + `</detail></soap:Fault></soap:Body></soap:Envelope>`))
+	})
+	fe.SetMaxResponseSize(1024)
+
+	_, err := fe.EchoRequest("hello")
+	if !errors.Is(err, ErrResponseTooLarge) {
+		t.Fatalf("Expected ErrResponseTooLarge, got %v", err)
+	}
+	var fault *SOAPFaultError
+	if !errors.As(err, &fault) || fault.String != "Internal error" {
+		t.Fatalf("Expected the SOAP fault of the oversized response, got %v", err)
+	}
+	var fErr *FiskalError
+	if !errors.As(err, &fErr) || fErr.Category != CategoryCISSystem || fErr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Expected a CIS system error with the status code, got %+v", fErr)
+	}
+}
+
+func BenchmarkSOAPBodyContent(b *testing.B) {
+	data := []byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><tns:RacunOdgovor xmlns:tns="http://www.apis-it.hr/fin/2012/types/f73">` +
+		strings.Repeat("<tns:Greska><tns:SifraGreske>s001</tns:SifraGreske></tns:Greska>", 1000) + `</tns:RacunOdgovor></soap:Body></soap:Envelope>`)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := soapBodyContent(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
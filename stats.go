@@ -0,0 +1,178 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"sync"
+	"time"
+)
+
+// Stats are the aggregated fiscalization statistics of an entity, kept in memory since the entity was created
+// or the last ResetStats, for quick operational dashboards without a metrics stack (see Metrics for that)
+type Stats struct {
+	// Since is the start of the statistics
+	Since time.Time
+
+	// Requests is the number of the requests sent to CIS (all operations), Succeeded and Failed split them
+	// by the outcome as reported to Metrics, Errors counts the failed ones by the error category
+	Requests  int
+	Succeeded int
+	Failed    int
+	Errors    map[ErrorCategory]int
+
+	// AverageLatency and MaxLatency are the CIS round-trip times of the requests
+	AverageLatency time.Duration
+	MaxLatency     time.Duration
+
+	// Invoices is the number of the invoice requests, Fiscalized of those that got the JIR and
+	// FailedInvoices of those that failed for any reason (including the invalid input)
+	Invoices       int
+	Fiscalized     int
+	FailedInvoices int
+
+	// Total is the total amount of the fiscalized invoices, PaymentMethods the totals per payment method
+	Total          string
+	PaymentMethods map[PaymentMethod]StatsPaymentMethod
+
+	// Tips is the number of the fiscalized invoices with a tip, TipsTotal their total amount
+	Tips      int
+	TipsTotal string
+}
+
+// StatsPaymentMethod is the number and the total amount of the fiscalized invoices paid with the payment method
+type StatsPaymentMethod struct {
+	Invoices int
+	Total    string
+}
+
+// statsCollector keeps the statistics of an entity, the zero value is ready to use
+type statsCollector struct {
+	mu sync.Mutex
+	statsData
+}
+
+// statsData are the counters of the statsCollector
+type statsData struct {
+	since     time.Time
+	requests  int
+	succeeded int
+	errors    map[ErrorCategory]int
+	latency   time.Duration
+	maxLat    time.Duration
+
+	invoices       int
+	fiscalized     int
+	failedInvoices int
+	total          int64
+	methods        map[PaymentMethod]int
+	methodTotals   map[PaymentMethod]int64
+	tips           int
+	tipsTotal      int64
+}
+
+// Stats returns a snapshot of the fiscalization statistics
+func (fe *FiskalEntity) Stats() Stats {
+	s := &fe.stats
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := Stats{
+		Since:          s.since,
+		Requests:       s.requests,
+		Succeeded:      s.succeeded,
+		Failed:         s.requests - s.succeeded,
+		Errors:         make(map[ErrorCategory]int, len(s.errors)),
+		MaxLatency:     s.maxLat,
+		Invoices:       s.invoices,
+		Fiscalized:     s.fiscalized,
+		FailedInvoices: s.failedInvoices,
+		Total:          formatCents(s.total),
+		PaymentMethods: make(map[PaymentMethod]StatsPaymentMethod, len(s.methods)),
+		Tips:           s.tips,
+		TipsTotal:      formatCents(s.tipsTotal),
+	}
+	if s.requests > 0 {
+		stats.AverageLatency = s.latency / time.Duration(s.requests)
+	}
+	for category, count := range s.errors {
+		stats.Errors[category] = count
+	}
+	for method, count := range s.methods {
+		stats.PaymentMethods[method] = StatsPaymentMethod{Invoices: count, Total: formatCents(s.methodTotals[method])}
+	}
+	return stats
+}
+
+// ResetStats clears the statistics, Since is set to now
+func (fe *FiskalEntity) ResetStats() {
+	s := &fe.stats
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statsData = statsData{since: time.Now()}
+}
+
+// init sets the start time and the maps of a zero collector, it must be called with the lock held
+func (s *statsCollector) init() {
+	if s.since.IsZero() {
+		s.since = time.Now()
+	}
+	if s.errors == nil {
+		s.errors = make(map[ErrorCategory]int)
+		s.methods = make(map[PaymentMethod]int)
+		s.methodTotals = make(map[PaymentMethod]int64)
+	}
+}
+
+// observeRequest counts a request sent to CIS
+func (s *statsCollector) observeRequest(duration time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.init()
+	s.requests++
+	s.latency += duration
+	s.maxLat = max(s.maxLat, duration)
+	if err == nil {
+		s.succeeded++
+		return
+	}
+	s.errors[ErrorCategory(outcomeOf(err))]++
+}
+
+// observeInvoice counts the outcome of an invoice request, the amounts of the fiscalized ones are summed
+func (s *statsCollector) observeInvoice(invoice *RacunType, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.init()
+	s.invoices++
+	if err != nil {
+		s.failedInvoices++
+		return
+	}
+	s.fiscalized++
+	method := PaymentMethod(invoice.NacinPlac)
+	s.methods[method]++
+	if amount, err := parseCents(invoice.IznosUkupno); err == nil {
+		s.total += amount
+		s.methodTotals[method] += amount
+	}
+	if invoice.Napojnica != nil {
+		s.observeTip(invoice.Napojnica.IznosNapojnice)
+	}
+}
+
+// observeTip adds the tip amount, it must be called with the lock held
+func (s *statsCollector) observeTip(amount string) {
+	s.tips++
+	if cents, err := parseCents(amount); err == nil {
+		s.tipsTotal += cents
+	}
+}
+
+// recordStats counts the invoice request, the requests answered from the journal are skipped
+func (fe *FiskalEntity) recordStats(invoice *RacunType, result *InvoiceResult, err error) {
+	if fe == nil || result.FromJournal {
+		return
+	}
+	fe.stats.observeInvoice(invoice, err)
+}
@@ -0,0 +1,89 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+func TestStats(t *testing.T) {
+	key, cert := newTestCISSigningCert(t)
+	fe := newTestServerEntity(t, func(w http.ResponseWriter, r *http.Request) {
+		doc := etree.NewDocument()
+		if _, err := doc.ReadFrom(r.Body); err != nil {
+			t.Error(err)
+			return
+		}
+		if doc.FindElement("//OznNapUr").Text() == "2" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		response := fmt.Sprintf(testCISResponse, "G0x1", doc.FindElement("//IdPoruke").Text(), doc.FindElement("//DatumVrijeme").Text(), "9d6f5bb6-da48-4fcd-a803-4586a025e0e4")
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprint(w, signTestCISResponse(t, key, response, MakeC14N10RecCanonicalizer()))
+	})
+	fe.ciscert = newSignatureCheckCIScert(cert, fe.ciscert.SSLverifyPoll)
+
+	if stats := fe.Stats(); stats.Requests != 0 || stats.Total != "0.00" || stats.Since.IsZero() {
+		t.Errorf("Expected empty statistics, got %+v", stats)
+	}
+
+	send := func(number, device uint, total string, method PaymentMethod) error {
+		invoice, _, err := fe.NewCISInvoice(time.Now(), number, device, nil, nil, nil, "0.00", "0.00", "0.00", nil, total, method, "12345678901")
+		if err != nil {
+			t.Fatalf("Failed to create invoice: %v", err)
+		}
+		if number == 3 {
+			invoice.Napojnica = &NapojnicaType{IznosNapojnice: "2.50", NacinPlacanjaNapojnice: string(CISCard)}
+		}
+		_, _, err = invoice.InvoiceRequest()
+		return err
+	}
+	for number, total := range []string{"10.00", "5.50"} {
+		if err := send(uint(number+1), 1, total, CISCash); err != nil {
+			t.Fatalf("Failed to send invoice: %v", err)
+		}
+	}
+	if err := send(3, 1, "20.00", CISCard); err != nil {
+		t.Fatalf("Failed to send invoice: %v", err)
+	}
+	if err := send(4, 2, "1.00", CISCash); err == nil {
+		t.Fatal("Expected the request to fail")
+	}
+
+	stats := fe.Stats()
+	if stats.Requests != 4 || stats.Succeeded != 3 || stats.Failed != 1 || stats.Errors[CategoryCISSystem]+stats.Errors[CategoryResponse] != 1 {
+		t.Errorf("Unexpected request counts %+v", stats)
+	}
+	if stats.AverageLatency <= 0 || stats.MaxLatency < stats.AverageLatency {
+		t.Errorf("Expected the latencies, got %v %v", stats.AverageLatency, stats.MaxLatency)
+	}
+	if stats.Invoices != 4 || stats.Fiscalized != 3 || stats.FailedInvoices != 1 || stats.Total != "35.50" {
+		t.Errorf("Unexpected invoice counts %+v", stats)
+	}
+	if cash := stats.PaymentMethods[CISCash]; cash.Invoices != 2 || cash.Total != "15.50" {
+		t.Errorf("Unexpected cash total %+v", cash)
+	}
+	if stats.Tips != 1 || stats.TipsTotal != "2.50" {
+		t.Errorf("Unexpected tips %d %s", stats.Tips, stats.TipsTotal)
+	}
+
+	// The snapshot is a copy
+	stats.Errors[CategoryTransport] = 10
+	if fe.Stats().Errors[CategoryTransport] != 0 {
+		t.Error("Expected Stats to return a copy")
+	}
+
+	before := time.Now()
+	fe.ResetStats()
+	if stats := fe.Stats(); stats.Requests != 0 || stats.Invoices != 0 || len(stats.PaymentMethods) != 0 || stats.Since.Before(before) {
+		t.Errorf("Expected the statistics to be reset, got %+v", stats)
+	}
+}
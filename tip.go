@@ -0,0 +1,61 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+)
+
+// AddTipRequest reports a tip (napojnica) given on an already fiscalized invoice, e.g. a tip added at the card
+// settlement after the JIR was received. The NapojnicaZahtjev carries the original invoice data unchanged,
+// with the ZKI validated like in InvoiceRequest, and the tip amount (two decimals, e.g. "2.50") and its payment
+// method. The invoice itself is not changed, a tip known when the invoice is issued is set on the invoice instead.
+//
+// It returns the CIS response with the confirmation in PorukaOdgovora. All errors are *FiskalError, the errors
+// returned by CIS are CISErrors (usually of the p series, see ErrCISLaterChange).
+func (invoice *RacunType) AddTipRequest(amount string, method PaymentMethod) (*NapojnicaOdgovor, error) {
+	if !IsValidCurrencyFormat(amount) || amount == "0.00" {
+		return nil, newFiskalError(CategoryInput, fmt.Errorf("the tip amount %q must be a positive amount with two decimals", amount))
+	}
+	if err := method.IsValid(); err != nil {
+		return nil, newFiskalError(CategoryInput, err)
+	}
+	if err := invoice.checkLaterChange(); err != nil {
+		return nil, err
+	}
+
+	// The tip is sent with a copy of the invoice, so the invoice can still be resent unchanged
+	racun := *invoice
+	racun.Napojnica = &NapojnicaType{IznosNapojnice: amount, NacinPlacanjaNapojnice: string(method)}
+
+	// The IDProvider derives the ids from the invoice, they would be the ones of the invoice request
+	zahtjev := NapojnicaZahtjev{
+		Zaglavlje: newFiskalHeader(GenerateID()),
+		Racun:     &racun,
+		Xmlns:     DefaultNamespace,
+		IdAttr:    GenerateID(),
+	}
+	xmlData, err := xml.MarshalIndent(zahtjev, "", " ")
+	if err != nil {
+		return nil, newFiskalError(CategoryInput, fmt.Errorf("error marshalling NapojnicaZahtjev: %w", err))
+	}
+
+	fe := invoice.pointerToEntity
+	attrs := []slog.Attr{slog.String("invoice", invoiceNumber(invoice)), slog.String("zki", invoice.ZastKod), slog.String("tip", amount)}
+	var odgovor NapojnicaOdgovor
+	parsed, err := fe.laterChangeRequest(zahtjev.Zaglavlje, xmlData, invoice.requestHeaders, &odgovor)
+	if err != nil {
+		fe.log(failureLevel, "tip request failed", append(attrs, errorAttrs(err)...)...)
+		err = fe.redactError(err)
+		if !parsed {
+			return nil, err
+		}
+		return &odgovor, err
+	}
+	fe.log(successLevel, "tip reported", attrs...)
+	return &odgovor, nil
+}
@@ -0,0 +1,83 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+const testNapojnicaOdgovor = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><tns:NapojnicaOdgovor xmlns:tns="http://www.apis-it.hr/fin/2012/types/f73" Id="G0x2">
+	<tns:Zaglavlje><tns:IdPoruke>%s</tns:IdPoruke><tns:DatumVrijeme>%s</tns:DatumVrijeme></tns:Zaglavlje>
+	<tns:PorukaOdgovora><tns:SifraPoruke>p001</tns:SifraPoruke><tns:Poruka>Napojnica zaprimljena</tns:Poruka></tns:PorukaOdgovora>%s
+</tns:NapojnicaOdgovor></soap:Body></soap:Envelope>`
+
+func TestAddTipRequest(t *testing.T) {
+	key, cert := newTestCISSigningCert(t)
+	var greske string
+	var request *etree.Document
+	fe := newTestServerEntity(t, func(w http.ResponseWriter, r *http.Request) {
+		request = etree.NewDocument()
+		if _, err := request.ReadFrom(r.Body); err != nil {
+			t.Error(err)
+			return
+		}
+		response := fmt.Sprintf(testNapojnicaOdgovor, request.FindElement("//IdPoruke").Text(), request.FindElement("//DatumVrijeme").Text(), greske)
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprint(w, signTestCISResponse(t, key, response, MakeC14N10RecCanonicalizer()))
+	})
+	fe.ciscert = newSignatureCheckCIScert(cert, fe.ciscert.SSLverifyPoll)
+
+	invoice, zki, err := fe.NewCISInvoice(time.Now(), 5, 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "20.00", CISCard, "12345678901")
+	if err != nil {
+		t.Fatalf("Failed to create invoice: %v", err)
+	}
+
+	odgovor, err := invoice.AddTipRequest("2.50", CISCard)
+	if err != nil {
+		t.Fatalf("Failed to report the tip: %v", err)
+	}
+	if odgovor.PorukaOdgovora == nil || odgovor.PorukaOdgovora.Poruka != "Napojnica zaprimljena" || odgovor.HasErrors() {
+		t.Errorf("Unexpected response %+v", odgovor)
+	}
+	if request.FindElement("//Body/NapojnicaZahtjev") == nil || request.FindElement("//Racun/ZastKod").Text() != zki ||
+		request.FindElement("//Napojnica/iznosNapojnice").Text() != "2.50" || request.FindElement("//Napojnica/nacinPlacanjaNapojnice").Text() != "K" {
+		t.Error("Expected the tip with the original invoice data in the request")
+	}
+	if invoice.Napojnica != nil {
+		t.Error("Expected the invoice not to be changed")
+	}
+
+	// Errors returned by CIS
+	greske = `<tns:Greske><tns:Greska><tns:SifraGreske>p010</tns:SifraGreske><tns:PorukaGreske>Racun nije fiskaliziran</tns:PorukaGreske></tns:Greska></tns:Greske>`
+	odgovor, err = invoice.AddTipRequest("1.00", CISCash)
+	if !errors.Is(err, ErrCISLaterChange) || IsRetriable(err) || odgovor.FirstErrorCode() != "p010" {
+		t.Errorf("Expected the CIS error, got %v", err)
+	}
+
+	// Invalid input is refused before sending
+	request = nil
+	for _, tip := range []struct {
+		amount string
+		method PaymentMethod
+	}{{"0.00", CISCash}, {"2.5", CISCash}, {"-1.00", CISCash}, {"2.50", "X"}} {
+		var fErr *FiskalError
+		if _, err := invoice.AddTipRequest(tip.amount, tip.method); !errors.As(err, &fErr) || fErr.Category != CategoryInput {
+			t.Errorf("Expected an input error for %v, got %v", tip, err)
+		}
+	}
+	invoice.ZastKod = "00000000000000000000000000000000"
+	if _, err := invoice.AddTipRequest("1.00", CISCash); err == nil {
+		t.Error("Expected an error for an invalid ZKI")
+	}
+	if request != nil {
+		t.Error("Expected nothing to be sent for invalid input")
+	}
+}
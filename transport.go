@@ -0,0 +1,85 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+
+	"github.com/l-d-t/fiskalhrgo/client"
+)
+
+// TransportRequest is a request message ready to be delivered to CIS, see client.Request. Its Endpoint is the entity
+// endpoint or the one of the message type (see MessageType.Endpoint).
+type TransportRequest = client.Request
+
+// TransportResponse is the response to a TransportRequest, see client.Response
+type TransportResponse = client.Response
+
+// Transport delivers the SOAP envelopes to CIS and returns the responses, see client.Transport.
+//
+// The default transport sends them with HTTPS POST to the entity endpoint using the entity HTTP settings.
+// Alternative transports (a relay over a message queue, a recorded or mocked CIS...) can be set with SetTransport,
+// the invoice level code, signing and response verification and parsing stay the same.
+// Implementations must be safe for concurrent use.
+type Transport = client.Transport
+
+// SetTransport sets the transport used to deliver the requests to CIS, nil restores the default HTTPS transport.
+// The HTTP settings of the entity (client, headers, trusted roots...) are used by the default transport only.
+func (fe *FiskalEntity) SetTransport(transport Transport) {
+	fe.clientMu.Lock()
+	defer fe.clientMu.Unlock()
+	fe.transport = transport
+}
+
+// getTransport returns the transport set with SetTransport or the default HTTPS transport
+func (fe *FiskalEntity) getTransport() Transport {
+	fe.clientMu.Lock()
+	defer fe.clientMu.Unlock()
+	if fe.transport != nil {
+		return fe.transport
+	}
+	return &httpsTransport{fe: fe}
+}
+
+// httpsTransport is the default transport, SOAP over HTTPS to the entity endpoint
+type httpsTransport struct {
+	fe *FiskalEntity
+}
+
+func (t *httpsTransport) Send(treq *TransportRequest) (*TransportResponse, error) {
+	fe := t.fe
+	httpClient := fe.getHTTPClient()
+
+	// Create a new HTTP POST request
+	endpoint := treq.Endpoint
+	if endpoint == "" {
+		endpoint = fe.Endpoint()
+	}
+	req, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(treq.Envelope))
+	if err != nil {
+		return nil, newFiskalError(CategoryInput, fmt.Errorf("failed to create request: %w", err))
+	}
+	fe.applyHeaders(req, treq.Header)
+
+	// Send the request
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, newFiskalError(classifyRequestError(err), fmt.Errorf("failed to make request: %w", err))
+	}
+	defer resp.Body.Close()
+
+	// Read the response body, but never more than the limit
+	maxSize := fe.maxResponseBodySize()
+	body, err := client.ReadLimited(resp.Body, resp.ContentLength, maxSize)
+	if err != nil {
+		fErr := newFiskalError(CategoryTransport, fmt.Errorf("failed to read response: %w", err))
+		fErr.StatusCode = resp.StatusCode
+		return &TransportResponse{StatusCode: resp.StatusCode, Body: body, Metadata: client.NewResponseMetadata(resp)}, fErr
+	}
+
+	return &TransportResponse{StatusCode: resp.StatusCode, Body: body, Metadata: client.NewResponseMetadata(resp)}, nil
+}
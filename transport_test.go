@@ -0,0 +1,59 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+type staticTransport struct {
+	requests []*TransportRequest
+	resp     *TransportResponse
+	err      error
+}
+
+func (t *staticTransport) Send(req *TransportRequest) (*TransportResponse, error) {
+	t.requests = append(t.requests, req)
+	return t.resp, t.err
+}
+
+func TestCustomTransport(t *testing.T) {
+	fe := newTestEntity(t)
+	transport := &staticTransport{resp: &TransportResponse{
+		StatusCode: http.StatusOK,
+		Body:       []byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><tns:EchoResponse xmlns:tns="http://www.apis-it.hr/fin/2012/types/f73">relayed</tns:EchoResponse></soap:Body></soap:Envelope>`),
+	}}
+	fe.SetTransport(transport)
+
+	resp, err := fe.EchoRequestWithHeaders("hello", http.Header{"X-Register": []string{"1"}})
+	if err != nil || resp != "relayed" {
+		t.Fatalf("Expected the transport response, got %q, %v", resp, err)
+	}
+	if len(transport.requests) != 1 || transport.requests[0].Operation != "EchoRequest" || transport.requests[0].Header.Get("X-Register") != "1" {
+		t.Errorf("Unexpected transport request: %+v", transport.requests)
+	}
+
+	// Plain errors from a transport are classified as transport errors
+	transport.err = errors.New("queue unavailable")
+	_, err = fe.EchoRequest("hello")
+	var fErr *FiskalError
+	if !errors.As(err, &fErr) || fErr.Category != CategoryTransport || !errors.Is(err, transport.err) {
+		t.Errorf("Expected a transport FiskalError, got %v", err)
+	}
+
+	// The response size limit applies to custom transports too
+	transport.err = nil
+	fe.SetMaxResponseSize(10)
+	if _, err := fe.EchoRequest("hello"); !errors.Is(err, ErrResponseTooLarge) {
+		t.Errorf("Expected ErrResponseTooLarge, got %v", err)
+	}
+
+	fe.SetTransport(nil)
+	if _, ok := fe.getTransport().(*httpsTransport); !ok {
+		t.Errorf("Expected the default transport after SetTransport(nil)")
+	}
+}
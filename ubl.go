@@ -0,0 +1,498 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// UBL namespaces and the EN 16931 customization of the exported invoices
+const (
+	ublInvoiceNamespace   = "urn:oasis:names:specification:ubl:schema:xsd:Invoice-2"
+	ublCACNamespace       = "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2"
+	ublCBCNamespace       = "urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2"
+	ublCustomizationID    = "urn:cen.eu:en16931:2017"
+	ublDefaultCurrency    = "EUR"
+	ublDefaultUnitCode    = "H87" // piece
+	ublDefaultCountryCode = "HR"
+)
+
+// UBL VAT category codes (UNCL5305) used in the export
+const (
+	UBLVATStandard   = "S"
+	UBLVATZeroRated  = "Z"
+	UBLVATExempt     = "E"
+	UBLVATNotSubject = "O"
+)
+
+// ErrUBLUnsupported is returned for invoices with the amounts that have no EN 16931 equivalent in the export:
+// the consumption tax (PNP), the other taxes, the fees (naknade) and the margin scheme
+var ErrUBLUnsupported = errors.New("invoice data not supported by the UBL export")
+
+// UBLParty is the seller or the buyer of the exported invoice
+type UBLParty struct {
+	// Name is the registered name, required
+	Name string
+
+	// OIB is exported as the VAT identifier (HR + OIB). The OIB of the seller is the OIB of the invoice if empty.
+	OIB string
+
+	// The postal address, the country is HR if empty
+	StreetName  string
+	CityName    string
+	PostalZone  string
+	CountryCode string
+}
+
+// UBLLine is an invoice line of the exported invoice
+type UBLLine struct {
+	// Name of the item, required
+	Name string
+
+	// Quantity is "1" and UnitCode is H87 (piece) if empty
+	Quantity string
+	UnitCode string
+
+	// Amount is the net amount of the line (without the VAT), with two decimals
+	Amount string
+
+	// VATCategory is one of the UBLVAT categories, S if empty. VATRate is the rate of the S category, e.g. "25.00".
+	VATCategory string
+	VATRate     string
+}
+
+// UBLOptions are the data of the exported invoice that are not in the fiscalized invoice
+type UBLOptions struct {
+	// JIR of the fiscalized invoice, required
+	JIR string
+
+	// Seller and Buyer of the invoice, the names are required
+	Seller UBLParty
+	Buyer  UBLParty
+
+	// BuyerReference is the reference of the buyer, required by the public sector buyers (e.g. the order number)
+	BuyerReference string
+
+	// DueDate of the payment, not exported if zero
+	DueDate time.Time
+
+	// Currency is EUR if empty
+	Currency string
+
+	// Lines are the invoice lines. Their amounts must add up to the tax bases of the invoice per VAT category and
+	// rate. If empty, the invoice has one line per tax base.
+	Lines []UBLLine
+}
+
+// ubl* are the UBL 2.1 elements of the export, in the order of the schema
+type ublInvoice struct {
+	XMLName                 xml.Name         `xml:"Invoice"`
+	Xmlns                   string           `xml:"xmlns,attr"`
+	XmlnsCAC                string           `xml:"xmlns:cac,attr"`
+	XmlnsCBC                string           `xml:"xmlns:cbc,attr"`
+	CustomizationID         string           `xml:"cbc:CustomizationID"`
+	ID                      string           `xml:"cbc:ID"`
+	IssueDate               string           `xml:"cbc:IssueDate"`
+	IssueTime               string           `xml:"cbc:IssueTime"`
+	DueDate                 string           `xml:"cbc:DueDate,omitempty"`
+	InvoiceTypeCode         string           `xml:"cbc:InvoiceTypeCode"`
+	Note                    []string         `xml:"cbc:Note"`
+	DocumentCurrencyCode    string           `xml:"cbc:DocumentCurrencyCode"`
+	BuyerReference          string           `xml:"cbc:BuyerReference,omitempty"`
+	AdditionalDocuments     []ublDocumentRef `xml:"cac:AdditionalDocumentReference"`
+	AccountingSupplierParty ublPartyWrapper  `xml:"cac:AccountingSupplierParty"`
+	AccountingCustomerParty ublPartyWrapper  `xml:"cac:AccountingCustomerParty"`
+	PaymentMeans            ublPaymentMeans  `xml:"cac:PaymentMeans"`
+	TaxTotal                ublTaxTotal      `xml:"cac:TaxTotal"`
+	LegalMonetaryTotal      ublMonetaryTotal `xml:"cac:LegalMonetaryTotal"`
+	InvoiceLines            []ublInvoiceLine `xml:"cac:InvoiceLine"`
+}
+
+type ublDocumentRef struct {
+	ID                  string `xml:"cbc:ID"`
+	DocumentDescription string `xml:"cbc:DocumentDescription"`
+}
+
+type ublPartyWrapper struct {
+	Party ublParty `xml:"cac:Party"`
+}
+
+type ublParty struct {
+	PostalAddress    ublAddress     `xml:"cac:PostalAddress"`
+	PartyTaxScheme   *ublTaxScheme  `xml:"cac:PartyTaxScheme,omitempty"`
+	PartyLegalEntity ublLegalEntity `xml:"cac:PartyLegalEntity"`
+}
+
+type ublAddress struct {
+	StreetName string `xml:"cbc:StreetName,omitempty"`
+	CityName   string `xml:"cbc:CityName,omitempty"`
+	PostalZone string `xml:"cbc:PostalZone,omitempty"`
+	Country    string `xml:"cac:Country>cbc:IdentificationCode"`
+}
+
+type ublTaxScheme struct {
+	CompanyID string `xml:"cbc:CompanyID"`
+	TaxScheme string `xml:"cac:TaxScheme>cbc:ID"`
+}
+
+type ublLegalEntity struct {
+	RegistrationName string `xml:"cbc:RegistrationName"`
+}
+
+type ublPaymentMeans struct {
+	Code string `xml:"cbc:PaymentMeansCode"`
+}
+
+type ublAmount struct {
+	Currency string `xml:"currencyID,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type ublTaxTotal struct {
+	TaxAmount ublAmount        `xml:"cbc:TaxAmount"`
+	Subtotals []ublTaxSubtotal `xml:"cac:TaxSubtotal"`
+}
+
+type ublTaxSubtotal struct {
+	TaxableAmount ublAmount      `xml:"cbc:TaxableAmount"`
+	TaxAmount     ublAmount      `xml:"cbc:TaxAmount"`
+	TaxCategory   ublTaxCategory `xml:"cac:TaxCategory"`
+}
+
+type ublTaxCategory struct {
+	ID                 string `xml:"cbc:ID"`
+	Percent            string `xml:"cbc:Percent,omitempty"`
+	TaxExemptionReason string `xml:"cbc:TaxExemptionReason,omitempty"`
+	TaxScheme          string `xml:"cac:TaxScheme>cbc:ID"`
+}
+
+type ublMonetaryTotal struct {
+	LineExtensionAmount ublAmount `xml:"cbc:LineExtensionAmount"`
+	TaxExclusiveAmount  ublAmount `xml:"cbc:TaxExclusiveAmount"`
+	TaxInclusiveAmount  ublAmount `xml:"cbc:TaxInclusiveAmount"`
+	PayableAmount       ublAmount `xml:"cbc:PayableAmount"`
+}
+
+type ublQuantity struct {
+	UnitCode string `xml:"unitCode,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type ublInvoiceLine struct {
+	ID                  string         `xml:"cbc:ID"`
+	InvoicedQuantity    ublQuantity    `xml:"cbc:InvoicedQuantity"`
+	LineExtensionAmount ublAmount      `xml:"cbc:LineExtensionAmount"`
+	ItemName            string         `xml:"cac:Item>cbc:Name"`
+	TaxCategory         ublTaxCategory `xml:"cac:Item>cac:ClassifiedTaxCategory"`
+	Price               ublPrice       `xml:"cac:Price"`
+}
+
+type ublPrice struct {
+	PriceAmount  ublAmount    `xml:"cbc:PriceAmount"`
+	BaseQuantity *ublQuantity `xml:"cbc:BaseQuantity,omitempty"`
+}
+
+// ublPaymentMeansCodes maps the payment methods to the UNCL4461 payment means codes
+var ublPaymentMeansCodes = map[PaymentMethod]string{
+	CISCash:         "10",
+	CISCard:         "48",
+	CISBankTransfer: "30",
+	CISCheck:        "20",
+	CISMixOther:     "ZZZ",
+}
+
+// ublTaxGroup is a tax base of the invoice, a VAT category and rate
+type ublTaxGroup struct {
+	category, rate string
+	base, tax      int64
+}
+
+// UBL exports the fiscalized invoice as a UBL 2.1 invoice following EN 16931, for reusing the fiscalization data
+// in the e-invoices (e.g. to the public sector buyers). The number, the date, the taxes and the totals are the ones
+// sent to CIS, the JIR and the ZKI are embedded as notes and additional document references. The exported
+// invoice is not validated against the schematron of EN 16931 or of the Croatian CIUS, whose place for the
+// fiscalization data is not final yet.
+//
+// The VAT bases are exported as standard rated (zero rated for the 0% rate), IznosOslobPdv as exempt and
+// IznosNePodlOpor as not subject to VAT. Invoices with the PNP, the other taxes, the fees or the margin are refused
+// with ErrUBLUnsupported.
+func (invoice *RacunType) UBL(options UBLOptions) ([]byte, error) {
+	if invoice == nil || invoice.BrRac == nil {
+		return nil, errors.New("invoice is nil or has no number")
+	}
+	if invoice.Pnp != nil || invoice.OstaliPor != nil || invoice.Naknade != nil || invoice.IznosMarza != "" {
+		return nil, fmt.Errorf("%w: the PNP, the other taxes, the fees and the margin can't be exported", ErrUBLUnsupported)
+	}
+	if !ValidateJIR(options.JIR) {
+		return nil, errors.New("a valid JIR of the fiscalized invoice is required")
+	}
+	if !ValidateZKI(invoice.ZastKod) {
+		return nil, errors.New("the invoice has no valid ZKI")
+	}
+	issued, err := time.ParseInLocation("02.01.2006T15:04:05", invoice.DatVrijeme, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse date: %w", err)
+	}
+	paymentMeans, ok := ublPaymentMeansCodes[PaymentMethod(invoice.NacinPlac)]
+	if !ok {
+		return nil, fmt.Errorf("invalid payment method %q", invoice.NacinPlac)
+	}
+	currency := options.Currency
+	if currency == "" {
+		currency = ublDefaultCurrency
+	}
+	amount := func(cents int64) ublAmount { return ublAmount{Currency: currency, Value: formatCents(cents)} }
+
+	seller, err := options.Seller.party(invoice.Oib)
+	if err != nil {
+		return nil, fmt.Errorf("seller: %w", err)
+	}
+	buyer, err := options.Buyer.party("")
+	if err != nil {
+		return nil, fmt.Errorf("buyer: %w", err)
+	}
+
+	groups, err := invoice.ublTaxGroups()
+	if err != nil {
+		return nil, err
+	}
+	lines, err := ublLines(options.Lines, groups, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	var net, tax int64
+	taxTotal := ublTaxTotal{}
+	for _, group := range groups {
+		net += group.base
+		tax += group.tax
+		taxTotal.Subtotals = append(taxTotal.Subtotals, ublTaxSubtotal{
+			TaxableAmount: amount(group.base),
+			TaxAmount:     amount(group.tax),
+			TaxCategory:   newUBLTaxCategory(group.category, group.rate),
+		})
+	}
+	taxTotal.TaxAmount = amount(tax)
+	total, err := parseCents(invoice.IznosUkupno)
+	if err != nil {
+		return nil, fmt.Errorf("invalid total amount: %w", err)
+	}
+	if net+tax != total {
+		return nil, fmt.Errorf("the tax bases and the taxes add up to %s, not to the total amount %s", formatCents(net+tax), invoice.IznosUkupno)
+	}
+
+	number := invoiceNumber(invoice)
+	doc := ublInvoice{
+		Xmlns:                ublInvoiceNamespace,
+		XmlnsCAC:             ublCACNamespace,
+		XmlnsCBC:             ublCBCNamespace,
+		CustomizationID:      ublCustomizationID,
+		ID:                   number,
+		IssueDate:            issued.Format("2006-01-02"),
+		IssueTime:            issued.Format("15:04:05"),
+		InvoiceTypeCode:      "380",
+		Note:                 []string{"JIR: " + options.JIR, "ZKI: " + invoice.ZastKod},
+		DocumentCurrencyCode: currency,
+		BuyerReference:       options.BuyerReference,
+		AdditionalDocuments: []ublDocumentRef{
+			{ID: options.JIR, DocumentDescription: "JIR"},
+			{ID: invoice.ZastKod, DocumentDescription: "ZKI"},
+		},
+		AccountingSupplierParty: ublPartyWrapper{Party: seller},
+		AccountingCustomerParty: ublPartyWrapper{Party: buyer},
+		PaymentMeans:            ublPaymentMeans{Code: paymentMeans},
+		TaxTotal:                taxTotal,
+		LegalMonetaryTotal: ublMonetaryTotal{
+			LineExtensionAmount: amount(net),
+			TaxExclusiveAmount:  amount(net),
+			TaxInclusiveAmount:  amount(total),
+			PayableAmount:       amount(total),
+		},
+		InvoiceLines: lines,
+	}
+	if !options.DueDate.IsZero() {
+		doc.DueDate = options.DueDate.Format("2006-01-02")
+	}
+
+	data, err := xml.MarshalIndent(doc, "", " ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal the UBL invoice: %w", err)
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// party returns the UBL party, with the OIB if it is empty
+func (p UBLParty) party(oib string) (ublParty, error) {
+	if p.Name == "" {
+		return ublParty{}, errors.New("name is required")
+	}
+	if p.OIB != "" {
+		oib = p.OIB
+	}
+	party := ublParty{
+		PostalAddress:    ublAddress{StreetName: p.StreetName, CityName: p.CityName, PostalZone: p.PostalZone, Country: p.CountryCode},
+		PartyLegalEntity: ublLegalEntity{RegistrationName: p.Name},
+	}
+	if party.PostalAddress.Country == "" {
+		party.PostalAddress.Country = ublDefaultCountryCode
+	}
+	if oib != "" {
+		if !ValidateOIB(oib) {
+			return ublParty{}, fmt.Errorf("invalid OIB %q", oib)
+		}
+		party.PartyTaxScheme = &ublTaxScheme{CompanyID: "HR" + oib, TaxScheme: "VAT"}
+	}
+	return party, nil
+}
+
+// ublTaxGroups returns the tax bases of the invoice per VAT category and rate
+func (invoice *RacunType) ublTaxGroups() ([]*ublTaxGroup, error) {
+	var groups []*ublTaxGroup
+	byKey := make(map[string]*ublTaxGroup)
+	add := func(category, rate, base, tax string) error {
+		baseCents, err := parseCents(base)
+		if err != nil {
+			return err
+		}
+		var taxCents int64
+		if tax != "" {
+			if taxCents, err = parseCents(tax); err != nil {
+				return err
+			}
+		}
+		key := category + "/" + rate
+		if group, ok := byKey[key]; ok {
+			group.base += baseCents
+			group.tax += taxCents
+			return nil
+		}
+		byKey[key] = &ublTaxGroup{category: category, rate: rate, base: baseCents, tax: taxCents}
+		groups = append(groups, byKey[key])
+		return nil
+	}
+
+	if invoice.Pdv != nil {
+		for _, porez := range invoice.Pdv.Porez {
+			if porez == nil {
+				continue
+			}
+			rate, err := parseCents(porez.Stopa)
+			if err != nil {
+				return nil, fmt.Errorf("invalid VAT rate: %w", err)
+			}
+			category := UBLVATStandard
+			if rate == 0 {
+				category = UBLVATZeroRated
+			}
+			if err := add(category, formatCents(rate), porez.Osnovica, porez.Iznos); err != nil {
+				return nil, fmt.Errorf("invalid VAT base or amount: %w", err)
+			}
+		}
+	}
+	if invoice.IznosOslobPdv != "" {
+		if err := add(UBLVATExempt, "", invoice.IznosOslobPdv, ""); err != nil {
+			return nil, fmt.Errorf("invalid amount exempt from VAT: %w", err)
+		}
+	}
+	if invoice.IznosNePodlOpor != "" {
+		if err := add(UBLVATNotSubject, "", invoice.IznosNePodlOpor, ""); err != nil {
+			return nil, fmt.Errorf("invalid amount not subject to taxation: %w", err)
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].category < groups[j].category })
+	return groups, nil
+}
+
+// ublLines returns the invoice lines, checking that they add up to the tax bases, or one line per tax base
+func ublLines(lines []UBLLine, groups []*ublTaxGroup, amount func(int64) ublAmount) ([]ublInvoiceLine, error) {
+	if len(lines) == 0 {
+		if len(groups) == 0 {
+			return nil, errors.New("the invoice has no tax bases, the lines are required")
+		}
+		for _, group := range groups {
+			name := "PDV " + group.rate + "%"
+			switch group.category {
+			case UBLVATExempt:
+				name = "Oslobođeno PDV-a"
+			case UBLVATNotSubject:
+				name = "Ne podliježe oporezivanju"
+			}
+			lines = append(lines, UBLLine{Name: name, Amount: formatCents(group.base), VATCategory: group.category, VATRate: group.rate})
+		}
+	}
+
+	sums := make(map[string]int64)
+	exported := make([]ublInvoiceLine, len(lines))
+	for i, line := range lines {
+		if line.Name == "" {
+			return nil, fmt.Errorf("line %d: name is required", i+1)
+		}
+		cents, err := parseCents(line.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		category, rate := line.VATCategory, ""
+		if category == "" {
+			category = UBLVATStandard
+		}
+		if category == UBLVATStandard || category == UBLVATZeroRated {
+			rateCents, err := parseCents(line.VATRate)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid VAT rate: %w", i+1, err)
+			}
+			rate = formatCents(rateCents)
+		}
+		sums[category+"/"+rate] += cents
+		quantity, unit := line.Quantity, line.UnitCode
+		if quantity == "" {
+			quantity = "1"
+		}
+		if unit == "" {
+			unit = ublDefaultUnitCode
+		}
+		exported[i] = ublInvoiceLine{
+			ID:                  fmt.Sprint(i + 1),
+			InvoicedQuantity:    ublQuantity{UnitCode: unit, Value: quantity},
+			LineExtensionAmount: amount(cents),
+			ItemName:            line.Name,
+			TaxCategory:         newUBLTaxCategory(category, rate),
+			Price:               ublPrice{PriceAmount: amount(cents)},
+		}
+		if quantity != "1" {
+			// The unit price is not known, the price is the line amount for the whole quantity
+			exported[i].Price.BaseQuantity = &ublQuantity{UnitCode: unit, Value: quantity}
+		}
+	}
+
+	for _, group := range groups {
+		key := group.category + "/" + group.rate
+		if sums[key] != group.base {
+			return nil, fmt.Errorf("the lines of VAT category %s %s add up to %s, not to the tax base %s", group.category, group.rate, formatCents(sums[key]), formatCents(group.base))
+		}
+		delete(sums, key)
+	}
+	for key := range sums {
+		return nil, fmt.Errorf("the lines have the VAT category %s that is not on the invoice", key)
+	}
+	return exported, nil
+}
+
+// newUBLTaxCategory returns the VAT category with the rate
+func newUBLTaxCategory(category, rate string) ublTaxCategory {
+	taxCategory := ublTaxCategory{ID: category, Percent: rate, TaxScheme: "VAT"}
+	switch category {
+	case UBLVATExempt:
+		taxCategory.Percent = "0.00"
+		taxCategory.TaxExemptionReason = "Oslobođeno PDV-a"
+	case UBLVATNotSubject:
+		taxCategory.Percent = ""
+		taxCategory.TaxExemptionReason = "Ne podliježe oporezivanju"
+	}
+	return taxCategory
+}
@@ -0,0 +1,104 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+func TestInvoiceUBL(t *testing.T) {
+	fe := newTestEntity(t)
+	const jir = "9d6f5bb6-da48-4fcd-a803-4586a025e0e4"
+	invoice, zki, err := fe.NewCISInvoice(time.Date(2026, 3, 2, 10, 15, 0, 0, time.Local), 12, 1,
+		[][]interface{}{{"25.00", "100.00", "25.00"}, {"13.00", "10.00", "1.30"}}, nil, nil, "5.00", "0.00", "0.00", nil, "141.30", CISBankTransfer, "12345678901")
+	if err != nil {
+		t.Fatalf("Failed to create invoice: %v", err)
+	}
+	options := UBLOptions{
+		JIR:            jir,
+		Seller:         UBLParty{Name: "Prodavatelj d.o.o.", CityName: "Zagreb"},
+		Buyer:          UBLParty{Name: "Grad Zagreb", OIB: "61817894937"},
+		BuyerReference: "NAR-1",
+	}
+
+	// One line per tax base
+	data, err := invoice.UBL(options)
+	if err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		t.Fatal(err)
+	}
+	for path, expected := range map[string]string{
+		"/Invoice/ID":        invoiceNumber(invoice),
+		"/Invoice/IssueDate": "2026-03-02",
+		"/Invoice/AccountingSupplierParty/Party/PartyTaxScheme/CompanyID":    "HR" + invoice.Oib,
+		"/Invoice/AccountingCustomerParty/Party/PartyTaxScheme/CompanyID":    "HR61817894937",
+		"/Invoice/PaymentMeans/PaymentMeansCode":                             "30",
+		"/Invoice/TaxTotal/TaxAmount":                                        "26.30",
+		"/Invoice/LegalMonetaryTotal/TaxExclusiveAmount":                     "115.00",
+		"/Invoice/LegalMonetaryTotal/PayableAmount":                          "141.30",
+		"/Invoice/AdditionalDocumentReference[DocumentDescription='ZKI']/ID": zki,
+		"/Invoice/AdditionalDocumentReference[DocumentDescription='JIR']/ID": jir,
+	} {
+		if el := doc.FindElement(path); el == nil || el.Text() != expected {
+			t.Errorf("Expected %s in %s", expected, path)
+		}
+	}
+	if lines := doc.FindElements("/Invoice/InvoiceLine"); len(lines) != 3 {
+		t.Errorf("Expected 3 lines, got %d", len(lines))
+	}
+	exempt := false
+	for _, subtotal := range doc.FindElements("/Invoice/TaxTotal/TaxSubtotal") {
+		exempt = exempt || subtotal.FindElement("TaxCategory/ID").Text() == UBLVATExempt && subtotal.FindElement("TaxableAmount").Text() == "5.00"
+	}
+	if !exempt {
+		t.Error("Expected the exempt amount in its own subtotal")
+	}
+
+	// Explicit lines must add up to the tax bases
+	options.Lines = []UBLLine{
+		{Name: "Usluga", Amount: "60.00", VATRate: "25.00"},
+		{Name: "Materijal", Quantity: "4", Amount: "40.00", VATRate: "25.00"},
+		{Name: "Knjiga", Amount: "10.00", VATRate: "13.00"},
+		{Name: "Pristojba", Amount: "5.00", VATCategory: UBLVATExempt},
+	}
+	if data, err = invoice.UBL(options); err != nil {
+		t.Fatalf("Failed to export with lines: %v", err)
+	}
+	if err := doc.ReadFromBytes(data); err != nil {
+		t.Fatal(err)
+	}
+	if el := doc.FindElement("/Invoice/InvoiceLine[ID='2']/Price/BaseQuantity"); el == nil || el.Text() != "4" {
+		t.Error("Expected the base quantity of the price")
+	}
+	options.Lines[0].Amount = "50.00"
+	if _, err := invoice.UBL(options); err == nil {
+		t.Error("Expected an error for the lines not adding up to the tax base")
+	}
+	options.Lines = nil
+
+	// Missing data and unsupported invoices
+	for name, modify := range map[string]func(*UBLOptions){
+		"no JIR":      func(o *UBLOptions) { o.JIR = "" },
+		"no buyer":    func(o *UBLOptions) { o.Buyer.Name = "" },
+		"invalid OIB": func(o *UBLOptions) { o.Buyer.OIB = "12345678900" },
+	} {
+		o := options
+		modify(&o)
+		if _, err := invoice.UBL(o); err == nil {
+			t.Errorf("Expected an error for %s", name)
+		}
+	}
+	invoice.IznosMarza = "1.00"
+	if _, err := invoice.UBL(options); !errors.Is(err, ErrUBLUnsupported) {
+		t.Errorf("Expected ErrUBLUnsupported, got %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+// Package validate has the validators of the fiscalization data (OIB, amounts, tax rates, JIR, ZKI, IBAN...) without
+// any dependency on the rest of the library, for validating the input before an invoice is created, e.g. in
+// the forms or in the import of the invoices from another system. The validators of the fiskalhrgo package
+// are the same functions.
+package validate
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import "regexp"
+
+var (
+	amountPattern       = regexp.MustCompile(`^\d+\.\d{2}$`)
+	signedAmountPattern = regexp.MustCompile(`^-?\d+\.\d{2}$`)
+	locationIDPattern   = regexp.MustCompile(`^[a-zA-Z0-9]{1,20}$`)
+	jirPattern          = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+	zkiPattern          = regexp.MustCompile(`^[0-9a-f]{32}$`)
+	ibanPattern         = regexp.MustCompile(`^[A-Z]{2}\d{2}[0-9A-Z]{11,30}$`)
+	hrIBANPattern       = regexp.MustCompile(`^HR\d{19}$`)
+)
+
+// Amount checks if the amount is non-negative with exactly two decimals, e.g. "10.00"
+func Amount(amount string) bool {
+	return amountPattern.MatchString(amount)
+}
+
+// SignedAmount checks if the amount has exactly two decimals, negative amounts (e.g. of a cancellation) included
+func SignedAmount(amount string) bool {
+	return signedAmountPattern.MatchString(amount)
+}
+
+// TaxRate checks if the tax rate is non-negative with exactly two decimals, e.g. "25.00" or "0.00"
+func TaxRate(rate string) bool {
+	return amountPattern.MatchString(rate)
+}
+
+// OIB checks if the OIB has 11 digits and a valid check digit (ISO 7064, MOD 11,10)
+func OIB(oib string) bool {
+	return len(oib) == 11 && mod1110(oib)
+}
+
+// mod1110 checks if the digits end with a valid check digit (ISO 7064, MOD 11,10)
+func mod1110(digits string) bool {
+	if digits == "" {
+		return false
+	}
+	remainder := 10
+	for i := 0; i < len(digits)-1; i++ {
+		digit := int(digits[i]) - '0'
+		if digit < 0 || digit > 9 {
+			return false
+		}
+		remainder = (remainder + digit) % 10
+		if remainder == 0 {
+			remainder = 10
+		}
+		remainder = (remainder * 2) % 11
+	}
+	lastDigit := int(digits[len(digits)-1]) - '0'
+	if lastDigit < 0 || lastDigit > 9 {
+		return false
+	}
+	return (11-remainder)%10 == lastDigit
+}
+
+// IBAN checks the IBAN in the electronic format (uppercase, without spaces): the structure and the check digits
+// (ISO 13616, MOD 97-10). A Croatian IBAN must have 21 characters, HR, the check digits, the 7 digit bank code
+// (VBDI) and the 10 digit account number, and the bank code and the account number have their own check digits
+// (ISO 7064, MOD 11,10). Remove the spaces of the printed format ("HR12 1001 0051 8630 0016 0") before checking.
+func IBAN(iban string) bool {
+	if !ibanPattern.MatchString(iban) {
+		return false
+	}
+	if iban[:2] == "HR" && !(hrIBANPattern.MatchString(iban) && mod1110(iban[4:11]) && mod1110(iban[11:])) {
+		return false
+	}
+	// The country and the check digits are moved to the end, the letters are replaced with 10-35
+	remainder := 0
+	for _, c := range iban[4:] + iban[:4] {
+		if c >= 'A' {
+			remainder = (remainder*100 + int(c-'A') + 10) % 97
+		} else {
+			remainder = (remainder*10 + int(c-'0')) % 97
+		}
+	}
+	return remainder == 1
+}
+
+// LocationID checks the mark of the business location or of the device, digits and letters, up to 20 characters
+func LocationID(locationID string) bool {
+	return locationIDPattern.MatchString(locationID)
+}
+
+// JIR checks if the JIR is a UUID in lowercase, e.g. "9d6f5bb6-da48-4fcd-a803-4586a025e0e4"
+func JIR(jir string) bool {
+	return jirPattern.MatchString(jir)
+}
+
+// ZKI checks if the ZKI is an MD5 hash in lowercase hexadecimal (32 characters)
+func ZKI(zki string) bool {
+	return zkiPattern.MatchString(zki)
+}
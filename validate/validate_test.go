@@ -0,0 +1,37 @@
+package validate
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import "testing"
+
+func TestValidators(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		check func(string) bool
+		valid []string
+		bad   []string
+	}{
+		{"Amount", Amount, []string{"0.00", "10.50", "1234567.89"}, []string{"", "10", "10.5", "-1.00", "1,00", "10.500"}},
+		{"SignedAmount", SignedAmount, []string{"0.00", "-10.50"}, []string{"", "--1.00", "+1.00", "1.0"}},
+		{"TaxRate", TaxRate, []string{"0.00", "25.00", "5.00"}, []string{"25", "-5.00", "25.0"}},
+		{"OIB", OIB, []string{"65049901548", "61817894937"}, []string{"", "12345678900", "6504990154", "6504990154a", "650499015481"}},
+		{"LocationID", LocationID, []string{"POS1", "a", "A1234567890123456789"}, []string{"", "POS-1", "A12345678901234567890", "Č1"}},
+		{"JIR", JIR, []string{"9d6f5bb6-da48-4fcd-a803-4586a025e0e4"}, []string{"", "9D6F5BB6-DA48-4FCD-A803-4586A025E0E4", "9d6f5bb6da484fcda8034586a025e0e4"}},
+		{"IBAN", IBAN, []string{"HR1210010051863000160", "HR1723600001101234565", "DE89370400440532013000", "GB82WEST12345698765432"},
+			[]string{"", "HR1310010051863000160", "hr1210010051863000160", "HR12 1001 0051 8630 0016 0", "HR4710010061863000160", "HR8210010051863000161", "HR56100100518630001601", "DE8937040044053201300"}},
+		{"ZKI", ZKI, []string{"e3a4d7bd1d5c2b4a8f0c9e6d7b1a2c3f"}, []string{"", "E3A4D7BD1D5C2B4A8F0C9E6D7B1A2C3F", "e3a4d7bd"}},
+	} {
+		for _, value := range tc.valid {
+			if !tc.check(value) {
+				t.Errorf("%s(%q) should be valid", tc.name, value)
+			}
+		}
+		for _, value := range tc.bad {
+			if tc.check(value) {
+				t.Errorf("%s(%q) should be invalid", tc.name, value)
+			}
+		}
+	}
+}
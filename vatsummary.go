@@ -0,0 +1,189 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// VATSummary is the tax summary of the fiscalized invoices in a period, with the exact amounts sent to CIS,
+// for pre-filling the PDV (VAT) and PNP (consumption tax) forms
+type VATSummary struct {
+	// From and To is the period of the summary, [From, To)
+	From, To time.Time
+
+	// Invoices is the number of the fiscalized invoices, Total their total amount
+	Invoices int
+	Total    string
+
+	// VAT are the bases and the tax amounts per VAT rate
+	VAT []VATSummaryTax
+
+	// ConsumptionTax are the bases and the tax amounts of the PNP per municipality and rate
+	ConsumptionTax []VATSummaryTax
+
+	// OtherTaxes are the bases and the amounts of the other taxes per name and rate
+	OtherTaxes []VATSummaryTax
+
+	// Exempt (IznosOslobPdv), Margin (IznosMarza) and NotTaxable (IznosNePodlOpor) are the totals
+	// of the amounts outside of the taxes
+	Exempt     string
+	Margin     string
+	NotTaxable string
+
+	// Unfiscalized lists the ZKI of the invoices in the period without the JIR. They are not in the summary,
+	// which is complete only when the list is empty.
+	Unfiscalized []string
+}
+
+// VATSummaryTax is the total of a tax rate
+type VATSummaryTax struct {
+	// Name is the municipality of the PNP (empty if it is not known) and the name of the other taxes,
+	// empty for the VAT
+	Name     string
+	Rate     string
+	Invoices int
+	Base     string
+	Amount   string
+}
+
+// BuildVATSummary sums the taxes of the invoices fiscalized in [from, to) from the journal. The attempts of an
+// invoice are counted once. The PNP is paid to the municipality of the business location, municipalities maps
+// the location (OznPosPr) to its municipality, the PNP of the locations not in the map has an empty Name.
+// The taxes are ordered by name and rate.
+func BuildVATSummary(journal Journal, from, to time.Time, municipalities map[string]string) (*VATSummary, error) {
+	if journal == nil {
+		return nil, errors.New("journal is nil")
+	}
+	if !from.Before(to) {
+		return nil, errors.New("summary period is empty, from must be before to")
+	}
+	entries, err := journal.Range(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	// The successful attempt of every invoice, or the last one
+	invoices := make(map[string]*JournalEntry)
+	var zkis []string
+	for _, entry := range entries {
+		previous, seen := invoices[entry.ZKI]
+		if !seen {
+			zkis = append(zkis, entry.ZKI)
+		}
+		if previous == nil || previous.JIR == "" {
+			invoices[entry.ZKI] = entry
+		}
+	}
+	sort.Strings(zkis)
+
+	summary := &VATSummary{From: from, To: to}
+	var total, exempt, margin, notTaxable int64
+	vat, pnp, other := newTaxSums(), newTaxSums(), newTaxSums()
+	for _, zki := range zkis {
+		entry := invoices[zki]
+		if entry.JIR == "" {
+			summary.Unfiscalized = append(summary.Unfiscalized, zki)
+			continue
+		}
+		summary.Invoices++
+		for _, sum := range []struct {
+			amount string
+			total  *int64
+		}{{entry.Total, &total}, {entry.Exempt, &exempt}, {entry.Margin, &margin}, {entry.NotTaxable, &notTaxable}} {
+			if sum.amount == "" {
+				continue
+			}
+			cents, err := parseCents(sum.amount)
+			if err != nil {
+				return nil, fmt.Errorf("invoice %s: %w", entry.InvoiceNumber, err)
+			}
+			*sum.total += cents
+		}
+
+		for _, tax := range entry.Taxes {
+			var err error
+			switch tax.Type {
+			case "PDV":
+				err = vat.add("", tax)
+			case "PNP":
+				err = pnp.add(municipalities[entry.Location], tax)
+			default:
+				err = other.add(tax.Type, tax)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invoice %s: %w", entry.InvoiceNumber, err)
+			}
+		}
+	}
+
+	summary.Total = formatCents(total)
+	summary.Exempt = formatCents(exempt)
+	summary.Margin = formatCents(margin)
+	summary.NotTaxable = formatCents(notTaxable)
+	summary.VAT, summary.ConsumptionTax, summary.OtherTaxes = vat.list(), pnp.list(), other.list()
+	return summary, nil
+}
+
+// taxSums sums the taxes by name and rate
+type taxSums map[[2]string]*taxSum
+
+type taxSum struct {
+	invoices     int
+	base, amount int64
+}
+
+func newTaxSums() taxSums {
+	return make(taxSums)
+}
+
+// add adds the tax of an invoice
+func (s taxSums) add(name string, tax JournalTax) error {
+	base, err := parseCents(tax.Base)
+	if err != nil {
+		return fmt.Errorf("invalid tax base: %w", err)
+	}
+	amount, err := parseCents(tax.Amount)
+	if err != nil {
+		return fmt.Errorf("invalid tax amount: %w", err)
+	}
+	key := [2]string{name, tax.Rate}
+	if s[key] == nil {
+		s[key] = &taxSum{}
+	}
+	s[key].invoices++
+	s[key].base += base
+	s[key].amount += amount
+	return nil
+}
+
+// list returns the totals ordered by name and rate, the rates with two decimals are ordered numerically
+func (s taxSums) list() []VATSummaryTax {
+	var list []VATSummaryTax
+	for key, sum := range s {
+		list = append(list, VATSummaryTax{
+			Name:     key[0],
+			Rate:     key[1],
+			Invoices: sum.invoices,
+			Base:     formatCents(sum.base),
+			Amount:   formatCents(sum.amount),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Name != list[j].Name {
+			return list[i].Name < list[j].Name
+		}
+		ri, erri := parseCents(list[i].Rate)
+		rj, errj := parseCents(list[j].Rate)
+		if erri == nil && errj == nil {
+			return ri < rj
+		}
+		return list[i].Rate < list[j].Rate
+	})
+	return list
+}
@@ -0,0 +1,86 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBuildVATSummary(t *testing.T) {
+	journal := NewMemoryJournal()
+	from := time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC)
+	entries := []*JournalEntry{
+		{ZKI: "a", Location: "POS1", Total: "137.50", Exempt: "10.00", Taxes: []JournalTax{
+			{Type: "PDV", Rate: "25.00", Base: "100.00", Amount: "25.00"},
+			{Type: "PNP", Rate: "3.00", Base: "80.00", Amount: "2.40"},
+		}},
+		// The failed attempt of the invoice b is counted once, with its successful retry
+		{ZKI: "b", Location: "POS2", Total: "11.30", Error: "timeout", Taxes: []JournalTax{
+			{Type: "PDV", Rate: "13.00", Base: "10.00", Amount: "1.30"},
+		}},
+		{ZKI: "b", Location: "POS2", Total: "11.30", Margin: "5.00", Taxes: []JournalTax{
+			{Type: "PDV", Rate: "13.00", Base: "10.00", Amount: "1.30"},
+			{Type: "PNP", Rate: "3.00", Base: "10.00", Amount: "0.30"},
+			{Type: "Porez na luksuz", Rate: "10.00", Base: "1.00", Amount: "0.10"},
+		}},
+		{ZKI: "c", Location: "POS1", Total: "-62.50", NotTaxable: "2.00", Taxes: []JournalTax{
+			{Type: "PDV", Rate: "25.00", Base: "-50.00", Amount: "-12.50"},
+			{Type: "PDV", Rate: "5.00", Base: "4.00", Amount: "0.20"},
+		}},
+		{ZKI: "d", Location: "POS1", Total: "1.00", Error: "timeout"},
+	}
+	for i, entry := range entries {
+		entry.Time = from.Add(time.Duration(i) * time.Hour)
+		if entry.Error == "" {
+			entry.JIR = "jir-" + entry.ZKI
+		}
+		journal.Append(entry)
+	}
+	journal.Append(&JournalEntry{Time: from.AddDate(0, 1, 0), ZKI: "e", JIR: "jir-e", Total: "100.00"})
+
+	summary, err := BuildVATSummary(journal, from, from.AddDate(0, 1, 0), map[string]string{"POS1": "Zagreb"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Invoices != 3 || summary.Total != "86.30" {
+		t.Errorf("Unexpected totals %d %s", summary.Invoices, summary.Total)
+	}
+	if summary.Exempt != "10.00" || summary.Margin != "5.00" || summary.NotTaxable != "2.00" {
+		t.Errorf("Unexpected exempt amounts %s %s %s", summary.Exempt, summary.Margin, summary.NotTaxable)
+	}
+	if len(summary.Unfiscalized) != 1 || summary.Unfiscalized[0] != "d" {
+		t.Errorf("Expected the unfiscalized invoice, got %v", summary.Unfiscalized)
+	}
+
+	expectedVAT := []VATSummaryTax{
+		{Rate: "5.00", Invoices: 1, Base: "4.00", Amount: "0.20"},
+		{Rate: "13.00", Invoices: 1, Base: "10.00", Amount: "1.30"},
+		{Rate: "25.00", Invoices: 2, Base: "50.00", Amount: "12.50"},
+	}
+	if len(summary.VAT) != len(expectedVAT) {
+		t.Fatalf("Unexpected VAT rates %+v", summary.VAT)
+	}
+	for i, tax := range expectedVAT {
+		if summary.VAT[i] != tax {
+			t.Errorf("Expected %+v, got %+v", tax, summary.VAT[i])
+		}
+	}
+	if len(summary.ConsumptionTax) != 2 || summary.ConsumptionTax[0].Name != "" || summary.ConsumptionTax[0].Amount != "0.30" ||
+		summary.ConsumptionTax[1].Name != "Zagreb" || summary.ConsumptionTax[1].Amount != "2.40" {
+		t.Errorf("Unexpected PNP per municipality %+v", summary.ConsumptionTax)
+	}
+	if len(summary.OtherTaxes) != 1 || summary.OtherTaxes[0].Name != "Porez na luksuz" || summary.OtherTaxes[0].Base != "1.00" {
+		t.Errorf("Unexpected other taxes %+v", summary.OtherTaxes)
+	}
+
+	if _, err := BuildVATSummary(journal, from, from, nil); err == nil {
+		t.Error("Expected an error for an empty period")
+	}
+	journal.Append(&JournalEntry{Time: from, ZKI: "f", JIR: "jir-f", Total: "1"})
+	if _, err := BuildVATSummary(journal, from, from.AddDate(0, 1, 0), nil); err == nil {
+		t.Error("Expected an error for an invalid amount")
+	}
+}
@@ -0,0 +1,257 @@
+// Package vaultcert provides a fiskalhrgo.CertProvider reading the P12 certificates from a HashiCorp Vault
+// KV version 2 secret, using the Vault HTTP API directly.
+//
+// The secret holds the base64 encoded P12 bundle and its password:
+//
+//	vault kv put secret/fiskal/shop1 p12=@<(base64 -w 0 fiskal.p12) password=...
+//
+// Every version of the secret is a certificate, the latest version is the current certificate and the
+// older versions are the historical ones, so a certificate renewal is just a new version of the secret.
+// Keep the old versions (don't destroy them), they are needed to recalculate the ZKI of old invoices.
+//
+//	provider, err := vaultcert.New(vaultcert.Config{Path: "fiskal/shop1"})
+//	entity, err := fiskalhrgo.NewFiskalEntityWithOptions(oib, fiskalhrgo.WithLocation("POS1"), fiskalhrgo.WithCertProvider(provider))
+package vaultcert
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	fiskalhrgo "github.com/l-d-t/fiskalhrgo"
+)
+
+// Config of the Vault provider
+type Config struct {
+	// Address of the Vault server, VAULT_ADDR if empty
+	Address string
+
+	// Token used to authenticate, VAULT_TOKEN if empty
+	Token string
+
+	// Namespace (Vault Enterprise), VAULT_NAMESPACE if empty
+	Namespace string
+
+	// Mount is the path of the KV version 2 secrets engine, "secret" if empty
+	Mount string
+
+	// Path of the secret in the secrets engine, required
+	Path string
+
+	// P12Field and PasswordField are the names of the secret fields, "p12" and "password" if empty
+	P12Field      string
+	PasswordField string
+
+	// HTTPClient used for the requests, a client with a 10 second timeout if nil
+	HTTPClient *http.Client
+}
+
+// Provider implements fiskalhrgo.CertProvider
+type Provider struct {
+	cfg Config
+
+	mu    sync.Mutex
+	cache map[int]*fiskalhrgo.Certificate
+}
+
+// New creates the provider, nothing is read from Vault until a certificate is requested
+func New(cfg Config) (*Provider, error) {
+	if cfg.Address == "" {
+		cfg.Address = os.Getenv("VAULT_ADDR")
+	}
+	if cfg.Token == "" {
+		cfg.Token = os.Getenv("VAULT_TOKEN")
+	}
+	if cfg.Namespace == "" {
+		cfg.Namespace = os.Getenv("VAULT_NAMESPACE")
+	}
+	if cfg.Mount == "" {
+		cfg.Mount = "secret"
+	}
+	if cfg.P12Field == "" {
+		cfg.P12Field = "p12"
+	}
+	if cfg.PasswordField == "" {
+		cfg.PasswordField = "password"
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	if cfg.Address == "" {
+		return nil, errors.New("vault address is not set")
+	}
+	if _, err := url.Parse(cfg.Address); err != nil {
+		return nil, fmt.Errorf("invalid vault address: %w", err)
+	}
+	if cfg.Token == "" {
+		return nil, errors.New("vault token is not set")
+	}
+	if cfg.Path == "" {
+		return nil, errors.New("secret path is required")
+	}
+	cfg.Address = strings.TrimRight(cfg.Address, "/")
+	cfg.Mount = strings.Trim(cfg.Mount, "/")
+	cfg.Path = strings.Trim(cfg.Path, "/")
+
+	return &Provider{cfg: cfg, cache: make(map[int]*fiskalhrgo.Certificate)}, nil
+}
+
+// GetCurrent returns the certificate from the latest version of the secret
+func (p *Provider) GetCurrent() (*fiskalhrgo.Certificate, error) {
+	return p.version(0)
+}
+
+// GetBySerial returns the certificate with the serial number from any version of the secret
+func (p *Provider) GetBySerial(serial string) (*fiskalhrgo.Certificate, error) {
+	certs, err := p.ListHistorical()
+	if err != nil {
+		return nil, err
+	}
+	for _, cert := range certs {
+		if cert.Serial() == serial {
+			return cert, nil
+		}
+	}
+	return nil, fiskalhrgo.ErrCertificateNotFound
+}
+
+// ListHistorical returns the certificates of all versions of the secret, the newest first.
+// Deleted and destroyed versions are skipped.
+func (p *Provider) ListHistorical() ([]*fiskalhrgo.Certificate, error) {
+	var metadata struct {
+		Data struct {
+			Versions map[string]struct {
+				DeletionTime string `json:"deletion_time"`
+				Destroyed    bool   `json:"destroyed"`
+			} `json:"versions"`
+		} `json:"data"`
+	}
+	if err := p.get("metadata", nil, &metadata); err != nil {
+		return nil, err
+	}
+
+	var versions []int
+	for key, info := range metadata.Data.Versions {
+		version, err := strconv.Atoi(key)
+		if err != nil || info.Destroyed || info.DeletionTime != "" {
+			continue
+		}
+		versions = append(versions, version)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+
+	certs := make([]*fiskalhrgo.Certificate, 0, len(versions))
+	for _, version := range versions {
+		cert, err := p.version(version)
+		if err != nil {
+			return nil, fmt.Errorf("version %d: %w", version, err)
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// version reads and decodes the version of the secret, 0 for the latest. Versions never change, so they are cached.
+func (p *Provider) version(version int) (*fiskalhrgo.Certificate, error) {
+	if version > 0 {
+		p.mu.Lock()
+		cert, ok := p.cache[version]
+		p.mu.Unlock()
+		if ok {
+			return cert, nil
+		}
+	}
+
+	query := url.Values{}
+	if version > 0 {
+		query.Set("version", strconv.Itoa(version))
+	}
+	var secret struct {
+		Data struct {
+			Data     map[string]interface{} `json:"data"`
+			Metadata struct {
+				Version int `json:"version"`
+			} `json:"metadata"`
+		} `json:"data"`
+	}
+	if err := p.get("data", query, &secret); err != nil {
+		return nil, err
+	}
+
+	p12, _ := secret.Data.Data[p.cfg.P12Field].(string)
+	password, _ := secret.Data.Data[p.cfg.PasswordField].(string)
+	if p12 == "" {
+		return nil, fmt.Errorf("secret field %s is empty", p.cfg.P12Field)
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(p12), ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64 in secret field %s: %w", p.cfg.P12Field, err)
+	}
+	cert, err := fiskalhrgo.ParseP12(data, password)
+	if err != nil {
+		return nil, fmt.Errorf("certificate decode fail: %v", err)
+	}
+
+	if v := secret.Data.Metadata.Version; v > 0 {
+		p.mu.Lock()
+		p.cache[v] = cert
+		p.mu.Unlock()
+	}
+	return cert, nil
+}
+
+// get calls the KV version 2 API and decodes the JSON response
+func (p *Provider) get(kind string, query url.Values, v interface{}) error {
+	u := p.cfg.Address + "/v1/" + p.cfg.Mount + "/" + kind + "/" + p.cfg.Path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", p.cfg.Token)
+	if p.cfg.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.cfg.Namespace)
+	}
+
+	resp, err := p.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read vault response: %w", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return fiskalhrgo.ErrCertificateNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		var vaultErr struct {
+			Errors []string `json:"errors"`
+		}
+		json.Unmarshal(body, &vaultErr)
+		return fmt.Errorf("vault returned an error: %d %s", resp.StatusCode, strings.Join(vaultErr.Errors, "; "))
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("invalid vault response: %w", err)
+	}
+	return nil
+}
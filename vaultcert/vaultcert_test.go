@@ -0,0 +1,165 @@
+package vaultcert
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	fiskalhrgo "github.com/l-d-t/fiskalhrgo"
+	gopkcs12 "software.sslmate.com/src/go-pkcs12"
+)
+
+// newP12 creates a self-signed P12 bundle with the serial number
+func newP12(t *testing.T, serial int64, password string) string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "FISKAL 1", Organization: []string{"TEST D.O.O. HR12345678903"}, Country: []string{"HR"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	data, err := gopkcs12.Modern.Encode(key, cert, nil, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// fakeVault serves a KV version 2 secret with the versions
+type fakeVault struct {
+	versions map[int]string
+	deleted  map[int]bool
+	reads    int
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Vault-Token") != "token" {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"errors":["permission denied"]}`))
+		return
+	}
+	latest := 0
+	for v := range f.versions {
+		if v > latest {
+			latest = v
+		}
+	}
+	switch r.URL.Path {
+	case "/v1/secret/metadata/fiskal/shop1":
+		versions := map[string]interface{}{}
+		for v := range f.versions {
+			deletion := ""
+			if f.deleted[v] {
+				deletion = "2024-01-01T00:00:00Z"
+			}
+			versions[strconv.Itoa(v)] = map[string]interface{}{"deletion_time": deletion, "destroyed": false}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"current_version": latest, "versions": versions}})
+	case "/v1/secret/data/fiskal/shop1":
+		f.reads++
+		version := latest
+		if v := r.URL.Query().Get("version"); v != "" {
+			version, _ = strconv.Atoi(v)
+		}
+		p12, ok := f.versions[version]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{
+			"data":     map[string]interface{}{"p12": p12, "password": "secret"},
+			"metadata": map[string]interface{}{"version": version},
+		}})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestProvider(t *testing.T) {
+	vault := &fakeVault{
+		versions: map[int]string{1: newP12(t, 101, "secret"), 2: newP12(t, 102, "secret"), 3: newP12(t, 103, "secret")},
+		deleted:  map[int]bool{2: true},
+	}
+	server := httptest.NewServer(vault)
+	defer server.Close()
+
+	provider, err := New(Config{Address: server.URL, Token: "token", Path: "fiskal/shop1"})
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	var _ fiskalhrgo.CertProvider = provider
+
+	current, err := provider.GetCurrent()
+	if err != nil {
+		t.Fatalf("Failed to get the current certificate: %v", err)
+	}
+	if current.Serial() != "103" {
+		t.Errorf("Expected the latest version to be current, got serial %s", current.Serial())
+	}
+
+	all, err := provider.ListHistorical()
+	if err != nil {
+		t.Fatalf("Failed to list certificates: %v", err)
+	}
+	if len(all) != 2 || all[0].Serial() != "103" || all[1].Serial() != "101" {
+		t.Errorf("Expected versions 3 and 1, got %d certificates", len(all))
+	}
+
+	old, err := provider.GetBySerial("101")
+	if err != nil || old.Serial() != "101" {
+		t.Errorf("Failed to get the old certificate: %v", err)
+	}
+	if _, err := provider.GetBySerial("102"); !errors.Is(err, fiskalhrgo.ErrCertificateNotFound) {
+		t.Errorf("Expected ErrCertificateNotFound for a deleted version, got %v", err)
+	}
+
+	reads := vault.reads
+	if _, err := provider.ListHistorical(); err != nil {
+		t.Fatal(err)
+	}
+	if vault.reads != reads {
+		t.Errorf("Expected the versions to be cached")
+	}
+}
+
+func TestProviderErrors(t *testing.T) {
+	server := httptest.NewServer(&fakeVault{versions: map[int]string{}})
+	defer server.Close()
+
+	if _, err := New(Config{Address: server.URL, Token: "token"}); err == nil {
+		t.Errorf("Expected error without a path")
+	}
+
+	provider, _ := New(Config{Address: server.URL, Token: "wrong", Path: "fiskal/shop1"})
+	if _, err := provider.GetCurrent(); err == nil || errors.Is(err, fiskalhrgo.ErrCertificateNotFound) {
+		t.Errorf("Expected permission error, got %v", err)
+	}
+
+	provider, _ = New(Config{Address: server.URL, Token: "token", Path: "fiskal/missing"})
+	if _, err := provider.GetCurrent(); !errors.Is(err, fiskalhrgo.ErrCertificateNotFound) {
+		t.Errorf("Expected ErrCertificateNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+// Package xmlsec verifies the signatures of the CIS responses with the xmlsec1 tool (https://www.aleksey.com/xmlsec/),
+// a stop-gap for environments that require the reference libxml2/xmlsec implementation of the XML signatures
+// instead of the built-in pure Go verification:
+//
+//	entity, err := fiskalhrgo.NewFiskalEntityWithOptions(oib, fiskalhrgo.WithLocation("POS1"), fiskalhrgo.WithCertFile(path, password),
+//		fiskalhrgo.WithResponseVerifier(&xmlsec.Verifier{}))
+//
+// The xmlsec1 binary must be installed (e.g. the xmlsec1 package on Debian or Ubuntu, libxmlsec1 on Homebrew).
+// Only the CIS certificate of the entity is trusted, the KeyInfo of the response is removed before the verification.
+package xmlsec
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+// defaultTimeout limits a single xmlsec1 run
+const defaultTimeout = 10 * time.Second
+
+// Verifier runs xmlsec1 to verify the response signatures, it implements fiskalhrgo.ResponseVerifier
+type Verifier struct {
+	// Path of the xmlsec1 binary, "xmlsec1" from PATH if empty
+	Path string
+
+	// Timeout of a single verification, 10 seconds if zero
+	Timeout time.Duration
+}
+
+// VerifyResponse verifies the signature of the message in the SOAP Body of the response with the CIS certificate.
+// The signature must be enveloped in the message and reference it by its Id, so a signed element can't be
+// wrapped in an unsigned message.
+func (v *Verifier) VerifyResponse(response []byte, cisCert *x509.Certificate) error {
+	if cisCert == nil {
+		return errors.New("the CIS certificate is not set")
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(response); err != nil {
+		return fmt.Errorf("failed to parse XML: %v", err)
+	}
+	message, err := signedMessage(doc)
+	if err != nil {
+		return err
+	}
+	signed, err := doc.WriteToBytes()
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "fiskalhrgo-xmlsec")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	responsePath := filepath.Join(dir, "response.xml")
+	certPath := filepath.Join(dir, "cis.pem")
+	if err := os.WriteFile(responsePath, signed, 0600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cisCert.Raw}), 0600); err != nil {
+		return err
+	}
+
+	idNode := message.Tag
+	if ns := message.NamespaceURI(); ns != "" {
+		idNode = ns + ":" + message.Tag
+	}
+
+	path := v.Path
+	if path == "" {
+		path = "xmlsec1"
+	}
+	timeout := v.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, path, "--verify",
+		"--pubkey-cert-pem", certPath,
+		"--id-attr:Id", idNode,
+		"--enabled-reference-uris", "same-doc",
+		responsePath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("xmlsec1 verification failed: %v: %s", err, bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+// signedMessage checks the structure of the response and returns the only message in the SOAP Body.
+// The KeyInfo is removed from the signature, so xmlsec1 uses only the CIS certificate.
+func signedMessage(doc *etree.Document) (*etree.Element, error) {
+	root := doc.Root()
+	if root == nil || root.Tag != "Envelope" {
+		return nil, errors.New("SOAP Envelope not found")
+	}
+	body := root.SelectElement("Body")
+	if body == nil || len(body.ChildElements()) != 1 {
+		return nil, errors.New("the SOAP Body must contain exactly one message")
+	}
+	message := body.ChildElements()[0]
+
+	signatures := message.SelectElements("Signature")
+	if len(signatures) == 0 {
+		return nil, errors.New("the response is not signed")
+	}
+	if len(signatures) > 1 || len(doc.FindElements("//Signature")) != 1 {
+		return nil, errors.New("more than one signature")
+	}
+	signature := signatures[0]
+
+	id := message.SelectAttrValue("Id", "")
+	references := doc.FindElements("//Signature/SignedInfo/Reference")
+	if id == "" || len(references) != 1 || references[0].SelectAttrValue("URI", "") != "#"+id {
+		return nil, errors.New("signature reference does not match the message Id")
+	}
+
+	if keyInfo := signature.SelectElement("KeyInfo"); keyInfo != nil {
+		signature.RemoveChild(keyInfo)
+	}
+	return message, nil
+}
@@ -0,0 +1,127 @@
+package xmlsec
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"crypto/x509"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	fiskalhrgo "github.com/l-d-t/fiskalhrgo"
+	"github.com/l-d-t/fiskalhrgo/ciscmock"
+	"github.com/l-d-t/fiskalhrgo/fiskaltest"
+)
+
+const signedResponse = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><tns:RacunOdgovor xmlns:tns="http://www.apis-it.hr/fin/2012/types/f73" Id="G0x1"><tns:Jir>9d6f5bb6-da48-4fcd-a803-4586a025e0e4</tns:Jir><Signature xmlns="http://www.w3.org/2000/09/xmldsig#"><SignedInfo><Reference URI="#G0x1"/></SignedInfo><SignatureValue>c2ln</SignatureValue><KeyInfo><X509Data/></KeyInfo></Signature></tns:RacunOdgovor></soap:Body></soap:Envelope>`
+
+func testCertificate(t *testing.T) *x509.Certificate {
+	t.Helper()
+	cert, err := fiskaltest.NewCertificate(fiskaltest.OIB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.Cert
+}
+
+// fakeXmlsec1 writes a script recording the arguments and the verified file, exiting with the status
+func fakeXmlsec1(t *testing.T, status string) (string, string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake xmlsec1 is a shell script")
+	}
+	dir := t.TempDir()
+	script := filepath.Join(dir, "xmlsec1")
+	content := "#!/bin/sh\nfor a; do last=$a; done\necho \"$@\" > " + dir + "/args\ncp \"$last\" " + dir + "/response.xml\necho verification output >&2\nexit " + status + "\n"
+	if err := os.WriteFile(script, []byte(content), 0700); err != nil {
+		t.Fatal(err)
+	}
+	return script, dir
+}
+
+func TestVerifyResponse(t *testing.T) {
+	cert := testCertificate(t)
+	script, dir := fakeXmlsec1(t, "0")
+
+	verifier := &Verifier{Path: script}
+	if err := verifier.VerifyResponse([]byte(signedResponse), cert); err != nil {
+		t.Fatalf("Expected the verification to pass, got %v", err)
+	}
+	args, _ := os.ReadFile(filepath.Join(dir, "args"))
+	if !strings.Contains(string(args), "--verify --pubkey-cert-pem") || !strings.Contains(string(args), "--id-attr:Id http://www.apis-it.hr/fin/2012/types/f73:RacunOdgovor") {
+		t.Errorf("Unexpected xmlsec1 arguments: %s", args)
+	}
+	verified, _ := os.ReadFile(filepath.Join(dir, "response.xml"))
+	if strings.Contains(string(verified), "KeyInfo") || !strings.Contains(string(verified), "SignatureValue") {
+		t.Errorf("Expected the KeyInfo to be removed, got %s", verified)
+	}
+
+	failing, _ := fakeXmlsec1(t, "1")
+	err := (&Verifier{Path: failing}).VerifyResponse([]byte(signedResponse), cert)
+	if err == nil || !strings.Contains(err.Error(), "verification output") {
+		t.Errorf("Expected the xmlsec1 failure with its output, got %v", err)
+	}
+}
+
+func TestVerifyResponseStructure(t *testing.T) {
+	cert := testCertificate(t)
+	verifier := &Verifier{Path: filepath.Join(t.TempDir(), "not-called")}
+	for name, response := range map[string]string{
+		"not XML":      "maintenance",
+		"no envelope":  `<RacunOdgovor Id="G0x1"/>`,
+		"unsigned":     strings.Replace(signedResponse, `<Signature xmlns="http://www.w3.org/2000/09/xmldsig#"><SignedInfo><Reference URI="#G0x1"/></SignedInfo><SignatureValue>c2ln</SignatureValue><KeyInfo><X509Data/></KeyInfo></Signature>`, "", 1),
+		"wrong Id":     strings.Replace(signedResponse, `Id="G0x1"`, `Id="G0x2"`, 1),
+		"two messages": strings.Replace(signedResponse, "<soap:Body>", "<soap:Body><tns:RacunOdgovor xmlns:tns=\"http://www.apis-it.hr/fin/2012/types/f73\"/>", 1),
+	} {
+		err := verifier.VerifyResponse([]byte(response), cert)
+		if err == nil || strings.Contains(err.Error(), "xmlsec1") {
+			t.Errorf("%s: expected a structure error, got %v", name, err)
+		}
+	}
+	if err := verifier.VerifyResponse([]byte(signedResponse), nil); err == nil {
+		t.Errorf("Expected an error without the CIS certificate")
+	}
+}
+
+// TestXmlsec1 verifies the responses of the mock CIS with the real xmlsec1, if it's installed
+func TestXmlsec1(t *testing.T) {
+	if _, err := exec.LookPath("xmlsec1"); err != nil {
+		t.Skip("xmlsec1 is not installed")
+	}
+	cert, err := fiskaltest.NewCertificate(fiskaltest.OIB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fe, err := fiskalhrgo.NewFiskalEntityWithOptions(fiskaltest.OIB, fiskalhrgo.WithLocation("XMLSEC"), fiskalhrgo.WithDemoMode(true),
+		fiskalhrgo.WithSigner(cert.Key, cert.Cert, cert.CACert), fiskalhrgo.WithChainVerification(false),
+		fiskalhrgo.WithResponseVerifier(&Verifier{}), fiskalhrgo.WithClock(fiskaltest.Clock))
+	if err != nil {
+		t.Fatalf("Failed to create entity: %v", err)
+	}
+	server := ciscmock.NewServer()
+	defer server.Close()
+	if err := server.Configure(fe); err != nil {
+		t.Fatal(err)
+	}
+	invoice, _, err := fe.NewCISInvoice(time.Now(), 1, 1, nil, nil, nil, "0.00", "0.00", "0.00", nil, "10.00", fiskalhrgo.CISCash, "12345678901")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := invoice.InvoiceRequest(); err != nil {
+		t.Errorf("Expected xmlsec1 to verify the mock response, got %v", err)
+	}
+
+	server.SetResponder(func(req *ciscmock.Request) *ciscmock.Response {
+		return &ciscmock.Response{Unsigned: true}
+	})
+	if _, _, err := invoice.InvoiceRequest(); !errors.Is(err, fiskalhrgo.ErrResponseSignature) {
+		t.Errorf("Expected ErrResponseSignature for an unsigned response, got %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ZKIAudit is the result of recomputing the ZKI of the journaled invoices
+type ZKIAudit struct {
+	// Checked is the number of the invoices checked
+	Checked int
+
+	// Findings are the invoices whose ZKI could not be confirmed, ordered as in the journal
+	Findings []*ZKIAuditFinding
+}
+
+// OK reports if the ZKI of every checked invoice was confirmed
+func (a *ZKIAudit) OK() bool {
+	return len(a.Findings) == 0
+}
+
+// ZKIAuditFinding is an invoice whose ZKI could not be confirmed
+type ZKIAuditFinding struct {
+	Entry *JournalEntry
+
+	// Err is ErrZKIMismatch if the recomputed ZKI differs (the journaled data doesn't match the ZKI),
+	// ErrCertificateNotFound if the recorded certificate is not known to the entity, or the problem with the entry
+	Err error
+}
+
+// AuditZKI walks the journal entries in [from, to) and recomputes the ZKI of every invoice with the certificate
+// recorded for it, found among the certificates of the entity (the current one, the certificate provider and
+// the CertArchive). This is the proof an inspection demands: the invoice data was not modified after it was issued.
+// Every invoice is checked once, the error is returned only if the journal can't be read.
+func (fe *FiskalEntity) AuditZKI(journal Journal, from, to time.Time) (*ZKIAudit, error) {
+	if journal == nil {
+		return nil, errors.New("journal is nil")
+	}
+	entries, err := journal.Range(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	audit := &ZKIAudit{}
+	certs := make(map[string]*certManager)
+	checked := make(map[string]bool)
+	for _, entry := range entries {
+		if checked[entry.ZKI] {
+			continue
+		}
+		checked[entry.ZKI] = true
+		audit.Checked++
+		if err := fe.auditEntry(entry, certs); err != nil {
+			audit.Findings = append(audit.Findings, &ZKIAuditFinding{Entry: entry, Err: err})
+		}
+	}
+	return audit, nil
+}
+
+// auditEntry recomputes the ZKI of the journal entry, the certificates are cached by the serial number
+func (fe *FiskalEntity) auditEntry(entry *JournalEntry, certs map[string]*certManager) error {
+	cm, ok := certs[entry.CertSerial]
+	if !ok {
+		cert, err := fe.FindCertificate(entry.CertSerial)
+		if err != nil {
+			return fmt.Errorf("%w: serial %s", err, entry.CertSerial)
+		}
+		if cm, err = fe.certManagerFor(cert); err != nil {
+			return err
+		}
+		certs[entry.CertSerial] = cm
+	}
+
+	number, _, _ := strings.Cut(entry.InvoiceNumber, "/")
+	invoiceNumber, err := strconv.ParseUint(number, 10, 0)
+	if err != nil {
+		return fmt.Errorf("invalid invoice number %q", entry.InvoiceNumber)
+	}
+	issued, err := time.ParseInLocation("02.01.2006T15:04:05", entry.IssuedAt, time.Local)
+	if err != nil {
+		return fmt.Errorf("invalid issue date %q", entry.IssuedAt)
+	}
+	hashed, err := zkiDigest(fe.oib, issued, uint(invoiceNumber), entry.Location, entry.Device, entry.Total)
+	if err != nil {
+		return err
+	}
+	signature, err := cm.signZKI(hashed[:])
+	if err != nil {
+		return fmt.Errorf("failed to sign data: %w", err)
+	}
+	if !strings.EqualFold(zkiFromSignature(signature), entry.ZKI) {
+		return ErrZKIMismatch
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAuditZKI(t *testing.T) {
+	fe := newTestEntity(t)
+	serial := fe.certificate().certSERIAL
+	issued := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	entry := func(number uint, total string) *JournalEntry {
+		zki, err := fe.GenerateZKI(issued, number, 1, total)
+		if err != nil {
+			t.Fatalf("Failed to generate ZKI: %v", err)
+		}
+		return &JournalEntry{
+			Time:          issued,
+			InvoiceNumber: invoiceNumber(&RacunType{BrRac: &BrojRacunaType{BrOznRac: number, OznPosPr: fe.locationID, OznNapUr: 1}}),
+			Location:      fe.locationID,
+			Device:        1,
+			IssuedAt:      issued.Format("02.01.2006T15:04:05"),
+			Total:         total,
+			ZKI:           zki,
+			CertSerial:    serial,
+		}
+	}
+
+	journal := NewMemoryJournal()
+	valid := entry(1, "10.00")
+	retried := *valid
+	retried.Time = issued.Add(time.Minute)
+	tampered := entry(2, "20.00")
+	tampered.Total = "2.00"
+	unknownCert := entry(3, "30.00")
+	unknownCert.CertSerial = "12345"
+	for _, e := range []*JournalEntry{valid, &retried, tampered, unknownCert} {
+		if err := journal.Append(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	audit, err := fe.AuditZKI(journal, issued.Add(-time.Minute), issued.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("AuditZKI failed: %v", err)
+	}
+	if audit.Checked != 3 || audit.OK() || len(audit.Findings) != 2 {
+		t.Fatalf("Expected 3 invoices checked with 2 findings, got %d %+v", audit.Checked, audit.Findings)
+	}
+	if audit.Findings[0].Entry.ZKI != tampered.ZKI || !errors.Is(audit.Findings[0].Err, ErrZKIMismatch) {
+		t.Errorf("Expected the mismatch of the tampered invoice, got %v", audit.Findings[0].Err)
+	}
+	if audit.Findings[1].Entry.ZKI != unknownCert.ZKI || !errors.Is(audit.Findings[1].Err, ErrCertificateNotFound) {
+		t.Errorf("Expected the unknown certificate, got %v", audit.Findings[1].Err)
+	}
+
+	if audit, err := fe.AuditZKI(journal, issued.Add(-time.Hour), issued); err != nil || audit.Checked != 0 || !audit.OK() {
+		t.Errorf("Expected an empty audit, got %+v %v", audit, err)
+	}
+}
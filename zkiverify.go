@@ -0,0 +1,67 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/l-d-t/fiskalhrgo/sign"
+)
+
+// VerifyZKI recalculates the ZKI from the invoice data with the certificate (the current or a historical one, e.g.
+// from the CertArchive) and returns ErrZKIMismatch if it differs. Unlike FindZKICertificate it doesn't need an entity,
+// so auditors and inspection tools can check a stored ZKI with the certificate of the taxpayer.
+// The OIB must be the OIB of the certificate, expired certificates are allowed.
+//
+// The ZKI is the MD5 hash of the signature, so it can only be recalculated with the private key (the Signer).
+// With just the public key, the ZKI can be verified only if the full signature was kept, see VerifyZKISignature.
+func VerifyZKI(zki string, oib string, issueDateTime time.Time, invoiceNumber uint, locationID string, deviceID uint, totalAmount string, cert *Certificate) error {
+	if cert == nil || cert.Cert == nil {
+		return errors.New("certificate is nil")
+	}
+	cm := newCertManager()
+	if err := cm.setSigner(cert.Signer, cert.Cert, cert.CACerts); err != nil {
+		return fmt.Errorf("certificate setup fail: %v", err)
+	}
+	if cm.certOIB != oib {
+		return errors.New("OIB does not match the certificate")
+	}
+	hashed, err := zkiDigest(oib, issueDateTime, invoiceNumber, locationID, deviceID, totalAmount)
+	if err != nil {
+		return err
+	}
+	signature, err := cm.signZKI(hashed[:])
+	if err != nil {
+		return fmt.Errorf("failed to sign data: %w", err)
+	}
+	if !strings.EqualFold(zkiFromSignature(signature), zki) {
+		return ErrZKIMismatch
+	}
+	return nil
+}
+
+// VerifyZKISignature verifies the ZKI with just the public key of the certificate, for systems that keep the full
+// signature of the ZKI data (the ZKI is its MD5 hash). The signature must be valid for the invoice data and the
+// public key (RSA PKCS #1 v1.5 or raw r||s ECDSA over SHA1) and its MD5 hash must be the ZKI, ErrZKIMismatch otherwise.
+func VerifyZKISignature(zki string, signature []byte, oib string, issueDateTime time.Time, invoiceNumber uint, locationID string, deviceID uint, totalAmount string, publicKey crypto.PublicKey) error {
+	if publicKey == nil {
+		return errors.New("public key is nil")
+	}
+	hashed, err := zkiDigest(oib, issueDateTime, invoiceNumber, locationID, deviceID, totalAmount)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(zkiFromSignature(signature), zki) {
+		return ErrZKIMismatch
+	}
+	if err := sign.VerifySignatureValue(publicKey, crypto.SHA1, hashed[:], signature); err != nil {
+		return fmt.Errorf("%w: %v", ErrZKIMismatch, err)
+	}
+	return nil
+}
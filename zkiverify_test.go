@@ -0,0 +1,64 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerifyZKI(t *testing.T) {
+	key, cert, _ := newP12TestCert(t, testOIB)
+	otherKey, otherCert, _ := newP12TestCert(t, testOIB)
+	fe, err := NewFiskalEntityWithOptions(testOIB, WithLocation("ZKI1"), WithSigner(key, cert), WithChainVerification(false))
+	if err != nil {
+		t.Fatalf("Failed to create entity: %v", err)
+	}
+	issued := time.Date(2026, 1, 1, 10, 30, 0, 0, time.Local)
+	zki, err := fe.GenerateZKI(issued, 7, 2, "125.00")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current := &Certificate{Signer: key, Cert: cert}
+	if err := VerifyZKI(zki, testOIB, issued, 7, "ZKI1", 2, "125.00", current); err != nil {
+		t.Errorf("Expected a valid ZKI, got %v", err)
+	}
+	if err := VerifyZKI(zki, testOIB, issued, 7, "ZKI1", 2, "125.01", current); !errors.Is(err, ErrZKIMismatch) {
+		t.Errorf("Expected ErrZKIMismatch for a modified amount, got %v", err)
+	}
+	if err := VerifyZKI(zki, testOIB, issued, 7, "ZKI1", 2, "125.00", &Certificate{Signer: otherKey, Cert: otherCert}); !errors.Is(err, ErrZKIMismatch) {
+		t.Errorf("Expected ErrZKIMismatch for another certificate, got %v", err)
+	}
+	if err := VerifyZKI(zki, "12345678903", issued, 7, "ZKI1", 2, "125.00", current); err == nil {
+		t.Errorf("Expected an error for an OIB of another taxpayer")
+	}
+	if err := VerifyZKI(zki, testOIB, issued, 7, "ZKI1", 2, "125", current); err == nil || errors.Is(err, ErrZKIMismatch) {
+		t.Errorf("Expected an error for an invalid amount, got %v", err)
+	}
+
+	// With the kept signature, the public key is enough
+	digest, err := zkiDigest(testOIB, issued, 7, "ZKI1", 2, "125.00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA1, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyZKISignature(zki, signature, testOIB, issued, 7, "ZKI1", 2, "125.00", cert.PublicKey); err != nil {
+		t.Errorf("Expected a valid ZKI signature, got %v", err)
+	}
+	if err := VerifyZKISignature(zki, signature, testOIB, issued, 8, "ZKI1", 2, "125.00", cert.PublicKey); !errors.Is(err, ErrZKIMismatch) {
+		t.Errorf("Expected ErrZKIMismatch for a modified invoice number, got %v", err)
+	}
+	if err := VerifyZKISignature(zki, signature, testOIB, issued, 7, "ZKI1", 2, "125.00", otherCert.PublicKey); !errors.Is(err, ErrZKIMismatch) {
+		t.Errorf("Expected ErrZKIMismatch for another public key, got %v", err)
+	}
+}
@@ -0,0 +1,207 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/l-d-t/fiskalhrgo/validate"
+)
+
+// ZReport is the end-of-day summary of a single device, the numbers needed by the cashier closing procedure
+type ZReport struct {
+	// Date is the start of the day
+	Date time.Time
+
+	// Location (OznPosPr) and Device (OznNapUr) of the report
+	Location string
+	Device   uint
+
+	// Invoices is the number of the invoices sent to CIS during the day, Total their total amount
+	Invoices int
+	Total    string
+
+	// Fiscalized is the number of the invoices that got the JIR, LateDelivered the number of those
+	// delivered after they were issued (NakDost)
+	Fiscalized    int
+	LateDelivered int
+
+	// Failed lists the ZKI of the invoices without the JIR, they must still be delivered to CIS
+	Failed []string
+
+	// PaymentMethods and Taxes are the totals per payment method and per tax type and rate
+	PaymentMethods []ZReportPaymentMethod
+	Taxes          []ZReportTax
+}
+
+// ZReportPaymentMethod is the total of the invoices paid with the payment method
+type ZReportPaymentMethod struct {
+	Method   PaymentMethod
+	Invoices int
+	Total    string
+}
+
+// ZReportTax is the total of a tax type and rate
+type ZReportTax struct {
+	// Type is "PDV", "PNP" or the name of the other tax
+	Type     string
+	Rate     string
+	Invoices int
+	Base     string
+	Amount   string
+}
+
+// BuildZReports summarizes the journal entries of the day (in the location of day), a report for every device.
+// The attempts of an invoice are counted once: it is fiscalized if any attempt during the day got the JIR.
+// The reports are ordered by location and device.
+func BuildZReports(journal Journal, day time.Time) ([]*ZReport, error) {
+	if journal == nil {
+		return nil, errors.New("journal is nil")
+	}
+	from := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	entries, err := journal.Range(from, from.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+
+	// The last attempt of every invoice, or the successful one
+	type deviceKey struct {
+		location string
+		device   uint
+	}
+	invoices := make(map[deviceKey]map[string]*JournalEntry)
+	for _, entry := range entries {
+		key := deviceKey{entry.Location, entry.Device}
+		if invoices[key] == nil {
+			invoices[key] = make(map[string]*JournalEntry)
+		}
+		if previous := invoices[key][entry.ZKI]; previous == nil || previous.JIR == "" {
+			invoices[key][entry.ZKI] = entry
+		}
+	}
+
+	reports := make([]*ZReport, 0, len(invoices))
+	for key, byZKI := range invoices {
+		report, err := buildZReport(from, key.location, key.device, byZKI)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		if reports[i].Location != reports[j].Location {
+			return reports[i].Location < reports[j].Location
+		}
+		return reports[i].Device < reports[j].Device
+	})
+	return reports, nil
+}
+
+// buildZReport sums the invoices of a single device
+func buildZReport(date time.Time, location string, device uint, invoices map[string]*JournalEntry) (*ZReport, error) {
+	report := &ZReport{Date: date, Location: location, Device: device, Invoices: len(invoices)}
+
+	type taxKey struct{ taxType, rate string }
+	type taxSum struct {
+		invoices     int
+		base, amount int64
+	}
+	var total int64
+	methods := make(map[PaymentMethod]*ZReportPaymentMethod)
+	methodTotals := make(map[PaymentMethod]int64)
+	taxes := make(map[taxKey]*taxSum)
+
+	zkis := make([]string, 0, len(invoices))
+	for zki := range invoices {
+		zkis = append(zkis, zki)
+	}
+	sort.Strings(zkis)
+	for _, zki := range zkis {
+		entry := invoices[zki]
+		if entry.JIR != "" {
+			report.Fiscalized++
+			if entry.LateDelivery {
+				report.LateDelivered++
+			}
+		} else {
+			report.Failed = append(report.Failed, zki)
+		}
+
+		amount, err := parseCents(entry.Total)
+		if err != nil {
+			return nil, fmt.Errorf("invoice %s: invalid total: %w", entry.InvoiceNumber, err)
+		}
+		total += amount
+		method := PaymentMethod(entry.PaymentMethod)
+		if methods[method] == nil {
+			methods[method] = &ZReportPaymentMethod{Method: method}
+		}
+		methods[method].Invoices++
+		methodTotals[method] += amount
+
+		for _, tax := range entry.Taxes {
+			base, err := parseCents(tax.Base)
+			if err != nil {
+				return nil, fmt.Errorf("invoice %s: invalid tax base: %w", entry.InvoiceNumber, err)
+			}
+			amount, err := parseCents(tax.Amount)
+			if err != nil {
+				return nil, fmt.Errorf("invoice %s: invalid tax amount: %w", entry.InvoiceNumber, err)
+			}
+			key := taxKey{tax.Type, tax.Rate}
+			if taxes[key] == nil {
+				taxes[key] = &taxSum{}
+			}
+			taxes[key].invoices++
+			taxes[key].base += base
+			taxes[key].amount += amount
+		}
+	}
+
+	report.Total = formatCents(total)
+	for method, sum := range methods {
+		sum.Total = formatCents(methodTotals[method])
+		report.PaymentMethods = append(report.PaymentMethods, *sum)
+	}
+	sort.Slice(report.PaymentMethods, func(i, j int) bool { return report.PaymentMethods[i].Method < report.PaymentMethods[j].Method })
+	for key, sum := range taxes {
+		report.Taxes = append(report.Taxes, ZReportTax{
+			Type:     key.taxType,
+			Rate:     key.rate,
+			Invoices: sum.invoices,
+			Base:     formatCents(sum.base),
+			Amount:   formatCents(sum.amount),
+		})
+	}
+	sort.Slice(report.Taxes, func(i, j int) bool {
+		if report.Taxes[i].Type != report.Taxes[j].Type {
+			return report.Taxes[i].Type < report.Taxes[j].Type
+		}
+		return report.Taxes[i].Rate < report.Taxes[j].Rate
+	})
+	return report, nil
+}
+
+// parseCents parses an amount with two decimals into cents
+func parseCents(amount string) (int64, error) {
+	if !validate.SignedAmount(amount) {
+		return 0, fmt.Errorf("invalid amount %q", amount)
+	}
+	return strconv.ParseInt(strings.Replace(amount, ".", "", 1), 10, 64)
+}
+
+// formatCents formats cents as an amount with two decimals
+func formatCents(cents int64) string {
+	sign := ""
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
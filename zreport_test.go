@@ -0,0 +1,92 @@
+package fiskalhrgo
+
+// SPDX-License-Identifier: MIT
+// Copyright (c) 2024 L. D. T. d.o.o.
+// Copyright (c) contributors for their respective contributions. See https://github.com/l-d-t/fiskalhrgo/graphs/contributors
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBuildZReports(t *testing.T) {
+	day := time.Date(2024, 5, 17, 0, 0, 0, 0, time.Local)
+	vat := func(rate, base, amount string) []JournalTax {
+		return []JournalTax{{Type: "PDV", Rate: rate, Base: base, Amount: amount}}
+	}
+	journal := NewMemoryJournal()
+	for _, entry := range []*JournalEntry{
+		// Fiscalized at once
+		{Time: day.Add(8 * time.Hour), Location: "POS1", Device: 1, ZKI: "a", JIR: "jir-a", Total: "12.50", PaymentMethod: "G", Taxes: vat("25.00", "10.00", "2.50")},
+		// Failed, then delivered late
+		{Time: day.Add(9 * time.Hour), Location: "POS1", Device: 1, ZKI: "b", Total: "10.50", PaymentMethod: "K", Taxes: vat("5.00", "10.00", "0.50"), Error: "timeout"},
+		{Time: day.Add(11 * time.Hour), Location: "POS1", Device: 1, ZKI: "b", JIR: "jir-b", LateDelivery: true, Total: "10.50", PaymentMethod: "K", Taxes: vat("5.00", "10.00", "0.50")},
+		// Failed twice
+		{Time: day.Add(10 * time.Hour), Location: "POS1", Device: 1, ZKI: "c", Total: "25.00", PaymentMethod: "G", Taxes: vat("25.00", "20.00", "5.00"), Error: "timeout"},
+		{Time: day.Add(12 * time.Hour), Location: "POS1", Device: 1, ZKI: "c", Total: "25.00", PaymentMethod: "G", Taxes: vat("25.00", "20.00", "5.00"), Error: "timeout"},
+		// Cancellation
+		{Time: day.Add(13 * time.Hour), Location: "POS1", Device: 1, ZKI: "d", JIR: "jir-d", Total: "-12.50", PaymentMethod: "G", Taxes: vat("25.00", "-10.00", "-2.50")},
+		// Another device and another day
+		{Time: day.Add(14 * time.Hour), Location: "POS1", Device: 2, ZKI: "e", JIR: "jir-e", Total: "1.00", PaymentMethod: "K"},
+		{Time: day.Add(25 * time.Hour), Location: "POS1", Device: 1, ZKI: "f", JIR: "jir-f", Total: "99.00", PaymentMethod: "G"},
+	} {
+		if err := journal.Append(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reports, err := BuildZReports(journal, day.Add(15*time.Hour))
+	if err != nil {
+		t.Fatalf("BuildZReports failed: %v", err)
+	}
+	if len(reports) != 2 || reports[0].Device != 1 || reports[1].Device != 2 {
+		t.Fatalf("Expected the reports of both devices in order, got %+v", reports)
+	}
+
+	want := &ZReport{
+		Date:          day,
+		Location:      "POS1",
+		Device:        1,
+		Invoices:      4,
+		Total:         "35.50",
+		Fiscalized:    3,
+		LateDelivered: 1,
+		Failed:        []string{"c"},
+		PaymentMethods: []ZReportPaymentMethod{
+			{Method: CISCash, Invoices: 3, Total: "25.00"},
+			{Method: CISCard, Invoices: 1, Total: "10.50"},
+		},
+		Taxes: []ZReportTax{
+			{Type: "PDV", Rate: "25.00", Invoices: 3, Base: "20.00", Amount: "5.00"},
+			{Type: "PDV", Rate: "5.00", Invoices: 1, Base: "10.00", Amount: "0.50"},
+		},
+	}
+	if !reflect.DeepEqual(reports[0], want) {
+		t.Errorf("Unexpected report\n got: %+v\nwant: %+v", reports[0], want)
+	}
+	if reports[1].Invoices != 1 || reports[1].Total != "1.00" || reports[1].Taxes != nil {
+		t.Errorf("Unexpected report of the second device %+v", reports[1])
+	}
+
+	if reports, err := BuildZReports(journal, day.AddDate(0, 0, -1)); err != nil || len(reports) != 0 {
+		t.Errorf("Expected no reports for a day without invoices, got %d %v", len(reports), err)
+	}
+	if err := journal.Append(&JournalEntry{Time: day.Add(16 * time.Hour), ZKI: "g", Total: "1,00"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := BuildZReports(journal, day); err == nil {
+		t.Error("Expected an error for an invalid total")
+	}
+}
+
+func TestFormatCents(t *testing.T) {
+	for cents, want := range map[int64]string{0: "0.00", 5: "0.05", 1250: "12.50", -5: "-0.05", -1250: "-12.50"} {
+		if got := formatCents(cents); got != want {
+			t.Errorf("formatCents(%d) = %s, want %s", cents, got, want)
+		}
+		if got, err := parseCents(want); err != nil || got != cents {
+			t.Errorf("parseCents(%s) = %d %v, want %d", want, got, err, cents)
+		}
+	}
+}